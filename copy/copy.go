@@ -25,6 +25,7 @@ import (
 	"github.com/containers/image/v5/types"
 	encconfig "github.com/containers/ocicrypt/config"
 	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/sync/semaphore"
 	"golang.org/x/term"
@@ -72,14 +73,19 @@ type ImageListSelection int
 
 // Options allows supplying non-default configuration modifying the behavior of CopyImage.
 type Options struct {
-	RemoveSignatures bool // Remove any pre-existing signatures. Signers and SignBy… will still add a new signature.
+	// Remove any pre-existing signatures: they are not read from the source, and not written to the destination.
+	// Signers and SignBy… will still add a new signature.
+	// This does not affect verifying the source image against the policy, which reads the source signatures independently;
+	// a policy requiring signatures still requires them on the source.
+	RemoveSignatures bool
 	// Signers to use to add signatures during the copy.
 	// Callers are still responsible for closing these Signer objects; they can be reused for multiple copy.Image operations in a row.
 	Signers                          []*signer.Signer
 	SignBy                           string          // If non-empty, asks for a signature to be added during the copy, and specifies a key ID, as accepted by signature.NewGPGSigningMechanism().SignDockerManifest(),
 	SignPassphrase                   string          // Passphrase to use when signing with the key ID from `SignBy`.
 	SignBySigstorePrivateKeyFile     string          // If non-empty, asks for a signature to be added during the copy, using a sigstore private key file at the provided path.
-	SignSigstorePrivateKeyPassphrase []byte          // Passphrase to use when signing with `SignBySigstorePrivateKeyFile`.
+	SignBySigstorePrivateKey         []byte          // If non-empty, asks for a signature to be added during the copy, using the provided sigstore private key (the contents of a private key file).
+	SignSigstorePrivateKeyPassphrase []byte          // Passphrase to use when signing with `SignBySigstorePrivateKeyFile` or `SignBySigstorePrivateKey`.
 	SignIdentity                     reference.Named // Identify to use when signing, defaults to the docker reference of the destination
 
 	ReportWriter     io.Writer
@@ -116,7 +122,8 @@ type Options struct {
 	// A weighted semaphore to limit the amount of concurrently copied layers and configs. Applies to all copy operations using the semaphore. If set, MaxParallelDownloads is ignored.
 	ConcurrentBlobCopiesSemaphore *semaphore.Weighted
 
-	// MaxParallelDownloads indicates the maximum layers to pull at the same time. Applies to a single copy operation. A reasonable default is used if this is left as 0. Ignored if ConcurrentBlobCopiesSemaphore is set.
+	// MaxParallelDownloads indicates the maximum layers to pull at the same time. Applies to a single copy operation.
+	// If this is left as 0, SourceCtx.MaxParallelDownloads is used if set, otherwise a reasonable default. Ignored if ConcurrentBlobCopiesSemaphore is set.
 	MaxParallelDownloads uint
 
 	// When OptimizeDestinationImageAlreadyExists is set, optimize the copy assuming that the destination image already
@@ -128,6 +135,12 @@ type Options struct {
 	// to not indicate "nondistributable".
 	DownloadForeignLayers bool
 
+	// If ManifestOnly is set, only the manifest, the config and the signatures are copied; layers are never read from the
+	// source nor written to the destination. Every layer must already be present at the destination, otherwise the copy fails;
+	// in particular, destinations which store layer contents locally (e.g. containers-storage) never fetch missing layers later.
+	// This is incompatible with encrypting or decrypting layers, and with DownloadForeignLayers.
+	ManifestOnly bool
+
 	// Contains slice of OptionCompressionVariant, where copy will ensure that for each platform
 	// in the manifest list, a variant with the requested compression will exist.
 	// Invalid when copying a non-multi-architecture image. That will probably
@@ -148,6 +161,36 @@ type Options struct {
 	// so that storage.ResolveReference returns exactly the created image.
 	// WARNING: It is unspecified whether the reference also contains a reference.Named element.
 	ReportResolvedReference *types.ImageReference
+
+	// If TransferLog is set, it is informed about every blob copied to the destination, whether it was
+	// pushed or reused, and about the overall outcome of the copy. It does not affect the copy in any way.
+	TransferLog TransferLogger
+
+	// If ImageTransform is set, it is used to edit the manifest and config of every copied image (but not of manifest lists)
+	// before they are written to the destination. This is not possible if the manifest must not be modified,
+	// e.g. when preserving existing signatures or digests.
+	ImageTransform ImageTransform
+
+	// ReportManifestDescriptor, if set, is set to a descriptor of the manifest written to the destination,
+	// e.g. so that the caller can add it to a manifest list without reading it back from the destination.
+	// If a single image was copied, the descriptor includes the platform, as read from the written image's config;
+	// if a manifest list was copied, the platform is nil.
+	ReportManifestDescriptor *imgspecv1.Descriptor
+
+	// If SkipIfDigestPresent is set, the copy is skipped if the destination already contains a manifest with the digest
+	// of the source manifest that would be copied (the instance chosen for the current system, when copying a single image
+	// from a manifest list); nothing is written to the destination, and the existing manifest is returned.
+	// If the destination contains a different manifest, or it can't be read, the image is copied as usual.
+	// The digest of the unmodified source manifest is compared, so if the manifest would be modified during the copy
+	// (e.g. to convert its format or compression), the copy is never skipped.
+	// The source image is still checked against the policy before the copy is skipped.
+	// The copy is not skipped if signing is requested, or if the source has signatures which would be copied (i.e. unless RemoveSignatures);
+	// the image is copied as usual in that case.
+	// Skipped copies are not reported to TransferLog.
+	SkipIfDigestPresent bool
+	// ReportSkipped, if set, is set to true if the copy was skipped because of SkipIfDigestPresent, and false otherwise.
+	// If the copy was skipped, ReportResolvedReference is set to nil and ReportManifestDescriptor is not modified.
+	ReportSkipped *bool
 }
 
 // OptionCompressionVariant allows to supply information about
@@ -176,6 +219,7 @@ type copier struct {
 	concurrentBlobCopiesSemaphore *semaphore.Weighted // Limits the amount of concurrently copied blobs
 	signers                       []*signer.Signer    // Signers to use to create new signatures for the image
 	signersToClose                []*signer.Signer    // Signers that should be closed when this copier is destroyed.
+	transferLog                   *transferLog        // Never nil
 }
 
 // Internal function to validate `requireCompressionFormatMatch` for copySingleImageOptions
@@ -197,6 +241,14 @@ func Image(ctx context.Context, policyContext *signature.PolicyContext, destRef,
 	if err := validateImageListSelection(options.ImageListSelection); err != nil {
 		return nil, err
 	}
+	if options.ManifestOnly {
+		if options.OciEncryptLayers != nil || options.OciDecryptConfig != nil {
+			return nil, errors.New("copying only the manifest is incompatible with encrypting or decrypting layers")
+		}
+		if options.DownloadForeignLayers {
+			return nil, errors.New("copying only the manifest is incompatible with downloading foreign layers")
+		}
+	}
 
 	reportWriter := io.Discard
 
@@ -218,6 +270,25 @@ func Image(ctx context.Context, policyContext *signature.PolicyContext, destRef,
 		}
 	}
 
+	if options.ReportSkipped != nil {
+		*options.ReportSkipped = false
+	}
+	if options.SkipIfDigestPresent {
+		existing, err := existingManifestIfUnchanged(ctx, policyContext, destRef, srcRef, options)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			if options.ReportSkipped != nil {
+				*options.ReportSkipped = true
+			}
+			if options.ReportResolvedReference != nil {
+				*options.ReportResolvedReference = nil
+			}
+			return existing, nil
+		}
+	}
+
 	publicDest, err := destRef.NewImageDestination(ctx, options.DestinationCtx)
 	if err != nil {
 		return nil, fmt.Errorf("initializing destination %s: %w", transports.ImageName(destRef), err)
@@ -254,6 +325,7 @@ func Image(ctx context.Context, policyContext *signature.PolicyContext, destRef,
 		// For now, use DestinationCtx (because blob reuse changes the behavior of the destination side more).
 		// Conceptually the cache settings should be in copy.Options instead.
 		blobInfoCache: internalblobinfocache.FromBlobInfoCache(blobinfocache.DefaultCache(options.DestinationCtx)),
+		transferLog:   newTransferLog(options.TransferLog),
 	}
 	defer c.close()
 	c.blobInfoCache.Open()
@@ -264,6 +336,9 @@ func Image(ctx context.Context, policyContext *signature.PolicyContext, destRef,
 		c.concurrentBlobCopiesSemaphore = c.options.ConcurrentBlobCopiesSemaphore
 		if c.concurrentBlobCopiesSemaphore == nil {
 			max := c.options.MaxParallelDownloads
+			if max == 0 && c.options.SourceCtx != nil {
+				max = c.options.SourceCtx.MaxParallelDownloads
+			}
 			if max == 0 {
 				max = maxParallelDownloads
 			}
@@ -287,6 +362,8 @@ func Image(ctx context.Context, policyContext *signature.PolicyContext, destRef,
 	if err != nil {
 		return nil, fmt.Errorf("determining manifest MIME type for %s: %w", transports.ImageName(srcRef), err)
 	}
+	copiedManifestMIMEType := ""
+	var copiedPlatform *imgspecv1.Platform // Only set if options.ReportManifestDescriptor != nil
 
 	if !multiImage {
 		if len(options.EnsureCompressionVariantsExist) > 0 {
@@ -302,6 +379,8 @@ func Image(ctx context.Context, policyContext *signature.PolicyContext, destRef,
 			return nil, err
 		}
 		copiedManifest = single.manifest
+		copiedManifestMIMEType = single.manifestMIMEType
+		copiedPlatform = single.platform
 	} else if c.options.ImageListSelection == CopySystemImage {
 		if len(options.EnsureCompressionVariantsExist) > 0 {
 			return nil, fmt.Errorf("EnsureCompressionVariantsExist is not implemented when not creating a multi-architecture image")
@@ -331,6 +410,8 @@ func Image(ctx context.Context, policyContext *signature.PolicyContext, destRef,
 			return nil, fmt.Errorf("copying system image from manifest list: %w", err)
 		}
 		copiedManifest = single.manifest
+		copiedManifestMIMEType = single.manifestMIMEType
+		copiedPlatform = single.platform
 	} else { /* c.options.ImageListSelection == CopyAllImages or c.options.ImageListSelection == CopySpecificImages, */
 		// If we were asked to copy multiple images and can't, that's an error.
 		if !supportsMultipleImages(c.dest) {
@@ -346,6 +427,7 @@ func Image(ctx context.Context, policyContext *signature.PolicyContext, destRef,
 		if copiedManifest, err = c.copyMultipleImages(ctx); err != nil {
 			return nil, err
 		}
+		copiedManifestMIMEType = manifest.GuessMIMEType(copiedManifest)
 	}
 
 	if options.ReportResolvedReference != nil {
@@ -357,6 +439,20 @@ func Image(ctx context.Context, policyContext *signature.PolicyContext, destRef,
 	}); err != nil {
 		return nil, fmt.Errorf("committing the finished image: %w", err)
 	}
+	c.transferLog.complete()
+
+	if options.ReportManifestDescriptor != nil {
+		manifestDigest, err := manifest.Digest(copiedManifest)
+		if err != nil {
+			return nil, err
+		}
+		*options.ReportManifestDescriptor = imgspecv1.Descriptor{
+			MediaType: copiedManifestMIMEType,
+			Digest:    manifestDigest,
+			Size:      int64(len(copiedManifest)),
+			Platform:  copiedPlatform,
+		}
+	}
 
 	return copiedManifest, nil
 }
@@ -0,0 +1,628 @@
+package copy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/image"
+	"github.com/containers/image/v5/internal/imagesource"
+	internalsig "github.com/containers/image/v5/internal/signature"
+	internalSigner "github.com/containers/image/v5/internal/signer"
+	"github.com/containers/image/v5/internal/testing/imagetest"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/oci/layout"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/pkg/compression"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/signature/signer"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestDirImage creates a single-layer image in a new directory and returns a reference to it,
+// along with the digest of its layer.
+func writeTestDirImage(t *testing.T) (types.ImageReference, digest.Digest) {
+	layer, err := os.ReadFile("fixtures/Hello.gz")
+	require.NoError(t, err)
+	uncompressed, err := os.ReadFile("fixtures/Hello.uncompressed")
+	require.NoError(t, err)
+	config, err := json.Marshal(imgspecv1.Image{
+		Platform: imgspecv1.Platform{OS: "linux", Architecture: "amd64"},
+		RootFS:   imgspecv1.RootFS{Type: "layers", DiffIDs: []digest.Digest{digest.FromBytes(uncompressed)}},
+	})
+	require.NoError(t, err)
+
+	ref := imagetest.WriteDirImage(t, imgspecv1.MediaTypeImageManifest, config, []imagetest.Blob{{MediaType: imgspecv1.MediaTypeImageLayerGzip, Data: layer}})
+	return ref, digest.FromBytes(layer)
+}
+
+// mockRegistry is a minimal registry, serving a single repository “repo”, which only supports uploading blobs and manifests.
+type mockRegistry struct {
+	t          *testing.T
+	server     *httptest.Server
+	mutex      sync.Mutex
+	blobs      map[digest.Digest][]byte // Blobs present in the repository
+	uploaded   []digest.Digest          // Blobs uploaded by clients
+	manifests  map[string][]byte        // Manifests, by tag
+	nextUpload int
+}
+
+// newMockRegistry returns a mockRegistry, containing blobs, and a SystemContext configured to access it.
+func newMockRegistry(t *testing.T, blobs map[digest.Digest][]byte) (*mockRegistry, *types.SystemContext) {
+	r := &mockRegistry{
+		t:         t,
+		blobs:     blobs,
+		manifests: map[string][]byte{},
+	}
+	r.server = httptest.NewServer(http.HandlerFunc(r.serveHTTP))
+	t.Cleanup(r.server.Close)
+
+	// An explicitly configured registries.conf file which does not exist is an error; use an empty one.
+	registriesConf := filepath.Join(t.TempDir(), "registries.conf")
+	err := os.WriteFile(registriesConf, []byte{}, 0o600)
+	require.NoError(t, err)
+	return r, &types.SystemContext{
+		RegistriesDirPath:           "/this/does/not/exist",
+		DockerPerHostCertDirPath:    "/this/does/not/exist",
+		SystemRegistriesConfPath:    registriesConf,
+		DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+		BlobInfoCacheDir:            t.TempDir(),
+	}
+}
+
+// reference returns a reference to tag in the repository of r.
+func (r *mockRegistry) reference(tag string) types.ImageReference {
+	registryURL, err := url.Parse(r.server.URL)
+	require.NoError(r.t, err)
+	ref, err := docker.ParseReference("//" + registryURL.Host + "/repo:" + tag)
+	require.NoError(r.t, err)
+	return ref
+}
+
+func (r *mockRegistry) serveHTTP(rw http.ResponseWriter, req *http.Request) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	const blobsPrefix, uploadsPrefix, manifestsPrefix = "/v2/repo/blobs/", "/v2/repo/blobs/uploads/", "/v2/repo/manifests/"
+	switch {
+	case req.Method == http.MethodGet && req.URL.Path == "/v2/":
+		rw.WriteHeader(http.StatusOK)
+	case req.Method == http.MethodPost && req.URL.Path == uploadsPrefix:
+		r.nextUpload++
+		rw.Header().Set("Location", fmt.Sprintf("%s%d", uploadsPrefix, r.nextUpload))
+		rw.WriteHeader(http.StatusAccepted)
+	case req.Method == http.MethodPatch && strings.HasPrefix(req.URL.Path, uploadsPrefix):
+		if _, err := io.Copy(io.Discard, req.Body); err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		rw.Header().Set("Location", req.URL.Path)
+		rw.WriteHeader(http.StatusAccepted)
+	case req.Method == http.MethodPut && strings.HasPrefix(req.URL.Path, uploadsPrefix):
+		d := digest.Digest(req.URL.Query().Get("digest"))
+		// The contents were discarded by the PATCH request; nothing reads them back.
+		r.blobs[d] = []byte{}
+		r.uploaded = append(r.uploaded, d)
+		rw.WriteHeader(http.StatusCreated)
+	case req.Method == http.MethodHead && strings.HasPrefix(req.URL.Path, blobsPrefix):
+		blob, ok := r.blobs[digest.Digest(strings.TrimPrefix(req.URL.Path, blobsPrefix))]
+		if !ok {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		rw.Header().Set("Content-Length", strconv.Itoa(len(blob)))
+		rw.WriteHeader(http.StatusOK)
+	case req.Method == http.MethodPut && strings.HasPrefix(req.URL.Path, manifestsPrefix):
+		manifestBlob, err := io.ReadAll(req.Body)
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		r.manifests[strings.TrimPrefix(req.URL.Path, manifestsPrefix)] = manifestBlob
+		rw.Header().Set("Docker-Content-Digest", digest.FromBytes(manifestBlob).String())
+		rw.WriteHeader(http.StatusCreated)
+	default:
+		assert.Failf(r.t, "Unexpected request", "%v %v", req.Method, req.URL.Path)
+		rw.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func TestImageManifestOnly(t *testing.T) {
+	ctx := context.Background()
+	policyContext := imagetest.AcceptAnythingPolicyContext(t)
+	srcSys := &types.SystemContext{BlobInfoCacheDir: t.TempDir()}
+
+	// The destination already contains the layers
+	srcRef, layerDigest := writeTestDirImage(t)
+	registry, sys := newMockRegistry(t, map[digest.Digest][]byte{layerDigest: {}})
+	// Make sure the layer is not read from the source.
+	err := os.Remove(filepath.Join(srcRef.StringWithinTransport(), layerDigest.Encoded()))
+	require.NoError(t, err)
+	copiedManifest, err := Image(ctx, policyContext, registry.reference("metadata"), srcRef, &Options{SourceCtx: srcSys, DestinationCtx: sys, ManifestOnly: true})
+	require.NoError(t, err)
+	assert.Equal(t, copiedManifest, registry.manifests["metadata"])
+	assert.NotContains(t, registry.uploaded, layerDigest)
+
+	// The destination does not contain the layers
+	srcRef, _ = writeTestDirImage(t)
+	registry, sys = newMockRegistry(t, map[digest.Digest][]byte{})
+	_, err = Image(ctx, policyContext, registry.reference("metadata"), srcRef, &Options{SourceCtx: srcSys, DestinationCtx: sys, ManifestOnly: true})
+	assert.ErrorContains(t, err, "not present at the destination")
+	assert.NotContains(t, registry.uploaded, layerDigest)
+	assert.Empty(t, registry.manifests)
+
+	// Incompatible options
+	for _, opts := range []Options{
+		{ManifestOnly: true, DownloadForeignLayers: true},
+		{ManifestOnly: true, OciEncryptLayers: &[]int{}},
+	} {
+		opts.SourceCtx = srcSys
+		opts.DestinationCtx = sys
+		_, err = Image(ctx, policyContext, registry.reference("metadata"), srcRef, &opts)
+		assert.ErrorContains(t, err, "copying only the manifest is incompatible")
+	}
+}
+
+func TestImageReportManifestDescriptor(t *testing.T) {
+	ctx := context.Background()
+	policyContext := imagetest.AcceptAnythingPolicyContext(t)
+	sys := &types.SystemContext{BlobInfoCacheDir: t.TempDir()}
+
+	srcRef := writeTestLabeledDirImage(t, nil)
+	for _, c := range []struct {
+		transform        ImageTransform
+		expectedPlatform imgspecv1.Platform
+	}{
+		{nil, imgspecv1.Platform{OS: "linux", Architecture: "amd64"}},
+		{ // The platform is read from the written config, not from the source
+			func(manifestBlob []byte, manifestMIMEType string, config []byte) ([]byte, []byte, error) {
+				var parsed imgspecv1.Image
+				if err := json.Unmarshal(config, &parsed); err != nil {
+					return nil, nil, err
+				}
+				parsed.Architecture = "arm64"
+				parsed.Variant = "v8"
+				newConfig, err := json.Marshal(parsed)
+				return manifestBlob, newConfig, err
+			},
+			imgspecv1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"},
+		},
+		{ // All of the platform fields are reported
+			func(manifestBlob []byte, manifestMIMEType string, config []byte) ([]byte, []byte, error) {
+				var parsed imgspecv1.Image
+				if err := json.Unmarshal(config, &parsed); err != nil {
+					return nil, nil, err
+				}
+				parsed.OS = "windows"
+				parsed.OSVersion = "10.0.17763.1879"
+				parsed.OSFeatures = []string{"win32k"}
+				newConfig, err := json.Marshal(parsed)
+				return manifestBlob, newConfig, err
+			},
+			imgspecv1.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763.1879", OSFeatures: []string{"win32k"}},
+		},
+	} {
+		destRef, err := layout.NewReference(t.TempDir(), "dest")
+		require.NoError(t, err)
+		var desc imgspecv1.Descriptor
+		copiedManifest, err := Image(ctx, policyContext, destRef, srcRef, &Options{
+			SourceCtx:                sys,
+			DestinationCtx:           sys,
+			ImageTransform:           c.transform,
+			ReportManifestDescriptor: &desc,
+		})
+		require.NoError(t, err)
+
+		src, err := destRef.NewImageSource(ctx, sys)
+		require.NoError(t, err)
+		defer src.Close()
+		destManifest, destMIMEType, err := src.GetManifest(ctx, nil)
+		require.NoError(t, err)
+		assert.Equal(t, copiedManifest, destManifest)
+		assert.Equal(t, destMIMEType, desc.MediaType)
+		assert.Equal(t, digest.FromBytes(destManifest), desc.Digest)
+		assert.Equal(t, int64(len(destManifest)), desc.Size)
+		require.NotNil(t, desc.Platform)
+		assert.Equal(t, c.expectedPlatform, *desc.Platform)
+	}
+}
+
+func TestImageRemoveSignatures(t *testing.T) {
+	ctx := context.Background()
+	policyContext := imagetest.AcceptAnythingPolicyContext(t)
+	sys := &types.SystemContext{BlobInfoCacheDir: t.TempDir()}
+
+	srcRef, _ := writeTestDirImage(t)
+	// Start the signature with 0xA0 to fool internal/signature.FromBlob into thinking it is valid GPG
+	err := os.WriteFile(filepath.Join(srcRef.StringWithinTransport(), "signature-1"), []byte("\xA0Signature A"), 0o644)
+	require.NoError(t, err)
+
+	for _, removeSignatures := range []bool{false, true} {
+		destRef, err := directory.NewReference(t.TempDir())
+		require.NoError(t, err)
+		_, err = Image(ctx, policyContext, destRef, srcRef, &Options{SourceCtx: sys, DestinationCtx: sys, RemoveSignatures: removeSignatures})
+		require.NoError(t, err, removeSignatures)
+
+		src, err := destRef.NewImageSource(ctx, sys)
+		require.NoError(t, err, removeSignatures)
+		sigs, err := src.GetSignatures(ctx, nil)
+		require.NoError(t, err, removeSignatures)
+		err = src.Close()
+		require.NoError(t, err, removeSignatures)
+		if removeSignatures {
+			assert.Empty(t, sigs)
+		} else {
+			assert.Equal(t, [][]byte{[]byte("\xA0Signature A")}, sigs)
+		}
+	}
+}
+
+func TestImageOCILayoutWithReferrerSignatures(t *testing.T) {
+	ctx := context.Background()
+	policyContext := imagetest.AcceptAnythingPolicyContext(t)
+
+	srcRef, err := layout.NewReference("../oci/layout/fixtures/signed_image", "latest")
+	require.NoError(t, err)
+	for _, c := range []struct {
+		name             string
+		srcSys           *types.SystemContext
+		removeSignatures bool
+		success          bool
+	}{
+		// The uncompressed layer is compressed when copying; the referrer signatures are not read by default, so that works.
+		{"default", nil, false, true},
+		// If the referrer signatures are read, they must be removed, because they can not be stored.
+		{"referrer signatures", &types.SystemContext{OCIReadReferrerSignatures: true}, false, false},
+		{"referrer signatures removed", &types.SystemContext{OCIReadReferrerSignatures: true}, true, true},
+	} {
+		destRef, err := layout.NewReference(t.TempDir(), "latest")
+		require.NoError(t, err, c.name)
+		_, err = Image(ctx, policyContext, destRef, srcRef, &Options{SourceCtx: c.srcSys, RemoveSignatures: c.removeSignatures})
+		if !c.success {
+			assert.Error(t, err, c.name)
+			continue
+		}
+		require.NoError(t, err, c.name)
+
+		img, err := destRef.NewImage(ctx, nil)
+		require.NoError(t, err, c.name)
+		layers := img.LayerInfos()
+		err = img.Close()
+		require.NoError(t, err, c.name)
+		require.Len(t, layers, 1, c.name)
+		assert.Equal(t, imgspecv1.MediaTypeImageLayerGzip, layers[0].MediaType, c.name)
+	}
+}
+
+// recordingTransferLogger is a TransferLogger which records all events.
+type recordingTransferLogger struct {
+	events    []BlobTransferEvent
+	summaries []TransferSummary
+}
+
+func (l *recordingTransferLogger) BlobTransferred(event BlobTransferEvent) {
+	l.events = append(l.events, event)
+}
+
+func (l *recordingTransferLogger) CopyCompleted(summary TransferSummary) {
+	l.summaries = append(l.summaries, summary)
+}
+
+func TestImageTransferLog(t *testing.T) {
+	ctx := context.Background()
+	policyContext := imagetest.AcceptAnythingPolicyContext(t)
+	sys := &types.SystemContext{BlobInfoCacheDir: t.TempDir()}
+
+	srcRef, layerDigest := writeTestDirImage(t)
+	destDir := t.TempDir()
+
+	// outcomes returns the outcomes of events, keyed by the source digest
+	outcomes := func(events []BlobTransferEvent) map[digest.Digest]BlobTransferOutcome {
+		res := map[digest.Digest]BlobTransferOutcome{}
+		for _, e := range events {
+			assert.Equal(t, srcRef.StringWithinTransport(), e.Source.StringWithinTransport())
+			res[e.SourceBlob.Digest] = e.Outcome
+		}
+		return res
+	}
+
+	// The destination is empty, everything is pushed.
+	firstRef, err := layout.NewReference(destDir, "first")
+	require.NoError(t, err)
+	logger := &recordingTransferLogger{}
+	_, err = Image(ctx, policyContext, firstRef, srcRef, &Options{SourceCtx: sys, DestinationCtx: sys, TransferLog: logger})
+	require.NoError(t, err)
+	require.Len(t, logger.events, 2)
+	src, err := srcRef.NewImageSource(ctx, sys)
+	require.NoError(t, err)
+	img, err := image.FromUnparsedImage(ctx, sys, image.UnparsedInstance(src, nil))
+	require.NoError(t, err)
+	configDigest := img.ConfigInfo().Digest
+	err = src.Close()
+	require.NoError(t, err)
+	assert.Equal(t, map[digest.Digest]BlobTransferOutcome{
+		layerDigest:  BlobTransferPushed,
+		configDigest: BlobTransferPushed,
+	}, outcomes(logger.events))
+	for _, e := range logger.events {
+		assert.Equal(t, e.SourceBlob.Digest == configDigest, e.Config)
+	}
+	require.Len(t, logger.summaries, 1)
+	assert.Equal(t, 2, logger.summaries[0].PushedBlobs)
+	assert.Equal(t, 0, logger.summaries[0].ReusedBlobs)
+	assert.Positive(t, logger.summaries[0].PushedBytes)
+
+	// The layer already exists at the destination, and is reused; the config is always written.
+	secondRef, err := layout.NewReference(destDir, "second")
+	require.NoError(t, err)
+	logger = &recordingTransferLogger{}
+	_, err = Image(ctx, policyContext, secondRef, srcRef, &Options{SourceCtx: sys, DestinationCtx: sys, TransferLog: logger})
+	require.NoError(t, err)
+	assert.Equal(t, map[digest.Digest]BlobTransferOutcome{
+		layerDigest:  BlobTransferReused,
+		configDigest: BlobTransferPushed,
+	}, outcomes(logger.events))
+	require.Len(t, logger.summaries, 1)
+	assert.Equal(t, 1, logger.summaries[0].PushedBlobs)
+	assert.Equal(t, 1, logger.summaries[0].ReusedBlobs)
+
+	// A failed copy does not report a summary.
+	logger = &recordingTransferLogger{}
+	_, err = Image(ctx, policyContext, secondRef, srcRef, &Options{SourceCtx: sys, DestinationCtx: sys, TransferLog: logger, ImageListSelection: ImageListSelection(-1)})
+	assert.Error(t, err)
+	assert.Empty(t, logger.summaries)
+}
+
+// writeTestMultiLayerDirImage creates an image with layerCount uncompressed layers in a new directory and returns a reference to it,
+// along with the digests of its layers.
+func writeTestMultiLayerDirImage(t testing.TB, layerCount int) (types.ImageReference, []digest.Digest) {
+	layers := []imagetest.Blob{}
+	layerDigests := []digest.Digest{}
+	for i := 0; i < layerCount; i++ {
+		layer := bytes.Repeat([]byte(fmt.Sprintf("layer %d\n", i)), 10000)
+		layers = append(layers, imagetest.Blob{MediaType: imgspecv1.MediaTypeImageLayer, Data: layer})
+		layerDigests = append(layerDigests, digest.FromBytes(layer))
+	}
+	config, err := json.Marshal(imgspecv1.Image{
+		Platform: imgspecv1.Platform{OS: "linux", Architecture: "amd64"},
+		RootFS:   imgspecv1.RootFS{Type: "layers", DiffIDs: layerDigests},
+	})
+	require.NoError(t, err)
+
+	return imagetest.WriteDirImage(t, imgspecv1.MediaTypeImageManifest, config, layers), layerDigests
+}
+
+func TestImageParallelLayerCopies(t *testing.T) {
+	ctx := context.Background()
+	policyContext := imagetest.AcceptAnythingPolicyContext(t)
+	sys := &types.SystemContext{BlobInfoCacheDir: t.TempDir(), MaxParallelDownloads: 3}
+
+	srcRef, layerDigests := writeTestMultiLayerDirImage(t, 10)
+
+	// All layers are copied, and recorded in the original order.
+	destRef, err := layout.NewReference(t.TempDir(), "dest")
+	require.NoError(t, err)
+	_, err = Image(ctx, policyContext, destRef, srcRef, &Options{SourceCtx: sys, DestinationCtx: sys})
+	require.NoError(t, err)
+	src, err := destRef.NewImageSource(ctx, sys)
+	require.NoError(t, err)
+	defer src.Close()
+	manifestBlob, _, err := src.GetManifest(ctx, nil)
+	require.NoError(t, err)
+	m, err := manifest.OCI1FromManifest(manifestBlob)
+	require.NoError(t, err)
+	// The layers are compressed while copying; compare the digests of their uncompressed contents.
+	copiedDigests := []digest.Digest{}
+	for _, l := range m.Layers {
+		stream, _, err := src.GetBlob(ctx, manifest.BlobInfoFromOCI1Descriptor(l), none.NoCache)
+		require.NoError(t, err)
+		uncompressed, _, err := compression.AutoDecompress(stream)
+		require.NoError(t, err)
+		d, err := digest.FromReader(uncompressed)
+		require.NoError(t, err)
+		uncompressed.Close()
+		stream.Close()
+		copiedDigests = append(copiedDigests, d)
+	}
+	assert.Equal(t, layerDigests, copiedDigests)
+
+	// A failure to copy one of the layers is reported, not the cancellation of the other copies.
+	srcPath := srcRef.StringWithinTransport()
+	err = os.Remove(filepath.Join(srcPath, layerDigests[4].Encoded()))
+	require.NoError(t, err)
+	destRef, err = layout.NewReference(t.TempDir(), "dest")
+	require.NoError(t, err)
+	_, err = Image(ctx, policyContext, destRef, srcRef, &Options{SourceCtx: sys, DestinationCtx: sys})
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.NotErrorIs(t, err, context.Canceled)
+}
+
+func BenchmarkImageParallelLayerCopies(b *testing.B) {
+	ctx := context.Background()
+	policyContext := imagetest.AcceptAnythingPolicyContext(b)
+	srcRef, _ := writeTestMultiLayerDirImage(b, 20)
+
+	for _, parallelism := range []uint{1, 6} {
+		b.Run(fmt.Sprintf("parallelism=%d", parallelism), func(b *testing.B) {
+			sys := &types.SystemContext{BlobInfoCacheDir: b.TempDir(), MaxParallelDownloads: parallelism}
+			for i := 0; i < b.N; i++ {
+				destRef, err := directory.NewReference(filepath.Join(b.TempDir(), "dest"))
+				require.NoError(b, err)
+				_, err = Image(ctx, policyContext, destRef, srcRef, &Options{SourceCtx: sys, DestinationCtx: sys})
+				require.NoError(b, err)
+			}
+		})
+	}
+}
+
+func TestImageMaxBlobsPerImage(t *testing.T) {
+	ctx := context.Background()
+	policyContext := imagetest.AcceptAnythingPolicyContext(t)
+
+	srcRef, layerDigests := writeTestMultiLayerDirImage(t, 3) // 3 layers + 1 config
+	for _, c := range []struct {
+		maxBlobs int
+		success  bool
+	}{
+		{0, true}, // No limit
+		{5, true},
+		{4, true},
+		{3, false},
+		{1, false},
+	} {
+		destDir := t.TempDir()
+		destRef, err := directory.NewReference(destDir)
+		require.NoError(t, err)
+		sys := &types.SystemContext{BlobInfoCacheDir: t.TempDir(), MaxBlobsPerImage: c.maxBlobs}
+		_, err = Image(ctx, policyContext, destRef, srcRef, &Options{SourceCtx: sys, DestinationCtx: sys})
+		if c.success {
+			require.NoError(t, err, c.maxBlobs)
+			for _, d := range layerDigests {
+				_, err = os.Stat(filepath.Join(destDir, d.Encoded()))
+				assert.NoError(t, err, c.maxBlobs)
+			}
+		} else {
+			assert.ErrorContains(t, err, fmt.Sprintf("image references 4 blobs, more than the maximum of %d", c.maxBlobs))
+			// Nothing was copied
+			for _, d := range layerDigests {
+				_, err = os.Stat(filepath.Join(destDir, d.Encoded()))
+				assert.ErrorIs(t, err, fs.ErrNotExist, c.maxBlobs)
+			}
+			_, err = os.Stat(filepath.Join(destDir, "manifest.json"))
+			assert.ErrorIs(t, err, fs.ErrNotExist, c.maxBlobs)
+		}
+	}
+}
+
+func TestImageSkipIfDigestPresent(t *testing.T) {
+	ctx := context.Background()
+	policyContext := imagetest.AcceptAnythingPolicyContext(t)
+	sys := &types.SystemContext{BlobInfoCacheDir: t.TempDir()}
+
+	srcRef, layerDigest := writeTestDirImage(t)
+	srcManifest, err := os.ReadFile(filepath.Join(srcRef.StringWithinTransport(), "manifest.json"))
+	require.NoError(t, err)
+	readDestManifest := func(destRef types.ImageReference) []byte {
+		src, err := destRef.NewImageSource(ctx, sys)
+		require.NoError(t, err)
+		defer src.Close()
+		destManifest, _, err := src.GetManifest(ctx, nil)
+		require.NoError(t, err)
+		return destManifest
+	}
+
+	// The destination does not exist yet
+	destRef, err := directory.NewReference(filepath.Join(t.TempDir(), "dest"))
+	require.NoError(t, err)
+	skipped := true
+	copiedManifest, err := Image(ctx, policyContext, destRef, srcRef, &Options{
+		SourceCtx: sys, DestinationCtx: sys, SkipIfDigestPresent: true, ReportSkipped: &skipped,
+	})
+	require.NoError(t, err)
+	assert.False(t, skipped)
+	assert.Equal(t, srcManifest, copiedManifest)
+	assert.Equal(t, srcManifest, readDestManifest(destRef))
+
+	// The destination already contains the same manifest; make sure nothing is read from the source or written.
+	err = os.Remove(filepath.Join(srcRef.StringWithinTransport(), layerDigest.Encoded()))
+	require.NoError(t, err)
+	copiedManifest, err = Image(ctx, policyContext, destRef, srcRef, &Options{
+		SourceCtx: sys, DestinationCtx: sys, SkipIfDigestPresent: true, ReportSkipped: &skipped,
+	})
+	require.NoError(t, err)
+	assert.True(t, skipped)
+	assert.Equal(t, srcManifest, copiedManifest)
+	assert.Equal(t, srcManifest, readDestManifest(destRef))
+	_, err = os.Stat(filepath.Join(destRef.StringWithinTransport(), layerDigest.Encoded()))
+	assert.NoError(t, err)
+
+	// A source rejected by the policy is not accepted even if the destination already contains it
+	rejectingContext, err := signature.NewPolicyContext(&signature.Policy{
+		Default: []signature.PolicyRequirement{signature.NewPRReject()},
+	})
+	require.NoError(t, err)
+	defer func() {
+		err := rejectingContext.Destroy()
+		require.NoError(t, err)
+	}()
+	_, err = Image(ctx, rejectingContext, destRef, srcRef, &Options{
+		SourceCtx: sys, DestinationCtx: sys, SkipIfDigestPresent: true, ReportSkipped: &skipped,
+	})
+	assert.ErrorContains(t, err, "Source image rejected")
+	assert.False(t, skipped)
+	assert.Equal(t, srcManifest, readDestManifest(destRef))
+
+	// The destination contains a different image
+	otherRef, otherLayers := writeTestMultiLayerDirImage(t, 2)
+	otherManifest, err := os.ReadFile(filepath.Join(otherRef.StringWithinTransport(), "manifest.json"))
+	require.NoError(t, err)
+	copiedManifest, err = Image(ctx, policyContext, destRef, otherRef, &Options{
+		SourceCtx: sys, DestinationCtx: sys, SkipIfDigestPresent: true, ReportSkipped: &skipped,
+	})
+	require.NoError(t, err)
+	assert.False(t, skipped)
+	assert.Equal(t, otherManifest, copiedManifest)
+	assert.Equal(t, otherManifest, readDestManifest(destRef))
+	for _, d := range otherLayers {
+		_, err = os.Stat(filepath.Join(destRef.StringWithinTransport(), d.Encoded()))
+		assert.NoError(t, err)
+	}
+
+	// The copy is not skipped if it would add signatures to the destination
+	signedRef, _ := writeTestDirImage(t)
+	signedDestRef, err := directory.NewReference(filepath.Join(t.TempDir(), "dest"))
+	require.NoError(t, err)
+	_, err = Image(ctx, policyContext, signedDestRef, signedRef, &Options{SourceCtx: sys, DestinationCtx: sys})
+	require.NoError(t, err)
+	stubSigner := internalSigner.NewSigner(&stubSignerImpl{})
+	defer stubSigner.Close()
+	signIdentity, err := reference.ParseNormalizedNamed("example.com/signed:latest")
+	require.NoError(t, err)
+	_, err = Image(ctx, policyContext, signedDestRef, signedRef, &Options{
+		SourceCtx: sys, DestinationCtx: sys, SkipIfDigestPresent: true, ReportSkipped: &skipped,
+		Signers: []*signer.Signer{stubSigner}, SignIdentity: signIdentity,
+	})
+	require.NoError(t, err)
+	assert.False(t, skipped)
+	readDestSignatures := func(destRef types.ImageReference) []internalsig.Signature {
+		src, err := destRef.NewImageSource(ctx, sys)
+		require.NoError(t, err)
+		defer src.Close()
+		sigs, err := imagesource.FromPublic(src).GetSignaturesWithFormat(ctx, nil)
+		require.NoError(t, err)
+		return sigs
+	}
+	require.Len(t, readDestSignatures(signedDestRef), 1)
+	assert.IsType(t, internalsig.Sigstore{}, readDestSignatures(signedDestRef)[0])
+	// Start the signature with 0xA0 to fool internal/signature.FromBlob into thinking it is valid GPG
+	err = os.WriteFile(filepath.Join(signedRef.StringWithinTransport(), "signature-1"), []byte("\xA0Signature A"), 0o644)
+	require.NoError(t, err)
+	for _, removeSignatures := range []bool{false, true} {
+		_, err = Image(ctx, policyContext, signedDestRef, signedRef, &Options{
+			SourceCtx: sys, DestinationCtx: sys, SkipIfDigestPresent: true, ReportSkipped: &skipped, RemoveSignatures: removeSignatures,
+		})
+		require.NoError(t, err, removeSignatures)
+		assert.Equal(t, removeSignatures, skipped, removeSignatures)
+		// If the copy is not skipped, the source signature replaces the one added when signing
+		assert.Equal(t, []internalsig.Signature{internalsig.SimpleSigningFromBlob([]byte("\xA0Signature A"))}, readDestSignatures(signedDestRef), removeSignatures)
+	}
+}
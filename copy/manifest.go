@@ -54,6 +54,7 @@ type determineManifestConversionInputs struct {
 	destSupportedManifestMIMETypes []string // MIME types supported by the destination, per types.ImageDestination.SupportedManifestMIMETypes()
 
 	forceManifestMIMEType      string                      // User’s choice of forced manifest MIME type
+	allowedManifestMIMETypes   []string                    // If not empty, only these MIME types may be written to the destination
 	requestedCompressionFormat *compressiontypes.Algorithm // Compression algorithm to use, if the user _explictily_ requested one.
 	requiresOCIEncryption      bool                        // Restrict to manifest formats that can support OCI encryption
 	cannotModifyManifestReason string                      // The reason the manifest cannot be modified, or an empty string if it can
@@ -85,6 +86,14 @@ func determineManifestConversion(in determineManifestConversionInputs) (manifest
 	if len(destSupportedManifestMIMETypes) == 0 {
 		destSupportedManifestMIMETypes = allManifestMIMETypes
 	}
+	if len(in.allowedManifestMIMETypes) != 0 {
+		allowed := restrictToAllowedMIMETypes(destSupportedManifestMIMETypes, in.allowedManifestMIMETypes)
+		if len(allowed) == 0 {
+			return manifestConversionPlan{}, fmt.Errorf("none of the manifest MIME types usable for the destination, [%s], is allowed by the configuration, [%s]",
+				strings.Join(destSupportedManifestMIMETypes, ", "), strings.Join(in.allowedManifestMIMETypes, ", "))
+		}
+		destSupportedManifestMIMETypes = allowed
+	}
 
 	restrictiveCompressionRequired := in.requestedCompressionFormat != nil && !internalManifest.CompressionAlgorithmIsUniversallySupported(*in.requestedCompressionFormat)
 	supportedByDest := set.New[string]()
@@ -119,7 +128,7 @@ func determineManifestConversion(in determineManifestConversionInputs) (manifest
 				return manifestConversionPlan{}, errors.New("internal error: forceManifestMIMEType was rejected for an unknown reason")
 			}
 		}
-		if len(in.destSupportedManifestMIMETypes) == 0 { // 2. destination accepts anything and we have chosen allManifestTypes
+		if len(in.destSupportedManifestMIMETypes) == 0 && len(in.allowedManifestMIMETypes) == 0 { // 2. destination accepts anything and we have chosen allManifestTypes
 			if !restrictiveCompressionRequired {
 				// Coverage: This should never happen.
 				// If we have not rejected for encryption reasons, we must have rejected due to encryption, but
@@ -129,7 +138,7 @@ func determineManifestConversion(in determineManifestConversionInputs) (manifest
 			// This can legitimately happen when the user asks for completely unsupported formats like Bzip2 or Xz.
 			return manifestConversionPlan{}, fmt.Errorf("compression using %s required, but none of the known manifest formats support it", in.requestedCompressionFormat.Name())
 		}
-		// 3. destination accepts a restricted list of mime types
+		// 3. destination accepts a restricted list of mime types, or the list was restricted by allowedManifestMIMETypes
 		destMIMEList := strings.Join(destSupportedManifestMIMETypes, ", ")
 		switch {
 		case in.requiresOCIEncryption && restrictiveCompressionRequired:
@@ -159,6 +168,10 @@ func determineManifestConversion(in determineManifestConversionInputs) (manifest
 		prioritizedTypes.append(srcType)
 	}
 	if in.cannotModifyManifestReason != "" {
+		if len(in.allowedManifestMIMETypes) != 0 && !supportedByDest.Contains(srcType) {
+			return manifestConversionPlan{}, fmt.Errorf("manifest MIME type %s is not allowed by the configuration, [%s], and the manifest can’t be converted: %s",
+				srcType, strings.Join(in.allowedManifestMIMETypes, ", "), in.cannotModifyManifestReason)
+		}
 		// We could also drop this check and have the caller
 		// make the choice; it is already doing that to an extent, to improve error
 		// messages.  But it is nice to hide the “if we can't modify, do no conversion”
@@ -208,13 +221,28 @@ func isMultiImage(ctx context.Context, img types.UnparsedImage) (bool, error) {
 	return manifest.MIMETypeIsMultiImage(mt), nil
 }
 
+// allowedDestinationManifestMIMETypes returns sys.AllowedDestinationManifestMIMETypes, or nil if sys is nil.
+func allowedDestinationManifestMIMETypes(sys *types.SystemContext) []string {
+	if sys == nil {
+		return nil
+	}
+	return sys.AllowedDestinationManifestMIMETypes
+}
+
+// restrictToAllowedMIMETypes returns the subset of mimeTypes which is included in allowed, preserving the order of mimeTypes.
+func restrictToAllowedMIMETypes(mimeTypes []string, allowed []string) []string {
+	return slices.DeleteFunc(slices.Clone(mimeTypes), func(t string) bool {
+		return !slices.Contains(allowed, t)
+	})
+}
+
 // determineListConversion takes the current MIME type of a list of manifests,
-// the list of MIME types supported for a given destination, and a possible
-// forced value, and returns the MIME type to which we should convert the list
+// the list of MIME types supported for a given destination, a possible
+// forced value, and an optional list of allowed MIME types, and returns the MIME type to which we should convert the list
 // of manifests (regardless of whether we are converting to it or using it
 // unmodified) and a slice of other list types which might be supported by the
 // destination.
-func (c *copier) determineListConversion(currentListMIMEType string, destSupportedMIMETypes []string, forcedListMIMEType string) (string, []string, error) {
+func (c *copier) determineListConversion(currentListMIMEType string, destSupportedMIMETypes []string, forcedListMIMEType string, allowedMIMETypes []string) (string, []string, error) {
 	// If there's no list of supported types, then anything we support is expected to be supported.
 	if len(destSupportedMIMETypes) == 0 {
 		destSupportedMIMETypes = manifest.SupportedListMIMETypes
@@ -223,6 +251,9 @@ func (c *copier) determineListConversion(currentListMIMEType string, destSupport
 	if forcedListMIMEType != "" {
 		destSupportedMIMETypes = []string{forcedListMIMEType}
 	}
+	if len(allowedMIMETypes) != 0 {
+		destSupportedMIMETypes = restrictToAllowedMIMETypes(destSupportedMIMETypes, allowedMIMETypes)
+	}
 
 	prioritizedTypes := newOrderedSet()
 	// The first priority is the current type, if it's in the list, since that lets us avoid a
@@ -239,6 +270,9 @@ func (c *copier) determineListConversion(currentListMIMEType string, destSupport
 
 	logrus.Debugf("Manifest list has MIME type %q, ordered candidate list [%s]", currentListMIMEType, strings.Join(destSupportedMIMETypes, ", "))
 	if len(prioritizedTypes.list) == 0 {
+		if len(allowedMIMETypes) != 0 {
+			return "", nil, fmt.Errorf("destination does not support any supported manifest list types (%v) allowed by the configuration (%v)", manifest.SupportedListMIMETypes, allowedMIMETypes)
+		}
 		return "", nil, fmt.Errorf("destination does not support any supported manifest list types (%v)", manifest.SupportedListMIMETypes)
 	}
 	selectedType := prioritizedTypes.list[0]
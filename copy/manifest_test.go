@@ -529,6 +529,98 @@ func (f fakeUnparsedImage) Manifest(ctx context.Context) ([]byte, string, error)
 	return nil, f.mt, nil
 }
 
+func TestDetermineManifestConversionAllowedMIMETypes(t *testing.T) {
+	for _, c := range []struct {
+		description string
+		in          determineManifestConversionInputs
+		expected    manifestConversionPlan
+	}{
+		{ // The allowlist forces a conversion
+			"OCI→anything, only s2 allowed",
+			determineManifestConversionInputs{
+				srcMIMEType:              v1.MediaTypeImageManifest,
+				allowedManifestMIMETypes: []string{manifest.DockerV2Schema2MediaType},
+			},
+			manifestConversionPlan{
+				preferredMIMEType:                manifest.DockerV2Schema2MediaType,
+				preferredMIMETypeNeedsConversion: true,
+				otherMIMETypeCandidates:          []string{},
+			},
+		},
+		{ // The allowlist restricts the candidates
+			"s2→s1s2OCI, s2 and OCI allowed",
+			determineManifestConversionInputs{
+				srcMIMEType: manifest.DockerV2Schema2MediaType,
+				destSupportedManifestMIMETypes: []string{v1.MediaTypeImageManifest, manifest.DockerV2Schema2MediaType,
+					manifest.DockerV2Schema1SignedMediaType, manifest.DockerV2Schema1MediaType},
+				allowedManifestMIMETypes: []string{v1.MediaTypeImageManifest, manifest.DockerV2Schema2MediaType},
+			},
+			manifestConversionPlan{
+				preferredMIMEType:                manifest.DockerV2Schema2MediaType,
+				preferredMIMETypeNeedsConversion: false,
+				otherMIMETypeCandidates:          []string{v1.MediaTypeImageManifest},
+			},
+		},
+		{ // The original type is allowed, so it can be used even if we can’t modify the manifest
+			"s2 cannotModifyManifestReason, s2 allowed",
+			determineManifestConversionInputs{
+				srcMIMEType:                manifest.DockerV2Schema2MediaType,
+				allowedManifestMIMETypes:   []string{manifest.DockerV2Schema2MediaType},
+				cannotModifyManifestReason: "Preserving digests",
+			},
+			manifestConversionPlan{
+				preferredMIMEType:       manifest.DockerV2Schema2MediaType,
+				otherMIMETypeCandidates: []string{},
+			},
+		},
+	} {
+		res, err := determineManifestConversion(c.in)
+		require.NoError(t, err, c.description)
+		assert.Equal(t, c.expected, res, c.description)
+	}
+
+	for _, c := range []struct {
+		description string
+		in          determineManifestConversionInputs
+	}{
+		{
+			"no allowed type supported by the destination",
+			determineManifestConversionInputs{
+				srcMIMEType:                    v1.MediaTypeImageManifest,
+				destSupportedManifestMIMETypes: []string{v1.MediaTypeImageManifest},
+				allowedManifestMIMETypes:       []string{manifest.DockerV2Schema2MediaType},
+			},
+		},
+		{
+			"forced type not allowed",
+			determineManifestConversionInputs{
+				srcMIMEType:              v1.MediaTypeImageManifest,
+				forceManifestMIMEType:    v1.MediaTypeImageManifest,
+				allowedManifestMIMETypes: []string{manifest.DockerV2Schema2MediaType},
+			},
+		},
+		{
+			"original type not allowed, and cannotModifyManifestReason",
+			determineManifestConversionInputs{
+				srcMIMEType:                v1.MediaTypeImageManifest,
+				allowedManifestMIMETypes:   []string{manifest.DockerV2Schema2MediaType},
+				cannotModifyManifestReason: "Preserving digests",
+			},
+		},
+		{
+			"allowed types don’t support encryption",
+			determineManifestConversionInputs{
+				srcMIMEType:              v1.MediaTypeImageManifest,
+				allowedManifestMIMETypes: []string{manifest.DockerV2Schema2MediaType},
+				requiresOCIEncryption:    true,
+			},
+		},
+	} {
+		_, err := determineManifestConversion(c.in)
+		assert.Error(t, err, c.description)
+	}
+}
+
 func TestIsMultiImage(t *testing.T) {
 	// MIME type is available; more or less a smoke test, other cases are handled in manifest.MIMETypeIsMultiImage
 	for _, c := range []struct {
@@ -598,7 +690,7 @@ func TestDetermineManifestListConversion(t *testing.T) {
 
 	for _, c := range cases {
 		copier := &copier{}
-		preferredMIMEType, otherCandidates, err := copier.determineListConversion(c.sourceType, c.destTypes, "")
+		preferredMIMEType, otherCandidates, err := copier.determineListConversion(c.sourceType, c.destTypes, "", nil)
 		require.NoError(t, err, c.description)
 		if c.expectedUpdate == "" {
 			assert.Equal(t, manifest.NormalizedMIMEType(c.sourceType), preferredMIMEType, c.description)
@@ -611,14 +703,23 @@ func TestDetermineManifestListConversion(t *testing.T) {
 	// With forceManifestMIMEType, the output is always the forced manifest type (in this case OCI index)
 	for _, c := range cases {
 		copier := &copier{}
-		preferredMIMEType, otherCandidates, err := copier.determineListConversion(c.sourceType, c.destTypes, v1.MediaTypeImageIndex)
+		preferredMIMEType, otherCandidates, err := copier.determineListConversion(c.sourceType, c.destTypes, v1.MediaTypeImageIndex, nil)
 		require.NoError(t, err, c.description)
 		assert.Equal(t, v1.MediaTypeImageIndex, preferredMIMEType, c.description)
 		assert.Equal(t, []string{}, otherCandidates, c.description)
 	}
 
-	// The destination doesn’t support list formats at all
+	// The allowlist restricts the candidates
 	copier := &copier{}
-	_, _, err := copier.determineListConversion(v1.MediaTypeImageIndex, supportOnlyS1, "")
+	preferredMIMEType, otherCandidates, err := copier.determineListConversion(v1.MediaTypeImageIndex, supportS1S2OCI, "",
+		[]string{manifest.DockerV2ListMediaType, manifest.DockerV2Schema2MediaType})
+	require.NoError(t, err)
+	assert.Equal(t, manifest.DockerV2ListMediaType, preferredMIMEType)
+	assert.Equal(t, []string{}, otherCandidates)
+	_, _, err = copier.determineListConversion(v1.MediaTypeImageIndex, supportOnlyOCI, "", []string{manifest.DockerV2ListMediaType})
+	assert.Error(t, err)
+
+	// The destination doesn’t support list formats at all
+	_, _, err = copier.determineListConversion(v1.MediaTypeImageIndex, supportOnlyS1, "", nil)
 	assert.Error(t, err)
 }
@@ -215,7 +215,8 @@ func (c *copier) copyMultipleImages(ctx context.Context) (copiedManifest []byte,
 	case imgspecv1.MediaTypeImageManifest:
 		forceListMIMEType = imgspecv1.MediaTypeImageIndex
 	}
-	selectedListType, otherManifestMIMETypeCandidates, err := c.determineListConversion(manifestType, c.dest.SupportedManifestMIMETypes(), forceListMIMEType)
+	selectedListType, otherManifestMIMETypeCandidates, err := c.determineListConversion(manifestType, c.dest.SupportedManifestMIMETypes(), forceListMIMEType,
+		allowedDestinationManifestMIMETypes(c.options.DestinationCtx))
 	if err != nil {
 		return nil, fmt.Errorf("determining manifest list type to write to destination: %w", err)
 	}
@@ -345,9 +346,11 @@ func (c *copier) copyMultipleImages(ctx context.Context) (copiedManifest []byte,
 	}
 	sigs = append(slices.Clone(sigs), newSigs...)
 
-	c.Printf("Storing list signatures\n")
-	if err := c.dest.PutSignaturesWithFormat(ctx, sigs, nil); err != nil {
-		return nil, fmt.Errorf("writing signatures: %w", err)
+	if len(sigs) > 0 {
+		c.Printf("Storing list signatures\n")
+		if err := c.dest.PutSignaturesWithFormat(ctx, sigs, nil); err != nil {
+			return nil, fmt.Errorf("writing signatures: %w", err)
+		}
 	}
 
 	return manifestList, nil
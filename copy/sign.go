@@ -2,6 +2,7 @@ package copy
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/containers/image/v5/docker/reference"
@@ -36,10 +37,18 @@ func (c *copier) setupSigners() error {
 		c.signersToClose = append(c.signersToClose, signer)
 	}
 
-	if c.options.SignBySigstorePrivateKeyFile != "" {
-		signer, err := sigstore.NewSigner(
-			sigstore.WithPrivateKeyFile(c.options.SignBySigstorePrivateKeyFile, c.options.SignSigstorePrivateKeyPassphrase),
-		)
+	if c.options.SignBySigstorePrivateKeyFile != "" && len(c.options.SignBySigstorePrivateKey) != 0 {
+		return errors.New("SignBySigstorePrivateKeyFile and SignBySigstorePrivateKey can not be used together")
+	}
+	var sigstoreKeyOption sigstore.Option
+	switch {
+	case c.options.SignBySigstorePrivateKeyFile != "":
+		sigstoreKeyOption = sigstore.WithPrivateKeyFile(c.options.SignBySigstorePrivateKeyFile, c.options.SignSigstorePrivateKeyPassphrase)
+	case len(c.options.SignBySigstorePrivateKey) != 0:
+		sigstoreKeyOption = sigstore.WithPrivateKey(c.options.SignBySigstorePrivateKey, c.options.SignSigstorePrivateKeyPassphrase)
+	}
+	if sigstoreKeyOption != nil {
+		signer, err := sigstore.NewSigner(sigstoreKeyOption)
 		if err != nil {
 			return err
 		}
@@ -47,6 +56,11 @@ func (c *copier) setupSigners() error {
 		c.signersToClose = append(c.signersToClose, signer)
 	}
 
+	// Reject an unusable identity now, instead of after copying all of the image.
+	if len(c.signers) != 0 && c.options.SignIdentity != nil && reference.IsNameOnly(c.options.SignIdentity) {
+		return fmt.Errorf("Sign identity must be a fully specified reference %s", c.options.SignIdentity.String())
+	}
+
 	return nil
 }
 
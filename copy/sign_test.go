@@ -4,15 +4,22 @@ import (
 	"context"
 	"errors"
 	"io"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/containers/image/v5/directory"
 	"github.com/containers/image/v5/docker"
 	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/image"
 	"github.com/containers/image/v5/internal/imagedestination"
+	"github.com/containers/image/v5/internal/imagesource"
 	internalsig "github.com/containers/image/v5/internal/signature"
 	internalSigner "github.com/containers/image/v5/internal/signer"
+	"github.com/containers/image/v5/internal/testing/imagetest"
+	"github.com/containers/image/v5/signature"
 	"github.com/containers/image/v5/signature/signer"
+	"github.com/containers/image/v5/signature/sigstore"
 	"github.com/containers/image/v5/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -161,3 +168,96 @@ func TestCreateSignatures(t *testing.T) {
 		}
 	}
 }
+
+func TestImageSignBySigstorePrivateKey(t *testing.T) {
+	ctx := context.Background()
+	policyContext := imagetest.AcceptAnythingPolicyContext(t)
+	sys := &types.SystemContext{BlobInfoCacheDir: t.TempDir()}
+
+	passphrase := []byte("some passphrase")
+	keyPair, err := sigstore.GenerateKeyPair(passphrase)
+	require.NoError(t, err)
+	keyFile := filepath.Join(t.TempDir(), "cosign.key")
+	err = os.WriteFile(keyFile, keyPair.PrivateKey, 0o600)
+	require.NoError(t, err)
+	identity, err := reference.ParseNormalizedNamed("example.com/signed/image:tag")
+	require.NoError(t, err)
+	identityRef, err := docker.NewReference(identity)
+	require.NoError(t, err)
+
+	srcRef, _ := writeTestDirImage(t)
+
+	// Successful signing, with a key file and with key data
+	for _, options := range []Options{
+		{SignBySigstorePrivateKeyFile: keyFile, SignSigstorePrivateKeyPassphrase: passphrase, SignIdentity: identity},
+		{SignBySigstorePrivateKey: keyPair.PrivateKey, SignSigstorePrivateKeyPassphrase: passphrase, SignIdentity: identity},
+	} {
+		destRef, err := directory.NewReference(t.TempDir())
+		require.NoError(t, err)
+		options.SourceCtx = sys
+		options.DestinationCtx = sys
+		_, err = Image(ctx, policyContext, destRef, srcRef, &options)
+		require.NoError(t, err)
+
+		src, err := destRef.NewImageSource(ctx, sys)
+		require.NoError(t, err)
+		defer src.Close()
+		sigs, err := imagesource.FromPublic(src).GetSignaturesWithFormat(ctx, nil)
+		require.NoError(t, err)
+		require.Len(t, sigs, 1)
+		_, ok := sigs[0].(internalsig.Sigstore)
+		assert.True(t, ok)
+
+		for _, c := range []struct {
+			publicKey []byte
+			accepted  bool
+		}{
+			{keyPair.PublicKey, true},
+			{otherPublicKey(t), false},
+		} {
+			pr, err := signature.NewPRSigstoreSignedKeyData(c.publicKey, signature.NewPRMMatchRepoDigestOrExact())
+			require.NoError(t, err)
+			verifyingContext, err := signature.NewPolicyContext(&signature.Policy{Default: []signature.PolicyRequirement{pr}})
+			require.NoError(t, err)
+			unparsed := image.UnparsedInstanceWithReference(image.UnparsedInstance(src, nil), identityRef)
+			allowed, err := verifyingContext.IsRunningImageAllowed(ctx, unparsed)
+			assert.Equal(t, c.accepted, allowed)
+			if c.accepted {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+			err = verifyingContext.Destroy()
+			require.NoError(t, err)
+		}
+	}
+
+	// Invalid options fail before anything is written
+	nameOnly, err := reference.ParseNormalizedNamed("example.com/signed/image")
+	require.NoError(t, err)
+	for _, options := range []Options{
+		{SignBySigstorePrivateKey: []byte("not a key"), SignSigstorePrivateKeyPassphrase: passphrase},
+		{SignBySigstorePrivateKey: keyPair.PrivateKey, SignSigstorePrivateKeyPassphrase: []byte("wrong passphrase")},
+		{SignBySigstorePrivateKey: keyPair.PrivateKey},
+		{SignBySigstorePrivateKeyFile: filepath.Join(t.TempDir(), "missing.key"), SignSigstorePrivateKeyPassphrase: passphrase},
+		{SignBySigstorePrivateKeyFile: keyFile, SignBySigstorePrivateKey: keyPair.PrivateKey, SignSigstorePrivateKeyPassphrase: passphrase},
+		{SignBySigstorePrivateKey: keyPair.PrivateKey, SignSigstorePrivateKeyPassphrase: passphrase, SignIdentity: nameOnly},
+	} {
+		destDir := t.TempDir()
+		destRef, err := directory.NewReference(destDir)
+		require.NoError(t, err)
+		options.SourceCtx = sys
+		options.DestinationCtx = sys
+		_, err = Image(ctx, policyContext, destRef, srcRef, &options)
+		assert.Error(t, err)
+		_, err = os.Stat(filepath.Join(destDir, "manifest.json"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	}
+}
+
+// otherPublicKey returns a newly generated sigstore public key.
+func otherPublicKey(t *testing.T) []byte {
+	keyPair, err := sigstore.GenerateKeyPair([]byte("other passphrase"))
+	require.NoError(t, err)
+	return keyPair.PublicKey
+}
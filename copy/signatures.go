@@ -0,0 +1,178 @@
+package copy
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containers/image/v5/internal/imagesource"
+	"github.com/containers/image/v5/internal/imagesource/impl"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/set"
+	internalsig "github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// CopySignatures copies the signatures of srcRef to dstRef, which must already contain the same image,
+// with a manifest matching the manifest of srcRef; otherwise an error is returned, and dstRef is not modified.
+// This is intended for propagating signatures created after an image was copied, e.g. to a mirror.
+//
+// Layers are never read; the manifest and config are written to dstRef again, unchanged, together with the signatures,
+// because many transports only accept signatures as a part of writing an image.
+// Hence dstRef must use a transport which can reuse the layers it already contains (e.g. containers-storage: or
+// docker://); transports which always overwrite the complete destination, like dir:, cannot be used as dstRef.
+//
+// Signatures already present in dstRef are preserved; the signatures of srcRef which are not already present are added after them.
+// No signature policy is evaluated, and the copied signatures are not verified.
+func CopySignatures(ctx context.Context, sys *types.SystemContext, srcRef, dstRef types.ImageReference) error {
+	srcDigest, srcMIMEType, err := topLevelManifestDigest(ctx, sys, srcRef)
+	if err != nil {
+		return fmt.Errorf("reading manifest of %s: %w", transports.ImageName(srcRef), err)
+	}
+	dstDigest, _, err := topLevelManifestDigest(ctx, sys, dstRef)
+	if err != nil {
+		return fmt.Errorf("reading manifest of %s: %w", transports.ImageName(dstRef), err)
+	}
+	if srcDigest != dstDigest {
+		return fmt.Errorf("manifest of %s (%s) does not match manifest of %s (%s), refusing to copy signatures",
+			transports.ImageName(srcRef), srcDigest, transports.ImageName(dstRef), dstDigest)
+	}
+
+	// The image at dstRef is not changed, only signatures are added, so there is nothing for a policy to reject.
+	policyContext, err := signature.NewPolicyContext(&signature.Policy{
+		Default: []signature.PolicyRequirement{signature.NewPRInsecureAcceptAnything()},
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = policyContext.Destroy() // Nothing to do with the error, the signatures have already been copied or not.
+	}()
+
+	options := &Options{
+		SourceCtx:       sys,
+		DestinationCtx:  sys,
+		ManifestOnly:    true,
+		PreserveDigests: true,
+	}
+	if manifest.MIMETypeIsMultiImage(srcMIMEType) {
+		options.ImageListSelection = CopyAllImages
+	}
+	// Copying writes all signatures of the source, replacing the existing signatures in the destination;
+	// so, use a source which includes the existing signatures as well.
+	mergedSrcRef := mergedSignaturesReference{ImageReference: srcRef, existing: dstRef}
+	copiedManifest, err := Image(ctx, policyContext, dstRef, mergedSrcRef, options)
+	if err != nil {
+		return err
+	}
+	copiedDigest, err := manifest.Digest(copiedManifest)
+	if err != nil {
+		return err
+	}
+	if copiedDigest != srcDigest {
+		return fmt.Errorf("internal error: copying signatures of %s wrote manifest %s instead of %s",
+			transports.ImageName(srcRef), copiedDigest, srcDigest)
+	}
+	return nil
+}
+
+// topLevelManifestDigest returns the digest and MIME type of the top-level manifest of ref.
+func topLevelManifestDigest(ctx context.Context, sys *types.SystemContext, ref types.ImageReference) (digest.Digest, string, error) {
+	src, err := ref.NewImageSource(ctx, sys)
+	if err != nil {
+		return "", "", err
+	}
+	defer src.Close()
+	manifestBlob, mimeType, err := src.GetManifest(ctx, nil)
+	if err != nil {
+		return "", "", err
+	}
+	d, err := manifest.Digest(manifestBlob)
+	if err != nil {
+		return "", "", err
+	}
+	return d, mimeType, nil
+}
+
+// mergedSignaturesReference is an image reference which behaves like the embedded ImageReference,
+// except that image sources return the signatures of existing, followed by the signatures of the embedded reference.
+type mergedSignaturesReference struct {
+	types.ImageReference
+	existing types.ImageReference
+}
+
+// NewImageSource returns a types.ImageSource for this reference.
+// The caller must call .Close() on the returned ImageSource.
+func (ref mergedSignaturesReference) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
+	src, err := ref.ImageReference.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := ref.existing.NewImageSource(ctx, sys)
+	if err != nil {
+		src.Close()
+		return nil, err
+	}
+	s := &mergedSignaturesSource{
+		ImageSource: imagesource.FromPublic(src),
+		existing:    imagesource.FromPublic(existing),
+	}
+	s.compat = impl.AddCompat(s)
+	return s, nil
+}
+
+// mergedSignaturesSource is an image source returned by mergedSignaturesReference.
+type mergedSignaturesSource struct {
+	private.ImageSource
+	compat   impl.Compat
+	existing private.ImageSource
+}
+
+// Close removes resources associated with an initialized ImageSource, if any.
+func (s *mergedSignaturesSource) Close() error {
+	err := s.ImageSource.Close()
+	if err2 := s.existing.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// GetSignaturesWithFormat returns the image's signatures.  It may use a remote (= slow) service.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to retrieve signatures for
+// (when the primary manifest is a manifest list); this never happens if the primary manifest is not a manifest list
+// (e.g. if the source never returns manifest lists).
+func (s *mergedSignaturesSource) GetSignaturesWithFormat(ctx context.Context, instanceDigest *digest.Digest) ([]internalsig.Signature, error) {
+	existing, err := s.existing.GetSignaturesWithFormat(ctx, instanceDigest)
+	if err != nil {
+		return nil, fmt.Errorf("reading existing signatures: %w", err)
+	}
+	added, err := s.ImageSource.GetSignaturesWithFormat(ctx, instanceDigest)
+	if err != nil {
+		return nil, err
+	}
+	seen := set.New[string]()
+	res := []internalsig.Signature{}
+	for _, sig := range append(existing, added...) {
+		blob, err := internalsig.Blob(sig)
+		if err != nil {
+			return nil, err
+		}
+		if seen.Contains(string(blob)) {
+			continue
+		}
+		seen.Add(string(blob))
+		res = append(res, sig)
+	}
+	return res, nil
+}
+
+// GetSignatures returns the image's signatures.  It may use a remote (= slow) service.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to retrieve signatures for
+// (when the primary manifest is a manifest list); this never happens if the primary manifest is not a manifest list
+// (e.g. if the source never returns manifest lists).
+func (s *mergedSignaturesSource) GetSignatures(ctx context.Context, instanceDigest *digest.Digest) ([][]byte, error) {
+	return s.compat.GetSignatures(ctx, instanceDigest)
+}
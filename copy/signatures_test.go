@@ -0,0 +1,38 @@
+package copy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopySignatures(t *testing.T) {
+	ctx := context.Background()
+	sys := &types.SystemContext{BlobInfoCacheDir: t.TempDir()}
+
+	// Manifests don’t match; the destination is not modified.
+	// (Copying matching signatures is tested in the storage package, dir: destinations can’t be updated.)
+	srcRef := writeTestLabeledDirImage(t, map[string]string{"a": "b"})
+	// Start the signature with 0xA0 to fool internal/signature.FromBlob into thinking it is valid GPG
+	err := os.WriteFile(filepath.Join(srcRef.StringWithinTransport(), "signature-1"), []byte("\xA0Signature A"), 0o644)
+	require.NoError(t, err)
+	dstRef, _ := writeTestDirImage(t)
+	err = CopySignatures(ctx, sys, srcRef, dstRef)
+	assert.ErrorContains(t, err, "does not match")
+	_, err = os.Stat(filepath.Join(dstRef.StringWithinTransport(), "manifest.json"))
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dstRef.StringWithinTransport(), "signature-1"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// Source does not exist
+	missingRef, err := directory.NewReference(filepath.Join(t.TempDir(), "missing"))
+	require.NoError(t, err)
+	err = CopySignatures(ctx, sys, missingRef, dstRef)
+	assert.Error(t, err)
+}
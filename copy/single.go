@@ -11,6 +11,7 @@ import (
 	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/internal/image"
@@ -41,6 +42,7 @@ type imageCopier struct {
 	compressionFormat             *compressiontypes.Algorithm // Compression algorithm to use, if the user explicitly requested one, or nil.
 	compressionLevel              *int
 	requireCompressionFormatMatch bool
+	writtenImage                  types.Image // The image, with all edits, most recently written by copyUpdatedConfigAndManifest
 }
 
 type copySingleImageOptions struct {
@@ -55,6 +57,7 @@ type copySingleImageResult struct {
 	manifestMIMEType      string
 	manifestDigest        digest.Digest
 	compressionAlgorithms []compressiontypes.Algorithm
+	platform              *imgspecv1.Platform // Only set if c.options.ReportManifestDescriptor != nil
 }
 
 // copySingleImage copies a single (non-manifest-list) image unparsedImage, using c.policyContext to validate
@@ -81,6 +84,9 @@ func (c *copier) copySingleImage(ctx context.Context, unparsedImage *image.Unpar
 	if err != nil {
 		return copySingleImageResult{}, fmt.Errorf("initializing image from source %s: %w", transports.ImageName(c.rawSource.Reference()), err)
 	}
+	if err := checkBlobCount(c.options.SourceCtx, src); err != nil {
+		return copySingleImageResult{}, fmt.Errorf("copying image from source %s: %w", transports.ImageName(c.rawSource.Reference()), err)
+	}
 
 	// If the destination is a digested reference, make a note of that, determine what digest value we're
 	// expecting, and check that the source manifest matches it.  If the source manifest doesn't, but it's
@@ -133,6 +139,9 @@ func (c *copier) copySingleImage(ctx context.Context, unparsedImage *image.Unpar
 	if c.options.PreserveDigests {
 		cannotModifyManifestReason = "Instructed to preserve digests"
 	}
+	if c.options.ImageTransform != nil && cannotModifyManifestReason != "" {
+		return copySingleImageResult{}, fmt.Errorf("Can not transform the image: %s", cannotModifyManifestReason)
+	}
 
 	ic := imageCopier{
 		c:               c,
@@ -192,6 +201,7 @@ func (c *copier) copySingleImage(ctx context.Context, unparsedImage *image.Unpar
 		srcMIMEType:                    ic.src.ManifestMIMEType,
 		destSupportedManifestMIMETypes: ic.c.dest.SupportedManifestMIMETypes(),
 		forceManifestMIMEType:          c.options.ForceManifestMIMEType,
+		allowedManifestMIMETypes:       allowedDestinationManifestMIMETypes(c.options.DestinationCtx),
 		requestedCompressionFormat:     ic.compressionFormat,
 		requiresOCIEncryption:          destRequiresOciEncryption,
 		cannotModifyManifestReason:     ic.cannotModifyManifestReason,
@@ -216,7 +226,7 @@ func (c *copier) copySingleImage(ctx context.Context, unparsedImage *image.Unpar
 		noPendingManifestUpdates := ic.noPendingManifestUpdates()
 
 		logrus.Debugf("Checking if we can skip copying: has signatures=%t, OCI encryption=%t, no manifest updates=%t, compression match required for reusing blobs=%t", shouldUpdateSigs, destRequiresOciEncryption, noPendingManifestUpdates, opts.requireCompressionFormatMatch)
-		if !shouldUpdateSigs && !destRequiresOciEncryption && noPendingManifestUpdates && !ic.requireCompressionFormatMatch {
+		if !shouldUpdateSigs && !destRequiresOciEncryption && noPendingManifestUpdates && !ic.requireCompressionFormatMatch && c.options.ImageTransform == nil {
 			matchedResult, err := ic.compareImageDestinationManifestEqual(ctx, targetInstance)
 			if err != nil {
 				logrus.Warnf("Failed to compare destination image manifest: %v", err)
@@ -225,6 +235,12 @@ func (c *copier) copySingleImage(ctx context.Context, unparsedImage *image.Unpar
 
 			if matchedResult != nil {
 				c.Printf("Skipping: image already present at destination\n")
+				if c.options.ReportManifestDescriptor != nil {
+					matchedResult.platform, err = writtenImagePlatform(ctx, ic.src)
+					if err != nil {
+						return copySingleImageResult{}, err
+					}
+				}
 				return *matchedResult, nil
 			}
 		}
@@ -312,10 +328,31 @@ func (c *copier) copySingleImage(ctx context.Context, unparsedImage *image.Unpar
 		}
 	}
 	wipResult.compressionAlgorithms = compressionAlgos
+	if c.options.ReportManifestDescriptor != nil {
+		wipResult.platform, err = writtenImagePlatform(ctx, ic.writtenImage)
+		if err != nil {
+			return copySingleImageResult{}, err
+		}
+	}
 	res := wipResult // We are done
 	return res, nil
 }
 
+// checkBlobCount enforces sys.MaxBlobsPerImage for src.
+func checkBlobCount(sys *types.SystemContext, src types.Image) error {
+	if sys == nil || sys.MaxBlobsPerImage <= 0 {
+		return nil
+	}
+	count := len(src.LayerInfos())
+	if src.ConfigInfo().Digest != "" {
+		count++
+	}
+	if count > sys.MaxBlobsPerImage {
+		return fmt.Errorf("image references %d blobs, more than the maximum of %d", count, sys.MaxBlobsPerImage)
+	}
+	return nil
+}
+
 // prepareImageConfigForDest enforces dest.MustMatchRuntimeOS and handles dest.NoteOriginalOCIConfig, if necessary.
 func prepareImageConfigForDest(ctx context.Context, sys *types.SystemContext, src types.Image, dest private.ImageDestination) error {
 	ociConfig, configErr := src.OCIConfig(ctx)
@@ -353,6 +390,15 @@ func prepareImageConfigForDest(ctx context.Context, sys *types.SystemContext, sr
 	return nil
 }
 
+// writtenImagePlatform returns the platform of img, a single image written to the destination, as recorded in its config.
+func writtenImagePlatform(ctx context.Context, img types.Image) (*imgspecv1.Platform, error) {
+	p, err := image.Platform(ctx, img)
+	if err != nil {
+		return nil, fmt.Errorf("determining the platform of the copied image: %w", err)
+	}
+	return &p, nil
+}
+
 // updateEmbeddedDockerReference handles the Docker reference embedded in Docker schema1 manifests.
 func (ic *imageCopier) updateEmbeddedDockerReference() error {
 	if ic.c.dest.IgnoresEmbeddedDockerReference() {
@@ -467,6 +513,13 @@ func (ic *imageCopier) copyLayers(ctx context.Context) ([]compressiontypes.Algor
 	// copyGroup is used to determine if all layers are copied
 	copyGroup := sync.WaitGroup{}
 
+	// copyCtx is cancelled as soon as copying any layer fails, so that the other layer copies stop,
+	// and no new ones are started, instead of continuing to copy an image which can no longer be committed.
+	copyCtx, cancelCopies := context.WithCancel(ctx)
+	defer cancelCopies()
+	var firstErrOnce sync.Once
+	var firstErr error // Set at most once, protected by firstErrOnce and then by copyGroup.Wait()
+
 	data := make([]copyLayerData, len(srcInfos))
 	copyLayerHelper := func(index int, srcLayer types.BlobInfo, toEncrypt bool, pool *mpb.Progress, srcRef reference.Named) {
 		defer ic.c.concurrentBlobCopiesSemaphore.Release(1)
@@ -483,9 +536,15 @@ func (ic *imageCopier) copyLayers(ctx context.Context) ([]compressiontypes.Algor
 				logrus.Debugf("Skipping foreign layer %q copy to %s", cld.destInfo.Digest, ic.c.dest.Reference().Transport().Name())
 			}
 		} else {
-			cld.destInfo, cld.diffID, cld.err = ic.copyLayer(ctx, srcLayer, toEncrypt, pool, index, srcRef, manifestLayerInfos[index].EmptyLayer)
+			cld.destInfo, cld.diffID, cld.err = ic.copyLayer(copyCtx, srcLayer, toEncrypt, pool, index, srcRef, manifestLayerInfos[index].EmptyLayer)
 		}
 		data[index] = cld
+		if cld.err != nil {
+			firstErrOnce.Do(func() {
+				firstErr = cld.err
+				cancelCopies()
+			})
+		}
 	}
 
 	// Decide which layers to encrypt
@@ -518,7 +577,11 @@ func (ic *imageCopier) copyLayers(ctx context.Context) ([]compressiontypes.Algor
 		defer copyGroup.Wait()
 
 		for i, srcLayer := range srcInfos {
-			if err := ic.c.concurrentBlobCopiesSemaphore.Acquire(ctx, 1); err != nil {
+			if err := ic.c.concurrentBlobCopiesSemaphore.Acquire(copyCtx, 1); err != nil {
+				if ctx.Err() == nil {
+					// copyCtx was cancelled because copying a layer failed; that error is reported below.
+					break
+				}
 				// This can only fail with ctx.Err(), so no need to blame acquiring the semaphore.
 				return fmt.Errorf("copying layer: %w", err)
 			}
@@ -531,6 +594,10 @@ func (ic *imageCopier) copyLayers(ctx context.Context) ([]compressiontypes.Algor
 	}(); err != nil {
 		return nil, err
 	}
+	if firstErr != nil {
+		// Report the error which caused the other layer copies to be cancelled, not the resulting cancellations.
+		return nil, firstErr
+	}
 
 	compressionAlgos := set.New[string]()
 	destInfos := make([]types.BlobInfo, len(srcInfos))
@@ -597,6 +664,12 @@ func (ic *imageCopier) copyUpdatedConfigAndManifest(ctx context.Context, instanc
 	if err != nil {
 		return nil, "", fmt.Errorf("reading manifest: %w", err)
 	}
+	if ic.c.options.ImageTransform != nil {
+		pendingImage, man, err = applyImageTransform(ctx, pendingImage, ic.c.options.ImageTransform)
+		if err != nil {
+			return nil, "", err
+		}
+	}
 
 	if err := ic.copyConfig(ctx, pendingImage); err != nil {
 		return nil, "", err
@@ -614,6 +687,7 @@ func (ic *imageCopier) copyUpdatedConfigAndManifest(ctx context.Context, instanc
 		logrus.Debugf("Error %v while writing manifest %q", err, string(man))
 		return nil, "", fmt.Errorf("writing manifest: %w", err)
 	}
+	ic.writtenImage = pendingImage
 	return man, manifestDigest, nil
 }
 
@@ -627,6 +701,7 @@ func (ic *imageCopier) copyConfig(ctx context.Context, src types.Image) error {
 		}
 		defer ic.c.concurrentBlobCopiesSemaphore.Release(1)
 
+		start := time.Now()
 		destInfo, err := func() (types.BlobInfo, error) { // A scope for defer
 			progressPool := ic.c.newProgressPool()
 			defer progressPool.Wait()
@@ -656,6 +731,14 @@ func (ic *imageCopier) copyConfig(ctx context.Context, src types.Image) error {
 		if destInfo.Digest != srcInfo.Digest {
 			return fmt.Errorf("Internal error: copying uncompressed config blob %s changed digest to %s", srcInfo.Digest, destInfo.Digest)
 		}
+		ic.c.transferLog.recordBlob(BlobTransferEvent{
+			Source:          ic.c.rawSource.Reference(),
+			SourceBlob:      srcInfo,
+			DestinationBlob: destInfo,
+			Config:          true,
+			Outcome:         BlobTransferPushed,
+			Duration:        time.Since(start),
+		})
 	}
 	return nil
 }
@@ -713,6 +796,16 @@ func (ic *imageCopier) copyLayer(ctx context.Context, srcInfo types.BlobInfo, to
 	}
 
 	ic.c.printCopyInfo("blob", srcInfo)
+	start := time.Now()
+	recordTransfer := func(destInfo types.BlobInfo, outcome BlobTransferOutcome) {
+		ic.c.transferLog.recordBlob(BlobTransferEvent{
+			Source:          ic.c.rawSource.Reference(),
+			SourceBlob:      srcInfo,
+			DestinationBlob: destInfo,
+			Outcome:         outcome,
+			Duration:        time.Since(start),
+		})
+	}
 
 	diffIDIsNeeded := false
 	var cachedDiffID digest.Digest = ""
@@ -789,8 +882,17 @@ func (ic *imageCopier) copyLayer(ctx context.Context, srcInfo types.BlobInfo, to
 				}
 			}
 
-			return updatedBlobInfoFromReuse(srcInfo, reusedBlob), cachedDiffID, nil
+			blobInfo := updatedBlobInfoFromReuse(srcInfo, reusedBlob)
+			recordTransfer(blobInfo, BlobTransferReused)
+			return blobInfo, cachedDiffID, nil
+		}
+	}
+
+	if ic.c.options.ManifestOnly {
+		if !canAvoidProcessingCompleteLayer {
+			return types.BlobInfo{}, "", fmt.Errorf("layer %s would have to be read to compute its uncompressed digest, which is not possible when copying only the manifest", srcInfo.Digest)
 		}
+		return types.BlobInfo{}, "", fmt.Errorf("layer %s is not present at the destination; copying only the manifest requires all layers to already exist there", srcInfo.Digest)
 	}
 
 	// A partial pull is managed by the destination storage, that decides what portions
@@ -839,6 +941,7 @@ func (ic *imageCopier) copyLayer(ctx context.Context, srcInfo types.BlobInfo, to
 			return types.BlobInfo{}, "", fmt.Errorf("partial pull of blob %s: %w", srcInfo.Digest, err)
 		}
 		if reused {
+			recordTransfer(blobInfo, BlobTransferPartial)
 			return blobInfo, cachedDiffID, nil
 		}
 	}
@@ -888,6 +991,7 @@ func (ic *imageCopier) copyLayer(ctx context.Context, srcInfo types.BlobInfo, to
 		}
 
 		bar.mark100PercentComplete()
+		recordTransfer(blobInfo, BlobTransferPushed)
 		return blobInfo, diffID, nil
 	}()
 }
@@ -0,0 +1,124 @@
+package copy
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/containers/image/v5/image"
+	"github.com/containers/image/v5/internal/imagesource"
+	internalManifest "github.com/containers/image/v5/internal/manifest"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// existingManifestIfUnchanged implements options.SkipIfDigestPresent: it returns the manifest destRef already contains,
+// if its digest matches the manifest copying srcRef would write to the destination, or nil otherwise.
+// Before returning an existing manifest, the images which would have been copied are checked against policyContext,
+// exactly as if they were copied.
+// This must be called before opening destRef as a destination, because some transports erase existing data when doing that.
+func existingManifestIfUnchanged(ctx context.Context, policyContext *signature.PolicyContext, destRef, srcRef types.ImageReference, options *Options) ([]byte, error) {
+	if len(options.Signers) > 0 || options.SignBy != "" || options.SignBySigstorePrivateKeyFile != "" || len(options.SignBySigstorePrivateKey) > 0 {
+		logrus.Debugf("Signing was requested, not skipping the copy to %s", transports.ImageName(destRef))
+		return nil, nil
+	}
+
+	publicSrc, err := srcRef.NewImageSource(ctx, options.SourceCtx)
+	if err != nil {
+		return nil, fmt.Errorf("initializing source %s: %w", transports.ImageName(srcRef), err)
+	}
+	src := imagesource.FromPublic(publicSrc)
+	defer src.Close()
+	sourceDigest, copiedInstances, signedInstances, err := sourceManifestDigest(ctx, src, options)
+	if err != nil {
+		return nil, fmt.Errorf("determining manifest digest for %s: %w", transports.ImageName(srcRef), err)
+	}
+	if !options.RemoveSignatures {
+		// The copy would add the source signatures to the destination, so it can’t be skipped if there are any.
+		for _, instanceDigest := range signedInstances {
+			sigs, err := src.GetSignaturesWithFormat(ctx, instanceDigest)
+			if err != nil {
+				return nil, fmt.Errorf("reading signatures of %s: %w", transports.ImageName(srcRef), err)
+			}
+			if len(sigs) > 0 {
+				logrus.Debugf("Source %s has signatures, not skipping the copy", transports.ImageName(srcRef))
+				return nil, nil
+			}
+		}
+	}
+
+	dest, err := destRef.NewImageSource(ctx, options.DestinationCtx)
+	if err != nil {
+		logrus.Debugf("Can't read existing manifest of %s, not skipping the copy: %v", transports.ImageName(destRef), err)
+		return nil, nil
+	}
+	defer dest.Close()
+	existing, _, err := dest.GetManifest(ctx, nil)
+	if err != nil {
+		logrus.Debugf("Can't read existing manifest of %s, not skipping the copy: %v", transports.ImageName(destRef), err)
+		return nil, nil
+	}
+	matches, err := manifest.MatchesDigest(existing, sourceDigest)
+	if err != nil || !matches {
+		logrus.Debugf("Existing manifest of %s does not match %s, not skipping the copy", transports.ImageName(destRef), sourceDigest.String())
+		return nil, nil
+	}
+
+	// Skipping the copy must not allow using images which would be rejected by the policy if they were copied.
+	for _, instanceDigest := range copiedInstances {
+		unparsedImage := image.UnparsedInstance(src, instanceDigest)
+		if allowed, err := policyContext.IsRunningImageAllowed(ctx, unparsedImage); !allowed || err != nil { // Be paranoid and fail if either return value indicates so.
+			return nil, fmt.Errorf("Source image rejected: %w", err)
+		}
+	}
+	logrus.Debugf("Destination %s already contains manifest %s, skipping the copy", transports.ImageName(destRef), sourceDigest.String())
+	return existing, nil
+}
+
+// sourceManifestDigest returns the digest of the manifest copying src would write to the destination, if the manifest
+// is not modified: the top-level manifest, or the instance chosen for the current system if src is a manifest list
+// and options.ImageListSelection == CopySystemImage.
+// It also returns the instances (nil for the top-level manifest) which would be copied, and checked by the policy,
+// and the instances whose signatures would be copied.
+func sourceManifestDigest(ctx context.Context, src types.ImageSource, options *Options) (digest.Digest, []*digest.Digest, []*digest.Digest, error) {
+	mfest, manifestType, err := image.UnparsedInstance(src, nil).Manifest(ctx)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if !manifest.MIMETypeIsMultiImage(manifestType) {
+		d, err := manifest.Digest(mfest)
+		return d, []*digest.Digest{nil}, []*digest.Digest{nil}, err
+	}
+	manifestList, err := internalManifest.ListFromBlob(mfest, manifestType)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if options.ImageListSelection != CopySystemImage {
+		d, err := manifest.Digest(mfest)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		copiedInstances := []*digest.Digest{}
+		for _, instanceDigest := range manifestList.Instances() {
+			if options.ImageListSelection == CopySpecificImages && !slices.Contains(options.Instances, instanceDigest) {
+				continue
+			}
+			copiedInstances = append(copiedInstances, &instanceDigest)
+		}
+		return d, copiedInstances, append([]*digest.Digest{nil}, copiedInstances...), nil
+	}
+	instanceDigest, err := manifestList.ChooseInstanceByCompression(options.SourceCtx, options.PreferGzipInstances)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	mfest, _, err = image.UnparsedInstance(src, &instanceDigest).Manifest(ctx)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	d, err := manifest.Digest(mfest)
+	return d, []*digest.Digest{&instanceDigest}, []*digest.Digest{&instanceDigest}, err
+}
@@ -0,0 +1,113 @@
+package copy
+
+import (
+	"sync"
+	"time"
+
+	"github.com/containers/image/v5/types"
+)
+
+// BlobTransferOutcome describes how a blob was made available at the destination.
+type BlobTransferOutcome int
+
+const (
+	// BlobTransferPushed means that the blob was read from the source and written to the destination.
+	BlobTransferPushed BlobTransferOutcome = iota
+	// BlobTransferReused means that the destination already contained the blob, or an equivalent one, so it was not read from the source.
+	BlobTransferReused
+	// BlobTransferPartial means that the destination only fetched the parts of the blob it did not already have.
+	BlobTransferPartial
+)
+
+// String returns a human-readable name of the outcome.
+func (o BlobTransferOutcome) String() string {
+	switch o {
+	case BlobTransferPushed:
+		return "pushed"
+	case BlobTransferReused:
+		return "reused"
+	case BlobTransferPartial:
+		return "partial"
+	default:
+		return "unknown"
+	}
+}
+
+// BlobTransferEvent records a single blob (a layer or a config) copied to the destination.
+type BlobTransferEvent struct {
+	Source          types.ImageReference // The image the blob belongs to
+	SourceBlob      types.BlobInfo       // The blob as referenced by the source image
+	DestinationBlob types.BlobInfo       // The blob as referenced by the destination image; the digest and size differ from SourceBlob if it was (de)compressed
+	Config          bool                 // True if the blob is the image config, false if it is a layer
+	Outcome         BlobTransferOutcome
+	Duration        time.Duration
+}
+
+// TransferSummary summarizes all blobs copied by a single copy.Image call.
+type TransferSummary struct {
+	PushedBlobs  int
+	PushedBytes  int64 // Sum of DestinationBlob.Size of the pushed blobs
+	ReusedBlobs  int
+	PartialBlobs int
+	Duration     time.Duration // The duration of the whole copy operation
+}
+
+// TransferLogger receives a record of blobs copied by copy.Image, e.g. for auditing.
+// It is only informed about the copy operation and has no way to affect it.
+type TransferLogger interface {
+	// BlobTransferred is called after a blob is successfully made available at the destination.
+	// Calls are serialized, but they may come from different goroutines, and in any order.
+	BlobTransferred(event BlobTransferEvent)
+	// CopyCompleted is called once, after the copied image has been successfully committed.
+	// It is not called if the copy fails.
+	CopyCompleted(summary TransferSummary)
+}
+
+// transferLog tracks the events reported to a TransferLogger during a single copy.Image call.
+type transferLog struct {
+	logger TransferLogger // nil if the caller did not ask for a transfer log
+	start  time.Time
+
+	lock    sync.Mutex // Protects summary, and serializes calls to logger
+	summary TransferSummary
+}
+
+// newTransferLog returns a transferLog reporting to logger, which may be nil.
+func newTransferLog(logger TransferLogger) *transferLog {
+	return &transferLog{
+		logger: logger,
+		start:  time.Now(),
+	}
+}
+
+// recordBlob reports event to the logger, if any.
+func (l *transferLog) recordBlob(event BlobTransferEvent) {
+	if l.logger == nil {
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	switch event.Outcome {
+	case BlobTransferPushed:
+		l.summary.PushedBlobs++
+		if event.DestinationBlob.Size > 0 {
+			l.summary.PushedBytes += event.DestinationBlob.Size
+		}
+	case BlobTransferReused:
+		l.summary.ReusedBlobs++
+	case BlobTransferPartial:
+		l.summary.PartialBlobs++
+	}
+	l.logger.BlobTransferred(event)
+}
+
+// complete reports the summary of the copy to the logger, if any.
+func (l *transferLog) complete() {
+	if l.logger == nil {
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.summary.Duration = time.Since(l.start)
+	l.logger.CopyCompleted(l.summary)
+}
@@ -0,0 +1,145 @@
+package copy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// ImageTransform edits the manifest and config of a single image during copy.Image, before they are written to the destination.
+// It is given the manifest with its MIME type, and the config blob (nil for images without a separate config, e.g. docker schema1),
+// and returns the edited manifest and config; it may return its inputs unmodified.
+//
+// The returned manifest must have the same MIME type and refer to the same layers.
+// If the config is modified, the config descriptor in the manifest is updated by the copy code, so the transform does not need to compute digests.
+type ImageTransform func(manifest []byte, manifestMIMEType string, config []byte) ([]byte, []byte, error)
+
+// transformedImage is a types.Image with a manifest and config edited by an ImageTransform.
+// Only Manifest, ConfigInfo, ConfigBlob and OCIConfig reflect the edits; it is only intended to be consumed by copyConfig
+// and writtenImagePlatform.
+type transformedImage struct {
+	types.Image
+	manifest         []byte
+	manifestMIMEType string
+	configInfo       types.BlobInfo
+	config           []byte
+}
+
+func (i *transformedImage) Manifest(ctx context.Context) ([]byte, string, error) {
+	return i.manifest, i.manifestMIMEType, nil
+}
+
+func (i *transformedImage) ConfigInfo() types.BlobInfo {
+	return i.configInfo
+}
+
+func (i *transformedImage) ConfigBlob(ctx context.Context) ([]byte, error) {
+	return i.config, nil
+}
+
+func (i *transformedImage) OCIConfig(ctx context.Context) (*imgspecv1.Image, error) {
+	if i.config == nil {
+		// Docker schema1, which records the platform in the manifest. Building a full config would require
+		// converting the manifest; only the platform is needed by writtenImagePlatform, so only the platform is set.
+		m, err := manifest.FromBlob(i.manifest, i.manifestMIMEType)
+		if err != nil {
+			return nil, err
+		}
+		info, err := m.Inspect(nil)
+		if err != nil {
+			return nil, err
+		}
+		return &imgspecv1.Image{Platform: imgspecv1.Platform{OS: info.Os, Architecture: info.Architecture}}, nil
+	}
+	// Docker schema2 configs are parsed the same way, see internal/image.manifestSchema2.OCIConfig.
+	config := &imgspecv1.Image{}
+	if err := json.Unmarshal(i.config, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// applyImageTransform applies transform to img, and returns the edited image and its manifest.
+func applyImageTransform(ctx context.Context, img types.Image, transform ImageTransform) (types.Image, []byte, error) {
+	man, mimeType, err := img.Manifest(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading manifest: %w", err)
+	}
+	var config []byte
+	if img.ConfigInfo().Digest != "" {
+		config, err = img.ConfigBlob(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading config: %w", err)
+		}
+	}
+
+	newMan, newConfig, err := transform(slices.Clone(man), mimeType, slices.Clone(config))
+	if err != nil {
+		return nil, nil, fmt.Errorf("transforming image: %w", err)
+	}
+	if bytes.Equal(newMan, man) && bytes.Equal(newConfig, config) {
+		return img, man, nil
+	}
+
+	origParsed, err := manifest.FromBlob(man, mimeType)
+	if err != nil {
+		return nil, nil, err
+	}
+	parsed, err := manifest.FromBlob(newMan, mimeType)
+	if err != nil {
+		return nil, nil, fmt.Errorf("image transform produced an invalid manifest: %w", err)
+	}
+	if guessed := manifest.GuessMIMEType(newMan); guessed != "" && manifest.NormalizedMIMEType(guessed) != manifest.NormalizedMIMEType(mimeType) {
+		return nil, nil, fmt.Errorf("image transform changed the manifest type from %s to %s", mimeType, guessed)
+	}
+	if layerDigestsDiffer(blobInfosOfLayers(origParsed.LayerInfos()), blobInfosOfLayers(parsed.LayerInfos())) {
+		return nil, nil, errors.New("image transform changed the layers of the image")
+	}
+
+	configInfo := parsed.ConfigInfo()
+	if config == nil {
+		if newConfig != nil {
+			return nil, nil, errors.New("image transform added a config to an image which does not have a separate config")
+		}
+	} else {
+		if !json.Valid(newConfig) {
+			return nil, nil, errors.New("image transform produced an invalid config")
+		}
+		if configInfo.Digest != digest.FromBytes(newConfig) || configInfo.Size != int64(len(newConfig)) {
+			newMan, err = manifest.UpdateConfig(newMan, mimeType, newConfig, "")
+			if err != nil {
+				return nil, nil, err
+			}
+			parsed, err = manifest.FromBlob(newMan, mimeType)
+			if err != nil {
+				return nil, nil, err
+			}
+			configInfo = parsed.ConfigInfo()
+		}
+	}
+
+	return &transformedImage{
+		Image:            img,
+		manifest:         newMan,
+		manifestMIMEType: mimeType,
+		configInfo:       configInfo,
+		config:           newConfig,
+	}, newMan, nil
+}
+
+// blobInfosOfLayers returns the BlobInfo values of layers.
+func blobInfosOfLayers(layers []manifest.LayerInfo) []types.BlobInfo {
+	res := make([]types.BlobInfo, 0, len(layers))
+	for _, l := range layers {
+		res = append(res, l.BlobInfo)
+	}
+	return res
+}
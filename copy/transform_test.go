@@ -0,0 +1,138 @@
+package copy
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/containers/image/v5/image"
+	"github.com/containers/image/v5/internal/testing/imagetest"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/oci/layout"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestLabeledDirImage creates a single-layer OCI image with the specified config labels in a dir: directory.
+func writeTestLabeledDirImage(t *testing.T, labels map[string]string) types.ImageReference {
+	layer := []byte("layer contents")
+	config, err := json.Marshal(imgspecv1.Image{
+		Platform: imgspecv1.Platform{OS: "linux", Architecture: "amd64"},
+		Config:   imgspecv1.ImageConfig{Labels: labels},
+		RootFS:   imgspecv1.RootFS{Type: "layers", DiffIDs: []digest.Digest{digest.FromBytes(layer)}},
+	})
+	require.NoError(t, err)
+	return imagetest.WriteDirImage(t, imgspecv1.MediaTypeImageManifest, config, []imagetest.Blob{{MediaType: imgspecv1.MediaTypeImageLayer, Data: layer}})
+}
+
+// stripLabelTransform is an ImageTransform removing the specified label from OCI configs.
+func stripLabelTransform(label string) ImageTransform {
+	return func(manifestBlob []byte, manifestMIMEType string, config []byte) ([]byte, []byte, error) {
+		var parsed imgspecv1.Image
+		if err := json.Unmarshal(config, &parsed); err != nil {
+			return nil, nil, err
+		}
+		delete(parsed.Config.Labels, label)
+		newConfig, err := json.Marshal(parsed)
+		if err != nil {
+			return nil, nil, err
+		}
+		return manifestBlob, newConfig, nil
+	}
+}
+
+func TestImageTransform(t *testing.T) {
+	ctx := context.Background()
+	policyContext := imagetest.AcceptAnythingPolicyContext(t)
+	sys := &types.SystemContext{BlobInfoCacheDir: t.TempDir()}
+
+	srcRef := writeTestLabeledDirImage(t, map[string]string{"build-secret": "hunter2", "version": "1.0"})
+
+	destRef, err := layout.NewReference(t.TempDir(), "dest")
+	require.NoError(t, err)
+	manifestBlob, err := Image(ctx, policyContext, destRef, srcRef, &Options{
+		SourceCtx:      sys,
+		DestinationCtx: sys,
+		ImageTransform: stripLabelTransform("build-secret"),
+	})
+	require.NoError(t, err)
+
+	src, err := destRef.NewImageSource(ctx, sys)
+	require.NoError(t, err)
+	img, err := image.FromSource(ctx, sys, src)
+	require.NoError(t, err)
+	defer img.Close()
+	destManifest, _, err := img.Manifest(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, manifestBlob, destManifest)
+	config, err := img.ConfigBlob(ctx) // This verifies the config digest
+	require.NoError(t, err)
+	assert.Equal(t, img.ConfigInfo().Digest, digest.FromBytes(config))
+	assert.Equal(t, img.ConfigInfo().Size, int64(len(config)))
+	ociConfig, err := img.OCIConfig(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"version": "1.0"}, ociConfig.Config.Labels)
+
+	// Transforms producing invalid results are rejected
+	for _, transform := range []ImageTransform{
+		func(manifestBlob []byte, manifestMIMEType string, config []byte) ([]byte, []byte, error) {
+			return []byte("this is not a manifest"), config, nil
+		},
+		func(manifestBlob []byte, manifestMIMEType string, config []byte) ([]byte, []byte, error) {
+			return manifestBlob, []byte("this is not a config"), nil
+		},
+		func(manifestBlob []byte, manifestMIMEType string, config []byte) ([]byte, []byte, error) {
+			var m imgspecv1.Manifest
+			if err := json.Unmarshal(manifestBlob, &m); err != nil {
+				return nil, nil, err
+			}
+			m.Layers = nil
+			newManifest, err := json.Marshal(m)
+			return newManifest, config, err
+		},
+	} {
+		destRef, err := layout.NewReference(t.TempDir(), "dest")
+		require.NoError(t, err)
+		_, err = Image(ctx, policyContext, destRef, srcRef, &Options{
+			SourceCtx:      sys,
+			DestinationCtx: sys,
+			ImageTransform: transform,
+		})
+		assert.Error(t, err)
+	}
+
+	// Transforms can’t be combined with preserving digests
+	destRef, err = layout.NewReference(t.TempDir(), "dest")
+	require.NoError(t, err)
+	_, err = Image(ctx, policyContext, destRef, srcRef, &Options{
+		SourceCtx:       sys,
+		DestinationCtx:  sys,
+		PreserveDigests: true,
+		ImageTransform:  stripLabelTransform("build-secret"),
+	})
+	assert.Error(t, err)
+}
+
+func TestTransformedImageOCIConfig(t *testing.T) {
+	ctx := context.Background()
+
+	// An edited config
+	config, err := json.Marshal(imgspecv1.Image{Platform: imgspecv1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}})
+	require.NoError(t, err)
+	img := &transformedImage{config: config}
+	res, err := img.OCIConfig(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, imgspecv1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}, res.Platform)
+
+	// Docker schema1, with no separate config
+	schema1, err := os.ReadFile("../internal/image/fixtures/schema1.json")
+	require.NoError(t, err)
+	img = &transformedImage{manifest: schema1, manifestMIMEType: manifest.DockerV2Schema1SignedMediaType}
+	res, err = img.OCIConfig(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, imgspecv1.Platform{OS: "linux", Architecture: "amd64"}, res.Platform)
+}
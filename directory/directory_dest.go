@@ -33,13 +33,21 @@ type dirImageDestination struct {
 	stubs.NoPutBlobPartialInitialize
 	stubs.AlwaysSupportsSignatures
 
-	ref dirReference
+	ref             dirReference
+	sigstorePattern string // SystemContext.DirSigstoreSignaturePattern, or "" to use the default signature paths
 }
 
 // newImageDestination returns an ImageDestination for writing to a directory.
 func newImageDestination(sys *types.SystemContext, ref dirReference) (private.ImageDestination, error) {
 	desiredLayerCompression := types.PreserveOriginal
+	sigstorePattern := ""
 	if sys != nil {
+		if sys.DirSigstoreSignaturePattern != "" {
+			if err := validateSigstoreSignaturePattern(sys.DirSigstoreSignaturePattern); err != nil {
+				return nil, err
+			}
+			sigstorePattern = sys.DirSigstoreSignaturePattern
+		}
 		if sys.DirForceCompress {
 			desiredLayerCompression = types.Compress
 
@@ -111,7 +119,8 @@ func newImageDestination(sys *types.SystemContext, ref dirReference) (private.Im
 		}),
 		NoPutBlobPartialInitialize: stubs.NoPutBlobPartial(ref),
 
-		ref: ref,
+		ref:             ref,
+		sigstorePattern: sigstorePattern,
 	}
 	d.Compat = impl.AddCompat(d)
 	return d, nil
@@ -236,14 +245,28 @@ func (d *dirImageDestination) PutManifest(ctx context.Context, manifest []byte,
 // (when the primary manifest is a manifest list); this should always be nil if the primary manifest is not a manifest list.
 // MUST be called after PutManifest (signatures may reference manifest contents).
 func (d *dirImageDestination) PutSignaturesWithFormat(ctx context.Context, signatures []signature.Signature, instanceDigest *digest.Digest) error {
-	for i, sig := range signatures {
+	defaultIndex, sigstoreIndex := 0, 0
+	for _, sig := range signatures {
 		blob, err := signature.Blob(sig)
 		if err != nil {
 			return err
 		}
-		path, err := d.ref.signaturePath(i, instanceDigest)
-		if err != nil {
-			return err
+		var path string
+		if _, ok := sig.(signature.Sigstore); ok && d.sigstorePattern != "" {
+			path, err = d.ref.sigstoreSignaturePath(d.sigstorePattern, sigstoreIndex, instanceDigest)
+			if err != nil {
+				return err
+			}
+			sigstoreIndex++
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
+			}
+		} else {
+			path, err = d.ref.signaturePath(defaultIndex, instanceDigest)
+			if err != nil {
+				return err
+			}
+			defaultIndex++
 		}
 		if err := os.WriteFile(path, blob, 0644); err != nil {
 			return err
@@ -21,22 +21,31 @@ type dirImageSource struct {
 	impl.DoesNotAffectLayerInfosForCopy
 	stubs.NoGetBlobAtInitialize
 
-	ref dirReference
+	ref             dirReference
+	sigstorePattern string // SystemContext.DirSigstoreSignaturePattern, or "" if only the default signature paths are used
 }
 
 // newImageSource returns an ImageSource reading from an existing directory.
 // The caller must call .Close() on the returned ImageSource.
-func newImageSource(ref dirReference) private.ImageSource {
+func newImageSource(sys *types.SystemContext, ref dirReference) (private.ImageSource, error) {
+	sigstorePattern := ""
+	if sys != nil && sys.DirSigstoreSignaturePattern != "" {
+		if err := validateSigstoreSignaturePattern(sys.DirSigstoreSignaturePattern); err != nil {
+			return nil, err
+		}
+		sigstorePattern = sys.DirSigstoreSignaturePattern
+	}
 	s := &dirImageSource{
 		PropertyMethodsInitialize: impl.PropertyMethods(impl.Properties{
 			HasThreadSafeGetBlob: false,
 		}),
 		NoGetBlobAtInitialize: stubs.NoGetBlobAt(ref),
 
-		ref: ref,
+		ref:             ref,
+		sigstorePattern: sigstorePattern,
 	}
 	s.Compat = impl.AddCompat(s)
-	return s
+	return s, nil
 }
 
 // Reference returns the reference used to set up this source, _as specified by the user_
@@ -89,10 +98,31 @@ func (s *dirImageSource) GetBlob(ctx context.Context, info types.BlobInfo, cache
 // If instanceDigest is not nil, it contains a digest of the specific manifest instance to retrieve signatures for
 // (when the primary manifest is a manifest list); this never happens if the primary manifest is not a manifest list
 // (e.g. if the source never returns manifest lists).
+// Signatures stored using SystemContext.DirSigstoreSignaturePattern are returned after those stored at the default paths.
 func (s *dirImageSource) GetSignaturesWithFormat(ctx context.Context, instanceDigest *digest.Digest) ([]signature.Signature, error) {
+	signatures, err := readSignatures(func(index int) (string, error) {
+		return s.ref.signaturePath(index, instanceDigest)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if s.sigstorePattern != "" {
+		sigstoreSignatures, err := readSignatures(func(index int) (string, error) {
+			return s.ref.sigstoreSignaturePath(s.sigstorePattern, index, instanceDigest)
+		})
+		if err != nil {
+			return nil, err
+		}
+		signatures = append(signatures, sigstoreSignatures...)
+	}
+	return signatures, nil
+}
+
+// readSignatures reads signatures from consecutive paths returned by signaturePath, until a path does not exist.
+func readSignatures(signaturePath func(index int) (string, error)) ([]signature.Signature, error) {
 	signatures := []signature.Signature{}
 	for i := 0; ; i++ {
-		path, err := s.ref.signaturePath(i, instanceDigest)
+		path, err := signaturePath(i)
 		if err != nil {
 			return nil, err
 		}
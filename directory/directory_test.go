@@ -6,9 +6,11 @@ import (
 	"errors"
 	"io"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/signature"
 	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/pkg/blobinfocache/memory"
 	"github.com/containers/image/v5/types"
@@ -199,6 +201,71 @@ func TestGetPutSignatures(t *testing.T) {
 	assert.Equal(t, signatures, sigs)
 }
 
+func TestGetPutSignaturesWithSigstorePattern(t *testing.T) {
+	ref, tmpDir := refToTempDir(t)
+	sys := &types.SystemContext{DirSigstoreSignaturePattern: "sigstore/sig-{index}.json"}
+
+	man := []byte("test-manifest")
+	list := []byte("test-manifest-list")
+	md, err := manifest.Digest(man)
+	require.NoError(t, err)
+	simple := signature.SimpleSigningFromBlob([]byte("\xA3simple signature")) // Start with 0xA3 to be minimally plausible to signature.FromBlob.
+	sigstore1 := signature.SigstoreFromComponents("application/vnd.dev.cosign.simplesigning.v1+json", []byte("payload 1"), map[string]string{"a": "1"})
+	sigstore2 := signature.SigstoreFromComponents("application/vnd.dev.cosign.simplesigning.v1+json", []byte("payload 2"), nil)
+
+	dest, err := ref.NewImageDestination(context.Background(), sys)
+	require.NoError(t, err)
+	defer dest.Close()
+	d, ok := dest.(private.ImageDestination)
+	require.True(t, ok)
+	err = d.PutManifest(context.Background(), man, &md)
+	require.NoError(t, err)
+	err = d.PutManifest(context.Background(), list, nil)
+	require.NoError(t, err)
+	err = d.PutSignaturesWithFormat(context.Background(), []signature.Signature{sigstore1, simple, sigstore2}, nil)
+	require.NoError(t, err)
+	err = d.PutSignaturesWithFormat(context.Background(), []signature.Signature{sigstore2}, &md)
+	require.NoError(t, err)
+	err = d.Commit(context.Background(), nil) // nil unparsedToplevel is invalid, we don’t currently use the value
+	require.NoError(t, err)
+
+	for _, path := range []string{"signature-1", "sigstore/sig-1.json", "sigstore/sig-2.json", "sigstore/" + md.Encoded() + ".sig-1.json"} {
+		_, err := os.Stat(filepath.Join(tmpDir, path))
+		assert.NoError(t, err, path)
+	}
+	for _, path := range []string{"signature-2", "signature-3", md.Encoded() + ".signature-1"} {
+		_, err := os.Stat(filepath.Join(tmpDir, path))
+		assert.ErrorIs(t, err, os.ErrNotExist, path)
+	}
+
+	src, err := ref.NewImageSource(context.Background(), sys)
+	require.NoError(t, err)
+	defer src.Close()
+	s, ok := src.(private.ImageSource)
+	require.True(t, ok)
+	sigs, err := s.GetSignaturesWithFormat(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, []signature.Signature{simple, sigstore1, sigstore2}, sigs)
+	sigs, err = s.GetSignaturesWithFormat(context.Background(), &md)
+	require.NoError(t, err)
+	assert.Equal(t, []signature.Signature{sigstore2}, sigs)
+
+	// Without the pattern, only the signatures at the default paths are found.
+	src2, err := ref.NewImageSource(context.Background(), nil)
+	require.NoError(t, err)
+	defer src2.Close()
+	sigs, err = src2.(private.ImageSource).GetSignaturesWithFormat(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, []signature.Signature{simple}, sigs)
+
+	// Invalid patterns are rejected
+	invalidSys := &types.SystemContext{DirSigstoreSignaturePattern: "../sig-{index}"}
+	_, err = ref.NewImageSource(context.Background(), invalidSys)
+	assert.Error(t, err)
+	_, err = ref.NewImageDestination(context.Background(), invalidSys)
+	assert.Error(t, err)
+}
+
 func TestSourceReference(t *testing.T) {
 	ref, tmpDir := refToTempDir(t)
 
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/containers/image/v5/directory/explicitfilepath"
@@ -95,6 +96,16 @@ func (ref dirReference) StringWithinTransport() string {
 	return ref.path
 }
 
+// NormalizedReference returns an equivalent reference using an absolute path without redundant path elements.
+// Unlike PolicyConfigurationIdentity, symbolic links are not resolved.
+func (ref dirReference) NormalizedReference() (types.ImageReference, error) {
+	path, err := filepath.Abs(ref.path)
+	if err != nil {
+		return nil, err
+	}
+	return NewReference(path)
+}
+
 // DockerReference returns a Docker reference associated with this reference
 // (fully explicit, i.e. !reference.IsNameOnly, but reflecting user intent,
 // not e.g. after redirect or alias processing), or nil if unknown/not applicable.
@@ -146,7 +157,7 @@ func (ref dirReference) NewImage(ctx context.Context, sys *types.SystemContext)
 // NewImageSource returns a types.ImageSource for this reference.
 // The caller must call .Close() on the returned ImageSource.
 func (ref dirReference) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
-	return newImageSource(ref), nil
+	return newImageSource(sys, ref)
 }
 
 // NewImageDestination returns a types.ImageDestination for this reference.
@@ -191,6 +202,38 @@ func (ref dirReference) signaturePath(index int, instanceDigest *digest.Digest)
 	return filepath.Join(ref.path, fmt.Sprintf("signature-%d", index+1)), nil
 }
 
+// sigstoreSignatureIndexPlaceholder is replaced by the 1-based index of a signature in SystemContext.DirSigstoreSignaturePattern.
+const sigstoreSignatureIndexPlaceholder = "{index}"
+
+// validateSigstoreSignaturePattern checks that pattern is a valid SystemContext.DirSigstoreSignaturePattern value.
+func validateSigstoreSignaturePattern(pattern string) error {
+	if strings.Count(pattern, sigstoreSignatureIndexPlaceholder) != 1 {
+		return fmt.Errorf("sigstore signature path pattern %q must contain %q exactly once", pattern, sigstoreSignatureIndexPlaceholder)
+	}
+	example := filepath.FromSlash(strings.Replace(pattern, sigstoreSignatureIndexPlaceholder, "1", 1))
+	if !filepath.IsLocal(example) || filepath.Clean(example) != example {
+		return fmt.Errorf("sigstore signature path pattern %q must be a clean relative path within the image directory", pattern)
+	}
+	if example == "signature-1" {
+		return fmt.Errorf("sigstore signature path pattern %q conflicts with the default signature paths", pattern)
+	}
+	return nil
+}
+
+// sigstoreSignaturePath returns a path for a sigstore signature within a directory using pattern, which must have been validated
+// by validateSigstoreSignaturePattern.
+func (ref dirReference) sigstoreSignaturePath(pattern string, index int, instanceDigest *digest.Digest) (string, error) {
+	path := filepath.FromSlash(strings.Replace(pattern, sigstoreSignatureIndexPlaceholder, strconv.Itoa(index+1), 1))
+	if instanceDigest != nil {
+		if err := instanceDigest.Validate(); err != nil { // digest.Digest.Encoded() panics on failure, and could possibly result in a path with ../, so validate explicitly.
+			return "", err
+		}
+		dir, file := filepath.Split(path)
+		path = filepath.Join(dir, instanceDigest.Encoded()+"."+file)
+	}
+	return filepath.Join(ref.path, path), nil
+}
+
 // versionPath returns a path for the version file within a directory using our conventions.
 func (ref dirReference) versionPath() string {
 	return filepath.Join(ref.path, "version")
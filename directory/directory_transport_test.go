@@ -244,6 +244,57 @@ func TestReferenceSignaturePath(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestValidateSigstoreSignaturePattern(t *testing.T) {
+	for _, pattern := range []string{
+		"sig-{index}",
+		"{index}.sig",
+		"sigstore/signature-{index}.json",
+		"a/b/{index}/sig",
+	} {
+		err := validateSigstoreSignaturePattern(pattern)
+		assert.NoError(t, err, pattern)
+	}
+	for _, pattern := range []string{
+		"",
+		"sig",                      // No placeholder
+		"sig-{index}-{index}",      // Placeholder used twice
+		"/tmp/sig-{index}",         // Absolute
+		"../sig-{index}",           // Outside of the directory
+		"sigstore/../sig-{index}",  // Not clean
+		"sigstore//sig-{index}",    // Not clean
+		"./sig-{index}",            // Not clean
+		"signature-{index}",        // Conflicts with the default paths
+		"sig-{INDEX}",              // Wrong placeholder
+		"sigstore/{index}/../../x", // Outside of the directory
+	} {
+		err := validateSigstoreSignaturePattern(pattern)
+		assert.Error(t, err, pattern)
+	}
+}
+
+func TestReferenceSigstoreSignaturePath(t *testing.T) {
+	dhex := digest.Digest("sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")
+
+	ref, tmpDir := refToTempDir(t)
+	dirRef, ok := ref.(dirReference)
+	require.True(t, ok)
+	res, err := dirRef.sigstoreSignaturePath("sigstore/sig-{index}.json", 0, nil)
+	require.NoError(t, err)
+	assert.Equal(t, tmpDir+"/sigstore/sig-1.json", res)
+	res, err = dirRef.sigstoreSignaturePath("sigstore/sig-{index}.json", 9, nil)
+	require.NoError(t, err)
+	assert.Equal(t, tmpDir+"/sigstore/sig-10.json", res)
+	res, err = dirRef.sigstoreSignaturePath("sigstore/sig-{index}.json", 0, &dhex)
+	require.NoError(t, err)
+	assert.Equal(t, tmpDir+"/sigstore/"+dhex.Encoded()+".sig-1.json", res)
+	res, err = dirRef.sigstoreSignaturePath("{index}.sig", 1, &dhex)
+	require.NoError(t, err)
+	assert.Equal(t, tmpDir+"/"+dhex.Encoded()+".2.sig", res)
+	invalidDigest := digest.Digest("sha256:../hello")
+	_, err = dirRef.sigstoreSignaturePath("sig-{index}", 0, &invalidDigest)
+	assert.Error(t, err)
+}
+
 func TestReferenceVersionPath(t *testing.T) {
 	ref, tmpDir := refToTempDir(t)
 	dirRef, ok := ref.(dirReference)
@@ -0,0 +1,171 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/docker/internal/tarfile"
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/blobinfocache"
+	"github.com/containers/image/v5/internal/imagedestination"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/blobinfocache/memory"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testArchiveImage is an image written by TestWriterMultipleImages.
+type testArchiveImage struct {
+	tag      string
+	layers   [][]byte
+	config   []byte
+	manifest []byte
+}
+
+func newTestArchiveImage(t *testing.T, tag string, layers ...[]byte) testArchiveImage {
+	diffIDs := []digest.Digest{}
+	layerDescriptors := []manifest.Schema2Descriptor{}
+	for _, l := range layers {
+		diffIDs = append(diffIDs, digest.FromBytes(l))
+		layerDescriptors = append(layerDescriptors, manifest.Schema2Descriptor{
+			MediaType: manifest.DockerV2Schema2LayerMediaType,
+			Size:      int64(len(l)),
+			Digest:    digest.FromBytes(l),
+		})
+	}
+	config, err := json.Marshal(manifest.Schema2Image{
+		Schema2V1Image: manifest.Schema2V1Image{
+			Comment:      tag, // Make sure every image has a different config
+			Architecture: "amd64",
+			OS:           "linux",
+		},
+		RootFS: &manifest.Schema2RootFS{Type: "layers", DiffIDs: diffIDs},
+	})
+	require.NoError(t, err)
+	man, err := manifest.Schema2FromComponents(manifest.Schema2Descriptor{
+		MediaType: manifest.DockerV2Schema2ConfigMediaType,
+		Size:      int64(len(config)),
+		Digest:    digest.FromBytes(config),
+	}, layerDescriptors).Serialize()
+	require.NoError(t, err)
+	return testArchiveImage{tag: tag, layers: layers, config: config, manifest: man}
+}
+
+func TestWriterMultipleImages(t *testing.T) {
+	ctx := context.Background()
+	sharedLayer := []byte("shared layer")
+	images := []testArchiveImage{
+		newTestArchiveImage(t, "example.com/first:latest", sharedLayer, []byte("first layer")),
+		newTestArchiveImage(t, "example.com/second:v1", sharedLayer, []byte("second layer")),
+	}
+
+	path := filepath.Join(t.TempDir(), "archive.tar")
+	writer, err := NewWriter(nil, path)
+	require.NoError(t, err)
+	cache := memory.New()
+	for _, image := range images {
+		named, err := reference.ParseNormalizedNamed(image.tag)
+		require.NoError(t, err)
+		ref, err := writer.NewReference(named.(reference.NamedTagged))
+		require.NoError(t, err)
+		publicDest, err := ref.NewImageDestination(ctx, nil)
+		require.NoError(t, err)
+		dest := imagedestination.FromPublic(publicDest)
+		for _, l := range image.layers {
+			_, err := dest.PutBlobWithOptions(ctx, bytes.NewReader(l), types.BlobInfo{Digest: digest.FromBytes(l), Size: int64(len(l))},
+				private.PutBlobOptions{Cache: blobinfocache.FromBlobInfoCache(cache)})
+			require.NoError(t, err)
+		}
+		_, err = dest.PutBlobWithOptions(ctx, bytes.NewReader(image.config), types.BlobInfo{Digest: digest.FromBytes(image.config), Size: int64(len(image.config))},
+			private.PutBlobOptions{Cache: blobinfocache.FromBlobInfoCache(cache), IsConfig: true})
+		require.NoError(t, err)
+		err = dest.PutManifest(ctx, image.manifest, nil)
+		require.NoError(t, err)
+		err = dest.CommitWithOptions(ctx, private.CommitOptions{})
+		require.NoError(t, err)
+		err = dest.Close()
+		require.NoError(t, err)
+	}
+	err = writer.Close()
+	require.NoError(t, err)
+
+	// The shared layer is only stored once, and the metadata refers to both images.
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	tr := tar.NewReader(f)
+	fileNames := map[string]int{}
+	var repositories map[string]map[string]string
+	var tarManifest []tarfile.ManifestItem
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		fileNames[h.Name]++
+		switch h.Name {
+		case "repositories":
+			err := json.NewDecoder(tr).Decode(&repositories)
+			require.NoError(t, err)
+		case "manifest.json":
+			err := json.NewDecoder(tr).Decode(&tarManifest)
+			require.NoError(t, err)
+		}
+	}
+	assert.Equal(t, 1, fileNames[digest.FromBytes(sharedLayer).Encoded()+".tar"])
+	assert.Len(t, repositories, 2)
+	assert.Contains(t, repositories["example.com/first"], "latest")
+	assert.Contains(t, repositories["example.com/second"], "v1")
+	require.Len(t, tarManifest, 2)
+	assert.Equal(t, []string{"example.com/first:latest"}, tarManifest[0].RepoTags)
+	assert.Equal(t, []string{"example.com/second:v1"}, tarManifest[1].RepoTags)
+	assert.Equal(t, tarManifest[0].Layers[0], tarManifest[1].Layers[0])
+
+	// Both images can be read back using the same transport.
+	reader, err := NewReader(nil, path)
+	require.NoError(t, err)
+	defer reader.Close()
+	refs, err := reader.List()
+	require.NoError(t, err)
+	require.Len(t, refs, len(images))
+	for i, image := range images {
+		require.Len(t, refs[i], 1)
+		require.NotNil(t, refs[i][0].DockerReference())
+		assert.Equal(t, image.tag, refs[i][0].DockerReference().String())
+
+		src, err := refs[i][0].NewImageSource(ctx, nil)
+		require.NoError(t, err)
+		defer src.Close()
+		manifestBlob, _, err := src.GetManifest(ctx, nil)
+		require.NoError(t, err)
+		man, err := manifest.Schema2FromManifest(manifestBlob)
+		require.NoError(t, err)
+		configStream, _, err := src.GetBlob(ctx, man.ConfigInfo(), cache)
+		require.NoError(t, err)
+		config, err := io.ReadAll(configStream)
+		configStream.Close()
+		require.NoError(t, err)
+		assert.Equal(t, image.config, config)
+		layerInfos := man.LayerInfos()
+		require.Len(t, layerInfos, len(image.layers))
+		for j, l := range image.layers {
+			layerStream, _, err := src.GetBlob(ctx, layerInfos[j].BlobInfo, cache)
+			require.NoError(t, err)
+			contents, err := io.ReadAll(layerStream)
+			layerStream.Close()
+			require.NoError(t, err)
+			assert.Equal(t, l, contents)
+		}
+	}
+}
@@ -1,12 +1,22 @@
 package docker
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"fmt"
+	"io"
 	"math"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -194,3 +204,85 @@ func TestBodyReaderErrorIfNotReconnecting(t *testing.T) {
 		}
 	}
 }
+
+func TestBodyReaderResume(t *testing.T) {
+	// Silence logrus.Info logs in the tested code
+	prevLevel := logrus.StandardLogger().Level
+	logrus.StandardLogger().SetLevel(logrus.WarnLevel)
+	t.Cleanup(func() {
+		logrus.StandardLogger().SetLevel(prevLevel)
+	})
+
+	blob := bytes.Repeat([]byte("0123456789abcdef"), 64*1024)
+	blobDigest := digest.FromBytes(blob)
+	const cutoff = 100_000
+
+	for _, honorRange := range []bool{true, false} {
+		var rangeHeaders []string
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/v2/":
+				w.WriteHeader(http.StatusOK)
+			case "/v2/repo/blobs/" + blobDigest.String():
+				rangeHeader := r.Header.Get("Range")
+				rangeHeaders = append(rangeHeaders, rangeHeader)
+				if rangeHeader == "" {
+					// Send a part of the blob, then abort the connection.
+					w.Header().Set("Content-Length", fmt.Sprintf("%d", len(blob)))
+					w.WriteHeader(http.StatusOK)
+					_, err := w.Write(blob[:cutoff])
+					assert.NoError(t, err)
+					w.(http.Flusher).Flush()
+					conn, _, err := w.(http.Hijacker).Hijack()
+					if !assert.NoError(t, err) {
+						return
+					}
+					conn.Close()
+					return
+				}
+				if !honorRange {
+					w.WriteHeader(http.StatusOK)
+					_, err := w.Write(blob)
+					assert.NoError(t, err)
+					return
+				}
+				var start int
+				_, err := fmt.Sscanf(rangeHeader, "bytes=%d-", &start)
+				if !assert.NoError(t, err) {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(blob)-1, len(blob)))
+				w.Header().Set("Content-Length", fmt.Sprintf("%d", len(blob)-start))
+				w.WriteHeader(http.StatusPartialContent)
+				_, err = w.Write(blob[start:])
+				assert.NoError(t, err)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		registry := strings.TrimPrefix(s.URL, "http://")
+		named, err := reference.ParseNormalizedNamed(registry + "/repo:latest")
+		require.NoError(t, err)
+		ref, err := newReference(named, false)
+		require.NoError(t, err)
+		client, err := newDockerClient(&types.SystemContext{DockerInsecureSkipTLSVerify: types.OptionalBoolTrue}, registry, registry)
+		require.NoError(t, err)
+
+		reader, size, err := client.getBlob(context.Background(), ref, types.BlobInfo{Digest: blobDigest, Size: -1}, none.NoCache)
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(blob)), size)
+		data, err := io.ReadAll(reader)
+		reader.Close()
+		if honorRange {
+			require.NoError(t, err)
+			assert.Equal(t, blobDigest, digest.FromBytes(data))
+			assert.Equal(t, []string{"", fmt.Sprintf("bytes=%d-", cutoff)}, rangeHeaders)
+		} else {
+			assert.ErrorContains(t, err, "server did not process a Range: header")
+			assert.Equal(t, blob[:cutoff], data)
+		}
+		client.Close()
+		s.Close()
+	}
+}
@@ -0,0 +1,209 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/containers/image/v5/internal/tmpdir"
+	"github.com/containers/image/v5/types"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultUploadChunkSize is the chunk size used when falling back to chunked uploads, if SystemContext.DockerUploadChunkSize is not set.
+	defaultUploadChunkSize = int64(8 * 1024 * 1024)
+	// maxUploadChunkAttempts is the maximum number of attempts to upload a single chunk, resuming the upload session after failures.
+	maxUploadChunkAttempts = 3
+)
+
+// uploadRequiresChunks returns true if status, returned for a blob upload in a single request, suggests that
+// the registry only accepts chunked uploads.
+func uploadRequiresChunks(status int) bool {
+	switch status {
+	case http.StatusLengthRequired, http.StatusRequestEntityTooLarge, http.StatusRequestedRangeNotSatisfiable:
+		return true
+	default:
+		return false
+	}
+}
+
+// spooledReader copies the data read from source to a temporary file, so that it can be read again if an upload fails.
+type spooledReader struct {
+	source io.Reader
+	file   *os.File
+}
+
+// newSpooledReader returns a spooledReader for source, using a temporary file as configured in sys.
+// The caller must call close() on the returned spooledReader.
+func newSpooledReader(sys *types.SystemContext, source io.Reader) (*spooledReader, error) {
+	file, err := tmpdir.CreateBigFileTemp(sys, "docker-upload-blob")
+	if err != nil {
+		return nil, fmt.Errorf("creating temporary on-disk layer: %w", err)
+	}
+	return &spooledReader{source: source, file: file}, nil
+}
+
+func (r *spooledReader) Read(p []byte) (int, error) {
+	n, err := r.source.Read(p)
+	if n > 0 {
+		if _, writeErr := r.file.Write(p[:n]); writeErr != nil {
+			return n, fmt.Errorf("writing to temporary on-disk layer: %w", writeErr)
+		}
+	}
+	return n, err
+}
+
+// replay returns a reader which returns all data of source, starting from the beginning.
+// The caller must ensure nothing else reads from r afterwards.
+func (r *spooledReader) replay() (io.Reader, error) {
+	if _, err := r.file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("rewinding temporary on-disk layer: %w", err)
+	}
+	return io.MultiReader(r.file, r.source), nil
+}
+
+// close closes and removes the temporary file.
+func (r *spooledReader) close() {
+	r.file.Close()
+	os.Remove(r.file.Name())
+}
+
+// uploadChunkSize returns the chunk size to use for blob uploads, or 0 if blobs should be uploaded in a single request.
+func (d *dockerImageDestination) uploadChunkSize() int64 {
+	if d.c.sys != nil && d.c.sys.DockerUploadChunkSize > 0 {
+		return d.c.sys.DockerUploadChunkSize
+	}
+	if d.chunkedUploadsRequired.Load() {
+		return defaultUploadChunkSize
+	}
+	return 0
+}
+
+// uploadBlobChunked uploads stream to the upload session at uploadLocation in chunks of chunkSize,
+// and returns the location to use for the next request in the upload session.
+func (d *dockerImageDestination) uploadBlobChunked(ctx context.Context, uploadLocation *url.URL, stream io.Reader, chunkSize int64) (*url.URL, error) {
+	buf := make([]byte, chunkSize)
+	offset := int64(0)
+	for {
+		n, err := io.ReadFull(stream, buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return nil, err
+		}
+		uploadLocation, err = d.uploadChunk(ctx, uploadLocation, buf[:n], offset)
+		if err != nil {
+			return nil, err
+		}
+		offset += int64(n)
+		if n < len(buf) {
+			break
+		}
+	}
+	return uploadLocation, nil
+}
+
+// uploadChunk uploads chunk, starting at offset of the blob, to the upload session at uploadLocation,
+// and returns the location to use for the next request in the upload session.
+// If uploading the chunk fails, the upload session is resumed from the data the registry has received.
+func (d *dockerImageDestination) uploadChunk(ctx context.Context, uploadLocation *url.URL, chunk []byte, offset int64) (*url.URL, error) {
+	sent := int64(0) // Number of bytes of chunk known to be stored by the registry
+	for attempt := 1; ; attempt++ {
+		nextLocation, err := d.patchChunk(ctx, uploadLocation, chunk[sent:], offset+sent)
+		if err == nil {
+			return nextLocation, nil
+		}
+		if attempt == maxUploadChunkAttempts || ctx.Err() != nil {
+			return nil, err
+		}
+		logrus.Debugf("Uploading chunk at offset %d failed, trying to resume: %v", offset+sent, err)
+		statusLocation, stored, statusErr := d.uploadStatus(ctx, uploadLocation)
+		if statusErr != nil {
+			logrus.Debugf("Error querying upload status: %v", statusErr)
+			return nil, err
+		}
+		if stored < offset || stored > offset+int64(len(chunk)) {
+			return nil, fmt.Errorf("resuming blob upload: registry has received %d bytes, expected between %d and %d", stored, offset, offset+int64(len(chunk)))
+		}
+		sent = stored - offset
+		uploadLocation = statusLocation
+		if sent == int64(len(chunk)) {
+			return uploadLocation, nil
+		}
+	}
+}
+
+// patchChunk sends a single PATCH request with chunk, starting at offset of the blob, to the upload session at uploadLocation,
+// and returns the location to use for the next request in the upload session.
+func (d *dockerImageDestination) patchChunk(ctx context.Context, uploadLocation *url.URL, chunk []byte, offset int64) (*url.URL, error) {
+	headers := map[string][]string{
+		"Content-Type":  {"application/octet-stream"},
+		"Content-Range": {fmt.Sprintf("%d-%d", offset, offset+int64(len(chunk))-1)},
+	}
+	res, err := d.c.makeRequestToResolvedURL(ctx, http.MethodPatch, uploadLocation, headers, bytes.NewReader(chunk), int64(len(chunk)), v2Auth, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if !successStatus(res.StatusCode) {
+		return nil, fmt.Errorf("uploading layer chunk: %w", registryHTTPResponseToError(res))
+	}
+	nextLocation, err := res.Location()
+	if err != nil {
+		return nil, fmt.Errorf("determining upload URL: %w", err)
+	}
+	return nextLocation, nil
+}
+
+// uploadStatus queries the upload session at uploadLocation, and returns the location to use for the next request
+// in the upload session, and the number of bytes the registry has received.
+func (d *dockerImageDestination) uploadStatus(ctx context.Context, uploadLocation *url.URL) (*url.URL, int64, error) {
+	res, err := d.c.makeRequestToResolvedURL(ctx, http.MethodGet, uploadLocation, nil, nil, -1, v2Auth, nil)
+	if err != nil {
+		return nil, -1, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		return nil, -1, registryHTTPResponseToError(res)
+	}
+	nextLocation := uploadLocation
+	if res.Header.Get("Location") != "" {
+		nextLocation, err = res.Location()
+		if err != nil {
+			return nil, -1, fmt.Errorf("determining upload URL: %w", err)
+		}
+	}
+	stored, err := parseUploadRange(res.Header.Get("Range"))
+	if err != nil {
+		return nil, -1, err
+	}
+	return nextLocation, stored, nil
+}
+
+// parseUploadRange parses the Range header of an upload status response, and returns the number of bytes received by the registry.
+func parseUploadRange(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	// docker/distribution historically used "0-N" without a unit, be liberal in what we accept.
+	start, end, ok := strings.Cut(strings.TrimPrefix(value, "bytes="), "-")
+	if !ok || start != "0" {
+		return -1, fmt.Errorf("invalid upload Range header %q", value)
+	}
+	last, err := strconv.ParseInt(end, 10, 64)
+	if err != nil || last < 0 {
+		return -1, fmt.Errorf("invalid upload Range header %q", value)
+	}
+	if last == 0 { // docker/distribution returns "0-0" for an empty upload; assume that is the case rather than a single received byte.
+		return 0, nil
+	}
+	return last + 1, nil
+}
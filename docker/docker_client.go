@@ -11,13 +11,16 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/externalblob"
 	"github.com/containers/image/v5/internal/iolimits"
+	internalManifest "github.com/containers/image/v5/internal/manifest"
 	"github.com/containers/image/v5/internal/multierr"
 	"github.com/containers/image/v5/internal/set"
 	"github.com/containers/image/v5/internal/useragent"
@@ -41,11 +44,13 @@ const (
 	dockerV1Hostname = "index.docker.io"
 	dockerRegistry   = "registry-1.docker.io"
 
-	resolvedPingV2URL       = "%s://%s/v2/"
+	resolvedPingV2URL       = "%s://%s%s/v2/"
 	tagsPath                = "/v2/%s/tags/list"
+	catalogPath             = "/v2/_catalog"
 	manifestPath            = "/v2/%s/manifests/%s"
 	blobsPath               = "/v2/%s/blobs/%s"
 	blobUploadPath          = "/v2/%s/blobs/uploads/"
+	referrersPath           = "/v2/%s/referrers/%s"
 	extensionsSignaturePath = "/extensions/v2/%s/signatures/%s"
 
 	minimumTokenLifetimeSeconds = 60
@@ -53,6 +58,8 @@ const (
 	extensionSignatureSchemaVersion = 2        // extensionSignature.Version
 	extensionSignatureTypeAtomic    = "atomic" // extensionSignature.Type
 
+	defaultMaxRedirects = 10 // The same as the net/http default
+
 	backoffNumIterations = 5
 	backoffInitialDelay  = 2 * time.Second
 	backoffMaxDelay      = 60 * time.Second
@@ -94,13 +101,23 @@ type bearerToken struct {
 // dockerClient is configuration for dealing with a single container registry.
 type dockerClient struct {
 	// The following members are set by newDockerClient and do not change afterwards.
-	sys       *types.SystemContext
-	registry  string
-	userAgent string
+	sys                 *types.SystemContext
+	registry            string
+	userAgent           string
+	manifestAcceptTypes []string // The MIME types to request when reading manifests, in order of preference
 
 	// tlsClientConfig is setup by newDockerClient and will be used and updated
 	// by detectProperties(). Callers can edit tlsClientConfig.InsecureSkipVerify in the meantime.
 	tlsClientConfig *tls.Config
+	// registryHeaders are additional HTTP headers to send to the registry, as configured in registries.conf.
+	// They are set up by newDockerClient; callers can replace them in the meantime.
+	registryHeaders map[string]string
+	// pathPrefix is prepended to the paths of all requests to the registry, as configured in registries.conf; it is either empty or starts with a "/".
+	// It is set up by newDockerClient; callers can replace it in the meantime.
+	pathPrefix string
+	// proxy, if not nil, is used as http.Transport.Proxy instead of the proxy configured in the environment, as configured in registries.conf.
+	// It is set up by newDockerClient; callers can replace it in the meantime.
+	proxy func(*http.Request) (*url.URL, error)
 	// The following members are not set by newDockerClient and must be set by callers if needed.
 	auth                   types.DockerAuthConfig
 	registryToken          string
@@ -117,6 +134,10 @@ type dockerClient struct {
 
 	// Private state for setupRequestAuth (key: string, value: bearerToken)
 	tokenCache sync.Map
+	// Private state for anonymous token acquisition: a bearer challenge returned by a request
+	// when the /v2/ ping did not ask for authentication (i.e. challenges is empty).
+	anonymousChallengeLock sync.Mutex
+	anonymousChallenge     *challenge
 	// Private state for detectProperties:
 	detectPropertiesOnce  sync.Once // detectPropertiesOnce is used to execute detectProperties() at most once.
 	detectPropertiesError error     // detectPropertiesError caches the initial error.
@@ -246,15 +267,24 @@ func newDockerClient(sys *types.SystemContext, registry, reference string) (*doc
 	// Check if TLS verification shall be skipped (default=false) which can
 	// be specified in the sysregistriesv2 configuration.
 	skipVerify := false
+	var registryHeaders map[string]string
+	pathPrefix := ""
+	var proxy func(*http.Request) (*url.URL, error)
 	reg, err := sysregistriesv2.FindRegistry(sys, reference)
 	if err != nil {
 		return nil, fmt.Errorf("loading registries: %w", err)
 	}
 	if reg != nil {
 		if reg.Blocked {
-			return nil, fmt.Errorf("registry %s is blocked in %s or %s", reg.Prefix, sysregistriesv2.ConfigPath(sys), sysregistriesv2.ConfigDirPath(sys))
+			return nil, fmt.Errorf("registry %s is blocked in %s", reg.Prefix, sysregistriesv2.ConfigurationSourceDescription(sys))
 		}
 		skipVerify = reg.Insecure
+		registryHeaders = reg.Headers
+		pathPrefix = reg.PathPrefix
+		proxy, err = reg.ProxyFunc()
+		if err != nil {
+			return nil, err
+		}
 	}
 	tlsClientConfig.InsecureSkipVerify = skipVerify
 
@@ -263,15 +293,52 @@ func newDockerClient(sys *types.SystemContext, registry, reference string) (*doc
 		userAgent = sys.DockerRegistryUserAgent
 	}
 
+	manifestAcceptTypes, err := manifestAcceptTypesForSystemContext(sys)
+	if err != nil {
+		return nil, err
+	}
+
 	return &dockerClient{
-		sys:              sys,
-		registry:         registry,
-		userAgent:        userAgent,
-		tlsClientConfig:  tlsClientConfig,
-		reportedWarnings: set.New[string](),
+		sys:                 sys,
+		registry:            registry,
+		userAgent:           userAgent,
+		manifestAcceptTypes: manifestAcceptTypes,
+		tlsClientConfig:     tlsClientConfig,
+		registryHeaders:     registryHeaders,
+		pathPrefix:          pathPrefix,
+		proxy:               proxy,
+		reportedWarnings:    set.New[string](),
 	}, nil
 }
 
+// manifestAcceptTypesForSystemContext returns the manifest MIME types to request, in order of preference:
+// the ones listed in sys.ManifestMIMETypeAcceptOrder, if any, followed by the remaining default ones.
+// If sys.DisableSchema1, schema1 MIME types are not requested at all.
+func manifestAcceptTypesForSystemContext(sys *types.SystemContext) ([]string, error) {
+	if sys == nil || (len(sys.ManifestMIMETypeAcceptOrder) == 0 && !sys.DisableSchema1) {
+		return manifest.DefaultRequestedManifestMIMETypes, nil
+	}
+	res := make([]string, 0, len(manifest.DefaultRequestedManifestMIMETypes))
+	for _, mimeType := range sys.ManifestMIMETypeAcceptOrder {
+		if !slices.Contains(manifest.DefaultRequestedManifestMIMETypes, mimeType) {
+			return nil, fmt.Errorf("unsupported manifest MIME type %q in ManifestMIMETypeAcceptOrder", mimeType)
+		}
+		if slices.Contains(res, mimeType) {
+			return nil, fmt.Errorf("manifest MIME type %q is listed more than once in ManifestMIMETypeAcceptOrder", mimeType)
+		}
+		if sys.DisableSchema1 && internalManifest.MIMETypeIsSchema1(mimeType) {
+			return nil, fmt.Errorf("manifest MIME type %q is listed in ManifestMIMETypeAcceptOrder, but schema1 is disabled by DisableSchema1", mimeType)
+		}
+		res = append(res, mimeType)
+	}
+	for _, mimeType := range manifest.DefaultRequestedManifestMIMETypes {
+		if !slices.Contains(res, mimeType) && !(sys.DisableSchema1 && internalManifest.MIMETypeIsSchema1(mimeType)) {
+			res = append(res, mimeType)
+		}
+	}
+	return res, nil
+}
+
 // CheckAuth validates the credentials by attempting to log into the registry
 // returns an error if an error occurred while making the http request or the status code received was 401
 func CheckAuth(ctx context.Context, sys *types.SystemContext, username, password, registry string) error {
@@ -391,9 +458,15 @@ func SearchRegistry(ctx context.Context, sys *types.SystemContext, registry, ima
 
 	logrus.Debugf("trying to talk to v2 search endpoint")
 	searchRes := []SearchResult{}
-	path := "/v2/_catalog"
+	if err := client.detectProperties(ctx); err != nil {
+		return nil, fmt.Errorf("couldn't search registry %q: %w", registry, err)
+	}
+	pageURL, err := client.resolveRequestURL(catalogPath)
+	if err != nil {
+		return nil, err
+	}
 	for len(searchRes) < limit {
-		resp, err := client.makeRequest(ctx, http.MethodGet, path, nil, nil, v2Auth, nil)
+		resp, err := client.makeRequestToResolvedURL(ctx, http.MethodGet, pageURL, nil, nil, -1, v2Auth, nil)
 		if err != nil {
 			logrus.Debugf("error getting search results from v2 endpoint %q: %v", registry, err)
 			return nil, fmt.Errorf("couldn't search registry %q: %w", registry, err)
@@ -428,29 +501,20 @@ func SearchRegistry(ctx context.Context, sys *types.SystemContext, registry, ima
 			}
 		}
 
-		link := resp.Header.Get("Link")
-		if link == "" {
-			break
-		}
-		linkURLPart, _, _ := strings.Cut(link, ";")
-		linkURL, err := url.Parse(strings.Trim(linkURLPart, "<>"))
+		nextURL, err := nextPageURL(resp)
 		if err != nil {
 			return searchRes, err
 		}
-
-		// can be relative or absolute, but we only want the path (and I
-		// guess we're in trouble if it forwards to a new place...)
-		path = linkURL.Path
-		if linkURL.RawQuery != "" {
-			path += "?"
-			path += linkURL.RawQuery
+		if nextURL == nil {
+			break
 		}
+		pageURL = nextURL
 	}
 	return searchRes, nil
 }
 
 // makeRequest creates and executes a http.Request with the specified parameters, adding authentication and TLS options for the Docker client.
-// The host name and schema is taken from the client or autodetected, and the path is relative to it, i.e. the path usually starts with /v2/.
+// The host name and schema is taken from the client or autodetected, and the path is relative to it (after c.pathPrefix), i.e. the path usually starts with /v2/.
 func (c *dockerClient) makeRequest(ctx context.Context, method, path string, headers map[string][]string, stream io.Reader, auth sendAuth, extraScope *authScope) (*http.Response, error) {
 	if err := c.detectProperties(ctx); err != nil {
 		return nil, err
@@ -466,7 +530,7 @@ func (c *dockerClient) makeRequest(ctx context.Context, method, path string, hea
 // resolveRequestURL turns a path for c.makeRequest into a full URL.
 // Most users should call makeRequest directly, this exists basically to make the URL available for debug logs.
 func (c *dockerClient) resolveRequestURL(path string) (*url.URL, error) {
-	urlString := fmt.Sprintf("%s://%s%s", c.scheme, c.registry, path)
+	urlString := fmt.Sprintf("%s://%s%s%s", c.scheme, c.registry, c.pathPrefix, path)
 	res, err := url.Parse(urlString)
 	if err != nil {
 		return nil, err
@@ -558,6 +622,7 @@ func (c *dockerClient) makeRequestToResolvedURL(ctx context.Context, method stri
 			if retry, newScope := needsRetryWithUpdatedScope(res); retry {
 				logrus.Debug("Detected insufficient_scope error, will retry request with updated scope")
 				res.Body.Close()
+				c.metrics().RequestRetried(c.registry)
 				// Note: This retry ignores extraScope. That’s, strictly speaking, incorrect, but we don’t currently
 				// expect the insufficient_scope errors to happen for those callers. If that changes, we can add support
 				// for more than one extra scope.
@@ -569,6 +634,27 @@ func (c *dockerClient) makeRequestToResolvedURL(ctx context.Context, method stri
 			}
 		}
 
+		// Some registries don’t ask for authentication on the /v2/ ping, but require
+		// a bearer token (possibly an anonymous one) for the actual request.
+		// If we have no credentials, try obtaining an anonymous token for the
+		// required scope, and retry with it.
+		//
+		// Same as above, we only try this on the first attempt, and not with a body.
+		if attempts == 1 && stream == nil && auth != noAuth {
+			if challenge := c.anonymousBearerChallenge(res); challenge != nil {
+				logrus.Debug("Detected a bearer challenge in a request without credentials, will retry request with an anonymous token")
+				res.Body.Close()
+				c.anonymousChallengeLock.Lock()
+				c.anonymousChallenge = challenge
+				c.anonymousChallengeLock.Unlock()
+				c.metrics().RequestRetried(c.registry)
+				res, err = c.makeRequestToResolvedURLOnce(ctx, method, requestURL, headers, stream, streamLen, auth, extraScope)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+
 		if res.StatusCode != http.StatusTooManyRequests || // Only retry on StatusTooManyRequests, success or other failure is returned to caller immediately
 			stream != nil || // We can't retry with a body (which is not restartable in the general case)
 			attempts == backoffNumIterations {
@@ -586,6 +672,7 @@ func (c *dockerClient) makeRequestToResolvedURL(ctx context.Context, method stri
 			// Nothing
 		}
 		delay *= 2 // If the registry does not specify a delay, back off exponentially.
+		c.metrics().RequestRetried(c.registry)
 	}
 }
 
@@ -607,17 +694,31 @@ func (c *dockerClient) makeRequestToResolvedURLOnce(ctx context.Context, method
 			req.Header.Add(n, hh)
 		}
 	}
-	req.Header.Add("User-Agent", c.userAgent)
+	req.Header.Set("User-Agent", c.userAgent)
+	// Only send the configured headers to the registry itself, not e.g. to URLs of foreign layers.
+	if resolvedURL.Host == c.registry {
+		for n, h := range c.registryHeaders {
+			req.Header.Set(n, h)
+		}
+	}
 	if auth == v2Auth {
 		if err := c.setupRequestAuth(req, extraScope); err != nil {
 			return nil, err
 		}
 	}
+	metricsEnabled := c.metricsEnabled()
+	if metricsEnabled && req.Body != nil && req.Body != http.NoBody { // Replacing http.NoBody would make the request chunked
+		req.Body = &countingReadCloser{source: req.Body, report: c.sys.DockerMetrics.BytesUploaded, registry: c.registry}
+	}
 	logrus.Debugf("%s %s", method, resolvedURL.Redacted())
 	res, err := c.client.Do(req)
 	if err != nil {
 		return nil, err
 	}
+	if metricsEnabled {
+		c.sys.DockerMetrics.RequestCompleted(c.registry, method, res.StatusCode)
+		res.Body = &countingReadCloser{source: res.Body, report: c.sys.DockerMetrics.BytesDownloaded, registry: c.registry}
+	}
 	if warnings := res.Header.Values("Warning"); len(warnings) != 0 {
 		c.logResponseWarnings(res, warnings)
 	}
@@ -692,6 +793,31 @@ func parseRegistryWarningHeader(header string) string {
 	return res.String()
 }
 
+// anonymousBearerChallenge returns a bearer challenge from res, if res is a 401 response to a request which
+// was sent without any authentication because the registry did not ask for it on the /v2/ ping,
+// and we have no credentials to use.
+// It returns nil if an anonymous token should not be requested.
+func (c *dockerClient) anonymousBearerChallenge(res *http.Response) *challenge {
+	if res.StatusCode != http.StatusUnauthorized || len(c.challenges) != 0 ||
+		c.auth != (types.DockerAuthConfig{}) || c.registryToken != "" {
+		return nil
+	}
+	c.anonymousChallengeLock.Lock()
+	alreadyUsed := c.anonymousChallenge != nil
+	c.anonymousChallengeLock.Unlock()
+	if alreadyUsed {
+		return nil // We already sent an anonymous token, and it was not accepted.
+	}
+	for _, challenge := range parseAuthHeader(res.Header) {
+		if challenge.Scheme == "bearer" {
+			if realm, ok := challenge.Parameters["realm"]; ok && realm != "" {
+				return &challenge
+			}
+		}
+	}
+	return nil
+}
+
 // we're using the challenges from the /v2/ ping response and not the one from the destination
 // URL in this request because:
 //
@@ -699,12 +825,23 @@ func parseRegistryWarningHeader(header string) string {
 // 2) gcr.io is sending 401 without a WWW-Authenticate header in the real request
 //
 // debugging: https://github.com/containers/image/pull/211#issuecomment-273426236 and follows up
+//
+// The only exception is when the ping did not return any challenges; then we may use an anonymousChallenge
+// from a later response.
 func (c *dockerClient) setupRequestAuth(req *http.Request, extraScope *authScope) error {
-	if len(c.challenges) == 0 {
+	challenges := c.challenges
+	if len(challenges) == 0 {
+		c.anonymousChallengeLock.Lock()
+		if c.anonymousChallenge != nil {
+			challenges = []challenge{*c.anonymousChallenge}
+		}
+		c.anonymousChallengeLock.Unlock()
+	}
+	if len(challenges) == 0 {
 		return nil
 	}
-	schemeNames := make([]string, 0, len(c.challenges))
-	for _, challenge := range c.challenges {
+	schemeNames := make([]string, 0, len(challenges))
+	for _, challenge := range challenges {
 		schemeNames = append(schemeNames, challenge.Scheme)
 		switch challenge.Scheme {
 		case "basic":
@@ -751,6 +888,7 @@ func (c *dockerClient) setupRequestAuth(req *http.Request, extraScope *authScope
 
 					token = *t
 					c.tokenCache.Store(cacheKey, token)
+					c.metrics().TokenRefreshed(c.registry)
 				}
 				registryToken = token.token
 			}
@@ -905,12 +1043,24 @@ func (c *dockerClient) detectPropertiesHelper(ctx context.Context) error {
 	if c.sys != nil && c.sys.DockerInsecureSkipTLSVerify != types.OptionalBoolUndefined {
 		c.tlsClientConfig.InsecureSkipVerify = c.sys.DockerInsecureSkipTLSVerify == types.OptionalBoolTrue
 	}
+	if override := insecureSkipTLSVerifyForRegistry(c.sys, c.registry); override != types.OptionalBoolUndefined {
+		c.tlsClientConfig.InsecureSkipVerify = override == types.OptionalBoolTrue
+	}
 	tr := tlsclientconfig.NewTransport()
 	tr.TLSClientConfig = c.tlsClientConfig
-	c.client = &http.Client{Transport: tr}
+	// With DisableCompression == false, the transport sends “Accept-Encoding: gzip”, and transparently decompresses the responses,
+	// so callers always see the original bytes.
+	tr.DisableCompression = c.sys != nil && c.sys.DockerDisableTransferCompression
+	if c.sys != nil && c.sys.DockerDialContext != nil {
+		tr.DialContext = c.sys.DockerDialContext
+	}
+	if c.proxy != nil {
+		tr.Proxy = c.proxy
+	}
+	c.client = &http.Client{Transport: tr, CheckRedirect: c.checkRedirect}
 
 	ping := func(scheme string) error {
-		pingURL, err := url.Parse(fmt.Sprintf(resolvedPingV2URL, scheme, c.registry))
+		pingURL, err := url.Parse(fmt.Sprintf(resolvedPingV2URL, scheme, c.registry, c.pathPrefix))
 		if err != nil {
 			return err
 		}
@@ -939,6 +1089,59 @@ func (c *dockerClient) detectPropertiesHelper(ctx context.Context) error {
 	return err
 }
 
+// insecureSkipTLSVerifyForRegistry returns the value of sys.DockerInsecureSkipTLSVerifyRegistries for registry,
+// or OptionalBoolUndefined if there is no such override.
+func insecureSkipTLSVerifyForRegistry(sys *types.SystemContext, registry string) types.OptionalBool {
+	if sys == nil {
+		return types.OptionalBoolUndefined
+	}
+	if v, ok := sys.DockerInsecureSkipTLSVerifyRegistries[registry]; ok && v != types.OptionalBoolUndefined {
+		return v
+	}
+	if registry == dockerRegistry { // Users refer to Docker Hub as docker.io
+		if v, ok := sys.DockerInsecureSkipTLSVerifyRegistries[dockerHostname]; ok {
+			return v
+		}
+	}
+	return types.OptionalBoolUndefined
+}
+
+// checkRedirect is the http.Client.CheckRedirect implementation for c.
+// It enforces the maximum number of redirects, and drops the Authorization header
+// when redirected to a different host, so that registry credentials are never sent
+// to a third party (e.g. object storage serving blobs).
+func (c *dockerClient) checkRedirect(req *http.Request, via []*http.Request) error {
+	maxRedirects := defaultMaxRedirects
+	if c.sys != nil && c.sys.DockerMaxRedirects > 0 {
+		maxRedirects = c.sys.DockerMaxRedirects
+	}
+	if len(via) > maxRedirects {
+		return fmt.Errorf("stopped after %d redirects (last redirected from %s to %s)", maxRedirects, via[len(via)-1].URL.Redacted(), req.URL.Redacted())
+	}
+	if req.URL.Host != via[0].URL.Host {
+		if req.Header.Get("Authorization") != "" {
+			logrus.Debugf("Redirected from host %s to %s, not sending the Authorization header", via[0].URL.Host, req.URL.Host)
+		}
+		req.Header.Del("Authorization")
+		// net/http copies the headers of the original request; the configured headers are only meant for the registry.
+		for n := range c.registryHeaders {
+			req.Header.Del(n)
+		}
+	}
+	return nil
+}
+
+// unauthorizedResponseToError returns an error for res, a 401 Unauthorized response to a request by c.
+// The error is an ErrUnauthorizedForCredentials only if c actually had credentials to send;
+// an anonymous request being refused does not mean that any credentials are invalid.
+func (c *dockerClient) unauthorizedResponseToError(res *http.Response) error {
+	err := registryHTTPResponseToError(res)
+	if c.auth.Username != "" || c.auth.Password != "" || c.auth.IdentityToken != "" || c.registryToken != "" {
+		return ErrUnauthorizedForCredentials{Err: err}
+	}
+	return err
+}
+
 // detectProperties detects various properties of the registry.
 // See the dockerClient documentation for members which are affected by this.
 func (c *dockerClient) detectProperties(ctx context.Context) error {
@@ -951,7 +1154,7 @@ func (c *dockerClient) detectProperties(ctx context.Context) error {
 func (c *dockerClient) fetchManifest(ctx context.Context, ref dockerReference, tagOrDigest string) ([]byte, string, error) {
 	path := fmt.Sprintf(manifestPath, reference.Path(ref.ref), tagOrDigest)
 	headers := map[string][]string{
-		"Accept": manifest.DefaultRequestedManifestMIMETypes,
+		"Accept": c.manifestAcceptTypes,
 	}
 	res, err := c.makeRequest(ctx, http.MethodGet, path, headers, nil, v2Auth, nil)
 	if err != nil {
@@ -963,17 +1166,26 @@ func (c *dockerClient) fetchManifest(ctx context.Context, ref dockerReference, t
 		return nil, "", fmt.Errorf("reading manifest %s in %s: %w", tagOrDigest, ref.ref.Name(), registryHTTPResponseToError(res))
 	}
 
-	manblob, err := iolimits.ReadAtMost(res.Body, iolimits.MaxManifestBodySize)
+	mimeType := simplifyContentType(res.Header.Get("Content-Type"))
+	manblob, err := iolimits.ReadAtMost(res.Body, iolimits.ManifestSizeLimit(c.sys))
 	if err != nil {
-		return nil, "", err
+		return nil, "", fmt.Errorf("reading manifest %s in %s: %w", tagOrDigest, ref.ref.Name(), err)
 	}
-	return manblob, simplifyContentType(res.Header.Get("Content-Type")), nil
+	// Registries may return a missing or generic Content-Type for any manifest format, so also look at the contents.
+	if c.sys != nil && c.sys.DisableSchema1 &&
+		(internalManifest.MIMETypeIsSchema1(mimeType) || internalManifest.MIMETypeIsSchema1(internalManifest.GuessMIMEType(manblob))) {
+		return nil, "", fmt.Errorf("reading manifest %s in %s: the registry returned a deprecated Docker schema1 manifest (%q), which is disabled by SystemContext.DisableSchema1",
+			tagOrDigest, ref.ref.Name(), mimeType)
+	}
+	return manblob, mimeType, nil
 }
 
-// getExternalBlob returns the reader of the first available blob URL from urls, which must not be empty.
+// getExternalBlob returns the reader of the first available blob URL from info.URLs, which must not be empty.
 // This function can return nil reader when no url is supported by this function. In this case, the caller
 // should fallback to fetch the non-external blob (i.e. pull from the registry).
-func (c *dockerClient) getExternalBlob(ctx context.Context, urls []string) (io.ReadCloser, int64, error) {
+// Unless c.sys.SkipForeignLayerVerification, the reader fails if the contents do not match info.Digest and info.Size.
+func (c *dockerClient) getExternalBlob(ctx context.Context, info types.BlobInfo) (io.ReadCloser, int64, error) {
+	urls := info.URLs
 	if len(urls) == 0 {
 		return nil, 0, errors.New("internal error: getExternalBlob called with no URLs")
 	}
@@ -998,7 +1210,15 @@ func (c *dockerClient) getExternalBlob(ctx context.Context, urls []string) (io.R
 			resp.Body.Close()
 			continue
 		}
-		return resp.Body, getBlobSize(resp), nil
+		if c.sys != nil && c.sys.SkipForeignLayerVerification {
+			return resp.Body, getBlobSize(resp), nil
+		}
+		reader, err := externalblob.NewVerifyingReader(resp.Body, info)
+		if err != nil {
+			resp.Body.Close()
+			return nil, 0, err
+		}
+		return reader, getBlobSize(resp), nil
 	}
 	if remoteErrors == nil {
 		return nil, 0, nil // fallback to non-external blob
@@ -1019,7 +1239,7 @@ func getBlobSize(resp *http.Response) int64 {
 // May update BlobInfoCache, preferably after it knows for certain that a blob truly exists at a specific location.
 func (c *dockerClient) getBlob(ctx context.Context, ref dockerReference, info types.BlobInfo, cache types.BlobInfoCache) (io.ReadCloser, int64, error) {
 	if len(info.URLs) != 0 {
-		r, s, err := c.getExternalBlob(ctx, info.URLs)
+		r, s, err := c.getExternalBlob(ctx, info)
 		if err != nil {
 			return nil, 0, err
 		} else if r != nil {
@@ -3,19 +3,28 @@ package docker
 import (
 	"bufio"
 	"bytes"
+	"compress/gzip"
 	"context"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/internal/useragent"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
 	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -156,8 +165,8 @@ func TestUserAgent(t *testing.T) {
 
 	var expectedUA string
 	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		got := r.Header.Get("User-Agent")
-		assert.Equal(t, expectedUA, got)
+		// The value is used verbatim, and only once.
+		assert.Equal(t, []string{expectedUA}, r.Header.Values("User-Agent"))
 		w.WriteHeader(http.StatusOK)
 	}))
 	defer s.Close()
@@ -180,9 +189,451 @@ func TestUserAgent(t *testing.T) {
 		if err := CheckAuth(context.Background(), tc.sys, "", "", registry); err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
+
+		// Requests with other headers use the same value.
+		named, err := reference.ParseNormalizedNamed(registry + "/repo:latest")
+		require.NoError(t, err)
+		ref, err := newReference(named, false)
+		require.NoError(t, err)
+		client, err := newDockerClient(tc.sys, registry, registry)
+		require.NoError(t, err)
+		_, _, err = client.fetchManifest(context.Background(), ref, "latest")
+		require.NoError(t, err)
+		err = client.Close()
+		require.NoError(t, err)
 	}
 }
 
+func TestAnonymousTokenAfterUnauthenticatedPing(t *testing.T) {
+	const anonymousToken = "anonymous-token"
+	tokenRequests := 0
+	var serverURL string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/": // The ping does not require authentication.
+			w.WriteHeader(http.StatusOK)
+		case "/token":
+			tokenRequests++
+			_, _, hasBasicAuth := r.BasicAuth()
+			assert.False(t, hasBasicAuth)
+			assert.Equal(t, "", r.URL.Query().Get("account"))
+			assert.Equal(t, "repository:library/busybox:pull", r.URL.Query().Get("scope"))
+			assert.Equal(t, "test-registry", r.URL.Query().Get("service"))
+			_, err := w.Write([]byte(`{"token":"` + anonymousToken + `"}`))
+			assert.NoError(t, err)
+		case "/v2/library/busybox/tags/list":
+			if r.Header.Get("Authorization") != "Bearer "+anonymousToken {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test-registry",scope="repository:library/busybox:pull"`, serverURL))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, err := w.Write([]byte(`{"name":"library/busybox","tags":["latest"]}`))
+			assert.NoError(t, err)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+	serverURL = s.URL
+	registry := strings.TrimPrefix(s.URL, "http://")
+
+	client, err := newDockerClient(&types.SystemContext{DockerInsecureSkipTLSVerify: types.OptionalBoolTrue}, registry, registry)
+	require.NoError(t, err)
+	defer client.Close()
+	client.scope = authScope{resourceType: "repository", remoteName: "library/busybox", actions: "pull"}
+
+	for i := 0; i < 2; i++ {
+		res, err := client.makeRequest(context.Background(), http.MethodGet, "/v2/library/busybox/tags/list", nil, nil, v2Auth, nil)
+		require.NoError(t, err)
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Contains(t, string(body), "latest")
+	}
+	assert.Equal(t, 1, tokenRequests) // The token is cached after the first request.
+
+	// With credentials, we don’t fall back to an anonymous token.
+	tokenRequests = 0
+	client2, err := newDockerClient(&types.SystemContext{DockerInsecureSkipTLSVerify: types.OptionalBoolTrue}, registry, registry)
+	require.NoError(t, err)
+	defer client2.Close()
+	client2.scope = client.scope
+	client2.auth = types.DockerAuthConfig{Username: "user", Password: "pass"}
+	res, err := client2.makeRequest(context.Background(), http.MethodGet, "/v2/library/busybox/tags/list", nil, nil, v2Auth, nil)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	assert.Equal(t, 0, tokenRequests)
+}
+
+func TestRedirects(t *testing.T) {
+	const authHeader = "Bearer registry-token"
+
+	var otherHostAuth []string
+	otherHost := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		otherHostAuth = append(otherHostAuth, r.Header.Get("Authorization"))
+		_, err := w.Write([]byte("blob from other host"))
+		assert.NoError(t, err)
+	}))
+	defer otherHost.Close()
+
+	var sameHostAuth []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case "/same-host":
+			http.Redirect(w, r, "/same-host-target", http.StatusTemporaryRedirect)
+		case "/same-host-target":
+			sameHostAuth = append(sameHostAuth, r.Header.Get("Authorization"))
+			_, err := w.Write([]byte("blob from same host"))
+			assert.NoError(t, err)
+		case "/other-host":
+			http.Redirect(w, r, otherHost.URL+"/blob", http.StatusTemporaryRedirect)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusTemporaryRedirect)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+	registry := strings.TrimPrefix(s.URL, "http://")
+
+	for _, c := range []struct {
+		path, expectedBody string
+		maxRedirects       int
+		expectedError      bool
+	}{
+		{"/same-host", "blob from same host", 0, false},
+		{"/same-host", "blob from same host", 1, false},
+		{"/other-host", "blob from other host", 0, false},
+		{"/loop", "", 0, true},
+		{"/loop", "", 3, true},
+	} {
+		client, err := newDockerClient(&types.SystemContext{
+			DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+			DockerMaxRedirects:          c.maxRedirects,
+		}, registry, registry)
+		require.NoError(t, err)
+		defer client.Close()
+		res, err := client.makeRequest(context.Background(), http.MethodGet, c.path, map[string][]string{"Authorization": {authHeader}}, nil, noAuth, nil)
+		if c.expectedError {
+			assert.ErrorContains(t, err, "redirects", c.path)
+			continue
+		}
+		require.NoError(t, err, c.path)
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		require.NoError(t, err, c.path)
+		assert.Equal(t, c.expectedBody, string(body), c.path)
+	}
+	// The Authorization header is kept on same-host redirects, but dropped on cross-host redirects.
+	assert.Equal(t, []string{authHeader, authHeader}, sameHostAuth)
+	assert.Equal(t, []string{""}, otherHostAuth)
+}
+
+func TestFetchManifestSizeLimit(t *testing.T) {
+	manifestBlob := bytes.Repeat([]byte("x"), 1000)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case "/v2/repo/manifests/latest":
+			w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+			_, err := w.Write(manifestBlob)
+			assert.NoError(t, err)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+	registry := strings.TrimPrefix(s.URL, "http://")
+	named, err := reference.ParseNormalizedNamed(registry + "/repo:latest")
+	require.NoError(t, err)
+	ref, err := newReference(named, false)
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		maxSize       int
+		expectedError bool
+	}{
+		{0, false}, // The default
+		{len(manifestBlob), false},
+		{len(manifestBlob) - 1, true},
+	} {
+		client, err := newDockerClient(&types.SystemContext{
+			DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+			MaxManifestSize:             c.maxSize,
+		}, registry, registry)
+		require.NoError(t, err)
+		defer client.Close()
+		res, _, err := client.fetchManifest(context.Background(), ref, "latest")
+		if c.expectedError {
+			assert.ErrorContains(t, err, "exceeded maximum allowed size", c.maxSize)
+		} else {
+			require.NoError(t, err, c.maxSize)
+			assert.Equal(t, manifestBlob, res, c.maxSize)
+		}
+	}
+}
+
+func TestFetchManifestTransferCompression(t *testing.T) {
+	manifestBlob := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","annotations":{"padding":"` +
+		strings.Repeat("x", 10000) + `"}}`)
+	manifestDigest := digest.FromBytes(manifestBlob)
+	var gzipRequested bool
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case "/v2/repo/manifests/latest":
+			w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+			gzipRequested = strings.Contains(r.Header.Get("Accept-Encoding"), "gzip")
+			if !gzipRequested {
+				_, err := w.Write(manifestBlob)
+				assert.NoError(t, err)
+				return
+			}
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			_, err := gz.Write(manifestBlob)
+			assert.NoError(t, err)
+			err = gz.Close()
+			assert.NoError(t, err)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+	registry := strings.TrimPrefix(s.URL, "http://")
+	named, err := reference.ParseNormalizedNamed(registry + "/repo:latest")
+	require.NoError(t, err)
+	ref, err := newReference(named, false)
+	require.NoError(t, err)
+
+	for _, disabled := range []bool{false, true} {
+		client, err := newDockerClient(&types.SystemContext{
+			DockerInsecureSkipTLSVerify:      types.OptionalBoolTrue,
+			DockerDisableTransferCompression: disabled,
+		}, registry, registry)
+		require.NoError(t, err)
+		defer client.Close()
+		res, _, err := client.fetchManifest(context.Background(), ref, "latest")
+		require.NoError(t, err)
+		assert.Equal(t, !disabled, gzipRequested, disabled)
+		// The manifest is returned, and digested, decompressed.
+		assert.Equal(t, manifestBlob, res, disabled)
+		assert.Equal(t, manifestDigest, digest.FromBytes(res), disabled)
+	}
+}
+
+func TestDockerDialContext(t *testing.T) {
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case "/v2/repo/manifests/latest":
+			w.Header().Set("Content-Type", imgspecv1.MediaTypeImageManifest)
+			_, err := w.Write([]byte("{}"))
+			assert.NoError(t, err)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+	serverAddr := s.Listener.Addr().String()
+	_, port, err := net.SplitHostPort(serverAddr)
+	require.NoError(t, err)
+	// The host name does not resolve; the dialer connects to the test server instead.
+	registry := net.JoinHostPort("registry.example.invalid", port)
+
+	var dialedLock sync.Mutex
+	var dialed []string
+	dialer := &net.Dialer{}
+	sys := &types.SystemContext{
+		DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+		DockerDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dialedLock.Lock()
+			dialed = append(dialed, addr)
+			dialedLock.Unlock()
+			return dialer.DialContext(ctx, network, serverAddr)
+		},
+	}
+
+	named, err := reference.ParseNormalizedNamed(registry + "/repo:latest")
+	require.NoError(t, err)
+	ref, err := newReference(named, false)
+	require.NoError(t, err)
+	client, err := newDockerClient(sys, registry, registry)
+	require.NoError(t, err)
+	defer client.Close()
+	res, _, err := client.fetchManifest(context.Background(), ref, "latest")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("{}"), res)
+	assert.Equal(t, "https", client.scheme) // TLS is still used
+
+	dialedLock.Lock()
+	defer dialedLock.Unlock()
+	require.NotEmpty(t, dialed)
+	for _, addr := range dialed {
+		assert.Equal(t, registry, addr)
+	}
+}
+
+func TestFetchManifestAcceptOrder(t *testing.T) {
+	var acceptHeader []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case "/v2/repo/manifests/latest":
+			acceptHeader = r.Header.Values("Accept")
+			w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+			_, err := w.Write([]byte("{}"))
+			assert.NoError(t, err)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+	registry := strings.TrimPrefix(s.URL, "http://")
+	named, err := reference.ParseNormalizedNamed(registry + "/repo:latest")
+	require.NoError(t, err)
+	ref, err := newReference(named, false)
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		order    []string
+		expected []string
+	}{
+		{nil, manifest.DefaultRequestedManifestMIMETypes},
+		{
+			[]string{manifest.DockerV2Schema2MediaType, imgspecv1.MediaTypeImageManifest},
+			[]string{
+				manifest.DockerV2Schema2MediaType,
+				imgspecv1.MediaTypeImageManifest,
+				manifest.DockerV2Schema1SignedMediaType,
+				manifest.DockerV2Schema1MediaType,
+				manifest.DockerV2ListMediaType,
+				imgspecv1.MediaTypeImageIndex,
+			},
+		},
+		{
+			[]string{imgspecv1.MediaTypeImageIndex},
+			[]string{
+				imgspecv1.MediaTypeImageIndex,
+				imgspecv1.MediaTypeImageManifest,
+				manifest.DockerV2Schema2MediaType,
+				manifest.DockerV2Schema1SignedMediaType,
+				manifest.DockerV2Schema1MediaType,
+				manifest.DockerV2ListMediaType,
+			},
+		},
+	} {
+		acceptHeader = nil
+		client, err := newDockerClient(&types.SystemContext{
+			DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+			ManifestMIMETypeAcceptOrder: c.order,
+		}, registry, registry)
+		require.NoError(t, err, c.order)
+		defer client.Close()
+		_, _, err = client.fetchManifest(context.Background(), ref, "latest")
+		require.NoError(t, err, c.order)
+		assert.Equal(t, c.expected, acceptHeader, c.order)
+	}
+
+	// Invalid values
+	for _, order := range [][]string{
+		{"application/json"},
+		{manifest.DockerV2Schema2MediaType, manifest.DockerV2Schema2MediaType},
+	} {
+		_, err := newDockerClient(&types.SystemContext{
+			DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+			ManifestMIMETypeAcceptOrder: order,
+		}, registry, registry)
+		assert.Error(t, err, order)
+	}
+}
+
+func TestFetchManifestDisableSchema1(t *testing.T) {
+	schema1Blob, err := os.ReadFile("../internal/image/fixtures/schema1.json")
+	require.NoError(t, err)
+	schema2Blob, err := os.ReadFile("../internal/image/fixtures/schema2.json")
+	require.NoError(t, err)
+	manifests := map[string]struct {
+		contentType string
+		blob        []byte
+	}{
+		"schema1":       {manifest.DockerV2Schema1SignedMediaType, schema1Blob},
+		"schema1-octet": {"application/octet-stream", schema1Blob},
+		"schema2-octet": {"application/octet-stream", schema2Blob},
+	}
+	var acceptHeader []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		m, ok := manifests[strings.TrimPrefix(r.URL.Path, "/v2/repo/manifests/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		acceptHeader = r.Header.Values("Accept")
+		w.Header().Set("Content-Type", m.contentType)
+		_, err := w.Write(m.blob)
+		assert.NoError(t, err)
+	}))
+	defer s.Close()
+	registry := strings.TrimPrefix(s.URL, "http://")
+	named, err := reference.ParseNormalizedNamed(registry + "/repo:latest")
+	require.NoError(t, err)
+	ref, err := newReference(named, false)
+	require.NoError(t, err)
+
+	for _, disableSchema1 := range []bool{false, true} {
+		client, err := newDockerClient(&types.SystemContext{
+			DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+			DisableSchema1:              disableSchema1,
+		}, registry, registry)
+		require.NoError(t, err)
+		defer client.Close()
+		for _, c := range []struct {
+			tag       string
+			isSchema1 bool
+		}{
+			{"schema1", true},
+			{"schema1-octet", true},
+			{"schema2-octet", false},
+		} {
+			res, mimeType, err := client.fetchManifest(context.Background(), ref, c.tag)
+			if disableSchema1 && c.isSchema1 {
+				assert.ErrorContains(t, err, "schema1", c.tag)
+			} else {
+				require.NoError(t, err, c.tag)
+				assert.Equal(t, manifests[c.tag].blob, res, c.tag)
+				assert.Equal(t, manifests[c.tag].contentType, mimeType, c.tag)
+			}
+			if disableSchema1 {
+				assert.NotContains(t, acceptHeader, manifest.DockerV2Schema1MediaType)
+				assert.NotContains(t, acceptHeader, manifest.DockerV2Schema1SignedMediaType)
+				assert.Contains(t, acceptHeader, manifest.DockerV2Schema2MediaType)
+			} else {
+				assert.Contains(t, acceptHeader, manifest.DockerV2Schema1SignedMediaType)
+			}
+		}
+	}
+
+	// Explicitly asking for schema1 is inconsistent with DisableSchema1
+	_, err = newDockerClient(&types.SystemContext{
+		DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+		DisableSchema1:              true,
+		ManifestMIMETypeAcceptOrder: []string{manifest.DockerV2Schema1SignedMediaType},
+	}, registry, registry)
+	assert.Error(t, err)
+}
+
 var registrySuseComResp = http.Response{
 	Status:     "401 Unauthorized",
 	StatusCode: http.StatusUnauthorized,
@@ -200,6 +651,248 @@ var registrySuseComResp = http.Response{
 	Request: nil,
 }
 
+func TestGetExternalBlobVerification(t *testing.T) {
+	blob := []byte("foreign layer contents")
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/layer":
+			_, err := w.Write(blob)
+			assert.NoError(t, err)
+		case "/corrupted":
+			_, err := w.Write([]byte("corrupted layer contents"))
+			assert.NoError(t, err)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+	named, err := reference.ParseNormalizedNamed("registry.example/repo:latest")
+	require.NoError(t, err)
+	ref, err := newReference(named, false)
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		path             string
+		skipVerification bool
+		expectedError    bool
+	}{
+		{"/layer", false, false},
+		{"/corrupted", false, true},
+		{"/corrupted", true, false},
+	} {
+		client, err := newDockerClient(&types.SystemContext{SkipForeignLayerVerification: c.skipVerification}, "registry.example", "registry.example")
+		require.NoError(t, err)
+		defer client.Close()
+		// Don’t call detectProperties, which would try to contact registry.example; only the external URL is used.
+		client.client = &http.Client{}
+		client.scheme = "https"
+		reader, _, err := client.getBlob(context.Background(), ref, types.BlobInfo{
+			Digest: digest.FromBytes(blob),
+			Size:   -1,
+			URLs:   []string{s.URL + c.path},
+		}, none.NoCache)
+		require.NoError(t, err, c.path)
+		_, err = io.ReadAll(reader)
+		reader.Close()
+		if c.expectedError {
+			assert.ErrorContains(t, err, "digest mismatch", c.path)
+		} else {
+			assert.NoError(t, err, c.path)
+		}
+	}
+}
+
+func TestRegistryHeaders(t *testing.T) {
+	var configuredHeaders, otherHeaders []string
+	var redirectTarget string
+	newServer := func(headers *[]string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*headers = append(*headers, r.Header.Get("X-Gateway-Route"))
+			switch r.URL.Path {
+			case "/v2/":
+				w.WriteHeader(http.StatusOK)
+			case "/v2/repo/manifests/latest":
+				w.Header().Set("Content-Type", imgspecv1.MediaTypeImageManifest)
+				_, err := w.Write([]byte("{}"))
+				assert.NoError(t, err)
+			case "/v2/repo/manifests/redirected":
+				http.Redirect(w, r, redirectTarget, http.StatusTemporaryRedirect)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+	}
+	configured := newServer(&configuredHeaders)
+	defer configured.Close()
+	other := newServer(&otherHeaders)
+	defer other.Close()
+	redirectTarget = other.URL + "/v2/repo/manifests/latest"
+	configuredRegistry := strings.TrimPrefix(configured.URL, "http://")
+	otherRegistry := strings.TrimPrefix(other.URL, "http://")
+
+	confPath := filepath.Join(t.TempDir(), "registries.conf")
+	err := os.WriteFile(confPath, []byte(fmt.Sprintf("[[registry]]\nlocation = %q\nheaders = { X-Gateway-Route = \"route-1\" }\n", configuredRegistry)), 0o600)
+	require.NoError(t, err)
+	sys := &types.SystemContext{
+		SystemRegistriesConfPath:    confPath,
+		SystemRegistriesConfDirPath: filepath.Join(t.TempDir(), "this-does-not-exist"),
+		DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+	}
+
+	for _, c := range []struct {
+		registry string
+		headers  *[]string
+		expected string
+	}{
+		{configuredRegistry, &configuredHeaders, "route-1"},
+		{otherRegistry, &otherHeaders, ""},
+	} {
+		named, err := reference.ParseNormalizedNamed(c.registry + "/repo:latest")
+		require.NoError(t, err)
+		ref, err := newReference(named, false)
+		require.NoError(t, err)
+		client, err := newDockerClient(sys, c.registry, c.registry)
+		require.NoError(t, err)
+		defer client.Close()
+		_, _, err = client.fetchManifest(context.Background(), ref, "latest")
+		require.NoError(t, err, c.registry)
+		require.NotEmpty(t, *c.headers, c.registry)
+		for _, h := range *c.headers {
+			assert.Equal(t, c.expected, h, c.registry)
+		}
+	}
+
+	// The headers are not sent to a different server the registry redirects to
+	configuredHeaders, otherHeaders = nil, nil
+	named, err := reference.ParseNormalizedNamed(configuredRegistry + "/repo:latest")
+	require.NoError(t, err)
+	ref, err := newReference(named, false)
+	require.NoError(t, err)
+	client, err := newDockerClient(sys, configuredRegistry, configuredRegistry)
+	require.NoError(t, err)
+	defer client.Close()
+	_, _, err = client.fetchManifest(context.Background(), ref, "redirected")
+	require.NoError(t, err)
+	require.NotEmpty(t, configuredHeaders)
+	for _, h := range configuredHeaders {
+		assert.Equal(t, "route-1", h)
+	}
+	assert.Equal(t, []string{""}, otherHeaders)
+}
+
+func TestRegistryPathPrefix(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		switch r.URL.Path {
+		case "/registry/v2/":
+			w.WriteHeader(http.StatusOK)
+		case "/registry/v2/repo/manifests/latest":
+			w.Header().Set("Content-Type", imgspecv1.MediaTypeImageManifest)
+			_, err := w.Write([]byte("{}"))
+			assert.NoError(t, err)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "http://")
+
+	confPath := filepath.Join(t.TempDir(), "registries.conf")
+	err := os.WriteFile(confPath, []byte(fmt.Sprintf("[[registry]]\nlocation = %q\npath-prefix = \"/registry\"\n", registry)), 0o600)
+	require.NoError(t, err)
+	sys := &types.SystemContext{
+		SystemRegistriesConfPath:    confPath,
+		SystemRegistriesConfDirPath: filepath.Join(t.TempDir(), "this-does-not-exist"),
+		DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+	}
+
+	named, err := reference.ParseNormalizedNamed(registry + "/repo:latest")
+	require.NoError(t, err)
+	ref, err := newReference(named, false)
+	require.NoError(t, err)
+	client, err := newDockerClient(sys, registry, registry)
+	require.NoError(t, err)
+	defer client.Close()
+	manifestBlob, _, err := client.fetchManifest(context.Background(), ref, "latest")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("{}"), manifestBlob)
+	assert.Equal(t, []string{"/registry/v2/", "/registry/v2/repo/manifests/latest"}, paths)
+}
+
+func TestRegistryProxy(t *testing.T) {
+	const proxiedRegistry = "proxied.example.invalid"
+	var proxiedRequests []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodConnect || r.URL.Host != proxiedRegistry { // Only allow plain-HTTP requests to the proxied registry
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		proxiedRequests = append(proxiedRequests, r.URL.String())
+		switch r.URL.Path {
+		case "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case "/v2/repo/manifests/latest":
+			w.Header().Set("Content-Type", imgspecv1.MediaTypeImageManifest)
+			_, err := w.Write([]byte("{}"))
+			assert.NoError(t, err)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer proxy.Close()
+	var directRequests []string
+	direct := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		directRequests = append(directRequests, r.URL.Path)
+		switch r.URL.Path {
+		case "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case "/v2/repo/manifests/latest":
+			w.Header().Set("Content-Type", imgspecv1.MediaTypeImageManifest)
+			_, err := w.Write([]byte("{}"))
+			assert.NoError(t, err)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer direct.Close()
+	directRegistry := strings.TrimPrefix(direct.URL, "http://")
+
+	confPath := filepath.Join(t.TempDir(), "registries.conf")
+	err := os.WriteFile(confPath, []byte(fmt.Sprintf("[[registry]]\nlocation = %q\nproxy = %q\n\n[[registry]]\nlocation = %q\nproxy = \"none\"\n",
+		proxiedRegistry, proxy.URL, directRegistry)), 0o600)
+	require.NoError(t, err)
+	sys := &types.SystemContext{
+		SystemRegistriesConfPath:    confPath,
+		SystemRegistriesConfDirPath: filepath.Join(t.TempDir(), "this-does-not-exist"),
+		DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+	}
+
+	for _, c := range []struct {
+		registry        string
+		expectedProxied []string
+		expectedDirect  []string
+	}{
+		{proxiedRegistry, []string{"http://" + proxiedRegistry + "/v2/", "http://" + proxiedRegistry + "/v2/repo/manifests/latest"}, nil},
+		{directRegistry, nil, []string{"/v2/", "/v2/repo/manifests/latest"}},
+	} {
+		proxiedRequests = nil
+		directRequests = nil
+		named, err := reference.ParseNormalizedNamed(c.registry + "/repo:latest")
+		require.NoError(t, err)
+		ref, err := newReference(named, false)
+		require.NoError(t, err)
+		client, err := newDockerClient(sys, c.registry, c.registry)
+		require.NoError(t, err)
+		manifestBlob, _, err := client.fetchManifest(context.Background(), ref, "latest")
+		client.Close()
+		require.NoError(t, err, c.registry)
+		assert.Equal(t, []byte("{}"), manifestBlob, c.registry)
+		assert.Equal(t, c.expectedProxied, proxiedRequests, c.registry)
+		assert.Equal(t, c.expectedDirect, directRequests, c.registry)
+	}
+}
+
 func TestNeedsRetryOnInsuficientScope(t *testing.T) {
 	resp := registrySuseComResp
 	resp.Header["Www-Authenticate"] = []string{
@@ -407,3 +1100,82 @@ func TestIsManifestUnknownError(t *testing.T) {
 		assert.True(t, res, "%s: %#v", c.name, err)
 	}
 }
+
+func TestInsecureSkipTLSVerifyRegistries(t *testing.T) {
+	newServer := func() *httptest.Server {
+		return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/v2/" {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			w.WriteHeader(http.StatusNotFound)
+		}))
+	}
+	insecure := newServer()
+	defer insecure.Close()
+	secure := newServer()
+	defer secure.Close()
+	insecureRegistry := strings.TrimPrefix(insecure.URL, "https://")
+	secureRegistry := strings.TrimPrefix(secure.URL, "https://")
+
+	sys := &types.SystemContext{
+		SystemRegistriesConfPath:    emptyRegistriesConf(t),
+		SystemRegistriesConfDirPath: "/this/does/not/exist",
+		DockerPerHostCertDirPath:    "/this/does/not/exist",
+		DockerInsecureSkipTLSVerifyRegistries: map[string]types.OptionalBool{
+			insecureRegistry: types.OptionalBoolTrue,
+		},
+	}
+	for _, c := range []struct {
+		registry string
+		success  bool
+	}{
+		{insecureRegistry, true},
+		{secureRegistry, false}, // The servers use a self-signed certificate, so this fails TLS verification.
+	} {
+		client, err := newDockerClient(sys, c.registry, c.registry)
+		require.NoError(t, err, c.registry)
+		defer client.Close()
+		err = client.detectProperties(context.Background())
+		if c.success {
+			assert.NoError(t, err, c.registry)
+			assert.Equal(t, "https", client.scheme, c.registry)
+		} else {
+			assert.Error(t, err, c.registry)
+		}
+	}
+
+	// A per-registry override takes precedence over DockerInsecureSkipTLSVerify.
+	sys2 := *sys
+	sys2.DockerInsecureSkipTLSVerify = types.OptionalBoolTrue
+	sys2.DockerInsecureSkipTLSVerifyRegistries = map[string]types.OptionalBool{
+		secureRegistry: types.OptionalBoolFalse,
+	}
+	client, err := newDockerClient(&sys2, secureRegistry, secureRegistry)
+	require.NoError(t, err)
+	defer client.Close()
+	err = client.detectProperties(context.Background())
+	assert.Error(t, err)
+}
+
+func TestInsecureSkipTLSVerifyForRegistry(t *testing.T) {
+	assert.Equal(t, types.OptionalBoolUndefined, insecureSkipTLSVerifyForRegistry(nil, "example.com"))
+	sys := &types.SystemContext{
+		DockerInsecureSkipTLSVerifyRegistries: map[string]types.OptionalBool{
+			"example.com":      types.OptionalBoolTrue,
+			"example.com:5000": types.OptionalBoolFalse,
+			"docker.io":        types.OptionalBoolTrue,
+		},
+	}
+	for _, c := range []struct {
+		registry string
+		expected types.OptionalBool
+	}{
+		{"example.com", types.OptionalBoolTrue},
+		{"example.com:5000", types.OptionalBoolFalse},
+		{"other.example.com", types.OptionalBoolUndefined},
+		{dockerRegistry, types.OptionalBoolTrue},
+	} {
+		assert.Equal(t, c.expected, insecureSkipTLSVerifyForRegistry(sys, c.registry), c.registry)
+	}
+}
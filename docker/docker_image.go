@@ -8,10 +8,14 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/internal/image"
 	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/docker/config"
+	"github.com/containers/image/v5/pkg/sysregistriesv2"
 	"github.com/containers/image/v5/types"
 	"github.com/opencontainers/go-digest"
 	"github.com/sirupsen/logrus"
@@ -54,6 +58,9 @@ func (i *Image) GetRepositoryTags(ctx context.Context) ([]string, error) {
 
 // GetRepositoryTags list all tags available in the repository. The tag
 // provided inside the ImageReference will be ignored.
+// Paginated responses are followed until the full list is read.
+// If the registry rejects the provided credentials, the returned error is an ErrUnauthorizedForCredentials
+// (but not if no credentials were provided); if the repository does not exist, it is an ErrRepositoryNotFound.
 func GetRepositoryTags(ctx context.Context, sys *types.SystemContext, ref types.ImageReference) ([]string, error) {
 	dr, ok := ref.(dockerReference)
 	if !ok {
@@ -73,13 +80,26 @@ func GetRepositoryTags(ctx context.Context, sys *types.SystemContext, ref types.
 
 	tags := make([]string, 0)
 
+	if err := client.detectProperties(ctx); err != nil {
+		return nil, err
+	}
+	pageURL, err := client.resolveRequestURL(path)
+	if err != nil {
+		return nil, err
+	}
 	for {
-		res, err := client.makeRequest(ctx, http.MethodGet, path, nil, nil, v2Auth, nil)
+		res, err := client.makeRequestToResolvedURL(ctx, http.MethodGet, pageURL, nil, nil, -1, v2Auth, nil)
 		if err != nil {
 			return nil, err
 		}
 		defer res.Body.Close()
-		if res.StatusCode != http.StatusOK {
+		switch res.StatusCode {
+		case http.StatusOK:
+		case http.StatusUnauthorized:
+			return nil, fmt.Errorf("fetching tags list: %w", client.unauthorizedResponseToError(res))
+		case http.StatusNotFound:
+			return nil, ErrRepositoryNotFound{Err: fmt.Errorf("fetching tags list: %w", registryHTTPResponseToError(res))}
+		default:
 			return nil, fmt.Errorf("fetching tags list: %w", registryHTTPResponseToError(res))
 		}
 
@@ -110,26 +130,124 @@ func GetRepositoryTags(ctx context.Context, sys *types.SystemContext, ref types.
 			tags = append(tags, tag)
 		}
 
-		link := res.Header.Get("Link")
-		if link == "" {
+		nextURL, err := nextPageURL(res)
+		if err != nil {
+			return tags, err
+		}
+		if nextURL == nil {
 			break
 		}
+		pageURL = nextURL
+	}
+	return tags, nil
+}
 
-		linkURLPart, _, _ := strings.Cut(link, ";")
-		linkURL, err := url.Parse(strings.Trim(linkURLPart, "<>"))
-		if err != nil {
-			return tags, err
+// nextPageURL returns the URL of the next page of a paginated list, as specified by the Link header in res,
+// or nil if there are no more pages.
+// The link is resolved relative to the URL of the request, and must refer to the same server;
+// it may switch from http to https (but not the other way), e.g. if a registry behind a TLS-terminating proxy creates absolute links.
+func nextPageURL(res *http.Response) (*url.URL, error) {
+	link := res.Header.Get("Link")
+	if link == "" {
+		return nil, nil
+	}
+
+	linkURLPart, _, _ := strings.Cut(link, ";")
+	linkURL, err := url.Parse(strings.Trim(linkURLPart, "<>"))
+	if err != nil {
+		return nil, err
+	}
+	nextURL := res.Request.URL.ResolveReference(linkURL)
+	// Don’t send credentials for this registry anywhere else.
+	sameScheme := nextURL.Scheme == res.Request.URL.Scheme || (res.Request.URL.Scheme == "http" && nextURL.Scheme == "https")
+	if !sameScheme || nextURL.Host != res.Request.URL.Host {
+		return nil, fmt.Errorf("next page link %s refers to a different server than %s", nextURL.Redacted(), res.Request.URL.Redacted())
+	}
+	return nextURL, nil
+}
+
+// GetRepositories returns an iterator over the names of all repositories in registry (a host[:port] value),
+// as listed by the registry’s catalog endpoint. Paginated responses are followed until the full list is read.
+// The returned value can be used as an iter.Seq2[string, error]; if an error occurs, it is returned as the last element.
+//
+// If the registry rejects the provided credentials, the error is an ErrUnauthorizedForCredentials (but not if no credentials were provided);
+// if the registry does not provide the catalog endpoint (as is the case for docker.io), the error is an ErrCatalogNotSupported.
+func GetRepositories(ctx context.Context, sys *types.SystemContext, registry string) func(yield func(string, error) bool) {
+	return func(yield func(string, error) bool) {
+		if err := getRepositories(ctx, sys, registry, func(repo string) bool {
+			return yield(repo, nil)
+		}); err != nil {
+			yield("", err)
 		}
+	}
+}
+
+// getRepositories implements GetRepositories, calling yield for every repository until it returns false.
+func getRepositories(ctx context.Context, sys *types.SystemContext, registry string, yield func(string) bool) error {
+	// We can't use GetCredentialsForRef here because we want to list the whole registry.
+	auth, err := config.GetCredentials(sys, registry)
+	if err != nil {
+		return fmt.Errorf("getting username and password: %w", err)
+	}
+	client, err := newDockerClient(sys, registry, registry)
+	if err != nil {
+		return fmt.Errorf("creating new docker client: %w", err)
+	}
+	defer client.Close()
+	client.auth = auth
+	if sys != nil {
+		client.registryToken = sys.DockerBearerRegistryToken
+	}
+	client.scope = authScope{resourceType: "registry", remoteName: "catalog", actions: "*"}
 
-		// can be relative or absolute, but we only want the path (and I
-		// guess we're in trouble if it forwards to a new place...)
-		path = linkURL.Path
-		if linkURL.RawQuery != "" {
-			path += "?"
-			path += linkURL.RawQuery
+	if err := client.detectProperties(ctx); err != nil {
+		return err
+	}
+	pageURL, err := client.resolveRequestURL(catalogPath)
+	if err != nil {
+		return err
+	}
+	for {
+		nextURL, err := func() (*url.URL, error) { // A scope for defer
+			res, err := client.makeRequestToResolvedURL(ctx, http.MethodGet, pageURL, nil, nil, -1, v2Auth, nil)
+			if err != nil {
+				return nil, err
+			}
+			defer res.Body.Close()
+			switch res.StatusCode {
+			case http.StatusOK:
+			case http.StatusUnauthorized:
+				return nil, fmt.Errorf("listing repositories: %w", client.unauthorizedResponseToError(res))
+			case http.StatusNotFound, http.StatusMethodNotAllowed:
+				return nil, ErrCatalogNotSupported{Err: fmt.Errorf("listing repositories: %w", registryHTTPResponseToError(res))}
+			default:
+				return nil, fmt.Errorf("listing repositories: %w", registryHTTPResponseToError(res))
+			}
+
+			var catalog struct {
+				Repositories []string `json:"repositories"`
+			}
+			if err := json.NewDecoder(res.Body).Decode(&catalog); err != nil {
+				return nil, err
+			}
+			for _, repo := range catalog.Repositories {
+				if _, err := reference.WithName(repo); err != nil { // Ensure the repository name does not contain unexpected values
+					return nil, fmt.Errorf("registry returned invalid repository name %q: %w", repo, err)
+				}
+				if !yield(repo) {
+					return nil, nil
+				}
+			}
+			return nextPageURL(res)
+		}()
+		if err != nil {
+			return err
 		}
+		if nextURL == nil {
+			return nil
+		}
+		pageURL = nextURL
 	}
-	return tags, nil
 }
 
 // GetDigest returns the image's digest
@@ -138,6 +256,10 @@ func GetRepositoryTags(ctx context.Context, sys *types.SystemContext, ref types.
 // and compute the digest from the value returned by GetManifest.
 // NOTE: Implemented to avoid Docker Hub API limits, and mirror configuration may be
 // ignored (but may be implemented in the future)
+//
+// The digest is read from the Docker-Content-Digest header of a HEAD request; if the registry does not
+// return that header, the manifest is downloaded and its digest is computed locally.
+// If the registry reports that the manifest does not exist, the returned error is an ErrManifestNotFound.
 func GetDigest(ctx context.Context, sys *types.SystemContext, ref types.ImageReference) (digest.Digest, error) {
 	dr, ok := ref.(dockerReference)
 	if !ok {
@@ -164,7 +286,7 @@ func GetDigest(ctx context.Context, sys *types.SystemContext, ref types.ImageRef
 
 	path := fmt.Sprintf(manifestPath, reference.Path(dr.ref), tagOrDigest)
 	headers := map[string][]string{
-		"Accept": manifest.DefaultRequestedManifestMIMETypes,
+		"Accept": client.manifestAcceptTypes,
 	}
 
 	res, err := client.makeRequest(ctx, http.MethodHead, path, headers, nil, v2Auth, nil)
@@ -173,14 +295,208 @@ func GetDigest(ctx context.Context, sys *types.SystemContext, ref types.ImageRef
 	}
 
 	defer res.Body.Close()
-	if res.StatusCode != http.StatusOK {
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", ErrManifestNotFound{Err: fmt.Errorf("reading digest %s in %s: %w", tagOrDigest, dr.ref.Name(), registryHTTPResponseToError(res))}
+	default:
 		return "", fmt.Errorf("reading digest %s in %s: %w", tagOrDigest, dr.ref.Name(), registryHTTPResponseToError(res))
 	}
 
-	dig, err := digest.Parse(res.Header.Get("Docker-Content-Digest"))
+	if header := res.Header.Get("Docker-Content-Digest"); header != "" {
+		dig, err := digest.Parse(header)
+		if err != nil {
+			return "", err
+		}
+		return dig, nil
+	}
+
+	logrus.Debugf("Manifest HEAD response for %s in %s didn’t contain a Docker-Content-Digest header, downloading the manifest", tagOrDigest, dr.ref.Name())
+	manblob, _, err := client.fetchManifest(ctx, dr, tagOrDigest)
 	if err != nil {
 		return "", err
 	}
+	return manifest.Digest(manblob)
+}
+
+// ResolvedTag is a manifest read by ResolveTag, along with its digest.
+type ResolvedTag struct {
+	Manifest         []byte
+	ManifestMIMEType string
+	Digest           digest.Digest        // The digest of Manifest.
+	DigestReference  types.ImageReference // A reference to the same repository by Digest, e.g. to pin later pulls to exactly this manifest.
+}
+
+// ResolveTag reads the manifest ref (typically a tag) refers to, and returns it along with its digest, using a single manifest request;
+// this allows recording the tag-to-digest mapping, and using the returned manifest, without a race against the tag being moved in the meantime.
+//
+// If expectedDigest is not "" (e.g. a digest recorded by an earlier call), and the manifest does not match it,
+// e.g. because the tag was moved to a different image, an ErrTagDigestChanged is returned.
+//
+// NOTE: As with GetDigest, mirror configuration is ignored.
+func ResolveTag(ctx context.Context, sys *types.SystemContext, ref types.ImageReference, expectedDigest digest.Digest) (*ResolvedTag, error) {
+	dr, ok := ref.(dockerReference)
+	if !ok {
+		return nil, errors.New("ref must be a dockerReference")
+	}
+	if dr.isUnknownDigest {
+		return nil, fmt.Errorf("docker: reference %q is for unknown digest case; cannot resolve it", dr.StringWithinTransport())
+	}
+	if expectedDigest != "" {
+		if err := expectedDigest.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid expected digest %q: %w", expectedDigest, err)
+		}
+	}
+	tagOrDigest, err := dr.tagOrDigest()
+	if err != nil {
+		return nil, err
+	}
 
-	return dig, nil
+	registryConfig, err := loadRegistryConfiguration(sys)
+	if err != nil {
+		return nil, err
+	}
+	client, err := newDockerClientFromRef(sys, dr, registryConfig, false, "pull")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client: %w", err)
+	}
+	defer client.Close()
+
+	manblob, mimeType, err := client.fetchManifest(ctx, dr, tagOrDigest)
+	if err != nil {
+		return nil, err
+	}
+	manifestDigest, err := manifest.Digest(manblob)
+	if err != nil {
+		return nil, err
+	}
+	if digested, ok := dr.ref.(reference.Canonical); ok {
+		matches, err := manifest.MatchesDigest(manblob, digested.Digest())
+		if err != nil {
+			return nil, fmt.Errorf("computing manifest digest: %w", err)
+		}
+		if !matches {
+			return nil, fmt.Errorf("manifest %s of %s does not match the expected digest", digested.Digest(), dr.ref.Name())
+		}
+		manifestDigest = digested.Digest() // In case it uses a different algorithm
+	}
+	if expectedDigest != "" {
+		matches, err := manifest.MatchesDigest(manblob, expectedDigest)
+		if err != nil {
+			return nil, fmt.Errorf("computing manifest digest: %w", err)
+		}
+		if !matches {
+			return nil, ErrTagDigestChanged{Reference: dr.StringWithinTransport(), Expected: expectedDigest, Actual: manifestDigest}
+		}
+	}
+
+	digestedNamed, err := reference.WithDigest(reference.TrimNamed(dr.ref), manifestDigest)
+	if err != nil {
+		return nil, err
+	}
+	digestRef, err := newReference(digestedNamed, false)
+	if err != nil {
+		return nil, err
+	}
+	return &ResolvedTag{
+		Manifest:         manblob,
+		ManifestMIMEType: mimeType,
+		Digest:           manifestDigest,
+		DigestReference:  digestRef,
+	}, nil
+}
+
+// EndpointStatus describes the state of one of the endpoints which would be used to pull an image, as determined by CheckPullSources.
+type EndpointStatus struct {
+	// Reference is the reference of the image on this endpoint, after applying any prefix rewriting for mirrors.
+	Reference reference.Named
+	// Endpoint is the configuration of the endpoint, from registries.conf(5).
+	Endpoint sysregistriesv2.Endpoint
+	// Reachable is true if the endpoint responded as a registry.
+	Reachable bool
+	// Authorized is true if the endpoint accepted the credentials (if any) configured for it.
+	Authorized bool
+	// Err, if not nil, describes why the endpoint is not Reachable or not Authorized.
+	// If the endpoint rejected the credentials, Err is an ErrUnauthorizedForCredentials (but not if no credentials were provided).
+	Err error
+}
+
+// pullSourceCheckTimeout is the time CheckPullSources allows each endpoint to respond.
+const pullSourceCheckTimeout = 30 * time.Second
+
+// CheckPullSources returns the status of each endpoint (mirrors, then the primary location)
+// which would be used to pull ref, in the order they would be tried, without reading any image data.
+// Endpoint settings from registries.conf (e.g. insecure, headers, proxy, and credentials) are applied
+// as for a pull. Endpoints are checked concurrently, and each endpoint is given at most 30 seconds to respond,
+// so that one unresponsive endpoint does not affect the status reported for the others; ctx can be used to limit
+// the total time spent.
+//
+// An error is returned only if the endpoints can't be determined; per-endpoint failures are reported in EndpointStatus.Err.
+func CheckPullSources(ctx context.Context, sys *types.SystemContext, ref types.ImageReference) ([]EndpointStatus, error) {
+	return checkPullSources(ctx, sys, ref, pullSourceCheckTimeout)
+}
+
+// checkPullSources implements CheckPullSources, allowing each endpoint at most timeout to respond.
+func checkPullSources(ctx context.Context, sys *types.SystemContext, ref types.ImageReference, timeout time.Duration) ([]EndpointStatus, error) {
+	dr, ok := ref.(dockerReference)
+	if !ok {
+		return nil, errors.New("ref must be a dockerReference")
+	}
+
+	registryConfig, err := loadRegistryConfiguration(sys)
+	if err != nil {
+		return nil, err
+	}
+	pullSources, err := pullSourcesForReference(sys, dr)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]EndpointStatus, len(pullSources))
+	wg := sync.WaitGroup{}
+	for i, pullSource := range pullSources {
+		res[i] = EndpointStatus{
+			Reference: pullSource.Reference,
+			Endpoint:  pullSource.Endpoint,
+		}
+		wg.Add(1)
+		go func(status *EndpointStatus, pullSource sysregistriesv2.PullSource) {
+			defer wg.Done()
+			endpointCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			status.Reachable, status.Authorized, status.Err = checkPullSource(endpointCtx, sys, dr, pullSource, registryConfig)
+		}(&res[i], pullSource)
+	}
+	wg.Wait()
+	return res, nil
+}
+
+// checkPullSource implements CheckPullSources for a single pullSource.
+func checkPullSource(ctx context.Context, sys *types.SystemContext, logicalRef dockerReference, pullSource sysregistriesv2.PullSource,
+	registryConfig *registryConfiguration) (reachable bool, authorized bool, err error) {
+	physicalRef, err := newReference(pullSource.Reference, false)
+	if err != nil {
+		return false, false, err
+	}
+	client, _, err := newPullSourceClient(sys, logicalRef, physicalRef, pullSource, registryConfig)
+	if err != nil {
+		return false, false, err
+	}
+	defer client.Close()
+
+	if err := client.detectProperties(ctx); err != nil {
+		return false, false, err
+	}
+	resp, err := client.makeRequest(ctx, http.MethodGet, "/v2/", nil, nil, v2Auth, nil)
+	if err != nil {
+		return true, false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, true, nil
+	case http.StatusUnauthorized:
+		return true, false, client.unauthorizedResponseToError(resp)
+	default:
+		return true, false, registryHTTPResponseToError(resp)
+	}
 }
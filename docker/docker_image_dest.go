@@ -15,6 +15,7 @@ import (
 	"path/filepath"
 	"slices"
 	"strings"
+	"sync/atomic"
 
 	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/internal/blobinfocache"
@@ -44,10 +45,12 @@ type dockerImageDestination struct {
 	stubs.IgnoresOriginalOCIConfig
 	stubs.NoPutBlobPartialInitialize
 
-	ref dockerReference
-	c   *dockerClient
+	ref              dockerReference
+	c                *dockerClient
+	mountSourceRepos []reference.Named // Repositories to try mounting blobs from, from SystemContext.BlobMountFromRepositories
 	// State
-	manifestDigest digest.Digest // or "" if not yet known.
+	manifestDigest         digest.Digest // or "" if not yet known.
+	chunkedUploadsRequired atomic.Bool   // Set if the registry rejected a blob upload in a single request
 }
 
 // newImageDestination creates a new ImageDestination for the specified image reference.
@@ -66,7 +69,7 @@ func newImageDestination(sys *types.SystemContext, ref dockerReference) (private
 		imgspecv1.MediaTypeImageIndex,
 		manifest.DockerV2ListMediaType,
 	}
-	if c.sys == nil || !c.sys.DockerDisableDestSchema1MIMETypes {
+	if c.sys == nil || (!c.sys.DockerDisableDestSchema1MIMETypes && !c.sys.DisableSchema1) {
 		mimeTypes = append(mimeTypes, manifest.DockerV2Schema1SignedMediaType, manifest.DockerV2Schema1MediaType)
 	}
 
@@ -80,13 +83,39 @@ func newImageDestination(sys *types.SystemContext, ref dockerReference) (private
 		}),
 		NoPutBlobPartialInitialize: stubs.NoPutBlobPartial(ref),
 
-		ref: ref,
-		c:   c,
+		ref:              ref,
+		c:                c,
+		mountSourceRepos: mountSourceRepositories(sys, ref),
 	}
 	dest.Compat = impl.AddCompat(dest)
 	return dest, nil
 }
 
+// mountSourceRepositories returns the valid repositories in sys.BlobMountFromRepositories usable for mounting blobs to ref.
+func mountSourceRepositories(sys *types.SystemContext, ref dockerReference) []reference.Named {
+	if sys == nil {
+		return nil
+	}
+	res := []reference.Named{}
+	for _, repo := range sys.BlobMountFromRepositories {
+		named, err := reference.ParseNormalizedNamed(repo)
+		if err != nil {
+			logrus.Warnf("Ignoring invalid blob mount source repository %q: %v", repo, err)
+			continue
+		}
+		if !reference.IsNameOnly(named) {
+			logrus.Warnf("Ignoring blob mount source repository %q: it must not contain a tag or digest", repo)
+			continue
+		}
+		if reference.Domain(named) != reference.Domain(ref.ref) {
+			logrus.Warnf("Ignoring blob mount source repository %q: it is not on the destination registry %s", repo, reference.Domain(ref.ref))
+			continue
+		}
+		res = append(res, named)
+	}
+	return res
+}
+
 // Reference returns the reference used to set up this destination.  Note that this should directly correspond to user's intent,
 // e.g. it should use the public hostname instead of the result of resolving CNAMEs or following redirects.
 func (d *dockerImageDestination) Reference() types.ImageReference {
@@ -161,47 +190,50 @@ func (d *dockerImageDestination) PutBlobWithOptions(ctx context.Context, stream
 		}
 	}
 
-	// FIXME? Chunked upload, progress reporting, etc.
+	// FIXME? Progress reporting, etc.
 	uploadPath := fmt.Sprintf(blobUploadPath, reference.Path(d.ref.ref))
-	logrus.Debugf("Uploading %s", uploadPath)
-	res, err := d.c.makeRequest(ctx, http.MethodPost, uploadPath, nil, nil, v2Auth, nil)
+	uploadLocation, err := d.startBlobUpload(ctx, uploadPath)
 	if err != nil {
 		return private.UploadedBlob{}, err
 	}
-	defer res.Body.Close()
-	if res.StatusCode != http.StatusAccepted {
-		logrus.Debugf("Error initiating layer upload, response %#v", *res)
-		return private.UploadedBlob{}, fmt.Errorf("initiating layer upload to %s in %s: %w", uploadPath, d.c.registry, registryHTTPResponseToError(res))
-	}
-	uploadLocation, err := res.Location()
-	if err != nil {
-		return private.UploadedBlob{}, fmt.Errorf("determining upload URL: %w", err)
-	}
 
-	digester, stream := putblobdigest.DigestIfCanonicalUnknown(stream, inputInfo)
-	sizeCounter := &sizeCounter{}
-	stream = io.TeeReader(stream, sizeCounter)
-
-	uploadLocation, err = func() (*url.URL, error) { // A scope for defer
-		uploadReader := uploadreader.NewUploadReader(stream)
-		// This error text should never be user-visible, we terminate only after makeRequestToResolvedURL
-		// returns, so there isn’t a way for the error text to be provided to any of our callers.
-		defer uploadReader.Terminate(errors.New("Reading data from an already terminated upload"))
-		res, err = d.c.makeRequestToResolvedURL(ctx, http.MethodPatch, uploadLocation, map[string][]string{"Content-Type": {"application/octet-stream"}}, uploadReader, inputInfo.Size, v2Auth, nil)
+	chunkSize := d.uploadChunkSize()
+	var spooled *spooledReader
+	if chunkSize == 0 {
+		// Keep a copy of the blob, so that the upload can be retried with chunks if the registry requires them.
+		spooled, err = newSpooledReader(d.c.sys, stream)
 		if err != nil {
-			logrus.Debugf("Error uploading layer chunked %v", err)
-			return nil, err
-		}
-		defer res.Body.Close()
-		if !successStatus(res.StatusCode) {
-			return nil, fmt.Errorf("uploading layer chunked: %w", registryHTTPResponseToError(res))
+			return private.UploadedBlob{}, err
 		}
-		uploadLocation, err := res.Location()
-		if err != nil {
-			return nil, fmt.Errorf("determining upload URL: %w", err)
+		defer spooled.close()
+		stream = spooled
+	}
+
+	digester, digestedStream := putblobdigest.DigestIfCanonicalUnknown(stream, inputInfo)
+	sizeCounter := &sizeCounter{}
+	digestedStream = io.TeeReader(digestedStream, sizeCounter)
+
+	if chunkSize > 0 {
+		uploadLocation, err = d.uploadBlobChunked(ctx, uploadLocation, digestedStream, chunkSize)
+	} else {
+		var requiresChunks bool
+		uploadLocation, requiresChunks, err = d.uploadBlobInOneRequest(ctx, uploadLocation, digestedStream, inputInfo.Size)
+		if err != nil && requiresChunks {
+			d.chunkedUploadsRequired.Store(true)
+			logrus.Debugf("Registry rejected a blob upload in a single request, retrying with a chunked upload: %v", err)
+			var replayed io.Reader
+			replayed, err = spooled.replay()
+			if err == nil {
+				uploadLocation, err = d.startBlobUpload(ctx, uploadPath)
+			}
+			if err == nil {
+				digester, digestedStream = putblobdigest.DigestIfCanonicalUnknown(replayed, inputInfo)
+				sizeCounter.size = 0
+				digestedStream = io.TeeReader(digestedStream, sizeCounter)
+				uploadLocation, err = d.uploadBlobChunked(ctx, uploadLocation, digestedStream, defaultUploadChunkSize)
+			}
 		}
-		return uploadLocation, nil
-	}()
+	}
 	if err != nil {
 		return private.UploadedBlob{}, err
 	}
@@ -212,7 +244,7 @@ func (d *dockerImageDestination) PutBlobWithOptions(ctx context.Context, stream
 	locationQuery := uploadLocation.Query()
 	locationQuery.Set("digest", blobDigest.String())
 	uploadLocation.RawQuery = locationQuery.Encode()
-	res, err = d.c.makeRequestToResolvedURL(ctx, http.MethodPut, uploadLocation, map[string][]string{"Content-Type": {"application/octet-stream"}}, nil, -1, v2Auth, nil)
+	res, err := d.c.makeRequestToResolvedURL(ctx, http.MethodPut, uploadLocation, map[string][]string{"Content-Type": {"application/octet-stream"}}, nil, -1, v2Auth, nil)
 	if err != nil {
 		return private.UploadedBlob{}, err
 	}
@@ -227,6 +259,49 @@ func (d *dockerImageDestination) PutBlobWithOptions(ctx context.Context, stream
 	return private.UploadedBlob{Digest: blobDigest, Size: sizeCounter.size}, nil
 }
 
+// startBlobUpload starts a blob upload session at uploadPath, and returns the location to use for the first request in the session.
+func (d *dockerImageDestination) startBlobUpload(ctx context.Context, uploadPath string) (*url.URL, error) {
+	logrus.Debugf("Uploading %s", uploadPath)
+	res, err := d.c.makeRequest(ctx, http.MethodPost, uploadPath, nil, nil, v2Auth, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusAccepted {
+		logrus.Debugf("Error initiating layer upload, response %#v", *res)
+		return nil, fmt.Errorf("initiating layer upload to %s in %s: %w", uploadPath, d.c.registry, registryHTTPResponseToError(res))
+	}
+	uploadLocation, err := res.Location()
+	if err != nil {
+		return nil, fmt.Errorf("determining upload URL: %w", err)
+	}
+	return uploadLocation, nil
+}
+
+// uploadBlobInOneRequest uploads stream, of size (or -1 if unknown), to the upload session at uploadLocation in a single request,
+// and returns the location to use for the next request in the upload session.
+// On failure, requiresChunks is set if the registry seems to only accept chunked uploads.
+func (d *dockerImageDestination) uploadBlobInOneRequest(ctx context.Context, uploadLocation *url.URL, stream io.Reader, size int64) (_ *url.URL, requiresChunks bool, _ error) {
+	uploadReader := uploadreader.NewUploadReader(stream)
+	// This error text should never be user-visible, we terminate only after makeRequestToResolvedURL
+	// returns, so there isn’t a way for the error text to be provided to any of our callers.
+	defer uploadReader.Terminate(errors.New("Reading data from an already terminated upload"))
+	res, err := d.c.makeRequestToResolvedURL(ctx, http.MethodPatch, uploadLocation, map[string][]string{"Content-Type": {"application/octet-stream"}}, uploadReader, size, v2Auth, nil)
+	if err != nil {
+		logrus.Debugf("Error uploading layer chunked %v", err)
+		return nil, false, err
+	}
+	defer res.Body.Close()
+	if !successStatus(res.StatusCode) {
+		return nil, uploadRequiresChunks(res.StatusCode), fmt.Errorf("uploading layer chunked: %w", registryHTTPResponseToError(res))
+	}
+	uploadLocation, err = res.Location()
+	if err != nil {
+		return nil, false, fmt.Errorf("determining upload URL: %w", err)
+	}
+	return uploadLocation, false, nil
+}
+
 // blobExists returns true iff repo contains a blob with digest, and if so, also its size.
 // If the destination does not contain the blob, or it is unknown, blobExists ordinarily returns (false, -1, nil);
 // it returns a non-nil error only on an unexpected failure.
@@ -356,12 +431,24 @@ func (d *dockerImageDestination) TryReusingBlobWithOptions(ctx context.Context,
 		// and use it even if no location candidate exists and the original dandidate is present.
 	}
 
-	// Then try reusing blobs from other locations.
-	candidates := options.Cache.CandidateLocations2(d.ref.Transport(), bicTransportScope(d.ref), info.Digest, blobinfocache.CandidateLocations2Options{
+	// Then try reusing blobs from other locations, starting with the repositories the user asked us to mount from.
+	candidates := []blobinfocache.BICReplacementCandidate2{}
+	if originalCandidateKnownToBeMissing {
+		for _, repo := range d.mountSourceRepos {
+			if repo.Name() == d.ref.ref.Name() {
+				continue
+			}
+			candidates = append(candidates, blobinfocache.BICReplacementCandidate2{
+				Digest:   info.Digest,
+				Location: types.BICLocationReference{Opaque: repo.Name()},
+			})
+		}
+	}
+	candidates = append(candidates, options.Cache.CandidateLocations2(d.ref.Transport(), bicTransportScope(d.ref), info.Digest, blobinfocache.CandidateLocations2Options{
 		CanSubstitute:           options.CanSubstitute,
 		PossibleManifestFormats: options.PossibleManifestFormats,
 		RequiredCompression:     options.RequiredCompression,
-	})
+	})...)
 	for _, candidate := range candidates {
 		var candidateRepo reference.Named
 		if !candidate.UnknownLocation {
@@ -457,6 +544,10 @@ func (d *dockerImageDestination) TryReusingBlobWithOptions(ctx context.Context,
 // If the destination is in principle available, refuses this manifest type (e.g. it does not recognize the schema),
 // but may accept a different manifest type, the returned error must be an ManifestTypeRejectedError.
 func (d *dockerImageDestination) PutManifest(ctx context.Context, m []byte, instanceDigest *digest.Digest) error {
+	if mt := manifest.GuessMIMEType(m); d.c.sys != nil && d.c.sys.DisableSchema1 &&
+		(mt == manifest.DockerV2Schema1MediaType || mt == manifest.DockerV2Schema1SignedMediaType) {
+		return errors.New("refusing to upload a deprecated Docker schema1 manifest, which is disabled by SystemContext.DisableSchema1")
+	}
 	var refTail string
 	// If d.ref.isUnknownDigest=true, then we push without a tag, so get the
 	// digest that will be used
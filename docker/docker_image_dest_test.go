@@ -3,10 +3,24 @@ package docker
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"fmt"
+	"io"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 
+	"github.com/containers/image/v5/internal/blobinfocache"
 	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/pkg/blobinfocache/memory"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	compressiontypes "github.com/containers/image/v5/pkg/compression/types"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -34,3 +48,312 @@ func TestIsManifestInvalidError(t *testing.T) {
 	res := isManifestInvalidError(err)
 	assert.True(t, res, "%#v", err)
 }
+
+func TestTryReusingBlobMount(t *testing.T) {
+	blob := []byte("blob contents")
+	blobDigest := digest.FromBytes(blob)
+
+	for _, mountAccepted := range []bool{true, false} {
+		destHasBlob := false
+		mountAttempts, cancelledUploads, uploads := 0, 0, 0
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.Method == http.MethodGet && r.URL.Path == "/v2/":
+				rw.WriteHeader(http.StatusOK)
+			case r.Method == http.MethodHead && r.URL.Path == "/v2/src/blobs/"+blobDigest.String():
+				rw.Header().Set("Content-Length", strconv.Itoa(len(blob)))
+				rw.WriteHeader(http.StatusOK)
+			case r.Method == http.MethodHead && r.URL.Path == "/v2/dest/blobs/"+blobDigest.String():
+				if !destHasBlob {
+					rw.WriteHeader(http.StatusNotFound)
+					return
+				}
+				rw.Header().Set("Content-Length", strconv.Itoa(len(blob)))
+				rw.WriteHeader(http.StatusOK)
+			case r.Method == http.MethodPost && r.URL.Path == "/v2/dest/blobs/uploads/" && r.URL.Query().Has("mount"):
+				mountAttempts++
+				assert.Equal(t, blobDigest.String(), r.URL.Query().Get("mount"))
+				assert.Equal(t, "src", r.URL.Query().Get("from"))
+				if mountAccepted {
+					destHasBlob = true
+					rw.WriteHeader(http.StatusCreated)
+				} else {
+					// The registry ignores the mount request, and starts an ordinary upload.
+					rw.Header().Set("Location", "/v2/dest/blobs/uploads/unwanted")
+					rw.WriteHeader(http.StatusAccepted)
+				}
+			case r.Method == http.MethodDelete && r.URL.Path == "/v2/dest/blobs/uploads/unwanted":
+				cancelledUploads++
+				rw.WriteHeader(http.StatusNoContent)
+			case r.Method == http.MethodPost && r.URL.Path == "/v2/dest/blobs/uploads/":
+				rw.Header().Set("Location", "/v2/dest/blobs/uploads/upload")
+				rw.WriteHeader(http.StatusAccepted)
+			case r.Method == http.MethodPatch && r.URL.Path == "/v2/dest/blobs/uploads/upload":
+				body, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				assert.Equal(t, blob, body)
+				rw.Header().Set("Location", "/v2/dest/blobs/uploads/upload")
+				rw.WriteHeader(http.StatusAccepted)
+			case r.Method == http.MethodPut && r.URL.Path == "/v2/dest/blobs/uploads/upload":
+				assert.Equal(t, blobDigest.String(), r.URL.Query().Get("digest"))
+				uploads++
+				destHasBlob = true
+				rw.WriteHeader(http.StatusCreated)
+			default:
+				require.FailNowf(t, "Unexpected request", "%v %v", r.Method, r.URL.Path)
+			}
+		}))
+		defer server.Close()
+		registryURL, err := url.Parse(server.URL)
+		require.NoError(t, err)
+		registry := registryURL.Host
+
+		sys := &types.SystemContext{
+			RegistriesDirPath:           "/this/does/not/exist",
+			DockerPerHostCertDirPath:    "/this/does/not/exist",
+			SystemRegistriesConfPath:    emptyRegistriesConf(t),
+			DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+		}
+		srcRef, err := ParseReference("//" + registry + "/src:latest")
+		require.NoError(t, err)
+		destRef, err := ParseReference("//" + registry + "/dest:latest")
+		require.NoError(t, err)
+
+		// The blob is known to exist in another repository on the same registry.
+		cache := blobinfocache.FromBlobInfoCache(memory.New())
+		cache.RecordDigestCompressorData(blobDigest, blobinfocache.DigestCompressorData{
+			BaseVariantCompressor:     compressiontypes.GzipAlgorithmName,
+			SpecificVariantCompressor: blobinfocache.UnknownCompression,
+		})
+		cache.RecordKnownLocation(srcRef.Transport(), bicTransportScope(srcRef.(dockerReference)), blobDigest, newBICLocationReference(srcRef.(dockerReference)))
+
+		dest, err := newImageDestination(sys, destRef.(dockerReference))
+		require.NoError(t, err)
+		defer dest.Close()
+		blobInfo := types.BlobInfo{Digest: blobDigest, Size: int64(len(blob))}
+		reused, reusedBlob, err := dest.TryReusingBlobWithOptions(context.Background(), blobInfo, private.TryReusingBlobOptions{
+			Cache:         cache,
+			CanSubstitute: true,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 1, mountAttempts)
+		if mountAccepted {
+			assert.True(t, reused)
+			assert.Equal(t, blobDigest, reusedBlob.Digest)
+			assert.Equal(t, int64(len(blob)), reusedBlob.Size)
+			assert.Equal(t, 0, cancelledUploads)
+		} else {
+			assert.False(t, reused)
+			assert.Equal(t, 1, cancelledUploads)
+			// The caller falls back to an ordinary upload.
+			uploaded, err := dest.PutBlobWithOptions(context.Background(), bytes.NewReader(blob), blobInfo, private.PutBlobOptions{Cache: cache})
+			require.NoError(t, err)
+			assert.Equal(t, blobDigest, uploaded.Digest)
+			assert.Equal(t, 1, uploads)
+		}
+		assert.True(t, destHasBlob)
+	}
+}
+
+func TestTryReusingBlobMountFromRepositories(t *testing.T) {
+	blob := []byte("blob contents")
+	blobDigest := digest.FromBytes(blob)
+
+	for _, sharedHasBlob := range []bool{true, false} {
+		checkedRepos := []string{}
+		mountedFrom := []string{}
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.Method == http.MethodGet && r.URL.Path == "/v2/":
+				rw.WriteHeader(http.StatusOK)
+			case r.Method == http.MethodHead && strings.HasSuffix(r.URL.Path, "/blobs/"+blobDigest.String()):
+				repo := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v2/"), "/blobs/"+blobDigest.String())
+				checkedRepos = append(checkedRepos, repo)
+				if repo == "dest" || (repo == "shared" && !sharedHasBlob) {
+					rw.WriteHeader(http.StatusNotFound)
+					return
+				}
+				rw.Header().Set("Content-Length", strconv.Itoa(len(blob)))
+				rw.WriteHeader(http.StatusOK)
+			case r.Method == http.MethodPost && r.URL.Path == "/v2/dest/blobs/uploads/" && r.URL.Query().Has("mount"):
+				mountedFrom = append(mountedFrom, r.URL.Query().Get("from"))
+				rw.WriteHeader(http.StatusCreated)
+			default:
+				require.FailNowf(t, "Unexpected request", "%v %v", r.Method, r.URL.Path)
+			}
+		}))
+		defer server.Close()
+		registryURL, err := url.Parse(server.URL)
+		require.NoError(t, err)
+		registry := registryURL.Host
+
+		sys := &types.SystemContext{
+			RegistriesDirPath:           "/this/does/not/exist",
+			DockerPerHostCertDirPath:    "/this/does/not/exist",
+			SystemRegistriesConfPath:    emptyRegistriesConf(t),
+			DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+			BlobMountFromRepositories: []string{
+				"this is not a valid reference",
+				"other-registry.example.com/shared", // Different registry
+				registry + "/shared:tagged",         // Not a repository
+				registry + "/dest",                  // The destination itself
+				registry + "/shared",
+			},
+		}
+		srcRef, err := ParseReference("//" + registry + "/src:latest")
+		require.NoError(t, err)
+		destRef, err := ParseReference("//" + registry + "/dest:latest")
+		require.NoError(t, err)
+
+		cache := blobinfocache.FromBlobInfoCache(memory.New())
+		cache.RecordDigestCompressorData(blobDigest, blobinfocache.DigestCompressorData{
+			BaseVariantCompressor:     compressiontypes.GzipAlgorithmName,
+			SpecificVariantCompressor: blobinfocache.UnknownCompression,
+		})
+		cache.RecordKnownLocation(srcRef.Transport(), bicTransportScope(srcRef.(dockerReference)), blobDigest, newBICLocationReference(srcRef.(dockerReference)))
+
+		dest, err := newImageDestination(sys, destRef.(dockerReference))
+		require.NoError(t, err)
+		defer dest.Close()
+		reused, reusedBlob, err := dest.TryReusingBlobWithOptions(context.Background(), types.BlobInfo{Digest: blobDigest, Size: int64(len(blob))}, private.TryReusingBlobOptions{
+			Cache:         cache,
+			CanSubstitute: true,
+		})
+		require.NoError(t, err)
+		assert.True(t, reused)
+		assert.Equal(t, blobDigest, reusedBlob.Digest)
+		assert.Equal(t, int64(len(blob)), reusedBlob.Size)
+		if sharedHasBlob {
+			assert.Equal(t, []string{"dest", "shared"}, checkedRepos)
+			assert.Equal(t, []string{"shared"}, mountedFrom)
+		} else {
+			assert.Equal(t, []string{"dest", "shared", "src"}, checkedRepos)
+			assert.Equal(t, []string{"src"}, mountedFrom)
+		}
+	}
+}
+
+func TestPutBlobChunked(t *testing.T) {
+	blob := []byte(strings.Repeat("0123456789", 3) + "01234")
+	blobDigest := digest.FromBytes(blob)
+
+	for _, c := range []struct {
+		name            string
+		chunkSize       int64
+		failChunk       int // If > 0, the registry stores only a part of this chunk (1-based), and fails the request
+		expectedPatches int // For every PutBlob call after the first one
+	}{
+		{name: "configured chunk size", chunkSize: 10, expectedPatches: 4},
+		{name: "fallback", chunkSize: 0, expectedPatches: 1},
+		{name: "resume", chunkSize: 10, failChunk: 2, expectedPatches: 4},
+	} {
+		var lock sync.Mutex
+		uploads := map[string][]byte{}
+		nextUpload := 0
+		rejectedUploads, patches, chunkFailures := 0, 0, 0
+		stored := map[digest.Digest][]byte{}
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			lock.Lock()
+			defer lock.Unlock()
+			const uploadsPrefix = "/v2/dest/blobs/uploads/"
+			id := strings.TrimPrefix(r.URL.Path, uploadsPrefix)
+			data, uploadExists := uploads[id]
+			switch {
+			case r.Method == http.MethodGet && r.URL.Path == "/v2/":
+				rw.WriteHeader(http.StatusOK)
+			case r.Method == http.MethodHead && r.URL.Path == "/v2/dest/blobs/"+blobDigest.String():
+				if _, ok := stored[blobDigest]; !ok {
+					rw.WriteHeader(http.StatusNotFound)
+					return
+				}
+				rw.Header().Set("Content-Length", strconv.Itoa(len(blob)))
+				rw.WriteHeader(http.StatusOK)
+			case r.Method == http.MethodPost && r.URL.Path == uploadsPrefix:
+				nextUpload++
+				id := strconv.Itoa(nextUpload)
+				uploads[id] = []byte{}
+				rw.Header().Set("Location", uploadsPrefix+id)
+				rw.WriteHeader(http.StatusAccepted)
+			case r.Method == http.MethodPatch && uploadExists:
+				// Only chunked uploads are accepted.
+				start, _, ok := strings.Cut(r.Header.Get("Content-Range"), "-")
+				if !ok || start != strconv.Itoa(len(data)) {
+					rejectedUploads++
+					rw.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+					return
+				}
+				patches++
+				body, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				if c.failChunk > 0 && patches == c.failChunk && chunkFailures == 0 {
+					chunkFailures++
+					uploads[id] = append(data, body[:len(body)/2]...)
+					rw.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				uploads[id] = append(data, body...)
+				rw.Header().Set("Location", uploadsPrefix+id)
+				rw.WriteHeader(http.StatusAccepted)
+			case r.Method == http.MethodGet && uploadExists:
+				if len(data) > 0 {
+					rw.Header().Set("Range", fmt.Sprintf("0-%d", len(data)-1))
+				}
+				rw.Header().Set("Location", uploadsPrefix+id)
+				rw.WriteHeader(http.StatusNoContent)
+			case r.Method == http.MethodPut && uploadExists:
+				d := digest.Digest(r.URL.Query().Get("digest"))
+				if d != digest.FromBytes(data) {
+					rw.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				stored[d] = data
+				delete(uploads, id)
+				rw.WriteHeader(http.StatusCreated)
+			default:
+				require.FailNowf(t, "Unexpected request", "%v %v", r.Method, r.URL.Path)
+			}
+		}))
+		defer server.Close()
+		registryURL, err := url.Parse(server.URL)
+		require.NoError(t, err)
+		registry := registryURL.Host
+
+		sys := &types.SystemContext{
+			RegistriesDirPath:           "/this/does/not/exist",
+			DockerPerHostCertDirPath:    "/this/does/not/exist",
+			SystemRegistriesConfPath:    emptyRegistriesConf(t),
+			DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+			DockerUploadChunkSize:       c.chunkSize,
+		}
+		destRef, err := ParseReference("//" + registry + "/dest:latest")
+		require.NoError(t, err)
+		dest, err := newImageDestination(sys, destRef.(dockerReference))
+		require.NoError(t, err)
+		defer dest.Close()
+
+		for i := 0; i < 2; i++ {
+			// The second upload must not be skipped as already present.
+			lock.Lock()
+			delete(stored, blobDigest)
+			patches = 0
+			lock.Unlock()
+			uploaded, err := dest.PutBlobWithOptions(context.Background(), bytes.NewReader(blob), types.BlobInfo{Size: -1}, private.PutBlobOptions{Cache: none.NoCache})
+			require.NoError(t, err, c.name)
+			assert.Equal(t, blobDigest, uploaded.Digest, c.name)
+			assert.Equal(t, int64(len(blob)), uploaded.Size, c.name)
+			assert.Equal(t, blob, stored[blobDigest], c.name)
+			if i > 0 {
+				assert.Equal(t, c.expectedPatches, patches, c.name)
+			}
+		}
+		if c.chunkSize == 0 {
+			// Only the first upload was attempted in a single request.
+			assert.Equal(t, 1, rejectedUploads, c.name)
+		} else {
+			assert.Equal(t, 0, rejectedUploads, c.name)
+		}
+		if c.failChunk > 0 {
+			assert.Equal(t, 1, chunkFailures, c.name)
+		}
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"sync"
 
 	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/imagesource"
 	"github.com/containers/image/v5/internal/imagesource/impl"
 	"github.com/containers/image/v5/internal/imagesource/stubs"
 	"github.com/containers/image/v5/internal/iolimits"
@@ -25,6 +26,7 @@ import (
 	"github.com/containers/image/v5/internal/signature"
 	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/pkg/docker/config"
 	"github.com/containers/image/v5/pkg/sysregistriesv2"
 	"github.com/containers/image/v5/types"
 	"github.com/containers/storage/pkg/regexp"
@@ -62,27 +64,12 @@ func newImageSource(ctx context.Context, sys *types.SystemContext, ref dockerRef
 	if err != nil {
 		return nil, err
 	}
-	registry, err := sysregistriesv2.FindRegistry(sys, ref.ref.Name())
-	if err != nil {
-		return nil, fmt.Errorf("loading registries configuration: %w", err)
-	}
-	if registry == nil {
-		// No configuration was found for the provided reference, so use the
-		// equivalent of a default configuration.
-		registry = &sysregistriesv2.Registry{
-			Endpoint: sysregistriesv2.Endpoint{
-				Location: ref.ref.String(),
-			},
-			Prefix: ref.ref.String(),
-		}
-	}
-
 	// Check all endpoints for the manifest availability. If we find one that does
 	// contain the image, it will be used for all future pull actions.  Always try the
 	// non-mirror original location last; this both transparently handles the case
 	// of no mirrors configured, and ensures we return the error encountered when
 	// accessing the upstream location if all endpoints fail.
-	pullSources, err := registry.PullSourcesFromReference(ref.ref)
+	pullSources, err := pullSourcesForReference(sys, ref)
 	if err != nil {
 		return nil, err
 	}
@@ -125,16 +112,30 @@ func newImageSource(ctx context.Context, sys *types.SystemContext, ref dockerRef
 	}
 }
 
-// newImageSourceAttempt is an internal helper for newImageSource. Everyone else must call newImageSource.
-// Given a logicalReference and a pullSource, return a dockerImageSource if it is reachable.
-// The caller must call .Close() on the returned ImageSource.
-func newImageSourceAttempt(ctx context.Context, sys *types.SystemContext, logicalRef dockerReference, pullSource sysregistriesv2.PullSource,
-	registryConfig *registryConfiguration) (*dockerImageSource, error) {
-	physicalRef, err := newReference(pullSource.Reference, false)
+// pullSourcesForReference returns the endpoints to try when pulling ref, in order, with the primary location last.
+func pullSourcesForReference(sys *types.SystemContext, ref dockerReference) ([]sysregistriesv2.PullSource, error) {
+	registry, err := sysregistriesv2.FindRegistry(sys, ref.ref.Name())
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("loading registries configuration: %w", err)
 	}
+	if registry == nil {
+		// No configuration was found for the provided reference, so use the
+		// equivalent of a default configuration.
+		registry = &sysregistriesv2.Registry{
+			Endpoint: sysregistriesv2.Endpoint{
+				Location: ref.ref.String(),
+			},
+			Prefix: ref.ref.String(),
+		}
+	}
+	return registry.PullSourcesFromReference(ref.ref)
+}
 
+// newPullSourceClient returns a dockerClient for pulling physicalRef, the reference of pullSource, on behalf of logicalRef,
+// configured as specified for pullSource.Endpoint, and the SystemContext to use for that endpoint.
+// The caller must call .Close() on the returned client.
+func newPullSourceClient(sys *types.SystemContext, logicalRef, physicalRef dockerReference, pullSource sysregistriesv2.PullSource,
+	registryConfig *registryConfiguration) (*dockerClient, *types.SystemContext, error) {
 	endpointSys := sys
 	// sys.DockerAuthConfig does not explicitly specify a registry; we must not blindly send the credentials intended for the primary endpoint to mirrors.
 	if endpointSys != nil && endpointSys.DockerAuthConfig != nil && reference.Domain(physicalRef.ref) != reference.Domain(logicalRef.ref) {
@@ -146,9 +147,47 @@ func newImageSourceAttempt(ctx context.Context, sys *types.SystemContext, logica
 
 	client, err := newDockerClientFromRef(endpointSys, physicalRef, registryConfig, false, "pull")
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	client.tlsClientConfig.InsecureSkipVerify = pullSource.Endpoint.Insecure
+	client.registryHeaders = pullSource.Endpoint.Headers
+	client.pathPrefix = pullSource.Endpoint.PathPrefix
+	client.proxy, err = pullSource.Endpoint.ProxyFunc()
+	if err != nil {
+		client.Close()
+		return nil, nil, err
+	}
+	if pullSource.Endpoint.AuthKey != "" {
+		// The mirror is configured to use credentials stored under a specific key, instead of the ones for physicalRef.
+		// sysregistriesv2 validates this, but be extra careful not to send credentials for some other registry to the mirror.
+		if !pullSource.Endpoint.AuthKeyMatchesHost(reference.Domain(physicalRef.ref)) {
+			client.Close()
+			return nil, nil, fmt.Errorf("credential key %q does not match mirror %q", pullSource.Endpoint.AuthKey, reference.Domain(physicalRef.ref))
+		}
+		auth, err := config.GetCredentials(endpointSys, pullSource.Endpoint.AuthKey)
+		if err != nil {
+			client.Close()
+			return nil, nil, fmt.Errorf("getting username and password for %q: %w", pullSource.Endpoint.AuthKey, err)
+		}
+		client.auth = auth
+	}
+	return client, endpointSys, nil
+}
+
+// newImageSourceAttempt is an internal helper for newImageSource. Everyone else must call newImageSource.
+// Given a logicalReference and a pullSource, return a dockerImageSource if it is reachable.
+// The caller must call .Close() on the returned ImageSource.
+func newImageSourceAttempt(ctx context.Context, sys *types.SystemContext, logicalRef dockerReference, pullSource sysregistriesv2.PullSource,
+	registryConfig *registryConfiguration) (*dockerImageSource, error) {
+	physicalRef, err := newReference(pullSource.Reference, false)
+	if err != nil {
+		return nil, err
+	}
+
+	client, endpointSys, err := newPullSourceClient(sys, logicalRef, physicalRef, pullSource, registryConfig)
+	if err != nil {
+		return nil, err
+	}
 
 	s := &dockerImageSource{
 		PropertyMethodsInitialize: impl.PropertyMethods(impl.Properties{
@@ -485,6 +524,58 @@ func (s *dockerImageSource) GetSignaturesWithFormat(ctx context.Context, instanc
 	return res, nil
 }
 
+// GetSignaturesMetadata returns metadata of the image's signatures, in the same order as GetSignaturesWithFormat.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to describe signatures for
+// (when the primary manifest is a manifest list); this never happens if the primary manifest is not a manifest list
+// (e.g. if the source never returns manifest lists).
+//
+// Sigstore attachments are described using their manifest, without fetching their contents;
+// signatures from the X-Registry-Supports-Signatures API extension or from lookaside are fetched in full.
+func (s *dockerImageSource) GetSignaturesMetadata(ctx context.Context, instanceDigest *digest.Digest) ([]private.SignatureMetadata, error) {
+	if err := s.c.detectProperties(ctx); err != nil {
+		return nil, err
+	}
+	var sigs []signature.Signature
+	switch {
+	case s.c.supportsSignatures:
+		if err := s.appendSignaturesFromAPIExtension(ctx, &sigs, instanceDigest); err != nil {
+			return nil, err
+		}
+	case s.c.signatureBase != nil:
+		if err := s.appendSignaturesFromLookaside(ctx, &sigs, instanceDigest); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("Internal error: X-Registry-Supports-Signatures extension not supported, and lookaside should not be empty configuration")
+	}
+	res, err := imagesource.MetadataOfSignatures(sigs)
+	if err != nil {
+		return nil, err
+	}
+
+	if !s.c.useSigstoreAttachments {
+		logrus.Debugf("Not looking for sigstore attachments: disabled by configuration")
+		return res, nil
+	}
+	manifestDigest, err := s.manifestDigest(ctx, instanceDigest)
+	if err != nil {
+		return nil, err
+	}
+	ociManifest, err := s.c.getSigstoreAttachmentManifest(ctx, s.physicalRef, manifestDigest)
+	if err != nil {
+		return nil, err
+	}
+	if ociManifest != nil {
+		for _, layer := range ociManifest.Layers {
+			res = append(res, private.SignatureMetadata{
+				Format: string(signature.SigstoreFormat),
+				Size:   layer.Size,
+			})
+		}
+	}
+	return res, nil
+}
+
 // manifestDigest returns a digest of the manifest, from instanceDigest if non-nil; or from the supplied reference,
 // or finally, from a fetched manifest.
 func (s *dockerImageSource) manifestDigest(ctx context.Context, instanceDigest *digest.Digest) (digest.Digest, error) {
@@ -680,7 +771,7 @@ func deleteImage(ctx context.Context, sys *types.SystemContext, ref dockerRefere
 	defer c.Close()
 
 	headers := map[string][]string{
-		"Accept": manifest.DefaultRequestedManifestMIMETypes,
+		"Accept": c.manifestAcceptTypes,
 	}
 	refTail, err := ref.tagOrDigest()
 	if err != nil {
@@ -699,7 +790,7 @@ func deleteImage(ctx context.Context, sys *types.SystemContext, ref dockerRefere
 	default:
 		return fmt.Errorf("deleting %v: %w", ref.ref, registryHTTPResponseToError(get))
 	}
-	manifestBody, err := iolimits.ReadAtMost(get.Body, iolimits.MaxManifestBodySize)
+	manifestBody, err := iolimits.ReadAtMost(get.Body, iolimits.ManifestSizeLimit(c.sys))
 	if err != nil {
 		return err
 	}
@@ -3,16 +3,20 @@ package docker
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"testing"
 
 	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/pkg/sysregistriesv2"
 	"github.com/containers/image/v5/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -84,6 +88,92 @@ location = "@REGISTRY@/with-mirror"
 	}
 }
 
+func TestDockerImageSourceMirrorAuthKey(t *testing.T) {
+	manifestPathRegex := regexp.MustCompile("^/v2/.*/manifests/latest$")
+	manifestAuth := map[string]string{} // Indexed by path
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/":
+			rw.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			rw.WriteHeader(http.StatusUnauthorized)
+		case r.Method == http.MethodGet && manifestPathRegex.MatchString(r.URL.Path):
+			user, _, ok := r.BasicAuth()
+			require.True(t, ok, r.URL.Path)
+			manifestAuth[r.URL.Path] = user
+			rw.WriteHeader(http.StatusOK)
+			// Empty body is good enough for this test
+		default:
+			require.FailNowf(t, "Unexpected request", "%v %v", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+	registryURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	registry := registryURL.Host
+
+	mirrorConfiguration := strings.ReplaceAll(
+		`[[registry]]
+location = "with-auth-key.example.com"
+
+[[registry.mirror]]
+location = "@REGISTRY@/with-auth-key"
+auth-key = "@REGISTRY@/shared-credentials"
+
+[[registry]]
+location = "without-auth-key.example.com"
+
+[[registry.mirror]]
+location = "@REGISTRY@/without-auth-key"
+`, "@REGISTRY@", registry)
+	tmpDir := t.TempDir()
+	registriesConf := filepath.Join(tmpDir, "registries.conf")
+	err = os.WriteFile(registriesConf, []byte(mirrorConfiguration), 0o600)
+	require.NoError(t, err)
+	authFile := filepath.Join(tmpDir, "auth.json")
+	authFileContents := fmt.Sprintf(`{"auths":{"%s":{"auth":"%s"},"%s":{"auth":"%s"},"%s":{"auth":"%s"}}}`,
+		registry, base64.StdEncoding.EncodeToString([]byte("mirror-default:password")),
+		registry+"/shared-credentials", base64.StdEncoding.EncodeToString([]byte("mirror-specific:password")),
+		"with-auth-key.example.com", base64.StdEncoding.EncodeToString([]byte("primary:password")))
+	err = os.WriteFile(authFile, []byte(authFileContents), 0o600)
+	require.NoError(t, err)
+
+	for _, c := range []struct{ input, physicalPath, user string }{
+		{"with-auth-key.example.com/busybox:latest", "/v2/with-auth-key/busybox/manifests/latest", "mirror-specific"},
+		{"without-auth-key.example.com/busybox:latest", "/v2/without-auth-key/busybox/manifests/latest", "mirror-default"},
+	} {
+		ref, err := ParseReference("//" + c.input)
+		require.NoError(t, err, c.input)
+		src, err := ref.NewImageSource(context.Background(), &types.SystemContext{
+			RegistriesDirPath:           "/this/does/not/exist",
+			DockerPerHostCertDirPath:    "/this/does/not/exist",
+			SystemRegistriesConfPath:    registriesConf,
+			SystemRegistriesConfDirPath: "/this/does/not/exist",
+			AuthFilePath:                authFile,
+			DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+		})
+		require.NoError(t, err, c.input)
+		defer src.Close()
+		assert.Equal(t, c.user, manifestAuth[c.physicalPath], c.input)
+	}
+
+	// Credentials for a different registry are never used for the mirror, even if the configuration is not validated.
+	sys := &types.SystemContext{
+		RegistriesDirPath:        "/this/does/not/exist",
+		DockerPerHostCertDirPath: "/this/does/not/exist",
+		AuthFilePath:             authFile,
+	}
+	registryConfig, err := loadRegistryConfiguration(sys)
+	require.NoError(t, err)
+	logicalRef, err := ParseReference("//with-auth-key.example.com/busybox:latest")
+	require.NoError(t, err)
+	physicalRef, err := ParseReference("//" + registry + "/with-auth-key/busybox:latest")
+	require.NoError(t, err)
+	_, _, err = newPullSourceClient(sys, logicalRef.(dockerReference), physicalRef.(dockerReference), sysregistriesv2.PullSource{
+		Endpoint: sysregistriesv2.Endpoint{Location: registry + "/with-auth-key", AuthKey: "with-auth-key.example.com"},
+	}, registryConfig)
+	assert.ErrorContains(t, err, "does not match mirror")
+}
+
 func TestSimplifyContentType(t *testing.T) {
 	for _, c := range []struct{ input, expected string }{
 		{"", ""},
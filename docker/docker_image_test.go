@@ -0,0 +1,611 @@
+package docker
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// emptyRegistriesConf returns the path of an empty registries.conf file, for tests which need the default registry configuration.
+// (An explicitly configured registries.conf file which does not exist is an error.)
+func emptyRegistriesConf(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "registries.conf")
+	err := os.WriteFile(path, []byte{}, 0o600)
+	require.NoError(t, err)
+	return path
+}
+
+func TestGetDigest(t *testing.T) {
+	manifestBlob := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{},"layers":[]}`)
+	manifestDigest := digest.FromBytes(manifestBlob)
+	headerDigest := digest.FromString("header digest")
+	manifestGETs := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/":
+			rw.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodHead && r.URL.Path == "/v2/repo/manifests/with-header":
+			rw.Header().Set("Docker-Content-Digest", headerDigest.String())
+			rw.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodHead && r.URL.Path == "/v2/repo/manifests/without-header":
+			rw.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/repo/manifests/without-header":
+			manifestGETs++
+			rw.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+			rw.WriteHeader(http.StatusOK)
+			_, err := rw.Write(manifestBlob)
+			require.NoError(t, err)
+		case r.Method == http.MethodHead && r.URL.Path == "/v2/repo/manifests/missing":
+			rw.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodHead && r.URL.Path == "/v2/repo/manifests/server-error":
+			rw.WriteHeader(http.StatusInternalServerError)
+		default:
+			require.FailNowf(t, "Unexpected request", "%v %v", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+	registryURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	registry := registryURL.Host
+
+	sys := &types.SystemContext{
+		RegistriesDirPath:           "/this/does/not/exist",
+		DockerPerHostCertDirPath:    "/this/does/not/exist",
+		SystemRegistriesConfPath:    emptyRegistriesConf(t),
+		DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+	}
+	getDigest := func(tag string) (digest.Digest, error) {
+		ref, err := ParseReference("//" + registry + "/repo:" + tag)
+		require.NoError(t, err)
+		return GetDigest(context.Background(), sys, ref)
+	}
+
+	// The digest is taken from the header, without downloading the manifest
+	d, err := getDigest("with-header")
+	require.NoError(t, err)
+	assert.Equal(t, headerDigest, d)
+	assert.Equal(t, 0, manifestGETs)
+
+	// Without the header, the manifest is downloaded and digested
+	d, err = getDigest("without-header")
+	require.NoError(t, err)
+	assert.Equal(t, manifestDigest, d)
+	assert.Equal(t, 1, manifestGETs)
+
+	// A missing manifest is reported with a specific error type
+	_, err = getDigest("missing")
+	var notFound ErrManifestNotFound
+	assert.True(t, errors.As(err, &notFound))
+
+	// Other errors are not
+	_, err = getDigest("server-error")
+	require.Error(t, err)
+	assert.False(t, errors.As(err, &notFound))
+}
+
+func TestResolveTag(t *testing.T) {
+	manifest1 := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{},"layers":[]}`)
+	manifest2 := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{},"layers":[],"annotations":{"v":"2"}}`)
+	digest1 := digest.FromBytes(manifest1)
+	digest2 := digest.FromBytes(manifest2)
+	manifests := map[digest.Digest][]byte{digest1: manifest1, digest2: manifest2}
+	tagTarget := digest1
+	manifestRequests := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/":
+			rw.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v2/repo/manifests/"):
+			manifestRequests++
+			tagOrDigest := strings.TrimPrefix(r.URL.Path, "/v2/repo/manifests/")
+			d := digest.Digest(tagOrDigest)
+			if tagOrDigest == "latest" {
+				d = tagTarget
+			}
+			m, ok := manifests[d]
+			if !ok {
+				rw.WriteHeader(http.StatusNotFound)
+				return
+			}
+			rw.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+			rw.WriteHeader(http.StatusOK)
+			_, err := rw.Write(m)
+			require.NoError(t, err)
+		default:
+			require.FailNowf(t, "Unexpected request", "%v %v", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+	registryURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	registry := registryURL.Host
+
+	sys := &types.SystemContext{
+		RegistriesDirPath:           "/this/does/not/exist",
+		DockerPerHostCertDirPath:    "/this/does/not/exist",
+		SystemRegistriesConfPath:    emptyRegistriesConf(t),
+		DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+	}
+	ref, err := ParseReference("//" + registry + "/repo:latest")
+	require.NoError(t, err)
+
+	// The manifest and its digest are returned with a single request
+	res, err := ResolveTag(context.Background(), sys, ref, "")
+	require.NoError(t, err)
+	assert.Equal(t, 1, manifestRequests)
+	assert.Equal(t, manifest1, res.Manifest)
+	assert.Equal(t, "application/vnd.oci.image.manifest.v1+json", res.ManifestMIMEType)
+	assert.Equal(t, digest1, res.Digest)
+	assert.Equal(t, "//"+registry+"/repo@"+digest1.String(), res.DigestReference.StringWithinTransport())
+
+	// The tag still refers to the recorded digest
+	res, err = ResolveTag(context.Background(), sys, ref, digest1)
+	require.NoError(t, err)
+	assert.Equal(t, digest1, res.Digest)
+
+	// The tag was moved
+	tagTarget = digest2
+	_, err = ResolveTag(context.Background(), sys, ref, digest1)
+	var changed ErrTagDigestChanged
+	require.True(t, errors.As(err, &changed))
+	assert.Equal(t, digest1, changed.Expected)
+	assert.Equal(t, digest2, changed.Actual)
+	res, err = ResolveTag(context.Background(), sys, ref, digest2)
+	require.NoError(t, err)
+	assert.Equal(t, manifest2, res.Manifest)
+
+	// Pulling using the pinned reference still returns the original manifest
+	pinnedRef, err := ParseReference("//" + registry + "/repo@" + digest1.String())
+	require.NoError(t, err)
+	res, err = ResolveTag(context.Background(), sys, pinnedRef, digest1)
+	require.NoError(t, err)
+	assert.Equal(t, manifest1, res.Manifest)
+	_, err = ResolveTag(context.Background(), sys, pinnedRef, digest2)
+	assert.True(t, errors.As(err, &changed))
+
+	// Invalid expected digests are rejected
+	_, err = ResolveTag(context.Background(), sys, ref, "this is not a digest")
+	assert.Error(t, err)
+}
+
+func TestGetRepositoryTags(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/":
+			rw.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/repo/tags/list":
+			var body string
+			switch r.URL.Query().Get("last") {
+			case "":
+				rw.Header().Set("Link", `</v2/repo/tags/list?n=2&last=b>; rel="next"`)
+				body = `{"name":"repo","tags":["a","b"]}`
+			case "b":
+				rw.Header().Set("Link", `</v2/repo/tags/list?n=2&last=d>; rel="next"`)
+				body = `{"name":"repo","tags":["c","d"]}`
+			case "d":
+				body = `{"name":"repo","tags":["e"]}`
+			default:
+				require.FailNowf(t, "Unexpected pagination", "%v", r.URL)
+			}
+			rw.Header().Set("Content-Type", "application/json")
+			rw.WriteHeader(http.StatusOK)
+			_, err := rw.Write([]byte(body))
+			require.NoError(t, err)
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/missing/tags/list":
+			rw.Header().Set("Content-Type", "application/json")
+			rw.WriteHeader(http.StatusNotFound)
+			_, err := rw.Write([]byte(`{"errors":[{"code":"NAME_UNKNOWN","message":"repository name not known to registry"}]}`))
+			require.NoError(t, err)
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/unauthorized/tags/list":
+			rw.Header().Set("Content-Type", "application/json")
+			rw.WriteHeader(http.StatusUnauthorized)
+			_, err := rw.Write([]byte(`{"errors":[{"code":"UNAUTHORIZED","message":"authentication required"}]}`))
+			require.NoError(t, err)
+		default:
+			require.FailNowf(t, "Unexpected request", "%v %v", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+	registryURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	registry := registryURL.Host
+
+	sys := &types.SystemContext{
+		RegistriesDirPath:           "/this/does/not/exist",
+		DockerPerHostCertDirPath:    "/this/does/not/exist",
+		SystemRegistriesConfPath:    emptyRegistriesConf(t),
+		DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+		AuthFilePath:                "/this/does/not/exist",
+		AuthFilePathOnly:            true,
+	}
+	getTags := func(sys *types.SystemContext, repo string) ([]string, error) {
+		ref, err := ParseReference("//" + registry + "/" + repo)
+		require.NoError(t, err)
+		return GetRepositoryTags(context.Background(), sys, ref)
+	}
+
+	// All pages are read
+	tags, err := getTags(sys, "repo")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, tags)
+
+	// A missing repository
+	_, err = getTags(sys, "missing")
+	var notFound ErrRepositoryNotFound
+	assert.True(t, errors.As(err, &notFound))
+
+	// Refused anonymous access does not mean that any credentials are invalid
+	_, err = getTags(sys, "unauthorized")
+	require.Error(t, err)
+	var unauthorized ErrUnauthorizedForCredentials
+	assert.False(t, errors.As(err, &unauthorized))
+	assert.False(t, errors.As(err, &notFound))
+
+	// Rejected credentials
+	credsSys := *sys
+	credsSys.DockerAuthConfig = &types.DockerAuthConfig{Username: "user", Password: "pass"}
+	_, err = getTags(&credsSys, "unauthorized")
+	assert.True(t, errors.As(err, &unauthorized))
+	assert.False(t, errors.As(err, &notFound))
+}
+
+func TestGetRepositoryTagsPathPrefix(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.RequestURI())
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/registry/v2/":
+			rw.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodGet && r.URL.Path == "/registry/v2/repo/tags/list":
+			var body string
+			switch r.URL.Query().Get("last") {
+			case "":
+				// An absolute path, which already includes the prefix
+				rw.Header().Set("Link", `</registry/v2/repo/tags/list?n=2&last=b>; rel="next"`)
+				body = `{"name":"repo","tags":["a","b"]}`
+			case "b":
+				// A path relative to the request URL
+				rw.Header().Set("Link", `<list?n=2&last=d>; rel="next"`)
+				body = `{"name":"repo","tags":["c","d"]}`
+			case "d":
+				body = `{"name":"repo","tags":["e"]}`
+			default:
+				require.FailNowf(t, "Unexpected pagination", "%v", r.URL)
+			}
+			rw.Header().Set("Content-Type", "application/json")
+			rw.WriteHeader(http.StatusOK)
+			_, err := rw.Write([]byte(body))
+			require.NoError(t, err)
+		case r.Method == http.MethodGet && r.URL.Path == "/registry/v2/elsewhere/tags/list":
+			rw.Header().Set("Link", `<http://registry.example.invalid/v2/elsewhere/tags/list?n=2&last=b>; rel="next"`)
+			rw.Header().Set("Content-Type", "application/json")
+			rw.WriteHeader(http.StatusOK)
+			_, err := rw.Write([]byte(`{"name":"elsewhere","tags":["a","b"]}`))
+			require.NoError(t, err)
+		default:
+			require.FailNowf(t, "Unexpected request", "%v %v", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+	registryURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	registry := registryURL.Host
+
+	confPath := filepath.Join(t.TempDir(), "registries.conf")
+	err = os.WriteFile(confPath, []byte(fmt.Sprintf("[[registry]]\nlocation = %q\npath-prefix = \"/registry\"\n", registry)), 0o600)
+	require.NoError(t, err)
+	sys := &types.SystemContext{
+		RegistriesDirPath:           "/this/does/not/exist",
+		DockerPerHostCertDirPath:    "/this/does/not/exist",
+		SystemRegistriesConfPath:    confPath,
+		SystemRegistriesConfDirPath: filepath.Join(t.TempDir(), "this-does-not-exist"),
+		DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+		AuthFilePath:                "/this/does/not/exist",
+		AuthFilePathOnly:            true,
+	}
+
+	ref, err := ParseReference("//" + registry + "/repo")
+	require.NoError(t, err)
+	tags, err := GetRepositoryTags(context.Background(), sys, ref)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, tags)
+	assert.Equal(t, []string{
+		"/registry/v2/",
+		"/registry/v2/repo/tags/list",
+		"/registry/v2/repo/tags/list?n=2&last=b",
+		"/registry/v2/repo/tags/list?n=2&last=d",
+	}, paths)
+
+	// Links to a different server are not followed
+	ref, err = ParseReference("//" + registry + "/elsewhere")
+	require.NoError(t, err)
+	_, err = GetRepositoryTags(context.Background(), sys, ref)
+	assert.Error(t, err)
+}
+
+func TestNextPageURL(t *testing.T) {
+	for _, c := range []struct {
+		requestURL, link, expected string // expected == "" means no next page
+		expectError                bool
+	}{
+		{"https://registry.example.com/v2/repo/tags/list", "", "", false},
+		{"https://registry.example.com/v2/repo/tags/list", `</v2/repo/tags/list?last=b>; rel="next"`, "https://registry.example.com/v2/repo/tags/list?last=b", false},
+		{"https://registry.example.com/v2/repo/tags/list", `<list?last=b>; rel="next"`, "https://registry.example.com/v2/repo/tags/list?last=b", false},
+		{"https://registry.example.com/v2/repo/tags/list", `<https://registry.example.com/v2/repo/tags/list?last=b>; rel="next"`, "https://registry.example.com/v2/repo/tags/list?last=b", false},
+		// http to https on the same host is allowed
+		{"http://registry.example.com/v2/repo/tags/list", `<https://registry.example.com/v2/repo/tags/list?last=b>; rel="next"`, "https://registry.example.com/v2/repo/tags/list?last=b", false},
+		// https to http is not
+		{"https://registry.example.com/v2/repo/tags/list", `<http://registry.example.com/v2/repo/tags/list?last=b>; rel="next"`, "", true},
+		// A different host or port is not allowed
+		{"https://registry.example.com/v2/repo/tags/list", `<https://other.example.com/v2/repo/tags/list?last=b>; rel="next"`, "", true},
+		{"http://registry.example.com/v2/repo/tags/list", `<https://other.example.com/v2/repo/tags/list?last=b>; rel="next"`, "", true},
+		{"https://registry.example.com/v2/repo/tags/list", `<https://registry.example.com:5000/v2/repo/tags/list?last=b>; rel="next"`, "", true},
+	} {
+		requestURL, err := url.Parse(c.requestURL)
+		require.NoError(t, err)
+		res := &http.Response{
+			Header:  http.Header{},
+			Request: &http.Request{URL: requestURL},
+		}
+		if c.link != "" {
+			res.Header.Set("Link", c.link)
+		}
+		nextURL, err := nextPageURL(res)
+		switch {
+		case c.expectError:
+			assert.Error(t, err, c.link)
+		case c.expected == "":
+			require.NoError(t, err, c.link)
+			assert.Nil(t, nextURL, c.link)
+		default:
+			require.NoError(t, err, c.link)
+			require.NotNil(t, nextURL, c.link)
+			assert.Equal(t, c.expected, nextURL.String(), c.link)
+		}
+	}
+}
+
+func TestGetRepositories(t *testing.T) {
+	catalogStatus := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/":
+			rw.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/_catalog" && catalogStatus != http.StatusOK:
+			rw.WriteHeader(catalogStatus)
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/_catalog":
+			var body string
+			switch r.URL.Query().Get("last") {
+			case "":
+				rw.Header().Set("Link", `</v2/_catalog?last=b&n=2>; rel="next"`)
+				body = `{"repositories":["a","b"]}`
+			case "b":
+				rw.Header().Set("Link", `</v2/_catalog?last=ns%2Fd&n=2>; rel="next"`)
+				body = `{"repositories":["c","ns/d"]}`
+			case "ns/d":
+				body = `{"repositories":["e"]}`
+			default:
+				require.FailNowf(t, "Unexpected page", "%v", r.URL.String())
+			}
+			rw.WriteHeader(http.StatusOK)
+			_, err := rw.Write([]byte(body))
+			require.NoError(t, err)
+		default:
+			require.FailNowf(t, "Unexpected request", "%v %v", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+	registryURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	registry := registryURL.Host
+
+	sys := &types.SystemContext{
+		RegistriesDirPath:           "/this/does/not/exist",
+		DockerPerHostCertDirPath:    "/this/does/not/exist",
+		SystemRegistriesConfPath:    emptyRegistriesConf(t),
+		DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+		AuthFilePath:                "/this/does/not/exist",
+		AuthFilePathOnly:            true,
+	}
+	credsSys := *sys
+	credsSys.DockerAuthConfig = &types.DockerAuthConfig{Username: "user", Password: "pass"}
+
+	// All pages are read
+	repos := []string{}
+	GetRepositories(context.Background(), sys, registry)(func(repo string, err error) bool {
+		require.NoError(t, err)
+		repos = append(repos, repo)
+		return true
+	})
+	assert.Equal(t, []string{"a", "b", "c", "ns/d", "e"}, repos)
+
+	// Stopping the iteration early does not read further pages
+	repos = []string{}
+	GetRepositories(context.Background(), sys, registry)(func(repo string, err error) bool {
+		require.NoError(t, err)
+		repos = append(repos, repo)
+		return len(repos) < 2
+	})
+	assert.Equal(t, []string{"a", "b"}, repos)
+
+	// Errors
+	for _, c := range []struct {
+		status      int
+		sys         *types.SystemContext
+		checkErrors func(t *testing.T, err error)
+	}{
+		{http.StatusNotFound, sys, func(t *testing.T, err error) {
+			var e ErrCatalogNotSupported
+			assert.True(t, errors.As(err, &e))
+		}},
+		{http.StatusMethodNotAllowed, sys, func(t *testing.T, err error) {
+			var e ErrCatalogNotSupported
+			assert.True(t, errors.As(err, &e))
+		}},
+		{http.StatusUnauthorized, sys, func(t *testing.T, err error) {
+			var e ErrUnauthorizedForCredentials
+			assert.False(t, errors.As(err, &e))
+		}},
+		{http.StatusUnauthorized, &credsSys, func(t *testing.T, err error) {
+			var e ErrUnauthorizedForCredentials
+			assert.True(t, errors.As(err, &e))
+		}},
+		{http.StatusInternalServerError, sys, func(t *testing.T, err error) {
+			var e ErrCatalogNotSupported
+			assert.False(t, errors.As(err, &e))
+		}},
+	} {
+		catalogStatus = c.status
+		var errs []error
+		GetRepositories(context.Background(), c.sys, registry)(func(repo string, err error) bool {
+			assert.Equal(t, "", repo)
+			errs = append(errs, err)
+			return true
+		})
+		require.Len(t, errs, 1, c.status)
+		require.Error(t, errs[0], c.status)
+		c.checkErrors(t, errs[0])
+	}
+}
+
+func TestCheckPullSources(t *testing.T) {
+	newRegistry := func(status int) string {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet || r.URL.Path != "/v2/" { // No image data should be read
+				rw.WriteHeader(http.StatusNotFound)
+				t.Errorf("Unexpected request %v %v", r.Method, r.URL.Path)
+				return
+			}
+			rw.WriteHeader(status)
+		}))
+		t.Cleanup(server.Close)
+		registryURL, err := url.Parse(server.URL)
+		require.NoError(t, err)
+		return registryURL.Host
+	}
+	healthy := newRegistry(http.StatusOK)
+	unauthorized := newRegistry(http.StatusUnauthorized)
+	closedServer := httptest.NewServer(http.NotFoundHandler())
+	closedServer.Close()
+	closedURL, err := url.Parse(closedServer.URL)
+	require.NoError(t, err)
+	unreachable := closedURL.Host
+
+	confPath := filepath.Join(t.TempDir(), "registries.conf")
+	err = os.WriteFile(confPath, []byte(fmt.Sprintf(`[[registry]]
+location = %q
+insecure = true
+[[registry.mirror]]
+location = %q
+insecure = true
+[[registry.mirror]]
+location = %q
+insecure = true
+[[registry.mirror]]
+location = %q
+`, unreachable, healthy+"/healthy", unauthorized+"/unauthorized", healthy+"/tls")), 0o600)
+	require.NoError(t, err)
+	sys := &types.SystemContext{
+		RegistriesDirPath:           "/this/does/not/exist",
+		DockerPerHostCertDirPath:    "/this/does/not/exist",
+		SystemRegistriesConfPath:    confPath,
+		SystemRegistriesConfDirPath: "/this/does/not/exist",
+		AuthFilePath:                "/this/does/not/exist",
+		AuthFilePathOnly:            true,
+	}
+	ref, err := ParseReference("//" + unreachable + "/repo:tag")
+	require.NoError(t, err)
+
+	statuses, err := CheckPullSources(context.Background(), sys, ref)
+	require.NoError(t, err)
+	require.Len(t, statuses, 4)
+	for i, c := range []struct {
+		reference  string
+		reachable  bool
+		authorized bool
+	}{
+		{healthy + "/healthy/repo:tag", true, true},
+		{unauthorized + "/unauthorized/repo:tag", true, false},
+		{healthy + "/tls/repo:tag", false, false}, // insecure is not set, so the plain-HTTP server can't be used
+		{unreachable + "/repo:tag", false, false},
+	} {
+		s := statuses[i]
+		assert.Equal(t, c.reference, s.Reference.String(), c.reference)
+		assert.Equal(t, c.reachable, s.Reachable, c.reference)
+		assert.Equal(t, c.authorized, s.Authorized, c.reference)
+		if c.authorized {
+			assert.NoError(t, s.Err, c.reference)
+		} else {
+			assert.Error(t, s.Err, c.reference)
+		}
+	}
+	// Refused anonymous access does not mean that any credentials are invalid
+	var e ErrUnauthorizedForCredentials
+	assert.False(t, errors.As(statuses[1].Err, &e))
+	assert.True(t, statuses[0].Endpoint.Insecure)
+	assert.False(t, statuses[2].Endpoint.Insecure)
+
+	// Rejected credentials
+	authFilePath := filepath.Join(t.TempDir(), "auth.json")
+	err = os.WriteFile(authFilePath, []byte(fmt.Sprintf(`{"auths":{%q:{"auth":%q}}}`,
+		unauthorized, base64.StdEncoding.EncodeToString([]byte("user:pass")))), 0o600)
+	require.NoError(t, err)
+	credsSys := *sys
+	credsSys.AuthFilePath = authFilePath
+	statuses, err = CheckPullSources(context.Background(), &credsSys, ref)
+	require.NoError(t, err)
+	require.Len(t, statuses, 4)
+	assert.True(t, errors.As(statuses[1].Err, &e))
+
+	// Non-docker references are rejected
+	_, err = CheckPullSources(context.Background(), sys, nil)
+	assert.Error(t, err)
+
+	// An unresponsive endpoint does not affect the others
+	hangingServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer hangingServer.Close()
+	hangingURL, err := url.Parse(hangingServer.URL)
+	require.NoError(t, err)
+	hanging := hangingURL.Host
+	hangingConfPath := filepath.Join(t.TempDir(), "registries.conf")
+	err = os.WriteFile(hangingConfPath, []byte(fmt.Sprintf(`[[registry]]
+location = %q
+insecure = true
+[[registry.mirror]]
+location = %q
+insecure = true
+`, healthy, hanging)), 0o600)
+	require.NoError(t, err)
+	hangingSys := *sys
+	hangingSys.SystemRegistriesConfPath = hangingConfPath
+	ref, err = ParseReference("//" + healthy + "/repo:tag")
+	require.NoError(t, err)
+	statuses, err = checkPullSources(context.Background(), &hangingSys, ref, 500*time.Millisecond)
+	require.NoError(t, err)
+	require.Len(t, statuses, 2)
+	assert.Equal(t, hanging+"/repo:tag", statuses[0].Reference.String())
+	assert.False(t, statuses[0].Reachable)
+	assert.ErrorIs(t, statuses[0].Err, context.DeadlineExceeded)
+	assert.Equal(t, healthy+"/repo:tag", statuses[1].Reference.String())
+	assert.True(t, statuses[1].Reachable)
+	assert.True(t, statuses[1].Authorized)
+	assert.NoError(t, statuses[1].Err)
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 
 	"github.com/docker/distribution/registry/api/errcode"
+	digest "github.com/opencontainers/go-digest"
 	"github.com/sirupsen/logrus"
 )
 
@@ -16,6 +17,8 @@ var (
 	ErrV1NotSupported = errors.New("can't talk to a V1 container registry")
 	// ErrTooManyRequests is returned when the status code returned is 429
 	ErrTooManyRequests = errors.New("too many requests to registry")
+	// ErrNoSBOM is returned by GetSBOM if no SBOM refers to the image.
+	ErrNoSBOM = errors.New("no SBOM refers to the image")
 )
 
 // ErrUnauthorizedForCredentials is returned when the status code returned is 401
@@ -27,6 +30,57 @@ func (e ErrUnauthorizedForCredentials) Error() string {
 	return fmt.Sprintf("unable to retrieve auth token: invalid username/password: %s", e.Err.Error())
 }
 
+// ErrManifestNotFound is returned by GetDigest when the registry reports that the requested manifest does not exist (status code 404)
+type ErrManifestNotFound struct { // We only use a struct to allow a type assertion, without limiting the contents of the error otherwise.
+	Err error
+}
+
+func (e ErrManifestNotFound) Error() string {
+	return e.Err.Error()
+}
+
+func (e ErrManifestNotFound) Unwrap() error {
+	return e.Err
+}
+
+// ErrRepositoryNotFound is returned by GetRepositoryTags when the registry reports that the repository does not exist (status code 404)
+type ErrRepositoryNotFound struct { // We only use a struct to allow a type assertion, without limiting the contents of the error otherwise.
+	Err error
+}
+
+func (e ErrRepositoryNotFound) Error() string {
+	return e.Err.Error()
+}
+
+func (e ErrRepositoryNotFound) Unwrap() error {
+	return e.Err
+}
+
+// ErrCatalogNotSupported is returned by GetRepositories when the registry does not provide the catalog endpoint (status code 404 or 405)
+type ErrCatalogNotSupported struct { // We only use a struct to allow a type assertion, without limiting the contents of the error otherwise.
+	Err error
+}
+
+func (e ErrCatalogNotSupported) Error() string {
+	return e.Err.Error()
+}
+
+func (e ErrCatalogNotSupported) Unwrap() error {
+	return e.Err
+}
+
+// ErrTagDigestChanged is returned by ResolveTag when the manifest a reference refers to does not match the expected digest,
+// e.g. because a tag was moved to a different image.
+type ErrTagDigestChanged struct {
+	Reference string        // The resolved reference, as returned by types.ImageReference.StringWithinTransport()
+	Expected  digest.Digest // The expected digest
+	Actual    digest.Digest // The digest of the manifest the reference currently refers to
+}
+
+func (e ErrTagDigestChanged) Error() string {
+	return fmt.Sprintf("%s now refers to manifest %s, not the expected %s", e.Reference, e.Actual, e.Expected)
+}
+
 // httpResponseToError translates the https.Response into an error, possibly prefixing it with the supplied context. It returns
 // nil if the response is not considered an error.
 // NOTE: Almost all callers in this package should use registryHTTPResponseToError instead.
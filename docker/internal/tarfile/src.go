@@ -232,7 +232,9 @@ func (s *Source) GetManifest(ctx context.Context, instanceDigest *digest.Digest)
 				return nil, "", fmt.Errorf("Internal inconsistency: Information about layer %s missing", diffID)
 			}
 			m.LayersDescriptors = append(m.LayersDescriptors, manifest.Schema2Descriptor{
-				Digest:    diffID, // diffID is a digest of the uncompressed tarball
+				Digest: diffID, // diffID is a digest of the uncompressed tarball
+				// GetBlob decompresses layers stored compressed in the archive (using any format supported by compression.AutoDecompress,
+				// e.g. gzip or zstd), so the layers are always uncompressed.
 				MediaType: manifest.DockerV2Schema2LayerMediaType,
 				Size:      li.size,
 			})
@@ -1,15 +1,20 @@
 package tarfile
 
 import (
+	"archive/tar"
 	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
 	"io"
 	"strings"
 	"testing"
 
 	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/pkg/blobinfocache/memory"
+	"github.com/containers/image/v5/pkg/compression"
 	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -64,3 +69,100 @@ func TestSourcePrepareLayerData(t *testing.T) {
 		}
 	}
 }
+
+// tarWithFile returns a tar archive containing a single file with the specified name and contents.
+func tarWithFile(t *testing.T, name string, contents []byte) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(contents)), Typeflag: tar.TypeReg})
+	require.NoError(t, err)
+	_, err = tw.Write(contents)
+	require.NoError(t, err)
+	err = tw.Close()
+	require.NoError(t, err)
+	return buf.Bytes()
+}
+
+func TestSourceCompressedLayers(t *testing.T) {
+	ctx := context.Background()
+	cache := memory.New()
+
+	// Uncompressed layer contents, and the layers as stored in the archive
+	algos := []compression.Algorithm{compression.Gzip, compression.Zstd}
+	uncompressedLayers := [][]byte{}
+	storedLayers := [][]byte{}
+	diffIDs := []digest.Digest{}
+	for i, algo := range algos {
+		uncompressed := tarWithFile(t, fmt.Sprintf("file-%d", i), bytes.Repeat([]byte{byte(i)}, 1000))
+		var compressed bytes.Buffer
+		compressor, err := compression.CompressStream(&compressed, algo, nil)
+		require.NoError(t, err)
+		_, err = compressor.Write(uncompressed)
+		require.NoError(t, err)
+		err = compressor.Close()
+		require.NoError(t, err)
+		detectedAlgo, _, _, err := compression.DetectCompressionFormat(bytes.NewReader(compressed.Bytes()))
+		require.NoError(t, err)
+		require.Equal(t, algo.Name(), detectedAlgo.Name())
+
+		uncompressedLayers = append(uncompressedLayers, uncompressed)
+		storedLayers = append(storedLayers, compressed.Bytes())
+		diffIDs = append(diffIDs, digest.FromBytes(uncompressed))
+	}
+
+	// Build a docker-archive, as written by other tools, using compressed layer files.
+	config, err := json.Marshal(manifest.Schema2Image{
+		RootFS: &manifest.Schema2RootFS{Type: "layers", DiffIDs: diffIDs},
+	})
+	require.NoError(t, err)
+	archiveFiles := map[string][]byte{"config.json": config}
+	layerPaths := []string{}
+	for i, algo := range algos {
+		layerPath := fmt.Sprintf("layer-%d.tar.%s", i, algo.Name())
+		archiveFiles[layerPath] = storedLayers[i]
+		layerPaths = append(layerPaths, layerPath)
+	}
+	manifestJSON, err := json.Marshal([]ManifestItem{{
+		Config:   "config.json",
+		RepoTags: []string{"example.com/compressed:latest"},
+		Layers:   layerPaths,
+	}})
+	require.NoError(t, err)
+	archiveFiles[manifestFileName] = manifestJSON
+	var archiveBuffer bytes.Buffer
+	tw := tar.NewWriter(&archiveBuffer)
+	for _, name := range append([]string{manifestFileName, "config.json"}, layerPaths...) {
+		err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(archiveFiles[name])), Typeflag: tar.TypeReg})
+		require.NoError(t, err)
+		_, err = tw.Write(archiveFiles[name])
+		require.NoError(t, err)
+	}
+	err = tw.Close()
+	require.NoError(t, err)
+
+	reader, err := NewReaderFromStream(nil, &archiveBuffer)
+	require.NoError(t, err)
+	defer reader.Close()
+	src := NewSource(reader, false, "transport name", nil, -1)
+	defer src.Close()
+
+	// The generated manifest describes the uncompressed layers, which are what GetBlob returns.
+	manifestBlob, _, err := src.GetManifest(ctx, nil)
+	require.NoError(t, err)
+	m, err := manifest.Schema2FromManifest(manifestBlob)
+	require.NoError(t, err)
+	require.Len(t, m.LayersDescriptors, len(algos))
+	for i, layer := range m.LayersDescriptors {
+		assert.Equal(t, manifest.DockerV2Schema2LayerMediaType, layer.MediaType, algos[i].Name())
+		assert.Equal(t, diffIDs[i], layer.Digest, algos[i].Name())
+		assert.Equal(t, int64(len(uncompressedLayers[i])), layer.Size, algos[i].Name())
+
+		stream, _, err := src.GetBlob(ctx, types.BlobInfo{Digest: layer.Digest, Size: layer.Size}, cache)
+		require.NoError(t, err, algos[i].Name())
+		contents, err := io.ReadAll(stream)
+		require.NoError(t, err, algos[i].Name())
+		err = stream.Close()
+		require.NoError(t, err, algos[i].Name())
+		assert.Equal(t, uncompressedLayers[i], contents, algos[i].Name())
+	}
+}
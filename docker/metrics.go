@@ -0,0 +1,48 @@
+package docker
+
+import (
+	"io"
+
+	"github.com/containers/image/v5/types"
+)
+
+// noDockerMetrics is a types.DockerMetrics which ignores all counters.
+type noDockerMetrics struct{}
+
+func (noDockerMetrics) RequestCompleted(registry string, method string, statusCode int) {}
+func (noDockerMetrics) BytesDownloaded(registry string, n int64)                        {}
+func (noDockerMetrics) BytesUploaded(registry string, n int64)                          {}
+func (noDockerMetrics) RequestRetried(registry string)                                  {}
+func (noDockerMetrics) TokenRefreshed(registry string)                                  {}
+
+// metrics returns the types.DockerMetrics to inform about c's activity; it is never nil.
+func (c *dockerClient) metrics() types.DockerMetrics {
+	if c.sys != nil && c.sys.DockerMetrics != nil {
+		return c.sys.DockerMetrics
+	}
+	return noDockerMetrics{}
+}
+
+// metricsEnabled returns true if the caller has asked for metrics, i.e. if it is worth counting transferred data.
+func (c *dockerClient) metricsEnabled() bool {
+	return c.sys != nil && c.sys.DockerMetrics != nil
+}
+
+// countingReadCloser reports the data read from an io.ReadCloser to a types.DockerMetrics.
+type countingReadCloser struct {
+	source   io.ReadCloser
+	report   func(registry string, n int64) // types.DockerMetrics.BytesDownloaded or types.DockerMetrics.BytesUploaded
+	registry string
+}
+
+func (r *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := r.source.Read(p)
+	if n > 0 {
+		r.report(r.registry, int64(n))
+	}
+	return n, err
+}
+
+func (r *countingReadCloser) Close() error {
+	return r.source.Close()
+}
@@ -0,0 +1,150 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/containers/image/v5/pkg/blobinfocache/memory"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingDockerMetrics is a types.DockerMetrics which records all counters.
+type recordingDockerMetrics struct {
+	lock            sync.Mutex
+	registries      map[string]struct{}
+	requests        map[string]int // Key: "$method $statusCode"
+	bytesDownloaded int64
+	bytesUploaded   int64
+	retries         int
+	tokens          int
+}
+
+func newRecordingDockerMetrics() *recordingDockerMetrics {
+	return &recordingDockerMetrics{
+		registries: map[string]struct{}{},
+		requests:   map[string]int{},
+	}
+}
+
+func (m *recordingDockerMetrics) RequestCompleted(registry string, method string, statusCode int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.registries[registry] = struct{}{}
+	m.requests[fmt.Sprintf("%s %d", method, statusCode)]++
+}
+
+func (m *recordingDockerMetrics) BytesDownloaded(registry string, n int64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.registries[registry] = struct{}{}
+	m.bytesDownloaded += n
+}
+
+func (m *recordingDockerMetrics) BytesUploaded(registry string, n int64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.registries[registry] = struct{}{}
+	m.bytesUploaded += n
+}
+
+func (m *recordingDockerMetrics) RequestRetried(registry string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.registries[registry] = struct{}{}
+	m.retries++
+}
+
+func (m *recordingDockerMetrics) TokenRefreshed(registry string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.registries[registry] = struct{}{}
+	m.tokens++
+}
+
+func TestDockerMetrics(t *testing.T) {
+	const token = "test-token"
+	manifestBlob := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json"}`)
+	blob := []byte(strings.Repeat("blob contents", 1000))
+	blobDigest := digest.FromBytes(blob)
+	blobRequests := 0
+	var serverURL string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			_, err := w.Write([]byte(`{"token":"` + token + `"}`))
+			assert.NoError(t, err)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test-registry"`, serverURL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case "/v2/repo/manifests/latest":
+			w.Header().Set("Content-Type", imgspecv1.MediaTypeImageManifest)
+			_, err := w.Write(manifestBlob)
+			assert.NoError(t, err)
+		case "/v2/repo/blobs/" + blobDigest.String():
+			blobRequests++
+			if blobRequests == 1 {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			_, err := w.Write(blob)
+			assert.NoError(t, err)
+		default:
+			require.FailNowf(t, "Unexpected request", "%v %v", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+	serverURL = server.URL
+	registry := strings.TrimPrefix(server.URL, "http://")
+
+	metrics := newRecordingDockerMetrics()
+	sys := &types.SystemContext{
+		RegistriesDirPath:           "/this/does/not/exist",
+		DockerPerHostCertDirPath:    "/this/does/not/exist",
+		SystemRegistriesConfPath:    emptyRegistriesConf(t),
+		SystemRegistriesConfDirPath: "/this/does/not/exist",
+		DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+		DockerMetrics:               metrics,
+	}
+	ref, err := ParseReference("//" + registry + "/repo:latest")
+	require.NoError(t, err)
+	src, err := ref.NewImageSource(context.Background(), sys)
+	require.NoError(t, err)
+	defer src.Close()
+	m, _, err := src.GetManifest(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, manifestBlob, m)
+	reader, _, err := src.GetBlob(context.Background(), types.BlobInfo{Digest: blobDigest, Size: int64(len(blob))}, memory.New())
+	require.NoError(t, err)
+	contents, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	reader.Close()
+	assert.Equal(t, blob, contents)
+
+	metrics.lock.Lock()
+	defer metrics.lock.Unlock()
+	assert.Equal(t, map[string]struct{}{registry: {}}, metrics.registries)
+	assert.Equal(t, 1, metrics.requests["GET 401"]) // The ping
+	assert.Equal(t, 1, metrics.requests[fmt.Sprintf("GET %d", http.StatusTooManyRequests)])
+	assert.Equal(t, 2, metrics.requests["GET 200"]) // The manifest and the blob
+	assert.Equal(t, 1, metrics.retries)
+	assert.Equal(t, 1, metrics.tokens)
+	assert.GreaterOrEqual(t, metrics.bytesDownloaded, int64(len(manifestBlob)+len(blob)))
+	assert.Equal(t, int64(0), metrics.bytesUploaded)
+}
@@ -0,0 +1,235 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/iolimits"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// sbomArtifactTypes are the artifact types of SBOMs recognized by GetSBOM, in the order of preference.
+var sbomArtifactTypes = []string{
+	"application/spdx+json",
+	"application/vnd.cyclonedx+json",
+	"text/spdx",
+	"application/vnd.cyclonedx+xml",
+	"application/vnd.cyclonedx",
+	"application/vnd.syft+json",
+}
+
+// GetSBOM returns the contents and the artifact type (e.g. "application/spdx+json") of an SBOM artifact
+// which refers to the manifest of ref (using its subject field), as listed by the OCI referrers API,
+// or by the referrers tag schema if the registry does not support the API.
+// If there are several SBOMs, the SPDX and CycloneDX JSON formats are preferred.
+// If ref refers to a multi-platform image, only SBOMs referring to the manifest list itself are considered.
+//
+// If no SBOM refers to the image, ErrNoSBOM is returned.
+//
+// NOTE: As with GetDigest, mirror configuration is ignored.
+func GetSBOM(ctx context.Context, sys *types.SystemContext, ref types.ImageReference) ([]byte, string, error) {
+	dr, ok := ref.(dockerReference)
+	if !ok {
+		return nil, "", errors.New("ref must be a dockerReference")
+	}
+	if dr.isUnknownDigest {
+		return nil, "", fmt.Errorf("docker: reference %q is for unknown digest case; cannot read its SBOM", dr.StringWithinTransport())
+	}
+	tagOrDigest, err := dr.tagOrDigest()
+	if err != nil {
+		return nil, "", err
+	}
+
+	registryConfig, err := loadRegistryConfiguration(sys)
+	if err != nil {
+		return nil, "", err
+	}
+	client, err := newDockerClientFromRef(sys, dr, registryConfig, false, "pull")
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create client: %w", err)
+	}
+	defer client.Close()
+
+	var manifestDigest digest.Digest
+	if digested, ok := dr.ref.(reference.Canonical); ok {
+		manifestDigest = digested.Digest()
+	} else {
+		manblob, _, err := client.fetchManifest(ctx, dr, tagOrDigest)
+		if err != nil {
+			return nil, "", err
+		}
+		manifestDigest, err = manifest.Digest(manblob)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	referrers, err := client.getReferrers(ctx, dr, manifestDigest)
+	if err != nil {
+		return nil, "", err
+	}
+	var sbom *imgspecv1.Descriptor
+	for i := range referrers {
+		rank := slices.Index(sbomArtifactTypes, referrers[i].ArtifactType)
+		if rank != -1 && (sbom == nil || rank < slices.Index(sbomArtifactTypes, sbom.ArtifactType)) {
+			sbom = &referrers[i]
+		}
+	}
+	if sbom == nil {
+		return nil, "", fmt.Errorf("%s: %w", dr.ref.String(), ErrNoSBOM)
+	}
+
+	contents, err := client.getSBOMContents(ctx, dr, manifestDigest, *sbom)
+	if err != nil {
+		return nil, "", fmt.Errorf("reading SBOM %s of %s: %w", sbom.Digest.String(), dr.ref.String(), err)
+	}
+	return contents, sbom.ArtifactType, nil
+}
+
+// getReferrers returns descriptors of manifests in ref's repository which refer to manifestDigest, or an empty list if there are none.
+func (c *dockerClient) getReferrers(ctx context.Context, ref dockerReference, manifestDigest digest.Digest) ([]imgspecv1.Descriptor, error) {
+	if err := manifestDigest.Validate(); err != nil { // Make sure manifestDigest.String() does not contain any unexpected characters
+		return nil, err
+	}
+	if err := c.detectProperties(ctx); err != nil {
+		return nil, err
+	}
+	pageURL, err := c.resolveRequestURL(fmt.Sprintf(referrersPath, reference.Path(ref.ref), manifestDigest.String()))
+	if err != nil {
+		return nil, err
+	}
+	referrers := []imgspecv1.Descriptor{}
+	for {
+		page, nextURL, supported, err := c.getReferrersPage(ctx, ref, manifestDigest, pageURL)
+		if err != nil {
+			return nil, err
+		}
+		if !supported {
+			if len(referrers) != 0 {
+				return nil, fmt.Errorf("reading referrers of %s in %s: next page %s not found", manifestDigest.String(), ref.ref.Name(), pageURL.Redacted())
+			}
+			// The registry does not support the referrers API; use the referrers tag schema.
+			return c.getReferrersFromTag(ctx, ref, manifestDigest)
+		}
+		referrers = append(referrers, page...)
+		if nextURL == nil {
+			break
+		}
+		pageURL = nextURL
+	}
+	return referrers, nil
+}
+
+// getReferrersPage returns descriptors listed on a single page of the referrers API response at pageURL, and the URL of the next page, if any.
+// If the registry does not support the referrers API, it returns supported = false.
+func (c *dockerClient) getReferrersPage(ctx context.Context, ref dockerReference, manifestDigest digest.Digest, pageURL *url.URL) (_ []imgspecv1.Descriptor, nextURL *url.URL, supported bool, _ error) {
+	headers := map[string][]string{
+		"Accept": {imgspecv1.MediaTypeImageIndex},
+	}
+	res, err := c.makeRequestToResolvedURL(ctx, http.MethodGet, pageURL, headers, nil, -1, v2Auth, nil)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil, false, nil
+	default:
+		return nil, nil, false, fmt.Errorf("reading referrers of %s in %s: %w", manifestDigest.String(), ref.ref.Name(), registryHTTPResponseToError(res))
+	}
+	indexBlob, err := iolimits.ReadAtMost(res.Body, iolimits.MaxManifestBodySize)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("reading referrers of %s in %s: %w", manifestDigest.String(), ref.ref.Name(), err)
+	}
+	referrers, err := parseReferrers(indexBlob)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("parsing referrers of %s in %s: %w", manifestDigest.String(), ref.ref.Name(), err)
+	}
+	nextURL, err = nextPageURL(res)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	return referrers, nextURL, true, nil
+}
+
+// getReferrersFromTag returns descriptors of manifests in ref's repository which refer to manifestDigest,
+// as recorded using the referrers tag schema, or an empty list if there are none.
+func (c *dockerClient) getReferrersFromTag(ctx context.Context, ref dockerReference, manifestDigest digest.Digest) ([]imgspecv1.Descriptor, error) {
+	tag := strings.Replace(manifestDigest.String(), ":", "-", 1)
+	indexBlob, _, err := c.fetchManifest(ctx, ref, tag)
+	if err != nil {
+		if isManifestUnknownError(err) {
+			return []imgspecv1.Descriptor{}, nil
+		}
+		return nil, err
+	}
+	referrers, err := parseReferrers(indexBlob)
+	if err != nil {
+		return nil, fmt.Errorf("parsing referrers of %s in %s: %w", manifestDigest.String(), ref.ref.Name(), err)
+	}
+	return referrers, nil
+}
+
+// parseReferrers returns the descriptors listed in a referrers index.
+func parseReferrers(indexBlob []byte) ([]imgspecv1.Descriptor, error) {
+	var index imgspecv1.Index
+	if err := json.Unmarshal(indexBlob, &index); err != nil {
+		return nil, err
+	}
+	return index.Manifests, nil
+}
+
+// getSBOMContents returns the contents of the SBOM artifact described by desc, which must refer to manifestDigest.
+func (c *dockerClient) getSBOMContents(ctx context.Context, ref dockerReference, manifestDigest digest.Digest, desc imgspecv1.Descriptor) ([]byte, error) {
+	if err := desc.Digest.Validate(); err != nil { // Make sure desc.Digest.String() does not contain any unexpected characters
+		return nil, err
+	}
+	manblob, _, err := c.fetchManifest(ctx, ref, desc.Digest.String())
+	if err != nil {
+		return nil, err
+	}
+	matches, err := manifest.MatchesDigest(manblob, desc.Digest)
+	if err != nil {
+		return nil, fmt.Errorf("computing manifest digest: %w", err)
+	}
+	if !matches {
+		return nil, errors.New("manifest does not match the expected digest")
+	}
+	parsed, err := manifest.OCI1FromManifest(manblob)
+	if err != nil {
+		return nil, err
+	}
+	// Referrer lists are not authenticated, and the referrers tag can be modified by anyone able to push to the repository;
+	// make sure the artifact really is about this image.
+	if parsed.Subject == nil || parsed.Subject.Digest != manifestDigest {
+		return nil, fmt.Errorf("SBOM artifact does not refer to image %s", manifestDigest.String())
+	}
+
+	var layer *imgspecv1.Descriptor
+	if len(parsed.Layers) == 1 {
+		layer = &parsed.Layers[0]
+	} else {
+		for i := range parsed.Layers {
+			if parsed.Layers[i].MediaType == desc.ArtifactType {
+				layer = &parsed.Layers[i]
+				break
+			}
+		}
+	}
+	if layer == nil {
+		return nil, fmt.Errorf("SBOM artifact has %d layers, none of type %q", len(parsed.Layers), desc.ArtifactType)
+	}
+	return c.getOCIDescriptorContents(ctx, ref, *layer, iolimits.MaxSBOMBodySize, none.NoCache)
+}
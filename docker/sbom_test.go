@@ -0,0 +1,175 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetSBOM(t *testing.T) {
+	imageManifest := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{},"layers":[]}`)
+	imageDigest := digest.FromBytes(imageManifest)
+	sbom := []byte(`{"spdxVersion":"SPDX-2.3"}`)
+	sbomDigest := digest.FromBytes(sbom)
+
+	artifactManifest := func(artifactType string, layer imgspecv1.Descriptor, subject digest.Digest) []byte {
+		m, err := json.Marshal(imgspecv1.Manifest{
+			Versioned:    specs.Versioned{SchemaVersion: 2},
+			MediaType:    imgspecv1.MediaTypeImageManifest,
+			ArtifactType: artifactType,
+			Config:       imgspecv1.DescriptorEmptyJSON,
+			Layers:       []imgspecv1.Descriptor{layer},
+			Subject:      &imgspecv1.Descriptor{MediaType: imgspecv1.MediaTypeImageManifest, Digest: subject, Size: int64(len(imageManifest))},
+		})
+		require.NoError(t, err)
+		return m
+	}
+	sigManifest := artifactManifest("application/vnd.dev.cosign.artifact.sig.v1+json",
+		imgspecv1.Descriptor{MediaType: "application/vnd.dev.cosign.simplesigning.v1+json", Digest: digest.FromString("sig"), Size: 3}, imageDigest)
+	sbomLayer := imgspecv1.Descriptor{MediaType: "application/spdx+json", Digest: sbomDigest, Size: int64(len(sbom))}
+	sbomManifest := artifactManifest("application/spdx+json", sbomLayer, imageDigest)
+	otherSubjectSBOMManifest := artifactManifest("application/spdx+json", sbomLayer, digest.FromString("other image"))
+	manifests := map[string][]byte{
+		"latest":                                            imageManifest,
+		digest.FromBytes(sigManifest).String():              sigManifest,
+		digest.FromBytes(sbomManifest).String():             sbomManifest,
+		digest.FromBytes(otherSubjectSBOMManifest).String(): otherSubjectSBOMManifest,
+	}
+	marshalIndex := func(referrers []imgspecv1.Descriptor) []byte {
+		index, err := json.Marshal(imgspecv1.Index{
+			Versioned: specs.Versioned{SchemaVersion: 2},
+			MediaType: imgspecv1.MediaTypeImageIndex,
+			Manifests: referrers,
+		})
+		require.NoError(t, err)
+		return index
+	}
+
+	for _, c := range []struct {
+		referrersAPI bool
+		hasSBOM      bool
+		wrongSubject bool // The SBOM listed as a referrer refers to a different image
+	}{
+		{true, true, false},
+		{true, false, false},
+		{false, true, false},
+		{false, false, false},
+		{true, true, true},
+		{false, true, true},
+	} {
+		referrers := []imgspecv1.Descriptor{
+			{MediaType: imgspecv1.MediaTypeImageManifest, ArtifactType: "application/vnd.dev.cosign.artifact.sig.v1+json",
+				Digest: digest.FromBytes(sigManifest), Size: int64(len(sigManifest))},
+		}
+		if c.hasSBOM {
+			listedSBOMManifest := sbomManifest
+			if c.wrongSubject {
+				listedSBOMManifest = otherSubjectSBOMManifest
+			}
+			referrers = append(referrers,
+				// A less preferred SBOM format; its manifest does not exist, so reading it would fail.
+				imgspecv1.Descriptor{MediaType: imgspecv1.MediaTypeImageManifest, ArtifactType: "application/vnd.cyclonedx+xml",
+					Digest: digest.FromString("cyclonedx"), Size: 10},
+				imgspecv1.Descriptor{MediaType: imgspecv1.MediaTypeImageManifest, ArtifactType: "application/spdx+json",
+					Digest: digest.FromBytes(listedSBOMManifest), Size: int64(len(listedSBOMManifest))},
+			)
+		}
+		index := marshalIndex(referrers)
+		// The referrers API returns each referrer on a separate page.
+		referrersPages := map[string][]byte{}
+		for i := range referrers {
+			referrersPages[strconv.Itoa(i)] = marshalIndex(referrers[i : i+1])
+		}
+		referrersTag := strings.Replace(imageDigest.String(), ":", "-", 1)
+
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.Method == http.MethodGet && r.URL.Path == "/v2/":
+				rw.WriteHeader(http.StatusOK)
+			case r.Method == http.MethodGet && r.URL.Path == "/v2/repo/referrers/"+imageDigest.String():
+				if !c.referrersAPI {
+					rw.WriteHeader(http.StatusNotFound)
+					return
+				}
+				page := r.URL.Query().Get("page")
+				if page == "" {
+					page = "0"
+				}
+				pageIndex, ok := referrersPages[page]
+				require.True(t, ok, page)
+				pageNumber, err := strconv.Atoi(page)
+				require.NoError(t, err)
+				if _, ok := referrersPages[strconv.Itoa(pageNumber+1)]; ok {
+					rw.Header().Set("Link", fmt.Sprintf(`</v2/repo/referrers/%s?page=%d>; rel="next"`, imageDigest.String(), pageNumber+1))
+				}
+				rw.Header().Set("Content-Type", imgspecv1.MediaTypeImageIndex)
+				rw.WriteHeader(http.StatusOK)
+				_, err = rw.Write(pageIndex)
+				require.NoError(t, err)
+			case r.Method == http.MethodGet && r.URL.Path == "/v2/repo/manifests/"+referrersTag && !c.referrersAPI && c.hasSBOM:
+				rw.Header().Set("Content-Type", imgspecv1.MediaTypeImageIndex)
+				rw.WriteHeader(http.StatusOK)
+				_, err := rw.Write(index)
+				require.NoError(t, err)
+			case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v2/repo/manifests/"):
+				m, ok := manifests[strings.TrimPrefix(r.URL.Path, "/v2/repo/manifests/")]
+				if !ok {
+					rw.Header().Set("Content-Type", "application/json")
+					rw.WriteHeader(http.StatusNotFound)
+					_, err := rw.Write([]byte(`{"errors":[{"code":"MANIFEST_UNKNOWN","message":"manifest unknown"}]}`))
+					require.NoError(t, err)
+					return
+				}
+				rw.Header().Set("Content-Type", imgspecv1.MediaTypeImageManifest)
+				rw.WriteHeader(http.StatusOK)
+				_, err := rw.Write(m)
+				require.NoError(t, err)
+			case r.Method == http.MethodGet && r.URL.Path == "/v2/repo/blobs/"+sbomDigest.String():
+				rw.WriteHeader(http.StatusOK)
+				_, err := rw.Write(sbom)
+				require.NoError(t, err)
+			default:
+				require.FailNowf(t, "Unexpected request", "%v %v", r.Method, r.URL.Path)
+			}
+		}))
+		defer server.Close()
+		registryURL, err := url.Parse(server.URL)
+		require.NoError(t, err)
+		registry := registryURL.Host
+
+		sys := &types.SystemContext{
+			RegistriesDirPath:           "/this/does/not/exist",
+			DockerPerHostCertDirPath:    "/this/does/not/exist",
+			SystemRegistriesConfPath:    emptyRegistriesConf(t),
+			DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+		}
+		for _, refString := range []string{"//" + registry + "/repo:latest", "//" + registry + "/repo@" + imageDigest.String()} {
+			ref, err := ParseReference(refString)
+			require.NoError(t, err)
+			contents, mediaType, err := GetSBOM(context.Background(), sys, ref)
+			switch {
+			case c.wrongSubject:
+				assert.ErrorContains(t, err, "does not refer to image", "%#v", c)
+			case c.hasSBOM:
+				require.NoError(t, err, "%#v", c)
+				assert.Equal(t, sbom, contents)
+				assert.Equal(t, "application/spdx+json", mediaType)
+			default:
+				assert.ErrorIs(t, err, ErrNoSBOM, "%#v", c)
+			}
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/containers/image/v5/internal/blobinfocache"
+	"github.com/containers/image/v5/internal/imagedestination"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/set"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"golang.org/x/sync/semaphore"
+)
+
+// defaultBlobReuseParallelism is the number of blobs checked concurrently by blobsAvailableInDestination
+// if the caller does not specify a limit.
+const defaultBlobReuseParallelism = uint(6)
+
+// appendUniqueBlobs appends blobs whose digests are not in seen to res, and adds their digests to seen.
+func appendUniqueBlobs(res []types.BlobInfo, seen *set.Set[digest.Digest], blobs ...types.BlobInfo) []types.BlobInfo {
+	for _, blob := range blobs {
+		if seen.Contains(blob.Digest) {
+			continue
+		}
+		seen.Add(blob.Digest)
+		res = append(res, blob)
+	}
+	return res
+}
+
+// blobsAvailableInDestination returns, for each of blobs, whether it is already available in dest,
+// as determined by dest.TryReusingBlob when copying blobs from srcRef (which may be nil).
+// cache is used and updated the same way as when copying an image, and may be nil.
+// At most maxParallel blobs are checked concurrently; 0 means a default limit.
+//
+// The blobs are checked without any context of the image they belong to (e.g. no layer index is provided),
+// so destinations can only reuse blobs with exactly the same digest.
+func blobsAvailableInDestination(ctx context.Context, dest types.ImageDestination, srcRef types.ImageReference,
+	cache types.BlobInfoCache, blobs []types.BlobInfo, maxParallel uint) ([]bool, error) {
+	if cache == nil {
+		cache = none.NoCache
+	}
+	if maxParallel == 0 {
+		maxParallel = defaultBlobReuseParallelism
+	}
+	bic := blobinfocache.FromBlobInfoCache(cache)
+	d := imagedestination.FromPublic(dest)
+	srcDockerRef := srcRef.DockerReference() // May be nil
+
+	sem := semaphore.NewWeighted(int64(maxParallel))
+	available := make([]bool, len(blobs))
+	errs := make([]error, len(blobs))
+	wg := sync.WaitGroup{}
+	for i, blob := range blobs {
+		if err := sem.Acquire(ctx, 1); err != nil {
+			// This can only fail with ctx.Err(), so no need to blame acquiring the semaphore.
+			errs[i] = err
+			break
+		}
+		wg.Add(1)
+		go func(i int, blob types.BlobInfo) {
+			defer sem.Release(1)
+			defer wg.Done()
+			available[i], _, errs[i] = d.TryReusingBlobWithOptions(ctx, blob, private.TryReusingBlobOptions{
+				Cache:         bic,
+				CanSubstitute: false,
+				SrcRef:        srcDockerRef,
+			})
+		}(i, blob)
+	}
+	wg.Wait()
+
+	for i, blob := range blobs {
+		if errs[i] != nil {
+			return nil, fmt.Errorf("checking whether blob %s exists in the destination: %w", blob.Digest.String(), errs[i])
+		}
+	}
+	return available, nil
+}
@@ -0,0 +1,28 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/containers/image/v5/types"
+)
+
+// ErrNoConfig is returned by RawConfig for images which do not have a separate config blob (e.g. docker schema1 images).
+var ErrNoConfig = errors.New("image does not have a separate config blob")
+
+// RawConfig returns the exact config blob of img, as referenced by its manifest; its digest matches img.ConfigInfo().Digest.
+// Unlike img.ConfigBlob, which returns nil for images without a separate config, it fails with ErrNoConfig in that case.
+func RawConfig(ctx context.Context, img types.Image) ([]byte, error) {
+	if img.ConfigInfo().Digest == "" {
+		return nil, ErrNoConfig
+	}
+	blob, err := img.ConfigBlob(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if blob == nil { // This should never happen if ConfigInfo().Digest is set, but let’s not return a nil config without an error.
+		return nil, fmt.Errorf("config %s is unexpectedly missing", img.ConfigInfo().Digest)
+	}
+	return blob, nil
+}
@@ -0,0 +1,54 @@
+package image
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/directory"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRawConfig(t *testing.T) {
+	ctx := context.Background()
+
+	config, err := os.ReadFile("../internal/image/fixtures/schema2-config.json")
+	require.NoError(t, err)
+	configDigest := digest.FromBytes(config)
+
+	for _, c := range []struct {
+		manifestFixture string
+		hasConfig       bool
+	}{
+		{"schema2.json", true},
+		{"oci1.json", true},
+		{"schema1.json", false},
+	} {
+		dir := t.TempDir()
+		manifest, err := os.ReadFile(filepath.Join("../internal/image/fixtures", c.manifestFixture))
+		require.NoError(t, err, c.manifestFixture)
+		err = os.WriteFile(filepath.Join(dir, "manifest.json"), manifest, 0o644)
+		require.NoError(t, err, c.manifestFixture)
+		err = os.WriteFile(filepath.Join(dir, configDigest.Encoded()), config, 0o644)
+		require.NoError(t, err, c.manifestFixture)
+		ref, err := directory.NewReference(dir)
+		require.NoError(t, err, c.manifestFixture)
+		src, err := ref.NewImageSource(ctx, nil)
+		require.NoError(t, err, c.manifestFixture)
+		img, err := FromSource(ctx, nil, src)
+		require.NoError(t, err, c.manifestFixture)
+		defer img.Close()
+
+		res, err := RawConfig(ctx, img)
+		if c.hasConfig {
+			require.NoError(t, err, c.manifestFixture)
+			assert.Equal(t, config, res, c.manifestFixture)
+			assert.Equal(t, img.ConfigInfo().Digest, digest.FromBytes(res), c.manifestFixture)
+		} else {
+			assert.ErrorIs(t, err, ErrNoConfig, c.manifestFixture)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package image
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containers/image/v5/internal/set"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// DownloadSize estimates the amount of layer data copying img to dest would transfer.
+// total is the sum of sizes of the layers of img, counting layers which appear in img more than once only once;
+// netNew is the part of total which is not already available in dest, as determined by dest.TryReusingBlob.
+// cache is used and updated the same way as when copying the image, and may be nil.
+//
+// Note that checking for blob reuse may have side effects in dest (e.g. cross-repository mounts on a registry),
+// so dest should be the destination that will be used for the copy.
+// DownloadSize fails if the size of some layer is not known (e.g. for docker schema1 images).
+func DownloadSize(ctx context.Context, img types.Image, dest types.ImageDestination, cache types.BlobInfoCache) (total, netNew int64, err error) {
+	layers := appendUniqueBlobs([]types.BlobInfo{}, set.New[digest.Digest](), img.LayerInfos()...)
+	for _, layer := range layers {
+		if layer.Size == -1 {
+			return -1, -1, fmt.Errorf("size of layer %s is unknown", layer.Digest.String())
+		}
+		total += layer.Size
+	}
+	available, err := blobsAvailableInDestination(ctx, dest, img.Reference(), cache, layers, 0)
+	if err != nil {
+		return -1, -1, err
+	}
+	for i, layer := range layers {
+		if !available[i] {
+			netNew += layer.Size
+		}
+	}
+	return total, netNew, nil
+}
@@ -0,0 +1,74 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/pkg/blobinfocache/memory"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadSize(t *testing.T) {
+	ctx := context.Background()
+
+	config, err := os.ReadFile("../internal/image/fixtures/schema2-config.json")
+	require.NoError(t, err)
+	configDigest := digest.FromBytes(config)
+
+	srcDir := t.TempDir()
+	err = os.WriteFile(filepath.Join(srcDir, configDigest.Encoded()), config, 0o644)
+	require.NoError(t, err)
+	layers := [][]byte{}
+	for i := 1; i <= 3; i++ {
+		layers = append(layers, []byte(strings.Repeat(fmt.Sprintf("%d", i), 100*i)))
+	}
+	layerDescriptors := []string{}
+	// The first layer is included twice, it should only be counted once.
+	for _, layer := range append(layers, layers[0]) {
+		d := digest.FromBytes(layer)
+		err = os.WriteFile(filepath.Join(srcDir, d.Encoded()), layer, 0o644)
+		require.NoError(t, err)
+		layerDescriptors = append(layerDescriptors, fmt.Sprintf(`{"mediaType":%q,"digest":%q,"size":%d}`,
+			imgspecv1.MediaTypeImageLayerGzip, d.String(), len(layer)))
+	}
+	manifest := fmt.Sprintf(`{"schemaVersion":2,"mediaType":%q,"config":{"mediaType":%q,"digest":%q,"size":%d},"layers":[%s]}`,
+		imgspecv1.MediaTypeImageManifest, imgspecv1.MediaTypeImageConfig, configDigest.String(), len(config), strings.Join(layerDescriptors, ","))
+	err = os.WriteFile(filepath.Join(srcDir, "manifest.json"), []byte(manifest), 0o644)
+	require.NoError(t, err)
+
+	srcRef, err := directory.NewReference(srcDir)
+	require.NoError(t, err)
+	src, err := srcRef.NewImageSource(ctx, nil)
+	require.NoError(t, err)
+	img, err := FromSource(ctx, nil, src)
+	require.NoError(t, err)
+	defer img.Close()
+
+	destRef, err := directory.NewReference(t.TempDir())
+	require.NoError(t, err)
+	dest, err := destRef.NewImageDestination(ctx, nil)
+	require.NoError(t, err)
+	defer dest.Close()
+
+	// Nothing in the destination yet
+	total, netNew, err := DownloadSize(ctx, img, dest, memory.New())
+	require.NoError(t, err)
+	assert.Equal(t, int64(100+200+300), total)
+	assert.Equal(t, int64(100+200+300), netNew)
+
+	// Partial overlap: the second layer already exists in the destination
+	err = os.WriteFile(filepath.Join(destRef.StringWithinTransport(), digest.FromBytes(layers[1]).Encoded()), layers[1], 0o644)
+	require.NoError(t, err)
+	total, netNew, err = DownloadSize(ctx, img, dest, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(100+200+300), total)
+	assert.Equal(t, int64(100+300), netNew)
+}
@@ -0,0 +1,97 @@
+package image
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containers/image/v5/internal/set"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// layerDiffEntry is a layer of an image, along with the key used to compare it with layers of other images.
+type layerDiffEntry struct {
+	key  digest.Digest
+	info types.BlobInfo
+}
+
+// LayerDiff compares the layers of images a and b, e.g. a base image and an image built on top of it.
+// It returns the layers of b which are not in a (added), the layers of a which are not in b (removed),
+// and the layers of b which are also in a (shared), each in the order of the respective image, and without duplicates.
+//
+// Layers are compared by their uncompressed digests (DiffIDs) if both images' configs contain them,
+// so that the same layer compressed differently is recognized as shared; otherwise, they are compared by digest.
+// Empty layers (e.g. placeholders used by docker schema1 images) are ignored.
+func LayerDiff(ctx context.Context, a, b types.Image) (added, removed, shared []types.BlobInfo, err error) {
+	aLayers, aHaveDiffIDs, err := layerDiffEntries(ctx, a)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	bLayers, bHaveDiffIDs, err := layerDiffEntries(ctx, b)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if !aHaveDiffIDs || !bHaveDiffIDs {
+		for i := range aLayers {
+			aLayers[i].key = aLayers[i].info.Digest
+		}
+		for i := range bLayers {
+			bLayers[i].key = bLayers[i].info.Digest
+		}
+	}
+
+	aKeys := set.New[digest.Digest]()
+	for _, l := range aLayers {
+		aKeys.Add(l.key)
+	}
+	bKeys := set.New[digest.Digest]()
+	added, shared = []types.BlobInfo{}, []types.BlobInfo{}
+	for _, l := range bLayers {
+		if bKeys.Contains(l.key) {
+			continue
+		}
+		bKeys.Add(l.key)
+		if aKeys.Contains(l.key) {
+			shared = append(shared, l.info)
+		} else {
+			added = append(added, l.info)
+		}
+	}
+	removed = []types.BlobInfo{}
+	for _, l := range aLayers {
+		if bKeys.Contains(l.key) {
+			continue
+		}
+		bKeys.Add(l.key) // Don’t report duplicates in a more than once.
+		removed = append(removed, l.info)
+	}
+	return added, removed, shared, nil
+}
+
+// layerDiffEntries returns the non-empty layers of img for LayerDiff, using DiffIDs as keys if they are available,
+// and whether they are available.
+func layerDiffEntries(ctx context.Context, img types.Image) ([]layerDiffEntry, bool, error) {
+	layers := img.LayerInfos()
+	var diffIDs []digest.Digest
+	if img.ConfigInfo().Digest != "" {
+		config, err := img.OCIConfig(ctx)
+		if err != nil {
+			return nil, false, fmt.Errorf("reading config: %w", err)
+		}
+		diffIDs = config.RootFS.DiffIDs
+	}
+	haveDiffIDs := len(diffIDs) == len(layers)
+
+	res := []layerDiffEntry{}
+	for i, l := range layers {
+		if l.Digest == GzippedEmptyLayerDigest {
+			continue
+		}
+		e := layerDiffEntry{key: l.Digest, info: l}
+		if haveDiffIDs {
+			e.key = diffIDs[i]
+		}
+		res = append(res, e)
+	}
+	return res, haveDiffIDs, nil
+}
@@ -0,0 +1,125 @@
+package image
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testLayer is a layer of an image created by writeLayerDiffTestImage
+type testLayer struct {
+	contents string
+	diffID   digest.Digest
+}
+
+// writeLayerDiffTestImage creates an OCI image with the specified layers in a dir: directory, and returns it.
+func writeLayerDiffTestImage(t *testing.T, layers []testLayer) types.Image {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	descriptors := []imgspecv1.Descriptor{}
+	diffIDs := []digest.Digest{}
+	for _, l := range layers {
+		d := digest.FromString(l.contents)
+		err := os.WriteFile(filepath.Join(dir, d.Encoded()), []byte(l.contents), 0o644)
+		require.NoError(t, err)
+		descriptors = append(descriptors, imgspecv1.Descriptor{MediaType: imgspecv1.MediaTypeImageLayerGzip, Digest: d, Size: int64(len(l.contents))})
+		diffIDs = append(diffIDs, l.diffID)
+	}
+	config, err := json.Marshal(imgspecv1.Image{
+		Platform: imgspecv1.Platform{OS: "linux", Architecture: "amd64"},
+		RootFS:   imgspecv1.RootFS{Type: "layers", DiffIDs: diffIDs},
+	})
+	require.NoError(t, err)
+	configDigest := digest.FromBytes(config)
+	err = os.WriteFile(filepath.Join(dir, configDigest.Encoded()), config, 0o644)
+	require.NoError(t, err)
+	manifestBlob, err := json.Marshal(imgspecv1.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: imgspecv1.MediaTypeImageManifest,
+		Config:    imgspecv1.Descriptor{MediaType: imgspecv1.MediaTypeImageConfig, Digest: configDigest, Size: int64(len(config))},
+		Layers:    descriptors,
+	})
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, "manifest.json"), manifestBlob, 0o644)
+	require.NoError(t, err)
+
+	ref, err := directory.NewReference(dir)
+	require.NoError(t, err)
+	src, err := ref.NewImageSource(ctx, nil)
+	require.NoError(t, err)
+	img, err := FromSource(ctx, nil, src)
+	require.NoError(t, err)
+	t.Cleanup(func() { img.Close() })
+	return img
+}
+
+func TestLayerDiff(t *testing.T) {
+	ctx := context.Background()
+
+	baseLayer1 := testLayer{"base layer 1", digest.FromString("uncompressed base layer 1")}
+	baseLayer2 := testLayer{"base layer 2", digest.FromString("uncompressed base layer 2")}
+	childLayer := testLayer{"child layer", digest.FromString("uncompressed child layer")}
+	// The same contents as baseLayer2, compressed differently
+	recompressedBaseLayer2 := testLayer{"base layer 2, recompressed", baseLayer2.diffID}
+	emptyLayer := testLayer{string(GzippedEmptyLayer), digest.FromString("uncompressed empty layer")}
+
+	blobInfo := func(l testLayer) types.BlobInfo {
+		return types.BlobInfo{
+			Digest:    digest.FromString(l.contents),
+			Size:      int64(len(l.contents)),
+			MediaType: imgspecv1.MediaTypeImageLayerGzip,
+		}
+	}
+
+	base := writeLayerDiffTestImage(t, []testLayer{baseLayer1, baseLayer2})
+	child := writeLayerDiffTestImage(t, []testLayer{baseLayer1, baseLayer2, emptyLayer, childLayer})
+	recompressedChild := writeLayerDiffTestImage(t, []testLayer{baseLayer1, recompressedBaseLayer2, childLayer})
+
+	for _, c := range []struct {
+		name                   string
+		a, b                   types.Image
+		added, removed, shared []types.BlobInfo
+	}{
+		{
+			name: "base→child", a: base, b: child,
+			added:   []types.BlobInfo{blobInfo(childLayer)},
+			removed: []types.BlobInfo{},
+			shared:  []types.BlobInfo{blobInfo(baseLayer1), blobInfo(baseLayer2)},
+		},
+		{
+			name: "child→base", a: child, b: base,
+			added:   []types.BlobInfo{},
+			removed: []types.BlobInfo{blobInfo(childLayer)},
+			shared:  []types.BlobInfo{blobInfo(baseLayer1), blobInfo(baseLayer2)},
+		},
+		{
+			name: "base→base", a: base, b: base,
+			added:   []types.BlobInfo{},
+			removed: []types.BlobInfo{},
+			shared:  []types.BlobInfo{blobInfo(baseLayer1), blobInfo(baseLayer2)},
+		},
+		{
+			name: "base→recompressed child", a: base, b: recompressedChild,
+			added:   []types.BlobInfo{blobInfo(childLayer)},
+			removed: []types.BlobInfo{},
+			shared:  []types.BlobInfo{blobInfo(baseLayer1), blobInfo(recompressedBaseLayer2)},
+		},
+	} {
+		added, removed, shared, err := LayerDiff(ctx, c.a, c.b)
+		require.NoError(t, err, c.name)
+		assert.Equal(t, c.added, added, c.name)
+		assert.Equal(t, c.removed, removed, c.name)
+		assert.Equal(t, c.shared, shared, c.name)
+	}
+}
@@ -0,0 +1,74 @@
+package image
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containers/image/v5/internal/set"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// MissingBlobs returns the layers and configs of all instances of the image in src which are not already available in dest,
+// as determined by dest.TryReusingBlob, in the order they first appear in the image, and without duplicates.
+// If src is not a multi-platform image, only its single instance is considered.
+// cache is used and updated the same way as when copying the image, and may be nil.
+// At most maxParallel blobs are checked concurrently; 0 means a default limit.
+//
+// Note that checking for blob reuse may have side effects in dest (e.g. cross-repository mounts on a registry),
+// so dest should be the destination that will be used for the copy.
+func MissingBlobs(ctx context.Context, sys *types.SystemContext, src types.ImageSource, dest types.ImageDestination,
+	cache types.BlobInfoCache, maxParallel uint) ([]types.BlobInfo, error) {
+	blobs, err := instanceBlobs(ctx, sys, src)
+	if err != nil {
+		return nil, err
+	}
+	available, err := blobsAvailableInDestination(ctx, dest, src.Reference(), cache, blobs, maxParallel)
+	if err != nil {
+		return nil, err
+	}
+	res := []types.BlobInfo{}
+	for i, blob := range blobs {
+		if !available[i] {
+			res = append(res, blob)
+		}
+	}
+	return res, nil
+}
+
+// instanceBlobs returns the layers and configs of all instances of the image in src, without duplicates.
+func instanceBlobs(ctx context.Context, sys *types.SystemContext, src types.ImageSource) ([]types.BlobInfo, error) {
+	manifestBlob, manifestType, err := src.GetManifest(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	instances := []*digest.Digest{nil}
+	if manifest.MIMETypeIsMultiImage(manifestType) {
+		list, err := manifest.ListFromBlob(manifestBlob, manifestType)
+		if err != nil {
+			return nil, fmt.Errorf("parsing manifest list: %w", err)
+		}
+		instances = []*digest.Digest{}
+		for _, instance := range list.Instances() {
+			instances = append(instances, &instance)
+		}
+	}
+
+	seen := set.New[digest.Digest]()
+	res := []types.BlobInfo{}
+	for _, instanceDigest := range instances {
+		img, err := FromUnparsedImage(ctx, sys, UnparsedInstance(src, instanceDigest))
+		if err != nil {
+			if instanceDigest != nil {
+				return nil, fmt.Errorf("reading instance %s: %w", instanceDigest.String(), err)
+			}
+			return nil, err
+		}
+		res = appendUniqueBlobs(res, seen, img.LayerInfos()...)
+		if config := img.ConfigInfo(); config.Digest != "" {
+			res = appendUniqueBlobs(res, seen, config)
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,111 @@
+package image
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/pkg/blobinfocache/memory"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMissingBlobs(t *testing.T) {
+	ctx := context.Background()
+
+	srcDir := t.TempDir()
+	writeBlob := func(dir string, contents []byte) imgspecv1.Descriptor {
+		d := digest.FromBytes(contents)
+		err := os.WriteFile(filepath.Join(dir, d.Encoded()), contents, 0o644)
+		require.NoError(t, err)
+		return imgspecv1.Descriptor{Digest: d, Size: int64(len(contents))}
+	}
+	// The two instances share the base layer.
+	base := writeBlob(srcDir, []byte("base layer"))
+	instanceBlobs := [][]imgspecv1.Descriptor{}
+	indexDescriptors := []imgspecv1.Descriptor{}
+	for _, arch := range []string{"amd64", "arm64"} {
+		top := writeBlob(srcDir, []byte("top layer for "+arch))
+		config := writeBlob(srcDir, []byte(`{"architecture":"`+arch+`","os":"linux"}`))
+		config.MediaType = imgspecv1.MediaTypeImageConfig
+		layers := []imgspecv1.Descriptor{base, top}
+		for i := range layers {
+			layers[i].MediaType = imgspecv1.MediaTypeImageLayerGzip
+		}
+		manifestBlob, err := json.Marshal(imgspecv1.Manifest{
+			Versioned: specs.Versioned{SchemaVersion: 2},
+			MediaType: imgspecv1.MediaTypeImageManifest,
+			Config:    config,
+			Layers:    layers,
+		})
+		require.NoError(t, err)
+		manifestDigest := digest.FromBytes(manifestBlob)
+		err = os.WriteFile(filepath.Join(srcDir, manifestDigest.Encoded()+".manifest.json"), manifestBlob, 0o644)
+		require.NoError(t, err)
+		instanceBlobs = append(instanceBlobs, []imgspecv1.Descriptor{base, top, config})
+		indexDescriptors = append(indexDescriptors, imgspecv1.Descriptor{
+			MediaType: imgspecv1.MediaTypeImageManifest,
+			Digest:    manifestDigest,
+			Size:      int64(len(manifestBlob)),
+			Platform:  &imgspecv1.Platform{OS: "linux", Architecture: arch},
+		})
+	}
+	index, err := json.Marshal(imgspecv1.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: imgspecv1.MediaTypeImageIndex,
+		Manifests: indexDescriptors,
+	})
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(srcDir, "manifest.json"), index, 0o644)
+	require.NoError(t, err)
+
+	srcRef, err := directory.NewReference(srcDir)
+	require.NoError(t, err)
+	src, err := srcRef.NewImageSource(ctx, nil)
+	require.NoError(t, err)
+	defer src.Close()
+
+	destDir := t.TempDir()
+	destRef, err := directory.NewReference(destDir)
+	require.NoError(t, err)
+	dest, err := destRef.NewImageDestination(ctx, nil)
+	require.NoError(t, err)
+	defer dest.Close()
+
+	digests := func(blobs []types.BlobInfo) []digest.Digest {
+		res := []digest.Digest{}
+		for _, b := range blobs {
+			res = append(res, b.Digest)
+		}
+		return res
+	}
+
+	// Nothing in the destination yet; the shared base layer is only listed once.
+	missing, err := MissingBlobs(ctx, nil, src, dest, memory.New(), 0)
+	require.NoError(t, err)
+	assert.Equal(t, []digest.Digest{
+		base.Digest, instanceBlobs[0][1].Digest, instanceBlobs[0][2].Digest,
+		instanceBlobs[1][1].Digest, instanceBlobs[1][2].Digest,
+	}, digests(missing))
+	for _, b := range missing {
+		assert.NotEqual(t, int64(-1), b.Size)
+	}
+
+	// The blobs of the first instance already exist in the destination.
+	for _, b := range instanceBlobs[0] {
+		contents, err := os.ReadFile(filepath.Join(srcDir, b.Digest.Encoded()))
+		require.NoError(t, err)
+		writeBlob(destDir, contents)
+	}
+	missing, err = MissingBlobs(ctx, nil, src, dest, nil, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []digest.Digest{instanceBlobs[1][1].Digest, instanceBlobs[1][2].Digest}, digests(missing))
+	assert.Equal(t, instanceBlobs[1][1].Size, missing[0].Size)
+}
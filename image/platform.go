@@ -0,0 +1,16 @@
+package image
+
+import (
+	"context"
+
+	"github.com/containers/image/v5/internal/image"
+	"github.com/containers/image/v5/types"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Platform returns the platform (OS, architecture, and where available variant, OS version and OS features)
+// img is built for, as recorded in the image configuration.
+// For docker v2s1 images, which have no separate configuration, only the OS and architecture are returned.
+func Platform(ctx context.Context, img types.Image) (imgspecv1.Platform, error) {
+	return image.Platform(ctx, img)
+}
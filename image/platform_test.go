@@ -0,0 +1,55 @@
+package image
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// otherImage is a types.Image implementation not provided by this package.
+type otherImage struct {
+	types.Image
+}
+
+func TestPlatform(t *testing.T) {
+	ctx := context.Background()
+
+	config, err := os.ReadFile("../internal/image/fixtures/schema2-config.json")
+	require.NoError(t, err)
+	configDigest := digest.FromBytes(config)
+
+	for _, manifestFixture := range []string{"schema2.json", "oci1.json", "schema1.json"} {
+		dir := t.TempDir()
+		manifest, err := os.ReadFile(filepath.Join("../internal/image/fixtures", manifestFixture))
+		require.NoError(t, err, manifestFixture)
+		err = os.WriteFile(filepath.Join(dir, "manifest.json"), manifest, 0o644)
+		require.NoError(t, err, manifestFixture)
+		err = os.WriteFile(filepath.Join(dir, configDigest.Encoded()), config, 0o644)
+		require.NoError(t, err, manifestFixture)
+		ref, err := directory.NewReference(dir)
+		require.NoError(t, err, manifestFixture)
+		src, err := ref.NewImageSource(ctx, nil)
+		require.NoError(t, err, manifestFixture)
+		img, err := FromSource(ctx, nil, src)
+		require.NoError(t, err, manifestFixture)
+		defer img.Close()
+
+		platform, err := Platform(ctx, img)
+		require.NoError(t, err, manifestFixture)
+		assert.Equal(t, imgspecv1.Platform{OS: "linux", Architecture: "amd64"}, platform, manifestFixture)
+
+		if manifestFixture != "schema1.json" { // Converting schema1 images to read their config requires layer DiffIDs.
+			platform, err = Platform(ctx, otherImage{Image: img})
+			require.NoError(t, err, manifestFixture)
+			assert.Equal(t, imgspecv1.Platform{OS: "linux", Architecture: "amd64"}, platform, manifestFixture)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package image
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/containers/image/v5/internal/iolimits"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/pkg/compression"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+)
+
+const (
+	// whiteoutPrefix marks a layer entry which deletes the path without the prefix from lower layers.
+	whiteoutPrefix = ".wh."
+	// whiteoutOpaqueDir marks a directory whose contents in lower layers are hidden.
+	whiteoutOpaqueDir = whiteoutPrefix + whiteoutPrefix + ".opq"
+	// maxReadFileLinks is the maximum number of symbolic and hard links ReadFile follows, to prevent loops.
+	maxReadFileLinks = 40
+)
+
+// ReadFile returns the contents of filePath in the image in src (chosen by instanceDigest, or as appropriate for sys if
+// instanceDigest is nil and src is a multi-platform image), without extracting the image.
+// Layers are read from the topmost one down, only until the file is found, honoring whiteouts and opaque directories.
+// Symbolic and hard links are followed, both for filePath itself and for its parent directories.
+//
+// The file is read into memory; files larger than sys.MaxReadFileSize (64 MiB by default) are rejected.
+// If the file does not exist, the returned error satisfies errors.Is(err, fs.ErrNotExist).
+// Note that because layers are not read completely, their contents are not verified to match their digests.
+func ReadFile(ctx context.Context, sys *types.SystemContext, src types.ImageSource, instanceDigest *digest.Digest, filePath string) ([]byte, error) {
+	img, err := FromUnparsedImage(ctx, sys, UnparsedInstance(src, instanceDigest))
+	if err != nil {
+		return nil, err
+	}
+	layers, err := img.LayerInfosForCopy(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if layers == nil {
+		layers = img.LayerInfos()
+	}
+
+	target := cleanLayerPath(filePath)
+	layerIndex := len(layers) - 1
+	for links := 0; ; links++ {
+		if target == "" {
+			return nil, fmt.Errorf("reading %q: is a directory", filePath)
+		}
+		res, err := readFileFromLayers(ctx, src, layers[:layerIndex+1], target, iolimits.ReadFileSizeLimit(sys))
+		if err != nil {
+			return nil, fmt.Errorf("reading %q: %w", filePath, err)
+		}
+		if res.link == nil {
+			return res.contents, nil
+		}
+		if links == maxReadFileLinks {
+			return nil, fmt.Errorf("reading %q: too many levels of links", filePath)
+		}
+		target = res.link.target
+		layerIndex = len(layers) - 1
+		if res.link.hardLink {
+			// Hard links refer to other entries of the same layer.
+			layerIndex = res.link.layerIndex
+		}
+	}
+}
+
+// readFileLink describes a link found by readFileFromLayers, which must be followed to find the file.
+type readFileLink struct {
+	target     string // The path to look up instead, in the format returned by cleanLayerPath
+	hardLink   bool   // If true, target must be looked up starting at layerIndex, not in the topmost layer
+	layerIndex int
+}
+
+// readFileResult is the result of readFileFromLayers: either the file contents, or a link to follow.
+type readFileResult struct {
+	contents []byte
+	link     *readFileLink
+}
+
+// readFileFromLayers looks up target, in the format returned by cleanLayerPath, in layers, starting at the last one.
+// Files larger than maxSize are rejected.
+func readFileFromLayers(ctx context.Context, src types.ImageSource, layers []types.BlobInfo, target string, maxSize int) (readFileResult, error) {
+	for i := len(layers) - 1; i >= 0; i-- {
+		res, found, hidesLower, err := readFileFromLayer(ctx, src, layers[i], target, maxSize)
+		if err != nil {
+			return readFileResult{}, fmt.Errorf("reading layer %s: %w", layers[i].Digest, err)
+		}
+		if found {
+			if res.link != nil {
+				res.link.layerIndex = i
+			}
+			return res, nil
+		}
+		if hidesLower {
+			break
+		}
+	}
+	return readFileResult{}, fs.ErrNotExist
+}
+
+// readFileFromLayer looks up target, in the format returned by cleanLayerPath, in a single layer.
+// It returns found == true if the layer contains target, or a link to follow;
+// otherwise, hidesLower is true if the layer deletes target from lower layers.
+// Files larger than maxSize are rejected.
+func readFileFromLayer(ctx context.Context, src types.ImageSource, layer types.BlobInfo, target string, maxSize int) (res readFileResult, found bool, hidesLower bool, err error) {
+	stream, _, err := src.GetBlob(ctx, layer, none.NoCache)
+	if err != nil {
+		return readFileResult{}, false, false, err
+	}
+	defer stream.Close()
+	uncompressed, _, err := compression.AutoDecompress(stream)
+	if err != nil {
+		return readFileResult{}, false, false, err
+	}
+	defer uncompressed.Close()
+
+	tr := tar.NewReader(uncompressed)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return readFileResult{}, false, hidesLower, nil
+		}
+		if err != nil {
+			return readFileResult{}, false, false, err
+		}
+		name := cleanLayerPath(hdr.Name)
+		if name == "" {
+			continue
+		}
+		dir, base := path.Split(name)
+		dir = strings.TrimSuffix(dir, "/")
+
+		switch {
+		case base == whiteoutOpaqueDir:
+			if isPathAncestor(dir, target) {
+				hidesLower = true
+			}
+		case strings.HasPrefix(base, whiteoutPrefix):
+			deleted := path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix))
+			if deleted == target || isPathAncestor(deleted, target) {
+				hidesLower = true
+			}
+		case name == target:
+			switch hdr.Typeflag {
+			case tar.TypeReg:
+				contents, err := iolimits.ReadAtMost(tr, maxSize)
+				if err != nil {
+					return readFileResult{}, false, false, err
+				}
+				return readFileResult{contents: contents}, true, false, nil
+			case tar.TypeSymlink:
+				return readFileResult{link: &readFileLink{target: resolveSymlink(dir, hdr.Linkname)}}, true, false, nil
+			case tar.TypeLink:
+				return readFileResult{link: &readFileLink{target: cleanLayerPath(hdr.Linkname), hardLink: true}}, true, false, nil
+			case tar.TypeDir:
+				return readFileResult{}, false, false, errors.New("is a directory")
+			default:
+				return readFileResult{}, false, false, fmt.Errorf("is not a regular file (type %q)", hdr.Typeflag)
+			}
+		case isPathAncestor(name, target):
+			switch hdr.Typeflag {
+			case tar.TypeDir:
+				// Nothing to do, the directory contents are merged with lower layers.
+			case tar.TypeSymlink:
+				rest := strings.TrimPrefix(target, name+"/")
+				return readFileResult{link: &readFileLink{target: path.Join(resolveSymlink(dir, hdr.Linkname), rest)}}, true, false, nil
+			default: // A non-directory replaces the directory in lower layers.
+				hidesLower = true
+			}
+		}
+	}
+}
+
+// cleanLayerPath returns p relative to the root of the filesystem, without a leading or trailing "/" or any "." or "..".
+// The root itself is represented as "".
+func cleanLayerPath(p string) string {
+	return strings.TrimPrefix(path.Clean("/"+p), "/")
+}
+
+// resolveSymlink returns the target of a symbolic link in dir with linkname, in the format returned by cleanLayerPath.
+func resolveSymlink(dir, linkname string) string {
+	if path.IsAbs(linkname) {
+		return cleanLayerPath(linkname)
+	}
+	return cleanLayerPath(path.Join(dir, linkname))
+}
+
+// isPathAncestor returns true if dir is a parent directory (not necessarily immediate) of p.
+func isPathAncestor(dir, p string) bool {
+	return dir == "" || strings.HasPrefix(p, dir+"/")
+}
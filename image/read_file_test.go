@@ -0,0 +1,183 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeReadFileTestImage creates an OCI image with layers containing the specified tar entries in a dir: directory, and returns a source for it.
+// Layers with an odd index are compressed.
+func writeReadFileTestImage(t *testing.T, layers [][]tar.Header, contents map[string]string) types.ImageSource {
+	dir := t.TempDir()
+
+	descriptors := []imgspecv1.Descriptor{}
+	diffIDs := []digest.Digest{}
+	for i, entries := range layers {
+		tarBuf := bytes.Buffer{}
+		tw := tar.NewWriter(&tarBuf)
+		for _, hdr := range entries {
+			data := contents[hdr.Name]
+			if hdr.Typeflag == tar.TypeReg {
+				hdr.Size = int64(len(data))
+			}
+			if hdr.Mode == 0 {
+				hdr.Mode = 0o755
+			}
+			err := tw.WriteHeader(&hdr)
+			require.NoError(t, err)
+			if hdr.Typeflag == tar.TypeReg {
+				_, err = tw.Write([]byte(data))
+				require.NoError(t, err)
+			}
+		}
+		err := tw.Close()
+		require.NoError(t, err)
+		diffIDs = append(diffIDs, digest.FromBytes(tarBuf.Bytes()))
+
+		blob := tarBuf.Bytes()
+		mediaType := imgspecv1.MediaTypeImageLayer
+		if i%2 == 1 {
+			gzipBuf := bytes.Buffer{}
+			gzw := gzip.NewWriter(&gzipBuf)
+			_, err := gzw.Write(blob)
+			require.NoError(t, err)
+			err = gzw.Close()
+			require.NoError(t, err)
+			blob = gzipBuf.Bytes()
+			mediaType = imgspecv1.MediaTypeImageLayerGzip
+		}
+		d := digest.FromBytes(blob)
+		err = os.WriteFile(filepath.Join(dir, d.Encoded()), blob, 0o644)
+		require.NoError(t, err)
+		descriptors = append(descriptors, imgspecv1.Descriptor{MediaType: mediaType, Digest: d, Size: int64(len(blob))})
+	}
+	config, err := json.Marshal(imgspecv1.Image{
+		Platform: imgspecv1.Platform{OS: "linux", Architecture: "amd64"},
+		RootFS:   imgspecv1.RootFS{Type: "layers", DiffIDs: diffIDs},
+	})
+	require.NoError(t, err)
+	configDigest := digest.FromBytes(config)
+	err = os.WriteFile(filepath.Join(dir, configDigest.Encoded()), config, 0o644)
+	require.NoError(t, err)
+	manifestBlob, err := json.Marshal(imgspecv1.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: imgspecv1.MediaTypeImageManifest,
+		Config:    imgspecv1.Descriptor{MediaType: imgspecv1.MediaTypeImageConfig, Digest: configDigest, Size: int64(len(config))},
+		Layers:    descriptors,
+	})
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, "manifest.json"), manifestBlob, 0o644)
+	require.NoError(t, err)
+
+	ref, err := directory.NewReference(dir)
+	require.NoError(t, err)
+	src, err := ref.NewImageSource(context.Background(), nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { src.Close() })
+	return src
+}
+
+func TestReadFile(t *testing.T) {
+	ctx := context.Background()
+	src := writeReadFileTestImage(t, [][]tar.Header{
+		{
+			{Name: "etc/", Typeflag: tar.TypeDir},
+			{Name: "etc/os-release", Typeflag: tar.TypeReg},
+			{Name: "etc/passwd", Typeflag: tar.TypeReg},
+			{Name: "etc/shadow", Typeflag: tar.TypeReg},
+			{Name: "opt/dir/a", Typeflag: tar.TypeReg},
+			{Name: "usr/bin/tool", Typeflag: tar.TypeReg},
+			{Name: "usr/lib/os-release", Typeflag: tar.TypeReg},
+			{Name: "bin", Typeflag: tar.TypeSymlink, Linkname: "usr/bin"},
+			{Name: "var/file", Typeflag: tar.TypeReg},
+		},
+		{
+			{Name: "./etc/os-release", Typeflag: tar.TypeSymlink, Linkname: "../usr/lib/os-release"},
+			{Name: "etc/.wh.shadow", Typeflag: tar.TypeReg},
+			{Name: "opt/dir/", Typeflag: tar.TypeDir},
+			{Name: "opt/dir/.wh..wh..opq", Typeflag: tar.TypeReg},
+			{Name: "opt/dir/b", Typeflag: tar.TypeReg},
+			{Name: "etc/group", Typeflag: tar.TypeReg},
+			{Name: "etc/group-link", Typeflag: tar.TypeLink, Linkname: "etc/group"},
+			{Name: "var", Typeflag: tar.TypeReg},
+		},
+		{
+			{Name: "/usr/lib/os-release", Typeflag: tar.TypeReg},
+			{Name: "loop1", Typeflag: tar.TypeSymlink, Linkname: "/loop2"},
+			{Name: "loop2", Typeflag: tar.TypeSymlink, Linkname: "loop1"},
+			{Name: "root-link", Typeflag: tar.TypeSymlink, Linkname: "../.."},
+		},
+	}, map[string]string{
+		"etc/os-release":      "lower os-release",
+		"etc/passwd":          "passwd",
+		"etc/shadow":          "shadow",
+		"opt/dir/a":           "a",
+		"opt/dir/b":           "b",
+		"usr/bin/tool":        "tool",
+		"usr/lib/os-release":  "middle os-release",
+		"/usr/lib/os-release": "upper os-release",
+		"var/file":            "var/file",
+		"etc/group":           "group",
+	})
+
+	// Files which exist
+	for _, c := range []struct{ path, expected string }{
+		{"/etc/passwd", "passwd"},                   // In a lower layer
+		{"etc/passwd", "passwd"},                    // Relative path
+		{"/etc/os-release", "upper os-release"},     // Symlink to a file in an upper layer
+		{"/usr/lib/os-release", "upper os-release"}, // Overwritten in an upper layer
+		{"/opt/dir/b", "b"},                         // Added in an opaque directory
+		{"/bin/tool", "tool"},                       // Symlinked parent directory
+		{"/etc/group-link", "group"},                // Hard link
+	} {
+		contents, err := ReadFile(ctx, nil, src, nil, c.path)
+		require.NoError(t, err, c.path)
+		assert.Equal(t, c.expected, string(contents), c.path)
+	}
+
+	// Files which don't exist
+	for _, path := range []string{
+		"/etc/shadow",  // Deleted by a whiteout
+		"/opt/dir/a",   // Hidden by an opaque directory
+		"/var/file",    // Parent directory replaced by a file
+		"/etc/missing", // Never existed
+		"/missing/file",
+	} {
+		_, err := ReadFile(ctx, nil, src, nil, path)
+		assert.ErrorIs(t, err, fs.ErrNotExist, path)
+	}
+
+	// Other errors
+	for _, path := range []string{
+		"/etc",       // A directory
+		"/",          // The root directory
+		"/root-link", // Symlink to the root directory
+		"/loop1",     // Symlink loop
+	} {
+		_, err := ReadFile(ctx, nil, src, nil, path)
+		assert.Error(t, err, path)
+		assert.NotErrorIs(t, err, fs.ErrNotExist, path)
+	}
+
+	// Size limit
+	contents, err := ReadFile(ctx, &types.SystemContext{MaxReadFileSize: len("passwd")}, src, nil, "/etc/passwd")
+	require.NoError(t, err)
+	assert.Equal(t, "passwd", string(contents))
+	_, err = ReadFile(ctx, &types.SystemContext{MaxReadFileSize: len("passwd") - 1}, src, nil, "/etc/passwd")
+	assert.Error(t, err)
+}
@@ -0,0 +1,25 @@
+package image
+
+import (
+	"context"
+
+	"github.com/containers/image/v5/internal/imagesource"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+)
+
+// SignatureMetadata describes a signature of an image, without including the signature contents.
+type SignatureMetadata = private.SignatureMetadata
+
+// SignaturesMetadata returns metadata (format and size) of the signatures of the image in src,
+// in the same order as src.GetSignatures returns them.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to describe signatures for
+// (when the primary manifest is a manifest list).
+//
+// Where the transport allows, this avoids reading the signatures in full (e.g. containers-storage records
+// signature sizes separately, and sigstore attachments in a registry are described by their manifest);
+// otherwise, all signatures are read.
+func SignaturesMetadata(ctx context.Context, src types.ImageSource, instanceDigest *digest.Digest) ([]SignatureMetadata, error) {
+	return imagesource.SignaturesMetadata(ctx, imagesource.FromPublic(src), instanceDigest)
+}
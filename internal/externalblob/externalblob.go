@@ -0,0 +1,76 @@
+package externalblob
+
+import (
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// verifyingReader is an io.ReadCloser which returns an error instead of io.EOF
+// if the contents of source do not match the expected digest and size.
+type verifyingReader struct {
+	source         io.ReadCloser
+	digester       digest.Digester
+	hash           hash.Hash
+	expectedDigest digest.Digest
+	expectedSize   int64 // -1 if unknown
+	size           int64
+}
+
+// NewVerifyingReader returns an io.ReadCloser with the contents of source, a blob fetched from one of info.URLs.
+// The returned reader fails with an error instead of returning io.EOF if the contents do not match info.Digest,
+// or info.Size if known; it also fails as soon as more than info.Size bytes are read.
+// Callers should use this unless sys.SkipForeignLayerVerification is set, because, unlike data from a registry,
+// the contents of a foreign URL are not tied to the image in any way.
+func NewVerifyingReader(source io.ReadCloser, info types.BlobInfo) (io.ReadCloser, error) {
+	if err := info.Digest.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid digest specification %q: %w", info.Digest, err)
+	}
+	digestAlgorithm := info.Digest.Algorithm()
+	if !digestAlgorithm.Available() {
+		return nil, fmt.Errorf("invalid digest specification %q: unsupported digest algorithm %q", info.Digest, digestAlgorithm)
+	}
+	digester := digestAlgorithm.Digester()
+	return &verifyingReader{
+		source:         source,
+		digester:       digester,
+		hash:           digester.Hash(),
+		expectedDigest: info.Digest,
+		expectedSize:   info.Size,
+		size:           0,
+	}, nil
+}
+
+// Read implements io.ReadCloser
+func (r *verifyingReader) Read(p []byte) (int, error) {
+	n, err := r.source.Read(p)
+	if n > 0 {
+		r.size += int64(n)
+		if r.expectedSize != -1 && r.size > r.expectedSize {
+			return 0, fmt.Errorf("external blob %s is larger than the expected size %d", r.expectedDigest, r.expectedSize)
+		}
+		if n2, err := r.hash.Write(p[:n]); n2 != n || err != nil {
+			// Coverage: This should not happen, the hash.Hash interface requires
+			// r.hash.Write to never return an error, and the io.Writer interface
+			// requires n2 == len(input) if no error is returned.
+			return 0, fmt.Errorf("updating digest during verification: %d vs. %d: %w", n2, n, err)
+		}
+	}
+	if err == io.EOF {
+		if r.expectedSize != -1 && r.size != r.expectedSize {
+			return 0, fmt.Errorf("external blob %s size mismatch, expected %d, got %d", r.expectedDigest, r.expectedSize, r.size)
+		}
+		if actualDigest := r.digester.Digest(); actualDigest != r.expectedDigest {
+			return 0, fmt.Errorf("external blob digest mismatch, expected %s, got %s", r.expectedDigest, actualDigest)
+		}
+	}
+	return n, err
+}
+
+// Close implements io.ReadCloser
+func (r *verifyingReader) Close() error {
+	return r.source.Close()
+}
@@ -0,0 +1,48 @@
+package externalblob
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewVerifyingReader(t *testing.T) {
+	blob := []byte("foreign layer contents")
+	blobDigest := digest.FromBytes(blob)
+
+	// Invalid digests
+	for _, d := range []digest.Digest{"", "sha256:x", "md5:d41d8cd98f00b204e9800998ecf8427e"} {
+		_, err := NewVerifyingReader(io.NopCloser(bytes.NewReader(blob)), types.BlobInfo{Digest: d, Size: -1})
+		assert.Error(t, err, string(d))
+	}
+
+	for _, c := range []struct {
+		name     string
+		contents []byte
+		size     int64
+		errorMsg string // "" if no error is expected
+	}{
+		{"matching, unknown size", blob, -1, ""},
+		{"matching, known size", blob, int64(len(blob)), ""},
+		{"digest mismatch", []byte("corrupted layer contents"), -1, "digest mismatch"},
+		{"too short", blob[:len(blob)-1], int64(len(blob)), "size mismatch"},
+		{"too long", append(blob, 'x'), int64(len(blob)), "larger than the expected size"},
+	} {
+		reader, err := NewVerifyingReader(io.NopCloser(bytes.NewReader(c.contents)), types.BlobInfo{Digest: blobDigest, Size: c.size})
+		require.NoError(t, err, c.name)
+		data, err := io.ReadAll(reader)
+		if c.errorMsg == "" {
+			require.NoError(t, err, c.name)
+			assert.Equal(t, blob, data, c.name)
+		} else {
+			assert.ErrorContains(t, err, c.errorMsg, c.name)
+		}
+		err = reader.Close()
+		assert.NoError(t, err, c.name)
+	}
+}
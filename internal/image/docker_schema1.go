@@ -63,6 +63,17 @@ func (m *manifestSchema1) OCIConfig(ctx context.Context) (*imgspecv1.Image, erro
 	return v2s2.OCIConfig(ctx)
 }
 
+// Platform returns the platform (OS, architecture, and where available variant, OS version and OS features)
+// the image is built for, as recorded in the image configuration.
+// Schema1 manifests have no separate configuration, so only the OS and architecture are returned.
+func (m *manifestSchema1) Platform(context.Context) (imgspecv1.Platform, error) {
+	info, err := m.m.Inspect(nil)
+	if err != nil {
+		return imgspecv1.Platform{}, err
+	}
+	return imgspecv1.Platform{OS: info.Os, Architecture: info.Architecture}, nil
+}
+
 // LayerInfos returns a list of BlobInfos of layers referenced by this image, in order (the root layer first, and then successive layered layers).
 // The Digest field is guaranteed to be provided; Size may be -1.
 // WARNING: The list may contain duplicates, and they are semantically relevant.
@@ -2,9 +2,11 @@ package image
 
 import (
 	"context"
+	"encoding/json"
 	"os"
 	"path/filepath"
 	"slices"
+	"strings"
 	"testing"
 	"time"
 
@@ -198,6 +200,17 @@ func TestManifestSchema1OCIConfig(t *testing.T) {
 	assert.Equal(t, "/pause", configOCI.Config.Entrypoint[0])
 }
 
+func TestManifestSchema1Platform(t *testing.T) {
+	for _, m := range []genericManifest{
+		manifestSchema1FromFixture(t, "schema1.json"),
+		manifestSchema1FromComponentsLikeFixture(t),
+	} {
+		platform, err := m.Platform(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, imgspecv1.Platform{OS: "linux", Architecture: "amd64"}, platform)
+	}
+}
+
 func TestManifestSchema1LayerInfo(t *testing.T) {
 	for _, m := range []genericManifest{
 		manifestSchema1FromFixture(t, "schema1.json"),
@@ -478,7 +491,7 @@ func TestManifestSchema1ConvertToSchema2(t *testing.T) {
 	assert.Equal(t, manifest.DockerV2Schema2MediaType, mt)
 	// Layers have been updated as expected
 	originalSrc := newSchema2ImageSource(t, "httpd:latest")
-	s2Manifest, err := manifestSchema2FromManifest(originalSrc, convertedJSON)
+	s2Manifest, err := manifestSchema2FromManifest(nil, originalSrc, convertedJSON)
 	require.NoError(t, err)
 	assert.Equal(t, []types.BlobInfo{
 		{
@@ -523,6 +536,60 @@ func TestManifestSchema1ConvertToSchema2(t *testing.T) {
 	// FIXME? Test also the various failure cases, if only to see that we don't crash?
 }
 
+func TestManifestSchema1ConversionPreservesHistory(t *testing.T) {
+	for _, c := range []struct {
+		fixture      string
+		layerInfos   []types.BlobInfo
+		layerDiffIDs []digest.Digest
+	}{
+		{"schema1.json", schema1FixtureLayerInfos, schema1FixtureLayerDiffIDs},
+		// Unlike schema1.json, this contains throwaway layers.
+		{"schema2-to-schema1-by-docker.json", schema1WithThrowawaysFixtureLayerInfos, schema1WithThrowawaysFixtureLayerDiffIDs},
+	} {
+		manifestBlob, err := os.ReadFile(filepath.Join("fixtures", c.fixture))
+		require.NoError(t, err, c.fixture)
+		s1, err := manifest.Schema1FromManifest(manifestBlob)
+		require.NoError(t, err, c.fixture)
+		// History in schema1 is ordered from the newest entry; schema2/OCI configs are ordered from the oldest one.
+		expectedHistory := []manifest.Schema2History{}
+		nonEmptyLayers := 0
+		for i := len(s1.ExtractedV1Compatibility) - 1; i >= 0; i-- {
+			compat := s1.ExtractedV1Compatibility[i]
+			expectedHistory = append(expectedHistory, manifest.Schema2History{
+				Created:    compat.Created,
+				CreatedBy:  strings.Join(compat.ContainerConfig.Cmd, " "),
+				Author:     compat.Author,
+				Comment:    compat.Comment,
+				EmptyLayer: compat.ThrowAway,
+			})
+			if !compat.ThrowAway {
+				nonEmptyLayers++
+			}
+		}
+
+		original := manifestSchema1FromFixture(t, c.fixture)
+		for _, mt := range []string{manifest.DockerV2Schema2MediaType, imgspecv1.MediaTypeImageManifest} {
+			res, err := original.UpdatedImage(context.Background(), types.ManifestUpdateOptions{
+				ManifestMIMEType: mt,
+				InformationOnly: types.ManifestUpdateInformation{
+					LayerInfos:   c.layerInfos,
+					LayerDiffIDs: c.layerDiffIDs,
+				},
+			})
+			require.NoError(t, err, c.fixture, mt)
+			configBlob, err := res.ConfigBlob(context.Background())
+			require.NoError(t, err, c.fixture, mt)
+			var config manifest.Schema2Image
+			err = json.Unmarshal(configBlob, &config)
+			require.NoError(t, err, c.fixture, mt)
+			assert.Equal(t, expectedHistory, config.History, c.fixture, mt)
+			require.NotNil(t, config.RootFS, c.fixture, mt)
+			assert.Len(t, config.RootFS.DiffIDs, nonEmptyLayers, c.fixture, mt)
+			assert.Len(t, res.LayerInfos(), nonEmptyLayers, c.fixture, mt)
+		}
+	}
+}
+
 func TestManifestSchema1ConvertToManifestOCI1(t *testing.T) {
 	original := manifestSchema1FromFixture(t, "schema1.json")
 	res, err := original.UpdatedImage(context.Background(), types.ManifestUpdateOptions{
@@ -565,7 +632,7 @@ func TestManifestSchema1ConvertToManifestOCI1(t *testing.T) {
 	assert.Equal(t, imgspecv1.MediaTypeImageManifest, mt)
 	// Layers have been updated as expected
 	originalSrc := newSchema2ImageSource(t, "httpd:latest")
-	ociManifest, err := manifestOCI1FromManifest(originalSrc, convertedJSON)
+	ociManifest, err := manifestOCI1FromManifest(nil, originalSrc, convertedJSON)
 	require.NoError(t, err)
 	assert.Equal(t, []types.BlobInfo{
 		{
@@ -610,7 +677,7 @@ func TestManifestSchema1ConvertToManifestOCI1(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, imgspecv1.MediaTypeImageManifest, mt)
 	// Layers have been updated as expected
-	ociManifest, err = manifestOCI1FromManifest(originalSrc, convertedJSON)
+	ociManifest, err = manifestOCI1FromManifest(nil, originalSrc, convertedJSON)
 	require.NoError(t, err)
 	assert.Equal(t, []types.BlobInfo{
 		{
@@ -37,19 +37,21 @@ var GzippedEmptyLayer = []byte{
 const GzippedEmptyLayerDigest = digest.Digest("sha256:a3ed95caeb02ffe68cdd9fd84406680ae93d633cb16422d00e8a7c22955b46d4")
 
 type manifestSchema2 struct {
-	src        types.ImageSource // May be nil if configBlob is not nil
-	configBlob []byte            // If set, corresponds to contents of ConfigDescriptor.
-	m          *manifest.Schema2
+	src             types.ImageSource // May be nil if configBlob is not nil
+	configBlob      []byte            // If set, corresponds to contents of ConfigDescriptor.
+	configSizeLimit int               // Maximum size of configBlob when reading it from src; 0 means iolimits.MaxConfigBodySize.
+	m               *manifest.Schema2
 }
 
-func manifestSchema2FromManifest(src types.ImageSource, manifestBlob []byte) (genericManifest, error) {
+func manifestSchema2FromManifest(sys *types.SystemContext, src types.ImageSource, manifestBlob []byte) (genericManifest, error) {
 	m, err := manifest.Schema2FromManifest(manifestBlob)
 	if err != nil {
 		return nil, err
 	}
 	return &manifestSchema2{
-		src: src,
-		m:   m,
+		src:             src,
+		configSizeLimit: iolimits.ConfigSizeLimit(sys),
+		m:               m,
 	}, nil
 }
 
@@ -101,16 +103,27 @@ func (m *manifestSchema2) ConfigBlob(ctx context.Context) ([]byte, error) {
 		if m.src == nil {
 			return nil, fmt.Errorf("Internal error: neither src nor configBlob set in manifestSchema2")
 		}
+		if err := m.m.ConfigDescriptor.Digest.Validate(); err != nil { // .Algorithm() might panic without this check
+			return nil, fmt.Errorf("invalid config digest %q: %w", m.m.ConfigDescriptor.Digest.String(), err)
+		}
+		digestAlgorithm := m.m.ConfigDescriptor.Digest.Algorithm()
+		if !digestAlgorithm.Available() {
+			return nil, fmt.Errorf("invalid config digest %q: unsupported digest algorithm %q", m.m.ConfigDescriptor.Digest.String(), digestAlgorithm.String())
+		}
 		stream, _, err := m.src.GetBlob(ctx, manifest.BlobInfoFromSchema2Descriptor(m.m.ConfigDescriptor), none.NoCache)
 		if err != nil {
 			return nil, err
 		}
 		defer stream.Close()
-		blob, err := iolimits.ReadAtMost(stream, iolimits.MaxConfigBodySize)
+		limit := m.configSizeLimit
+		if limit == 0 {
+			limit = iolimits.MaxConfigBodySize
+		}
+		blob, err := iolimits.ReadAtMost(stream, limit)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("reading config %s: %w", m.m.ConfigDescriptor.Digest, err)
 		}
-		computedDigest := digest.FromBytes(blob)
+		computedDigest := digestAlgorithm.FromBytes(blob)
 		if computedDigest != m.m.ConfigDescriptor.Digest {
 			return nil, fmt.Errorf("Download config.json digest %s does not match expected %s", computedDigest, m.m.ConfigDescriptor.Digest)
 		}
@@ -119,6 +132,16 @@ func (m *manifestSchema2) ConfigBlob(ctx context.Context) ([]byte, error) {
 	return m.configBlob, nil
 }
 
+// Platform returns the platform (OS, architecture, and where available variant, OS version and OS features)
+// the image is built for, as recorded in the image configuration.
+func (m *manifestSchema2) Platform(ctx context.Context) (imgspecv1.Platform, error) {
+	config, err := m.OCIConfig(ctx)
+	if err != nil {
+		return imgspecv1.Platform{}, err
+	}
+	return config.Platform, nil
+}
+
 // LayerInfos returns a list of BlobInfos of layers referenced by this image, in order (the root layer first, and then successive layered layers).
 // The Digest field is guaranteed to be provided; Size may be -1.
 // WARNING: The list may contain duplicates, and they are semantically relevant.
@@ -28,7 +28,7 @@ func manifestSchema2FromFixture(t *testing.T, src types.ImageSource, fixture str
 	manifest, err := os.ReadFile(filepath.Join("fixtures", fixture))
 	require.NoError(t, err)
 
-	m, err := manifestSchema2FromManifest(src, manifest)
+	m, err := manifestSchema2FromManifest(nil, src, manifest)
 	if mustFail {
 		require.Error(t, err)
 	} else {
@@ -76,7 +76,7 @@ func TestManifestSchema2FromManifest(t *testing.T) {
 	// values are correctly returned in tests for the individual getter methods.
 	_ = manifestSchema2FromFixture(t, mocks.ForbiddenImageSource{}, "schema2.json", false)
 
-	_, err := manifestSchema2FromManifest(nil, []byte{})
+	_, err := manifestSchema2FromManifest(nil, nil, []byte{})
 	assert.Error(t, err)
 }
 
@@ -193,6 +193,42 @@ func TestManifestSchema2ConfigBlob(t *testing.T) {
 	cb, err := m.ConfigBlob(context.Background())
 	require.NoError(t, err)
 	assert.Equal(t, configBlob, cb)
+
+	// A config exceeding the configured size limit
+	manifestBlob, err := os.ReadFile(filepath.Join("fixtures", "schema2.json"))
+	require.NoError(t, err)
+	src := configBlobImageSource{
+		expectedDigest: commonFixtureConfigDigest,
+		f: func() (io.ReadCloser, int64, error) {
+			return io.NopCloser(bytes.NewReader(realConfigJSON)), int64(len(realConfigJSON)), nil
+		},
+	}
+	m, err = manifestSchema2FromManifest(&types.SystemContext{MaxConfigSize: len(realConfigJSON) - 1}, src, manifestBlob)
+	require.NoError(t, err)
+	_, err = m.ConfigBlob(context.Background())
+	assert.ErrorContains(t, err, "exceeded maximum allowed size")
+}
+
+func TestManifestSchema2Platform(t *testing.T) {
+	configJSON, err := os.ReadFile("fixtures/schema2-config.json")
+	require.NoError(t, err)
+	m := manifestSchema2FromComponentsLikeFixture(configJSON)
+	platform, err := m.Platform(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, imgspecv1.Platform{OS: "linux", Architecture: "amd64"}, platform)
+
+	configJSON, err = os.ReadFile("fixtures/schema2-config-platform.json")
+	require.NoError(t, err)
+	m = manifestSchema2FromComponentsLikeFixture(configJSON)
+	platform, err = m.Platform(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, imgspecv1.Platform{
+		OS:           "windows",
+		Architecture: "arm",
+		Variant:      "v7",
+		OSVersion:    "10.0.14393.1066",
+		OSFeatures:   []string{"win32k"},
+	}, platform)
 }
 
 func TestManifestSchema2LayerInfo(t *testing.T) {
@@ -532,7 +568,7 @@ func TestConvertToManifestOCI(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, imgspecv1.MediaTypeImageManifest, mt)
 	// Layers have been updated as expected
-	ociManifest, err := manifestOCI1FromManifest(originalSrc, convertedJSON)
+	ociManifest, err := manifestOCI1FromManifest(nil, originalSrc, convertedJSON)
 	require.NoError(t, err)
 	assert.Equal(t, []types.BlobInfo{
 		{
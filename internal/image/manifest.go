@@ -2,9 +2,11 @@ package image
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/containers/image/v5/docker/reference"
+	internalManifest "github.com/containers/image/v5/internal/manifest"
 	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/types"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
@@ -53,6 +55,11 @@ type genericManifest interface {
 	// The following methods are not a part of types.Image:
 	// ===
 
+	// Platform returns the platform (OS, architecture, and where available variant, OS version and OS features)
+	// the image is built for, as recorded in the image configuration.
+	// For docker v2s1 images, which have no separate configuration, only the OS and architecture are returned.
+	Platform(context.Context) (imgspecv1.Platform, error)
+
 	// CanChangeLayerCompression returns true if we can compress/decompress layers with mimeType in the current image
 	// (and the code can handle that).
 	// NOTE: Even if this returns true, the relevant format might not accept all compression algorithms; the set of accepted
@@ -64,13 +71,20 @@ type genericManifest interface {
 // manifestInstanceFromBlob returns a genericManifest implementation for (manblob, mt) in src.
 // If manblob is a manifest list, it implicitly chooses an appropriate image from the list.
 func manifestInstanceFromBlob(ctx context.Context, sys *types.SystemContext, src types.ImageSource, manblob []byte, mt string) (genericManifest, error) {
+	var m genericManifest
+	var err error
 	switch manifest.NormalizedMIMEType(mt) {
 	case manifest.DockerV2Schema1MediaType, manifest.DockerV2Schema1SignedMediaType:
-		return manifestSchema1FromManifest(manblob)
+		// NormalizedMIMEType treats missing, generic or unknown MIME types as schema1; in that case, only refuse actual schema1 manifests.
+		if sys != nil && sys.DisableSchema1 &&
+			(internalManifest.MIMETypeIsSchema1(mt) || internalManifest.MIMETypeIsSchema1(internalManifest.GuessMIMEType(manblob))) {
+			return nil, errors.New("the image uses a deprecated Docker schema1 manifest, which is disabled by SystemContext.DisableSchema1")
+		}
+		m, err = manifestSchema1FromManifest(manblob)
 	case imgspecv1.MediaTypeImageManifest:
-		return manifestOCI1FromManifest(src, manblob)
+		m, err = manifestOCI1FromManifest(sys, src, manblob)
 	case manifest.DockerV2Schema2MediaType:
-		return manifestSchema2FromManifest(src, manblob)
+		m, err = manifestSchema2FromManifest(sys, src, manblob)
 	case manifest.DockerV2ListMediaType:
 		return manifestSchema2FromManifestList(ctx, sys, src, manblob)
 	case imgspecv1.MediaTypeImageIndex:
@@ -78,6 +92,13 @@ func manifestInstanceFromBlob(ctx context.Context, sys *types.SystemContext, src
 	default: // Note that this may not be reachable, manifest.NormalizedMIMEType has a default for unknown values.
 		return nil, fmt.Errorf("Unimplemented manifest MIME type %q", mt)
 	}
+	if err != nil {
+		return nil, err
+	}
+	if err := internalManifest.ValidateLayerCount(len(m.LayerInfos()), internalManifest.LayerCountLimit(sys)); err != nil {
+		return nil, err
+	}
+	return m, nil
 }
 
 // manifestLayerInfosToBlobInfos extracts a []types.BlobInfo from a []manifest.LayerInfo.
@@ -1,11 +1,16 @@
 package image
 
 import (
+	"context"
+	"os"
+	"path/filepath"
 	"testing"
 
+	internalManifest "github.com/containers/image/v5/internal/manifest"
 	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/types"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestManifestLayerInfosToBlobInfos(t *testing.T) {
@@ -69,3 +74,73 @@ func TestManifestLayerInfosToBlobInfos(t *testing.T) {
 		},
 	}, blobs)
 }
+
+func TestManifestInstanceFromBlobDisableSchema1(t *testing.T) {
+	manifestBlob, err := os.ReadFile(filepath.Join("fixtures", "schema1.json"))
+	require.NoError(t, err)
+
+	for _, sys := range []*types.SystemContext{nil, {}} {
+		m, err := manifestInstanceFromBlob(context.Background(), sys, nil, manifestBlob, manifest.DockerV2Schema1SignedMediaType)
+		require.NoError(t, err)
+		assert.Equal(t, manifest.DockerV2Schema1SignedMediaType, m.manifestMIMEType())
+	}
+
+	_, err = manifestInstanceFromBlob(context.Background(), &types.SystemContext{DisableSchema1: true}, nil, manifestBlob, manifest.DockerV2Schema1SignedMediaType)
+	assert.Error(t, err)
+}
+
+func TestManifestInstanceFromBlobMaxLayerCount(t *testing.T) {
+	manifestBlob, err := os.ReadFile(filepath.Join("fixtures", "schema2.json"))
+	require.NoError(t, err)
+	m, err := manifestInstanceFromBlob(context.Background(), nil, nil, manifestBlob, manifest.DockerV2Schema2MediaType)
+	require.NoError(t, err)
+	layerCount := len(m.LayerInfos())
+
+	for _, c := range []struct {
+		limit       int
+		expectError bool
+	}{
+		{0, false},
+		{layerCount, false},
+		{layerCount - 1, true},
+		{internalManifest.MaxLayerCount + 1, false},
+	} {
+		_, err := manifestInstanceFromBlob(context.Background(), &types.SystemContext{MaxLayerCount: c.limit}, nil, manifestBlob, manifest.DockerV2Schema2MediaType)
+		if c.expectError {
+			assert.Error(t, err, c.limit)
+		} else {
+			assert.NoError(t, err, c.limit)
+		}
+	}
+
+	// Manifests with more layers than the default limit
+	s2, err := manifest.Schema2FromManifest(manifestBlob)
+	require.NoError(t, err)
+	for _, c := range []struct {
+		layers      int
+		limit       int
+		expectError bool
+	}{
+		{internalManifest.MaxLayerCount, 0, false},
+		{internalManifest.MaxLayerCount + 1, 0, true},
+		{internalManifest.MaxLayerCount + 1, internalManifest.MaxLayerCount + 1, false},
+		{internalManifest.MaxLayerCount + 2, internalManifest.MaxLayerCount + 1, true},
+	} {
+		layers := make([]manifest.Schema2Descriptor, c.layers)
+		for i := range layers {
+			layers[i] = s2.LayersDescriptors[0]
+		}
+		many := manifest.Schema2FromComponents(s2.ConfigDescriptor, layers)
+		manyBlob, err := many.Serialize()
+		require.NoError(t, err)
+		// The public parser accepts any number of layers.
+		_, err = manifest.Schema2FromManifest(manyBlob)
+		require.NoError(t, err)
+		_, err = manifestInstanceFromBlob(context.Background(), &types.SystemContext{MaxLayerCount: c.limit}, nil, manyBlob, manifest.DockerV2Schema2MediaType)
+		if c.expectError {
+			assert.Error(t, err, "%d/%d", c.layers, c.limit)
+		} else {
+			assert.NoError(t, err, "%d/%d", c.layers, c.limit)
+		}
+	}
+}
@@ -14,24 +14,25 @@ import (
 	"github.com/containers/image/v5/pkg/blobinfocache/none"
 	"github.com/containers/image/v5/types"
 	ociencspec "github.com/containers/ocicrypt/spec"
-	"github.com/opencontainers/go-digest"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 type manifestOCI1 struct {
-	src        types.ImageSource // May be nil if configBlob is not nil
-	configBlob []byte            // If set, corresponds to contents of m.Config.
-	m          *manifest.OCI1
+	src             types.ImageSource // May be nil if configBlob is not nil
+	configBlob      []byte            // If set, corresponds to contents of m.Config.
+	configSizeLimit int               // Maximum size of configBlob when reading it from src; 0 means iolimits.MaxConfigBodySize.
+	m               *manifest.OCI1
 }
 
-func manifestOCI1FromManifest(src types.ImageSource, manifestBlob []byte) (genericManifest, error) {
+func manifestOCI1FromManifest(sys *types.SystemContext, src types.ImageSource, manifestBlob []byte) (genericManifest, error) {
 	m, err := manifest.OCI1FromManifest(manifestBlob)
 	if err != nil {
 		return nil, err
 	}
 	return &manifestOCI1{
-		src: src,
-		m:   m,
+		src:             src,
+		configSizeLimit: iolimits.ConfigSizeLimit(sys),
+		m:               m,
 	}, nil
 }
 
@@ -65,16 +66,27 @@ func (m *manifestOCI1) ConfigBlob(ctx context.Context) ([]byte, error) {
 		if m.src == nil {
 			return nil, errors.New("Internal error: neither src nor configBlob set in manifestOCI1")
 		}
+		if err := m.m.Config.Digest.Validate(); err != nil { // .Algorithm() might panic without this check
+			return nil, fmt.Errorf("invalid config digest %q: %w", m.m.Config.Digest.String(), err)
+		}
+		digestAlgorithm := m.m.Config.Digest.Algorithm()
+		if !digestAlgorithm.Available() {
+			return nil, fmt.Errorf("invalid config digest %q: unsupported digest algorithm %q", m.m.Config.Digest.String(), digestAlgorithm.String())
+		}
 		stream, _, err := m.src.GetBlob(ctx, manifest.BlobInfoFromOCI1Descriptor(m.m.Config), none.NoCache)
 		if err != nil {
 			return nil, err
 		}
 		defer stream.Close()
-		blob, err := iolimits.ReadAtMost(stream, iolimits.MaxConfigBodySize)
+		limit := m.configSizeLimit
+		if limit == 0 {
+			limit = iolimits.MaxConfigBodySize
+		}
+		blob, err := iolimits.ReadAtMost(stream, limit)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("reading config %s: %w", m.m.Config.Digest, err)
 		}
-		computedDigest := digest.FromBytes(blob)
+		computedDigest := digestAlgorithm.FromBytes(blob)
 		if computedDigest != m.m.Config.Digest {
 			return nil, fmt.Errorf("Download config.json digest %s does not match expected %s", computedDigest, m.m.Config.Digest)
 		}
@@ -102,6 +114,16 @@ func (m *manifestOCI1) OCIConfig(ctx context.Context) (*imgspecv1.Image, error)
 	return configOCI, nil
 }
 
+// Platform returns the platform (OS, architecture, and where available variant, OS version and OS features)
+// the image is built for, as recorded in the image configuration.
+func (m *manifestOCI1) Platform(ctx context.Context) (imgspecv1.Platform, error) {
+	config, err := m.OCIConfig(ctx)
+	if err != nil {
+		return imgspecv1.Platform{}, err
+	}
+	return config.Platform, nil
+}
+
 // LayerInfos returns a list of BlobInfos of layers referenced by this image, in order (the root layer first, and then successive layered layers).
 // The Digest field is guaranteed to be provided; Size may be -1.
 // WARNING: The list may contain duplicates, and they are semantically relevant.
@@ -300,7 +322,9 @@ func (m *manifestOCI1) convertToManifestSchema2(_ context.Context, options *type
 	// Rather than copying the ConfigBlob now, we just pass m.src to the
 	// translated manifest, since the only difference is the mediatype of
 	// descriptors there is no change to any blob stored in m.src.
-	return manifestSchema2FromComponents(config, m.src, nil, layers), nil
+	res := manifestSchema2FromComponents(config, m.src, nil, layers)
+	res.configSizeLimit = m.configSizeLimit
+	return res, nil
 }
 
 // convertToManifestSchema1 returns a genericManifest implementation converted to manifest.DockerV2Schema1{Signed,}MediaType.
@@ -28,7 +28,7 @@ func manifestOCI1FromFixture(t *testing.T, src types.ImageSource, fixture string
 	manifest, err := os.ReadFile(filepath.Join("fixtures", fixture))
 	require.NoError(t, err)
 
-	m, err := manifestOCI1FromManifest(src, manifest)
+	m, err := manifestOCI1FromManifest(nil, src, manifest)
 	require.NoError(t, err)
 	return m
 }
@@ -96,7 +96,7 @@ func TestManifestOCI1FromManifest(t *testing.T) {
 	// values are correctly returned in tests for the individual getter methods.
 	_ = manifestOCI1FromFixture(t, mocks.ForbiddenImageSource{}, "oci1.json")
 
-	_, err := manifestOCI1FromManifest(nil, []byte{})
+	_, err := manifestOCI1FromManifest(nil, nil, []byte{})
 	assert.Error(t, err)
 }
 
@@ -202,6 +202,20 @@ func TestManifestOCI1ConfigBlob(t *testing.T) {
 	cb, err := m.ConfigBlob(context.Background())
 	require.NoError(t, err)
 	assert.Equal(t, configBlob, cb)
+
+	// A config exceeding the configured size limit
+	manifestBlob, err := os.ReadFile(filepath.Join("fixtures", "oci1.json"))
+	require.NoError(t, err)
+	src := configBlobImageSource{
+		expectedDigest: commonFixtureConfigDigest,
+		f: func() (io.ReadCloser, int64, error) {
+			return io.NopCloser(bytes.NewReader(realConfigJSON)), int64(len(realConfigJSON)), nil
+		},
+	}
+	m, err = manifestOCI1FromManifest(&types.SystemContext{MaxConfigSize: len(realConfigJSON) - 1}, src, manifestBlob)
+	require.NoError(t, err)
+	_, err = m.ConfigBlob(context.Background())
+	assert.ErrorContains(t, err, "exceeded maximum allowed size")
 }
 
 func TestManifestOCI1OCIConfig(t *testing.T) {
@@ -242,6 +256,28 @@ func TestManifestOCI1OCIConfig(t *testing.T) {
 	assert.ErrorAs(t, err, &expected)
 }
 
+func TestManifestOCI1Platform(t *testing.T) {
+	configJSON, err := os.ReadFile("fixtures/oci1-config.json")
+	require.NoError(t, err)
+	m := manifestOCI1FromComponentsLikeFixture(configJSON)
+	platform, err := m.Platform(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, imgspecv1.Platform{OS: "linux", Architecture: "amd64"}, platform)
+
+	configJSON, err = os.ReadFile("fixtures/oci1-config-platform.json")
+	require.NoError(t, err)
+	m = manifestOCI1FromComponentsLikeFixture(configJSON)
+	platform, err = m.Platform(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, imgspecv1.Platform{
+		OS:           "windows",
+		Architecture: "arm64",
+		Variant:      "v8",
+		OSVersion:    "10.0.17763.1879",
+		OSFeatures:   []string{"win32k"},
+	}, platform)
+}
+
 func TestManifestOCI1LayerInfo(t *testing.T) {
 	for _, m := range []genericManifest{
 		manifestOCI1FromFixture(t, mocks.ForbiddenImageSource{}, "oci1.json"),
@@ -723,7 +759,7 @@ func TestConvertToManifestSchema2(t *testing.T) {
 	convertedJSON, mt, err = res.Manifest(context.Background())
 	require.NoError(t, err)
 	assert.Equal(t, manifest.DockerV2Schema2MediaType, mt)
-	s2Manifest, err := manifestSchema2FromManifest(originalSrc, convertedJSON)
+	s2Manifest, err := manifestSchema2FromManifest(nil, originalSrc, convertedJSON)
 	require.NoError(t, err)
 	assert.Equal(t, []types.BlobInfo{
 		{
@@ -777,7 +813,7 @@ func TestConvertToManifestSchema2(t *testing.T) {
 	convertedJSON, mt, err = res.Manifest(context.Background())
 	require.NoError(t, err)
 	assert.Equal(t, manifest.DockerV2Schema2MediaType, mt)
-	s2Manifest, err = manifestSchema2FromManifest(mixedSrc, convertedJSON)
+	s2Manifest, err = manifestSchema2FromManifest(nil, mixedSrc, convertedJSON)
 	require.NoError(t, err)
 	assert.Equal(t, []types.BlobInfo{
 		{
@@ -826,7 +862,7 @@ func TestConvertToManifestSchema2(t *testing.T) {
 	convertedJSON, mt, err = res.Manifest(context.Background())
 	require.NoError(t, err)
 	assert.Equal(t, manifest.DockerV2Schema2MediaType, mt)
-	s2Manifest, err = manifestSchema2FromManifest(mixedSrc, convertedJSON)
+	s2Manifest, err = manifestSchema2FromManifest(nil, mixedSrc, convertedJSON)
 	require.NoError(t, err)
 	assert.Equal(t, []types.BlobInfo{
 		{
@@ -872,7 +908,7 @@ func TestConvertToV2S2WithInvalidMIMEType(t *testing.T) {
 	manifest, err := os.ReadFile(filepath.Join("fixtures", "oci1-invalid-media-type.json"))
 	require.NoError(t, err)
 
-	_, err = manifestOCI1FromManifest(originalSrc, manifest)
+	_, err = manifestOCI1FromManifest(nil, originalSrc, manifest)
 	require.NoError(t, err)
 }
 
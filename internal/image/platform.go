@@ -0,0 +1,27 @@
+package image
+
+import (
+	"context"
+
+	"github.com/containers/image/v5/types"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Platform returns the platform (OS, architecture, and where available variant, OS version and OS features)
+// img is built for, as recorded in the image configuration.
+// For docker v2s1 images, which have no separate configuration, only the OS and architecture are returned.
+//
+// This is publicly visible as c/image/image.Platform.
+func Platform(ctx context.Context, img types.Image) (imgspecv1.Platform, error) {
+	if ic, ok := img.(*imageCloser); ok {
+		img = ic.Image
+	}
+	if m, ok := img.(genericManifest); ok { // Avoid converting docker v2s1 images just to read their config.
+		return m.Platform(ctx)
+	}
+	config, err := img.OCIConfig(ctx)
+	if err != nil {
+		return imgspecv1.Platform{}, err
+	}
+	return config.Platform, nil
+}
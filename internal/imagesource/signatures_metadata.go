@@ -0,0 +1,39 @@
+package imagesource
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/signature"
+	"github.com/opencontainers/go-digest"
+)
+
+// SignaturesMetadata returns metadata of the signatures of src (or of instanceDigest, if not nil).
+// It uses private.SignatureMetadataSource if src implements it, and otherwise reads all signatures in full.
+func SignaturesMetadata(ctx context.Context, src private.ImageSource, instanceDigest *digest.Digest) ([]private.SignatureMetadata, error) {
+	if metadataSrc, ok := src.(private.SignatureMetadataSource); ok {
+		return metadataSrc.GetSignaturesMetadata(ctx, instanceDigest)
+	}
+	sigs, err := src.GetSignaturesWithFormat(ctx, instanceDigest)
+	if err != nil {
+		return nil, err
+	}
+	return MetadataOfSignatures(sigs)
+}
+
+// MetadataOfSignatures returns metadata of sigs, which have already been read in full.
+func MetadataOfSignatures(sigs []signature.Signature) ([]private.SignatureMetadata, error) {
+	res := make([]private.SignatureMetadata, 0, len(sigs))
+	for i, sig := range sigs {
+		blob, err := signature.Blob(sig)
+		if err != nil {
+			return nil, fmt.Errorf("serializing signature %d: %w", i+1, err)
+		}
+		res = append(res, private.SignatureMetadata{
+			Format: string(sig.FormatID()),
+			Size:   int64(len(blob)),
+		})
+	}
+	return res, nil
+}
@@ -3,6 +3,8 @@ package iolimits
 import (
 	"fmt"
 	"io"
+
+	"github.com/containers/image/v5/types"
 )
 
 // All constants below are intended to be used as limits for `ReadAtMost`. The
@@ -39,6 +41,12 @@ const (
 	// MaxTarFileManifestSize is the maximum allowed size of a (docker save)-like manifest (which may contain multiple images)
 	// The limit of 1 MB is considered to be greatly sufficient.
 	MaxTarFileManifestSize = megaByte
+	// MaxSBOMBodySize is the maximum allowed size of an SBOM read from a registry.
+	// SBOMs of large images can be quite big, so the limit of 64 MB is generous.
+	MaxSBOMBodySize = 64 * megaByte
+	// MaxReadFileSize is the maximum allowed size of a file read from a layer by image.ReadFile.
+	// The function is intended for configuration files and similar metadata, so the limit of 64 MB is generous.
+	MaxReadFileSize = 64 * megaByte
 )
 
 // ReadAtMost reads from reader and errors out if the specified limit (in bytes) is exceeded.
@@ -56,3 +64,27 @@ func ReadAtMost(reader io.Reader, limit int) ([]byte, error) {
 
 	return res, nil
 }
+
+// ManifestSizeLimit returns the maximum allowed size of a manifest, as configured by sys.
+func ManifestSizeLimit(sys *types.SystemContext) int {
+	if sys != nil && sys.MaxManifestSize > 0 {
+		return sys.MaxManifestSize
+	}
+	return MaxManifestBodySize
+}
+
+// ConfigSizeLimit returns the maximum allowed size of a config blob, as configured by sys.
+func ConfigSizeLimit(sys *types.SystemContext) int {
+	if sys != nil && sys.MaxConfigSize > 0 {
+		return sys.MaxConfigSize
+	}
+	return MaxConfigBodySize
+}
+
+// ReadFileSizeLimit returns the maximum allowed size of a file read by image.ReadFile, as configured by sys.
+func ReadFileSizeLimit(sys *types.SystemContext) int {
+	if sys != nil && sys.MaxReadFileSize > 0 {
+		return sys.MaxReadFileSize
+	}
+	return MaxReadFileSize
+}
@@ -5,6 +5,7 @@ import (
 	"math/rand"
 	"testing"
 
+	"github.com/containers/image/v5/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -35,3 +36,21 @@ func TestReadAtMost(t *testing.T) {
 		}
 	}
 }
+
+func TestManifestSizeLimit(t *testing.T) {
+	assert.Equal(t, MaxManifestBodySize, ManifestSizeLimit(nil))
+	assert.Equal(t, MaxManifestBodySize, ManifestSizeLimit(&types.SystemContext{}))
+	assert.Equal(t, 1234, ManifestSizeLimit(&types.SystemContext{MaxManifestSize: 1234}))
+}
+
+func TestConfigSizeLimit(t *testing.T) {
+	assert.Equal(t, MaxConfigBodySize, ConfigSizeLimit(nil))
+	assert.Equal(t, MaxConfigBodySize, ConfigSizeLimit(&types.SystemContext{}))
+	assert.Equal(t, 1234, ConfigSizeLimit(&types.SystemContext{MaxConfigSize: 1234}))
+}
+
+func TestReadFileSizeLimit(t *testing.T) {
+	assert.Equal(t, MaxReadFileSize, ReadFileSizeLimit(nil))
+	assert.Equal(t, MaxReadFileSize, ReadFileSizeLimit(&types.SystemContext{}))
+	assert.Equal(t, 1234, ReadFileSizeLimit(&types.SystemContext{MaxReadFileSize: 1234}))
+}
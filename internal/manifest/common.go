@@ -3,6 +3,8 @@ package manifest
 import (
 	"encoding/json"
 	"fmt"
+
+	"github.com/containers/image/v5/types"
 )
 
 // AllowedManifestFields is a bit mask of “essential” manifest fields that ValidateUnambiguousManifestFormat
@@ -70,3 +72,25 @@ func ValidateUnambiguousManifestFormat(manifest []byte, expectedMIMEType string,
 	}
 	return nil
 }
+
+// MaxLayerCount is the default maximum number of layers accepted in a single-image manifest read from an image source,
+// if SystemContext.MaxLayerCount is not set.
+// This is far more than any practical image uses; the limit exists to reject manifests designed
+// to trigger huge allocations when processing the layers.
+const MaxLayerCount = 1024
+
+// LayerCountLimit returns the maximum allowed number of layers in a single-image manifest, as configured by sys.
+func LayerCountLimit(sys *types.SystemContext) int {
+	if sys != nil && sys.MaxLayerCount > 0 {
+		return sys.MaxLayerCount
+	}
+	return MaxLayerCount
+}
+
+// ValidateLayerCount returns an error if count, the number of layers in a manifest, exceeds limit.
+func ValidateLayerCount(count, limit int) error {
+	if count > limit {
+		return fmt.Errorf("manifest has %d layers, more than the maximum of %d", count, limit)
+	}
+	return nil
+}
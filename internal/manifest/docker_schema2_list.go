@@ -3,6 +3,7 @@ package manifest
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"slices"
 
 	platform "github.com/containers/image/v5/internal/pkg/platform"
@@ -154,14 +155,24 @@ func (list *Schema2ListPublic) ChooseInstanceByCompression(ctx *types.SystemCont
 func (list *Schema2ListPublic) ChooseInstance(ctx *types.SystemContext) (digest.Digest, error) {
 	wantedPlatforms := platform.WantedPlatforms(ctx)
 	for _, wantedPlatform := range wantedPlatforms {
+		var bestMatch digest.Digest
+		bestOSVersionRank := math.MaxInt
 		for _, d := range list.Manifests {
 			imagePlatform := ociPlatformFromSchema2PlatformSpec(d.Platform)
-			if platform.MatchesPlatform(imagePlatform, wantedPlatform) {
-				return d.Digest, nil
+			if !platform.MatchesPlatform(imagePlatform, wantedPlatform) {
+				continue
 			}
+			if osVersionRank, ok := platform.OSVersionRank(ctx, imagePlatform.OSVersion); ok && osVersionRank < bestOSVersionRank {
+				bestMatch = d.Digest
+				bestOSVersionRank = osVersionRank
+			}
+		}
+		if bestMatch != "" {
+			return bestMatch, nil
 		}
 	}
-	return "", fmt.Errorf("no image found in manifest list for architecture %q, variant %q, OS %q", wantedPlatforms[0].Architecture, wantedPlatforms[0].Variant, wantedPlatforms[0].OS)
+	return "", fmt.Errorf("no image found in manifest list for architecture %q, variant %q, OS %q%s", wantedPlatforms[0].Architecture, wantedPlatforms[0].Variant, wantedPlatforms[0].OS,
+		platform.OSVersionDescription(ctx))
 }
 
 // Serialize returns the list in a blob format.
@@ -159,3 +159,61 @@ func TestChooseInstance(t *testing.T) {
 		}
 	}
 }
+
+func TestChooseInstanceOSVersion(t *testing.T) {
+	const (
+		ltsc2022       = "sha256:961cd3a6bd93d32eb54d31971dddabdfef1900d2b89dc8dd96fee2d173d641bd" // 10.0.20348.643
+		ltsc2019       = "sha256:5edcbed5623306cfb0d718243bbb13a7f77cfc4af6b46bb965eb036b78409316" // 10.0.17763.1879
+		ltsc2019Update = "sha256:0584e06819fdfa28ec93661c45e65f62111f453d37cd5e55d1fe388d1b110500" // 10.0.17763.2000
+		linux          = "sha256:a5720b342702fd21a4ace9d3018d865c57e21b6b01eb5c500f03c3cbd8e52b3a"
+	)
+	for _, listFile := range []string{"schema2list-windows.json", "oci1index-windows.json"} {
+		rawManifest, err := os.ReadFile(filepath.Join("testdata", listFile))
+		require.NoError(t, err)
+		list, err := ListFromBlob(rawManifest, GuessMIMEType(rawManifest))
+		require.NoError(t, err)
+
+		for _, c := range []struct {
+			os, osVersion string
+			match         types.OSVersionMatch
+			expected      digest.Digest // or "" if no instance is acceptable
+		}{
+			// No OS version specified: the first matching instance
+			{"windows", "", types.OSVersionMatchPreferred, ltsc2022},
+			{"windows", "", types.OSVersionMatchExact, ltsc2022},
+			// An exact match is preferred over an earlier instance with the same build
+			{"windows", "10.0.17763.2000", types.OSVersionMatchPreferred, ltsc2019Update},
+			{"windows", "10.0.17763.2000", types.OSVersionMatchBuild, ltsc2019Update},
+			{"windows", "10.0.17763.2000", types.OSVersionMatchExact, ltsc2019Update},
+			{"windows", "10.0.20348.643", types.OSVersionMatchExact, ltsc2022},
+			// The same build is preferred over other builds
+			{"windows", "10.0.17763.3000", types.OSVersionMatchPreferred, ltsc2019},
+			{"windows", "10.0.17763.3000", types.OSVersionMatchBuild, ltsc2019},
+			{"windows", "10.0.17763", types.OSVersionMatchBuild, ltsc2019},
+			{"windows", "10.0.17763.3000", types.OSVersionMatchExact, ""},
+			// No matching build
+			{"windows", "10.0.19041.1", types.OSVersionMatchPreferred, ltsc2022},
+			{"windows", "10.0.19041.1", types.OSVersionMatchBuild, ""},
+			{"windows", "10.0.19041.1", types.OSVersionMatchExact, ""},
+			// Instances without an os.version are accepted
+			{"linux", "10.0.19041.1", types.OSVersionMatchExact, linux},
+		} {
+			testName := fmt.Sprintf("%s %s %q %d", listFile, c.os, c.osVersion, c.match)
+			sys := &types.SystemContext{
+				ArchitectureChoice: "amd64",
+				OSChoice:           c.os,
+				OSVersionChoice:    c.osVersion,
+				OSVersionMatch:     c.match,
+			}
+			for _, preferGzip := range []types.OptionalBool{types.OptionalBoolUndefined, types.OptionalBoolTrue, types.OptionalBoolFalse} {
+				res, err := list.ChooseInstanceByCompression(sys, preferGzip)
+				if c.expected == "" {
+					assert.ErrorContains(t, err, c.osVersion, testName)
+				} else {
+					require.NoError(t, err, testName)
+					assert.Equal(t, c.expected, res, testName)
+				}
+			}
+		}
+	}
+}
@@ -168,6 +168,18 @@ func NormalizedMIMEType(input string) string {
 	}
 }
 
+// MIMETypeIsSchema1 returns true if mimeType is a Docker schema1 manifest MIME type.
+// Unlike NormalizedMIMEType, this does not treat missing, generic or unknown MIME types as schema1;
+// callers processing manifests with such MIME types should use GuessMIMEType instead.
+func MIMETypeIsSchema1(mimeType string) bool {
+	switch mimeType {
+	case DockerV2Schema1MediaType, DockerV2Schema1SignedMediaType:
+		return true
+	default:
+		return false
+	}
+}
+
 // CompressionAlgorithmIsUniversallySupported returns true if MIMETypeSupportsCompressionAlgorithm(mimeType, algo) returns true for all mimeType values.
 func CompressionAlgorithmIsUniversallySupported(algo compressiontypes.Algorithm) bool {
 	// Compare the discussion about BaseVariantName in MIMETypeSupportsCompressionAlgorithm().
@@ -135,6 +135,27 @@ func TestNormalizedMIMEType(t *testing.T) {
 	}
 }
 
+func TestMIMETypeIsSchema1(t *testing.T) {
+	for _, c := range []struct {
+		mt       string
+		expected bool
+	}{
+		{DockerV2Schema1MediaType, true},
+		{DockerV2Schema1SignedMediaType, true},
+		{"application/json", false},
+		{"text/plain", false},
+		{"application/octet-stream", false},
+		{"", false},
+		{DockerV2Schema2MediaType, false},
+		{DockerV2ListMediaType, false},
+		{imgspecv1.MediaTypeImageManifest, false},
+		{imgspecv1.MediaTypeImageIndex, false},
+	} {
+		res := MIMETypeIsSchema1(c.mt)
+		assert.Equal(t, c.expected, res, c.mt)
+	}
+}
+
 func TestCompressionAlgorithmIsUniversallySupported(t *testing.T) {
 	for _, algo := range []compression.Algorithm{compression.Gzip} {
 		res := CompressionAlgorithmIsUniversallySupported(algo)
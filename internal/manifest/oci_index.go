@@ -208,6 +208,7 @@ func instanceIsZstd(manifest imgspecv1.Descriptor) bool {
 
 type instanceCandidate struct {
 	platformIndex    int           // Index of the candidate in platform.WantedPlatforms: lower numbers are preferred; or math.maxInt if the candidate doesn’t have a platform
+	osVersionRank    int           // The result of platform.OSVersionRank: lower numbers are preferred
 	isZstd           bool          // tells if particular instance if zstd instance
 	manifestPosition int           // A zero-based index of the instance in the manifest list
 	digest           digest.Digest // Instance digest
@@ -217,6 +218,8 @@ func (ic instanceCandidate) isPreferredOver(other *instanceCandidate, preferGzip
 	switch {
 	case ic.platformIndex != other.platformIndex:
 		return ic.platformIndex < other.platformIndex
+	case ic.osVersionRank != other.osVersionRank:
+		return ic.osVersionRank < other.osVersionRank
 	case ic.isZstd != other.isZstd:
 		if !preferGzip {
 			return ic.isZstd
@@ -241,6 +244,7 @@ func (index *OCI1IndexPublic) chooseInstance(ctx *types.SystemContext, preferGzi
 	bestMatch = nil
 	for manifestIndex, d := range index.Manifests {
 		candidate := instanceCandidate{platformIndex: math.MaxInt, manifestPosition: manifestIndex, isZstd: instanceIsZstd(d), digest: d.Digest}
+		imageOSVersion := ""
 		if d.Platform != nil {
 			imagePlatform := ociPlatformClone(*d.Platform)
 			platformIndex := slices.IndexFunc(wantedPlatforms, func(wantedPlatform imgspecv1.Platform) bool {
@@ -250,7 +254,13 @@ func (index *OCI1IndexPublic) chooseInstance(ctx *types.SystemContext, preferGzi
 				continue
 			}
 			candidate.platformIndex = platformIndex
+			imageOSVersion = imagePlatform.OSVersion
 		}
+		osVersionRank, ok := platform.OSVersionRank(ctx, imageOSVersion)
+		if !ok {
+			continue
+		}
+		candidate.osVersionRank = osVersionRank
 		if bestMatch == nil || candidate.isPreferredOver(bestMatch, didPreferGzip) {
 			bestMatch = &candidate
 		}
@@ -258,7 +268,8 @@ func (index *OCI1IndexPublic) chooseInstance(ctx *types.SystemContext, preferGzi
 	if bestMatch != nil {
 		return bestMatch.digest, nil
 	}
-	return "", fmt.Errorf("no image found in image index for architecture %q, variant %q, OS %q", wantedPlatforms[0].Architecture, wantedPlatforms[0].Variant, wantedPlatforms[0].OS)
+	return "", fmt.Errorf("no image found in image index for architecture %q, variant %q, OS %q%s", wantedPlatforms[0].Architecture, wantedPlatforms[0].Variant, wantedPlatforms[0].OS,
+		platform.OSVersionDescription(ctx))
 }
 
 func (index *OCI1Index) ChooseInstanceByCompression(ctx *types.SystemContext, preferGzip types.OptionalBool) (digest.Digest, error) {
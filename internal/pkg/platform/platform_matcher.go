@@ -221,3 +221,36 @@ func MatchesPlatform(image imgspecv1.Platform, wanted imgspecv1.Platform) bool {
 		image.OS == wanted.OS &&
 		image.Variant == wanted.Variant
 }
+
+// OSVersionRank returns how well imageOSVersion, the os.version of an instance matching the wanted platform, matches ctx.OSVersionChoice:
+// candidates with lower values are preferred. It returns false if the instance is not acceptable per ctx.OSVersionMatch.
+func OSVersionRank(ctx *types.SystemContext, imageOSVersion string) (int, bool) {
+	if ctx == nil || ctx.OSVersionChoice == "" {
+		return 0, true
+	}
+	switch {
+	case imageOSVersion == ctx.OSVersionChoice:
+		return 0, true
+	case imageOSVersion != "" && ctx.OSVersionMatch != types.OSVersionMatchExact &&
+		osVersionBuild(imageOSVersion) == osVersionBuild(ctx.OSVersionChoice):
+		return 1, true
+	case imageOSVersion == "":
+		return 2, true
+	default:
+		return 3, ctx.OSVersionMatch == types.OSVersionMatchPreferred
+	}
+}
+
+// osVersionBuild returns the major.minor.build prefix of osVersion, i.e. without a fourth (patch level) component.
+func osVersionBuild(osVersion string) string {
+	components := strings.SplitN(osVersion, ".", 4)
+	return strings.Join(components[:min(len(components), 3)], ".")
+}
+
+// OSVersionDescription returns a suffix describing ctx.OSVersionChoice for error messages, or "" if it is not set.
+func OSVersionDescription(ctx *types.SystemContext) string {
+	if ctx == nil || ctx.OSVersionChoice == "" {
+		return ""
+	}
+	return fmt.Sprintf(", OS version %q", ctx.OSVersionChoice)
+}
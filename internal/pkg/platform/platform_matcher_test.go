@@ -58,3 +58,42 @@ func TestWantedPlatforms(t *testing.T) {
 		assert.Equal(t, c.expected, platforms, testName)
 	}
 }
+
+func TestOSVersionRank(t *testing.T) {
+	// No OSVersionChoice: all instances are equally good
+	for _, sys := range []*types.SystemContext{nil, {}, {OSVersionMatch: types.OSVersionMatchExact}} {
+		for _, v := range []string{"", "10.0.17763.1879"} {
+			rank, ok := OSVersionRank(sys, v)
+			assert.True(t, ok)
+			assert.Equal(t, 0, rank)
+		}
+	}
+
+	for _, c := range []struct {
+		imageOSVersion string
+		match          types.OSVersionMatch
+		rank           int
+		ok             bool
+	}{
+		{"10.0.17763.1879", types.OSVersionMatchPreferred, 0, true},
+		{"10.0.17763.1879", types.OSVersionMatchBuild, 0, true},
+		{"10.0.17763.1879", types.OSVersionMatchExact, 0, true},
+		{"10.0.17763.2000", types.OSVersionMatchPreferred, 1, true},
+		{"10.0.17763.2000", types.OSVersionMatchBuild, 1, true},
+		{"10.0.17763.2000", types.OSVersionMatchExact, -1, false},
+		{"10.0.17763", types.OSVersionMatchBuild, 1, true},
+		{"", types.OSVersionMatchPreferred, 2, true},
+		{"", types.OSVersionMatchBuild, 2, true},
+		{"", types.OSVersionMatchExact, 2, true},
+		{"10.0.20348.643", types.OSVersionMatchPreferred, 3, true},
+		{"10.0.20348.643", types.OSVersionMatchBuild, -1, false},
+		{"10.0.20348.643", types.OSVersionMatchExact, -1, false},
+		{"10.0.177630.1879", types.OSVersionMatchBuild, -1, false},
+	} {
+		rank, ok := OSVersionRank(&types.SystemContext{OSVersionChoice: "10.0.17763.1879", OSVersionMatch: c.match}, c.imageOSVersion)
+		assert.Equal(t, c.ok, ok, c.imageOSVersion)
+		if c.ok {
+			assert.Equal(t, c.rank, rank, c.imageOSVersion)
+		}
+	}
+}
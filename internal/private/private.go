@@ -28,6 +28,25 @@ type ImageSourceInternalOnly interface {
 	GetSignaturesWithFormat(ctx context.Context, instanceDigest *digest.Digest) ([]signature.Signature, error)
 }
 
+// SignatureMetadata describes a signature of an image, without including the signature contents.
+type SignatureMetadata struct {
+	// Format is the format of the signature, e.g. "simple-signing" or "sigstore-json"; "" if it can not be determined without reading the signature.
+	Format string
+	// Size is the size of the signature as stored by the transport, in bytes.
+	// It is intended for display and accounting; the same signature may have different sizes when stored using different transports.
+	Size int64
+}
+
+// SignatureMetadataSource is an optional extension of ImageSource, implemented by sources
+// which can describe their signatures more cheaply than by reading them all in full.
+type SignatureMetadataSource interface {
+	// GetSignaturesMetadata returns metadata of the image's signatures, in the same order as GetSignaturesWithFormat.
+	// If instanceDigest is not nil, it contains a digest of the specific manifest instance to describe signatures for
+	// (when the primary manifest is a manifest list); this never happens if the primary manifest is not a manifest list
+	// (e.g. if the source never returns manifest lists).
+	GetSignaturesMetadata(ctx context.Context, instanceDigest *digest.Digest) ([]SignatureMetadata, error)
+}
+
 // ImageSource is an internal extension to the types.ImageSource interface.
 type ImageSource interface {
 	types.ImageSource
@@ -229,3 +248,11 @@ func (c ErrFallbackToOrdinaryLayerDownload) Unwrap() error {
 func NewErrFallbackToOrdinaryLayerDownload(err error) error {
 	return ErrFallbackToOrdinaryLayerDownload{err: err}
 }
+
+// NormalizingImageReference is an optional interface of types.ImageReference, for transports where
+// several spellings of StringWithinTransport() refer to the same image (e.g. relative and absolute paths).
+type NormalizingImageReference interface {
+	// NormalizedReference returns an equivalent reference using a canonical spelling of the reference,
+	// e.g. an absolute path without redundant path elements.
+	NormalizedReference() (types.ImageReference, error)
+}
@@ -17,6 +17,9 @@ const (
 	SigstoreCertificateAnnotationKey = "dev.sigstore.cosign/certificate"
 	// from sigstore/cosign/pkg/oci/static.ChainAnnotationKey
 	SigstoreIntermediateCertificateChainAnnotationKey = "dev.sigstore.cosign/chain"
+	// A JSON-encoded Sigstore bundle (github.com/sigstore/protobuf-specs) carrying the signature, certificates and
+	// transparency log entry for the payload; if present, it is used instead of the four annotations above.
+	SigstoreBundleAnnotationKey = "dev.sigstore.bundle"
 )
 
 // Sigstore is a github.com/cosign/cosign signature.
@@ -0,0 +1,86 @@
+// Package imagetest is a TESTING-ONLY utility providing images and policies for tests copying images.
+//
+// NEVER use this in non-testing subpackages!
+package imagetest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+// Blob is a layer to be included in an image written by WriteDirImage.
+type Blob struct {
+	MediaType string
+	Data      []byte
+}
+
+// WriteDirImage writes a single-image manifest of manifestMIMEType (an OCI or Docker schema2 manifest), referring to config and layers,
+// along with the blobs, to a new dir: directory, and returns a reference to it.
+func WriteDirImage(t testing.TB, manifestMIMEType string, config []byte, layers []Blob) types.ImageReference {
+	dir := t.TempDir()
+	writeBlob := func(data []byte) digest.Digest {
+		d := digest.FromBytes(data)
+		err := os.WriteFile(filepath.Join(dir, d.Encoded()), data, 0o644)
+		require.NoError(t, err)
+		return d
+	}
+
+	configDigest := writeBlob(config)
+	var manifestBlob []byte
+	var err error
+	switch manifestMIMEType {
+	case imgspecv1.MediaTypeImageManifest:
+		layerDescriptors := []imgspecv1.Descriptor{}
+		for _, layer := range layers {
+			layerDescriptors = append(layerDescriptors, imgspecv1.Descriptor{MediaType: layer.MediaType, Digest: writeBlob(layer.Data), Size: int64(len(layer.Data))})
+		}
+		manifestBlob, err = manifest.OCI1FromComponents(imgspecv1.Descriptor{
+			MediaType: imgspecv1.MediaTypeImageConfig,
+			Digest:    configDigest,
+			Size:      int64(len(config)),
+		}, layerDescriptors).Serialize()
+	case manifest.DockerV2Schema2MediaType:
+		layerDescriptors := []manifest.Schema2Descriptor{}
+		for _, layer := range layers {
+			layerDescriptors = append(layerDescriptors, manifest.Schema2Descriptor{MediaType: layer.MediaType, Digest: writeBlob(layer.Data), Size: int64(len(layer.Data))})
+		}
+		manifestBlob, err = manifest.Schema2FromComponents(manifest.Schema2Descriptor{
+			MediaType: manifest.DockerV2Schema2ConfigMediaType,
+			Digest:    configDigest,
+			Size:      int64(len(config)),
+		}, layerDescriptors).Serialize()
+	default:
+		t.Fatalf("Unsupported manifest MIME type %q", manifestMIMEType)
+	}
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, "manifest.json"), manifestBlob, 0o644)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, "version"), []byte("Directory Transport Version: 1.1\n"), 0o644)
+	require.NoError(t, err)
+
+	ref, err := directory.NewReference(dir)
+	require.NoError(t, err)
+	return ref
+}
+
+// AcceptAnythingPolicyContext returns a PolicyContext accepting any image, which is destroyed when the test finishes.
+func AcceptAnythingPolicyContext(t testing.TB) *signature.PolicyContext {
+	policyContext, err := signature.NewPolicyContext(&signature.Policy{
+		Default: []signature.PolicyRequirement{signature.NewPRInsecureAcceptAnything()},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		err := policyContext.Destroy()
+		require.NoError(t, err)
+	})
+	return policyContext
+}
@@ -1,6 +1,7 @@
 package tmpdir
 
 import (
+	"fmt"
 	"os"
 	"runtime"
 
@@ -36,9 +37,26 @@ func temporaryDirectoryForBigFiles(sys *types.SystemContext) string {
 }
 
 func CreateBigFileTemp(sys *types.SystemContext, name string) (*os.File, error) {
-	return os.CreateTemp(temporaryDirectoryForBigFiles(sys), prefix+name)
+	f, err := os.CreateTemp(temporaryDirectoryForBigFiles(sys), prefix+name)
+	if err != nil {
+		return nil, wrapConfiguredDirError(sys, err)
+	}
+	return f, nil
 }
 
 func MkDirBigFileTemp(sys *types.SystemContext, name string) (string, error) {
-	return os.MkdirTemp(temporaryDirectoryForBigFiles(sys), prefix+name)
+	dir, err := os.MkdirTemp(temporaryDirectoryForBigFiles(sys), prefix+name)
+	if err != nil {
+		return "", wrapConfiguredDirError(sys, err)
+	}
+	return dir, nil
+}
+
+// wrapConfiguredDirError adds context to err, a failure to create a temporary file or directory,
+// if the directory was explicitly configured in sys; that is typically not obvious from the error alone.
+func wrapConfiguredDirError(sys *types.SystemContext, err error) error {
+	if sys != nil && sys.BigFilesTemporaryDir != "" {
+		return fmt.Errorf("using temporary directory %q from SystemContext.BigFilesTemporaryDir: %w", sys.BigFilesTemporaryDir, err)
+	}
+	return err
 }
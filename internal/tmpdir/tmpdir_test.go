@@ -31,7 +31,8 @@ func TestCreateBigFileTemp(t *testing.T) {
 
 	sys.BigFilesTemporaryDir = "/tmp/bogus"
 	_, err = CreateBigFileTemp(&sys, "foobar1")
-	assert.Error(t, err)
+	assert.ErrorContains(t, err, "BigFilesTemporaryDir")
+	assert.ErrorIs(t, err, os.ErrNotExist)
 
 }
 
@@ -50,5 +51,6 @@ func TestMkDirBigFileTemp(t *testing.T) {
 
 	sys.BigFilesTemporaryDir = "/tmp/bogus"
 	_, err = MkDirBigFileTemp(&sys, "foobar1")
-	assert.Error(t, err)
+	assert.ErrorContains(t, err, "BigFilesTemporaryDir")
+	assert.ErrorIs(t, err, os.ErrNotExist)
 }
@@ -78,6 +78,19 @@ func compressionVariantMIMEType(variantTable []compressionMIMETypeSet, mimeType
 	return "", fmt.Errorf("unsupported MIME type for decompression: %q", mimeType)
 }
 
+// NormalizedLayerMediaType returns the variant of the Docker schema2 or OCI layer MIME type original which corresponds to
+// compressing the layer with algorithm (or not compressing it at all, if algorithm is nil).
+// The returned error will be a ManifestLayerCompressionIncompatibilityError if original can't be combined with algorithm
+// (e.g. zstd-compressing a Docker schema2 layer, or a foreign layer).
+func NormalizedLayerMediaType(original string, algorithm *compressiontypes.Algorithm) (string, error) {
+	for _, variantTable := range [][]compressionMIMETypeSet{schema2CompressionMIMETypeSets, oci1CompressionMIMETypeSets} {
+		if compressionVariantsRecognizeMIMEType(variantTable, original) {
+			return compressionVariantMIMEType(variantTable, original, algorithm)
+		}
+	}
+	return "", fmt.Errorf("unsupported layer MIME type %q", original)
+}
+
 // updatedMIMEType returns the result of applying edits in updated (MediaType, CompressionOperation) to
 // mimeType, based on variantTable.  It may use updated.Digest for error messages.
 // The returned error will be a ManifestLayerCompressionIncompatibilityError if mimeType has variants
@@ -123,6 +123,53 @@ func TestCompressionVariantMIMEType(t *testing.T) {
 	}
 }
 
+func TestNormalizedLayerMediaType(t *testing.T) {
+	for _, c := range []struct {
+		input    string
+		algo     *compressiontypes.Algorithm
+		expected string
+	}{
+		// Docker schema2
+		{DockerV2SchemaLayerMediaTypeUncompressed, nil, DockerV2SchemaLayerMediaTypeUncompressed},
+		{DockerV2SchemaLayerMediaTypeUncompressed, &compression.Gzip, DockerV2Schema2LayerMediaType},
+		{DockerV2SchemaLayerMediaTypeUncompressed, &compression.Zstd, ""},
+		{DockerV2Schema2LayerMediaType, nil, DockerV2SchemaLayerMediaTypeUncompressed},
+		{DockerV2Schema2LayerMediaType, &compression.Gzip, DockerV2Schema2LayerMediaType},
+		{DockerV2Schema2LayerMediaType, &compression.Zstd, ""},
+		{DockerV2Schema2LayerMediaType, &compression.ZstdChunked, ""},
+		// Docker schema2 foreign layers
+		{DockerV2Schema2ForeignLayerMediaType, nil, DockerV2Schema2ForeignLayerMediaType},
+		{DockerV2Schema2ForeignLayerMediaType, &compression.Gzip, DockerV2Schema2ForeignLayerMediaTypeGzip},
+		{DockerV2Schema2ForeignLayerMediaTypeGzip, nil, DockerV2Schema2ForeignLayerMediaType},
+		{DockerV2Schema2ForeignLayerMediaTypeGzip, &compression.Zstd, ""},
+		// OCI
+		{imgspecv1.MediaTypeImageLayer, nil, imgspecv1.MediaTypeImageLayer},
+		{imgspecv1.MediaTypeImageLayer, &compression.Gzip, imgspecv1.MediaTypeImageLayerGzip},
+		{imgspecv1.MediaTypeImageLayer, &compression.Zstd, imgspecv1.MediaTypeImageLayerZstd},
+		{imgspecv1.MediaTypeImageLayerGzip, nil, imgspecv1.MediaTypeImageLayer},
+		{imgspecv1.MediaTypeImageLayerGzip, &compression.Zstd, imgspecv1.MediaTypeImageLayerZstd},
+		{imgspecv1.MediaTypeImageLayerZstd, &compression.Gzip, imgspecv1.MediaTypeImageLayerGzip},
+		{imgspecv1.MediaTypeImageLayerZstd, &compression.ZstdChunked, imgspecv1.MediaTypeImageLayerZstd},
+		// OCI non-distributable layers
+		{imgspecv1.MediaTypeImageLayerNonDistributable, &compression.Gzip, imgspecv1.MediaTypeImageLayerNonDistributableGzip},     //nolint:staticcheck // NonDistributable layers are deprecated, but we want to continue to support manipulating pre-existing images.
+		{imgspecv1.MediaTypeImageLayerNonDistributableGzip, &compression.Zstd, imgspecv1.MediaTypeImageLayerNonDistributableZstd}, //nolint:staticcheck // NonDistributable layers are deprecated, but we want to continue to support manipulating pre-existing images.
+		{imgspecv1.MediaTypeImageLayerNonDistributableZstd, nil, imgspecv1.MediaTypeImageLayerNonDistributable},                   //nolint:staticcheck // NonDistributable layers are deprecated, but we want to continue to support manipulating pre-existing images.
+		// Not layer types
+		{imgspecv1.MediaTypeImageConfig, nil, ""},
+		{DockerV2Schema2ConfigMediaType, &compression.Gzip, ""},
+		{"", nil, ""},
+		{"unknown", &compression.Gzip, ""},
+	} {
+		res, err := NormalizedLayerMediaType(c.input, c.algo)
+		if c.expected == "" {
+			assert.Error(t, err, c.input)
+		} else {
+			require.NoError(t, err, c.input)
+			assert.Equal(t, c.expected, res, c.input)
+		}
+	}
+}
+
 func TestUpdatedMIMEType(t *testing.T) {
 	// all known types, PreserveOriginal
 	preserve := []struct {
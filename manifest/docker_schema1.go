@@ -336,6 +336,60 @@ func (m *Schema1) ToSchema2Config(diffIDs []digest.Digest) ([]byte, error) {
 	return config, nil
 }
 
+// ToSchema2 converts m into a schema2 manifest, and returns it along with its config blob.
+// layerInfos and diffIDs must correspond to m.LayerInfos(), i.e. contain an entry for every layer, including empty (throwaway) ones;
+// layerInfos contains the digests and sizes of the layer blobs, possibly after they were updated during a copy.
+// Empty layers, which in schema1 are represented by copies of GzippedEmptyLayer, are omitted in schema2 (they are only recorded
+// in the config’s history), so the corresponding entries of layerInfos and diffIDs are ignored.
+func (m *Schema1) ToSchema2(layerInfos []types.BlobInfo, diffIDs []digest.Digest) (*Schema2, []byte, error) {
+	if len(layerInfos) != len(m.FSLayers) {
+		return nil, nil, fmt.Errorf("converting to schema2: %d layer infos for %d layers", len(layerInfos), len(m.FSLayers))
+	}
+	if len(diffIDs) != len(m.FSLayers) {
+		return nil, nil, fmt.Errorf("converting to schema2: %d DiffIDs for %d layers", len(diffIDs), len(m.FSLayers))
+	}
+
+	layers := []Schema2Descriptor{}
+	nonEmptyDiffIDs := []digest.Digest{}
+	for i, layer := range m.LayerInfos() {
+		if layer.EmptyLayer {
+			continue
+		}
+		info := layerInfos[i]
+		if err := info.Digest.Validate(); err != nil {
+			return nil, nil, fmt.Errorf("converting to schema2: invalid digest of layer %d: %w", i, err)
+		}
+		if info.Size < 0 {
+			return nil, nil, fmt.Errorf("converting to schema2: unknown size of layer %d (%s)", i, info.Digest)
+		}
+		if err := diffIDs[i].Validate(); err != nil {
+			return nil, nil, fmt.Errorf("converting to schema2: invalid DiffID of layer %d (%s): %w", i, info.Digest, err)
+		}
+		mediaType := info.MediaType
+		if mediaType == "" {
+			mediaType = DockerV2Schema2LayerMediaType
+		}
+		layers = append(layers, Schema2Descriptor{
+			MediaType: mediaType,
+			Size:      info.Size,
+			Digest:    info.Digest,
+			URLs:      info.URLs,
+		})
+		nonEmptyDiffIDs = append(nonEmptyDiffIDs, diffIDs[i])
+	}
+
+	config, err := m.ToSchema2Config(nonEmptyDiffIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	configDescriptor := Schema2Descriptor{
+		MediaType: DockerV2Schema2ConfigMediaType,
+		Size:      int64(len(config)),
+		Digest:    digest.FromBytes(config),
+	}
+	return Schema2FromComponents(configDescriptor, layers), config, nil
+}
+
 // ImageID computes an ID which can uniquely identify this image by its contents.
 func (m *Schema1) ImageID(diffIDs []digest.Digest) (string, error) {
 	image, err := m.ToSchema2Config(diffIDs)
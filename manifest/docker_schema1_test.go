@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
 	"time"
 
@@ -367,3 +368,68 @@ func TestSchema1ImageID(t *testing.T) {
 	// This is mostly a smoke-test; it’s fine to just update this value if that implementation changes.
 	assert.Equal(t, "9ca4bda0a6b3727a6ffcc43e981cad0f24e2ec79d338f6ba325b4dfd0756fb8f", id)
 }
+
+func TestSchema1ToSchema2(t *testing.T) {
+	m := manifestSchema1FromFixture(t, "schema2-to-schema1-by-docker.json")
+	layers := m.LayerInfos()
+	layerInfos := make([]types.BlobInfo, len(layers))
+	diffIDs := make([]digest.Digest, len(layers))
+	expectedLayers := []Schema2Descriptor{}
+	nonEmptyIndex := 0
+	for i, l := range layers {
+		layerInfos[i] = types.BlobInfo{Digest: l.Digest, Size: int64(1000 + i)}
+		if l.EmptyLayer {
+			continue // diffIDs[i] is ignored, and left empty
+		}
+		diffIDs[i] = schema1FixtureLayerDiffIDs[nonEmptyIndex]
+		nonEmptyIndex++
+		expectedLayers = append(expectedLayers, Schema2Descriptor{
+			MediaType: DockerV2Schema2LayerMediaType,
+			Size:      int64(1000 + i),
+			Digest:    l.Digest,
+		})
+	}
+	require.Equal(t, len(schema1FixtureLayerDiffIDs), nonEmptyIndex)
+
+	s2, config, err := m.ToSchema2(layerInfos, diffIDs)
+	require.NoError(t, err)
+	assert.Equal(t, expectedLayers, s2.LayersDescriptors)
+	assert.Equal(t, DockerV2Schema2ConfigMediaType, s2.ConfigDescriptor.MediaType)
+	assert.Equal(t, int64(len(config)), s2.ConfigDescriptor.Size)
+	assert.Equal(t, digest.FromBytes(config), s2.ConfigDescriptor.Digest)
+	// The config is consistent with ImageID.
+	id, err := m.ImageID(schema1FixtureLayerDiffIDs)
+	require.NoError(t, err)
+	assert.Equal(t, id, s2.ConfigDescriptor.Digest.Encoded())
+	// The result is a valid schema2 manifest, and its config contains the history, including empty layers.
+	serialized, err := s2.Serialize()
+	require.NoError(t, err)
+	_, err = Schema2FromManifest(serialized)
+	require.NoError(t, err)
+	var parsedConfig Schema2Image
+	err = json.Unmarshal(config, &parsedConfig)
+	require.NoError(t, err)
+	require.NotNil(t, parsedConfig.RootFS)
+	assert.Equal(t, schema1FixtureLayerDiffIDs, parsedConfig.RootFS.DiffIDs)
+	assert.Len(t, parsedConfig.History, len(layers))
+
+	// Invalid inputs
+	_, _, err = m.ToSchema2(layerInfos[1:], diffIDs)
+	assert.Error(t, err)
+	_, _, err = m.ToSchema2(layerInfos, diffIDs[1:])
+	assert.Error(t, err)
+	for i, l := range layers {
+		if l.EmptyLayer {
+			continue
+		}
+		badDiffIDs := slices.Clone(diffIDs)
+		badDiffIDs[i] = ""
+		_, _, err = m.ToSchema2(layerInfos, badDiffIDs)
+		assert.Error(t, err)
+		badLayerInfos := slices.Clone(layerInfos)
+		badLayerInfos[i].Size = -1
+		_, _, err = m.ToSchema2(badLayerInfos, diffIDs)
+		assert.Error(t, err)
+		break
+	}
+}
@@ -1,6 +1,8 @@
 package manifest
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 
 	"github.com/containers/image/v5/internal/manifest"
@@ -80,6 +82,9 @@ type Manifest interface {
 	// of which (of possibly more than one simultaneously valid) reference was used to locate the
 	// image, and unchanged by whether or how the layers are compressed.  The result takes the form
 	// of the hexadecimal portion of a digest.Digest.
+	// For schema2 and OCI images, this is the config digest, and diffIDs is ignored; for schema1,
+	// diffIDs must contain the uncompressed digests of all layers, in the order of LayerInfos().
+	// See also the ImageID function, which does not require diffIDs.
 	ImageID(diffIDs []digest.Digest) (string, error)
 
 	// Inspect returns various information for (skopeo inspect) parsed from the manifest,
@@ -168,3 +173,121 @@ func FromBlob(manblob []byte, mt string) (Manifest, error) {
 	// Note that this may not be reachable, NormalizedMIMEType has a default for unknown values.
 	return nil, fmt.Errorf("Unimplemented manifest MIME type %q (normalized as %q)", mt, nmt)
 }
+
+// ImageID returns the ID of the image described by m, as would be returned by m.ImageID, i.e. the hexadecimal
+// portion of the config digest, without requiring the layer diffIDs.
+// This allows computing the ID of an image before it is pushed or stored anywhere.
+// Schema1 manifests do not reference a config, and their ID depends on the uncompressed layer digests,
+// so this fails for them; use m.ImageID with the layer diffIDs instead.
+func ImageID(m Manifest) (string, error) {
+	if _, ok := m.(*Schema1); ok {
+		return "", errors.New("computing the image ID of a schema1 manifest requires layer DiffIDs")
+	}
+	return m.ImageID(nil)
+}
+
+// UpdateConfig returns a copy of manifestBlob, a Docker schema2 or OCI image manifest with MIME type mimeType,
+// updated to refer to config: the digest and size of the config descriptor are computed from config,
+// and its media type is set to configMIMEType, unless that is "".
+// This is intended for tools which edit the config of an image, e.g. to set labels; config must be valid JSON.
+func UpdateConfig(manifestBlob []byte, mimeType string, config []byte, configMIMEType string) ([]byte, error) {
+	if !json.Valid(config) {
+		return nil, errors.New("updating manifest config: the config is not valid JSON")
+	}
+	configDigest := digest.FromBytes(config)
+	switch NormalizedMIMEType(mimeType) {
+	case DockerV2Schema2MediaType:
+		m, err := Schema2FromManifest(manifestBlob)
+		if err != nil {
+			return nil, err
+		}
+		m.ConfigDescriptor.Digest = configDigest
+		m.ConfigDescriptor.Size = int64(len(config))
+		if configMIMEType != "" {
+			m.ConfigDescriptor.MediaType = configMIMEType
+		}
+		return m.Serialize()
+	case imgspecv1.MediaTypeImageManifest:
+		m, err := OCI1FromManifest(manifestBlob)
+		if err != nil {
+			return nil, err
+		}
+		m.Config.Digest = configDigest
+		m.Config.Size = int64(len(config))
+		m.Config.Data = nil // The embedded data, if any, would no longer match.
+		if configMIMEType != "" {
+			m.Config.MediaType = configMIMEType
+		}
+		return m.Serialize()
+	default:
+		return nil, fmt.Errorf("updating the config of a manifest of type %q is not supported", mimeType)
+	}
+}
+
+// Validate parses manifestBlob, using the guessed MIME type, and checks that it is structurally valid:
+// all referenced digests are well-formed, required fields are present, and sizes are not negative.
+// It does not access the network, nor verify that the referenced blobs or manifests exist.
+// It is intended to be safe to call on arbitrary, untrusted, input; it returns an error for any malformed input.
+func Validate(manifestBlob []byte) error {
+	mt := GuessMIMEType(manifestBlob)
+	if mt == "" {
+		return errors.New("unrecognized manifest format")
+	}
+
+	if MIMETypeIsMultiImage(mt) {
+		list, err := ListFromBlob(manifestBlob, mt)
+		if err != nil {
+			return err
+		}
+		for i, instanceDigest := range list.Instances() {
+			instance, err := list.Instance(instanceDigest)
+			if err != nil {
+				return err // Coverage: This should never happen, instanceDigest comes from list.Instances().
+			}
+			if err := validateReferencedObject(fmt.Sprintf("instance %d", i), instance.Digest, instance.Size, instance.MediaType); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	m, err := FromBlob(manifestBlob, mt)
+	if err != nil {
+		return err
+	}
+	// Schema1 does not record a config, nor sizes and MIME types of layers.
+	schema1 := mt == DockerV2Schema1MediaType || mt == DockerV2Schema1SignedMediaType
+	if !schema1 {
+		config := m.ConfigInfo()
+		if err := validateReferencedObject("config", config.Digest, config.Size, config.MediaType); err != nil {
+			return err
+		}
+	}
+	for i, layer := range m.LayerInfos() {
+		what := fmt.Sprintf("layer %d", i)
+		if schema1 {
+			if err := layer.Digest.Validate(); err != nil {
+				return fmt.Errorf("invalid digest %q of %s: %w", layer.Digest.String(), what, err)
+			}
+			continue
+		}
+		if err := validateReferencedObject(what, layer.Digest, layer.Size, layer.MediaType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateReferencedObject validates the fields of a descriptor of an object referenced from a manifest, described as what.
+func validateReferencedObject(what string, d digest.Digest, size int64, mediaType string) error {
+	if err := d.Validate(); err != nil {
+		return fmt.Errorf("invalid digest %q of %s: %w", d.String(), what, err)
+	}
+	if size < 0 {
+		return fmt.Errorf("invalid size %d of %s", size, what)
+	}
+	if mediaType == "" {
+		return fmt.Errorf("missing media type of %s", what)
+	}
+	return nil
+}
@@ -1,10 +1,13 @@
 package manifest
 
 import (
+	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
 
+	"github.com/containers/image/v5/types"
 	"github.com/containers/libtrust"
 	digest "github.com/opencontainers/go-digest"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
@@ -167,3 +170,190 @@ func TestNormalizedMIMEType(t *testing.T) {
 		assert.Equal(t, DockerV2Schema1SignedMediaType, res, c)
 	}
 }
+
+func TestImageID(t *testing.T) {
+	for _, c := range []struct {
+		path, mimeType string
+	}{
+		{"v2s2.manifest.json", DockerV2Schema2MediaType},
+		{"ociv1.manifest.json", imgspecv1.MediaTypeImageManifest},
+	} {
+		manifest, err := os.ReadFile(filepath.Join("fixtures", c.path))
+		require.NoError(t, err)
+		m, err := FromBlob(manifest, c.mimeType)
+		require.NoError(t, err)
+		id, err := ImageID(m)
+		require.NoError(t, err, c.path)
+		assert.Equal(t, "b5b2b2c507a0944348e0303114d8d93aaaa081732b86451d9bce1f432a537bc7", id, c.path)
+		assert.Equal(t, m.ConfigInfo().Digest.Encoded(), id, c.path)
+	}
+
+	// Non-image OCI artifact
+	manifest, err := os.ReadFile(filepath.Join("fixtures", "ociv1.artifact.json"))
+	require.NoError(t, err)
+	m, err := FromBlob(manifest, imgspecv1.MediaTypeImageManifest)
+	require.NoError(t, err)
+	_, err = ImageID(m)
+	var expected NonImageArtifactError
+	assert.ErrorAs(t, err, &expected)
+
+	// Schema1 requires DiffIDs
+	manifest, err = os.ReadFile(filepath.Join("fixtures", "v2s1.manifest.json"))
+	require.NoError(t, err)
+	m, err = FromBlob(manifest, DockerV2Schema1SignedMediaType)
+	require.NoError(t, err)
+	_, err = ImageID(m)
+	assert.Error(t, err)
+}
+
+// validateWithoutPanic calls Validate on manifestBlob, and fails the test if Validate panics.
+func validateWithoutPanic(t *testing.T, manifestBlob []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Errorf("Validate panicked on %q: %v", string(manifestBlob), r)
+			err = errors.New("panic")
+		}
+	}()
+	return Validate(manifestBlob)
+}
+
+func TestUpdateConfig(t *testing.T) {
+	config := []byte(`{"architecture":"amd64","os":"linux","config":{"Labels":{"com.example.label":"edited"}},"rootfs":{"type":"layers","diff_ids":[]}}`)
+	configDigest := digest.FromBytes(config)
+
+	for _, c := range []struct {
+		path, mimeType, configMIMEType, expectedConfigMIMEType string
+	}{
+		{"v2s2.manifest.json", DockerV2Schema2MediaType, "", DockerV2Schema2ConfigMediaType},
+		{"v2s2.manifest.json", DockerV2Schema2MediaType, DockerV2Schema2ConfigMediaType, DockerV2Schema2ConfigMediaType},
+		{"ociv1.manifest.json", imgspecv1.MediaTypeImageManifest, "", imgspecv1.MediaTypeImageConfig},
+		{"ociv1.artifact.json", imgspecv1.MediaTypeImageManifest, imgspecv1.MediaTypeImageConfig, imgspecv1.MediaTypeImageConfig},
+	} {
+		original, err := os.ReadFile(filepath.Join("fixtures", c.path))
+		require.NoError(t, err)
+		originalManifest, err := FromBlob(original, c.mimeType)
+		require.NoError(t, err)
+
+		updated, err := UpdateConfig(original, c.mimeType, config, c.configMIMEType)
+		require.NoError(t, err, c.path)
+		m, err := FromBlob(updated, c.mimeType)
+		require.NoError(t, err, c.path)
+		assert.Equal(t, types.BlobInfo{
+			Digest:    configDigest,
+			Size:      int64(len(config)),
+			MediaType: c.expectedConfigMIMEType,
+		}, m.ConfigInfo(), c.path)
+		assert.Equal(t, originalManifest.LayerInfos(), m.LayerInfos(), c.path)
+		assert.Equal(t, c.mimeType, GuessMIMEType(updated), c.path)
+
+		// Round-trip: updating the manifest again with the same config does not change it.
+		updated2, err := UpdateConfig(updated, c.mimeType, config, c.configMIMEType)
+		require.NoError(t, err, c.path)
+		assert.Equal(t, updated, updated2, c.path)
+	}
+
+	v2s2, err := os.ReadFile(filepath.Join("fixtures", "v2s2.manifest.json"))
+	require.NoError(t, err)
+	// Invalid config
+	_, err = UpdateConfig(v2s2, DockerV2Schema2MediaType, []byte("this is not JSON"), "")
+	assert.Error(t, err)
+	// Invalid manifest
+	_, err = UpdateConfig([]byte("this is not JSON"), DockerV2Schema2MediaType, config, "")
+	assert.Error(t, err)
+
+	// Unsupported manifest types
+	for _, c := range []struct{ path, mimeType string }{
+		{"v2s1.manifest.json", DockerV2Schema1SignedMediaType},
+		{"v2list.manifest.json", DockerV2ListMediaType},
+		{"ociv1.image.index.json", imgspecv1.MediaTypeImageIndex},
+	} {
+		manifest, err := os.ReadFile(filepath.Join("fixtures", c.path))
+		require.NoError(t, err)
+		_, err = UpdateConfig(manifest, c.mimeType, config, "")
+		assert.Error(t, err, c.path)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, path := range []string{
+		"v2s2.manifest.json",
+		"v2list.manifest.json",
+		"v2s1.manifest.json",
+		"v2s1-unsigned.manifest.json",
+		"ociv1.manifest.json",
+		"ociv1.image.index.json",
+		"ociv1nomime.manifest.json",
+		"ociv1nomime.image.index.json",
+	} {
+		manifest, err := os.ReadFile(filepath.Join("fixtures", path))
+		require.NoError(t, err)
+		err = validateWithoutPanic(t, manifest)
+		assert.NoError(t, err, path)
+	}
+
+	for _, path := range []string{
+		"unknown-version.manifest.json",
+		"non-json.manifest.json",
+		"ociv1.artifact.json", // The config digest is empty
+	} {
+		manifest, err := os.ReadFile(filepath.Join("fixtures", path))
+		require.NoError(t, err)
+		err = validateWithoutPanic(t, manifest)
+		assert.Error(t, err, path)
+	}
+
+	// Raw malformed inputs
+	for _, input := range []string{
+		"",
+		"null",
+		"{}",
+		"[]",
+		"\x00\xff",
+		`{"schemaVersion": 2`,
+		`{"schemaVersion": "2"}`,
+		`{"schemaVersion": 1}`,
+		`{"schemaVersion": 1, "fsLayers": [{"blobSum": "sha256:1"}], "history": []}`,
+		`{"schemaVersion": 2, "mediaType": "application/vnd.docker.distribution.manifest.v2+json"}`,
+		`{"schemaVersion": 2, "mediaType": "application/vnd.docker.distribution.manifest.v2+json", "config": null, "layers": [null]}`,
+		`{"schemaVersion": 2, "mediaType": "application/vnd.oci.image.index.v1+json", "manifests": [null]}`,
+		`{"schemaVersion": 2, "mediaType": "application/vnd.oci.image.index.v1+json", "manifests": 1}`,
+		`{"schemaVersion": 2, "mediaType": "application/vnd.docker.distribution.manifest.list.v2+json", "manifests": [{}]}`,
+	} {
+		err := validateWithoutPanic(t, []byte(input))
+		assert.Error(t, err, input)
+	}
+
+	// Malformed modifications of valid manifests
+	for _, c := range []struct {
+		path   string
+		modify func(m map[string]any)
+	}{
+		{"v2s2.manifest.json", func(m map[string]any) { delete(m, "config") }},
+		{"v2s2.manifest.json", func(m map[string]any) { m["config"].(map[string]any)["digest"] = "this is invalid" }},
+		{"v2s2.manifest.json", func(m map[string]any) { m["config"].(map[string]any)["size"] = -1 }},
+		{"v2s2.manifest.json", func(m map[string]any) { delete(m["config"].(map[string]any), "mediaType") }},
+		{"v2s2.manifest.json", func(m map[string]any) { m["layers"].([]any)[0].(map[string]any)["digest"] = "sha256:abc" }},
+		{"v2s2.manifest.json", func(m map[string]any) { m["layers"].([]any)[1].(map[string]any)["size"] = -100 }},
+		{"v2s2.manifest.json", func(m map[string]any) { delete(m["layers"].([]any)[2].(map[string]any), "digest") }},
+		{"ociv1.manifest.json", func(m map[string]any) { m["config"].(map[string]any)["digest"] = "" }},
+		{"ociv1.manifest.json", func(m map[string]any) { m["layers"].([]any)[0].(map[string]any)["size"] = -2 }},
+		{"ociv1.manifest.json", func(m map[string]any) { delete(m["layers"].([]any)[0].(map[string]any), "mediaType") }},
+		{"ociv1.image.index.json", func(m map[string]any) { m["manifests"].([]any)[0].(map[string]any)["digest"] = "md5:abc" }},
+		{"ociv1.image.index.json", func(m map[string]any) { m["manifests"].([]any)[1].(map[string]any)["size"] = -1 }},
+		{"ociv1.image.index.json", func(m map[string]any) { delete(m["manifests"].([]any)[1].(map[string]any), "mediaType") }},
+		{"v2list.manifest.json", func(m map[string]any) { m["manifests"].([]any)[0].(map[string]any)["digest"] = "sha256:" }},
+		{"v2list.manifest.json", func(m map[string]any) { m["manifests"].([]any)[0].(map[string]any)["size"] = -1 }},
+		{"v2s1-unsigned.manifest.json", func(m map[string]any) { m["fsLayers"].([]any)[0].(map[string]any)["blobSum"] = "this is invalid" }},
+	} {
+		manifest, err := os.ReadFile(filepath.Join("fixtures", c.path))
+		require.NoError(t, err)
+		var m map[string]any
+		err = json.Unmarshal(manifest, &m)
+		require.NoError(t, err)
+		c.modify(m)
+		manifest, err = json.Marshal(m)
+		require.NoError(t, err)
+		err = validateWithoutPanic(t, manifest)
+		assert.Error(t, err, string(manifest))
+	}
+}
@@ -0,0 +1,35 @@
+//go:build unix
+
+package layout
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// lockIndex serializes updates of the index of the layout at dir, also with other processes,
+// and returns a function to release the lock.
+// It takes a flock on the layout directory itself, so no extra file is created in the layout,
+// and the lock is released by the kernel if the process dies while holding it.
+func lockIndex(dir string) (func(), error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		err = unix.Flock(int(f.Fd()), unix.LOCK_EX)
+		if err != unix.EINTR {
+			break
+		}
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("locking %q: %w", dir, err)
+	}
+	return func() {
+		// Closing the file releases the lock.
+		f.Close()
+	}, nil
+}
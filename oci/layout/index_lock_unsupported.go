@@ -0,0 +1,15 @@
+//go:build !unix
+
+package layout
+
+import "sync"
+
+// indexLock is used by lockIndex on platforms without flock.
+var indexLock sync.Mutex
+
+// lockIndex serializes updates of the index of the layout at dir, and returns a function to release the lock.
+// On this platform, updates are only serialized within the current process.
+func lockIndex(dir string) (func(), error) {
+	indexLock.Lock()
+	return indexLock.Unlock, nil
+}
@@ -4,12 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io/fs"
 	"os"
 	"slices"
 
 	"github.com/containers/image/v5/internal/set"
 	"github.com/containers/image/v5/types"
+	"github.com/containers/storage/pkg/fileutils"
 	digest "github.com/opencontainers/go-digest"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/sirupsen/logrus"
@@ -22,6 +22,14 @@ func (ref ociReference) DeleteImage(ctx context.Context, sys *types.SystemContex
 		sharedBlobsDir = sys.OCISharedBlobDirPath
 	}
 
+	// The blob use counts and the position of the image in index.json are only valid as long as index.json does not change;
+	// hold the lock until index.json is rewritten, so that concurrent commits to the same layout are not dropped.
+	unlock, err := lockIndex(ref.dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	descriptor, descriptorIndex, err := ref.getManifestDescriptor()
 	if err != nil {
 		return err
@@ -156,28 +164,11 @@ func (ref ociReference) deleteReferenceFromIndex(referenceIndex int) error {
 
 	index.Manifests = slices.Delete(index.Manifests, referenceIndex, referenceIndex+1)
 
-	return saveJSON(ref.indexPath(), index)
-}
-
-func saveJSON(path string, content any) error {
-	// If the file already exists, get its mode to preserve it
-	var mode fs.FileMode
-	existingfi, err := os.Stat(path)
-	if err != nil {
-		if !os.IsNotExist(err) {
-			return err
-		} else { // File does not exist, use default mode
-			mode = 0644
-		}
-	} else {
-		mode = existingfi.Mode()
-	}
-
-	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	indexJSON, err := json.Marshal(index)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
-
-	return json.NewEncoder(file).Encode(content)
+	// Keep an index.json.gz copy up to date if there is one.
+	compress := fileutils.Exists(ref.compressedIndexPath()) == nil
+	return writeIndex(ref, indexJSON, compress)
 }
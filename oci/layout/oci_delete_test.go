@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"slices"
 	"testing"
+	"time"
 
 	"github.com/containers/image/v5/types"
 	digest "github.com/opencontainers/go-digest"
@@ -40,6 +41,32 @@ func TestReferenceDeleteImage_onlyOneImage(t *testing.T) {
 	require.Equal(t, 0, len(index.Manifests))
 }
 
+func TestReferenceDeleteImage_locksIndex(t *testing.T) {
+	tmpDir := loadFixture(t, "delete_image_only_one_image")
+
+	ref, err := NewReference(tmpDir, "latest")
+	require.NoError(t, err)
+
+	unlock, err := lockIndex(tmpDir)
+	require.NoError(t, err)
+	done := make(chan error, 1)
+	go func() {
+		done <- ref.DeleteImage(context.Background(), nil)
+	}()
+	select {
+	case err := <-done:
+		require.FailNow(t, "DeleteImage finished while the index was locked", "%v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	unlock()
+	err = <-done
+	require.NoError(t, err)
+
+	index, err := ref.(ociReference).getIndex()
+	require.NoError(t, err)
+	assert.Empty(t, index.Manifests)
+}
+
 func TestReferenceDeleteImage_onlyOneImage_emptyImageName(t *testing.T) {
 	tmpDir := loadFixture(t, "delete_image_only_one_image")
 
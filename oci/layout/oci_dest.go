@@ -1,12 +1,14 @@
 package layout
 
 import (
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"maps"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -20,6 +22,8 @@ import (
 	"github.com/containers/image/v5/internal/reflink"
 	"github.com/containers/image/v5/types"
 	"github.com/containers/storage/pkg/fileutils"
+	"github.com/containers/storage/pkg/ioutils"
+	"github.com/containers/storage/pkg/regexp"
 	digest "github.com/opencontainers/go-digest"
 	imgspec "github.com/opencontainers/image-spec/specs-go"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
@@ -32,9 +36,28 @@ type ociImageDestination struct {
 	stubs.NoPutBlobPartialInitialize
 	stubs.NoSignaturesInitialize
 
-	ref           ociReference
-	index         imgspecv1.Index
-	sharedBlobDir string
+	ref            ociReference
+	index          imgspecv1.Index
+	addedManifests []imgspecv1.Descriptor // Entries added to index by this destination, to be merged into index.json on commit
+	sharedBlobDir  string
+	annotations    map[string]string // Extra annotations for the index.json entry of the image, from SystemContext.OCIIndexAnnotations
+	compressIndex  bool              // Also write index.json.gz, from SystemContext.OCICompressIndex
+}
+
+// annotationKeyRegexp matches annotation keys using the reverse domain notation recommended by the OCI image specification.
+var annotationKeyRegexp = regexp.Delayed(`^[A-Za-z0-9-]+(\.[A-Za-z0-9_-]+)+$`)
+
+// validateIndexAnnotations returns an error if annotations are not usable as SystemContext.OCIIndexAnnotations.
+func validateIndexAnnotations(annotations map[string]string) error {
+	for key := range annotations {
+		if key == imgspecv1.AnnotationRefName {
+			return fmt.Errorf("annotation %q can not be set explicitly, it is set from the image reference", key)
+		}
+		if !annotationKeyRegexp.MatchString(key) {
+			return fmt.Errorf("invalid annotation key %q: it must use the reverse domain notation, e.g. com.example.key", key)
+		}
+	}
+	return nil
 }
 
 // newImageDestination returns an ImageDestination for writing to an existing directory.
@@ -58,6 +81,12 @@ func newImageDestination(sys *types.SystemContext, ref ociReference) (private.Im
 		}
 	}
 
+	if sys != nil {
+		if err := validateIndexAnnotations(sys.OCIIndexAnnotations); err != nil {
+			return nil, err
+		}
+	}
+
 	desiredLayerCompression := types.Compress
 	if sys != nil && sys.OCIAcceptUncompressedLayers {
 		desiredLayerCompression = types.PreserveOriginal
@@ -84,6 +113,8 @@ func newImageDestination(sys *types.SystemContext, ref ociReference) (private.Im
 	d.Compat = impl.AddCompat(d)
 	if sys != nil {
 		d.sharedBlobDir = sys.OCISharedBlobDirPath
+		d.annotations = sys.OCIIndexAnnotations
+		d.compressIndex = sys.OCICompressIndex
 	}
 
 	if err := ensureDirectoryExists(d.ref.dir); err != nil {
@@ -257,19 +288,28 @@ func (d *ociImageDestination) PutManifest(ctx context.Context, m []byte, instanc
 	desc := imgspecv1.Descriptor{}
 	desc.Digest = digest
 	desc.Size = int64(len(m))
+	if len(d.annotations) != 0 {
+		desc.Annotations = maps.Clone(d.annotations)
+	}
 	if d.ref.image != "" {
-		desc.Annotations = make(map[string]string)
+		if desc.Annotations == nil {
+			desc.Annotations = make(map[string]string)
+		}
 		desc.Annotations[imgspecv1.AnnotationRefName] = d.ref.image
 	}
 
 	// If we knew the MIME type, we wouldn't have to guess here.
 	desc.MediaType = manifest.GuessMIMEType(m)
 
+	added := desc
+	added.Annotations = maps.Clone(desc.Annotations) // addManifest may later modify desc.Annotations in d.index
+	d.addedManifests = append(d.addedManifests, added)
 	d.addManifest(&desc)
 
 	return nil
 }
 
+// addManifest adds desc to d.index, replacing conflicting entries.
 func (d *ociImageDestination) addManifest(desc *imgspecv1.Descriptor) {
 	// If the new entry has a name, remove any conflicting names which we already have.
 	if desc.Annotations != nil && desc.Annotations[imgspecv1.AnnotationRefName] != "" {
@@ -310,11 +350,80 @@ func (d *ociImageDestination) CommitWithOptions(ctx context.Context, options pri
 	if err := os.WriteFile(d.ref.ociLayoutPath(), layoutBytes, 0644); err != nil {
 		return err
 	}
+	// Other images may have been written to the same layout since this destination was created;
+	// merge our entries into the current index.json instead of overwriting theirs.
+	// Hold a lock while doing so, so that concurrent commits, possibly from other processes, don’t drop each other’s entries.
+	unlock, err := lockIndex(d.ref.dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if indexExists(d.ref) {
+		index, err := d.ref.getIndex()
+		if err != nil {
+			return err
+		}
+		d.index = *index
+		for _, desc := range d.addedManifests {
+			desc.Annotations = maps.Clone(desc.Annotations)
+			d.addManifest(&desc)
+		}
+	}
 	indexJSON, err := json.Marshal(d.index)
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(d.ref.indexPath(), indexJSON, 0644)
+	return writeIndex(d.ref, indexJSON, d.compressIndex)
+}
+
+// writeIndex atomically replaces the index.json of ref with indexJSON.
+// If compress, a gzip-compressed copy is then also written as index.json.gz, recording the version of index.json it is a copy of,
+// so that readers only use it while it is current (see loadIndex); otherwise, any existing index.json.gz is removed.
+func writeIndex(ref ociReference, indexJSON []byte, compress bool) error {
+	// If index.json already exists, preserve its mode.
+	mode := fs.FileMode(0644)
+	if fi, err := os.Stat(ref.indexPath()); err == nil {
+		mode = fi.Mode()
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := ioutils.AtomicWriteFile(ref.indexPath(), indexJSON, mode); err != nil {
+		return err
+	}
+	if !compress {
+		return removeIfExists(ref.compressedIndexPath())
+	}
+	fi, err := os.Stat(ref.indexPath())
+	if err != nil {
+		return err
+	}
+	return writeCompressedFile(ref.compressedIndexPath(), indexJSON, compressedIndexStamp(fi))
+}
+
+// writeCompressedFile atomically replaces path with data, gzip-compressed, with comment in the gzip header.
+func writeCompressedFile(path string, data []byte, comment string) error {
+	file, err := ioutils.NewAtomicFileWriterWithOpts(path, 0644, &ioutils.AtomicFileWriterOptions{ExplicitCommit: true})
+	if err != nil {
+		return err
+	}
+	defer file.Close() // Discards the file if it was not committed
+	gz := gzip.NewWriter(file)
+	gz.Comment = comment
+	if _, err := gz.Write(data); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return file.Commit()
+}
+
+// removeIfExists removes path, and does not fail if it does not exist.
+func removeIfExists(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
 }
 
 // PutBlobFromLocalFileOption is unused but may receive functionality in the future.
@@ -392,15 +501,15 @@ func ensureParentDirectoryExists(path string) error {
 	return ensureDirectoryExists(filepath.Dir(path))
 }
 
-// indexExists checks whether the index location specified in the OCI reference exists.
+// indexExists checks whether the index location specified in the OCI reference exists,
+// either as index.json or as index.json.gz.
 // The implementation is opinionated, since in case of unexpected errors false is returned
 func indexExists(ref ociReference) bool {
-	err := fileutils.Exists(ref.indexPath())
-	if err == nil {
-		return true
-	}
-	if os.IsNotExist(err) {
-		return false
+	for _, path := range []string{ref.indexPath(), ref.compressedIndexPath()} {
+		err := fileutils.Exists(path)
+		if err == nil || !os.IsNotExist(err) {
+			return true
+		}
 	}
-	return true
+	return false
 }
@@ -3,16 +3,21 @@ package layout
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/containers/image/v5/internal/blobinfocache"
 	"github.com/containers/image/v5/internal/private"
 	"github.com/containers/image/v5/pkg/blobinfocache/memory"
 	"github.com/containers/image/v5/types"
 	digest "github.com/opencontainers/go-digest"
+	imgspec "github.com/opencontainers/image-spec/specs-go"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -131,6 +136,318 @@ func TestPutTwoDifferentTags(t *testing.T) {
 	assert.Equal(t, "zomg", index.Manifests[2].Annotations[imgspecv1.AnnotationRefName])
 }
 
+func TestPutManifestIndexAnnotations(t *testing.T) {
+	ref, _ := refToTempOCI(t, false)
+	ociRef, ok := ref.(ociReference)
+	require.True(t, ok)
+
+	data, err := os.ReadFile("../../internal/image/fixtures/oci1.json")
+	require.NoError(t, err)
+	dest, err := newImageDestination(&types.SystemContext{
+		OCIIndexAnnotations: map[string]string{
+			"com.example.build.id":               "1234",
+			imgspecv1.AnnotationCreated:          "2024-01-01T00:00:00Z",
+			"io.example.pipeline-name.with_char": "nightly",
+		},
+	}, ociRef)
+	require.NoError(t, err)
+	defer dest.Close()
+	err = dest.PutManifest(context.Background(), data, nil)
+	require.NoError(t, err)
+	err = dest.Commit(context.Background(), nil) // nil unparsedToplevel is invalid, we don’t currently use the value
+	require.NoError(t, err)
+
+	index, err := ociRef.getIndex()
+	require.NoError(t, err)
+	require.Len(t, index.Manifests, 2)
+	assert.Equal(t, map[string]string{
+		imgspecv1.AnnotationRefName:          "imageValue",
+		"com.example.build.id":               "1234",
+		imgspecv1.AnnotationCreated:          "2024-01-01T00:00:00Z",
+		"io.example.pipeline-name.with_char": "nightly",
+	}, index.Manifests[1].Annotations)
+	// Other entries in index.json are not affected.
+	assert.NotContains(t, index.Manifests[0].Annotations, "com.example.build.id")
+
+	// Invalid annotation keys are rejected
+	for _, key := range []string{
+		"",
+		"nodots",
+		".com.example",
+		"com.example.",
+		"com..example",
+		"com.example/key",
+		"com.example key",
+		imgspecv1.AnnotationRefName,
+	} {
+		_, err := newImageDestination(&types.SystemContext{
+			OCIIndexAnnotations: map[string]string{key: "value"},
+		}, ociRef)
+		assert.Error(t, err, key)
+	}
+}
+
+func TestPutManifestCompressedIndex(t *testing.T) {
+	const entries = 20000
+	tmpDir := t.TempDir()
+	index := imgspecv1.Index{
+		Versioned: imgspec.Versioned{SchemaVersion: 2},
+		MediaType: imgspecv1.MediaTypeImageIndex,
+	}
+	for i := range entries {
+		index.Manifests = append(index.Manifests, imgspecv1.Descriptor{
+			MediaType:    imgspecv1.MediaTypeImageManifest,
+			ArtifactType: "application/vnd.example.sbom",
+			Digest:       digest.FromString(fmt.Sprintf("referrer %d", i)),
+			Size:         1234,
+			Annotations:  map[string]string{imgspecv1.AnnotationCreated: "2024-01-01T00:00:00Z"},
+		})
+	}
+	indexJSON, err := json.Marshal(index)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(tmpDir, imgspecv1.ImageIndexFile), indexJSON, 0o644)
+	require.NoError(t, err)
+
+	data, err := os.ReadFile("../../internal/image/fixtures/oci1.json")
+	require.NoError(t, err)
+	for i, c := range []struct {
+		compress        bool
+		expectedEntries int
+	}{
+		{true, entries + 1},
+		{true, entries + 2}, // Adding to an existing compressed index
+		{false, entries + 3},
+	} {
+		ref, err := NewReference(tmpDir, fmt.Sprintf("image%d", i))
+		require.NoError(t, err)
+		dest, err := ref.NewImageDestination(context.Background(), &types.SystemContext{OCICompressIndex: c.compress})
+		require.NoError(t, err)
+		err = dest.PutManifest(context.Background(), data, nil)
+		require.NoError(t, err)
+		err = dest.Commit(context.Background(), nil) // nil unparsedToplevel is invalid, we don’t currently use the value
+		require.NoError(t, err)
+		dest.Close()
+
+		// index.json is always written
+		uncompressed, err := parseIndex(filepath.Join(tmpDir, imgspecv1.ImageIndexFile))
+		require.NoError(t, err)
+		require.Len(t, uncompressed.Manifests, c.expectedEntries)
+		assert.Equal(t, index.Manifests, uncompressed.Manifests[:entries])
+		assert.Equal(t, fmt.Sprintf("image%d", i), uncompressed.Manifests[c.expectedEntries-1].Annotations[imgspecv1.AnnotationRefName])
+		if c.compress {
+			fi, err := os.Stat(filepath.Join(tmpDir, compressedIndexFile))
+			require.NoError(t, err)
+			assert.Less(t, fi.Size(), int64(len(indexJSON)/2))
+			compressed, stamp, err := parseCompressedIndex(filepath.Join(tmpDir, compressedIndexFile))
+			require.NoError(t, err)
+			assert.Equal(t, uncompressed, compressed)
+			fi, err = os.Stat(filepath.Join(tmpDir, imgspecv1.ImageIndexFile))
+			require.NoError(t, err)
+			assert.Equal(t, compressedIndexStamp(fi), stamp)
+		} else {
+			_, err = os.Stat(filepath.Join(tmpDir, compressedIndexFile))
+			assert.ErrorIs(t, err, fs.ErrNotExist)
+		}
+
+		listed, err := List(tmpDir)
+		require.NoError(t, err)
+		assert.Len(t, listed, c.expectedEntries)
+	}
+
+	// A layout with only index.json.gz, as written by older versions, can be read, and is upgraded when written.
+	err = os.Remove(filepath.Join(tmpDir, imgspecv1.ImageIndexFile))
+	require.NoError(t, err)
+	err = writeCompressedFile(filepath.Join(tmpDir, compressedIndexFile), indexJSON, "")
+	require.NoError(t, err)
+	ref, err := NewReference(tmpDir, "image-gz")
+	require.NoError(t, err)
+	dest, err := ref.NewImageDestination(context.Background(), &types.SystemContext{OCICompressIndex: true})
+	require.NoError(t, err)
+	defer dest.Close()
+	err = dest.PutManifest(context.Background(), data, nil)
+	require.NoError(t, err)
+	err = dest.Commit(context.Background(), nil) // nil unparsedToplevel is invalid, we don’t currently use the value
+	require.NoError(t, err)
+	parseCompressedIndexIgnoringStamp := func(path string) (*imgspecv1.Index, error) {
+		index, _, err := parseCompressedIndex(path)
+		return index, err
+	}
+	for _, c := range []struct {
+		file  string
+		parse func(string) (*imgspecv1.Index, error)
+	}{
+		{imgspecv1.ImageIndexFile, parseIndex},
+		{compressedIndexFile, parseCompressedIndexIgnoringStamp},
+	} {
+		written, err := c.parse(filepath.Join(tmpDir, c.file))
+		require.NoError(t, err, c.file)
+		require.Len(t, written.Manifests, entries+1, c.file)
+		assert.Equal(t, "image-gz", written.Manifests[entries].Annotations[imgspecv1.AnnotationRefName], c.file)
+	}
+	// No temporary files are left behind
+	dirEntries, err := os.ReadDir(tmpDir)
+	require.NoError(t, err)
+	names := []string{}
+	for _, e := range dirEntries {
+		names = append(names, e.Name())
+	}
+	assert.ElementsMatch(t, []string{"blobs", imgspecv1.ImageIndexFile, compressedIndexFile, imgspecv1.ImageLayoutFile}, names)
+}
+
+func TestLoadIndexCompressed(t *testing.T) {
+	tmpDir := t.TempDir()
+	ref, err := NewReference(tmpDir, "")
+	require.NoError(t, err)
+	indexWithRefName := func(name string) []byte {
+		indexJSON, err := json.Marshal(imgspecv1.Index{
+			Versioned: imgspec.Versioned{SchemaVersion: 2},
+			MediaType: imgspecv1.MediaTypeImageIndex,
+			Manifests: []imgspecv1.Descriptor{{
+				MediaType:   imgspecv1.MediaTypeImageManifest,
+				Digest:      digest.FromString(name),
+				Size:        1,
+				Annotations: map[string]string{imgspecv1.AnnotationRefName: name},
+			}},
+		})
+		require.NoError(t, err)
+		return indexJSON
+	}
+	loadedRefName := func() string {
+		index, err := loadIndex(tmpDir)
+		require.NoError(t, err)
+		require.Len(t, index.Manifests, 1)
+		return index.Manifests[0].Annotations[imgspecv1.AnnotationRefName]
+	}
+	indexPath := filepath.Join(tmpDir, imgspecv1.ImageIndexFile)
+	compressedPath := filepath.Join(tmpDir, compressedIndexFile)
+
+	err = writeIndex(ref.(ociReference), indexWithRefName("written"), true)
+	require.NoError(t, err)
+	assert.Equal(t, "written", loadedRefName())
+
+	// A current index.json.gz is used instead of index.json; to detect that, replace it with different contents.
+	fi, err := os.Stat(indexPath)
+	require.NoError(t, err)
+	err = writeCompressedFile(compressedPath, indexWithRefName("compressed"), compressedIndexStamp(fi))
+	require.NoError(t, err)
+	assert.Equal(t, "compressed", loadedRefName())
+
+	// index.json.gz without a matching stamp is ignored
+	for _, stamp := range []string{"", compressedIndexStamp(fakeFileInfo{size: fi.Size() + 1, modTime: fi.ModTime()})} {
+		err = writeCompressedFile(compressedPath, indexWithRefName("compressed"), stamp)
+		require.NoError(t, err)
+		assert.Equal(t, "written", loadedRefName(), stamp)
+	}
+	// So is an invalid index.json.gz
+	err = os.WriteFile(compressedPath, []byte("this is not gzip"), 0o644)
+	require.NoError(t, err)
+	assert.Equal(t, "written", loadedRefName())
+
+	// index.json.gz is ignored if index.json is modified by another tool
+	err = writeCompressedFile(compressedPath, indexWithRefName("compressed"), compressedIndexStamp(fi))
+	require.NoError(t, err)
+	err = os.WriteFile(indexPath, indexWithRefName("modified"), 0o644)
+	require.NoError(t, err)
+	err = os.Chtimes(indexPath, time.Time{}, fi.ModTime().Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, "modified", loadedRefName())
+
+	// Writing without compression removes index.json.gz
+	err = writeIndex(ref.(ociReference), indexWithRefName("uncompressed"), false)
+	require.NoError(t, err)
+	_, err = os.Stat(compressedPath)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.Equal(t, "uncompressed", loadedRefName())
+}
+
+// fakeFileInfo is a fs.FileInfo with only the size and modification time set.
+type fakeFileInfo struct {
+	fs.FileInfo
+	size    int64
+	modTime time.Time
+}
+
+func (fi fakeFileInfo) Size() int64        { return fi.size }
+func (fi fakeFileInfo) ModTime() time.Time { return fi.modTime }
+
+func TestPutTwoImagesSharingALayer(t *testing.T) {
+	tmpDir := t.TempDir()
+	cache := memory.New()
+	sharedLayer := []byte("shared base layer")
+	sharedLayerDigest := digest.FromBytes(sharedLayer)
+
+	// Create both destinations before either is committed, to make sure neither overwrites the other’s index.json entries.
+	var dests []private.ImageDestination
+	for i, name := range []string{"image1", "image2"} {
+		ref, err := NewReference(tmpDir, name)
+		require.NoError(t, err)
+		dest, err := newImageDestination(nil, ref.(ociReference))
+		require.NoError(t, err)
+		defer dest.Close()
+		dests = append(dests, dest)
+
+		if i == 0 {
+			_, err = dest.PutBlobWithOptions(context.Background(), bytes.NewReader(sharedLayer),
+				types.BlobInfo{Digest: sharedLayerDigest, Size: int64(len(sharedLayer))}, private.PutBlobOptions{Cache: blobinfocache.FromBlobInfoCache(cache)})
+			require.NoError(t, err)
+		}
+	}
+
+	// The second image reuses the blob written for the first one.
+	reused, reusedInfo, err := dests[1].TryReusingBlobWithOptions(context.Background(),
+		types.BlobInfo{Digest: sharedLayerDigest, Size: int64(len(sharedLayer))}, private.TryReusingBlobOptions{Cache: blobinfocache.FromBlobInfoCache(cache)})
+	require.NoError(t, err)
+	assert.True(t, reused)
+	assert.Equal(t, sharedLayerDigest, reusedInfo.Digest)
+	assert.Equal(t, int64(len(sharedLayer)), reusedInfo.Size)
+
+	manifestDigests := []digest.Digest{}
+	for i, dest := range dests {
+		m := []byte(fmt.Sprintf(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json",`+
+			`"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"sha256:%064d","size":%d},`+
+			`"layers":[{"mediaType":"application/vnd.oci.image.layer.v1.tar","digest":"%s","size":%d}]}`,
+			i, i, sharedLayerDigest.String(), len(sharedLayer)))
+		err := dest.PutManifest(context.Background(), m, nil)
+		require.NoError(t, err)
+		manifestDigests = append(manifestDigests, digest.FromBytes(m))
+	}
+	for _, dest := range dests {
+		err := dest.CommitWithOptions(context.Background(), private.CommitOptions{})
+		require.NoError(t, err)
+	}
+
+	// Only spec-defined files are left in the layout.
+	topLevel, err := os.ReadDir(tmpDir)
+	require.NoError(t, err)
+	topLevelNames := []string{}
+	for _, e := range topLevel {
+		topLevelNames = append(topLevelNames, e.Name())
+	}
+	assert.ElementsMatch(t, []string{imgspecv1.ImageBlobsDir, imgspecv1.ImageIndexFile, imgspecv1.ImageLayoutFile}, topLevelNames)
+
+	// The shared layer is stored exactly once.
+	entries, err := os.ReadDir(filepath.Join(tmpDir, "blobs", "sha256"))
+	require.NoError(t, err)
+	layerCount := 0
+	for _, e := range entries {
+		if e.Name() == sharedLayerDigest.Encoded() {
+			layerCount++
+		}
+	}
+	assert.Equal(t, 1, layerCount)
+
+	// Both images are in index.json.
+	ref, err := NewReference(tmpDir, "")
+	require.NoError(t, err)
+	index, err := ref.(ociReference).getIndex()
+	require.NoError(t, err)
+	require.Len(t, index.Manifests, 2)
+	for i, name := range []string{"image1", "image2"} {
+		assert.Equal(t, manifestDigests[i], index.Manifests[i].Digest)
+		assert.Equal(t, name, index.Manifests[i].Annotations[imgspecv1.AnnotationRefName])
+	}
+}
+
 func putTestConfig(t *testing.T, ociRef ociReference, tmpDir string) {
 	data, err := os.ReadFile("../../internal/image/fixtures/oci1-config.json")
 	assert.NoError(t, err)
@@ -2,6 +2,7 @@ package layout
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -10,10 +11,13 @@ import (
 	"os"
 	"strconv"
 
+	"github.com/containers/image/v5/internal/externalblob"
 	"github.com/containers/image/v5/internal/imagesource/impl"
 	"github.com/containers/image/v5/internal/imagesource/stubs"
+	"github.com/containers/image/v5/internal/iolimits"
 	"github.com/containers/image/v5/internal/manifest"
 	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/signature"
 	"github.com/containers/image/v5/pkg/tlsclientconfig"
 	"github.com/containers/image/v5/types"
 	"github.com/docker/go-connections/tlsconfig"
@@ -35,7 +39,6 @@ func (e ImageNotFoundError) Error() string {
 type ociImageSource struct {
 	impl.Compat
 	impl.PropertyMethodsInitialize
-	impl.NoSignatures
 	impl.DoesNotAffectLayerInfosForCopy
 	stubs.NoGetBlobAtInitialize
 
@@ -44,6 +47,11 @@ type ociImageSource struct {
 	descriptor    imgspecv1.Descriptor
 	client        *http.Client
 	sharedBlobDir string
+
+	skipExternalBlobVerification bool
+	readReferrerSignatures       bool
+	// signatureReferrers maps subject digests to digests of manifests referring to them; it is nil until it is first needed.
+	signatureReferrers map[digest.Digest][]digest.Digest
 }
 
 // newImageSource returns an ImageSource for reading from an existing directory.
@@ -82,6 +90,8 @@ func newImageSource(sys *types.SystemContext, ref ociReference) (private.ImageSo
 	if sys != nil {
 		// TODO(jonboulle): check dir existence?
 		s.sharedBlobDir = sys.OCISharedBlobDirPath
+		s.skipExternalBlobVerification = sys.SkipForeignLayerVerification
+		s.readReferrerSignatures = sys.OCIReadReferrerSignatures
 	}
 	s.Compat = impl.AddCompat(s)
 	return s, nil
@@ -141,7 +151,7 @@ func (s *ociImageSource) GetManifest(ctx context.Context, instanceDigest *digest
 // May update BlobInfoCache, preferably after it knows for certain that a blob truly exists at a specific location.
 func (s *ociImageSource) GetBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache) (io.ReadCloser, int64, error) {
 	if len(info.URLs) != 0 {
-		r, s, err := s.getExternalBlob(ctx, info.URLs)
+		r, s, err := s.getExternalBlob(ctx, info)
 		if err != nil {
 			return nil, 0, err
 		} else if r != nil {
@@ -165,10 +175,103 @@ func (s *ociImageSource) GetBlob(ctx context.Context, info types.BlobInfo, cache
 	return r, fi.Size(), nil
 }
 
-// getExternalBlob returns the reader of the first available blob URL from urls, which must not be empty.
+// GetSignaturesWithFormat returns the image's signatures.  It may use a remote (= slow) service.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to retrieve signatures for
+// (when the primary manifest is a manifest list); this never happens if the primary manifest is not a manifest list
+// (e.g. if the source never returns manifest lists).
+//
+// If types.SystemContext.OCIReadReferrerSignatures is set, the signatures are read from sigstore signature manifests
+// in the same layout which refer to the image using their subject field (“referrers”); otherwise, there are no signatures.
+func (s *ociImageSource) GetSignaturesWithFormat(ctx context.Context, instanceDigest *digest.Digest) ([]signature.Signature, error) {
+	if !s.readReferrerSignatures {
+		return nil, nil
+	}
+	manifestDigest := s.descriptor.Digest
+	if instanceDigest != nil {
+		manifestDigest = *instanceDigest
+	}
+	if s.signatureReferrers == nil {
+		referrers, err := s.findSignatureReferrers()
+		if err != nil {
+			return nil, err
+		}
+		s.signatureReferrers = referrers
+	}
+
+	res := []signature.Signature{}
+	for _, referrer := range s.signatureReferrers[manifestDigest] {
+		manifestBlob, err := s.readBlob(referrer, iolimits.MaxManifestBodySize)
+		if err != nil {
+			return nil, fmt.Errorf("reading manifest %s: %w", referrer.String(), err)
+		}
+		var m imgspecv1.Manifest
+		if err := json.Unmarshal(manifestBlob, &m); err != nil {
+			return nil, fmt.Errorf("parsing manifest %s: %w", referrer.String(), err)
+		}
+		for _, layer := range m.Layers {
+			if layer.MediaType != signature.SigstoreSignatureMIMEType {
+				continue
+			}
+			payload, err := s.readBlob(layer.Digest, iolimits.MaxSignatureBodySize)
+			if err != nil {
+				return nil, fmt.Errorf("reading signature %s: %w", layer.Digest.String(), err)
+			}
+			res = append(res, signature.SigstoreFromComponents(layer.MediaType, payload, layer.Annotations))
+		}
+	}
+	return res, nil
+}
+
+// findSignatureReferrers reads all image manifests in the layout’s index,
+// and returns a map from subject digests to digests of the manifests referring to them.
+func (s *ociImageSource) findSignatureReferrers() (map[digest.Digest][]digest.Digest, error) {
+	res := map[digest.Digest][]digest.Digest{}
+	for _, md := range s.index.Manifests {
+		if md.MediaType != "" && md.MediaType != imgspecv1.MediaTypeImageManifest {
+			continue
+		}
+		manifestBlob, err := s.readBlob(md.Digest, iolimits.MaxManifestBodySize)
+		if err != nil {
+			return nil, fmt.Errorf("reading manifest %s: %w", md.Digest.String(), err)
+		}
+		var m imgspecv1.Manifest
+		if err := json.Unmarshal(manifestBlob, &m); err != nil {
+			return nil, fmt.Errorf("parsing manifest %s: %w", md.Digest.String(), err)
+		}
+		if m.Subject != nil && m.Subject.Digest != md.Digest {
+			res[m.Subject.Digest] = append(res[m.Subject.Digest], md.Digest)
+		}
+	}
+	return res, nil
+}
+
+// readBlob returns the contents of a blob with the specified digest, which must not be larger than limit.
+func (s *ociImageSource) readBlob(dig digest.Digest, limit int) ([]byte, error) {
+	path, err := s.ref.blobPath(dig, s.sharedBlobDir)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	blob, err := iolimits.ReadAtMost(f, limit)
+	if err != nil {
+		return nil, err
+	}
+	if actual := dig.Algorithm().FromBytes(blob); actual != dig {
+		return nil, fmt.Errorf("blob digest mismatch: expected %s, got %s", dig.String(), actual.String())
+	}
+	return blob, nil
+}
+
+// getExternalBlob returns the reader of the first available blob URL from info.URLs, which must not be empty.
 // This function can return nil reader when no url is supported by this function. In this case, the caller
 // should fallback to fetch the non-external blob (i.e. pull from the registry).
-func (s *ociImageSource) getExternalBlob(ctx context.Context, urls []string) (io.ReadCloser, int64, error) {
+// Unless verification was disabled in the SystemContext, the reader fails if the contents do not match info.Digest and info.Size.
+func (s *ociImageSource) getExternalBlob(ctx context.Context, info types.BlobInfo) (io.ReadCloser, int64, error) {
+	urls := info.URLs
 	if len(urls) == 0 {
 		return nil, 0, errors.New("internal error: getExternalBlob called with no URLs")
 	}
@@ -198,7 +301,15 @@ func (s *ociImageSource) getExternalBlob(ctx context.Context, urls []string) (io
 			continue
 		}
 
-		return resp.Body, getBlobSize(resp), nil
+		if s.skipExternalBlobVerification {
+			return resp.Body, getBlobSize(resp), nil
+		}
+		reader, err := externalblob.NewVerifyingReader(resp.Body, info)
+		if err != nil {
+			resp.Body.Close()
+			return nil, 0, err
+		}
+		return reader, getBlobSize(resp), nil
 	}
 	if !hasSupportedURL {
 		return nil, 0, nil // fallback to non-external blob
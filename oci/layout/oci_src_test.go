@@ -13,6 +13,7 @@ import (
 	"testing"
 
 	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/signature"
 	"github.com/containers/image/v5/pkg/blobinfocache/memory"
 	"github.com/containers/image/v5/types"
 	digest "github.com/opencontainers/go-digest"
@@ -41,7 +42,12 @@ func TestMain(m *testing.M) {
 
 func TestGetBlobForRemoteLayers(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprintln(w, "Hello world")
+		switch r.URL.Path {
+		case "/corrupted":
+			fmt.Fprint(w, "Hello World")
+		default:
+			fmt.Fprint(w, "Hello world")
+		}
 	}))
 	defer ts.Close()
 	cache := memory.New()
@@ -64,6 +70,23 @@ func TestGetBlobForRemoteLayers(t *testing.T) {
 	data, err := io.ReadAll(reader)
 	require.NoError(t, err)
 	assert.Contains(t, string(data), "Hello world")
+
+	// Corrupted content is rejected, unless verification is disabled
+	layerInfo.URLs = []string{ts.URL + "/corrupted"}
+	for _, skipVerification := range []bool{false, true} {
+		imageSource := createImageSource(t, &types.SystemContext{SkipForeignLayerVerification: skipVerification})
+		defer imageSource.Close()
+		reader, _, err := imageSource.GetBlob(context.Background(), layerInfo, cache)
+		require.NoError(t, err)
+		defer reader.Close()
+		data, err := io.ReadAll(reader)
+		if skipVerification {
+			require.NoError(t, err)
+			assert.Equal(t, "Hello World", string(data))
+		} else {
+			assert.ErrorContains(t, err, "digest mismatch")
+		}
+	}
 }
 
 func TestGetBlobForRemoteLayersWithTLS(t *testing.T) {
@@ -74,11 +97,14 @@ func TestGetBlobForRemoteLayersWithTLS(t *testing.T) {
 	cache := memory.New()
 
 	layer, size, err := imageSource.GetBlob(context.Background(), types.BlobInfo{
-		URLs: []string{httpServerAddr},
+		Digest: digest.FromString(RemoteLayerContent),
+		Size:   int64(len(RemoteLayerContent)),
+		URLs:   []string{httpServerAddr},
 	}, cache)
 	require.NoError(t, err)
 
-	layerContent, _ := io.ReadAll(layer)
+	layerContent, err := io.ReadAll(layer)
+	require.NoError(t, err)
 	assert.Equal(t, RemoteLayerContent, string(layerContent))
 	assert.Equal(t, int64(len(RemoteLayerContent)), size)
 }
@@ -134,6 +160,51 @@ func startRemoteLayerServer() (*httptest.Server, error) {
 	return httpServer, nil
 }
 
+func TestGetSignaturesWithFormat(t *testing.T) {
+	ctx := context.Background()
+
+	ref, err := NewReference("fixtures/signed_image", "latest")
+	require.NoError(t, err)
+
+	// Referrers are ignored by default
+	src, err := ref.NewImageSource(ctx, nil)
+	require.NoError(t, err)
+	defer src.Close()
+	sigs, err := src.(private.ImageSource).GetSignaturesWithFormat(ctx, nil)
+	require.NoError(t, err)
+	assert.Empty(t, sigs)
+
+	src, err = ref.NewImageSource(ctx, &types.SystemContext{OCIReadReferrerSignatures: true})
+	require.NoError(t, err)
+	defer src.Close()
+	privateSrc, ok := src.(private.ImageSource)
+	require.True(t, ok)
+	sigs, err = privateSrc.GetSignaturesWithFormat(ctx, nil)
+	require.NoError(t, err)
+	require.Len(t, sigs, 1)
+	sigstoreSig, ok := sigs[0].(signature.Sigstore)
+	require.True(t, ok)
+	assert.Equal(t, signature.SigstoreSignatureMIMEType, sigstoreSig.UntrustedMIMEType())
+	assert.Equal(t, digest.Digest("sha256:6db8756435ce4eca8e059c5d37b66e21270a311bf3c533ca7271548f74916378"), digest.FromBytes(sigstoreSig.UntrustedPayload()))
+	assert.Equal(t, map[string]string{signature.SigstoreSignatureAnnotationKey: "MEUCIQDn+not+a+real+signature=="}, sigstoreSig.UntrustedAnnotations())
+
+	// A different instance digest has no signatures.
+	otherDigest := digest.FromString("some other manifest")
+	sigs, err = privateSrc.GetSignaturesWithFormat(ctx, &otherDigest)
+	require.NoError(t, err)
+	assert.Empty(t, sigs)
+
+	// A layout without any referrers
+	ref2, err := NewReference("fixtures/delete_image_multiple_images", "3")
+	require.NoError(t, err)
+	src2, err := ref2.NewImageSource(ctx, &types.SystemContext{OCIReadReferrerSignatures: true})
+	require.NoError(t, err)
+	defer src2.Close()
+	sigs, err = src2.(private.ImageSource).GetSignaturesWithFormat(ctx, nil)
+	require.NoError(t, err)
+	assert.Empty(t, sigs)
+}
+
 func createImageSource(t *testing.T, sys *types.SystemContext) types.ImageSource {
 	imageRef, err := NewReference("fixtures/manifest", "")
 	require.NoError(t, err)
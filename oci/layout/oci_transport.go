@@ -1,10 +1,12 @@
 package layout
 
 import (
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
@@ -17,12 +19,17 @@ import (
 	"github.com/containers/image/v5/types"
 	"github.com/opencontainers/go-digest"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
 )
 
 func init() {
 	transports.Register(Transport)
 }
 
+// compressedIndexFile is the name of a gzip-compressed copy of index.json, written in addition to index.json if SystemContext.OCICompressIndex is set.
+// This is not a part of the OCI image layout specification.
+const compressedIndexFile = imgspecv1.ImageIndexFile + ".gz"
+
 var (
 	// Transport is an ImageTransport for OCI directories.
 	Transport = ociTransport{}
@@ -137,6 +144,16 @@ func (ref ociReference) StringWithinTransport() string {
 	return fmt.Sprintf("%s:@%d", ref.dir, ref.sourceIndex)
 }
 
+// NormalizedReference returns an equivalent reference using an absolute directory path without redundant path elements.
+// Unlike PolicyConfigurationIdentity, symbolic links are not resolved.
+func (ref ociReference) NormalizedReference() (types.ImageReference, error) {
+	dir, err := filepath.Abs(ref.dir)
+	if err != nil {
+		return nil, err
+	}
+	return newReference(dir, ref.image, ref.sourceIndex)
+}
+
 // DockerReference returns a Docker reference associated with this reference
 // (fully explicit, i.e. !reference.IsNameOnly, but reflecting user intent,
 // not e.g. after redirect or alias processing), or nil if unknown/not applicable.
@@ -190,8 +207,71 @@ func (ref ociReference) NewImage(ctx context.Context, sys *types.SystemContext)
 
 // getIndex returns a pointer to the index references by this ociReference. If an error occurs opening an index nil is returned together
 // with an error.
+//
+// If the layout contains an index.json.gz which is a current copy of index.json (see compressedIndexStamp), the former is used.
 func (ref ociReference) getIndex() (*imgspecv1.Index, error) {
-	return parseIndex(ref.indexPath())
+	return loadIndex(ref.dir)
+}
+
+// loadIndex returns the index of the layout in dir.
+// index.json is authoritative; index.json.gz is read instead only if it records the current size and modification time of index.json
+// (or, for layouts written by older versions, if index.json does not exist).
+func loadIndex(dir string) (*imgspecv1.Index, error) {
+	indexPath := filepath.Join(dir, imgspecv1.ImageIndexFile)
+	compressedPath := filepath.Join(dir, compressedIndexFile)
+	fi, err := os.Stat(indexPath)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		compressed, _, err2 := parseCompressedIndex(compressedPath)
+		if err2 != nil {
+			if errors.Is(err2, fs.ErrNotExist) {
+				return nil, err // Report the missing index.json, not the optional extension.
+			}
+			return nil, err2
+		}
+		return compressed, nil
+	}
+
+	compressed, stamp, err := parseCompressedIndex(compressedPath)
+	switch {
+	case err == nil && stamp == compressedIndexStamp(fi):
+		return compressed, nil
+	case err == nil:
+		logrus.Debugf("Ignoring outdated %s", compressedPath)
+	case !errors.Is(err, fs.ErrNotExist):
+		logrus.Debugf("Ignoring %s: %v", compressedPath, err)
+	}
+	return parseIndex(indexPath)
+}
+
+// compressedIndexStamp returns a value identifying the version of index.json with fi,
+// recorded in the gzip header of index.json.gz to allow detecting that it is a copy of the current index.json.
+// If index.json is replaced by anything (including tools unaware of index.json.gz), its modification time
+// (and, usually, its size) changes, so the recorded value no longer matches and index.json is used.
+func compressedIndexStamp(fi fs.FileInfo) string {
+	return fmt.Sprintf("%s size=%d mtime=%d", imgspecv1.ImageIndexFile, fi.Size(), fi.ModTime().UnixNano())
+}
+
+// parseCompressedIndex parses a gzip-compressed index at path, and returns it along with the stamp recorded in its header, if any.
+func parseCompressedIndex(path string) (*imgspecv1.Index, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer file.Close()
+	content, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, "", fmt.Errorf("decompressing %s: %w", path, err)
+	}
+	defer content.Close()
+
+	index := new(imgspecv1.Index)
+	if err := json.NewDecoder(content).Decode(index); err != nil {
+		return nil, "", fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return index, content.Comment, nil
 }
 
 func parseIndex(path string) (*imgspecv1.Index, error) {
@@ -288,6 +368,11 @@ func (ref ociReference) indexPath() string {
 	return filepath.Join(ref.dir, imgspecv1.ImageIndexFile)
 }
 
+// compressedIndexPath returns a path for the gzip-compressed copy of index.json, written if SystemContext.OCICompressIndex is set.
+func (ref ociReference) compressedIndexPath() string {
+	return filepath.Join(ref.dir, compressedIndexFile)
+}
+
 // blobPath returns a path for a blob within a directory using OCI image-layout conventions.
 func (ref ociReference) blobPath(digest digest.Digest, sharedBlobDir string) (string, error) {
 	if err := digest.Validate(); err != nil {
@@ -1,10 +1,7 @@
 package layout
 
 import (
-	"encoding/json"
 	"fmt"
-	"os"
-	"path/filepath"
 
 	"github.com/containers/image/v5/types"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
@@ -23,14 +20,10 @@ type ListResult struct {
 func List(dir string) ([]ListResult, error) {
 	var res []ListResult
 
-	indexJSON, err := os.ReadFile(filepath.Join(dir, imgspecv1.ImageIndexFile))
+	index, err := loadIndex(dir)
 	if err != nil {
 		return nil, err
 	}
-	var index imgspecv1.Index
-	if err := json.Unmarshal(indexJSON, &index); err != nil {
-		return nil, err
-	}
 
 	for manifestIndex, md := range index.Manifests {
 		refName := md.Annotations[imgspecv1.AnnotationRefName]
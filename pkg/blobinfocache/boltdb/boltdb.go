@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"io/fs"
+	"slices"
 	"sync"
 	"time"
 
@@ -373,6 +374,11 @@ func (bdc *cache) RecordDigestCompressorData(anyDigest digest.Digest, data blobi
 // RecordKnownLocation records that a blob with the specified digest exists within the specified (transport, scope) scope,
 // and can be reused given the opaque location data.
 func (bdc *cache) RecordKnownLocation(transport types.ImageTransport, scope types.BICTransportScope, blobDigest digest.Digest, location types.BICLocationReference) {
+	bdc.recordKnownLocation(transport, scope, blobDigest, location, time.Now())
+}
+
+// recordKnownLocation implements RecordKnownLocation, recording the location as of recordTime.
+func (bdc *cache) recordKnownLocation(transport types.ImageTransport, scope types.BICTransportScope, blobDigest digest.Digest, location types.BICLocationReference, recordTime time.Time) {
 	_ = bdc.update(func(tx *bolt.Tx) error {
 		b, err := tx.CreateBucketIfNotExists(knownLocationsBucket)
 		if err != nil {
@@ -390,7 +396,7 @@ func (bdc *cache) RecordKnownLocation(transport types.ImageTransport, scope type
 		if err != nil {
 			return err
 		}
-		value, err := time.Now().MarshalBinary()
+		value, err := recordTime.MarshalBinary()
 		if err != nil {
 			return err
 		}
@@ -401,6 +407,117 @@ func (bdc *cache) RecordKnownLocation(transport types.ImageTransport, scope type
 	}) // FIXME? Log error (but throttle the log volume on repeated accesses)?
 }
 
+// PruneOptions specifies which entries Prune removes.
+type PruneOptions struct {
+	// MaxAge, if not 0, removes known blob locations which were last recorded more than MaxAge ago.
+	MaxAge time.Duration
+	// MaxKnownLocations, if not 0, removes the least recently recorded known blob locations so that at most MaxKnownLocations remain.
+	MaxKnownLocations int
+}
+
+// Prune removes stale known blob locations from the BoltDB cache at path, as specified by options.
+// Data about relationships between digests, and about compression, is not removed: it remains valid regardless of the contents of any registry.
+//
+// BoltDB never shrinks the database file, but it reuses the space of removed entries; so, pruning regularly with MaxKnownLocations set
+// bounds the size of the file.
+//
+// It is not an error if the database does not exist.
+func Prune(path string, options PruneOptions) error {
+	if options.MaxAge < 0 || options.MaxKnownLocations < 0 {
+		return fmt.Errorf("invalid pruning options %#v", options)
+	}
+	if err := fileutils.Lexists(path); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	return new2(path).prune(options, time.Now())
+}
+
+// knownLocation identifies a single knownLocationsBucket entry.
+type knownLocation struct {
+	transport, scope, digest, location []byte
+	recordTime                         time.Time // Zero if the value is not valid
+}
+
+// prune implements Prune, treating now as the current time.
+func (bdc *cache) prune(options PruneOptions, now time.Time) error {
+	return bdc.update(func(tx *bolt.Tx) error {
+		locationsBucket := tx.Bucket(knownLocationsBucket)
+		if locationsBucket == nil {
+			return nil
+		}
+		// Collect all entries first, BoltDB does not allow modifying buckets while iterating over them.
+		// The keys are cloned because they are only valid until the next modification.
+		locations := []knownLocation{}
+		if err := locationsBucket.ForEachBucket(func(transport []byte) error {
+			transportBucket := locationsBucket.Bucket(transport)
+			return transportBucket.ForEachBucket(func(scope []byte) error {
+				scopeBucket := transportBucket.Bucket(scope)
+				return scopeBucket.ForEachBucket(func(digest []byte) error {
+					return scopeBucket.Bucket(digest).ForEach(func(location, value []byte) error {
+						t := time.Time{}
+						if err := t.UnmarshalBinary(value); err != nil {
+							t = time.Time{} // Treat invalid entries as the oldest ones
+						}
+						locations = append(locations, knownLocation{
+							transport:  bytes.Clone(transport),
+							scope:      bytes.Clone(scope),
+							digest:     bytes.Clone(digest),
+							location:   bytes.Clone(location),
+							recordTime: t,
+						})
+						return nil
+					})
+				})
+			})
+		}); err != nil {
+			return err
+		}
+
+		// Oldest first
+		slices.SortStableFunc(locations, func(a, b knownLocation) int {
+			return a.recordTime.Compare(b.recordTime)
+		})
+		toRemove := 0
+		if options.MaxAge != 0 {
+			cutoff := now.Add(-options.MaxAge)
+			for toRemove < len(locations) && locations[toRemove].recordTime.Before(cutoff) {
+				toRemove++
+			}
+		}
+		if options.MaxKnownLocations != 0 && len(locations)-toRemove > options.MaxKnownLocations {
+			toRemove = len(locations) - options.MaxKnownLocations
+		}
+		for _, l := range locations[:toRemove] {
+			transportBucket := locationsBucket.Bucket(l.transport)
+			scopeBucket := transportBucket.Bucket(l.scope)
+			digestBucket := scopeBucket.Bucket(l.digest)
+			if err := digestBucket.Delete(l.location); err != nil {
+				return err
+			}
+			// Remove buckets which have become empty, so that they don’t accumulate.
+			if k, _ := digestBucket.Cursor().First(); k == nil {
+				if err := scopeBucket.DeleteBucket(l.digest); err != nil {
+					return err
+				}
+				if k, _ := scopeBucket.Cursor().First(); k == nil {
+					if err := transportBucket.DeleteBucket(l.scope); err != nil {
+						return err
+					}
+					if k, _ := transportBucket.Cursor().First(); k == nil {
+						if err := locationsBucket.DeleteBucket(l.transport); err != nil {
+							return err
+						}
+					}
+				}
+			}
+		}
+		return nil
+	})
+}
+
 // appendReplacementCandidates creates prioritize.CandidateWithTime values for digest in scopeBucket
 // (which might be nil) with corresponding compression
 // info from compressionBucket and specificVariantCompresssionBucket (which might be nil), and returns the result of appending them
@@ -1,11 +1,20 @@
 package boltdb
 
 import (
+	"os"
 	"path/filepath"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/containers/image/v5/internal/blobinfocache"
+	"github.com/containers/image/v5/internal/testing/mocks"
 	"github.com/containers/image/v5/pkg/blobinfocache/internal/test"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
 )
 
 var _ blobinfocache.BlobInfoCache2 = &cache{}
@@ -24,3 +33,82 @@ func TestNew(t *testing.T) {
 }
 
 // FIXME: Tests for the various corner cases / failure cases of boltDBCache should be added here.
+
+func TestPrune(t *testing.T) {
+	transport := mocks.NameImageTransport("==BlobInfocache transport mock")
+	scope := types.BICTransportScope{Opaque: "scope"}
+	otherScope := types.BICTransportScope{Opaque: "other scope"}
+	digest1 := digest.FromString("1")
+	digest2 := digest.FromString("2")
+	now := time.Now()
+
+	// A missing database is not an error, and is not created.
+	missingPath := filepath.Join(t.TempDir(), "db")
+	err := Prune(missingPath, PruneOptions{MaxAge: time.Hour})
+	require.NoError(t, err)
+	_, err = os.Lstat(missingPath)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	for _, c := range []struct {
+		options  PruneOptions
+		expected []string // Locations remaining in (scope, digest1), (scope, digest2), (otherScope, digest1), in this order
+	}{
+		{PruneOptions{}, []string{"new", "old", "older", "oldest"}},
+		{PruneOptions{MaxAge: 90 * time.Minute}, []string{"new", "old"}},
+		{PruneOptions{MaxAge: 30 * time.Minute}, []string{"new"}},
+		{PruneOptions{MaxKnownLocations: 3}, []string{"new", "old", "older"}},
+		{PruneOptions{MaxKnownLocations: 10}, []string{"new", "old", "older", "oldest"}},
+		{PruneOptions{MaxAge: 150 * time.Minute, MaxKnownLocations: 2}, []string{"new", "old"}},
+		{PruneOptions{MaxAge: 90 * time.Minute, MaxKnownLocations: 3}, []string{"new", "old"}},
+	} {
+		path := filepath.Join(t.TempDir(), "db")
+		bdc := new2(path)
+		bdc.recordKnownLocation(transport, scope, digest1, types.BICLocationReference{Opaque: "new"}, now)
+		bdc.recordKnownLocation(transport, scope, digest1, types.BICLocationReference{Opaque: "old"}, now.Add(-1*time.Hour))
+		bdc.recordKnownLocation(transport, scope, digest2, types.BICLocationReference{Opaque: "older"}, now.Add(-2*time.Hour))
+		bdc.recordKnownLocation(transport, otherScope, digest1, types.BICLocationReference{Opaque: "oldest"}, now.Add(-3*time.Hour))
+		bdc.RecordDigestUncompressedPair(digest1, digest2)
+
+		err := Prune(path, c.options)
+		require.NoError(t, err, c.options)
+
+		remaining := []string{}
+		for _, e := range []struct {
+			scope types.BICTransportScope
+			d     digest.Digest
+		}{
+			{scope, digest1},
+			{scope, digest2},
+			{otherScope, digest1},
+		} {
+			for _, candidate := range bdc.CandidateLocations(transport, e.scope, e.d, false) {
+				remaining = append(remaining, candidate.Location.Opaque)
+			}
+		}
+		assert.Equal(t, c.expected, remaining, c.options)
+		// Digest relationships are not removed.
+		assert.Equal(t, digest2, bdc.UncompressedDigest(digest1), c.options)
+
+		// Empty buckets are removed.
+		err = bdc.view(func(tx *bolt.Tx) error {
+			scopesBucket := tx.Bucket(knownLocationsBucket).Bucket([]byte(transport.Name()))
+			if !slices.Contains(c.expected, "older") {
+				assert.Nil(t, scopesBucket.Bucket([]byte(scope.Opaque)).Bucket([]byte(digest2.String())), c.options)
+			}
+			if !slices.Contains(c.expected, "oldest") {
+				assert.Nil(t, scopesBucket.Bucket([]byte(otherScope.Opaque)), c.options)
+			}
+			return nil
+		})
+		require.NoError(t, err)
+	}
+
+	// Invalid options
+	for _, options := range []PruneOptions{
+		{MaxAge: -time.Hour},
+		{MaxKnownLocations: -1},
+	} {
+		err := Prune(missingPath, options)
+		assert.Error(t, err)
+	}
+}
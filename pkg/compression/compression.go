@@ -8,7 +8,6 @@ import (
 
 	"github.com/containers/image/v5/pkg/compression/internal"
 	"github.com/containers/image/v5/pkg/compression/types"
-	"github.com/containers/storage/pkg/chunked/compressor"
 	"github.com/klauspost/pgzip"
 	"github.com/sirupsen/logrus"
 	"github.com/ulikunitz/xz"
@@ -32,7 +31,7 @@ var (
 		[]byte{0x28, 0xb5, 0x2f, 0xfd}, ZstdDecompressor, zstdCompressor)
 	// ZstdChunked is a Zstd compression with chunk metadata which allows random access to individual files.
 	ZstdChunked = internal.NewAlgorithm(types.ZstdChunkedAlgorithmName, types.ZstdAlgorithmName,
-		nil, ZstdDecompressor, compressor.ZstdCompressor)
+		nil, ZstdDecompressor, zstdChunkedCompressor)
 
 	compressionAlgorithms = map[string]Algorithm{
 		Gzip.Name():        Gzip,
@@ -78,6 +77,9 @@ func XzDecompressor(r io.Reader) (io.ReadCloser, error) {
 // gzipCompressor is a CompressorFunc for the gzip compression algorithm.
 func gzipCompressor(r io.Writer, metadata map[string]string, level *int) (io.WriteCloser, error) {
 	if level != nil {
+		if *level < pgzip.HuffmanOnly || *level > pgzip.BestCompression {
+			return nil, fmt.Errorf("invalid gzip compression level %d, must be between %d and %d", *level, pgzip.HuffmanOnly, pgzip.BestCompression)
+		}
 		return pgzip.NewWriterLevel(r, *level)
 	}
 	return pgzip.NewWriter(r), nil
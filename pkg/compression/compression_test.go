@@ -7,6 +7,7 @@ import (
 	"os"
 	"testing"
 
+	digest "github.com/opencontainers/go-digest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -126,3 +127,59 @@ func TestAutoDecompress(t *testing.T) {
 	_, _, err = AutoDecompress(reader)
 	assert.Error(t, err)
 }
+
+func TestCompressStreamLevels(t *testing.T) {
+	input := bytes.Repeat([]byte("Lorem ipsum dolor sit amet, consectetur adipiscing elit. "), 10000)
+	for i := range input { // Make the input less trivially compressible, so that levels make a difference.
+		if i%7 == 0 {
+			input[i] = byte(i % 251)
+		}
+	}
+	expectedDigest := digest.FromBytes(input)
+
+	compress := func(algo Algorithm, level *int) ([]byte, error) {
+		var buf bytes.Buffer
+		compressor, err := CompressStream(&buf, algo, level)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := compressor.Write(input); err != nil {
+			return nil, err
+		}
+		if err := compressor.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	for _, c := range []struct {
+		algo          Algorithm
+		fast, best    int
+		invalidLevels []int
+	}{
+		{Gzip, 1, 9, []int{-3, 10}},
+		{Zstd, 1, 22, []int{0, 23}},
+	} {
+		var sizes []int
+		for _, level := range []int{c.fast, c.best} {
+			compressed, err := compress(c.algo, &level)
+			require.NoError(t, err, c.algo.Name())
+			sizes = append(sizes, len(compressed))
+
+			// The result is valid, and decompresses to the original data.
+			decompressed, isCompressed, err := AutoDecompress(bytes.NewReader(compressed))
+			require.NoError(t, err, c.algo.Name())
+			assert.True(t, isCompressed, c.algo.Name())
+			decompressedDigest, err := digest.FromReader(decompressed)
+			require.NoError(t, err, c.algo.Name())
+			decompressed.Close()
+			assert.Equal(t, expectedDigest, decompressedDigest, c.algo.Name())
+		}
+		assert.NotEqual(t, sizes[0], sizes[1], c.algo.Name())
+
+		for _, level := range c.invalidLevels {
+			_, err := compress(c.algo, &level)
+			assert.Error(t, err, "%s level %d", c.algo.Name(), level)
+		}
+	}
+}
@@ -1,8 +1,10 @@
 package compression
 
 import (
+	"fmt"
 	"io"
 
+	"github.com/containers/storage/pkg/chunked/compressor"
 	"github.com/klauspost/compress/zstd"
 )
 
@@ -45,14 +47,41 @@ func zstdWriterWithLevel(dest io.Writer, level int) (*zstd.Encoder, error) {
 	return zstd.NewWriter(dest, zstd.WithEncoderLevel(el))
 }
 
+const (
+	// zstdMinLevel and zstdMaxLevel are the range of compression levels accepted for zstd.
+	zstdMinLevel = 1
+	zstdMaxLevel = 22
+)
+
+// validateZstdLevel returns an error if level is not a valid zstd compression level.
+func validateZstdLevel(level int) error {
+	if level < zstdMinLevel || level > zstdMaxLevel {
+		return fmt.Errorf("invalid zstd compression level %d, must be between %d and %d", level, zstdMinLevel, zstdMaxLevel)
+	}
+	return nil
+}
+
 // zstdCompressor is a CompressorFunc for the zstd compression algorithm.
 func zstdCompressor(r io.Writer, metadata map[string]string, level *int) (io.WriteCloser, error) {
 	if level == nil {
 		return zstdWriter(r)
 	}
+	if err := validateZstdLevel(*level); err != nil {
+		return nil, err
+	}
 	return zstdWriterWithLevel(r, *level)
 }
 
+// zstdChunkedCompressor is a CompressorFunc for the zstd:chunked compression algorithm.
+func zstdChunkedCompressor(r io.Writer, metadata map[string]string, level *int) (io.WriteCloser, error) {
+	if level != nil {
+		if err := validateZstdLevel(*level); err != nil {
+			return nil, err
+		}
+	}
+	return compressor.ZstdCompressor(r, metadata, level)
+}
+
 // ZstdDecompressor is a DecompressorFunc for the zstd compression algorithm.
 func ZstdDecompressor(r io.Reader) (io.ReadCloser, error) {
 	return zstdReader(r)
@@ -11,6 +11,8 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/internal/multierr"
@@ -76,7 +78,17 @@ func GetAllCredentials(sys *types.SystemContext) (map[string]types.DockerAuthCon
 	// While we're at it, we’ll also canonicalize docker.io to the standard format.
 	normalizedDockerIORegistry := normalizeRegistry("docker.io")
 
-	helpers, err := sysregistriesv2.CredentialHelpers(sys)
+	if dir := systemdCredentialsDir(sys); dir != "" {
+		registries, err := systemdCredentialsRegistries(dir)
+		if err != nil {
+			return nil, fmt.Errorf("listing systemd credentials in %q: %w", dir, err)
+		}
+		for _, registry := range registries {
+			allKeys.Add(registry)
+		}
+	}
+
+	helpers, err := credentialHelpers(sys)
 	if err != nil {
 		return nil, err
 	}
@@ -138,6 +150,18 @@ func GetAllCredentials(sys *types.SystemContext) (map[string]types.DockerAuthCon
 	return allCreds, nil
 }
 
+// credentialHelpers returns the credential helpers to use for sys, in the order they should be used.
+func credentialHelpers(sys *types.SystemContext) ([]string, error) {
+	if sys != nil && sys.AuthFilePathOnly {
+		if sys.AuthFilePath == "" {
+			return nil, errors.New("AuthFilePathOnly is set but AuthFilePath is not")
+		}
+		// Ignore credential helpers from registries.conf; getAuthFilePaths only returns AuthFilePath.
+		return []string{sysregistriesv2.AuthenticationFileHelper}, nil
+	}
+	return sysregistriesv2.CredentialHelpers(sys)
+}
+
 // getAuthFilePaths returns a slice of authPaths based on the system context
 // in the order they should be searched. Note that some paths may not exist.
 // The homeDir parameter should always be homedir.Get(), and is only intended to be overridden
@@ -180,7 +204,8 @@ func getAuthFilePaths(sys *types.SystemContext, homeDir string) []authPath {
 //
 // GetCredentialsForRef should almost always be used in favor of this API.
 func GetCredentials(sys *types.SystemContext, key string) (types.DockerAuthConfig, error) {
-	return getCredentialsWithHomeDir(sys, key, homedir.Get())
+	creds, _, err := getCredentialsWithHomeDirAndOrigin(sys, key, homedir.Get())
+	return creds, err
 }
 
 // GetCredentialsForRef returns the registry credentials necessary for
@@ -188,21 +213,57 @@ func GetCredentials(sys *types.SystemContext, key string) (types.DockerAuthConfi
 // appropriate for sys and the users’ configuration.
 // If an entry is not found, an empty struct is returned.
 func GetCredentialsForRef(sys *types.SystemContext, ref reference.Named) (types.DockerAuthConfig, error) {
-	return getCredentialsWithHomeDir(sys, ref.Name(), homedir.Get())
+	creds, _, err := getCredentialsWithHomeDirAndOrigin(sys, ref.Name(), homedir.Get())
+	return creds, err
+}
+
+// GetCredentialsWithOrigin returns the registry credentials matching key, like GetCredentials,
+// and a human-readable description of where the credentials were found: an auth file path,
+// a credential helper, or "explicit" for credentials provided in sys.DockerAuthConfig.
+// The origin never contains the credentials themselves.
+// If an entry is not found, an empty struct and an empty origin are returned.
+// NOTE: The origin is only intended to be read by humans; its form is not an API,
+// it may change (or new forms can be added) any time.
+func GetCredentialsWithOrigin(sys *types.SystemContext, key string) (types.DockerAuthConfig, string, error) {
+	return getCredentialsWithHomeDirAndOrigin(sys, key, homedir.Get())
+}
+
+// GetCredentialsForRefWithOrigin returns the registry credentials necessary for
+// accessing ref on the registry ref points to, like GetCredentialsForRef,
+// and a human-readable description of where the credentials were found,
+// like GetCredentialsWithOrigin.
+func GetCredentialsForRefWithOrigin(sys *types.SystemContext, ref reference.Named) (types.DockerAuthConfig, string, error) {
+	return getCredentialsWithHomeDirAndOrigin(sys, ref.Name(), homedir.Get())
 }
 
 // getCredentialsWithHomeDir is an internal implementation detail of
 // GetCredentialsForRef and GetCredentials. It exists only to allow testing it
 // with an artificial home directory.
 func getCredentialsWithHomeDir(sys *types.SystemContext, key, homeDir string) (types.DockerAuthConfig, error) {
+	creds, _, err := getCredentialsWithHomeDirAndOrigin(sys, key, homeDir)
+	return creds, err
+}
+
+// credentialOriginExplicit is the origin returned by GetCredentialsWithOrigin for sys.DockerAuthConfig.
+const credentialOriginExplicit = "explicit"
+
+// credHelperOrigin returns a human-readable description of credHelper, for GetCredentialsWithOrigin.
+func credHelperOrigin(credHelper string) string {
+	return fmt.Sprintf("credential helper: %s", credHelper)
+}
+
+// getCredentialsWithHomeDirAndOrigin is an internal implementation detail of
+// GetCredentials and GetCredentialsWithOrigin (and their …ForRef variants). It exists only to allow testing it
+// with an artificial home directory.
+func getCredentialsWithHomeDirAndOrigin(sys *types.SystemContext, key, homeDir string) (types.DockerAuthConfig, string, error) {
 	_, err := validateKey(key)
 	if err != nil {
-		return types.DockerAuthConfig{}, err
+		return types.DockerAuthConfig{}, "", err
 	}
 
 	if sys != nil && sys.DockerAuthConfig != nil {
 		logrus.Debugf("Returning credentials for %s from DockerAuthConfig", key)
-		return *sys.DockerAuthConfig, nil
+		return *sys.DockerAuthConfig, credentialOriginExplicit, nil
 	}
 
 	var registry string // We compute this once because it is used in several places.
@@ -212,39 +273,54 @@ func getCredentialsWithHomeDir(sys *types.SystemContext, key, homeDir string) (t
 		registry = key
 	}
 
+	if dir := systemdCredentialsDir(sys); dir != "" {
+		creds, path, err := getCredsFromSystemdCredentials(dir, registry)
+		if err != nil {
+			return types.DockerAuthConfig{}, "", fmt.Errorf("reading systemd credentials for %s: %w", registry, err)
+		}
+		if creds != (types.DockerAuthConfig{}) {
+			logrus.Debugf("Returning credentials for %s from systemd credential %s", registry, path)
+			return creds, path, nil
+		}
+	}
+
 	// Anonymous function to query credentials from auth files.
-	getCredentialsFromAuthFiles := func() (types.DockerAuthConfig, string, error) {
+	// Returns the path of the file, and the name of a credential helper if the file refers to one.
+	getCredentialsFromAuthFiles := func() (types.DockerAuthConfig, string, string, error) {
 		for _, path := range getAuthFilePaths(sys, homeDir) {
-			creds, err := findCredentialsInFile(key, registry, path)
+			creds, fileCredHelper, err := findCredentialsInFile(key, registry, path)
 			if err != nil {
-				return types.DockerAuthConfig{}, "", err
+				return types.DockerAuthConfig{}, "", "", err
 			}
 
 			if creds != (types.DockerAuthConfig{}) {
-				return creds, path.path, nil
+				return creds, path.path, fileCredHelper, nil
 			}
 		}
-		return types.DockerAuthConfig{}, "", nil
+		return types.DockerAuthConfig{}, "", "", nil
 	}
 
-	helpers, err := sysregistriesv2.CredentialHelpers(sys)
+	helpers, err := credentialHelpers(sys)
 	if err != nil {
-		return types.DockerAuthConfig{}, err
+		return types.DockerAuthConfig{}, "", err
 	}
 
+	// Helpers are tried in order; a helper which fails is skipped, and the lookup only fails
+	// if all of the helpers fail (a helper finding no credentials is not a failure).
 	var multiErr []error
 	for _, helper := range helpers {
 		var (
 			creds          types.DockerAuthConfig
 			helperKey      string
 			credHelperPath string
+			fileCredHelper string
 			err            error
 		)
 		switch helper {
 		// Special-case the built-in helper for auth files.
 		case sysregistriesv2.AuthenticationFileHelper:
 			helperKey = key
-			creds, credHelperPath, err = getCredentialsFromAuthFiles()
+			creds, credHelperPath, fileCredHelper, err = getCredentialsFromAuthFiles()
 		// External helpers.
 		default:
 			// This intentionally uses "registry", not "key"; we don't support namespaced
@@ -259,19 +335,32 @@ func getCredentialsWithHomeDir(sys *types.SystemContext, key, homeDir string) (t
 		}
 		if creds != (types.DockerAuthConfig{}) {
 			msg := fmt.Sprintf("Found credentials for %s in credential helper %s", helperKey, helper)
+			var origin string
+			switch {
+			case fileCredHelper != "":
+				origin = fmt.Sprintf("%s (configured in %s)", credHelperOrigin(fileCredHelper), credHelperPath)
+			case credHelperPath != "":
+				origin = credHelperPath
+			default:
+				origin = credHelperOrigin(helper)
+			}
 			if credHelperPath != "" {
 				msg = fmt.Sprintf("%s in file %s", msg, credHelperPath)
 			}
 			logrus.Debug(msg)
-			return creds, nil
+			return creds, origin, nil
 		}
 	}
 	if multiErr != nil {
-		return types.DockerAuthConfig{}, multierr.Format("errors looking up credentials:\n\t* ", "\nt* ", "\n", multiErr)
+		if len(multiErr) == len(helpers) {
+			return types.DockerAuthConfig{}, "", multierr.Format("errors looking up credentials:\n\t* ", "\nt* ", "\n", multiErr)
+		}
+		logrus.Warnf("Ignoring errors looking up credentials for %s in some credential helpers: %v",
+			key, multierr.Format("", "; ", "", multiErr))
 	}
 
 	logrus.Debugf("No credentials for %s found", key)
-	return types.DockerAuthConfig{}, nil
+	return types.DockerAuthConfig{}, "", nil
 }
 
 // GetAuthentication returns the registry credentials matching key, appropriate for
@@ -527,7 +616,7 @@ func prepareForEdit(sys *types.SystemContext, key string, keyRelevant bool) ([]s
 		return []string{sysregistriesv2.AuthenticationFileHelper}, modifyDockerConfigJSON, key, false, nil
 	}
 
-	helpers, err := sysregistriesv2.CredentialHelpers(sys)
+	helpers, err := credentialHelpers(sys)
 	if err != nil {
 		return nil, nil, "", false, err
 	}
@@ -752,10 +841,56 @@ func modifyDockerConfigJSON(sys *types.SystemContext, editor func(fileContents *
 	return description, nil
 }
 
+// credHelperResponse is the output of a credential helper’s "get" action.
+// It is credentials.Credentials extended with an optional ExpiresAt field,
+// which is not a part of the docker-credential-helpers protocol; helpers that
+// return short-lived tokens can set it to allow us to reuse the credentials
+// until they expire, and to invoke the helper again afterwards.
+type credHelperResponse struct {
+	ServerURL string
+	Username  string
+	Secret    string
+	ExpiresAt *time.Time `json:",omitempty"`
+}
+
+// credHelperCacheKey identifies a credential helper lookup in credHelperCache.
+type credHelperCacheKey struct {
+	helper   string
+	registry string
+}
+
+// credHelperCacheEntry is a credential helper lookup result that is valid until expiresAt.
+type credHelperCacheEntry struct {
+	creds     types.DockerAuthConfig
+	expiresAt time.Time
+}
+
+var (
+	// credHelperCache contains credentials returned by credential helpers with an ExpiresAt value.
+	// Credentials without an expiry are never cached, the helper is invoked on every lookup.
+	credHelperCache     = map[credHelperCacheKey]credHelperCacheEntry{}
+	credHelperCacheLock sync.Mutex
+	// timeNow is time.Now, it exists only to allow tests to simulate credential expiry.
+	timeNow = time.Now
+)
+
 func getCredsFromCredHelper(credHelper, registry string) (types.DockerAuthConfig, error) {
+	cacheKey := credHelperCacheKey{helper: credHelper, registry: registry}
+	credHelperCacheLock.Lock()
+	entry, ok := credHelperCache[cacheKey]
+	if ok && !timeNow().Before(entry.expiresAt) {
+		delete(credHelperCache, cacheKey)
+		ok = false
+	}
+	credHelperCacheLock.Unlock()
+	if ok {
+		logrus.Debugf("Using cached credentials for %s from credential helper %s, valid until %s", registry, credHelper, entry.expiresAt)
+		return entry.creds, nil
+	}
+
 	helperName := fmt.Sprintf("docker-credential-%s", credHelper)
 	p := helperclient.NewShellProgramFunc(helperName)
-	creds, err := helperclient.Get(p, registry)
+	resp, err := getFromCredHelperProgram(p, registry)
 	if err != nil {
 		if credentials.IsErrCredentialsNotFoundMessage(err.Error()) {
 			logrus.Debugf("Not logged in to %s with credential helper %s", registry, credHelper)
@@ -764,17 +899,54 @@ func getCredsFromCredHelper(credHelper, registry string) (types.DockerAuthConfig
 		return types.DockerAuthConfig{}, err
 	}
 
-	switch creds.Username {
+	var creds types.DockerAuthConfig
+	switch resp.Username {
 	case "<token>":
-		return types.DockerAuthConfig{
-			IdentityToken: creds.Secret,
-		}, nil
+		creds = types.DockerAuthConfig{
+			IdentityToken: resp.Secret,
+		}
 	default:
-		return types.DockerAuthConfig{
-			Username: creds.Username,
-			Password: creds.Secret,
-		}, nil
+		creds = types.DockerAuthConfig{
+			Username: resp.Username,
+			Password: resp.Secret,
+		}
+	}
+	if resp.ExpiresAt != nil {
+		credHelperCacheLock.Lock()
+		credHelperCache[cacheKey] = credHelperCacheEntry{creds: creds, expiresAt: *resp.ExpiresAt}
+		credHelperCacheLock.Unlock()
+	}
+	return creds, nil
+}
+
+// getFromCredHelperProgram is helperclient.Get, except that it also parses the
+// optional ExpiresAt field of the helper’s response.
+func getFromCredHelperProgram(program helperclient.ProgramFunc, serverURL string) (*credHelperResponse, error) {
+	cmd := program(credentials.ActionGet)
+	cmd.Input(strings.NewReader(serverURL))
+
+	out, err := cmd.Output()
+	if err != nil {
+		if credentials.IsErrCredentialsNotFoundMessage(string(out)) {
+			return nil, credentials.NewErrCredentialsNotFound()
+		}
+		return nil, fmt.Errorf("error getting credentials - err: %v, out: `%s`", err, strings.TrimSpace(string(out)))
+	}
+
+	resp := &credHelperResponse{
+		ServerURL: serverURL,
 	}
+	if err := json.Unmarshal(out, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// forgetCachedCredsFromCredHelper drops cached credentials for registry in credHelper, if any.
+func forgetCachedCredsFromCredHelper(credHelper, registry string) {
+	credHelperCacheLock.Lock()
+	defer credHelperCacheLock.Unlock()
+	delete(credHelperCache, credHelperCacheKey{helper: credHelper, registry: registry})
 }
 
 // setCredsInCredHelper stores (username, password) for registry in credHelper.
@@ -787,6 +959,7 @@ func setCredsInCredHelper(credHelper, registry, username, password string) (stri
 		Username:  username,
 		Secret:    password,
 	}
+	forgetCachedCredsFromCredHelper(credHelper, registry)
 	if err := helperclient.Store(p, creds); err != nil {
 		return "", err
 	}
@@ -794,6 +967,7 @@ func setCredsInCredHelper(credHelper, registry, username, password string) (stri
 }
 
 func deleteCredsFromCredHelper(credHelper, registry string) error {
+	forgetCachedCredsFromCredHelper(credHelper, registry)
 	helperName := fmt.Sprintf("docker-credential-%s", credHelper)
 	p := helperclient.NewShellProgramFunc(helperName)
 	return helperclient.Erase(p, registry)
@@ -801,10 +975,11 @@ func deleteCredsFromCredHelper(credHelper, registry string) error {
 
 // findCredentialsInFile looks for credentials matching "key"
 // (which is "registry" or a namespace in "registry") in "path".
-func findCredentialsInFile(key, registry string, path authPath) (types.DockerAuthConfig, error) {
+// If "path" refers to a credential helper for "registry", the helper name is returned as well.
+func findCredentialsInFile(key, registry string, path authPath) (types.DockerAuthConfig, string, error) {
 	fileContents, err := path.parse()
 	if err != nil {
-		return types.DockerAuthConfig{}, fmt.Errorf("reading JSON file %q: %w", path.path, err)
+		return types.DockerAuthConfig{}, "", fmt.Errorf("reading JSON file %q: %w", path.path, err)
 	}
 
 	// First try cred helpers. They should always be normalized.
@@ -812,7 +987,8 @@ func findCredentialsInFile(key, registry string, path authPath) (types.DockerAut
 	// credentials in helpers.
 	if ch, exists := fileContents.CredHelpers[registry]; exists {
 		logrus.Debugf("Looking up in credential helper %s based on credHelpers entry in %s", ch, path.path)
-		return getCredsFromCredHelper(ch, registry)
+		creds, err := getCredsFromCredHelper(ch, registry)
+		return creds, ch, err
 	}
 
 	// Support sub-registry namespaces in auth.
@@ -829,7 +1005,8 @@ func findCredentialsInFile(key, registry string, path authPath) (types.DockerAut
 	// keys we prefer exact matches as well.
 	for _, key := range keys {
 		if val, exists := fileContents.AuthConfigs[key]; exists {
-			return decodeDockerAuth(path.path, key, val)
+			creds, err := decodeDockerAuth(path.path, key, val)
+			return creds, "", err
 		}
 	}
 
@@ -844,14 +1021,15 @@ func findCredentialsInFile(key, registry string, path authPath) (types.DockerAut
 	registry = normalizeRegistry(registry)
 	for k, v := range fileContents.AuthConfigs {
 		if normalizeAuthFileKey(k, path.legacyFormat) == registry {
-			return decodeDockerAuth(path.path, k, v)
+			creds, err := decodeDockerAuth(path.path, k, v)
+			return creds, "", err
 		}
 	}
 
 	// Only log this if we found nothing; getCredentialsWithHomeDir logs the
 	// source of found data.
 	logrus.Debugf("No credentials matching %s found in %s", key, path.path)
-	return types.DockerAuthConfig{}, nil
+	return types.DockerAuthConfig{}, "", nil
 }
 
 // authKeysForKey returns the keys matching a provided auth file key, in order
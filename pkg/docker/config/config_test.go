@@ -6,7 +6,9 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/types"
@@ -633,6 +635,327 @@ func TestGetAllCredentials(t *testing.T) {
 	}
 }
 
+func TestGetCredentialsWithOrigin(t *testing.T) {
+	// override PATH for executing credHelper
+	path, err := os.Getwd()
+	require.NoError(t, err)
+	origPath := os.Getenv("PATH")
+	newPath := fmt.Sprintf("%s:%s", filepath.Join(path, "testdata"), origPath)
+	t.Setenv("PATH", newPath)
+	err = os.Chmod(filepath.Join(path, "testdata", "docker-credential-helper-registry"), os.ModePerm)
+	require.NoError(t, err)
+
+	tmpHomeDir := t.TempDir()
+	authFilePath := filepath.Join(t.TempDir(), "auth.json")
+	err = os.WriteFile(authFilePath, []byte(`{"auths":{"quay.io":{"auth":"dXNlcm5hbWU6cGFzc3dvcmQ="}},`+
+		`"credHelpers":{"registry-b.com":"helper-registry"}}`), 0600)
+	require.NoError(t, err)
+	sys := &types.SystemContext{
+		AuthFilePath:                authFilePath,
+		SystemRegistriesConfPath:    filepath.Join("testdata", "cred-helper-with-auth-files.conf"),
+		SystemRegistriesConfDirPath: filepath.Join("testdata", "IdoNotExist"),
+	}
+
+	for _, c := range []struct {
+		name           string
+		sys            *types.SystemContext
+		key            string
+		expectedCreds  types.DockerAuthConfig
+		expectedOrigin string
+	}{
+		{
+			name:           "explicit",
+			sys:            &types.SystemContext{DockerAuthConfig: &types.DockerAuthConfig{Username: "u", Password: "secret-password-value"}},
+			key:            "quay.io",
+			expectedCreds:  types.DockerAuthConfig{Username: "u", Password: "secret-password-value"},
+			expectedOrigin: "explicit",
+		},
+		{
+			name:           "auth file",
+			sys:            sys,
+			key:            "quay.io/repo",
+			expectedCreds:  types.DockerAuthConfig{Username: "username", Password: "password"},
+			expectedOrigin: authFilePath,
+		},
+		{
+			name:           "credential helper in auth file",
+			sys:            sys,
+			key:            "registry-b.com",
+			expectedCreds:  types.DockerAuthConfig{IdentityToken: "fizzbuzz"},
+			expectedOrigin: "credential helper: helper-registry (configured in " + authFilePath + ")",
+		},
+		{
+			name:           "credential helper in registries.conf",
+			sys:            sys,
+			key:            "registry-a.com",
+			expectedCreds:  types.DockerAuthConfig{Username: "foo", Password: "bar"},
+			expectedOrigin: "credential helper: helper-registry",
+		},
+		{
+			name:           "not found",
+			sys:            sys,
+			key:            "example.org",
+			expectedCreds:  types.DockerAuthConfig{},
+			expectedOrigin: "",
+		},
+	} {
+		creds, origin, err := getCredentialsWithHomeDirAndOrigin(c.sys, c.key, tmpHomeDir)
+		require.NoError(t, err, c.name)
+		assert.Equal(t, c.expectedCreds, creds, c.name)
+		assert.Equal(t, c.expectedOrigin, origin, c.name)
+		if c.expectedCreds.Password != "" {
+			assert.NotContains(t, origin, c.expectedCreds.Password, c.name)
+		}
+	}
+}
+
+func TestGetCredentialsHelperFallback(t *testing.T) {
+	// override PATH for executing credHelper
+	path, err := os.Getwd()
+	require.NoError(t, err)
+	origPath := os.Getenv("PATH")
+	newPath := fmt.Sprintf("%s:%s", filepath.Join(path, "testdata"), origPath)
+	t.Setenv("PATH", newPath)
+	err = os.Chmod(filepath.Join(path, "testdata", "docker-credential-helper-registry"), os.ModePerm)
+	require.NoError(t, err)
+
+	tmpHomeDir := t.TempDir()
+	confDir := t.TempDir()
+	fallbackConf := filepath.Join(confDir, "fallback.conf")
+	err = os.WriteFile(fallbackConf, []byte(`credential-helpers = [ "helper-not-installed", "helper-registry" ]`), 0o600)
+	require.NoError(t, err)
+	failingConf := filepath.Join(confDir, "failing.conf")
+	err = os.WriteFile(failingConf, []byte(`credential-helpers = [ "helper-not-installed", "another-helper-not-installed" ]`), 0o600)
+	require.NoError(t, err)
+
+	sys := &types.SystemContext{
+		SystemRegistriesConfPath:    fallbackConf,
+		SystemRegistriesConfDirPath: filepath.Join("testdata", "IdoNotExist"),
+	}
+	// A failing helper followed by a helper with credentials
+	creds, origin, err := getCredentialsWithHomeDirAndOrigin(sys, "registry-a.com", tmpHomeDir)
+	require.NoError(t, err)
+	assert.Equal(t, types.DockerAuthConfig{Username: "foo", Password: "bar"}, creds)
+	assert.Equal(t, "credential helper: helper-registry", origin)
+	// A failing helper followed by a helper without credentials
+	creds, origin, err = getCredentialsWithHomeDirAndOrigin(sys, "registry-no-creds.com", tmpHomeDir)
+	require.NoError(t, err)
+	assert.Equal(t, types.DockerAuthConfig{}, creds)
+	assert.Equal(t, "", origin)
+
+	// All helpers fail
+	sys = &types.SystemContext{
+		SystemRegistriesConfPath:    failingConf,
+		SystemRegistriesConfDirPath: filepath.Join("testdata", "IdoNotExist"),
+	}
+	_, _, err = getCredentialsWithHomeDirAndOrigin(sys, "registry-a.com", tmpHomeDir)
+	assert.Error(t, err)
+}
+
+func TestGetCredentialsAuthFilePathOnly(t *testing.T) {
+	// override PATH for executing credHelper
+	path, err := os.Getwd()
+	require.NoError(t, err)
+	origPath := os.Getenv("PATH")
+	newPath := fmt.Sprintf("%s:%s", filepath.Join(path, "testdata"), origPath)
+	t.Setenv("PATH", newPath)
+	err = os.Chmod(filepath.Join(path, "testdata", "docker-credential-helper-registry"), os.ModePerm)
+	require.NoError(t, err)
+
+	// Credentials for example.org only exist in the fallback $HOME/.docker/config.json,
+	// credentials for registry-a.com only exist in a credential helper configured in registries.conf.
+	tmpHomeDir := t.TempDir()
+	t.Setenv("DOCKER_CONFIG", "")
+	os.Unsetenv("DOCKER_CONFIG")
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(tmpHomeDir, ".config"))
+	err = os.MkdirAll(filepath.Join(tmpHomeDir, ".docker"), 0700)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(tmpHomeDir, ".docker", "config.json"),
+		[]byte(`{"auths":{"example.org":{"auth":"dXNlcm5hbWU6cGFzc3dvcmQ="}}}`), 0600)
+	require.NoError(t, err)
+	authFilePath := filepath.Join(t.TempDir(), "auth.json")
+	err = os.WriteFile(authFilePath, []byte(`{"auths":{"quay.io":{"auth":"dXNlcm5hbWU6cGFzc3dvcmQ="}}}`), 0600)
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		key              string
+		expectedDefault  types.DockerAuthConfig
+		expectedRestrict types.DockerAuthConfig
+	}{
+		{
+			key:              "quay.io",
+			expectedDefault:  types.DockerAuthConfig{Username: "username", Password: "password"},
+			expectedRestrict: types.DockerAuthConfig{Username: "username", Password: "password"},
+		},
+		{
+			key:              "registry-a.com",
+			expectedDefault:  types.DockerAuthConfig{Username: "foo", Password: "bar"},
+			expectedRestrict: types.DockerAuthConfig{},
+		},
+	} {
+		sys := &types.SystemContext{
+			AuthFilePath:                authFilePath,
+			SystemRegistriesConfPath:    filepath.Join("testdata", "cred-helper-with-auth-files.conf"),
+			SystemRegistriesConfDirPath: filepath.Join("testdata", "IdoNotExist"),
+		}
+		creds, err := getCredentialsWithHomeDir(sys, c.key, tmpHomeDir)
+		require.NoError(t, err, c.key)
+		assert.Equal(t, c.expectedDefault, creds, c.key)
+
+		sys.AuthFilePathOnly = true
+		creds, err = getCredentialsWithHomeDir(sys, c.key, tmpHomeDir)
+		require.NoError(t, err, c.key)
+		assert.Equal(t, c.expectedRestrict, creds, c.key)
+	}
+
+	// The default auth file locations are never used with AuthFilePathOnly.
+	sys := &types.SystemContext{AuthFilePath: authFilePath, AuthFilePathOnly: true}
+	assert.Equal(t, []authPath{newAuthPathDefault(authFilePath)}, getAuthFilePaths(sys, tmpHomeDir))
+	creds, err := getCredentialsWithHomeDir(sys, "example.org", tmpHomeDir)
+	require.NoError(t, err)
+	assert.Equal(t, types.DockerAuthConfig{}, creds)
+
+	// AuthFilePathOnly without AuthFilePath is rejected.
+	_, err = getCredentialsWithHomeDir(&types.SystemContext{AuthFilePathOnly: true}, "example.org", tmpHomeDir)
+	assert.Error(t, err)
+	_, err = SetCredentials(&types.SystemContext{AuthFilePathOnly: true}, "example.org", "user", "pass")
+	assert.Error(t, err)
+}
+
+func TestGetCredentialsSystemdCredentials(t *testing.T) {
+	tmpHomeDir := t.TempDir()
+	authFilePath := filepath.Join(t.TempDir(), "auth.json")
+	err := os.WriteFile(authFilePath, []byte(`{"auths":{"quay.io":{"auth":"dXNlcm5hbWU6cGFzc3dvcmQ="},"example.org":{"auth":"dXNlcm5hbWU6cGFzc3dvcmQ="}}}`), 0600)
+	require.NoError(t, err)
+	credsDir := t.TempDir()
+	for name, contents := range map[string]string{
+		"registry-auth.quay.io":         `{"auth":"c2QtdXNlcjpzZC1wYXNz"}`,                     // sd-user:sd-pass
+		"registry-auth.localhost:5000":  `{"auth":"bG9jYWw6c2VjcmV0","identitytoken":"token"}`, // local:secret
+		"registry-auth.invalid.example": `not JSON`,
+		"unrelated-credential":          "something else",
+	} {
+		err := os.WriteFile(filepath.Join(credsDir, name), []byte(contents), 0600)
+		require.NoError(t, err)
+	}
+	fileCreds := types.DockerAuthConfig{Username: "username", Password: "password"}
+	systemdCreds := types.DockerAuthConfig{Username: "sd-user", Password: "sd-pass"}
+	newSys := func(useSystemdCredentials bool) *types.SystemContext {
+		return &types.SystemContext{AuthFilePath: authFilePath, AuthFilePathOnly: true, UseSystemdCredentials: useSystemdCredentials}
+	}
+
+	t.Setenv(systemdCredentialsDirectoryEnv, credsDir)
+	for _, c := range []struct {
+		sys            *types.SystemContext
+		key            string
+		expectedCreds  types.DockerAuthConfig
+		expectedOrigin string
+	}{
+		{newSys(false), "quay.io", fileCreds, authFilePath},
+		{newSys(true), "quay.io", systemdCreds, filepath.Join(credsDir, "registry-auth.quay.io")},
+		{newSys(true), "quay.io/ns/repo", systemdCreds, filepath.Join(credsDir, "registry-auth.quay.io")},
+		{newSys(true), "localhost:5000", types.DockerAuthConfig{Username: "local", Password: "secret", IdentityToken: "token"},
+			filepath.Join(credsDir, "registry-auth.localhost:5000")},
+		{newSys(true), "example.org", fileCreds, authFilePath}, // No systemd credential
+		{newSys(true), "unknown.example", types.DockerAuthConfig{}, ""},
+		{ // DockerAuthConfig takes precedence
+			&types.SystemContext{DockerAuthConfig: &types.DockerAuthConfig{Username: "u", Password: "p"}, UseSystemdCredentials: true},
+			"quay.io", types.DockerAuthConfig{Username: "u", Password: "p"}, credentialOriginExplicit,
+		},
+	} {
+		creds, origin, err := getCredentialsWithHomeDirAndOrigin(c.sys, c.key, tmpHomeDir)
+		require.NoError(t, err, c.key)
+		assert.Equal(t, c.expectedCreds, creds, c.key)
+		assert.Equal(t, c.expectedOrigin, origin, c.key)
+	}
+	_, err = getCredentialsWithHomeDir(newSys(true), "invalid.example", tmpHomeDir)
+	assert.Error(t, err)
+
+	allCreds, err := GetAllCredentials(newSys(true))
+	require.Error(t, err) // Because of registry-auth.invalid.example
+	assert.Nil(t, allCreds)
+	err = os.Remove(filepath.Join(credsDir, "registry-auth.invalid.example"))
+	require.NoError(t, err)
+	allCreds, err = GetAllCredentials(newSys(true))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]types.DockerAuthConfig{
+		"quay.io":        systemdCreds,
+		"localhost:5000": {Username: "local", Password: "secret", IdentityToken: "token"},
+		"example.org":    fileCreds,
+	}, allCreds)
+
+	// A missing or unset credentials directory is ignored.
+	for _, dir := range []string{filepath.Join(credsDir, "does-not-exist"), ""} {
+		t.Setenv(systemdCredentialsDirectoryEnv, dir)
+		creds, err := getCredentialsWithHomeDir(newSys(true), "quay.io", tmpHomeDir)
+		require.NoError(t, err, dir)
+		assert.Equal(t, fileCreds, creds, dir)
+		allCreds, err := GetAllCredentials(newSys(true))
+		require.NoError(t, err, dir)
+		assert.Equal(t, map[string]types.DockerAuthConfig{"quay.io": fileCreds, "example.org": fileCreds}, allCreds, dir)
+	}
+}
+
+func TestGetCredentialsFromExpiringCredHelper(t *testing.T) {
+	// override PATH for executing credHelper
+	path, err := os.Getwd()
+	require.NoError(t, err)
+	origPath := os.Getenv("PATH")
+	newPath := fmt.Sprintf("%s:%s", filepath.Join(path, "testdata"), origPath)
+	t.Setenv("PATH", newPath)
+	err = os.Chmod(filepath.Join(path, "testdata", "docker-credential-helper-registry"), os.ModePerm)
+	require.NoError(t, err)
+	counterPath := filepath.Join(t.TempDir(), "counter")
+	t.Setenv("HELPER_INVOCATION_COUNTER", counterPath)
+	invocations := func() string {
+		contents, err := os.ReadFile(counterPath)
+		require.NoError(t, err)
+		return strings.TrimSpace(string(contents))
+	}
+
+	origTimeNow := timeNow
+	defer func() { timeNow = origTimeNow }()
+	now := time.Date(2029, time.December, 31, 23, 0, 0, 0, time.UTC) // The helper returns ExpiresAt = 2030-01-01T00:00:00Z
+	timeNow = func() time.Time { return now }
+
+	sys := &types.SystemContext{
+		SystemRegistriesConfPath:    filepath.Join("testdata", "cred-helper.conf"),
+		SystemRegistriesConfDirPath: filepath.Join("testdata", "IdoNotExist"),
+	}
+	forgetCachedCredsFromCredHelper("helper-registry", "registry-expiring.com")
+	defer forgetCachedCredsFromCredHelper("helper-registry", "registry-expiring.com")
+
+	// The first lookup invokes the helper.
+	creds, err := GetCredentials(sys, "registry-expiring.com")
+	require.NoError(t, err)
+	assert.Equal(t, types.DockerAuthConfig{Username: "foo", Password: "token-1"}, creds)
+	assert.Equal(t, "1", invocations())
+
+	// Before expiry, cached credentials are used.
+	now = now.Add(30 * time.Minute)
+	creds, err = GetCredentials(sys, "registry-expiring.com")
+	require.NoError(t, err)
+	assert.Equal(t, types.DockerAuthConfig{Username: "foo", Password: "token-1"}, creds)
+	assert.Equal(t, "1", invocations())
+
+	// After expiry, the helper is invoked again.
+	now = now.Add(time.Hour)
+	creds, err = GetCredentials(sys, "registry-expiring.com")
+	require.NoError(t, err)
+	assert.Equal(t, types.DockerAuthConfig{Username: "foo", Password: "token-2"}, creds)
+	assert.Equal(t, "2", invocations())
+
+	// Credentials without an expiry are never cached.
+	for i := 0; i < 2; i++ {
+		creds, err = GetCredentials(sys, "registry-a.com")
+		require.NoError(t, err)
+		assert.Equal(t, types.DockerAuthConfig{Username: "foo", Password: "bar"}, creds)
+	}
+	credHelperCacheLock.Lock()
+	_, cached := credHelperCache[credHelperCacheKey{helper: "helper-registry", registry: "registry-a.com"}]
+	credHelperCacheLock.Unlock()
+	assert.False(t, cached)
+}
+
 func TestAuthKeysForKey(t *testing.T) {
 	for _, tc := range []struct {
 		name, input string
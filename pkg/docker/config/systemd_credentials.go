@@ -0,0 +1,69 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containers/image/v5/types"
+)
+
+const (
+	// systemdCredentialsDirectoryEnv is the environment variable systemd uses to point services at their credentials.
+	systemdCredentialsDirectoryEnv = "CREDENTIALS_DIRECTORY"
+	// systemdCredentialPrefix is the prefix of names of systemd credentials containing registry credentials; it is followed by the registry host.
+	systemdCredentialPrefix = "registry-auth."
+)
+
+// systemdCredentialsDir returns the systemd credentials directory to read registry credentials from, or "" if none should be used.
+func systemdCredentialsDir(sys *types.SystemContext) string {
+	if sys == nil || !sys.UseSystemdCredentials {
+		return ""
+	}
+	return os.Getenv(systemdCredentialsDirectoryEnv)
+}
+
+// getCredsFromSystemdCredentials returns the credentials for registry stored in dir, and the path of the file containing them.
+// It returns an empty struct if dir or the file does not exist.
+func getCredsFromSystemdCredentials(dir, registry string) (types.DockerAuthConfig, string, error) {
+	path := filepath.Join(dir, systemdCredentialPrefix+registry)
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return types.DockerAuthConfig{}, "", nil
+		}
+		return types.DockerAuthConfig{}, "", err
+	}
+	var conf dockerAuthConfig
+	if err := json.Unmarshal(contents, &conf); err != nil {
+		return types.DockerAuthConfig{}, "", fmt.Errorf("unmarshaling JSON at %q: %w", path, err)
+	}
+	creds, err := decodeDockerAuth(path, registry, conf)
+	if err != nil {
+		return types.DockerAuthConfig{}, "", err
+	}
+	return creds, path, nil
+}
+
+// systemdCredentialsRegistries returns the registries which have credentials stored in dir.
+// It returns nil if dir does not exist.
+func systemdCredentialsRegistries(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	res := []string{}
+	for _, e := range entries {
+		if registry, ok := strings.CutPrefix(e.Name(), systemdCredentialPrefix); ok && registry != "" {
+			res = append(res, registry)
+		}
+	}
+	return res, nil
+}
@@ -248,7 +248,7 @@ func Resolve(ctx *types.SystemContext, name string) (*Resolved, error) {
 
 	// Sanity check the short-name mode.
 	switch mode {
-	case types.ShortNameModeDisabled, types.ShortNameModePermissive, types.ShortNameModeEnforcing:
+	case types.ShortNameModeDisabled, types.ShortNameModePermissive, types.ShortNameModeEnforcing, types.ShortNameModeForbidden:
 		// We're good.
 	default:
 		return nil, fmt.Errorf("unsupported short-name mode (%v)", mode)
@@ -263,6 +263,11 @@ func Resolve(ctx *types.SystemContext, name string) (*Resolved, error) {
 		return resolved, nil
 	}
 
+	// Refuse short names altogether if forbidden, even if the caller would force Docker Hub.
+	if mode == types.ShortNameModeForbidden {
+		return nil, fmt.Errorf("short-name %q is not allowed: short-name resolution is forbidden, use a fully-qualified reference", name)
+	}
+
 	// Resolve to docker.io only if enforced by the caller (e.g., Podman's
 	// Docker-compatible REST API).
 	if ctx != nil && ctx.PodmanOnlyShortNamesIgnoreRegistriesConfAndForceDockerHub {
@@ -400,6 +405,9 @@ func Resolve(ctx *types.SystemContext, name string) (*Resolved, error) {
 // all candidates.  If neither tag nor digest is specified, candidates are
 // normalized with the "latest" tag. The returned slice contains at least one
 // item.
+//
+// If the short-name mode is types.ShortNameModeForbidden, short names are
+// rejected.
 func ResolveLocally(ctx *types.SystemContext, name string) ([]reference.Named, error) {
 	isShort, shortRef, err := parseUnnormalizedShortName(name)
 	if err != nil {
@@ -410,6 +418,15 @@ func ResolveLocally(ctx *types.SystemContext, name string) ([]reference.Named, e
 		return []reference.Named{named}, nil
 	}
 
+	// Refuse short names altogether if forbidden, even if the caller would force Docker Hub, consistently with Resolve.
+	mode, err := sysregistriesv2.GetShortNameMode(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if mode == types.ShortNameModeForbidden {
+		return nil, fmt.Errorf("short-name %q is not allowed: short-name resolution is forbidden, use a fully-qualified reference", name)
+	}
+
 	var candidates []reference.Named
 
 	// Complete the candidates with the specified registries.
@@ -432,6 +432,12 @@ func TestResolveWithVaryingShortNameModes(t *testing.T) {
 		{"testdata/no-reg.conf", types.ShortNameModeEnforcing, "doesnotexist", true, 0},
 		{"testdata/one-reg.conf", types.ShortNameModeEnforcing, "doesnotexist", false, 1},
 		{"testdata/two-reg.conf", types.ShortNameModeEnforcing, "doesnotexist", true, 0},
+		// Forbidden -> error for any short name, even with an alias
+		{"testdata/one-reg.conf", types.ShortNameModeForbidden, "repo/image", true, 0},
+		{"testdata/one-reg.conf", types.ShortNameModeForbidden, "doesnotexist", true, 0},
+		{"testdata/two-reg.conf", types.ShortNameModeForbidden, "nginx", true, 0},
+		// Forbidden + fully-qualified reference -> used as is
+		{"testdata/two-reg.conf", types.ShortNameModeForbidden, "docker.io/library/nginx", false, 1},
 	}
 
 	for _, test := range tests {
@@ -600,4 +606,20 @@ func TestResolveLocally(t *testing.T) {
 		require.Len(t, aliases, 1)
 		assert.Equal(t, test.expectedSysResolveToDockerHub, aliases[0].String())
 	}
+
+	// Short names are rejected if short-name resolution is forbidden; fully-qualified references are returned as is.
+	forbidden := types.ShortNameModeForbidden
+	for _, s := range []*types.SystemContext{sys, sysResolveToDockerHub} {
+		sysForbidden := *s
+		sysForbidden.ShortNameMode = &forbidden
+		for _, input := range []string{"repo/image", "foo", "foo:tag", "foo" + digest} {
+			_, err := ResolveLocally(&sysForbidden, input)
+			assert.Error(t, err, input)
+		}
+		for _, input := range []string{"localhost/foo", "registry.com/repo/image" + digest} {
+			aliases, err := ResolveLocally(&sysForbidden, input)
+			require.NoError(t, err, input)
+			require.Len(t, aliases, 1, input)
+		}
+	}
 }
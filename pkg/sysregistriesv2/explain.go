@@ -0,0 +1,92 @@
+package sysregistriesv2
+
+import (
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/types"
+)
+
+// ResolutionExplanation describes how the registries configuration applies to a reference,
+// for diagnostic purposes.
+// It is intended to be serialized as JSON; the set of fields may be extended in the future.
+type ResolutionExplanation struct {
+	// The input reference.
+	Reference string `json:"reference"`
+	// The prefix of the matching [[registry]] table, or "" if no table matches (and Reference is used unmodified).
+	MatchedPrefix string `json:"matchedPrefix,omitempty"`
+	// The configuration file which defined the matching [[registry]] table, if any.
+	Origin string `json:"origin,omitempty"`
+	// The location of the matching registry; "" if no table matches, or if the table does not set a location.
+	Location string `json:"location,omitempty"`
+	// Whether the matching registry is insecure.
+	Insecure bool `json:"insecure"`
+	// Whether the matching registry is blocked; if so, PullSources is empty.
+	Blocked bool `json:"blocked"`
+	// Whether the matching registry uses mirrors only for references with digests.
+	MirrorByDigestOnly bool `json:"mirrorByDigestOnly"`
+	// The sources Reference would be pulled from, in the order they are tried.
+	PullSources []PullSourceExplanation `json:"pullSources"`
+}
+
+// PullSourceExplanation describes a single source in ResolutionExplanation.PullSources.
+type PullSourceExplanation struct {
+	// The reference after rewriting it for this source.
+	Reference string `json:"reference"`
+	// The location of the endpoint.
+	Location string `json:"location,omitempty"`
+	// Whether the endpoint is insecure.
+	Insecure bool `json:"insecure"`
+	// Whether the endpoint is a mirror, as opposed to the primary location of the registry.
+	Mirror bool `json:"mirror"`
+	// The pull-from-mirror setting of the mirror, if any.
+	PullFromMirror string `json:"pullFromMirror,omitempty"`
+}
+
+// ExplainReference returns a description of how ref is resolved using the registries configuration,
+// i.e. which [[registry]] table matches it, and which sources it would be pulled from.
+// It uses the same logic as FindRegistry and Registry.PullSourcesFromReference, and is intended for diagnostics.
+func ExplainReference(sys *types.SystemContext, ref reference.Named) (ResolutionExplanation, error) {
+	config, err := getConfig(sys)
+	if err != nil {
+		return ResolutionExplanation{}, err
+	}
+	registry, err := findRegistryWithParsedConfig(config, ref.String())
+	if err != nil {
+		return ResolutionExplanation{}, err
+	}
+
+	res := ResolutionExplanation{
+		Reference:   ref.String(),
+		PullSources: []PullSourceExplanation{},
+	}
+	if registry == nil {
+		res.PullSources = append(res.PullSources, PullSourceExplanation{
+			Reference: ref.String(),
+			Location:  reference.Domain(ref),
+		})
+		return res, nil
+	}
+
+	res.MatchedPrefix = registry.Prefix
+	res.Origin = config.registryOrigins[registry.Prefix]
+	res.Location = registry.Location
+	res.Insecure = registry.Insecure
+	res.Blocked = registry.Blocked
+	res.MirrorByDigestOnly = registry.MirrorByDigestOnly
+	if registry.Blocked {
+		return res, nil
+	}
+	sources, err := registry.PullSourcesFromReference(ref)
+	if err != nil {
+		return ResolutionExplanation{}, err
+	}
+	for i, source := range sources {
+		res.PullSources = append(res.PullSources, PullSourceExplanation{
+			Reference:      source.Reference.String(),
+			Location:       source.Endpoint.Location,
+			Insecure:       source.Endpoint.Insecure,
+			Mirror:         i < len(sources)-1, // PullSourcesFromReference always returns the primary endpoint last.
+			PullFromMirror: source.Endpoint.PullFromMirror,
+		})
+	}
+	return res, nil
+}
@@ -0,0 +1,85 @@
+package sysregistriesv2
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplainReference(t *testing.T) {
+	sys := &types.SystemContext{
+		SystemRegistriesConfPath:    "testdata/pull-sources-from-reference.conf",
+		SystemRegistriesConfDirPath: "testdata/this-does-not-exist",
+	}
+	digest := "@sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+
+	// Mirrors with various settings
+	res, err := ExplainReference(sys, toNamedRef(t, "registry-a.com/foo/image:latest"))
+	require.NoError(t, err)
+	assert.Equal(t, ResolutionExplanation{
+		Reference:     "registry-a.com/foo/image:latest",
+		MatchedPrefix: "registry-a.com/foo",
+		Origin:        "testdata/pull-sources-from-reference.conf",
+		Location:      "registry-a.com/bar",
+		PullSources: []PullSourceExplanation{
+			{Reference: "mirror-1.registry-a.com/image:latest", Location: "mirror-1.registry-a.com", Mirror: true},
+			{Reference: "mirror-2.registry-a.com/image:latest", Location: "mirror-2.registry-a.com", Insecure: true, Mirror: true},
+			{Reference: "registry-a.com/bar/image:latest", Location: "registry-a.com/bar"},
+		},
+	}, res)
+
+	res, err = ExplainReference(sys, toNamedRef(t, "registry-b.com/foo/image:latest"))
+	require.NoError(t, err)
+	assert.True(t, res.MirrorByDigestOnly)
+	assert.Equal(t, []PullSourceExplanation{
+		{Reference: "registry-b.com/bar/image:latest", Location: "registry-b.com/bar"},
+	}, res.PullSources)
+
+	res, err = ExplainReference(sys, toNamedRef(t, "registry-b.com/baz/image"+digest))
+	require.NoError(t, err)
+	assert.Equal(t, []PullSourceExplanation{
+		{Reference: "mirror-1.registry-b.com/image" + digest, Location: "mirror-1.registry-b.com", Mirror: true, PullFromMirror: MirrorByDigestOnly},
+		{Reference: "mirror-2.registry-b.com/image" + digest, Location: "mirror-2.registry-b.com", Mirror: true, PullFromMirror: MirrorByDigestOnly},
+		{Reference: "registry-b.com/bar/image" + digest, Location: "registry-b.com/bar"},
+	}, res.PullSources)
+
+	// No matching registry
+	res, err = ExplainReference(sys, toNamedRef(t, "unconfigured.example.com/image:latest"))
+	require.NoError(t, err)
+	assert.Equal(t, ResolutionExplanation{
+		Reference: "unconfigured.example.com/image:latest",
+		PullSources: []PullSourceExplanation{
+			{Reference: "unconfigured.example.com/image:latest", Location: "unconfigured.example.com"},
+		},
+	}, res)
+
+	// The result can be serialized as JSON
+	res, err = ExplainReference(sys, toNamedRef(t, "registry-a.com/foo/image:latest"))
+	require.NoError(t, err)
+	resJSON, err := json.Marshal(res)
+	require.NoError(t, err)
+	var decoded ResolutionExplanation
+	err = json.Unmarshal(resJSON, &decoded)
+	require.NoError(t, err)
+	assert.Equal(t, res, decoded)
+
+	// Origins and blocking with drop-in files
+	sys = &types.SystemContext{
+		SystemRegistriesConfPath:    "testdata/base-for-registries.d.conf",
+		SystemRegistriesConfDirPath: "testdata/registries.conf.d",
+	}
+	res, err = ExplainReference(sys, toNamedRef(t, "base.com/image:latest"))
+	require.NoError(t, err)
+	assert.Equal(t, ResolutionExplanation{
+		Reference:     "base.com/image:latest",
+		MatchedPrefix: "base.com",
+		Origin:        filepath.Join("testdata/registries.conf.d", "config-2.conf"),
+		Location:      "base.com",
+		Blocked:       true,
+		PullSources:   []PullSourceExplanation{},
+	}, res)
+}
@@ -1,6 +1,7 @@
 package sysregistriesv2
 
 import (
+	"bytes"
 	"fmt"
 	"maps"
 	"os"
@@ -14,6 +15,7 @@ import (
 	"github.com/containers/image/v5/internal/rootless"
 	"github.com/containers/image/v5/types"
 	"github.com/containers/storage/pkg/homedir"
+	"github.com/containers/storage/pkg/ioutils"
 	"github.com/containers/storage/pkg/lockfile"
 	"github.com/sirupsen/logrus"
 )
@@ -92,12 +94,22 @@ type shortNameAliasCache struct {
 // experience such that users are able to resolve potential pull errors.
 // Almost all callers should use pkg/shortnames instead.
 //
+// This can be used to preview what a short name resolves to, without pulling
+// anything.  If no alias exists, the returned reference is nil and the origin is "";
+// if an alias is explicitly reset by an empty value in a config file, the returned
+// reference is nil but the origin describes that config file.
+// Consistent with pkg/shortnames, no aliases are used if
+// ctx.PodmanOnlyShortNamesIgnoreRegistriesConfAndForceDockerHub is set.
+//
 // Note that it’s the caller’s responsibility to pass only a repository
 // (reference.IsNameOnly) as the short name.
 func ResolveShortNameAlias(ctx *types.SystemContext, name string) (reference.Named, string, error) {
 	if err := validateShortName(name); err != nil {
 		return nil, "", err
 	}
+	if ctx != nil && ctx.PodmanOnlyShortNamesIgnoreRegistriesConfAndForceDockerHub {
+		return nil, "", nil
+	}
 	confPath, lock, err := shortNameAliasesConfPathAndLock(ctx)
 	if err != nil {
 		return nil, "", err
@@ -174,18 +186,21 @@ func editShortNameAlias(ctx *types.SystemContext, name string, value *string) er
 		delete(conf.Aliases, name)
 	}
 
-	f, err := os.OpenFile(confPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
-	if err != nil {
+	// Write the file atomically, so that a failure (or a reader not using the
+	// lock) never observes a truncated config.
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(conf); err != nil {
 		return err
 	}
-	defer f.Close()
-
-	encoder := toml.NewEncoder(f)
-	return encoder.Encode(conf)
+	return ioutils.AtomicWriteFile(confPath, buf.Bytes(), 0600)
 }
 
 // AddShortNameAlias adds the specified name-value pair as a new alias to the
-// user-specific aliases.conf.  It may override an existing alias for `name`.
+// user-specific aliases.conf, creating the file if necessary.  It may override
+// an existing alias for `name`.  `name` must be a short name, and `value` must
+// be a fully-qualified repository without a tag or digest.  The file is locked
+// while it is modified, so concurrent writers (in this or other processes) are
+// safe.
 //
 // Note that it’s the caller’s responsibility to pass only a repository
 // (reference.IsNameOnly) as the short name.
@@ -1,7 +1,11 @@
 package sysregistriesv2
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/containers/image/v5/types"
@@ -158,6 +162,18 @@ func TestResolveShortNameAlias(t *testing.T) {
 	require.NoError(t, err)
 	assert.Nil(t, value)
 	assert.Equal(t, "testdata/aliases.conf", path)
+
+	// Aliases are ignored if the caller forces Docker Hub.
+	forceDockerHub := *sys
+	forceDockerHub.PodmanOnlyShortNamesIgnoreRegistriesConfAndForceDockerHub = true
+	value, path, err = ResolveShortNameAlias(&forceDockerHub, "docker")
+	require.NoError(t, err)
+	assert.Nil(t, value)
+	assert.Equal(t, "", path)
+
+	// Invalid short names are rejected.
+	_, _, err = ResolveShortNameAlias(sys, "example.com/foo")
+	assert.Error(t, err)
 }
 
 func TestAliasesWithDropInConfigs(t *testing.T) {
@@ -296,3 +312,53 @@ func TestInvalidAliases(t *testing.T) {
 	assert.Error(t, AddShortNameAlias(sys, "added3", " "))
 	assert.Error(t, AddShortNameAlias(sys, "added3", "$$$"))
 }
+
+func TestAddShortNameAlias(t *testing.T) {
+	confPath := filepath.Join(t.TempDir(), "does-not-exist-yet", "aliases.conf")
+	sys := &types.SystemContext{
+		SystemRegistriesConfPath:    "testdata/aliases.conf",
+		SystemRegistriesConfDirPath: "testdata/this-does-not-exist",
+		UserShortNameAliasConfPath:  confPath,
+	}
+
+	// Invalid names and values are rejected.
+	for _, c := range []struct{ name, value string }{
+		{"example.com/foo", "example.com/foo"},                       // name is not a short name
+		{"foo:tag", "example.com/foo"},                               // name contains a tag
+		{"foo", "foo"},                                               // value is not fully qualified
+		{"foo", "example.com/foo:tag"},                               // value contains a tag
+		{"foo", "example.com/foo@sha256:" + strings.Repeat("a", 64)}, // value contains a digest
+	} {
+		err := AddShortNameAlias(sys, c.name, c.value)
+		assert.Error(t, err, "%#v", c)
+	}
+
+	// Concurrent writers don’t lose updates.
+	const numAliases = 10
+	var wg sync.WaitGroup
+	errs := make([]error, numAliases)
+	for i := 0; i < numAliases; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = AddShortNameAlias(sys, fmt.Sprintf("concurrent%d", i), fmt.Sprintf("example.com/concurrent%d", i))
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < numAliases; i++ {
+		require.NoError(t, errs[i])
+		value, path, err := ResolveShortNameAlias(sys, fmt.Sprintf("concurrent%d", i))
+		require.NoError(t, err)
+		require.NotNil(t, value)
+		assert.Equal(t, fmt.Sprintf("example.com/concurrent%d", i), value.String())
+		assert.Equal(t, confPath, path)
+	}
+
+	// The user-specific file has precedence over registries.conf.
+	require.NoError(t, AddShortNameAlias(sys, "docker", "quay.io/podman/docker"))
+	value, path, err := ResolveShortNameAlias(sys, "docker")
+	require.NoError(t, err)
+	require.NotNil(t, value)
+	assert.Equal(t, "quay.io/podman/docker", value.String())
+	assert.Equal(t, confPath, path)
+}
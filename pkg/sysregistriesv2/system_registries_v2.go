@@ -4,9 +4,13 @@ import (
 	"errors"
 	"fmt"
 	"io/fs"
+	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"reflect"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
@@ -17,6 +21,7 @@ import (
 	"github.com/containers/storage/pkg/fileutils"
 	"github.com/containers/storage/pkg/homedir"
 	"github.com/containers/storage/pkg/regexp"
+	"github.com/opencontainers/go-digest"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/exp/maps"
 )
@@ -50,8 +55,10 @@ const (
 
 // Endpoint describes a remote location of a registry.
 type Endpoint struct {
-	// The endpoint's remote location. Can be empty iff Prefix contains
-	// wildcard in the format: "*.example.com" for subdomain matching.
+	// The endpoint's remote location. Can be empty for a registry (not a mirror)
+	// with an explicitly set Prefix; references matching such a registry,
+	// including ones using a wildcard prefix in the format "*.example.com",
+	// are used as-is, without rewriting.
 	// Please refer to FindRegistry / PullSourcesFromReference instead
 	// of accessing/interpreting `Location` directly.
 	Location string `toml:"location,omitempty"`
@@ -70,6 +77,124 @@ type Endpoint struct {
 	// This can only be set in a registry's Mirror field, not in the registry's primary Endpoint.
 	// This per-mirror setting is allowed only when mirror-by-digest-only is not configured for the primary registry.
 	PullFromMirror string `toml:"pull-from-mirror,omitempty"`
+	// Headers are additional HTTP headers to send with every request to this endpoint,
+	// e.g. for routing by an API gateway. Headers used for authentication or
+	// for the HTTP protocol itself (see restrictedEndpointHeaders) can not be set.
+	Headers map[string]string `toml:"headers,omitempty"`
+	// AuthKey, if not empty, is the key used to look up credentials for pulling from this mirror,
+	// in auth files and credential helpers (a host[:port], optionally followed by a namespace or a repository,
+	// as used in containers-auth.json(5)), instead of the mirror’s rewritten reference.
+	// The host[:port] of the key must be the host[:port] of Location, so that credentials
+	// stored for one registry are never sent to another one.
+	// This can only be set in a registry's Mirror field, not in the registry's primary Endpoint.
+	AuthKey string `toml:"auth-key,omitempty"`
+	// PathPrefix, if not empty, is an URL path prepended to the paths of the registry API (e.g. "/registry" to use "/registry/v2/…"),
+	// for registries which are not served at the root of their host.
+	PathPrefix string `toml:"path-prefix,omitempty"`
+	// Proxy, if not empty, is the URL of an HTTP(S) or SOCKS5 proxy used for all connections to this endpoint,
+	// instead of the proxy configured in the environment (HTTP_PROXY, HTTPS_PROXY and NO_PROXY).
+	// The special value "none" connects to the endpoint directly, ignoring the environment.
+	Proxy string `toml:"proxy,omitempty"`
+}
+
+// proxyNone is the Endpoint.Proxy value which requests direct connections.
+const proxyNone = "none"
+
+// restrictedEndpointHeaders are the (canonicalized) names of HTTP headers which can not be set using Endpoint.Headers.
+var restrictedEndpointHeaders = []string{
+	"Authorization",
+	"Connection",
+	"Content-Length",
+	"Cookie",
+	"Host",
+	"Proxy-Authorization",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// validateHeaders returns an error if e.Headers contains an invalid or restricted header.
+func (e *Endpoint) validateHeaders() error {
+	for name := range e.Headers {
+		if name == "" || strings.ContainsAny(name, " \t\r\n:") {
+			return &InvalidRegistries{s: fmt.Sprintf("invalid header name %q for %q", name, e.Location)}
+		}
+		if slices.Contains(restrictedEndpointHeaders, http.CanonicalHeaderKey(name)) {
+			return &InvalidRegistries{s: fmt.Sprintf("header %q for %q can not be set in the registries configuration", name, e.Location)}
+		}
+	}
+	return nil
+}
+
+// validateAuthKey returns an error if e.AuthKey is set but not usable as a credential lookup key.
+func (e *Endpoint) validateAuthKey() error {
+	if e.AuthKey == "" {
+		return nil
+	}
+	if strings.HasPrefix(e.AuthKey, "http://") || strings.HasPrefix(e.AuthKey, "https://") {
+		return &InvalidRegistries{s: fmt.Sprintf("invalid auth-key %q for mirror %q: URI schemes are not supported", e.AuthKey, e.Location)}
+	}
+	if strings.ContainsAny(e.AuthKey, "@ \t\r\n") || strings.HasPrefix(e.AuthKey, "/") || strings.HasSuffix(e.AuthKey, "/") {
+		return &InvalidRegistries{s: fmt.Sprintf("invalid auth-key %q for mirror %q", e.AuthKey, e.Location)}
+	}
+	// Reject host/repo:tag, but allow localhost:5000 and localhost:5000/foo, like containers-auth.json(5) keys.
+	if firstSlash := strings.IndexRune(e.AuthKey, '/'); firstSlash != -1 && strings.ContainsRune(e.AuthKey[firstSlash+1:], ':') {
+		return &InvalidRegistries{s: fmt.Sprintf("invalid auth-key %q for mirror %q: a tag is not allowed", e.AuthKey, e.Location)}
+	}
+	if authKeyHost(e.AuthKey) != authKeyHost(e.Location) {
+		return &InvalidRegistries{s: fmt.Sprintf("invalid auth-key %q for mirror %q: the key must be for the mirror’s host", e.AuthKey, e.Location)}
+	}
+	return nil
+}
+
+// authKeyHost returns the host[:port] part of key, a credential lookup key or an Endpoint.Location.
+func authKeyHost(key string) string {
+	host, _, _ := strings.Cut(key, "/")
+	return host
+}
+
+// AuthKeyMatchesHost returns true if e.AuthKey is a credential lookup key for host, a host[:port] value.
+func (e *Endpoint) AuthKeyMatchesHost(host string) bool {
+	return authKeyHost(e.AuthKey) == host
+}
+
+// validatePathPrefix returns an error if e.PathPrefix is set but not a valid URL path prefix.
+func (e *Endpoint) validatePathPrefix() error {
+	if e.PathPrefix == "" {
+		return nil
+	}
+	if !strings.HasPrefix(e.PathPrefix, "/") || strings.HasSuffix(e.PathPrefix, "/") || path.Clean(e.PathPrefix) != e.PathPrefix ||
+		strings.ContainsAny(e.PathPrefix, "?#%@ \t\r\n") {
+		return &InvalidRegistries{s: fmt.Sprintf("invalid path-prefix %q for %q: must be an absolute, clean, URL path, without a trailing slash", e.PathPrefix, e.Location)}
+	}
+	return nil
+}
+
+// ProxyFunc returns a function suitable for http.Transport.Proxy, implementing e.Proxy; or nil if e.Proxy is not set,
+// and the proxy configured in the environment should be used.
+func (e *Endpoint) ProxyFunc() (func(*http.Request) (*url.URL, error), error) {
+	switch e.Proxy {
+	case "":
+		return nil, nil
+	case proxyNone:
+		return func(*http.Request) (*url.URL, error) { return nil, nil }, nil
+	}
+	u, err := url.Parse(e.Proxy)
+	if err != nil {
+		// Don’t include err, or e.Proxy, in the error message: they might contain credentials.
+		return nil, &InvalidRegistries{s: fmt.Sprintf("invalid proxy URL for %q", e.Location)}
+	}
+	if (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") || u.Host == "" ||
+		(u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+		return nil, &InvalidRegistries{s: fmt.Sprintf("invalid proxy %q for %q: must be an http://, https:// or socks5:// URL of a proxy server, or %q",
+			u.Redacted(), e.Location, proxyNone)}
+	}
+	return http.ProxyURL(u), nil
+}
+
+// validateProxy returns an error if e.Proxy is set but not valid.
+func (e *Endpoint) validateProxy() error {
+	_, err := e.ProxyFunc()
+	return err
 }
 
 // userRegistriesFile is the path to the per user registry configuration file.
@@ -92,14 +217,7 @@ func (e *Endpoint) rewriteReference(ref reference.Named, prefix string) (referen
 	}
 	// In the case of an empty `location` field, simply return the original
 	// input ref as-is.
-	//
-	// FIXME: already validated in postProcessRegistries, so check can probably
-	// be dropped.
-	// https://github.com/containers/image/pull/1191#discussion_r610621608
 	if e.Location == "" {
-		if !strings.HasPrefix(prefix, "*.") {
-			return nil, fmt.Errorf("invalid prefix '%v' for empty location, should be in the format: *.example.com", prefix)
-		}
 		return ref, nil
 	}
 	newNamedRef = e.Location + refString[prefixLen:]
@@ -246,7 +364,8 @@ type V2RegistriesConf struct {
 	// Valid modes are: * "prompt": prompt if stdout is a TTY, otherwise
 	// use all unqualified-search registries * "enforcing": always prompt
 	// and error if stdout is not a TTY * "disabled": do not prompt and
-	// potentially use all unqualified-search registries
+	// potentially use all unqualified-search registries * "forbidden": refuse
+	// to resolve short names at all
 	ShortNameMode string `toml:"short-name-mode"`
 
 	// AdditionalLayerStoreAuthHelper is a helper binary that receives
@@ -297,6 +416,9 @@ type parsedConfig struct {
 	partialV2 V2RegistriesConf
 	// Absolute path to the configuration file that set the UnqualifiedSearchRegistries.
 	unqualifiedSearchRegistriesOrigin string
+	// Path to the configuration file that defined each of partialV2.Registries, indexed by prefix.
+	// May be nil if there are no registries.
+	registryOrigins map[string]string
 	// Result of parsing of partialV2.ShortNameMode.
 	// NOTE: May be ShortNameModeInvalid to represent ShortNameMode == "" in intermediate values;
 	// the full configuration in configCache / getConfig() always contains a valid value.
@@ -418,17 +540,27 @@ func (config *V2RegistriesConf) postProcessRegistries() error {
 			if err != nil {
 				return err
 			}
-			// FIXME: allow config authors to always use Prefix.
-			// https://github.com/containers/image/pull/1191#discussion_r610622495
-			if !strings.HasPrefix(reg.Prefix, "*.") && reg.Location == "" {
-				return &InvalidRegistries{s: "invalid condition: location is unset and prefix is not in the format: *.example.com"}
-			}
+			// If Location is unset, references matching Prefix are used as-is, without rewriting;
+			// this allows setting up mirrors, or blocking, without renaming anything.
+		}
+
+		if err := reg.validateHeaders(); err != nil {
+			return err
+		}
+		if err := reg.validatePathPrefix(); err != nil {
+			return err
+		}
+		if err := reg.validateProxy(); err != nil {
+			return err
 		}
 
 		// validate the mirror usage settings does not apply to primary registry
 		if reg.PullFromMirror != "" {
 			return fmt.Errorf("pull-from-mirror must not be set for a non-mirror registry %q", reg.Prefix)
 		}
+		if reg.AuthKey != "" {
+			return &InvalidRegistries{s: fmt.Sprintf("auth-key must not be set for a non-mirror registry %q", reg.Prefix)}
+		}
 		// make sure mirrors are valid
 		for _, mir := range reg.Mirrors {
 			mir.Location, err = parseLocation(mir.Location)
@@ -442,6 +574,18 @@ func (config *V2RegistriesConf) postProcessRegistries() error {
 			if mir.Location == "" {
 				return &InvalidRegistries{s: "invalid condition: mirror location is unset"}
 			}
+			if err := mir.validateHeaders(); err != nil {
+				return err
+			}
+			if err := mir.validateAuthKey(); err != nil {
+				return err
+			}
+			if err := mir.validatePathPrefix(); err != nil {
+				return err
+			}
+			if err := mir.validateProxy(); err != nil {
+				return err
+			}
 
 			if reg.MirrorByDigestOnly && mir.PullFromMirror != "" {
 				return &InvalidRegistries{s: fmt.Sprintf("cannot set mirror usage mirror-by-digest-only for the registry (%q) and pull-from-mirror for per-mirror (%q) at the same time", reg.Prefix, mir.Location)}
@@ -475,14 +619,18 @@ func (config *V2RegistriesConf) postProcessRegistries() error {
 		if !ok {
 			return fmt.Errorf("Internal error in V2RegistriesConf.PostProcess: entry in regMap is missing")
 		}
+		name := reg.Location
+		if name == "" {
+			name = reg.Prefix
+		}
 		for _, other := range others {
 			if reg.Insecure != other.Insecure {
-				msg := fmt.Sprintf("registry '%s' is defined multiple times with conflicting 'insecure' setting", reg.Location)
+				msg := fmt.Sprintf("registry '%s' is defined multiple times with conflicting 'insecure' setting", name)
 				return &InvalidRegistries{s: msg}
 			}
 
 			if reg.Blocked != other.Blocked {
-				msg := fmt.Sprintf("registry '%s' is defined multiple times with conflicting 'blocked' setting", reg.Location)
+				msg := fmt.Sprintf("registry '%s' is defined multiple times with conflicting 'blocked' setting", name)
 				return &InvalidRegistries{s: msg}
 			}
 		}
@@ -529,6 +677,8 @@ func (config *V2RegistriesConf) postProcessRegistries() error {
 // ConfigPath returns the path to the system-wide registry configuration file.
 // Deprecated: This API implies configuration is read from files, and that there is only one.
 // Please use ConfigurationSourceDescription to obtain a string usable for error messages.
+//
+// If SystemContext.SystemRegistriesConfBytes is set, the configuration is not read from a file, and this returns "".
 func ConfigPath(ctx *types.SystemContext) string {
 	return newConfigWrapper(ctx).configPath
 }
@@ -545,11 +695,16 @@ func ConfigDirPath(ctx *types.SystemContext) string {
 	return configWrapper.configDirPath
 }
 
+// inMemoryConfigDescription is used in messages instead of a path to the registries.conf file when SystemContext.SystemRegistriesConfBytes is set.
+const inMemoryConfigDescription = "(in-memory registries.conf)"
+
 // configWrapper is used to store the paths from ConfigPath and ConfigDirPath
 // and acts as a key to the internal cache.
 type configWrapper struct {
-	// path to the registries.conf file
+	// path to the registries.conf file, or "" if SystemContext.SystemRegistriesConfBytes is used
 	configPath string
+	// digest of SystemContext.SystemRegistriesConfBytes, or "" if the registries.conf file is read from configPath
+	configContentsDigest digest.Digest
 	// path to system-wide registries.conf.d directory, or "" if not used
 	configDirPath string
 	// path to user specified registries.conf.d directory, or "" if not used
@@ -569,7 +724,10 @@ func newConfigWrapperWithHomeDir(ctx *types.SystemContext, homeDir string) confi
 	userRegistriesDirPath := filepath.Join(homeDir, userRegistriesDir)
 
 	// decide configPath using per-user path or system file
-	if ctx != nil && ctx.SystemRegistriesConfPath != "" {
+	if ctx != nil && ctx.SystemRegistriesConfBytes != nil {
+		// The cache key must differ for different in-memory contents.
+		wrapper.configContentsDigest = digest.FromBytes(ctx.SystemRegistriesConfBytes)
+	} else if ctx != nil && ctx.SystemRegistriesConfPath != "" {
 		wrapper.configPath = ctx.SystemRegistriesConfPath
 	} else if err := fileutils.Exists(userRegistriesFilePath); err == nil {
 		// per-user registries.conf exists, not reading system dir
@@ -603,10 +761,18 @@ func newConfigWrapperWithHomeDir(ctx *types.SystemContext, homeDir string) confi
 	return wrapper
 }
 
+// configSourceDescription returns a description of the source of the registries.conf data, for use in messages.
+func (wrapper configWrapper) configSourceDescription() string {
+	if wrapper.configContentsDigest != "" {
+		return inMemoryConfigDescription
+	}
+	return wrapper.configPath
+}
+
 // ConfigurationSourceDescription returns a string containers paths of registries.conf and registries.conf.d
 func ConfigurationSourceDescription(ctx *types.SystemContext) string {
 	wrapper := newConfigWrapper(ctx)
-	configSources := []string{wrapper.configPath}
+	configSources := []string{wrapper.configSourceDescription()}
 	if wrapper.configDirPath != "" {
 		configSources = append(configSources, wrapper.configDirPath)
 	}
@@ -717,22 +883,31 @@ func tryUpdatingCache(ctx *types.SystemContext, wrapper configWrapper) (*parsedC
 	defer configMutex.Unlock()
 
 	// load the config
-	config, err := loadConfigFile(wrapper.configPath, false)
-	if err != nil {
-		// Continue with an empty []Registry if we use the default config, which
-		// implies that the config path of the SystemContext isn't set.
-		//
-		// Note: if ctx.SystemRegistriesConfPath points to the default config,
-		// we will still return an error.
-		if os.IsNotExist(err) && (ctx == nil || ctx.SystemRegistriesConfPath == "") {
-			config = &parsedConfig{}
-			config.partialV2 = V2RegistriesConf{Registries: []Registry{}}
-			config.aliasCache, err = newShortNameAliasCache("", &shortNameAliasConf{})
-			if err != nil {
-				return nil, err // Should never happen
+	var config *parsedConfig
+	var err error
+	if wrapper.configContentsDigest != "" {
+		config, err = loadConfigData(wrapper.configSourceDescription(), ctx.SystemRegistriesConfBytes, false)
+		if err != nil {
+			return nil, fmt.Errorf("loading registries configuration %s: %w", wrapper.configSourceDescription(), err)
+		}
+	} else {
+		config, err = loadConfigFile(wrapper.configPath, false)
+		if err != nil {
+			// Continue with an empty []Registry if we use the default config, which
+			// implies that the config path of the SystemContext isn't set.
+			//
+			// Note: if ctx.SystemRegistriesConfPath points to the default config,
+			// we will still return an error.
+			if os.IsNotExist(err) && (ctx == nil || ctx.SystemRegistriesConfPath == "") {
+				config = &parsedConfig{}
+				config.partialV2 = V2RegistriesConf{Registries: []Registry{}}
+				config.aliasCache, err = newShortNameAliasCache("", &shortNameAliasConf{})
+				if err != nil {
+					return nil, err // Should never happen
+				}
+			} else {
+				return nil, fmt.Errorf("loading registries configuration %q: %w", wrapper.configPath, err)
 			}
-		} else {
-			return nil, fmt.Errorf("loading registries configuration %q: %w", wrapper.configPath, err)
 		}
 	}
 
@@ -808,6 +983,8 @@ func parseShortNameMode(mode string) (types.ShortNameMode, error) {
 		return types.ShortNameModeDisabled, nil
 	case "enforcing":
 		return types.ShortNameModeEnforcing, nil
+	case "forbidden":
+		return types.ShortNameModeForbidden, nil
 	case "permissive":
 		return types.ShortNameModePermissive, nil
 	default:
@@ -922,6 +1099,32 @@ func FindRegistry(ctx *types.SystemContext, ref string) (*Registry, error) {
 	return findRegistryWithParsedConfig(config, ref)
 }
 
+// RewriteReference returns the reference ref would be pulled from first, after applying
+// the prefix and location rewriting (including mirrors) configured in registries.conf.
+// This is the Reference of the first PullSource returned by Registry.PullSourcesFromReference.
+// If no Registry prefixes ref, ref is returned unchanged.
+// An error is returned if the matching registry is blocked.
+func RewriteReference(ctx *types.SystemContext, ref reference.Named) (reference.Named, error) {
+	registry, err := FindRegistry(ctx, ref.String())
+	if err != nil {
+		return nil, err
+	}
+	if registry == nil {
+		return ref, nil
+	}
+	if registry.Blocked {
+		return nil, fmt.Errorf("registry %s is blocked in %s", registry.Prefix, ConfigurationSourceDescription(ctx))
+	}
+	sources, err := registry.PullSourcesFromReference(ref)
+	if err != nil {
+		return nil, err
+	}
+	if len(sources) == 0 { // Should never happen, the primary endpoint is always included.
+		return nil, fmt.Errorf("internal error: no pull sources for %s", ref.String())
+	}
+	return sources[0].Reference, nil
+}
+
 // findRegistryWithParsedConfig implements `FindRegistry` with a pre-loaded
 // parseConfig.
 func findRegistryWithParsedConfig(config *parsedConfig, ref string) (*Registry, error) {
@@ -946,16 +1149,25 @@ func findRegistryWithParsedConfig(config *parsedConfig, ref string) (*Registry,
 // Use forceV2 if the config must in the v2 format.
 func loadConfigFile(path string, forceV2 bool) (*parsedConfig, error) {
 	logrus.Debugf("Loading registries configuration %q", path)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return loadConfigData(path, data, forceV2)
+}
 
+// loadConfigData unmarshals a single config file with the specified contents; path is only used to describe the origin of the data.
+// Use forceV2 if the config must in the v2 format.
+func loadConfigData(path string, data []byte, forceV2 bool) (*parsedConfig, error) {
 	// tomlConfig allows us to unmarshal either V1 or V2 simultaneously.
 	type tomlConfig struct {
 		V2RegistriesConf
 		V1RegistriesConf // for backwards compatibility with sysregistries v1
 	}
 
-	// Load the tomlConfig. Note that `DecodeFile` will overwrite set fields.
+	// Load the tomlConfig. Note that `Decode` will overwrite set fields.
 	var combinedTOML tomlConfig
-	meta, err := toml.DecodeFile(path, &combinedTOML)
+	meta, err := toml.Decode(string(data), &combinedTOML)
 	if err != nil {
 		return nil, err
 	}
@@ -989,6 +1201,10 @@ func loadConfigFile(path string, forceV2 bool) (*parsedConfig, error) {
 	}
 
 	res.unqualifiedSearchRegistriesOrigin = path
+	res.registryOrigins = make(map[string]string, len(res.partialV2.Registries))
+	for i := range res.partialV2.Registries {
+		res.registryOrigins[res.partialV2.Registries[i].Prefix] = path
+	}
 
 	if len(res.partialV2.ShortNameMode) > 0 {
 		mode, err := parseShortNameMode(res.partialV2.ShortNameMode)
@@ -1038,6 +1254,12 @@ func (c *parsedConfig) updateWithConfigurationFrom(updates *parsedConfig) {
 	for i := range updates.partialV2.Registries {
 		registryMap[updates.partialV2.Registries[i].Prefix] = updates.partialV2.Registries[i]
 	}
+	if len(updates.registryOrigins) != 0 && c.registryOrigins == nil {
+		c.registryOrigins = make(map[string]string, len(updates.registryOrigins))
+	}
+	for prefix, origin := range updates.registryOrigins {
+		c.registryOrigins[prefix] = origin
+	}
 
 	// Go maps have a non-deterministic order when iterating the keys, so
 	// we dump them in a slice and sort it to enforce some order in
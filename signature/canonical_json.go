@@ -0,0 +1,102 @@
+package signature
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/cyberphone/json-canonicalization/go/src/webpki.org/jsoncanonicalizer"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// canonicalJSONMatchesDigest returns true iff the canonical JSON form of manifestBlob (see canonicalJSON) matches expectedDigest.
+func canonicalJSONMatchesDigest(manifestBlob []byte, expectedDigest digest.Digest) (bool, error) {
+	if err := expectedDigest.Validate(); err != nil {
+		return false, err
+	}
+	canonical, err := canonicalJSON(manifestBlob)
+	if err != nil {
+		return false, fmt.Errorf("canonicalizing manifest: %w", err)
+	}
+	return expectedDigest.Algorithm().FromBytes(canonical) == expectedDigest, nil
+}
+
+// canonicalJSON returns the JSON Canonicalization Scheme (RFC 8785) form of input.
+//
+// Because a signature of the canonical form is then accepted for input, input must not be ambiguous:
+// objects with keys which are equal or only differ in case are rejected, because JSON parsers differ
+// in which of the values they use (and encoding/json matches struct fields case-insensitively),
+// so reordering the keys could change the meaning of the document.
+func canonicalJSON(input []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(input))
+	dec.UseNumber()
+	if _, err := decodeUnambiguousJSON(dec); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		if err == nil {
+			err = errors.New("unexpected data after the top-level value")
+		}
+		return nil, err
+	}
+	return jsoncanonicalizer.Transform(input)
+}
+
+// decodeUnambiguousJSON decodes a single JSON value from dec, rejecting duplicate object keys (see canonicalJSON).
+// Numbers are returned as json.Number.
+func decodeUnambiguousJSON(dec *json.Decoder) (any, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	delim, ok := token.(json.Delim)
+	if !ok {
+		return token, nil // string, json.Number, bool, or nil
+	}
+	switch delim {
+	case '{':
+		res := map[string]any{}
+		for dec.More() {
+			keyToken, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key, ok := keyToken.(string)
+			if !ok { // Coverage: encoding/json should never return a non-string key.
+				return nil, fmt.Errorf("unexpected object key %#v", keyToken)
+			}
+			for existing := range res {
+				if strings.EqualFold(existing, key) {
+					return nil, fmt.Errorf("ambiguous JSON object, contains both %q and %q", existing, key)
+				}
+			}
+			value, err := decodeUnambiguousJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			res[key] = value
+		}
+		if _, err := dec.Token(); err != nil { // '}'
+			return nil, err
+		}
+		return res, nil
+	case '[':
+		res := []any{}
+		for dec.More() {
+			value, err := decodeUnambiguousJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, value)
+		}
+		if _, err := dec.Token(); err != nil { // ']'
+			return nil, err
+		}
+		return res, nil
+	default: // Coverage: encoding/json should never return a closing delimiter here.
+		return nil, fmt.Errorf("unexpected JSON delimiter %q", delim)
+	}
+}
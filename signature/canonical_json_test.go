@@ -0,0 +1,86 @@
+package signature
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonicalJSON(t *testing.T) {
+	for _, c := range []struct{ input, expected string }{
+		{`{}`, `{}`},
+		{" {\n\t\"b\": [1, 2.50, 1e3],\n \"a\": {\"y\": null, \"x\": true}\n}\n", `{"a":{"x":true,"y":null},"b":[1,2.5,1000]}`},
+		{`{"z": "<&>", "a": "\u00e9"}`, `{"a":"é","z":"<&>"}`},
+		{`[{"b": 1, "a": 2}, "s"]`, `[{"a":2,"b":1},"s"]`},
+		{`[12345678901234567890]`, `[12345678901234567000]`},
+	} {
+		res, err := canonicalJSON([]byte(c.input))
+		require.NoError(t, err, c.input)
+		assert.Equal(t, c.expected, string(res), c.input)
+	}
+
+	for _, input := range []string{
+		``,
+		`{`,
+		`{"a": 1,}`,
+		`{"a": 1} {}`,
+		`{"a": 1} x`,
+		`1`, // Only objects and arrays are supported at the top level
+		`{"a": 1, "a": 2}`,
+		`{"a": 1, "A": 2}`,
+		`[{"mediaType": "a", "MediaType": "b"}]`,
+	} {
+		_, err := canonicalJSON([]byte(input))
+		assert.Error(t, err, input)
+	}
+}
+
+func TestCanonicalJSONFixtures(t *testing.T) {
+	// The fixtures are the test vectors of the RFC 8785 reference implementation,
+	// from https://github.com/cyberphone/json-canonicalization/tree/master/testdata .
+	inputs, err := filepath.Glob("fixtures/jcs/input/*.json")
+	require.NoError(t, err)
+	require.NotEmpty(t, inputs)
+	for _, inputPath := range inputs {
+		input, err := os.ReadFile(inputPath)
+		require.NoError(t, err)
+		expected, err := os.ReadFile(filepath.Join("fixtures/jcs/output", filepath.Base(inputPath)))
+		require.NoError(t, err)
+		res, err := canonicalJSON(input)
+		if filepath.Base(inputPath) == "structures.json" {
+			// Contains keys which only differ in case, which we reject.
+			assert.ErrorContains(t, err, "ambiguous JSON object", inputPath)
+			continue
+		}
+		require.NoError(t, err, inputPath)
+		assert.Equal(t, string(expected), string(res), inputPath)
+	}
+}
+
+func TestCanonicalJSONMatchesDigest(t *testing.T) {
+	input := []byte("{\"b\": 1,\n\"a\": 2}")
+	canonical := []byte(`{"a":2,"b":1}`)
+
+	for _, c := range []struct {
+		digest   digest.Digest
+		expected bool
+	}{
+		{digest.FromBytes(canonical), true},
+		{digest.SHA512.FromBytes(canonical), true},
+		{digest.FromBytes(input), false},
+		{digest.FromString("other"), false},
+	} {
+		res, err := canonicalJSONMatchesDigest(input, c.digest)
+		require.NoError(t, err, c.digest)
+		assert.Equal(t, c.expected, res, c.digest)
+	}
+
+	_, err := canonicalJSONMatchesDigest(input, "invalid digest")
+	assert.Error(t, err)
+	_, err = canonicalJSONMatchesDigest([]byte(`{"a": 1, "a": 2}`), digest.FromBytes(canonical))
+	assert.Error(t, err)
+}
@@ -5,6 +5,7 @@ package signature
 import (
 	"errors"
 	"fmt"
+	"io"
 	"slices"
 	"strings"
 
@@ -20,9 +21,25 @@ type SignOptions struct {
 	Passphrase string
 }
 
-// SignDockerManifest returns a signature for manifest as the specified dockerReference,
+// SignDockerManifestWithOptions returns a signature for manifest as the specified dockerReference,
 // using mech and keyIdentity, and the specified options.
+// If mech does not support signing (e.g. with the containers_image_openpgp build tag), this fails with a SigningNotSupportedError.
 func SignDockerManifestWithOptions(m []byte, dockerReference string, mech SigningMechanism, keyIdentity string, options *SignOptions) ([]byte, error) {
+	if err := mech.SupportsSigning(); err != nil {
+		return nil, err
+	}
+	// The signature would be accepted only for a reference VerifyDockerManifestSignature can parse; don’t create unusable signatures.
+	if _, err := reference.ParseNormalizedNamed(dockerReference); err != nil {
+		return nil, fmt.Errorf("invalid docker reference %q: %w", dockerReference, err)
+	}
+	if keyIdentity == "" {
+		return nil, errors.New("signing key identity must not be empty")
+	}
+	if m, ok := mech.(signingMechanismWithKeyCheck); ok {
+		if err := m.checkSigningKey(keyIdentity); err != nil {
+			return nil, err
+		}
+	}
 	manifestDigest, err := manifest.Digest(m)
 	if err != nil {
 		return nil, err
@@ -38,11 +55,16 @@ func SignDockerManifestWithOptions(m []byte, dockerReference string, mech Signin
 		}
 	}
 
-	return sig.sign(mech, keyIdentity, passphrase)
+	res, err := sig.sign(mech, keyIdentity, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("signing using key %q: %w", keyIdentity, err)
+	}
+	return res, nil
 }
 
 // SignDockerManifest returns a signature for manifest as the specified dockerReference,
 // using mech and keyIdentity.
+// If mech does not support signing (e.g. with the containers_image_openpgp build tag), this fails with a SigningNotSupportedError.
 func SignDockerManifest(m []byte, dockerReference string, mech SigningMechanism, keyIdentity string) ([]byte, error) {
 	return SignDockerManifestWithOptions(m, dockerReference, mech, keyIdentity, nil)
 }
@@ -100,3 +122,29 @@ func VerifyImageManifestSignatureUsingKeyIdentityList(unverifiedSignature, unver
 	}
 	return sig, matchedKeyIdentity, err
 }
+
+// VerifyStandalone checks that sig is a valid signature of manifest as expectedRef,
+// made by one of the public keys in keyring (an OpenPGP keyring, binary or ASCII-armored).
+// It returns the verified signature contents.
+//
+// This is intended for callers which have a detached signature, a manifest and a public key,
+// and no policy configuration; see PolicyContext for the general-purpose verification API.
+func VerifyStandalone(manifest []byte, sig []byte, expectedRef string, keyring io.Reader) (*Signature, error) {
+	keyBlob, err := io.ReadAll(keyring)
+	if err != nil {
+		return nil, fmt.Errorf("reading public keys: %w", err)
+	}
+	mech, keyIdentities, err := NewEphemeralGPGSigningMechanism(keyBlob)
+	if err != nil {
+		return nil, fmt.Errorf("importing public keys: %w", err)
+	}
+	defer mech.Close()
+	if len(keyIdentities) == 0 {
+		return nil, errors.New("no public keys found in the keyring")
+	}
+	res, _, err := VerifyImageManifestSignatureUsingKeyIdentityList(sig, manifest, expectedRef, mech, keyIdentities)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
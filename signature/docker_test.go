@@ -1,6 +1,8 @@
 package signature
 
 import (
+	"bytes"
+	"errors"
 	"os"
 	"testing"
 
@@ -40,9 +42,59 @@ func TestSignDockerManifest(t *testing.T) {
 	_, err = SignDockerManifest(manifest, "", mech, TestKeyFingerprint)
 	assert.Error(t, err)
 
+	// Invalid docker reference
+	_, err = SignDockerManifest(manifest, "UPPERCASEISINVALID", mech, TestKeyFingerprint)
+	assert.Error(t, err)
+
+	// Empty key identity
+	_, err = SignDockerManifest(manifest, TestImageSignatureReference, mech, "")
+	assert.Error(t, err)
+
 	// Error signing
 	_, err = SignDockerManifest(manifest, TestImageSignatureReference, mech, "this fingerprint doesn't exist")
-	assert.Error(t, err)
+	assert.ErrorContains(t, err, "this fingerprint doesn't exist")
+}
+
+// keyCheckingMechanism is a SigningMechanism which only knows about knownKey, and records whether it was asked to sign.
+type keyCheckingMechanism struct {
+	SigningMechanism
+	knownKey string
+	signed   bool
+}
+
+func (m *keyCheckingMechanism) SupportsSigning() error {
+	return nil
+}
+
+func (m *keyCheckingMechanism) checkSigningKey(keyIdentity string) error {
+	if keyIdentity != m.knownKey {
+		return errors.New("unknown key")
+	}
+	return nil
+}
+
+func (m *keyCheckingMechanism) Sign(input []byte, keyIdentity string) ([]byte, error) {
+	m.signed = true
+	return nil, errors.New("signing not implemented")
+}
+
+func TestSignDockerManifestChecksKey(t *testing.T) {
+	manifest, err := os.ReadFile("fixtures/image.manifest.json")
+	require.NoError(t, err)
+	invalidManifest, err := os.ReadFile("fixtures/v2s1-invalid-signatures.manifest.json")
+	require.NoError(t, err)
+
+	// A missing key is reported before doing any other work
+	mech := &keyCheckingMechanism{knownKey: TestKeyFingerprint}
+	_, err = SignDockerManifest(invalidManifest, TestImageSignatureReference, mech, "this fingerprint doesn't exist")
+	assert.ErrorContains(t, err, "unknown key")
+	assert.False(t, mech.signed)
+
+	// A known key is used
+	mech = &keyCheckingMechanism{knownKey: TestKeyFingerprint}
+	_, err = SignDockerManifest(manifest, TestImageSignatureReference, mech, TestKeyFingerprint)
+	assert.ErrorContains(t, err, "signing not implemented")
+	assert.True(t, mech.signed)
 }
 
 func TestSignDockerManifestWithPassphrase(t *testing.T) {
@@ -234,3 +286,42 @@ func TestVerifyImageManifestSignatureUsingKeyIdentityList(t *testing.T) {
 	assert.Nil(t, sig)
 	assert.Equal(t, "", keyIdentity)
 }
+
+func TestVerifyStandalone(t *testing.T) {
+	manifest, err := os.ReadFile("fixtures/image.manifest.json")
+	require.NoError(t, err)
+	signature, err := os.ReadFile("fixtures/image.signature")
+	require.NoError(t, err)
+	keyring, err := os.ReadFile("fixtures/public-key.gpg")
+	require.NoError(t, err)
+
+	// Successful verification
+	sig, err := VerifyStandalone(manifest, signature, TestImageSignatureReference, bytes.NewReader(keyring))
+	require.NoError(t, err)
+	assert.Equal(t, TestImageSignatureReference, sig.DockerReference)
+	assert.Equal(t, TestImageManifestDigest, sig.DockerManifestDigest)
+
+	// Tampered manifest
+	tampered := bytes.Clone(manifest)
+	tampered[len(tampered)-2] = ' '
+	sig, err = VerifyStandalone(tampered, signature, TestImageSignatureReference, bytes.NewReader(keyring))
+	assert.Error(t, err)
+	assert.Nil(t, sig)
+
+	// Docker reference mismatch
+	sig, err = VerifyStandalone(manifest, signature, "example.com/does-not/match", bytes.NewReader(keyring))
+	assert.Error(t, err)
+	assert.Nil(t, sig)
+
+	// Wrong key
+	otherKeyring, err := os.ReadFile("fixtures/public-key-2.gpg")
+	require.NoError(t, err)
+	sig, err = VerifyStandalone(manifest, signature, TestImageSignatureReference, bytes.NewReader(otherKeyring))
+	assert.Error(t, err)
+	assert.Nil(t, sig)
+
+	// No keys
+	sig, err = VerifyStandalone(manifest, signature, TestImageSignatureReference, bytes.NewReader([]byte("this is not a keyring")))
+	assert.Error(t, err)
+	assert.Nil(t, sig)
+}
@@ -8,6 +8,7 @@ import (
 	"crypto/ecdsa"
 	"crypto/x509"
 	"errors"
+	"time"
 )
 
 type fulcioTrustRoot struct {
@@ -22,7 +23,7 @@ func (f *fulcioTrustRoot) validate() error {
 
 func verifyRekorFulcio(rekorPublicKeys []*ecdsa.PublicKey, fulcioTrustRoot *fulcioTrustRoot, untrustedRekorSET []byte,
 	untrustedCertificateBytes []byte, untrustedIntermediateChainBytes []byte, untrustedBase64Signature string,
-	untrustedPayloadBytes []byte) (crypto.PublicKey, error) {
-	return nil, errors.New("fulcio disabled at compile-time")
+	untrustedPayloadBytes []byte) (crypto.PublicKey, time.Time, error) {
+	return nil, time.Time{}, errors.New("fulcio disabled at compile-time")
 
 }
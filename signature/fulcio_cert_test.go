@@ -451,16 +451,17 @@ func TestVerifyRekorFulcio(t *testing.T) {
 	require.NoError(t, err)
 
 	// Success
-	pk, err := verifyRekorFulcio(rekorKeysECDSA, &fulcioTrustRoot{
+	pk, rekorTime, err := verifyRekorFulcio(rekorKeysECDSA, &fulcioTrustRoot{
 		caCertificates: caCertificates,
 		oidcIssuer:     "https://github.com/login/oauth",
 		subjectEmail:   "mitr@redhat.com",
 	}, setBytes, certBytes, chainBytes, string(sigBase64), payloadBytes)
 	require.NoError(t, err)
 	assertPublicKeyMatchesCert(t, certBytes, pk)
+	assert.False(t, rekorTime.IsZero())
 
 	// Rekor failure
-	pk, err = verifyRekorFulcio(rekorKeysECDSA, &fulcioTrustRoot{
+	pk, _, err = verifyRekorFulcio(rekorKeysECDSA, &fulcioTrustRoot{
 		caCertificates: caCertificates,
 		oidcIssuer:     "https://github.com/login/oauth",
 		subjectEmail:   "mitr@redhat.com",
@@ -469,7 +470,7 @@ func TestVerifyRekorFulcio(t *testing.T) {
 	assert.Nil(t, pk)
 
 	// Fulcio failure
-	pk, err = verifyRekorFulcio(rekorKeysECDSA, &fulcioTrustRoot{
+	pk, _, err = verifyRekorFulcio(rekorKeysECDSA, &fulcioTrustRoot{
 		caCertificates: caCertificates,
 		oidcIssuer:     "https://github.com/login/oauth",
 		subjectEmail:   "this-does-not-match@example.com",
@@ -0,0 +1,130 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// rekorCheckpointSignaturePrefix starts every signature line of a signed note (https://pkg.go.dev/golang.org/x/mod/sumdb/note).
+const rekorCheckpointSignaturePrefix = "— "
+
+// untrustedRekorCheckpoint is a parsed Rekor checkpoint, a signed note committing to the state of a transparency log.
+// All of the values are UNTRUSTED until the note is verified by VerifyRekorCheckpoint.
+type untrustedRekorCheckpoint struct {
+	text       string   // The signed text, ending with a newline
+	treeSize   uint64   // The tree size, from the second line of text
+	rootHash   []byte   // The root hash, from the third line of text
+	signatures [][]byte // Decoded signature values: a 4-byte key hash followed by the signature
+}
+
+// parseRekorCheckpoint parses unverifiedCheckpoint, a Rekor checkpoint in the signed note format.
+func parseRekorCheckpoint(unverifiedCheckpoint []byte) (untrustedRekorCheckpoint, error) {
+	text, sigs, ok := strings.Cut(string(unverifiedCheckpoint), "\n\n")
+	if !ok {
+		return untrustedRekorCheckpoint{}, NewInvalidSignatureError("Rekor checkpoint has no signatures")
+	}
+	text += "\n"
+	lines := strings.Split(text, "\n")
+	if len(lines) < 4 { // origin, tree size, root hash, and "" after the final newline
+		return untrustedRekorCheckpoint{}, NewInvalidSignatureError("Rekor checkpoint is too short")
+	}
+	treeSize, err := strconv.ParseUint(lines[1], 10, 64)
+	if err != nil {
+		return untrustedRekorCheckpoint{}, NewInvalidSignatureError(fmt.Sprintf("invalid Rekor checkpoint tree size %q", lines[1]))
+	}
+	rootHash, err := base64.StdEncoding.DecodeString(lines[2])
+	if err != nil || len(rootHash) != sha256.Size {
+		return untrustedRekorCheckpoint{}, NewInvalidSignatureError(fmt.Sprintf("invalid Rekor checkpoint root hash %q", lines[2]))
+	}
+	res := untrustedRekorCheckpoint{text: text, treeSize: treeSize, rootHash: rootHash}
+	for _, line := range strings.Split(strings.TrimSuffix(sigs, "\n"), "\n") {
+		rest, ok := strings.CutPrefix(line, rekorCheckpointSignaturePrefix)
+		if !ok {
+			return untrustedRekorCheckpoint{}, NewInvalidSignatureError(fmt.Sprintf("invalid Rekor checkpoint signature line %q", line))
+		}
+		_, b64, ok := strings.Cut(rest, " ")
+		if !ok {
+			return untrustedRekorCheckpoint{}, NewInvalidSignatureError(fmt.Sprintf("invalid Rekor checkpoint signature line %q", line))
+		}
+		sig, err := base64.StdEncoding.DecodeString(b64)
+		if err != nil || len(sig) <= 4 {
+			return untrustedRekorCheckpoint{}, NewInvalidSignatureError(fmt.Sprintf("invalid Rekor checkpoint signature line %q", line))
+		}
+		res.signatures = append(res.signatures, sig)
+	}
+	return res, nil
+}
+
+// VerifyRekorCheckpoint verifies that unverifiedCheckpoint, a Rekor checkpoint in the signed note format
+// (as returned in SigstoreBundleComponents.UntrustedRekorCheckpoint), is signed by one of publicKeys.
+func VerifyRekorCheckpoint(publicKeys []*ecdsa.PublicKey, unverifiedCheckpoint []byte) error {
+	checkpoint, err := parseRekorCheckpoint(unverifiedCheckpoint)
+	if err != nil {
+		return err
+	}
+	textHash := sha256.Sum256([]byte(checkpoint.text))
+	for _, pk := range publicKeys {
+		pkBytes, err := x509.MarshalPKIXPublicKey(pk)
+		if err != nil {
+			return fmt.Errorf("marshaling Rekor public key: %w", err)
+		}
+		pkHash := sha256.Sum256(pkBytes)
+		for _, sig := range checkpoint.signatures {
+			if bytes.Equal(sig[:4], pkHash[:4]) && ecdsa.VerifyASN1(pk, textHash[:], sig[4:]) {
+				return nil
+			}
+		}
+	}
+	return NewInvalidSignatureError("cryptographic signature verification of Rekor checkpoint failed")
+}
+
+// rekorLeafHash returns the RFC 6962 Merkle tree leaf hash of data.
+func rekorLeafHash(data []byte) []byte {
+	h := sha256.Sum256(append([]byte{0}, data...))
+	return h[:]
+}
+
+// rekorNodeHash returns the RFC 6962 Merkle tree hash of an interior node with children left and right.
+func rekorNodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{1})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// rootFromInclusionProof returns the Merkle tree root hash implied by an inclusion proof of leafHash at index in a tree of treeSize,
+// using the algorithm of RFC 9162, section 2.1.3.2.
+func rootFromInclusionProof(index, treeSize uint64, leafHash []byte, proof [][]byte) ([]byte, error) {
+	if index >= treeSize {
+		return nil, NewInvalidSignatureError(fmt.Sprintf("inclusion proof index %d is outside of tree size %d", index, treeSize))
+	}
+	fn, sn := index, treeSize-1
+	r := leafHash
+	for _, p := range proof {
+		if sn == 0 {
+			return nil, NewInvalidSignatureError("inclusion proof is too long")
+		}
+		if fn&1 == 1 || fn == sn {
+			r = rekorNodeHash(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = rekorNodeHash(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 {
+		return nil, NewInvalidSignatureError("inclusion proof is too short")
+	}
+	return r, nil
+}
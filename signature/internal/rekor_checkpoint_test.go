@@ -0,0 +1,149 @@
+package internal
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testRekorCheckpointKey signs checkpoints created by testRekorCheckpoint.
+var testRekorCheckpointKey = func() *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}()
+
+// testRekorCheckpoint returns a checkpoint for treeSize and rootHash, signed by key.
+func testRekorCheckpoint(t *testing.T, key *ecdsa.PrivateKey, treeSize uint64, rootHash []byte) string {
+	text := fmt.Sprintf("rekor.example.com - 1234\n%d\n%s\n", treeSize, base64.StdEncoding.EncodeToString(rootHash))
+	textHash := sha256.Sum256([]byte(text))
+	sig, err := ecdsa.SignASN1(rand.Reader, key, textHash[:])
+	require.NoError(t, err)
+	pkBytes, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	pkHash := sha256.Sum256(pkBytes)
+	return text + "\n" + "— rekor.example.com " + base64.StdEncoding.EncodeToString(append(pkHash[:4], sig...)) + "\n"
+}
+
+// testMerkleTreeHash computes the Merkle tree hash of leaves, as defined in RFC 6962, section 2.1.
+func testMerkleTreeHash(leaves [][]byte) []byte {
+	switch n := len(leaves); n {
+	case 0:
+		h := sha256.Sum256(nil)
+		return h[:]
+	case 1:
+		return rekorLeafHash(leaves[0])
+	default:
+		k := testLargestPowerOfTwoBelow(n)
+		return rekorNodeHash(testMerkleTreeHash(leaves[:k]), testMerkleTreeHash(leaves[k:]))
+	}
+}
+
+// testMerkleAuditPath computes the audit path of leaf m in leaves, as defined in RFC 6962, section 2.1.1.
+func testMerkleAuditPath(m int, leaves [][]byte) [][]byte {
+	n := len(leaves)
+	if n <= 1 {
+		return nil
+	}
+	k := testLargestPowerOfTwoBelow(n)
+	if m < k {
+		return append(testMerkleAuditPath(m, leaves[:k]), testMerkleTreeHash(leaves[k:]))
+	}
+	return append(testMerkleAuditPath(m-k, leaves[k:]), testMerkleTreeHash(leaves[:k]))
+}
+
+// testLargestPowerOfTwoBelow returns the largest power of two smaller than n > 1.
+func testLargestPowerOfTwoBelow(n int) int {
+	k := 1
+	for k*2 < n {
+		k *= 2
+	}
+	return k
+}
+
+func TestRootFromInclusionProof(t *testing.T) {
+	var leaves [][]byte
+	for i := range 17 {
+		leaves = append(leaves, []byte(fmt.Sprintf("leaf %d", i)))
+	}
+	for size := 1; size <= len(leaves); size++ {
+		tree := leaves[:size]
+		expectedRoot := testMerkleTreeHash(tree)
+		for index := range size {
+			proof := testMerkleAuditPath(index, tree)
+			root, err := rootFromInclusionProof(uint64(index), uint64(size), rekorLeafHash(tree[index]), proof)
+			require.NoError(t, err, "%d/%d", index, size)
+			assert.Equal(t, expectedRoot, root, "%d/%d", index, size)
+
+			if len(proof) > 0 {
+				// A modified proof computes a different root
+				modified := append([][]byte{}, proof...)
+				modified[len(modified)-1] = rekorLeafHash([]byte("other"))
+				root, err = rootFromInclusionProof(uint64(index), uint64(size), rekorLeafHash(tree[index]), modified)
+				require.NoError(t, err, "%d/%d", index, size)
+				assert.NotEqual(t, expectedRoot, root, "%d/%d", index, size)
+				// A truncated proof is rejected
+				_, err = rootFromInclusionProof(uint64(index), uint64(size), rekorLeafHash(tree[index]), proof[:len(proof)-1])
+				assert.Error(t, err, "%d/%d", index, size)
+			}
+			// An extended proof is rejected
+			_, err = rootFromInclusionProof(uint64(index), uint64(size), rekorLeafHash(tree[index]), append(proof, expectedRoot))
+			assert.Error(t, err, "%d/%d", index, size)
+		}
+		// An index outside of the tree is rejected
+		_, err := rootFromInclusionProof(uint64(size), uint64(size), rekorLeafHash(leaves[0]), nil)
+		assert.Error(t, err, "%d", size)
+	}
+}
+
+func TestVerifyRekorCheckpoint(t *testing.T) {
+	rootHash := rekorLeafHash([]byte("root"))
+	checkpoint := testRekorCheckpoint(t, testRekorCheckpointKey, 5, rootHash)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	// Success
+	err = VerifyRekorCheckpoint([]*ecdsa.PublicKey{&testRekorCheckpointKey.PublicKey}, []byte(checkpoint))
+	assert.NoError(t, err)
+	err = VerifyRekorCheckpoint([]*ecdsa.PublicKey{&otherKey.PublicKey, &testRekorCheckpointKey.PublicKey}, []byte(checkpoint))
+	assert.NoError(t, err)
+	parsed, err := parseRekorCheckpoint([]byte(checkpoint))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), parsed.treeSize)
+	assert.Equal(t, rootHash, parsed.rootHash)
+
+	// Signed by a different key
+	err = VerifyRekorCheckpoint([]*ecdsa.PublicKey{&otherKey.PublicKey}, []byte(checkpoint))
+	assert.Error(t, err)
+	// Modified text
+	modified := strings.Replace(checkpoint, "\n5\n", "\n6\n", 1)
+	err = VerifyRekorCheckpoint([]*ecdsa.PublicKey{&testRekorCheckpointKey.PublicKey}, []byte(modified))
+	assert.Error(t, err)
+
+	// Invalid formats
+	for _, c := range []string{
+		"",
+		"rekor.example.com - 1234\n5\n" + base64.StdEncoding.EncodeToString(rootHash) + "\n",                 // No signatures
+		"rekor.example.com - 1234\n5\n\n— rekor.example.com AAAAAAAA\n",                                      // Too short
+		"rekor.example.com - 1234\nx\n" + base64.StdEncoding.EncodeToString(rootHash) + "\n\n— a AAAAAAAA\n", // Invalid tree size
+		"rekor.example.com - 1234\n5\nAAAA\n\n— a AAAAAAAA\n",                                                // Invalid root hash
+		"rekor.example.com - 1234\n5\n" + base64.StdEncoding.EncodeToString(rootHash) + "\n\na AAAAAAAA\n",   // No signature prefix
+		"rekor.example.com - 1234\n5\n" + base64.StdEncoding.EncodeToString(rootHash) + "\n\n— AAAAAAAA\n",   // No key name
+		"rekor.example.com - 1234\n5\n" + base64.StdEncoding.EncodeToString(rootHash) + "\n\n— a AAAA\n",     // Signature too short
+		"rekor.example.com - 1234\n5\n" + base64.StdEncoding.EncodeToString(rootHash) + "\n\n— a ???\n",      // Invalid base64
+	} {
+		err = VerifyRekorCheckpoint([]*ecdsa.PublicKey{&testRekorCheckpointKey.PublicKey}, []byte(c))
+		assert.Error(t, err, c)
+	}
+}
@@ -0,0 +1,238 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"strings"
+)
+
+// The only Rekor entry kind and version we can verify, see also HashedRekordV001APIVersion.
+// (rekor_set.go is not available with containers_image_rekor_stub, so we can’t use the constant from there.)
+const (
+	hashedRekordKind       = "hashedrekord"
+	hashedRekordAPIVersion = "0.0.1"
+)
+
+// sigstoreBundleMediaTypePrefix is the common prefix of the media types of all versions of the Sigstore bundle format
+// (“application/vnd.dev.sigstore.bundle+json;version=0.1”, “application/vnd.dev.sigstore.bundle.v0.3+json”, …).
+const sigstoreBundleMediaTypePrefix = "application/vnd.dev.sigstore.bundle"
+
+// untrustedSigstoreBundle is a parsed subset of the JSON form of a github.com/sigstore/protobuf-specs Bundle.
+// We only represent the fields we use; unknown fields are ignored, as in the protobuf JSON mapping.
+type untrustedSigstoreBundle struct {
+	MediaType            string `json:"mediaType"`
+	VerificationMaterial struct {
+		PublicKey *struct {
+			Hint string `json:"hint"`
+		} `json:"publicKey"`
+		X509CertificateChain *struct {
+			Certificates []struct {
+				RawBytes []byte `json:"rawBytes"`
+			} `json:"certificates"`
+		} `json:"x509CertificateChain"`
+		Certificate *struct {
+			RawBytes []byte `json:"rawBytes"`
+		} `json:"certificate"`
+		TlogEntries []untrustedSigstoreBundleTlogEntry `json:"tlogEntries"`
+	} `json:"verificationMaterial"`
+	MessageSignature *struct {
+		MessageDigest *struct {
+			Algorithm string `json:"algorithm"`
+			Digest    []byte `json:"digest"`
+		} `json:"messageDigest"`
+		Signature []byte `json:"signature"`
+	} `json:"messageSignature"`
+	DSSEEnvelope json.RawMessage `json:"dsseEnvelope"`
+}
+
+// untrustedSigstoreBundleTlogEntry is a parsed subset of a github.com/sigstore/protobuf-specs TransparencyLogEntry.
+type untrustedSigstoreBundleTlogEntry struct {
+	LogIndex int64 `json:"logIndex,string"`
+	LogID    struct {
+		KeyID []byte `json:"keyId"`
+	} `json:"logId"`
+	KindVersion struct {
+		Kind    string `json:"kind"`
+		Version string `json:"version"`
+	} `json:"kindVersion"`
+	IntegratedTime   int64 `json:"integratedTime,string"`
+	InclusionPromise *struct {
+		SignedEntryTimestamp []byte `json:"signedEntryTimestamp"`
+	} `json:"inclusionPromise"`
+	InclusionProof *struct {
+		LogIndex   int64    `json:"logIndex,string"`
+		RootHash   []byte   `json:"rootHash"`
+		TreeSize   int64    `json:"treeSize,string"`
+		Hashes     [][]byte `json:"hashes"`
+		Checkpoint struct {
+			Envelope string `json:"envelope"`
+		} `json:"checkpoint"`
+	} `json:"inclusionProof"`
+	CanonicalizedBody []byte `json:"canonicalizedBody"`
+}
+
+// SigstoreBundleComponents contains the values of a Sigstore bundle, converted to the representation
+// used by the annotation-based sigstore signature format.
+// All of the values are UNTRUSTED, they are only converted from the bundle, not verified.
+type SigstoreBundleComponents struct {
+	UntrustedBase64Signature      string
+	UntrustedCertificatePEM       []byte // nil if the bundle refers to a public key instead of containing a certificate
+	UntrustedIntermediateChainPEM []byte // nil if the bundle contains no intermediate certificates
+	UntrustedRekorSET             []byte // nil if the bundle contains no transparency log entry
+	UntrustedRekorCheckpoint      []byte // nil if the transparency log entry contains no inclusion proof
+}
+
+// ParseSigstoreBundle parses unverifiedBundle, a JSON-encoded Sigstore bundle signing unverifiedPayload,
+// and converts it into the components used by the annotation-based sigstore signature format, so that
+// they can be verified using VerifyRekorSET, VerifyRekorCheckpoint and VerifySigstorePayload.
+//
+// Only bundles with a message signature (not a DSSE envelope) and at most one transparency log entry, which must
+// be a hashedrekord with an inclusion promise, are supported. If the entry contains an inclusion proof, the proof
+// is verified against the tree size and root hash of its checkpoint here; the checkpoint signature must be verified
+// by the caller, using VerifyRekorCheckpoint.
+func ParseSigstoreBundle(unverifiedBundle []byte, unverifiedPayload []byte) (SigstoreBundleComponents, error) {
+	var bundle untrustedSigstoreBundle
+	if err := json.Unmarshal(unverifiedBundle, &bundle); err != nil {
+		return SigstoreBundleComponents{}, NewInvalidSignatureError(fmt.Sprintf("parsing Sigstore bundle: %v", err))
+	}
+	if !strings.HasPrefix(bundle.MediaType, sigstoreBundleMediaTypePrefix) {
+		return SigstoreBundleComponents{}, NewInvalidSignatureError(fmt.Sprintf("unexpected Sigstore bundle media type %q", bundle.MediaType))
+	}
+	if bundle.DSSEEnvelope != nil {
+		return SigstoreBundleComponents{}, NewInvalidSignatureError("Sigstore bundles with a DSSE envelope are not supported")
+	}
+	if bundle.MessageSignature == nil || len(bundle.MessageSignature.Signature) == 0 {
+		return SigstoreBundleComponents{}, NewInvalidSignatureError("Sigstore bundle does not contain a message signature")
+	}
+	// The digest is not cryptographically protected by itself, but rejecting inconsistent bundles makes them easier to diagnose.
+	if d := bundle.MessageSignature.MessageDigest; d != nil {
+		if d.Algorithm != "SHA2_256" {
+			return SigstoreBundleComponents{}, NewInvalidSignatureError(fmt.Sprintf("unsupported Sigstore bundle message digest algorithm %q", d.Algorithm))
+		}
+		payloadDigest := sha256.Sum256(unverifiedPayload)
+		if subtle.ConstantTimeCompare(d.Digest, payloadDigest[:]) != 1 {
+			return SigstoreBundleComponents{}, NewInvalidSignatureError("Sigstore bundle message digest does not match the payload")
+		}
+	}
+
+	res := SigstoreBundleComponents{
+		UntrustedBase64Signature: base64.StdEncoding.EncodeToString(bundle.MessageSignature.Signature),
+	}
+
+	vm := &bundle.VerificationMaterial
+	var certificates [][]byte
+	switch {
+	case vm.X509CertificateChain != nil:
+		for _, c := range vm.X509CertificateChain.Certificates {
+			certificates = append(certificates, c.RawBytes)
+		}
+		if len(certificates) == 0 {
+			return SigstoreBundleComponents{}, NewInvalidSignatureError("Sigstore bundle contains an empty certificate chain")
+		}
+	case vm.Certificate != nil:
+		certificates = [][]byte{vm.Certificate.RawBytes}
+	case vm.PublicKey != nil:
+		// The key must be provided by the policy, so there is nothing to record.
+	default:
+		return SigstoreBundleComponents{}, NewInvalidSignatureError("Sigstore bundle contains neither a certificate nor a public key identifier")
+	}
+	if len(certificates) > 0 {
+		res.UntrustedCertificatePEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificates[0]})
+		if len(certificates) > 1 {
+			var chain bytes.Buffer
+			for _, c := range certificates[1:] {
+				if err := pem.Encode(&chain, &pem.Block{Type: "CERTIFICATE", Bytes: c}); err != nil {
+					return SigstoreBundleComponents{}, fmt.Errorf("encoding intermediate certificate: %w", err) // Coverage: This should never happen.
+				}
+			}
+			res.UntrustedIntermediateChainPEM = chain.Bytes()
+		}
+	}
+
+	switch len(vm.TlogEntries) {
+	case 0:
+		// res.UntrustedRekorSET remains nil
+	case 1:
+		set, err := rekorSETFromSigstoreBundleTlogEntry(&vm.TlogEntries[0])
+		if err != nil {
+			return SigstoreBundleComponents{}, err
+		}
+		res.UntrustedRekorSET = set
+		checkpoint, err := rekorCheckpointFromSigstoreBundleTlogEntry(&vm.TlogEntries[0])
+		if err != nil {
+			return SigstoreBundleComponents{}, err
+		}
+		res.UntrustedRekorCheckpoint = checkpoint
+	default:
+		return SigstoreBundleComponents{}, NewInvalidSignatureError(fmt.Sprintf("Sigstore bundle contains %d transparency log entries, only one is supported", len(vm.TlogEntries)))
+	}
+	return res, nil
+}
+
+// rekorSETFromSigstoreBundleTlogEntry converts entry into the representation used by the
+// sigstore annotation-based format, which can be verified using VerifyRekorSET.
+func rekorSETFromSigstoreBundleTlogEntry(entry *untrustedSigstoreBundleTlogEntry) ([]byte, error) {
+	if entry.KindVersion.Kind != hashedRekordKind || entry.KindVersion.Version != hashedRekordAPIVersion {
+		return nil, NewInvalidSignatureError(fmt.Sprintf("unsupported transparency log entry kind %q version %q", entry.KindVersion.Kind, entry.KindVersion.Version))
+	}
+	if entry.InclusionPromise == nil {
+		return nil, NewInvalidSignatureError("transparency log entry does not contain an inclusion promise")
+	}
+	// The SET signs a canonical JSON form of exactly this payload, so any inconsistency between the fields
+	// (e.g. an entry copied from a different log index) causes VerifyRekorSET to fail.
+	// Like the constants above, this uses a local representation instead of UntrustedRekorSET / UntrustedRekorPayload.
+	payload, err := json.Marshal(map[string]any{
+		"body":           entry.CanonicalizedBody,
+		"integratedTime": entry.IntegratedTime,
+		"logIndex":       entry.LogIndex,
+		"logID":          hex.EncodeToString(entry.LogID.KeyID),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("encoding Rekor SET payload: %w", err) // Coverage: This should never happen.
+	}
+	set, err := json.Marshal(map[string]any{
+		"SignedEntryTimestamp": entry.InclusionPromise.SignedEntryTimestamp,
+		"Payload":              json.RawMessage(payload),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("encoding Rekor SET: %w", err) // Coverage: This should never happen.
+	}
+	return set, nil
+}
+
+// rekorCheckpointFromSigstoreBundleTlogEntry verifies the inclusion proof of entry, if any, against the tree size and root hash
+// of the proof’s checkpoint, and returns the checkpoint, to be verified using VerifyRekorCheckpoint.
+// It returns nil if entry contains no inclusion proof.
+func rekorCheckpointFromSigstoreBundleTlogEntry(entry *untrustedSigstoreBundleTlogEntry) ([]byte, error) {
+	proof := entry.InclusionProof
+	if proof == nil {
+		return nil, nil
+	}
+	if proof.LogIndex < 0 || proof.TreeSize < 0 {
+		return nil, NewInvalidSignatureError(fmt.Sprintf("invalid inclusion proof log index %d, tree size %d", proof.LogIndex, proof.TreeSize))
+	}
+	checkpointBytes := []byte(proof.Checkpoint.Envelope)
+	checkpoint, err := parseRekorCheckpoint(checkpointBytes)
+	if err != nil {
+		return nil, err
+	}
+	// The proof’s tree size and root hash are redundant with the checkpoint; only the checkpoint is signed, so use it
+	// for the verification, and reject inconsistent values to make them easier to diagnose.
+	if checkpoint.treeSize != uint64(proof.TreeSize) || !bytes.Equal(checkpoint.rootHash, proof.RootHash) {
+		return nil, NewInvalidSignatureError("inclusion proof does not match its checkpoint")
+	}
+	root, err := rootFromInclusionProof(uint64(proof.LogIndex), checkpoint.treeSize, rekorLeafHash(entry.CanonicalizedBody), proof.Hashes)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(root, checkpoint.rootHash) {
+		return nil, NewInvalidSignatureError("inclusion proof does not match the checkpoint root hash")
+	}
+	return checkpointBytes, nil
+}
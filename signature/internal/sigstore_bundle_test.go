@@ -0,0 +1,261 @@
+package internal
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testSigstoreBundle returns a Sigstore bundle, as a JSON-compatible map, equivalent to
+// testdata/rekor-{set,cert,sig}, along with the signed payload.
+func testSigstoreBundle(t *testing.T) (map[string]any, []byte) {
+	setBytes, err := os.ReadFile("testdata/rekor-set")
+	require.NoError(t, err)
+	var set struct {
+		SignedEntryTimestamp []byte
+		Payload              struct {
+			Body           []byte `json:"body"`
+			IntegratedTime int64  `json:"integratedTime"`
+			LogIndex       int64  `json:"logIndex"`
+			LogID          string `json:"logID"`
+		}
+	}
+	err = json.Unmarshal(setBytes, &set)
+	require.NoError(t, err)
+	logID, err := hex.DecodeString(set.Payload.LogID)
+	require.NoError(t, err)
+
+	certPEM, err := os.ReadFile("testdata/rekor-cert")
+	require.NoError(t, err)
+	certBlock, rest := pem.Decode(certPEM)
+	require.NotNil(t, certBlock)
+	require.Empty(t, strings.TrimSpace(string(rest)))
+
+	sigBase64, err := os.ReadFile("testdata/rekor-sig")
+	require.NoError(t, err)
+	sig, err := base64.StdEncoding.DecodeString(string(sigBase64))
+	require.NoError(t, err)
+
+	payload, err := os.ReadFile("testdata/rekor-payload")
+	require.NoError(t, err)
+	payloadDigest := sha256.Sum256(payload)
+
+	// A synthetic log of 6 entries, containing the entry at proofIndex.
+	const proofIndex = 3
+	leaves := [][]byte{[]byte("leaf 0"), []byte("leaf 1"), []byte("leaf 2"), set.Payload.Body, []byte("leaf 4"), []byte("leaf 5")}
+	rootHash := testMerkleTreeHash(leaves)
+
+	return map[string]any{
+		"mediaType": "application/vnd.dev.sigstore.bundle+json;version=0.1",
+		"verificationMaterial": map[string]any{
+			"x509CertificateChain": map[string]any{
+				"certificates": []any{
+					map[string]any{"rawBytes": certBlock.Bytes},
+				},
+			},
+			"tlogEntries": []any{
+				map[string]any{
+					"logIndex":         strconv.FormatInt(set.Payload.LogIndex, 10),
+					"logId":            map[string]any{"keyId": logID},
+					"kindVersion":      map[string]any{"kind": "hashedrekord", "version": "0.0.1"},
+					"integratedTime":   strconv.FormatInt(set.Payload.IntegratedTime, 10),
+					"inclusionPromise": map[string]any{"signedEntryTimestamp": set.SignedEntryTimestamp},
+					"inclusionProof": map[string]any{
+						"logIndex":   strconv.Itoa(proofIndex),
+						"rootHash":   rootHash,
+						"treeSize":   strconv.Itoa(len(leaves)),
+						"hashes":     testMerkleAuditPath(proofIndex, leaves),
+						"checkpoint": map[string]any{"envelope": testRekorCheckpoint(t, testRekorCheckpointKey, uint64(len(leaves)), rootHash)},
+					},
+					"canonicalizedBody": set.Payload.Body,
+				},
+			},
+		},
+		"messageSignature": map[string]any{
+			"messageDigest": map[string]any{"algorithm": "SHA2_256", "digest": payloadDigest[:]},
+			"signature":     sig,
+		},
+	}, payload
+}
+
+func TestParseSigstoreBundle(t *testing.T) {
+	setBytes, err := os.ReadFile("testdata/rekor-set")
+	require.NoError(t, err)
+	certPEM, err := os.ReadFile("testdata/rekor-cert")
+	require.NoError(t, err)
+	sigBase64, err := os.ReadFile("testdata/rekor-sig")
+	require.NoError(t, err)
+
+	// Success
+	bundle, payload := testSigstoreBundle(t)
+	bundleBytes, err := json.Marshal(bundle)
+	require.NoError(t, err)
+	res, err := ParseSigstoreBundle(bundleBytes, payload)
+	require.NoError(t, err)
+	assert.Equal(t, string(sigBase64), res.UntrustedBase64Signature)
+	assert.Equal(t, certPEM, res.UntrustedCertificatePEM)
+	assert.Nil(t, res.UntrustedIntermediateChainPEM)
+	assert.JSONEq(t, string(setBytes), string(res.UntrustedRekorSET))
+	require.NotNil(t, res.UntrustedRekorCheckpoint)
+	err = VerifyRekorCheckpoint([]*ecdsa.PublicKey{&testRekorCheckpointKey.PublicKey}, res.UntrustedRekorCheckpoint)
+	assert.NoError(t, err)
+
+	// No inclusion proof
+	bundle, payload = testSigstoreBundle(t)
+	delete(bundle["verificationMaterial"].(map[string]any)["tlogEntries"].([]any)[0].(map[string]any), "inclusionProof")
+	bundleBytes, err = json.Marshal(bundle)
+	require.NoError(t, err)
+	res, err = ParseSigstoreBundle(bundleBytes, payload)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(setBytes), string(res.UntrustedRekorSET))
+	assert.Nil(t, res.UntrustedRekorCheckpoint)
+
+	// A certificate chain
+	bundle, payload = testSigstoreBundle(t)
+	chain := bundle["verificationMaterial"].(map[string]any)["x509CertificateChain"].(map[string]any)
+	chain["certificates"] = append(chain["certificates"].([]any), map[string]any{"rawBytes": []byte("intermediate")})
+	bundleBytes, err = json.Marshal(bundle)
+	require.NoError(t, err)
+	res, err = ParseSigstoreBundle(bundleBytes, payload)
+	require.NoError(t, err)
+	assert.Equal(t, certPEM, res.UntrustedCertificatePEM)
+	assert.Equal(t, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("intermediate")}), res.UntrustedIntermediateChainPEM)
+
+	// A single certificate
+	bundle, payload = testSigstoreBundle(t)
+	vm := bundle["verificationMaterial"].(map[string]any)
+	vm["certificate"] = vm["x509CertificateChain"].(map[string]any)["certificates"].([]any)[0]
+	delete(vm, "x509CertificateChain")
+	bundleBytes, err = json.Marshal(bundle)
+	require.NoError(t, err)
+	res, err = ParseSigstoreBundle(bundleBytes, payload)
+	require.NoError(t, err)
+	assert.Equal(t, certPEM, res.UntrustedCertificatePEM)
+	assert.Nil(t, res.UntrustedIntermediateChainPEM)
+
+	// A public key, no transparency log entries
+	bundle, payload = testSigstoreBundle(t)
+	vm = bundle["verificationMaterial"].(map[string]any)
+	vm["publicKey"] = map[string]any{"hint": "some key"}
+	delete(vm, "x509CertificateChain")
+	delete(vm, "tlogEntries")
+	bundleBytes, err = json.Marshal(bundle)
+	require.NoError(t, err)
+	res, err = ParseSigstoreBundle(bundleBytes, payload)
+	require.NoError(t, err)
+	assert.Equal(t, SigstoreBundleComponents{UntrustedBase64Signature: string(sigBase64)}, res)
+
+	// Invalid JSON
+	_, err = ParseSigstoreBundle([]byte("&"), payload)
+	assert.Error(t, err)
+
+	// Payload does not match the message digest
+	bundle, payload = testSigstoreBundle(t)
+	bundleBytes, err = json.Marshal(bundle)
+	require.NoError(t, err)
+	_, err = ParseSigstoreBundle(bundleBytes, append(payload, 'x'))
+	assert.Error(t, err)
+
+	// Various invalid modifications
+	for _, c := range []struct {
+		name   string
+		modify func(bundle map[string]any)
+	}{
+		{"unexpected media type", func(bundle map[string]any) { bundle["mediaType"] = "application/json" }},
+		{"DSSE envelope", func(bundle map[string]any) {
+			delete(bundle, "messageSignature")
+			bundle["dsseEnvelope"] = map[string]any{"payload": "", "payloadType": "", "signatures": []any{}}
+		}},
+		{"no message signature", func(bundle map[string]any) { delete(bundle, "messageSignature") }},
+		{"empty signature", func(bundle map[string]any) {
+			bundle["messageSignature"].(map[string]any)["signature"] = []byte{}
+		}},
+		{"unexpected digest algorithm", func(bundle map[string]any) {
+			bundle["messageSignature"].(map[string]any)["messageDigest"].(map[string]any)["algorithm"] = "SHA2_512"
+		}},
+		{"empty certificate chain", func(bundle map[string]any) {
+			bundle["verificationMaterial"].(map[string]any)["x509CertificateChain"] = map[string]any{"certificates": []any{}}
+		}},
+		{"no key or certificate", func(bundle map[string]any) {
+			delete(bundle["verificationMaterial"].(map[string]any), "x509CertificateChain")
+		}},
+		{"two transparency log entries", func(bundle map[string]any) {
+			vm := bundle["verificationMaterial"].(map[string]any)
+			entries := vm["tlogEntries"].([]any)
+			vm["tlogEntries"] = []any{entries[0], entries[0]}
+		}},
+		{"unexpected entry kind", func(bundle map[string]any) {
+			entry := bundle["verificationMaterial"].(map[string]any)["tlogEntries"].([]any)[0].(map[string]any)
+			entry["kindVersion"] = map[string]any{"kind": "intoto", "version": "0.0.2"}
+		}},
+		{"no inclusion promise", func(bundle map[string]any) {
+			entry := bundle["verificationMaterial"].(map[string]any)["tlogEntries"].([]any)[0].(map[string]any)
+			delete(entry, "inclusionPromise")
+		}},
+		{"log index not a string", func(bundle map[string]any) {
+			entry := bundle["verificationMaterial"].(map[string]any)["tlogEntries"].([]any)[0].(map[string]any)
+			entry["logIndex"] = 1
+		}},
+		{"mismatched inclusion proof hash", func(bundle map[string]any) {
+			proof := bundle["verificationMaterial"].(map[string]any)["tlogEntries"].([]any)[0].(map[string]any)["inclusionProof"].(map[string]any)
+			hashes := proof["hashes"].([][]byte)
+			hashes[0] = rekorLeafHash([]byte("other"))
+		}},
+		{"mismatched inclusion proof index", func(bundle map[string]any) {
+			proof := bundle["verificationMaterial"].(map[string]any)["tlogEntries"].([]any)[0].(map[string]any)["inclusionProof"].(map[string]any)
+			proof["logIndex"] = "2"
+		}},
+		{"inclusion proof too short", func(bundle map[string]any) {
+			proof := bundle["verificationMaterial"].(map[string]any)["tlogEntries"].([]any)[0].(map[string]any)["inclusionProof"].(map[string]any)
+			hashes := proof["hashes"].([][]byte)
+			proof["hashes"] = hashes[:len(hashes)-1]
+		}},
+		{"inclusion proof index outside of the tree", func(bundle map[string]any) {
+			proof := bundle["verificationMaterial"].(map[string]any)["tlogEntries"].([]any)[0].(map[string]any)["inclusionProof"].(map[string]any)
+			proof["logIndex"] = "6"
+		}},
+		{"negative inclusion proof index", func(bundle map[string]any) {
+			proof := bundle["verificationMaterial"].(map[string]any)["tlogEntries"].([]any)[0].(map[string]any)["inclusionProof"].(map[string]any)
+			proof["logIndex"] = "-1"
+		}},
+		{"inclusion proof of a different entry", func(bundle map[string]any) {
+			entry := bundle["verificationMaterial"].(map[string]any)["tlogEntries"].([]any)[0].(map[string]any)
+			entry["canonicalizedBody"] = []byte("leaf 3")
+		}},
+		{"inclusion proof tree size does not match the checkpoint", func(bundle map[string]any) {
+			proof := bundle["verificationMaterial"].(map[string]any)["tlogEntries"].([]any)[0].(map[string]any)["inclusionProof"].(map[string]any)
+			proof["treeSize"] = "7"
+		}},
+		{"inclusion proof root hash does not match the checkpoint", func(bundle map[string]any) {
+			proof := bundle["verificationMaterial"].(map[string]any)["tlogEntries"].([]any)[0].(map[string]any)["inclusionProof"].(map[string]any)
+			proof["rootHash"] = rekorLeafHash([]byte("other"))
+		}},
+		{"checkpoint for a different root hash", func(bundle map[string]any) {
+			proof := bundle["verificationMaterial"].(map[string]any)["tlogEntries"].([]any)[0].(map[string]any)["inclusionProof"].(map[string]any)
+			otherRoot := rekorLeafHash([]byte("other"))
+			proof["rootHash"] = otherRoot
+			proof["checkpoint"] = map[string]any{"envelope": testRekorCheckpoint(t, testRekorCheckpointKey, 6, otherRoot)}
+		}},
+		{"invalid checkpoint", func(bundle map[string]any) {
+			proof := bundle["verificationMaterial"].(map[string]any)["tlogEntries"].([]any)[0].(map[string]any)["inclusionProof"].(map[string]any)
+			proof["checkpoint"] = map[string]any{"envelope": "invalid"}
+		}},
+	} {
+		bundle, payload := testSigstoreBundle(t)
+		c.modify(bundle)
+		bundleBytes, err := json.Marshal(bundle)
+		require.NoError(t, err, c.name)
+		_, err = ParseSigstoreBundle(bundleBytes, payload)
+		assert.Error(t, err, c.name)
+	}
+}
@@ -47,6 +47,15 @@ func NewUntrustedSigstorePayload(dockerManifestDigest digest.Digest, dockerRefer
 	}
 }
 
+// UntrustedTimestamp returns the signing time recorded in the payload, if any.
+// Note that this is only a claim of the signer, as trustworthy as the signature of the payload.
+func (s *UntrustedSigstorePayload) UntrustedTimestamp() (time.Time, bool) {
+	if s.untrustedTimestamp == nil {
+		return time.Time{}, false
+	}
+	return time.Unix(*s.untrustedTimestamp, 0), true
+}
+
 // A compile-time check that UntrustedSigstorePayload and *UntrustedSigstorePayload implements json.Marshaler
 var _ json.Marshaler = UntrustedSigstorePayload{}
 var _ json.Marshaler = (*UntrustedSigstorePayload)(nil)
@@ -46,6 +46,14 @@ type signingMechanismWithPassphrase interface {
 	SignWithPassphrase(input []byte, keyIdentity string, passphrase string) ([]byte, error)
 }
 
+// signingMechanismWithKeyCheck is an internal extension of SigningMechanism.
+type signingMechanismWithKeyCheck interface {
+	SigningMechanism
+
+	// checkSigningKey returns nil if keyIdentity identifies a key which can be used for signing.
+	checkSigningKey(keyIdentity string) error
+}
+
 // SigningNotSupportedError is returned when trying to sign using a mechanism which does not support that.
 type SigningNotSupportedError string
 
@@ -122,6 +122,14 @@ func (m *gpgmeSigningMechanism) SupportsSigning() error {
 	return nil
 }
 
+// checkSigningKey returns nil if keyIdentity identifies a key which can be used for signing.
+func (m *gpgmeSigningMechanism) checkSigningKey(keyIdentity string) error {
+	if _, err := m.ctx.GetKey(keyIdentity, true); err != nil {
+		return fmt.Errorf("looking up signing key %q: %w", keyIdentity, err)
+	}
+	return nil
+}
+
 // Sign creates a (non-detached) signature of input using keyIdentity and passphrase.
 // Fails with a SigningNotSupportedError if the mechanism does not support signing.
 func (m *gpgmeSigningMechanism) SignWithPassphrase(input []byte, keyIdentity string, passphrase string) ([]byte, error) {
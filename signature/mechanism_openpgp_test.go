@@ -4,6 +4,7 @@
 package signature
 
 import (
+	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -27,3 +28,14 @@ func TestOpenpgpSigningMechanismSign(t *testing.T) {
 	assert.Error(t, err)
 	assert.IsType(t, SigningNotSupportedError(""), err)
 }
+
+func TestOpenpgpSignDockerManifest(t *testing.T) {
+	mech, _, err := NewEphemeralGPGSigningMechanism([]byte{})
+	require.NoError(t, err)
+	defer mech.Close()
+	manifest, err := os.ReadFile("fixtures/image.manifest.json")
+	require.NoError(t, err)
+	_, err = SignDockerManifest(manifest, TestImageSignatureReference, mech, TestKeyFingerprint)
+	assert.Error(t, err)
+	assert.IsType(t, SigningNotSupportedError(""), err)
+}
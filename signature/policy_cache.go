@@ -0,0 +1,66 @@
+package signature
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// policyCacheKey identifies a policy in policyCache.
+type policyCacheKey struct {
+	path        string        // The policy file, if bytesDigest is ""
+	bytesDigest digest.Digest // The digest of SystemContext.SignaturePolicyBytes, or ""
+	variables   string        // SystemContext.SignaturePolicyPathEnvironmentVariables, joined by "\n"
+}
+
+// policyCacheMutex is used to synchronize concurrent accesses to policyCache.
+var policyCacheMutex = sync.Mutex{}
+
+// policyCache caches policies loaded by CachedDefaultPolicy. Concurrent accesses to the cache
+// are synchronized via policyCacheMutex.
+var policyCache = map[policyCacheKey]*Policy{}
+
+// CachedDefaultPolicy returns the same policy as DefaultPolicy, but parses each policy file
+// (or SystemContext.SignaturePolicyBytes value) only once, and returns the cached policy afterwards.
+// The returned policy is shared with other callers, and must not be modified.
+//
+// Changes to the policy file, or to environment variables it refers to, are not noticed until InvalidatePolicyCache is called;
+// long-running processes should call it when they are notified that the policy may have changed (e.g. on SIGHUP).
+func CachedDefaultPolicy(sys *types.SystemContext) (*Policy, error) {
+	key := policyCacheKey{}
+	if sys != nil && sys.SignaturePolicyBytes != nil {
+		key.bytesDigest = digest.FromBytes(sys.SignaturePolicyBytes)
+	} else {
+		path, err := defaultPolicyPath(sys)
+		if err != nil {
+			return nil, err
+		}
+		key.path = path
+	}
+	if sys != nil {
+		key.variables = strings.Join(sys.SignaturePolicyPathEnvironmentVariables, "\n")
+	}
+
+	policyCacheMutex.Lock()
+	defer policyCacheMutex.Unlock()
+	if policy, ok := policyCache[key]; ok {
+		return policy, nil
+	}
+	policy, err := loadDefaultPolicy(sys, key.path)
+	if err != nil {
+		return nil, err
+	}
+	policyCache[key] = policy
+	return policy, nil
+}
+
+// InvalidatePolicyCache invalidates the policy cache used by CachedDefaultPolicy, so that policies are
+// read again on the next call. This function is meant to be used by long-running processes that need
+// to reload potential changes made to the policy files.
+func InvalidatePolicyCache() {
+	policyCacheMutex.Lock()
+	defer policyCacheMutex.Unlock()
+	policyCache = map[policyCacheKey]*Policy{}
+}
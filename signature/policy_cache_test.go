@@ -0,0 +1,76 @@
+package signature
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCachedDefaultPolicy(t *testing.T) {
+	InvalidatePolicyCache()
+	t.Cleanup(InvalidatePolicyCache)
+
+	rejectPolicy := &Policy{Default: PolicyRequirements{NewPRReject()}, Transports: map[string]PolicyTransportScopes{}}
+	acceptPolicy := &Policy{Default: PolicyRequirements{NewPRInsecureAcceptAnything()}, Transports: map[string]PolicyTransportScopes{}}
+
+	policyPath := filepath.Join(t.TempDir(), "policy.json")
+	err := os.WriteFile(policyPath, []byte(`{"default":[{"type":"reject"}]}`), 0o644)
+	require.NoError(t, err)
+	sys := &types.SystemContext{SignaturePolicyPath: policyPath}
+
+	policy, err := CachedDefaultPolicy(sys)
+	require.NoError(t, err)
+	assert.Equal(t, rejectPolicy, policy)
+
+	// A changed file is not re-read until the cache is invalidated
+	err = os.WriteFile(policyPath, []byte(`{"default":[{"type":"insecureAcceptAnything"}]}`), 0o644)
+	require.NoError(t, err)
+	policy2, err := CachedDefaultPolicy(sys)
+	require.NoError(t, err)
+	assert.Same(t, policy, policy2)
+	InvalidatePolicyCache()
+	policy, err = CachedDefaultPolicy(sys)
+	require.NoError(t, err)
+	assert.Equal(t, acceptPolicy, policy)
+
+	// In-memory policies are cached by their contents, separately from files
+	policy, err = CachedDefaultPolicy(&types.SystemContext{SignaturePolicyPath: policyPath, SignaturePolicyBytes: []byte(`{"default":[{"type":"reject"}]}`)})
+	require.NoError(t, err)
+	assert.Equal(t, rejectPolicy, policy)
+	policy, err = CachedDefaultPolicy(sys)
+	require.NoError(t, err)
+	assert.Equal(t, acceptPolicy, policy)
+
+	// Errors are not cached
+	missingPath := filepath.Join(t.TempDir(), "missing.json")
+	_, err = CachedDefaultPolicy(&types.SystemContext{SignaturePolicyPath: missingPath})
+	assert.Error(t, err)
+	err = os.WriteFile(missingPath, []byte(`{"default":[{"type":"reject"}]}`), 0o644)
+	require.NoError(t, err)
+	policy, err = CachedDefaultPolicy(&types.SystemContext{SignaturePolicyPath: missingPath})
+	require.NoError(t, err)
+	assert.Equal(t, rejectPolicy, policy)
+
+	// Concurrent users all get the same policy
+	InvalidatePolicyCache()
+	policies := make([]*Policy, 10)
+	wg := sync.WaitGroup{}
+	for i := range policies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			p, err := CachedDefaultPolicy(sys)
+			assert.NoError(t, err)
+			policies[i] = p
+		}(i)
+	}
+	wg.Wait()
+	for _, p := range policies {
+		assert.Same(t, policies[0], p)
+	}
+}
@@ -19,14 +19,17 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 
 	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/set"
 	"github.com/containers/image/v5/signature/internal"
 	"github.com/containers/image/v5/transports"
 	"github.com/containers/image/v5/types"
 	"github.com/containers/storage/pkg/fileutils"
 	"github.com/containers/storage/pkg/homedir"
 	"github.com/containers/storage/pkg/regexp"
+	digest "github.com/opencontainers/go-digest"
 )
 
 // systemDefaultPolicyPath is the policy path used for DefaultPolicy().
@@ -47,15 +50,47 @@ func (err InvalidPolicyFormatError) Error() string {
 // DefaultPolicy returns the default policy of the system.
 // Most applications should be using this method to get the policy configured
 // by the system administrator.
-// sys should usually be nil, can be set to override the default.
+// sys should usually be nil, can be set to override the default;
+// sys.SignaturePolicyBytes, if set, takes precedence over sys.SignaturePolicyPath.
 // NOTE: When this function returns an error, report it to the user and abort.
 // DO NOT hard-code fallback policies in your application.
 func DefaultPolicy(sys *types.SystemContext) (*Policy, error) {
-	policyPath, err := defaultPolicyPath(sys)
-	if err != nil {
-		return nil, err
+	policyPath := ""
+	if sys == nil || sys.SignaturePolicyBytes == nil {
+		p, err := defaultPolicyPath(sys)
+		if err != nil {
+			return nil, err
+		}
+		policyPath = p
+	}
+	return loadDefaultPolicy(sys, policyPath)
+}
+
+// loadDefaultPolicy implements DefaultPolicy, reading the policy from policyPath unless sys.SignaturePolicyBytes is set.
+func loadDefaultPolicy(sys *types.SystemContext, policyPath string) (*Policy, error) {
+	var policy *Policy
+	var policyOrigin string // A description of the policy source, for error messages
+	if sys != nil && sys.SignaturePolicyBytes != nil {
+		policyOrigin = "SystemContext.SignaturePolicyBytes"
+		p, err := NewPolicyFromBytes(sys.SignaturePolicyBytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid policy in %s: %w", policyOrigin, err)
+		}
+		policy = p
+	} else {
+		policyOrigin = fmt.Sprintf("%q", policyPath)
+		p, err := NewPolicyFromFile(policyPath)
+		if err != nil {
+			return nil, err
+		}
+		policy = p
 	}
-	return NewPolicyFromFile(policyPath)
+	if sys != nil && len(sys.SignaturePolicyPathEnvironmentVariables) > 0 {
+		if err := expandPolicyPaths(policy, sys.SignaturePolicyPathEnvironmentVariables); err != nil {
+			return nil, fmt.Errorf("invalid policy in %s: %w", policyOrigin, err)
+		}
+	}
+	return policy, nil
 }
 
 // defaultPolicyPath returns a path to the relevant policy of the system, or an error if the policy is missing.
@@ -109,6 +144,82 @@ func NewPolicyFromBytes(data []byte) (*Policy, error) {
 	return &p, nil
 }
 
+// Merge returns a new policy consisting of p, with requirements from other layered on top:
+// other.Default replaces p.Default if it is non-empty, and each transport scope present in other
+// replaces the same scope of p; scopes only present in p are preserved.
+// Requirements of p which reject all images can only be replaced by requirements which also reject all images:
+// such conflicting merges fail, so that other can not loosen the rejections of p.
+// A nil p is treated as an empty policy.
+// Neither p nor other is modified (but the returned policy shares PolicyRequirement values with them).
+func (p *Policy) Merge(other *Policy) (*Policy, error) {
+	if other == nil {
+		return nil, errors.New("merging with a nil policy")
+	}
+	if p == nil {
+		p = &Policy{}
+	}
+
+	res := &Policy{
+		Default:    slices.Clone(p.Default),
+		Transports: map[string]PolicyTransportScopes{},
+	}
+	if len(other.Default) > 0 {
+		if err := checkMergedRequirements(p.Default, other.Default); err != nil {
+			return nil, InvalidPolicyFormatError(fmt.Sprintf("Conflicting default policy: %v", err))
+		}
+		res.Default = slices.Clone(other.Default)
+	}
+	if len(res.Default) == 0 {
+		return nil, InvalidPolicyFormatError("Default policy is missing")
+	}
+	for transportName, scopes := range p.Transports {
+		resScopes := make(PolicyTransportScopes, len(scopes))
+		for scope, reqs := range scopes {
+			resScopes[scope] = slices.Clone(reqs)
+		}
+		res.Transports[transportName] = resScopes
+	}
+	for transportName, scopes := range other.Transports {
+		transport := transports.Get(transportName) // May be nil, as in policyTransportsMap.UnmarshalJSON
+		resScopes, ok := res.Transports[transportName]
+		if !ok {
+			resScopes = make(PolicyTransportScopes, len(scopes))
+			res.Transports[transportName] = resScopes
+		}
+		for scope, reqs := range scopes {
+			if len(reqs) == 0 {
+				return nil, InvalidPolicyFormatError(fmt.Sprintf("List of verification policy requirements for transport %q scope %q must not be empty", transportName, scope))
+			}
+			if scope != "" && transport != nil {
+				if err := transport.ValidatePolicyConfigurationScope(scope); err != nil {
+					return nil, InvalidPolicyFormatError(fmt.Sprintf("Invalid scope %q for transport %q: %v", scope, transportName, err))
+				}
+			}
+			if err := checkMergedRequirements(resScopes[scope], reqs); err != nil {
+				return nil, InvalidPolicyFormatError(fmt.Sprintf("Conflicting policy for transport %q scope %q: %v", transportName, scope, err))
+			}
+			resScopes[scope] = slices.Clone(reqs)
+		}
+	}
+	return res, nil
+}
+
+// checkMergedRequirements returns an error if replacing base with overlay in Policy.Merge would loosen a rejection in base.
+func checkMergedRequirements(base, overlay PolicyRequirements) error {
+	if requirementsReject(base) && !requirementsReject(overlay) {
+		return errors.New("requirements which reject all images can not be replaced by less strict ones")
+	}
+	return nil
+}
+
+// requirementsReject returns true if reqs contains a requirement which rejects all images.
+func requirementsReject(reqs PolicyRequirements) bool {
+	return slices.ContainsFunc(reqs, func(req PolicyRequirement) bool {
+		_, ok := req.(*prReject)
+		return ok
+	})
+}
+
 // Compile-time check that Policy implements json.Unmarshaler.
 var _ json.Unmarshaler = (*Policy)(nil)
 
@@ -257,6 +368,12 @@ func newPolicyRequirementFromJSON(data []byte) (PolicyRequirement, error) {
 		res = &prSignedBaseLayer{}
 	case prTypeSigstoreSigned:
 		res = &prSigstoreSigned{}
+	case prTypeAllowlistByDigest:
+		res = &prAllowlistByDigest{}
+	case prTypeAppliesToManifestKind:
+		res = &prAppliesToManifestKind{}
+	case prTypeAnyOf:
+		res = &prAnyOf{}
 	default:
 		return nil, InvalidPolicyFormatError(fmt.Sprintf("Unknown policy requirement type %q", typeField.Type))
 	}
@@ -530,6 +647,232 @@ func (pr *prSignedBaseLayer) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// newPRAllowlistByDigest returns a new prAllowlistByDigest if parameters are valid.
+func newPRAllowlistByDigest(digests []digest.Digest, digestsPath string) (*prAllowlistByDigest, error) {
+	switch {
+	case digests != nil && digestsPath == "":
+		if err := validateDigestAllowlist(digests); err != nil {
+			return nil, err
+		}
+	case digests == nil && digestsPath != "":
+	default:
+		return nil, InvalidPolicyFormatError("exactly one of digests and digestsPath must be specified")
+	}
+	return &prAllowlistByDigest{
+		prCommon:    prCommon{Type: prTypeAllowlistByDigest},
+		Digests:     digests,
+		DigestsPath: digestsPath,
+	}, nil
+}
+
+// validateDigestAllowlist returns an error if digests is not a valid, non-empty set of digests.
+func validateDigestAllowlist(digests []digest.Digest) error {
+	if len(digests) == 0 {
+		return InvalidPolicyFormatError("digest allowlist must not be empty")
+	}
+	seen := set.New[digest.Digest]()
+	for _, d := range digests {
+		if err := d.Validate(); err != nil {
+			return InvalidPolicyFormatError(fmt.Sprintf("invalid digest %q in allowlist: %v", d.String(), err))
+		}
+		if seen.Contains(d) {
+			return InvalidPolicyFormatError(fmt.Sprintf("duplicate digest %s in allowlist", d.String()))
+		}
+		seen.Add(d)
+	}
+	return nil
+}
+
+// newPRAllowlistByDigestDigests is NewPRAllowlistByDigest, except it returns the private type.
+func newPRAllowlistByDigestDigests(digests []digest.Digest) (*prAllowlistByDigest, error) {
+	return newPRAllowlistByDigest(digests, "")
+}
+
+// NewPRAllowlistByDigest returns a new "allowlistByDigest" PolicyRequirement accepting the specified manifest digests.
+func NewPRAllowlistByDigest(digests []digest.Digest) (PolicyRequirement, error) {
+	return newPRAllowlistByDigestDigests(digests)
+}
+
+// newPRAllowlistByDigestPath is NewPRAllowlistByDigestPath, except it returns the private type.
+func newPRAllowlistByDigestPath(digestsPath string) (*prAllowlistByDigest, error) {
+	return newPRAllowlistByDigest(nil, digestsPath)
+}
+
+// NewPRAllowlistByDigestPath returns a new "allowlistByDigest" PolicyRequirement accepting manifest digests listed in digestsPath.
+func NewPRAllowlistByDigestPath(digestsPath string) (PolicyRequirement, error) {
+	return newPRAllowlistByDigestPath(digestsPath)
+}
+
+// Compile-time check that prAllowlistByDigest implements json.Unmarshaler.
+var _ json.Unmarshaler = (*prAllowlistByDigest)(nil)
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (pr *prAllowlistByDigest) UnmarshalJSON(data []byte) error {
+	*pr = prAllowlistByDigest{}
+	var tmp prAllowlistByDigest
+	var gotDigests, gotDigestsPath = false, false
+	if err := internal.ParanoidUnmarshalJSONObject(data, func(key string) any {
+		switch key {
+		case "type":
+			return &tmp.Type
+		case "digests":
+			gotDigests = true
+			return &tmp.Digests
+		case "digestsPath":
+			gotDigestsPath = true
+			return &tmp.DigestsPath
+		default:
+			return nil
+		}
+	}); err != nil {
+		return err
+	}
+
+	if tmp.Type != prTypeAllowlistByDigest {
+		return InvalidPolicyFormatError(fmt.Sprintf("Unexpected policy requirement type %q", tmp.Type))
+	}
+	var res *prAllowlistByDigest
+	var err error
+	switch {
+	case gotDigests && !gotDigestsPath:
+		res, err = newPRAllowlistByDigestDigests(tmp.Digests)
+	case !gotDigests && gotDigestsPath:
+		res, err = newPRAllowlistByDigestPath(tmp.DigestsPath)
+	case !gotDigests && !gotDigestsPath:
+		return InvalidPolicyFormatError("Exactly one of digests and digestsPath must be specified, none of them present")
+	default:
+		return InvalidPolicyFormatError("Exactly one of digests and digestsPath must be specified, both present")
+	}
+	if err != nil {
+		return err
+	}
+	*pr = *res
+	return nil
+}
+
+// IsValid checks that kind is a valid manifestKind value.
+func (kind manifestKind) IsValid() bool {
+	switch kind {
+	case ManifestKindImage, ManifestKindArtifact:
+		return true
+	default:
+		return false
+	}
+}
+
+// Compile-time check that manifestKind implements json.Unmarshaler.
+var _ json.Unmarshaler = (*manifestKind)(nil)
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (kind *manifestKind) UnmarshalJSON(data []byte) error {
+	*kind = manifestKind("")
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	if !manifestKind(s).IsValid() {
+		return InvalidPolicyFormatError(fmt.Sprintf("Unrecognized manifestKind value %q", s))
+	}
+	*kind = manifestKind(s)
+	return nil
+}
+
+// newPRAppliesToManifestKind is NewPRAppliesToManifestKind, except it returns the private type.
+func newPRAppliesToManifestKind(kind manifestKind, requirement PolicyRequirement) (*prAppliesToManifestKind, error) {
+	if !kind.IsValid() {
+		return nil, InvalidPolicyFormatError(fmt.Sprintf("invalid manifestKind %q", kind))
+	}
+	if requirement == nil {
+		return nil, InvalidPolicyFormatError("requirement not specified")
+	}
+	return &prAppliesToManifestKind{
+		prCommon:     prCommon{Type: prTypeAppliesToManifestKind},
+		ManifestKind: kind,
+		Requirement:  requirement,
+	}, nil
+}
+
+// NewPRAppliesToManifestKind returns a new "appliesToManifestKind" PolicyRequirement, which enforces requirement
+// only for manifests of the specified kind, and does not affect manifests of other kinds.
+func NewPRAppliesToManifestKind(kind manifestKind, requirement PolicyRequirement) (PolicyRequirement, error) {
+	return newPRAppliesToManifestKind(kind, requirement)
+}
+
+// Compile-time check that prAppliesToManifestKind implements json.Unmarshaler.
+var _ json.Unmarshaler = (*prAppliesToManifestKind)(nil)
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (pr *prAppliesToManifestKind) UnmarshalJSON(data []byte) error {
+	*pr = prAppliesToManifestKind{}
+	var tmp prAppliesToManifestKind
+	var requirement json.RawMessage
+	if err := internal.ParanoidUnmarshalJSONObjectExactFields(data, map[string]any{
+		"type":         &tmp.Type,
+		"manifestKind": &tmp.ManifestKind,
+		"requirement":  &requirement,
+	}); err != nil {
+		return err
+	}
+
+	if tmp.Type != prTypeAppliesToManifestKind {
+		return InvalidPolicyFormatError(fmt.Sprintf("Unexpected policy requirement type %q", tmp.Type))
+	}
+	req, err := newPolicyRequirementFromJSON(requirement)
+	if err != nil {
+		return err
+	}
+	res, err := newPRAppliesToManifestKind(tmp.ManifestKind, req)
+	if err != nil {
+		return err
+	}
+	*pr = *res
+	return nil
+}
+
+// newPRAnyOf is NewPRAnyOf, except it returns the private type.
+func newPRAnyOf(requirements PolicyRequirements) (*prAnyOf, error) {
+	if len(requirements) == 0 {
+		return nil, InvalidPolicyFormatError("requirements must not be empty")
+	}
+	if slices.Contains(requirements, nil) {
+		return nil, InvalidPolicyFormatError("requirements must not contain nil values")
+	}
+	return &prAnyOf{
+		prCommon:     prCommon{Type: prTypeAnyOf},
+		Requirements: requirements,
+	}, nil
+}
+
+// NewPRAnyOf returns a new "anyOf" PolicyRequirement, which accepts an image if at least one of requirements accepts it.
+func NewPRAnyOf(requirements PolicyRequirements) (PolicyRequirement, error) {
+	return newPRAnyOf(requirements)
+}
+
+// Compile-time check that prAnyOf implements json.Unmarshaler.
+var _ json.Unmarshaler = (*prAnyOf)(nil)
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (pr *prAnyOf) UnmarshalJSON(data []byte) error {
+	*pr = prAnyOf{}
+	var tmp prAnyOf
+	if err := internal.ParanoidUnmarshalJSONObjectExactFields(data, map[string]any{
+		"type":         &tmp.Type,
+		"requirements": &tmp.Requirements,
+	}); err != nil {
+		return err
+	}
+
+	if tmp.Type != prTypeAnyOf {
+		return InvalidPolicyFormatError(fmt.Sprintf("Unexpected policy requirement type %q", tmp.Type))
+	}
+	res, err := newPRAnyOf(tmp.Requirements)
+	if err != nil {
+		return err
+	}
+	*pr = *res
+	return nil
+}
+
 // newPolicyReferenceMatchFromJSON parses JSON data into a PolicyReferenceMatch implementation.
 func newPolicyReferenceMatchFromJSON(data []byte) (PolicyReferenceMatch, error) {
 	var typeField prmCommon
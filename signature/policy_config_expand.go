@@ -0,0 +1,123 @@
+// policy_config_expand.go implements the opt-in environment variable expansion in policy paths,
+// per types.SystemContext.SignaturePolicyPathEnvironmentVariables.
+
+package signature
+
+import (
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/containers/storage/pkg/regexp"
+)
+
+// environmentVariableReferenceRegexp matches $NAME and ${NAME}.
+var environmentVariableReferenceRegexp = regexp.Delayed(`\$(?:\{([A-Za-z_][A-Za-z0-9_]*)\}|([A-Za-z_][A-Za-z0-9_]*))`)
+
+// expandPolicyPaths expands references to the environment variables in allowedVariables,
+// in all file paths in policy, modifying it in place.
+// References to other variables are left unmodified.
+func expandPolicyPaths(policy *Policy, allowedVariables []string) error {
+	expand := func(path string) (string, error) {
+		var err error
+		res := environmentVariableReferenceRegexp.ReplaceAllStringFunc(path, func(ref string) string {
+			m := environmentVariableReferenceRegexp.FindStringSubmatch(ref)
+			name := m[1] + m[2] // Exactly one of them is set
+			if !slices.Contains(allowedVariables, name) {
+				return ref
+			}
+			value, ok := os.LookupEnv(name)
+			if !ok {
+				if err == nil {
+					err = fmt.Errorf("environment variable %s, used in policy path %q, is not set", name, path)
+				}
+				return ref
+			}
+			return value
+		})
+		if err != nil {
+			return "", err
+		}
+		return res, nil
+	}
+
+	if err := expandPolicyRequirementsPaths(policy.Default, expand); err != nil {
+		return err
+	}
+	for _, scopes := range policy.Transports {
+		for _, reqs := range scopes {
+			if err := expandPolicyRequirementsPaths(reqs, expand); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// expandPolicyRequirementsPaths expands all file paths in reqs using expand, modifying the requirements in place.
+func expandPolicyRequirementsPaths(reqs PolicyRequirements, expand func(string) (string, error)) error {
+	expandOne := func(path *string) error {
+		if *path == "" {
+			return nil
+		}
+		res, err := expand(*path)
+		if err != nil {
+			return err
+		}
+		*path = res
+		return nil
+	}
+	expandMany := func(paths []string) error {
+		for i := range paths {
+			if err := expandOne(&paths[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, req := range reqs {
+		switch req := req.(type) {
+		case *prSignedBy:
+			if err := expandOne(&req.KeyPath); err != nil {
+				return err
+			}
+			if err := expandMany(req.KeyPaths); err != nil {
+				return err
+			}
+		case *prSigstoreSigned:
+			if err := expandOne(&req.KeyPath); err != nil {
+				return err
+			}
+			if err := expandMany(req.KeyPaths); err != nil {
+				return err
+			}
+			if err := expandOne(&req.RekorPublicKeyPath); err != nil {
+				return err
+			}
+			if err := expandMany(req.RekorPublicKeyPaths); err != nil {
+				return err
+			}
+			if fulcio, ok := req.Fulcio.(*prSigstoreSignedFulcio); ok {
+				if err := expandOne(&fulcio.CAPath); err != nil {
+					return err
+				}
+			}
+		case *prAllowlistByDigest:
+			if err := expandOne(&req.DigestsPath); err != nil {
+				return err
+			}
+		case *prAppliesToManifestKind:
+			if err := expandPolicyRequirementsPaths(PolicyRequirements{req.Requirement}, expand); err != nil {
+				return err
+			}
+		case *prAnyOf:
+			if err := expandPolicyRequirementsPaths(req.Requirements, expand); err != nil {
+				return err
+			}
+		default:
+			// No file paths
+		}
+	}
+	return nil
+}
@@ -132,6 +132,48 @@ func PRSigstoreSignedWithSignedIdentity(signedIdentity PolicyReferenceMatch) PRS
 	}
 }
 
+// PRSigstoreSignedWithMaxSignatureAgeDays specifies a value for the "maxSignatureAgeDays" field when calling NewPRSigstoreSigned.
+func PRSigstoreSignedWithMaxSignatureAgeDays(days int) PRSigstoreSignedOption {
+	return func(pr *prSigstoreSigned) error {
+		if pr.MaxSignatureAgeDays != 0 {
+			return InvalidPolicyFormatError(`"maxSignatureAgeDays" already specified`)
+		}
+		if days <= 0 {
+			return InvalidPolicyFormatError(fmt.Sprintf(`"maxSignatureAgeDays" must be positive, not %d`, days))
+		}
+		pr.MaxSignatureAgeDays = days
+		return nil
+	}
+}
+
+// PRSigstoreSignedWithSignatureWithoutTimestamp specifies a value for the "signatureWithoutTimestamp" field when calling NewPRSigstoreSigned.
+func PRSigstoreSignedWithSignatureWithoutTimestamp(action sigstoreNoTimestampAction) PRSigstoreSignedOption {
+	return func(pr *prSigstoreSigned) error {
+		if pr.SignatureWithoutTimestamp != "" {
+			return InvalidPolicyFormatError(`"signatureWithoutTimestamp" already specified`)
+		}
+		if action != SigstoreNoTimestampReject && action != SigstoreNoTimestampAccept {
+			return InvalidPolicyFormatError(fmt.Sprintf(`Unknown "signatureWithoutTimestamp" value %q`, action))
+		}
+		pr.SignatureWithoutTimestamp = action
+		return nil
+	}
+}
+
+// PRSigstoreSignedWithManifestCanonicalization specifies a value for the "manifestCanonicalization" field when calling NewPRSigstoreSigned.
+func PRSigstoreSignedWithManifestCanonicalization(canonicalization sigstoreManifestCanonicalization) PRSigstoreSignedOption {
+	return func(pr *prSigstoreSigned) error {
+		if pr.ManifestCanonicalization != "" {
+			return InvalidPolicyFormatError(`"manifestCanonicalization" already specified`)
+		}
+		if canonicalization != SigstoreManifestCanonicalizationNone && canonicalization != SigstoreManifestCanonicalizationJSON {
+			return InvalidPolicyFormatError(fmt.Sprintf(`Unknown "manifestCanonicalization" value %q`, canonicalization))
+		}
+		pr.ManifestCanonicalization = canonicalization
+		return nil
+	}
+}
+
 // newPRSigstoreSigned is NewPRSigstoreSigned, except it returns the private type.
 func newPRSigstoreSigned(options ...PRSigstoreSignedOption) (*prSigstoreSigned, error) {
 	res := prSigstoreSigned{
@@ -187,6 +229,10 @@ func newPRSigstoreSigned(options ...PRSigstoreSignedOption) (*prSigstoreSigned,
 		return nil, InvalidPolicyFormatError("signedIdentity not specified")
 	}
 
+	if res.SignatureWithoutTimestamp != "" && res.MaxSignatureAgeDays == 0 {
+		return nil, InvalidPolicyFormatError("signatureWithoutTimestamp can only be specified together with maxSignatureAgeDays")
+	}
+
 	return &res, nil
 }
 
@@ -220,6 +266,7 @@ func (pr *prSigstoreSigned) UnmarshalJSON(data []byte) error {
 	var tmp prSigstoreSigned
 	var gotKeyPath, gotKeyPaths, gotKeyData, gotKeyDatas, gotFulcio bool
 	var gotRekorPublicKeyPath, gotRekorPublicKeyPaths, gotRekorPublicKeyData, gotRekorPublicKeyDatas bool
+	var gotMaxSignatureAgeDays, gotSignatureWithoutTimestamp, gotManifestCanonicalization bool
 	var fulcio prSigstoreSignedFulcio
 	var signedIdentity json.RawMessage
 	if err := internal.ParanoidUnmarshalJSONObject(data, func(key string) any {
@@ -255,6 +302,15 @@ func (pr *prSigstoreSigned) UnmarshalJSON(data []byte) error {
 			return &tmp.RekorPublicKeyDatas
 		case "signedIdentity":
 			return &signedIdentity
+		case "maxSignatureAgeDays":
+			gotMaxSignatureAgeDays = true
+			return &tmp.MaxSignatureAgeDays
+		case "signatureWithoutTimestamp":
+			gotSignatureWithoutTimestamp = true
+			return &tmp.SignatureWithoutTimestamp
+		case "manifestCanonicalization":
+			gotManifestCanonicalization = true
+			return &tmp.ManifestCanonicalization
 		default:
 			return nil
 		}
@@ -304,6 +360,15 @@ func (pr *prSigstoreSigned) UnmarshalJSON(data []byte) error {
 		opts = append(opts, PRSigstoreSignedWithRekorPublicKeyDatas(tmp.RekorPublicKeyDatas))
 	}
 	opts = append(opts, PRSigstoreSignedWithSignedIdentity(tmp.SignedIdentity))
+	if gotMaxSignatureAgeDays {
+		opts = append(opts, PRSigstoreSignedWithMaxSignatureAgeDays(tmp.MaxSignatureAgeDays))
+	}
+	if gotSignatureWithoutTimestamp {
+		opts = append(opts, PRSigstoreSignedWithSignatureWithoutTimestamp(tmp.SignatureWithoutTimestamp))
+	}
+	if gotManifestCanonicalization {
+		opts = append(opts, PRSigstoreSignedWithManifestCanonicalization(tmp.ManifestCanonicalization))
+	}
 
 	res, err := newPRSigstoreSigned(opts...)
 	if err != nil {
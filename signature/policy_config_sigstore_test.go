@@ -305,6 +305,46 @@ func TestNewPRSigstoreSigned(t *testing.T) {
 			PRSigstoreSignedWithSignedIdentity(testIdentity),
 			PRSigstoreSignedWithSignedIdentity(newPRMMatchRepository()),
 		},
+		{ // Non-positive maxSignatureAgeDays
+			PRSigstoreSignedWithKeyPath(testKeyPath),
+			PRSigstoreSignedWithSignedIdentity(testIdentity),
+			PRSigstoreSignedWithMaxSignatureAgeDays(0),
+		},
+		{ // Duplicate maxSignatureAgeDays
+			PRSigstoreSignedWithKeyPath(testKeyPath),
+			PRSigstoreSignedWithSignedIdentity(testIdentity),
+			PRSigstoreSignedWithMaxSignatureAgeDays(30),
+			PRSigstoreSignedWithMaxSignatureAgeDays(60),
+		},
+		{ // Invalid signatureWithoutTimestamp
+			PRSigstoreSignedWithKeyPath(testKeyPath),
+			PRSigstoreSignedWithSignedIdentity(testIdentity),
+			PRSigstoreSignedWithMaxSignatureAgeDays(30),
+			PRSigstoreSignedWithSignatureWithoutTimestamp("this is invalid"),
+		},
+		{ // Duplicate signatureWithoutTimestamp
+			PRSigstoreSignedWithKeyPath(testKeyPath),
+			PRSigstoreSignedWithSignedIdentity(testIdentity),
+			PRSigstoreSignedWithMaxSignatureAgeDays(30),
+			PRSigstoreSignedWithSignatureWithoutTimestamp(SigstoreNoTimestampAccept),
+			PRSigstoreSignedWithSignatureWithoutTimestamp(SigstoreNoTimestampReject),
+		},
+		{ // signatureWithoutTimestamp without maxSignatureAgeDays
+			PRSigstoreSignedWithKeyPath(testKeyPath),
+			PRSigstoreSignedWithSignedIdentity(testIdentity),
+			PRSigstoreSignedWithSignatureWithoutTimestamp(SigstoreNoTimestampAccept),
+		},
+		{ // Invalid manifestCanonicalization
+			PRSigstoreSignedWithKeyPath(testKeyPath),
+			PRSigstoreSignedWithSignedIdentity(testIdentity),
+			PRSigstoreSignedWithManifestCanonicalization("this is invalid"),
+		},
+		{ // Duplicate manifestCanonicalization
+			PRSigstoreSignedWithKeyPath(testKeyPath),
+			PRSigstoreSignedWithSignedIdentity(testIdentity),
+			PRSigstoreSignedWithManifestCanonicalization(SigstoreManifestCanonicalizationJSON),
+			PRSigstoreSignedWithManifestCanonicalization(SigstoreManifestCanonicalizationNone),
+		},
 	} {
 		_, err = newPRSigstoreSigned(c...)
 		assert.Error(t, err)
@@ -432,10 +472,37 @@ func TestPRSigstoreSignedUnmarshalJSON(t *testing.T) {
 			func(v mSA) { v["signedIdentity"] = "this is invalid" },
 			// "signedIdentity" an explicit nil
 			func(v mSA) { v["signedIdentity"] = nil },
+			// Invalid "maxSignatureAgeDays" field
+			func(v mSA) { v["maxSignatureAgeDays"] = "30" },
+			func(v mSA) { v["maxSignatureAgeDays"] = 0 },
+			func(v mSA) { v["maxSignatureAgeDays"] = -1 },
+			// "signatureWithoutTimestamp" without "maxSignatureAgeDays"
+			func(v mSA) { v["signatureWithoutTimestamp"] = "accept" },
+			// Invalid "signatureWithoutTimestamp" field
+			func(v mSA) { v["maxSignatureAgeDays"] = 30; v["signatureWithoutTimestamp"] = 1 },
+			func(v mSA) { v["maxSignatureAgeDays"] = 30; v["signatureWithoutTimestamp"] = "this is invalid" },
+			// Invalid "manifestCanonicalization" field
+			func(v mSA) { v["manifestCanonicalization"] = 1 },
+			func(v mSA) { v["manifestCanonicalization"] = "this is invalid" },
 		},
 		duplicateFields: []string{"type", "keyData", "signedIdentity"},
 	}
 	keyDataTests.run(t)
+	// Test maxSignatureAgeDays, signatureWithoutTimestamp and manifestCanonicalization duplicate fields
+	policyJSONUmarshallerTests[PolicyRequirement]{
+		newDest: func() json.Unmarshaler { return &prSigstoreSigned{} },
+		newValidObject: func() (PolicyRequirement, error) {
+			return NewPRSigstoreSigned(
+				PRSigstoreSignedWithKeyPath("/foo/bar"),
+				PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepoDigestOrExact()),
+				PRSigstoreSignedWithMaxSignatureAgeDays(30),
+				PRSigstoreSignedWithSignatureWithoutTimestamp(SigstoreNoTimestampAccept),
+				PRSigstoreSignedWithManifestCanonicalization(SigstoreManifestCanonicalizationJSON),
+			)
+		},
+		otherJSONParser: newPolicyRequirementFromJSON,
+		duplicateFields: []string{"type", "keyPath", "signedIdentity", "maxSignatureAgeDays", "signatureWithoutTimestamp", "manifestCanonicalization"},
+	}.run(t)
 	// Test keyPath and keyPath-specific duplicate fields
 	policyJSONUmarshallerTests[PolicyRequirement]{
 		newDest: func() json.Unmarshaler { return &prSigstoreSigned{} },
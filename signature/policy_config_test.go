@@ -14,6 +14,7 @@ import (
 	// this import is needed  where we use the "atomic" transport in TestPolicyUnmarshalJSON
 	_ "github.com/containers/image/v5/openshift"
 	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -144,6 +145,105 @@ func TestDefaultPolicy(t *testing.T) {
 		assert.Error(t, err)
 		assert.Nil(t, policy)
 	}
+
+	// In-memory policy, taking precedence over SignaturePolicyPath
+	policyBytes, err := os.ReadFile("./fixtures/policy.json")
+	require.NoError(t, err)
+	for _, path := range []string{"", "/this/does/not/exist"} {
+		policy, err := DefaultPolicy(&types.SystemContext{SignaturePolicyPath: path, SignaturePolicyBytes: policyBytes})
+		require.NoError(t, err, path)
+		assert.Equal(t, policyFixtureContents, policy, path)
+	}
+	policy, err = DefaultPolicy(&types.SystemContext{
+		SignaturePolicyPath:  "./fixtures/policy.json",
+		SignaturePolicyBytes: []byte(`{"default":[{"type":"reject"}]}`),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &Policy{Default: PolicyRequirements{NewPRReject()}, Transports: map[string]PolicyTransportScopes{}}, policy)
+
+	// Invalid in-memory policy; an empty, but non-nil, value is not ignored.
+	for _, data := range [][]byte{{}, []byte("this is invalid")} {
+		policy, err := DefaultPolicy(&types.SystemContext{SignaturePolicyPath: "./fixtures/policy.json", SignaturePolicyBytes: data})
+		assert.Error(t, err, string(data))
+		assert.Nil(t, policy, string(data))
+	}
+}
+
+func TestDefaultPolicyPathEnvironmentVariables(t *testing.T) {
+	policyPath := filepath.Join(t.TempDir(), "policy.json")
+	err := os.WriteFile(policyPath, []byte(`{
+		"default": [{"type": "signedBy", "keyType": "GPGKeys", "keyPath": "$CERTS_DIR/default.gpg"}],
+		"transports": {
+			"docker": {
+				"example.com/paths": [
+					{"type": "signedBy", "keyType": "GPGKeys", "keyPaths": ["${CERTS_DIR}/a.gpg", "$OTHER_DIR/b.gpg"]},
+					{"type": "allowlistByDigest", "digestsPath": "$CERTS_DIR/digests"}
+				],
+				"example.com/sigstore": [
+					{
+						"type": "sigstoreSigned",
+						"fulcio": {"caPath": "$CERTS_DIR/fulcio.pem", "oidcIssuer": "https://example.com", "subjectEmail": "user@example.com"},
+						"rekorPublicKeyPath": "$CERTS_DIR/rekor.pub"
+					}
+				]
+			}
+		}
+	}`), 0o644)
+	require.NoError(t, err)
+	t.Setenv("CERTS_DIR", "/certs")
+	t.Setenv("OTHER_DIR", "/other")
+
+	// Expansion enabled
+	policy, err := DefaultPolicy(&types.SystemContext{
+		SignaturePolicyPath:                     policyPath,
+		SignaturePolicyPathEnvironmentVariables: []string{"CERTS_DIR"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, PolicyRequirements{
+		xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "/certs/default.gpg", NewPRMMatchRepoDigestOrExact()),
+	}, policy.Default)
+	pr, err := NewPRAllowlistByDigestPath("/certs/digests")
+	require.NoError(t, err)
+	assert.Equal(t, PolicyRequirements{
+		// Only the allowed variable is expanded
+		xNewPRSignedByKeyPaths(SBKeyTypeGPGKeys, []string{"/certs/a.gpg", "$OTHER_DIR/b.gpg"}, NewPRMMatchRepoDigestOrExact()),
+		pr,
+	}, policy.Transports["docker"]["example.com/paths"])
+	fulcio, err := NewPRSigstoreSignedFulcio(
+		PRSigstoreSignedFulcioWithCAPath("/certs/fulcio.pem"),
+		PRSigstoreSignedFulcioWithOIDCIssuer("https://example.com"),
+		PRSigstoreSignedFulcioWithSubjectEmail("user@example.com"),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, PolicyRequirements{
+		xNewPRSigstoreSigned(
+			PRSigstoreSignedWithFulcio(fulcio),
+			PRSigstoreSignedWithRekorPublicKeyPath("/certs/rekor.pub"),
+			PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepoDigestOrExact()),
+		),
+	}, policy.Transports["docker"]["example.com/sigstore"])
+
+	// Expansion disabled
+	policy, err = DefaultPolicy(&types.SystemContext{SignaturePolicyPath: policyPath})
+	require.NoError(t, err)
+	assert.Equal(t, PolicyRequirements{
+		xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "$CERTS_DIR/default.gpg", NewPRMMatchRepoDigestOrExact()),
+	}, policy.Default)
+	assert.Equal(t, "${CERTS_DIR}/a.gpg", policy.Transports["docker"]["example.com/paths"][0].(*prSignedBy).KeyPaths[0])
+
+	// An allowed variable is not set
+	_, err = DefaultPolicy(&types.SystemContext{
+		SignaturePolicyPath:                     policyPath,
+		SignaturePolicyPathEnvironmentVariables: []string{"CERTS_DIR", "OTHER_DIR", "UNSET_DIR"},
+	})
+	require.NoError(t, err)
+	t.Setenv("OTHER_DIR", "")
+	os.Unsetenv("OTHER_DIR")
+	_, err = DefaultPolicy(&types.SystemContext{
+		SignaturePolicyPath:                     policyPath,
+		SignaturePolicyPathEnvironmentVariables: []string{"CERTS_DIR", "OTHER_DIR"},
+	})
+	assert.Error(t, err)
 }
 
 func TestDefaultPolicyPath(t *testing.T) {
@@ -285,6 +385,99 @@ func TestNewPolicyFromBytes(t *testing.T) {
 	assert.IsType(t, InvalidPolicyFormatError(""), err)
 }
 
+func TestPolicyMerge(t *testing.T) {
+	base := &Policy{
+		Default: PolicyRequirements{NewPRInsecureAcceptAnything()},
+		Transports: map[string]PolicyTransportScopes{
+			"docker": {
+				"example.com":         PolicyRequirements{NewPRInsecureAcceptAnything()},
+				"example.com/private": PolicyRequirements{NewPRReject()},
+			},
+		},
+	}
+
+	// Overlapping policies
+	other := &Policy{
+		Default: PolicyRequirements{NewPRReject()},
+		Transports: map[string]PolicyTransportScopes{
+			"docker": {
+				"example.com":         PolicyRequirements{NewPRReject()},
+				"example.com/private": PolicyRequirements{NewPRReject()},
+				"example.org":         PolicyRequirements{NewPRInsecureAcceptAnything()},
+			},
+		},
+	}
+	merged, err := base.Merge(other)
+	require.NoError(t, err)
+	assert.Equal(t, &Policy{
+		Default: PolicyRequirements{NewPRReject()},
+		Transports: map[string]PolicyTransportScopes{
+			"docker": {
+				"example.com":         PolicyRequirements{NewPRReject()},
+				"example.com/private": PolicyRequirements{NewPRReject()},
+				"example.org":         PolicyRequirements{NewPRInsecureAcceptAnything()},
+			},
+		},
+	}, merged)
+	// The inputs are not modified
+	assert.Equal(t, PolicyRequirements{NewPRInsecureAcceptAnything()}, base.Default)
+	assert.Equal(t, PolicyRequirements{NewPRInsecureAcceptAnything()}, base.Transports["docker"]["example.com"])
+	assert.Len(t, base.Transports["docker"], 2)
+
+	// Disjoint policies, other without a default
+	other = &Policy{
+		Transports: map[string]PolicyTransportScopes{
+			"dir": {
+				"": PolicyRequirements{NewPRInsecureAcceptAnything()},
+			},
+		},
+	}
+	merged, err = base.Merge(other)
+	require.NoError(t, err)
+	assert.Equal(t, &Policy{
+		Default: PolicyRequirements{NewPRInsecureAcceptAnything()},
+		Transports: map[string]PolicyTransportScopes{
+			"docker": {
+				"example.com":         PolicyRequirements{NewPRInsecureAcceptAnything()},
+				"example.com/private": PolicyRequirements{NewPRReject()},
+			},
+			"dir": {
+				"": PolicyRequirements{NewPRInsecureAcceptAnything()},
+			},
+		},
+	}, merged)
+	_, ok := base.Transports["dir"]
+	assert.False(t, ok)
+
+	// Merging into a policy without a default, or a nil policy
+	for _, p := range []*Policy{{}, nil} {
+		merged, err = p.Merge(base)
+		require.NoError(t, err)
+		assert.Equal(t, base, merged)
+	}
+
+	// Incompatible merges
+	for _, c := range []struct {
+		base, other *Policy
+	}{
+		{base, nil},
+		// No default in either policy
+		{&Policy{}, &Policy{}},
+		{nil, &Policy{}},
+		// Empty list of requirements for a scope
+		{base, &Policy{Transports: map[string]PolicyTransportScopes{"docker": {"example.com": PolicyRequirements{}}}}},
+		// Scope invalid for the transport
+		{base, &Policy{Transports: map[string]PolicyTransportScopes{"dir": {"relative/path": PolicyRequirements{NewPRReject()}}}}},
+		// A rejected scope replaced by less strict requirements
+		{base, &Policy{Transports: map[string]PolicyTransportScopes{"docker": {"example.com/private": PolicyRequirements{NewPRInsecureAcceptAnything()}}}}},
+		// A rejecting default replaced by a less strict one
+		{&Policy{Default: PolicyRequirements{NewPRReject()}}, &Policy{Default: PolicyRequirements{NewPRInsecureAcceptAnything()}}},
+	} {
+		_, err := c.base.Merge(c.other)
+		assert.Error(t, err)
+	}
+}
+
 // FIXME? There is quite a bit of duplication below. Factor some of it out?
 
 // jsonUnmarshalFromObject is like json.Unmarshal(), but the input is an arbitrary object
@@ -1038,6 +1231,253 @@ func TestPRSignedBaseLayerUnmarshalJSON(t *testing.T) {
 	}.run(t)
 }
 
+func TestNewPRAllowlistByDigest(t *testing.T) {
+	digests := []digest.Digest{TestImageManifestDigest, digest.FromString("other")}
+
+	// Success
+	_pr, err := NewPRAllowlistByDigest(digests)
+	require.NoError(t, err)
+	pr, ok := _pr.(*prAllowlistByDigest)
+	require.True(t, ok)
+	assert.Equal(t, &prAllowlistByDigest{
+		prCommon: prCommon{prTypeAllowlistByDigest},
+		Digests:  digests,
+	}, pr)
+
+	// Invalid digests
+	for _, invalid := range [][]digest.Digest{
+		nil,
+		{},
+		{"this is invalid"},
+		{TestImageManifestDigest, TestImageManifestDigest},
+	} {
+		_, err = NewPRAllowlistByDigest(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestNewPRAllowlistByDigestPath(t *testing.T) {
+	const testPath = "/foo/bar"
+
+	// Success
+	_pr, err := NewPRAllowlistByDigestPath(testPath)
+	require.NoError(t, err)
+	pr, ok := _pr.(*prAllowlistByDigest)
+	require.True(t, ok)
+	assert.Equal(t, &prAllowlistByDigest{
+		prCommon:    prCommon{prTypeAllowlistByDigest},
+		DigestsPath: testPath,
+	}, pr)
+
+	// Invalid path
+	_, err = NewPRAllowlistByDigestPath("")
+	assert.Error(t, err)
+}
+
+func TestPRAllowlistByDigestUnmarshalJSON(t *testing.T) {
+	for _, c := range []struct {
+		newValidObject  func() (PolicyRequirement, error)
+		breakFns        []func(mSA)
+		duplicateFields []string
+	}{
+		{ // digests
+			newValidObject: func() (PolicyRequirement, error) {
+				return NewPRAllowlistByDigest([]digest.Digest{TestImageManifestDigest})
+			},
+			breakFns: []func(mSA){
+				// Invalid "digests" field
+				func(v mSA) { v["digests"] = 1 },
+				func(v mSA) { v["digests"] = []string{} },
+				func(v mSA) { v["digests"] = nil },
+				func(v mSA) { v["digests"] = []string{"this is invalid"} },
+				// Duplicate digests
+				func(v mSA) { v["digests"] = []digest.Digest{TestImageManifestDigest, TestImageManifestDigest} },
+				// Both "digests" and "digestsPath" present
+				func(v mSA) { v["digestsPath"] = "/foo/bar" },
+			},
+			duplicateFields: []string{"type", "digests"},
+		},
+		{ // digestsPath
+			newValidObject: func() (PolicyRequirement, error) {
+				return NewPRAllowlistByDigestPath("/foo/bar")
+			},
+			breakFns: []func(mSA){
+				// Invalid "digestsPath" field
+				func(v mSA) { v["digestsPath"] = 1 },
+				func(v mSA) { v["digestsPath"] = "" },
+				// Both "digests" and "digestsPath" present
+				func(v mSA) { v["digests"] = []digest.Digest{TestImageManifestDigest} },
+			},
+			duplicateFields: []string{"type", "digestsPath"},
+		},
+	} {
+		policyJSONUmarshallerTests[PolicyRequirement]{
+			newDest:         func() json.Unmarshaler { return &prAllowlistByDigest{} },
+			newValidObject:  c.newValidObject,
+			otherJSONParser: newPolicyRequirementFromJSON,
+			breakFns: append([]func(mSA){
+				// The "type" field is missing
+				func(v mSA) { delete(v, "type") },
+				// Wrong "type" field
+				func(v mSA) { v["type"] = 1 },
+				func(v mSA) { v["type"] = "this is invalid" },
+				// Extra top-level sub-object
+				func(v mSA) { v["unexpected"] = 1 },
+				// Neither "digests" nor "digestsPath" present
+				func(v mSA) { delete(v, "digests"); delete(v, "digestsPath") },
+			}, c.breakFns...),
+			duplicateFields: c.duplicateFields,
+		}.run(t)
+	}
+}
+
+func TestManifestKindIsValid(t *testing.T) {
+	// Valid values
+	for _, s := range []manifestKind{
+		ManifestKindImage,
+		ManifestKindArtifact,
+	} {
+		assert.True(t, s.IsValid())
+	}
+
+	// Invalid values
+	for _, s := range []string{"", "this is invalid"} {
+		assert.False(t, manifestKind(s).IsValid())
+	}
+}
+
+func TestManifestKindUnmarshalJSON(t *testing.T) {
+	var kind manifestKind
+
+	testInvalidJSONInput(t, &kind)
+
+	// Valid values.
+	for _, v := range []manifestKind{
+		ManifestKindImage,
+		ManifestKindArtifact,
+	} {
+		kind = manifestKind("")
+		err := json.Unmarshal([]byte(`"`+string(v)+`"`), &kind)
+		assert.NoError(t, err)
+		assert.Equal(t, v, kind)
+	}
+
+	// Invalid values
+	for _, v := range []string{`""`, `"this is invalid"`} {
+		kind = manifestKind("")
+		err := json.Unmarshal([]byte(v), &kind)
+		assert.Error(t, err, v)
+	}
+}
+
+func TestNewPRAppliesToManifestKind(t *testing.T) {
+	testReq := NewPRReject()
+
+	// Success
+	_pr, err := NewPRAppliesToManifestKind(ManifestKindArtifact, testReq)
+	require.NoError(t, err)
+	pr, ok := _pr.(*prAppliesToManifestKind)
+	require.True(t, ok)
+	assert.Equal(t, &prAppliesToManifestKind{
+		prCommon:     prCommon{prTypeAppliesToManifestKind},
+		ManifestKind: ManifestKindArtifact,
+		Requirement:  testReq,
+	}, pr)
+
+	// Invalid manifestKind
+	_, err = NewPRAppliesToManifestKind(manifestKind("this is invalid"), testReq)
+	assert.Error(t, err)
+
+	// Invalid requirement
+	_, err = NewPRAppliesToManifestKind(ManifestKindImage, nil)
+	assert.Error(t, err)
+}
+
+func TestPRAppliesToManifestKindUnmarshalJSON(t *testing.T) {
+	policyJSONUmarshallerTests[PolicyRequirement]{
+		newDest: func() json.Unmarshaler { return &prAppliesToManifestKind{} },
+		newValidObject: func() (PolicyRequirement, error) {
+			return NewPRAppliesToManifestKind(ManifestKindImage, NewPRReject())
+		},
+		otherJSONParser: newPolicyRequirementFromJSON,
+		breakFns: []func(mSA){
+			// The "type" field is missing
+			func(v mSA) { delete(v, "type") },
+			// Wrong "type" field
+			func(v mSA) { v["type"] = 1 },
+			func(v mSA) { v["type"] = "this is invalid" },
+			// Extra top-level sub-object
+			func(v mSA) { v["unexpected"] = 1 },
+			// The "manifestKind" field is missing
+			func(v mSA) { delete(v, "manifestKind") },
+			// Invalid "manifestKind" field
+			func(v mSA) { v["manifestKind"] = 1 },
+			func(v mSA) { v["manifestKind"] = "this is invalid" },
+			// The "requirement" field is missing
+			func(v mSA) { delete(v, "requirement") },
+			// Invalid "requirement" field
+			func(v mSA) { v["requirement"] = "this is invalid" },
+			func(v mSA) { v["requirement"] = nil },
+			func(v mSA) { v["requirement"] = mSA{"type": "this is invalid"} },
+		},
+		duplicateFields: []string{"type", "manifestKind", "requirement"},
+	}.run(t)
+}
+
+func TestNewPRAnyOf(t *testing.T) {
+	testReqs := PolicyRequirements{NewPRReject(), NewPRInsecureAcceptAnything()}
+
+	// Success
+	_pr, err := NewPRAnyOf(testReqs)
+	require.NoError(t, err)
+	pr, ok := _pr.(*prAnyOf)
+	require.True(t, ok)
+	assert.Equal(t, &prAnyOf{
+		prCommon:     prCommon{prTypeAnyOf},
+		Requirements: testReqs,
+	}, pr)
+
+	// Invalid requirements
+	for _, reqs := range []PolicyRequirements{
+		nil,
+		{},
+		{NewPRReject(), nil},
+	} {
+		_, err = NewPRAnyOf(reqs)
+		assert.Error(t, err)
+	}
+}
+
+func TestPRAnyOfUnmarshalJSON(t *testing.T) {
+	policyJSONUmarshallerTests[PolicyRequirement]{
+		newDest: func() json.Unmarshaler { return &prAnyOf{} },
+		newValidObject: func() (PolicyRequirement, error) {
+			return NewPRAnyOf(PolicyRequirements{
+				xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "/path/to/team-a.gpg", NewPRMMatchRepoDigestOrExact()),
+				xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "/path/to/team-b.gpg", NewPRMMatchRepoDigestOrExact()),
+			})
+		},
+		otherJSONParser: newPolicyRequirementFromJSON,
+		breakFns: []func(mSA){
+			// The "type" field is missing
+			func(v mSA) { delete(v, "type") },
+			// Wrong "type" field
+			func(v mSA) { v["type"] = 1 },
+			func(v mSA) { v["type"] = "this is invalid" },
+			// Extra top-level sub-object
+			func(v mSA) { v["unexpected"] = 1 },
+			// The "requirements" field is missing
+			func(v mSA) { delete(v, "requirements") },
+			// Invalid "requirements" field
+			func(v mSA) { v["requirements"] = "this is invalid" },
+			func(v mSA) { v["requirements"] = nil },
+			func(v mSA) { v["requirements"] = []any{} },
+			func(v mSA) { v["requirements"] = []any{mSA{"type": "this is invalid"}} },
+		},
+		duplicateFields: []string{"type", "requirements"},
+	}.run(t)
+}
+
 func TestNewPolicyReferenceMatchFromJSON(t *testing.T) {
 	// Sample success. Others tested in the individual PolicyReferenceMatch.UnmarshalJSON implementations.
 	validPRM := NewPRMMatchRepoDigestOrExact()
@@ -11,7 +11,9 @@ import (
 
 	"github.com/containers/image/v5/internal/private"
 	"github.com/containers/image/v5/internal/unparsedimage"
+	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/types"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/sirupsen/logrus"
 )
 
@@ -163,6 +165,30 @@ func (pc *PolicyContext) requirementsForImageRef(ref types.ImageReference) Polic
 	return pc.Policy.Default
 }
 
+// imageManifestKind returns the kind of the manifest of image, for requirements which only apply to some kinds.
+// A manifest is only an artifact if it can not be run as a container image: a single-image OCI manifest with a config
+// which is not an image config. Everything else, notably all manifest lists and indexes (which may refer to images even
+// if they declare an artifactType) and all non-OCI formats, is an image, so that an attacker can’t avoid requirements
+// which apply to images by adding an artifactType to an image.
+func imageManifestKind(ctx context.Context, image private.UnparsedImage) (manifestKind, error) {
+	m, mimeType, err := image.Manifest(ctx)
+	if err != nil {
+		return "", err
+	}
+	if manifest.NormalizedMIMEType(mimeType) == imgspecv1.MediaTypeImageManifest {
+		oci, err := manifest.OCI1FromManifest(m)
+		if err != nil {
+			return "", err
+		}
+		// Runtimes using this library refuse to run OCI manifests with other config types (see internal/image.manifestOCI1.OCIConfig);
+		// be conservative and also treat Docker image configs as image configs, in case other runtimes accept them.
+		if oci.Config.MediaType != imgspecv1.MediaTypeImageConfig && oci.Config.MediaType != manifest.DockerV2Schema2ConfigMediaType {
+			return ManifestKindArtifact, nil
+		}
+	}
+	return ManifestKindImage, nil
+}
+
 // GetSignaturesWithAcceptedAuthor returns those signatures from an image
 // for which the policy accepts the author (and which have been successfully
 // verified).
@@ -291,3 +317,59 @@ func (pc *PolicyContext) IsRunningImageAllowed(ctx context.Context, publicImage
 	logrus.Debugf("Overall: allowed")
 	return true, nil
 }
+
+// RequirementEvaluation is the result of evaluating a single PolicyRequirement, as returned by DiagnoseRunningImage.
+type RequirementEvaluation struct {
+	Requirement PolicyRequirement
+	Allowed     bool
+	// Err is set iff !Allowed, and is an PolicyRequirementError if evaluation succeeded but the result was rejection.
+	Err error
+}
+
+// DiagnoseRunningImage evaluates all policy requirements which apply to the image, without stopping at the first
+// rejection, and returns the result of each of them, in the order they are listed in the policy.
+// The policy allows running the image iff all of the returned results are Allowed.
+// This is intended for explaining why an image is rejected; use IsRunningImageAllowed to enforce the policy.
+// It returns an error only if the requirements could not be evaluated at all.
+// WARNING: This validates signatures and the manifest, but does not download or validate the
+// layers. Users must validate that the layers match their expected digests.
+func (pc *PolicyContext) DiagnoseRunningImage(ctx context.Context, publicImage types.UnparsedImage) (res []RequirementEvaluation, finalErr error) {
+	if err := pc.changeState(pcReady, pcInUse); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := pc.changeState(pcInUse, pcReady); err != nil {
+			res = nil
+			finalErr = err
+		}
+	}()
+
+	image := unparsedimage.FromPublic(publicImage)
+
+	logrus.Debugf("DiagnoseRunningImage for image %s", policyIdentityLogName(image.Reference()))
+	reqs := pc.requirementsForImageRef(image.Reference())
+
+	if len(reqs) == 0 {
+		return nil, PolicyRequirementError("List of verification policy requirements must not be empty")
+	}
+
+	res = make([]RequirementEvaluation, 0, len(reqs))
+	for reqNumber, req := range reqs {
+		allowed, err := req.isRunningImageAllowed(ctx, image)
+		if allowed {
+			logrus.Debugf(" Requirement %d: allowed", reqNumber)
+			err = nil
+		} else {
+			if err == nil { // This violates the PolicyRequirement contract, but make sure Err is set anyway.
+				err = PolicyRequirementError(fmt.Sprintf("Requirement %d rejected the image", reqNumber))
+			}
+			logrus.Debugf(" Requirement %d: denied: %v", reqNumber, err)
+		}
+		res = append(res, RequirementEvaluation{
+			Requirement: req,
+			Allowed:     allowed,
+			Err:         err,
+		})
+	}
+	return res, nil
+}
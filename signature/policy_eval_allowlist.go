@@ -0,0 +1,80 @@
+// Policy evaluation for prAllowlistByDigest.
+
+package signature
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/manifest"
+	digest "github.com/opencontainers/go-digest"
+)
+
+func (pr *prAllowlistByDigest) isSignatureAuthorAccepted(ctx context.Context, image private.UnparsedImage, sig []byte) (signatureAcceptanceResult, *Signature, error) {
+	// The allowlist does not say anything about signature authors.
+	return sarUnknown, nil, nil
+}
+
+func (pr *prAllowlistByDigest) isRunningImageAllowed(ctx context.Context, image private.UnparsedImage) (bool, error) {
+	// FIXME: move this to per-context initialization
+	digests, err := pr.allowedDigests()
+	if err != nil {
+		return false, err
+	}
+
+	m, _, err := image.Manifest(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, d := range digests {
+		matches, err := manifest.MatchesDigest(m, d)
+		if err != nil {
+			return false, err
+		}
+		if matches {
+			return true, nil
+		}
+	}
+	return false, PolicyRequirementError("Image manifest digest is not in the allowlist")
+}
+
+// allowedDigests returns the set of digests accepted by pr.
+func (pr *prAllowlistByDigest) allowedDigests() ([]digest.Digest, error) {
+	if pr.DigestsPath == "" {
+		return pr.Digests, nil
+	}
+	data, err := os.ReadFile(pr.DigestsPath)
+	if err != nil {
+		return nil, err
+	}
+	digests, err := parseDigestAllowlist(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing digest allowlist %q: %w", pr.DigestsPath, err)
+	}
+	return digests, nil
+}
+
+// parseDigestAllowlist parses the contents of a prAllowlistByDigest.DigestsPath file.
+func parseDigestAllowlist(data []byte) ([]digest.Digest, error) {
+	digests := []digest.Digest{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		digests = append(digests, digest.Digest(line))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := validateDigestAllowlist(digests); err != nil {
+		return nil, err
+	}
+	return digests, nil
+}
@@ -0,0 +1,77 @@
+package signature
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPRAllowlistByDigestIsSignatureAuthorAccepted(t *testing.T) {
+	pr, err := NewPRAllowlistByDigest([]digest.Digest{TestImageManifestDigest})
+	require.NoError(t, err)
+	// Pass nil signature to, kind of, test that the return value does not depend on it.
+	sar, parsedSig, err := pr.isSignatureAuthorAccepted(context.Background(), nameOnlyImageMock{}, nil)
+	assertSARUnknown(t, sar, parsedSig, err)
+}
+
+func TestPRAllowlistByDigestIsRunningImageAllowed(t *testing.T) {
+	image := dirImageMock(t, "fixtures/dir-img-valid", "testing/manifest:latest")
+	otherDigest := digest.FromString("other")
+
+	// Digest in the list
+	pr, err := NewPRAllowlistByDigest([]digest.Digest{otherDigest, TestImageManifestDigest})
+	require.NoError(t, err)
+	allowed, err := pr.isRunningImageAllowed(context.Background(), image)
+	assertRunningAllowed(t, allowed, err)
+
+	// Digest not in the list
+	pr, err = NewPRAllowlistByDigest([]digest.Digest{otherDigest})
+	require.NoError(t, err)
+	allowed, err = pr.isRunningImageAllowed(context.Background(), image)
+	assertRunningRejectedPolicyRequirement(t, allowed, err)
+
+	// Error reading the manifest
+	noManifestImage := dirImageMock(t, "fixtures/dir-img-no-manifest", "testing/manifest:latest")
+	pr, err = NewPRAllowlistByDigest([]digest.Digest{TestImageManifestDigest})
+	require.NoError(t, err)
+	allowed, err = pr.isRunningImageAllowed(context.Background(), noManifestImage)
+	assertRunningRejected(t, allowed, err)
+
+	// Digests in a file
+	dir := t.TempDir()
+	allowlistPath := filepath.Join(dir, "allowlist")
+	err = os.WriteFile(allowlistPath, []byte("# A comment\n"+otherDigest.String()+"\n\n  "+TestImageManifestDigest.String()+"  \n"), 0o644)
+	require.NoError(t, err)
+	pr, err = NewPRAllowlistByDigestPath(allowlistPath)
+	require.NoError(t, err)
+	allowed, err = pr.isRunningImageAllowed(context.Background(), image)
+	assertRunningAllowed(t, allowed, err)
+
+	err = os.WriteFile(allowlistPath, []byte(otherDigest.String()+"\n"), 0o644)
+	require.NoError(t, err)
+	allowed, err = pr.isRunningImageAllowed(context.Background(), image)
+	assertRunningRejectedPolicyRequirement(t, allowed, err)
+
+	// Invalid file contents
+	for _, contents := range []string{
+		"",
+		"# Only a comment\n",
+		"this is invalid\n",
+		TestImageManifestDigest.String() + "\n" + TestImageManifestDigest.String() + "\n",
+	} {
+		err = os.WriteFile(allowlistPath, []byte(contents), 0o644)
+		require.NoError(t, err)
+		allowed, err = pr.isRunningImageAllowed(context.Background(), image)
+		assertRunningRejected(t, allowed, err)
+	}
+
+	// Missing file
+	pr, err = NewPRAllowlistByDigestPath(filepath.Join(dir, "this-does-not-exist"))
+	require.NoError(t, err)
+	allowed, err = pr.isRunningImageAllowed(context.Background(), image)
+	assertRunningRejected(t, allowed, err)
+}
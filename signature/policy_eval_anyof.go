@@ -0,0 +1,74 @@
+// Policy evaluation for prAnyOf.
+
+package signature
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/containers/image/v5/internal/multierr"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/sirupsen/logrus"
+)
+
+func (pr *prAnyOf) isSignatureAuthorAccepted(ctx context.Context, image private.UnparsedImage, sig []byte) (signatureAcceptanceResult, *Signature, error) {
+	rejections := []error{}
+	for reqNumber, req := range pr.Requirements {
+		sar, parsedSig, err := req.isSignatureAuthorAccepted(ctx, image, sig)
+		switch sar {
+		case sarAccepted:
+			logrus.Debugf(" Alternative %d: signature accepted", reqNumber)
+			return sarAccepted, parsedSig, nil
+		case sarRejected:
+			logrus.Debugf(" Alternative %d: signature rejected: %v", reqNumber, err)
+			rejections = append(rejections, rejectionOrDefault(reqNumber, err))
+		case sarUnknown:
+			// Nothing to do.
+		default:
+			return sarRejected, nil, fmt.Errorf("Internal error: Unexpected signature verification result %q", string(sar))
+		}
+	}
+	if len(rejections) == 0 {
+		return sarUnknown, nil, nil
+	}
+	return sarRejected, nil, combineAlternativeRejections(rejections)
+}
+
+func (pr *prAnyOf) isRunningImageAllowed(ctx context.Context, image private.UnparsedImage) (bool, error) {
+	rejections := []error{}
+	for reqNumber, req := range pr.Requirements {
+		allowed, err := req.isRunningImageAllowed(ctx, image)
+		if allowed {
+			logrus.Debugf(" Alternative %d: allowed", reqNumber)
+			return true, nil
+		}
+		logrus.Debugf(" Alternative %d: denied: %v", reqNumber, err)
+		rejections = append(rejections, rejectionOrDefault(reqNumber, err))
+	}
+	return false, combineAlternativeRejections(rejections)
+}
+
+// rejectionOrDefault returns err, the reason alternative reqNumber rejected an image, or a generic PolicyRequirementError if it did not report any.
+func rejectionOrDefault(reqNumber int, err error) error {
+	if err == nil {
+		return PolicyRequirementError(fmt.Sprintf("Alternative %d rejected the image without reporting a reason", reqNumber))
+	}
+	return err
+}
+
+// combineAlternativeRejections returns an error reporting that none of the alternatives in a prAnyOf was satisfied, for the non-empty rejections.
+// The result is a PolicyRequirementError if all of rejections are.
+func combineAlternativeRejections(rejections []error) error {
+	if len(rejections) == 1 {
+		return rejections[0]
+	}
+	summary := multierr.Format("None of the alternative requirements were satisfied, reasons: ", "; ", "", rejections)
+	for _, err := range rejections {
+		var prErr PolicyRequirementError
+		if !errors.As(err, &prErr) {
+			return summary
+		}
+	}
+	return PolicyRequirementError(summary.Error())
+}
@@ -0,0 +1,134 @@
+package signature
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/containers/image/v5/internal/private"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// silentRejectionRequirement is a PolicyRequirement which rejects everything without reporting a reason.
+type silentRejectionRequirement struct{}
+
+func (silentRejectionRequirement) isSignatureAuthorAccepted(ctx context.Context, image private.UnparsedImage, sig []byte) (signatureAcceptanceResult, *Signature, error) {
+	return sarRejected, nil, nil
+}
+
+func (silentRejectionRequirement) isRunningImageAllowed(ctx context.Context, image private.UnparsedImage) (bool, error) {
+	return false, nil
+}
+
+func TestPRAnyOfIsSignatureAuthorAccepted(t *testing.T) {
+	ktGPG := SBKeyTypeGPGKeys
+	prm := NewPRMMatchExact()
+	testImage := dirImageMock(t, "fixtures/dir-img-valid", "testing/manifest:latest")
+	testImageSig, err := os.ReadFile("fixtures/dir-img-valid/signature-1")
+	require.NoError(t, err)
+	signedByValidKey := xNewPRSignedByKeyPath(ktGPG, "fixtures/public-key-1.gpg", prm)
+	signedByOtherKey := xNewPRSignedByKeyPath(ktGPG, "fixtures/public-key-2.gpg", prm)
+
+	// Accepted if signed by any of the keys, in either order
+	for _, reqs := range []PolicyRequirements{
+		{signedByValidKey, signedByOtherKey},
+		{signedByOtherKey, signedByValidKey},
+		{NewPRInsecureAcceptAnything(), signedByValidKey},
+	} {
+		pr, err := NewPRAnyOf(reqs)
+		require.NoError(t, err)
+		sar, parsedSig, err := pr.isSignatureAuthorAccepted(context.Background(), testImage, testImageSig)
+		assertSARAccepted(t, sar, parsedSig, err, Signature{
+			DockerManifestDigest: TestImageManifestDigest,
+			DockerReference:      "testing/manifest:latest",
+		})
+	}
+
+	// Rejected if no alternative accepts the signature
+	otherIdentity, err := NewPRMExactReference("example.com/other:latest")
+	require.NoError(t, err)
+	pr, err := NewPRAnyOf(PolicyRequirements{signedByOtherKey, xNewPRSignedByKeyPath(ktGPG, "fixtures/public-key-1.gpg", otherIdentity)})
+	require.NoError(t, err)
+	sar, parsedSig, err := pr.isSignatureAuthorAccepted(context.Background(), testImage, testImageSig)
+	assertSARRejected(t, sar, parsedSig, err)
+	assert.ErrorContains(t, err, "None of the alternative requirements were satisfied")
+
+	// Rejections without a reason are reported
+	for _, reqs := range []PolicyRequirements{
+		{silentRejectionRequirement{}},
+		{silentRejectionRequirement{}, silentRejectionRequirement{}},
+	} {
+		pr, err = NewPRAnyOf(reqs)
+		require.NoError(t, err)
+		sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), testImage, testImageSig)
+		assertSARRejectedPolicyRequirement(t, sar, parsedSig, err)
+		assert.ErrorContains(t, err, "without reporting a reason")
+	}
+
+	// Unknown if no alternative deals with signatures
+	pr, err = NewPRAnyOf(PolicyRequirements{NewPRInsecureAcceptAnything(), NewPRInsecureAcceptAnything()})
+	require.NoError(t, err)
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), testImage, testImageSig)
+	assertSARUnknown(t, sar, parsedSig, err)
+}
+
+func TestPRAnyOfIsRunningImageAllowed(t *testing.T) {
+	ktGPG := SBKeyTypeGPGKeys
+	prm := NewPRMMatchExact()
+	signedByValidKey := xNewPRSignedByKeyPath(ktGPG, "fixtures/public-key-1.gpg", prm)
+	signedByOtherKey := xNewPRSignedByKeyPath(ktGPG, "fixtures/public-key-2.gpg", prm)
+
+	// Allowed if signed by any of the keys, in either order
+	image := dirImageMock(t, "fixtures/dir-img-valid", "testing/manifest:latest")
+	for _, reqs := range []PolicyRequirements{
+		{signedByValidKey, signedByOtherKey},
+		{signedByOtherKey, signedByValidKey},
+	} {
+		pr, err := NewPRAnyOf(reqs)
+		require.NoError(t, err)
+		allowed, err := pr.isRunningImageAllowed(context.Background(), image)
+		assertRunningAllowed(t, allowed, err)
+	}
+
+	// Rejected if signed by neither of the keys
+	pr, err := NewPRAnyOf(PolicyRequirements{signedByOtherKey, signedByOtherKey})
+	require.NoError(t, err)
+	allowed, err := pr.isRunningImageAllowed(context.Background(), image)
+	assertRunningRejected(t, allowed, err)
+
+	// Rejected if not signed at all; all failures are reported
+	image = dirImageMock(t, "fixtures/dir-img-unsigned", "testing/manifest:latest")
+	notAllowlisted, err := NewPRAllowlistByDigest([]digest.Digest{digest.FromString("other manifest")})
+	require.NoError(t, err)
+	pr, err = NewPRAnyOf(PolicyRequirements{signedByValidKey, notAllowlisted})
+	require.NoError(t, err)
+	allowed, err = pr.isRunningImageAllowed(context.Background(), image)
+	assertRunningRejectedPolicyRequirement(t, allowed, err)
+	assert.ErrorContains(t, err, "signature")
+	assert.ErrorContains(t, err, "allowlist")
+
+	// Rejections without a reason are reported
+	for _, reqs := range []PolicyRequirements{
+		{silentRejectionRequirement{}},
+		{silentRejectionRequirement{}, silentRejectionRequirement{}},
+	} {
+		pr, err = NewPRAnyOf(reqs)
+		require.NoError(t, err)
+		allowed, err = pr.isRunningImageAllowed(context.Background(), image)
+		assertRunningRejectedPolicyRequirement(t, allowed, err)
+		assert.ErrorContains(t, err, "without reporting a reason")
+	}
+
+	// Errors other than rejections are preserved
+	invalidSigDir := createInvalidSigDir(t)
+	image = dirImageMock(t, invalidSigDir, "testing/manifest:latest")
+	pr, err = NewPRAnyOf(PolicyRequirements{signedByValidKey, notAllowlisted})
+	require.NoError(t, err)
+	allowed, err = pr.isRunningImageAllowed(context.Background(), image)
+	assertRunningRejected(t, allowed, err)
+	assert.ErrorContains(t, err, "too many levels of symbolic links")
+	_, isPolicyRequirementError := err.(PolicyRequirementError)
+	assert.False(t, isPolicyRequirementError)
+}
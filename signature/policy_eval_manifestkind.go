@@ -0,0 +1,45 @@
+// Policy evaluation for prAppliesToManifestKind.
+
+package signature
+
+import (
+	"context"
+
+	"github.com/containers/image/v5/internal/private"
+	"github.com/sirupsen/logrus"
+)
+
+func (pr *prAppliesToManifestKind) isSignatureAuthorAccepted(ctx context.Context, image private.UnparsedImage, sig []byte) (signatureAcceptanceResult, *Signature, error) {
+	applies, err := pr.appliesTo(ctx, image)
+	if err != nil {
+		return sarRejected, nil, err
+	}
+	if !applies {
+		return sarUnknown, nil, nil
+	}
+	return pr.Requirement.isSignatureAuthorAccepted(ctx, image, sig)
+}
+
+func (pr *prAppliesToManifestKind) isRunningImageAllowed(ctx context.Context, image private.UnparsedImage) (bool, error) {
+	applies, err := pr.appliesTo(ctx, image)
+	if err != nil {
+		return false, err
+	}
+	if !applies {
+		return true, nil
+	}
+	return pr.Requirement.isRunningImageAllowed(ctx, image)
+}
+
+// appliesTo returns true if pr.Requirement should be enforced for image.
+func (pr *prAppliesToManifestKind) appliesTo(ctx context.Context, image private.UnparsedImage) (bool, error) {
+	kind, err := imageManifestKind(ctx, image)
+	if err != nil {
+		return false, err
+	}
+	if kind != pr.ManifestKind {
+		logrus.Debugf(" Manifest is of kind %q, requirement applies only to %q, skipping", kind, pr.ManifestKind)
+		return false, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,159 @@
+package signature
+
+import (
+	"context"
+	"testing"
+
+	"github.com/containers/image/v5/manifest"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// manifestImageMock is a mock of private.UnparsedImage which returns a fixed manifest,
+// and allows transports.ImageName to work.
+type manifestImageMock struct {
+	nameOnlyImageMock
+	manifest []byte
+	mimeType string
+}
+
+func (m manifestImageMock) Manifest(ctx context.Context) ([]byte, string, error) {
+	return m.manifest, m.mimeType, nil
+}
+
+const (
+	testOCIImageManifest = `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json",` +
+		`"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"sha256:a8e4c0e3e0e8c44d6c7b9b5d0a0a30c5a1b2f6a5e4b2c7d1e9f6b3a7c5d2e1f0","size":2},` +
+		`"layers":[]}`
+	testOCIArtifactManifest = `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","artifactType":"application/spdx+json",` +
+		`"config":{"mediaType":"application/vnd.oci.empty.v1+json","digest":"sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a","size":2},` +
+		`"layers":[]}`
+	testOCIArtifactConfigManifest = `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json",` +
+		`"config":{"mediaType":"application/vnd.example.sbom.config.v1+json","digest":"sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a","size":2},` +
+		`"layers":[]}`
+	// A runnable image which claims to be an artifact
+	testOCIImageWithArtifactTypeManifest = `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","artifactType":"application/spdx+json",` +
+		`"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"sha256:a8e4c0e3e0e8c44d6c7b9b5d0a0a30c5a1b2f6a5e4b2c7d1e9f6b3a7c5d2e1f0","size":2},` +
+		`"layers":[{"mediaType":"application/vnd.oci.image.layer.v1.tar+gzip","digest":"sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a","size":2}]}`
+	testOCIDockerConfigManifest = `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json",` +
+		`"config":{"mediaType":"application/vnd.docker.container.image.v1+json","digest":"sha256:a8e4c0e3e0e8c44d6c7b9b5d0a0a30c5a1b2f6a5e4b2c7d1e9f6b3a7c5d2e1f0","size":2},` +
+		`"layers":[]}`
+	testOCIIndex         = `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[]}`
+	testOCIArtifactIndex = `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","artifactType":"application/spdx+json","manifests":[]}`
+)
+
+func TestImageManifestKind(t *testing.T) {
+	for _, c := range []struct {
+		manifest, mimeType string
+		expected           manifestKind
+	}{
+		{testOCIImageManifest, imgspecv1.MediaTypeImageManifest, ManifestKindImage},
+		{testOCIArtifactManifest, imgspecv1.MediaTypeImageManifest, ManifestKindArtifact},
+		{testOCIArtifactConfigManifest, imgspecv1.MediaTypeImageManifest, ManifestKindArtifact},
+		{testOCIImageWithArtifactTypeManifest, imgspecv1.MediaTypeImageManifest, ManifestKindImage},
+		{testOCIDockerConfigManifest, imgspecv1.MediaTypeImageManifest, ManifestKindImage},
+		{testOCIIndex, imgspecv1.MediaTypeImageIndex, ManifestKindImage},
+		// The instances of an index may be runnable images, whatever its artifactType.
+		{testOCIArtifactIndex, imgspecv1.MediaTypeImageIndex, ManifestKindImage},
+	} {
+		kind, err := imageManifestKind(context.Background(), manifestImageMock{manifest: []byte(c.manifest), mimeType: c.mimeType})
+		require.NoError(t, err, c.manifest)
+		assert.Equal(t, c.expected, kind, c.manifest)
+	}
+
+	// Non-OCI manifests are always images
+	image := dirImageMock(t, "fixtures/dir-img-valid", "testing/manifest:latest")
+	kind, err := imageManifestKind(context.Background(), image)
+	require.NoError(t, err)
+	assert.Equal(t, ManifestKindImage, kind)
+
+	// Invalid manifest
+	_, err = imageManifestKind(context.Background(), manifestImageMock{manifest: []byte("this is invalid"), mimeType: imgspecv1.MediaTypeImageManifest})
+	assert.Error(t, err)
+	// Error reading the manifest
+	noManifestImage := dirImageMock(t, "fixtures/dir-img-no-manifest", "testing/manifest:latest")
+	_, err = imageManifestKind(context.Background(), noManifestImage)
+	assert.Error(t, err)
+}
+
+func TestPRAppliesToManifestKindIsSignatureAuthorAccepted(t *testing.T) {
+	imageManifest := manifestImageMock{manifest: []byte(testOCIImageManifest), mimeType: imgspecv1.MediaTypeImageManifest}
+	artifactManifest := manifestImageMock{manifest: []byte(testOCIArtifactManifest), mimeType: imgspecv1.MediaTypeImageManifest}
+
+	pr, err := NewPRAppliesToManifestKind(ManifestKindImage, NewPRReject())
+	require.NoError(t, err)
+	// Pass nil signature to, kind of, test that the return value does not depend on it.
+	sar, parsedSig, err := pr.isSignatureAuthorAccepted(context.Background(), imageManifest, nil)
+	assertSARRejectedPolicyRequirement(t, sar, parsedSig, err)
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), artifactManifest, nil)
+	assertSARUnknown(t, sar, parsedSig, err)
+
+	// Error determining the manifest kind
+	invalidManifest := manifestImageMock{manifest: []byte("this is invalid"), mimeType: imgspecv1.MediaTypeImageManifest}
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), invalidManifest, nil)
+	assertSARRejected(t, sar, parsedSig, err)
+}
+
+func TestPRAppliesToManifestKindIsRunningImageAllowed(t *testing.T) {
+	imageManifest := manifestImageMock{manifest: []byte(testOCIImageManifest), mimeType: imgspecv1.MediaTypeImageManifest}
+	artifactManifest := manifestImageMock{manifest: []byte(testOCIArtifactManifest), mimeType: imgspecv1.MediaTypeImageManifest}
+
+	// A requirement applying only to images
+	pr, err := NewPRAppliesToManifestKind(ManifestKindImage, NewPRReject())
+	require.NoError(t, err)
+	allowed, err := pr.isRunningImageAllowed(context.Background(), imageManifest)
+	assertRunningRejectedPolicyRequirement(t, allowed, err)
+	allowed, err = pr.isRunningImageAllowed(context.Background(), artifactManifest)
+	assertRunningAllowed(t, allowed, err)
+	// Adding an artifactType to an image does not avoid the requirement.
+	for _, m := range []manifestImageMock{
+		{manifest: []byte(testOCIImageWithArtifactTypeManifest), mimeType: imgspecv1.MediaTypeImageManifest},
+		{manifest: []byte(testOCIArtifactIndex), mimeType: imgspecv1.MediaTypeImageIndex},
+	} {
+		allowed, err = pr.isRunningImageAllowed(context.Background(), m)
+		assertRunningRejectedPolicyRequirement(t, allowed, err)
+	}
+
+	// A requirement applying only to artifacts
+	pr, err = NewPRAppliesToManifestKind(ManifestKindArtifact, NewPRReject())
+	require.NoError(t, err)
+	allowed, err = pr.isRunningImageAllowed(context.Background(), imageManifest)
+	assertRunningAllowed(t, allowed, err)
+	allowed, err = pr.isRunningImageAllowed(context.Background(), artifactManifest)
+	assertRunningRejectedPolicyRequirement(t, allowed, err)
+
+	// A policy requiring a specific image digest for images, but not for artifacts;
+	// unscoped requirements apply to both.
+	imageDigest, err := manifest.Digest([]byte(testOCIImageManifest))
+	require.NoError(t, err)
+	allowlist, err := NewPRAllowlistByDigest([]digest.Digest{imageDigest})
+	require.NoError(t, err)
+	scopedAllowlist, err := NewPRAppliesToManifestKind(ManifestKindImage, allowlist)
+	require.NoError(t, err)
+	for _, c := range []struct {
+		req             PolicyRequirement
+		imageAllowed    bool
+		artifactAllowed bool
+	}{
+		{allowlist, true, false},
+		{scopedAllowlist, true, true},
+	} {
+		allowed, err := c.req.isRunningImageAllowed(context.Background(), imageManifest)
+		assert.Equal(t, c.imageAllowed, allowed)
+		if !c.imageAllowed {
+			assert.Error(t, err)
+		}
+		allowed, err = c.req.isRunningImageAllowed(context.Background(), artifactManifest)
+		assert.Equal(t, c.artifactAllowed, allowed)
+		if !c.artifactAllowed {
+			assert.Error(t, err)
+		}
+	}
+
+	// Error determining the manifest kind
+	invalidManifest := manifestImageMock{manifest: []byte("this is invalid"), mimeType: imgspecv1.MediaTypeImageManifest}
+	allowed, err = pr.isRunningImageAllowed(context.Background(), invalidManifest)
+	assertRunningRejected(t, allowed, err)
+}
@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/containers/image/v5/internal/multierr"
 	"github.com/containers/image/v5/internal/private"
@@ -169,6 +170,35 @@ func (pr *prSigstoreSigned) prepareTrustRoot() (*sigstoreSignedTrustRoot, error)
 	return &res, nil
 }
 
+// sigstoreBundleToAnnotations converts a Sigstore bundle into the equivalent annotations of the
+// annotation-based sigstore signature format, so that both are verified by the same code.
+// Annotations other than the bundle are ignored, to ensure all data comes from the bundle.
+// If the bundle contains an inclusion proof, and rekorPublicKeys is set, the proof’s checkpoint must be signed by one of rekorPublicKeys.
+func sigstoreBundleToAnnotations(rekorPublicKeys []*ecdsa.PublicKey, untrustedBundle, untrustedPayload []byte) (map[string]string, error) {
+	components, err := internal.ParseSigstoreBundle(untrustedBundle, untrustedPayload)
+	if err != nil {
+		return nil, err
+	}
+	if components.UntrustedRekorCheckpoint != nil && rekorPublicKeys != nil {
+		if err := internal.VerifyRekorCheckpoint(rekorPublicKeys, components.UntrustedRekorCheckpoint); err != nil {
+			return nil, err
+		}
+	}
+	res := map[string]string{
+		signature.SigstoreSignatureAnnotationKey: components.UntrustedBase64Signature,
+	}
+	if components.UntrustedCertificatePEM != nil {
+		res[signature.SigstoreCertificateAnnotationKey] = string(components.UntrustedCertificatePEM)
+	}
+	if components.UntrustedIntermediateChainPEM != nil {
+		res[signature.SigstoreIntermediateCertificateChainAnnotationKey] = string(components.UntrustedIntermediateChainPEM)
+	}
+	if components.UntrustedRekorSET != nil {
+		res[signature.SigstoreSETAnnotationKey] = string(components.UntrustedRekorSET)
+	}
+	return res, nil
+}
+
 func (pr *prSigstoreSigned) isSignatureAuthorAccepted(ctx context.Context, image private.UnparsedImage, sig []byte) (signatureAcceptanceResult, *Signature, error) {
 	// We don’t know of a single user of this API, and we might return unexpected values in Signature.
 	// For now, just punt.
@@ -183,13 +213,20 @@ func (pr *prSigstoreSigned) isSignatureAccepted(ctx context.Context, image priva
 	}
 
 	untrustedAnnotations := sig.UntrustedAnnotations()
+	untrustedPayload := sig.UntrustedPayload()
+	if untrustedBundle, ok := untrustedAnnotations[signature.SigstoreBundleAnnotationKey]; ok {
+		untrustedAnnotations, err = sigstoreBundleToAnnotations(trustRoot.rekorPublicKeys, []byte(untrustedBundle), untrustedPayload)
+		if err != nil {
+			return sarRejected, err
+		}
+	}
 	untrustedBase64Signature, ok := untrustedAnnotations[signature.SigstoreSignatureAnnotationKey]
 	if !ok {
 		return sarRejected, fmt.Errorf("missing %s annotation", signature.SigstoreSignatureAnnotationKey)
 	}
-	untrustedPayload := sig.UntrustedPayload()
 
 	var publicKeys []crypto.PublicKey
+	var signatureTime time.Time // The Rekor inclusion time, if known.
 	switch {
 	case trustRoot.publicKeys != nil && trustRoot.fulcio != nil: // newPRSigstoreSigned rejects such combinations.
 		return sarRejected, errors.New("Internal inconsistency: Both a public key and Fulcio CA specified")
@@ -213,10 +250,10 @@ func (pr *prSigstoreSigned) isSignatureAccepted(ctx context.Context, image priva
 					// (PEM is not essential, MarshalPublicKeyToPEM can only fail if marshaling to ASN1.DER fails.)
 					return sarRejected, fmt.Errorf("re-marshaling public key to PEM: %w", err)
 				}
-				// We don’t care about the Rekor timestamp, just about log presence.
-				_, err = internal.VerifyRekorSET(trustRoot.rekorPublicKeys, []byte(untrustedSET), recreatedPublicKeyPEM, untrustedBase64Signature, untrustedPayload)
+				rekorSETTime, err := internal.VerifyRekorSET(trustRoot.rekorPublicKeys, []byte(untrustedSET), recreatedPublicKeyPEM, untrustedBase64Signature, untrustedPayload)
 				if err == nil {
 					publicKeys = append(publicKeys, candidatePublicKey)
+					signatureTime = rekorSETTime
 					break // The SET can only accept one public key entry, so if we found one, the rest either doesn’t match or is a duplicate
 				}
 				rekorFailures = append(rekorFailures, err.Error())
@@ -248,12 +285,13 @@ func (pr *prSigstoreSigned) isSignatureAccepted(ctx context.Context, image priva
 		if untrustedIntermediateChain, ok := untrustedAnnotations[signature.SigstoreIntermediateCertificateChainAnnotationKey]; ok {
 			untrustedIntermediateChainBytes = []byte(untrustedIntermediateChain)
 		}
-		pk, err := verifyRekorFulcio(trustRoot.rekorPublicKeys, trustRoot.fulcio,
+		pk, rekorSETTime, err := verifyRekorFulcio(trustRoot.rekorPublicKeys, trustRoot.fulcio,
 			[]byte(untrustedSET), []byte(untrustedCert), untrustedIntermediateChainBytes, untrustedBase64Signature, untrustedPayload)
 		if err != nil {
 			return sarRejected, err
 		}
 		publicKeys = []crypto.PublicKey{pk}
+		signatureTime = rekorSETTime
 	}
 
 	if len(publicKeys) == 0 {
@@ -277,6 +315,12 @@ func (pr *prSigstoreSigned) isSignatureAccepted(ctx context.Context, image priva
 			if err != nil {
 				return err
 			}
+			if !digestMatches && pr.ManifestCanonicalization == SigstoreManifestCanonicalizationJSON {
+				digestMatches, err = canonicalJSONMatchesDigest(m, digest)
+				if err != nil {
+					return err
+				}
+			}
 			if !digestMatches {
 				return PolicyRequirementError(fmt.Sprintf("Signature for digest %s does not match", digest))
 			}
@@ -290,9 +334,39 @@ func (pr *prSigstoreSigned) isSignatureAccepted(ctx context.Context, image priva
 		return sarRejected, errors.New("internal error: VerifySigstorePayload succeeded but returned no data") // Coverage: This should never happen.
 	}
 
+	if pr.MaxSignatureAgeDays != 0 {
+		if signatureTime.IsZero() {
+			if payloadTime, ok := signature.UntrustedTimestamp(); ok {
+				signatureTime = payloadTime
+			}
+		}
+		if err := pr.checkSignatureAge(signatureTime); err != nil {
+			return sarRejected, err
+		}
+	}
+
 	return sarAccepted, nil
 }
 
+// timeNow returns the current time; it can be replaced by tests.
+var timeNow = time.Now
+
+// checkSignatureAge returns an error if a signature created at signatureTime (zero if unknown) does not satisfy pr.MaxSignatureAgeDays.
+func (pr *prSigstoreSigned) checkSignatureAge(signatureTime time.Time) error {
+	if signatureTime.IsZero() {
+		if pr.SignatureWithoutTimestamp == SigstoreNoTimestampAccept {
+			return nil
+		}
+		return PolicyRequirementError("Signature does not record its creation time, and a maximum signature age is required")
+	}
+	maxAge := time.Duration(pr.MaxSignatureAgeDays) * 24 * time.Hour
+	if age := timeNow().Sub(signatureTime); age > maxAge {
+		return PolicyRequirementError(fmt.Sprintf("Signature created at %s is older than the maximum signature age of %d days",
+			signatureTime.UTC().Format(time.RFC3339), pr.MaxSignatureAgeDays))
+	}
+	return nil
+}
+
 func (pr *prSigstoreSigned) isRunningImageAllowed(ctx context.Context, image private.UnparsedImage) (bool, error) {
 	sigs, err := image.UntrustedSignatures(ctx)
 	if err != nil {
@@ -7,11 +7,23 @@ package signature
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
 	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/internal/signature"
+	internalSigner "github.com/containers/image/v5/internal/signer"
+	"github.com/containers/image/v5/signature/sigstore"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -699,6 +711,198 @@ func TestPRrSigstoreSignedIsSignatureAccepted(t *testing.T) {
 	assertRejected(sar, err)
 }
 
+func TestPRSigstoreSignedIsSignatureAcceptedBundle(t *testing.T) {
+	prm := NewPRMMatchRepository()
+	testKeyRekorImage := dirImageMock(t, "fixtures/dir-img-cosign-bundle-key-rekor-valid", "192.168.64.2:5000/cosign-signed/key-1")
+	testKeyRekorImageSig := sigstoreSignatureFromFile(t, "fixtures/dir-img-cosign-bundle-key-rekor-valid/signature-1")
+	testFulcioRekorImage := dirImageMock(t, "fixtures/dir-img-cosign-bundle-fulcio-rekor-valid", "192.168.64.2:5000/cosign-signed/fulcio-rekor-1")
+	testFulcioRekorImageSig := sigstoreSignatureFromFile(t, "fixtures/dir-img-cosign-bundle-fulcio-rekor-valid/signature-1")
+	fulcio, err := NewPRSigstoreSignedFulcio(
+		PRSigstoreSignedFulcioWithCAPath("fixtures/fulcio_v1.crt.pem"),
+		PRSigstoreSignedFulcioWithOIDCIssuer("https://github.com/login/oauth"),
+		PRSigstoreSignedFulcioWithSubjectEmail("mitr@redhat.com"),
+	)
+	require.NoError(t, err)
+	keyRekorPR, err := newPRSigstoreSigned(
+		PRSigstoreSignedWithKeyPath("fixtures/cosign2.pub"),
+		PRSigstoreSignedWithRekorPublicKeyPath("fixtures/rekor.pub"),
+		PRSigstoreSignedWithSignedIdentity(prm),
+	)
+	require.NoError(t, err)
+	fulcioRekorPR, err := newPRSigstoreSigned(
+		PRSigstoreSignedWithFulcio(fulcio),
+		PRSigstoreSignedWithRekorPublicKeyPath("fixtures/rekor.pub"),
+		PRSigstoreSignedWithSignedIdentity(prm),
+	)
+	require.NoError(t, err)
+
+	// Successful key+Rekor use
+	sar, err := keyRekorPR.isSignatureAccepted(context.Background(), testKeyRekorImage, testKeyRekorImageSig)
+	require.NoError(t, err)
+	assert.Equal(t, sarAccepted, sar)
+
+	// Successful Fulcio certificate use
+	sar, err = fulcioRekorPR.isSignatureAccepted(context.Background(), testFulcioRekorImage, testFulcioRekorImageSig)
+	require.NoError(t, err)
+	assert.Equal(t, sarAccepted, sar)
+
+	// A transparency log entry which does not match the inclusion promise
+	// Pass a nil pointer to, kind of, test that the return value does not depend on the image.
+	sar, err = fulcioRekorPR.isSignatureAccepted(context.Background(), nil,
+		sigstoreSignatureFromFile(t, "fixtures/dir-img-cosign-bundle-mismatched-tlog-entry/signature-1"))
+	assert.Error(t, err)
+	assert.Equal(t, sarRejected, sar)
+
+	// Invalid bundle
+	// Pass a nil pointer to, kind of, test that the return value does not depend on the image.
+	sar, err = keyRekorPR.isSignatureAccepted(context.Background(), nil,
+		sigstoreSignatureWithModifiedAnnotation(testKeyRekorImageSig, signature.SigstoreBundleAnnotationKey, "this is not a valid bundle"))
+	assert.Error(t, err)
+	assert.Equal(t, sarRejected, sar)
+
+	// A bundle for a different payload
+	// Pass a nil pointer to, kind of, test that the return value does not depend on the image.
+	sar, err = keyRekorPR.isSignatureAccepted(context.Background(), nil,
+		sigstoreSignatureWithModifiedAnnotation(testKeyRekorImageSig, signature.SigstoreBundleAnnotationKey,
+			testFulcioRekorImageSig.UntrustedAnnotations()[signature.SigstoreBundleAnnotationKey]))
+	assert.Error(t, err)
+	assert.Equal(t, sarRejected, sar)
+
+	// A consistent inclusion proof, with a checkpoint not signed by the Rekor key
+	var bundle map[string]any
+	err = json.Unmarshal([]byte(testKeyRekorImageSig.UntrustedAnnotations()[signature.SigstoreBundleAnnotationKey]), &bundle)
+	require.NoError(t, err)
+	entry := bundle["verificationMaterial"].(map[string]any)["tlogEntries"].([]any)[0].(map[string]any)
+	body, err := base64.StdEncoding.DecodeString(entry["canonicalizedBody"].(string))
+	require.NoError(t, err)
+	rootHash := sha256.Sum256(append([]byte{0}, body...)) // The only leaf of a tree of size 1
+	checkpointText := fmt.Sprintf("rekor.example.com - 1234\n1\n%s\n", base64.StdEncoding.EncodeToString(rootHash[:]))
+	checkpointKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	checkpointHash := sha256.Sum256([]byte(checkpointText))
+	checkpointSig, err := ecdsa.SignASN1(rand.Reader, checkpointKey, checkpointHash[:])
+	require.NoError(t, err)
+	checkpointKeyBytes, err := x509.MarshalPKIXPublicKey(&checkpointKey.PublicKey)
+	require.NoError(t, err)
+	checkpointKeyHash := sha256.Sum256(checkpointKeyBytes)
+	entry["inclusionProof"] = map[string]any{
+		"logIndex": "0",
+		"rootHash": rootHash[:],
+		"treeSize": "1",
+		"hashes":   []any{},
+		"checkpoint": map[string]any{
+			"envelope": checkpointText + "\n— rekor.example.com " + base64.StdEncoding.EncodeToString(append(checkpointKeyHash[:4], checkpointSig...)) + "\n",
+		},
+	}
+	bundleBytes, err := json.Marshal(bundle)
+	require.NoError(t, err)
+	// Pass a nil pointer to, kind of, test that the return value does not depend on the image.
+	sar, err = keyRekorPR.isSignatureAccepted(context.Background(), nil,
+		sigstoreSignatureWithModifiedAnnotation(testKeyRekorImageSig, signature.SigstoreBundleAnnotationKey, string(bundleBytes)))
+	assert.Error(t, err)
+	assert.Equal(t, sarRejected, sar)
+}
+
+func TestPRSigstoreSignedMaxSignatureAge(t *testing.T) {
+	defer func(original func() time.Time) { timeNow = original }(timeNow)
+	const maxAgeDays = 30
+	fulcio, err := NewPRSigstoreSignedFulcio(
+		PRSigstoreSignedFulcioWithCAPath("fixtures/fulcio_v1.crt.pem"),
+		PRSigstoreSignedFulcioWithOIDCIssuer("https://github.com/login/oauth"),
+		PRSigstoreSignedFulcioWithSubjectEmail("mitr@redhat.com"),
+	)
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		name          string
+		options       []PRSigstoreSignedOption
+		image         string
+		reference     string
+		signatureTime time.Time
+	}{
+		{
+			name: "key+Rekor, Rekor inclusion time",
+			options: []PRSigstoreSignedOption{
+				PRSigstoreSignedWithKeyPath("fixtures/cosign2.pub"),
+				PRSigstoreSignedWithRekorPublicKeyPath("fixtures/rekor.pub"),
+				PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepository()),
+			},
+			image:         "fixtures/dir-img-cosign-key-rekor-valid",
+			reference:     "192.168.64.2:5000/cosign-signed/key-1",
+			signatureTime: time.Unix(1674251859, 0),
+		},
+		{
+			name: "Fulcio, Rekor inclusion time",
+			options: []PRSigstoreSignedOption{
+				PRSigstoreSignedWithFulcio(fulcio),
+				PRSigstoreSignedWithRekorPublicKeyPath("fixtures/rekor.pub"),
+				PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepository()),
+			},
+			image:         "fixtures/dir-img-cosign-fulcio-rekor-valid",
+			reference:     "192.168.64.2:5000/cosign-signed/fulcio-rekor-1",
+			signatureTime: time.Unix(1674247893, 0),
+		},
+		{
+			name: "key, signing time in the payload",
+			options: []PRSigstoreSignedOption{
+				PRSigstoreSignedWithKeyPath("fixtures/cosign.pub"),
+				PRSigstoreSignedWithSignedIdentity(NewPRMMatchExact()),
+			},
+			image:         "fixtures/dir-img-cosign-valid-with-tag",
+			reference:     "192.168.64.2:5000/skopeo-signed:tag",
+			signatureTime: time.Unix(1657296609, 0),
+		},
+	} {
+		pr, err := newPRSigstoreSigned(append(c.options, PRSigstoreSignedWithMaxSignatureAgeDays(maxAgeDays))...)
+		require.NoError(t, err, c.name)
+		image := dirImageMock(t, c.image, c.reference)
+		sig := sigstoreSignatureFromFile(t, c.image+"/signature-1")
+
+		// A fresh signature
+		timeNow = func() time.Time { return c.signatureTime.Add((maxAgeDays - 1) * 24 * time.Hour) }
+		sar, err := pr.isSignatureAccepted(context.Background(), image, sig)
+		assert.NoError(t, err, c.name)
+		assert.Equal(t, sarAccepted, sar, c.name)
+
+		// A stale signature
+		timeNow = func() time.Time { return c.signatureTime.Add((maxAgeDays + 1) * 24 * time.Hour) }
+		sar, err = pr.isSignatureAccepted(context.Background(), image, sig)
+		assert.ErrorContains(t, err, "older than the maximum signature age", c.name)
+		assert.Equal(t, sarRejected, sar, c.name)
+		allowed, err := pr.isRunningImageAllowed(context.Background(), image)
+		assert.Error(t, err, c.name)
+		assert.False(t, allowed, c.name)
+	}
+
+	// A signature without a timestamp
+	timeNow = time.Now
+	image := dirImageMock(t, "fixtures/dir-img-cosign-valid", "192.168.64.2:5000/cosign-signed-single-sample")
+	sig := sigstoreSignatureFromFile(t, "fixtures/dir-img-cosign-valid/signature-1")
+	for _, c := range []struct {
+		options  []PRSigstoreSignedOption
+		accepted bool
+	}{
+		{nil, false},
+		{[]PRSigstoreSignedOption{PRSigstoreSignedWithSignatureWithoutTimestamp(SigstoreNoTimestampReject)}, false},
+		{[]PRSigstoreSignedOption{PRSigstoreSignedWithSignatureWithoutTimestamp(SigstoreNoTimestampAccept)}, true},
+	} {
+		pr, err := newPRSigstoreSigned(append([]PRSigstoreSignedOption{
+			PRSigstoreSignedWithKeyPath("fixtures/cosign.pub"),
+			PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepository()),
+			PRSigstoreSignedWithMaxSignatureAgeDays(maxAgeDays),
+		}, c.options...)...)
+		require.NoError(t, err)
+		sar, err := pr.isSignatureAccepted(context.Background(), image, sig)
+		if c.accepted {
+			assert.NoError(t, err)
+			assert.Equal(t, sarAccepted, sar)
+		} else {
+			assert.ErrorContains(t, err, "does not record its creation time")
+			assert.Equal(t, sarRejected, sar)
+		}
+	}
+}
+
 func TestPRSigstoreSignedIsRunningImageAllowed(t *testing.T) {
 	prm := NewPRMMatchRepository() // We prefer to test with a Cosign-created signature to ensure interoperability, and that doesn’t work with matchExact. matchExact is tested later.
 
@@ -822,3 +1026,82 @@ func TestPRSigstoreSignedIsRunningImageAllowed(t *testing.T) {
 	allowed, err = pr.isRunningImageAllowed(context.Background(), image)
 	assertRunningRejectedPolicyRequirement(t, allowed, err)
 }
+
+func TestPRSigstoreSignedManifestCanonicalization(t *testing.T) {
+	keyPair, err := sigstore.GenerateKeyPair([]byte("passphrase"))
+	require.NoError(t, err)
+	privateKeyFile := filepath.Join(t.TempDir(), "private.key")
+	err = os.WriteFile(privateKeyFile, keyPair.PrivateKey, 0o600)
+	require.NoError(t, err)
+	signer, err := sigstore.NewSigner(sigstore.WithPrivateKeyFile(privateKeyFile, []byte("passphrase")))
+	require.NoError(t, err)
+	defer signer.Close()
+
+	const testReference = "example.com/canonical:latest"
+	testNamed, err := reference.ParseNormalizedNamed(testReference)
+	require.NoError(t, err)
+	rawManifest, err := os.ReadFile("fixtures/image.manifest.json")
+	require.NoError(t, err)
+	canonicalManifest, err := canonicalJSON(rawManifest)
+	require.NoError(t, err)
+	require.NotEqual(t, rawManifest, canonicalManifest)
+	imageDir := t.TempDir()
+	err = os.WriteFile(filepath.Join(imageDir, "manifest.json"), rawManifest, 0o644)
+	require.NoError(t, err)
+	image := dirImageMock(t, imageDir, testReference)
+
+	signManifest := func(m []byte) signature.Sigstore {
+		sig, err := internalSigner.SignImageManifest(context.Background(), signer, m, testNamed)
+		require.NoError(t, err)
+		sigstoreSig, ok := sig.(signature.Sigstore)
+		require.True(t, ok)
+		return sigstoreSig
+	}
+	rawSig := signManifest(rawManifest)
+	canonicalSig := signManifest(canonicalManifest)
+
+	for _, c := range []struct {
+		options           []PRSigstoreSignedOption
+		canonicalAccepted bool
+	}{
+		{nil, false},
+		{[]PRSigstoreSignedOption{PRSigstoreSignedWithManifestCanonicalization(SigstoreManifestCanonicalizationNone)}, false},
+		{[]PRSigstoreSignedOption{PRSigstoreSignedWithManifestCanonicalization(SigstoreManifestCanonicalizationJSON)}, true},
+	} {
+		pr, err := newPRSigstoreSigned(append([]PRSigstoreSignedOption{
+			PRSigstoreSignedWithKeyData(keyPair.PublicKey),
+			PRSigstoreSignedWithSignedIdentity(NewPRMMatchExact()),
+		}, c.options...)...)
+		require.NoError(t, err)
+
+		// A signature of the raw manifest is always accepted
+		sar, err := pr.isSignatureAccepted(context.Background(), image, rawSig)
+		assert.NoError(t, err)
+		assert.Equal(t, sarAccepted, sar)
+
+		sar, err = pr.isSignatureAccepted(context.Background(), image, canonicalSig)
+		if c.canonicalAccepted {
+			assert.NoError(t, err)
+			assert.Equal(t, sarAccepted, sar)
+		} else {
+			assert.ErrorContains(t, err, "does not match")
+			assert.Equal(t, sarRejected, sar)
+		}
+	}
+
+	// An ambiguous manifest is rejected even if the signature matches its canonical form
+	ambiguousManifest := []byte(`{"schemaVersion": 2, "mediaType": "application/vnd.oci.image.manifest.v1+json", "MediaType": "other"}`)
+	canonicalAmbiguousManifest := []byte(`{"MediaType":"other","mediaType":"application/vnd.oci.image.manifest.v1+json","schemaVersion":2}`)
+	ambiguousDir := t.TempDir()
+	err = os.WriteFile(filepath.Join(ambiguousDir, "manifest.json"), ambiguousManifest, 0o644)
+	require.NoError(t, err)
+	pr, err := newPRSigstoreSigned(
+		PRSigstoreSignedWithKeyData(keyPair.PublicKey),
+		PRSigstoreSignedWithSignedIdentity(NewPRMMatchExact()),
+		PRSigstoreSignedWithManifestCanonicalization(SigstoreManifestCanonicalizationJSON),
+	)
+	require.NoError(t, err)
+	sar, err := pr.isSignatureAccepted(context.Background(), dirImageMock(t, ambiguousDir, testReference), signManifest(canonicalAmbiguousManifest))
+	assert.ErrorContains(t, err, "ambiguous JSON object")
+	assert.Equal(t, sarRejected, sar)
+}
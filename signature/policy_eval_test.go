@@ -2,6 +2,7 @@ package signature
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"testing"
 
@@ -246,6 +247,10 @@ func TestPolicyContextGetSignaturesWithAcceptedAuthor(t *testing.T) {
 					NewPRInsecureAcceptAnything(),
 				},
 				"docker.io/testing/manifest:invalidEmptyRequirements": {},
+				"docker.io/testing/manifest:inconsistentRequirements": {
+					inconsistentRequirementMock{allowed: false, err: nil},
+					inconsistentRequirementMock{allowed: true, err: errors.New("ignored")},
+				},
 			},
 		},
 	})
@@ -373,6 +378,10 @@ func TestPolicyContextIsRunningImageAllowed(t *testing.T) {
 					NewPRInsecureAcceptAnything(),
 				},
 				"docker.io/testing/manifest:invalidEmptyRequirements": {},
+				"docker.io/testing/manifest:inconsistentRequirements": {
+					inconsistentRequirementMock{allowed: false, err: nil},
+					inconsistentRequirementMock{allowed: true, err: errors.New("ignored")},
+				},
 			},
 		},
 	})
@@ -446,6 +455,100 @@ func TestPolicyContextIsRunningImageAllowed(t *testing.T) {
 	// mistakes only, anyway.
 }
 
+// inconsistentRequirementMock is a PolicyRequirement which returns fixed results from isRunningImageAllowed,
+// even ones violating the PolicyRequirement contract.
+type inconsistentRequirementMock struct {
+	allowed bool
+	err     error
+}
+
+func (pr inconsistentRequirementMock) isSignatureAuthorAccepted(ctx context.Context, image private.UnparsedImage, sig []byte) (signatureAcceptanceResult, *Signature, error) {
+	return sarUnknown, nil, nil
+}
+
+func (pr inconsistentRequirementMock) isRunningImageAllowed(ctx context.Context, image private.UnparsedImage) (bool, error) {
+	return pr.allowed, pr.err
+}
+
+func TestPolicyContextDiagnoseRunningImage(t *testing.T) {
+	pc, err := NewPolicyContext(&Policy{
+		Default: PolicyRequirements{NewPRReject()},
+		Transports: map[string]PolicyTransportScopes{
+			"docker": {
+				"docker.io/testing/manifest:latest": {
+					xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key.gpg", NewPRMMatchExact()),
+					NewPRInsecureAcceptAnything(),
+				},
+				"docker.io/testing/manifest:multipleFailures": {
+					xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key.gpg", NewPRMMatchExact()),
+					NewPRInsecureAcceptAnything(),
+					NewPRReject(),
+				},
+				"docker.io/testing/manifest:invalidEmptyRequirements": {},
+				"docker.io/testing/manifest:inconsistentRequirements": {
+					inconsistentRequirementMock{allowed: false, err: nil},
+					inconsistentRequirementMock{allowed: true, err: errors.New("ignored")},
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer func() {
+		err := pc.Destroy()
+		require.NoError(t, err)
+	}()
+
+	// All requirements allow the image
+	img := pcImageMock(t, "fixtures/dir-img-valid", "testing/manifest:latest")
+	res, err := pc.DiagnoseRunningImage(context.Background(), img)
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	for _, r := range res {
+		assertRunningAllowed(t, r.Allowed, r.Err)
+	}
+
+	// All failures are reported, in order; allowed requirements are reported as well
+	img = pcImageMock(t, "fixtures/dir-img-unsigned", "testing/manifest:multipleFailures")
+	res, err = pc.DiagnoseRunningImage(context.Background(), img)
+	require.NoError(t, err)
+	reqs := pc.Policy.Transports["docker"]["docker.io/testing/manifest:multipleFailures"]
+	require.Len(t, res, len(reqs))
+	for i, r := range res {
+		assert.Equal(t, reqs[i], r.Requirement)
+	}
+	assertRunningRejectedPolicyRequirement(t, res[0].Allowed, res[0].Err)
+	assertRunningAllowed(t, res[1].Allowed, res[1].Err)
+	assertRunningRejectedPolicyRequirement(t, res[2].Allowed, res[2].Err)
+	// The enforcing API is not affected
+	allowed, err := pc.IsRunningImageAllowed(context.Background(), img)
+	assertRunningRejectedPolicyRequirement(t, allowed, err)
+	assert.Equal(t, res[0].Err, err)
+
+	// Err is set iff !Allowed, even if a requirement returns inconsistent values
+	img = pcImageMock(t, "fixtures/dir-img-valid", "testing/manifest:inconsistentRequirements")
+	res, err = pc.DiagnoseRunningImage(context.Background(), img)
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	assertRunningRejectedPolicyRequirement(t, res[0].Allowed, res[0].Err)
+	assertRunningAllowed(t, res[1].Allowed, res[1].Err)
+
+	// Empty list of requirements (invalid)
+	img = pcImageMock(t, "fixtures/dir-img-valid", "testing/manifest:invalidEmptyRequirements")
+	res, err = pc.DiagnoseRunningImage(context.Background(), img)
+	assert.IsType(t, PolicyRequirementError(""), err)
+	assert.Nil(t, res)
+
+	// Unexpected state (context already destroyed)
+	destroyedPC, err := NewPolicyContext(pc.Policy)
+	require.NoError(t, err)
+	err = destroyedPC.Destroy()
+	require.NoError(t, err)
+	img = pcImageMock(t, "fixtures/dir-img-valid", "testing/manifest:latest")
+	res, err = destroyedPC.DiagnoseRunningImage(context.Background(), img)
+	assert.Error(t, err)
+	assert.Nil(t, res)
+}
+
 // Helpers for validating PolicyRequirement.isSignatureAuthorAccepted results:
 
 // assertSARRejected verifies that isSignatureAuthorAccepted returns a consistent sarRejected result
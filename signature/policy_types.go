@@ -6,6 +6,10 @@
 
 package signature
 
+import (
+	digest "github.com/opencontainers/go-digest"
+)
+
 // NOTE: Keep this in sync with docs/containers-policy.json.5.md!
 
 // Policy defines requirements for considering a signature, or an image, valid.
@@ -47,6 +51,9 @@ const (
 	prTypeSignedBy               prTypeIdentifier = "signedBy"
 	prTypeSignedBaseLayer        prTypeIdentifier = "signedBaseLayer"
 	prTypeSigstoreSigned         prTypeIdentifier = "sigstoreSigned"
+	prTypeAllowlistByDigest      prTypeIdentifier = "allowlistByDigest"
+	prTypeAppliesToManifestKind  prTypeIdentifier = "appliesToManifestKind"
+	prTypeAnyOf                  prTypeIdentifier = "anyOf"
 )
 
 // prInsecureAcceptAnything is a PolicyRequirement with type = prTypeInsecureAcceptAnything:
@@ -145,8 +152,41 @@ type prSigstoreSigned struct {
 	// Defaults to "matchRepoDigestOrExact" if not specified.
 	// Note that /usr/bin/cosign interoperability might require using repo-only matching.
 	SignedIdentity PolicyReferenceMatch `json:"signedIdentity"`
+
+	// MaxSignatureAgeDays, if not 0, requires an accepted signature to have been created at most this many days ago.
+	// The time of the signature is the Rekor inclusion time if a Rekor public key is specified, otherwise the signing time recorded in the signed payload.
+	MaxSignatureAgeDays int `json:"maxSignatureAgeDays,omitempty"`
+	// SignatureWithoutTimestamp specifies how signatures without a known time are handled if MaxSignatureAgeDays is set.
+	// Defaults to "reject" if not specified.
+	SignatureWithoutTimestamp sigstoreNoTimestampAction `json:"signatureWithoutTimestamp,omitempty"`
+
+	// ManifestCanonicalization specifies whether signatures of a canonicalized form of the manifest are accepted
+	// in addition to signatures of the exact manifest bytes.
+	// Defaults to "none" if not specified.
+	ManifestCanonicalization sigstoreManifestCanonicalization `json:"manifestCanonicalization,omitempty"`
 }
 
+// sigstoreNoTimestampAction are the allowed values for prSigstoreSigned.SignatureWithoutTimestamp
+type sigstoreNoTimestampAction string
+
+const (
+	// SigstoreNoTimestampReject rejects signatures without a known time, if a maximum signature age is required.
+	SigstoreNoTimestampReject sigstoreNoTimestampAction = "reject"
+	// SigstoreNoTimestampAccept accepts signatures without a known time, regardless of a maximum signature age.
+	SigstoreNoTimestampAccept sigstoreNoTimestampAction = "accept"
+)
+
+// sigstoreManifestCanonicalization are the allowed values for prSigstoreSigned.ManifestCanonicalization
+type sigstoreManifestCanonicalization string
+
+const (
+	// SigstoreManifestCanonicalizationNone only accepts signatures of the exact manifest bytes.
+	SigstoreManifestCanonicalizationNone sigstoreManifestCanonicalization = "none"
+	// SigstoreManifestCanonicalizationJSON also accepts signatures of the manifest re-encoded
+	// using the JSON Canonicalization Scheme (RFC 8785).
+	SigstoreManifestCanonicalizationJSON sigstoreManifestCanonicalization = "canonicalJSON"
+)
+
 // PRSigstoreSignedFulcio contains Fulcio configuration options for a "sigstoreSigned" PolicyRequirement.
 // This is a public type with a single private implementation.
 type PRSigstoreSignedFulcio interface {
@@ -167,6 +207,50 @@ type prSigstoreSignedFulcio struct {
 	SubjectEmail string `json:"subjectEmail,omitempty"`
 }
 
+// prAllowlistByDigest is a PolicyRequirement with type = prTypeAllowlistByDigest: the image is allowed to run
+// only if its manifest digest is one of an explicitly listed set; signatures are not considered.
+type prAllowlistByDigest struct {
+	prCommon
+
+	// Digests is a set of accepted manifest digests. Exactly one of Digests and DigestsPath must be specified.
+	Digests []digest.Digest `json:"digests,omitempty"`
+	// DigestsPath is a pathname to a local file containing accepted manifest digests, one per line;
+	// empty lines and lines starting with "#" are ignored. Exactly one of Digests and DigestsPath must be specified.
+	DigestsPath string `json:"digestsPath,omitempty"`
+}
+
+// prAppliesToManifestKind is a PolicyRequirement with type = prTypeAppliesToManifestKind: Requirement must be satisfied
+// by manifests of the specified ManifestKind; manifests of other kinds are not affected by this requirement.
+type prAppliesToManifestKind struct {
+	prCommon
+
+	// ManifestKind specifies the kind of manifests Requirement applies to.
+	ManifestKind manifestKind `json:"manifestKind"`
+	// Requirement is the requirement to enforce for manifests of ManifestKind.
+	Requirement PolicyRequirement `json:"requirement"`
+}
+
+// prAnyOf is a PolicyRequirement with type = prTypeAnyOf: the image is accepted if at least one of Requirements accepts it.
+// This allows e.g. accepting images signed by any one of several keys, whereas PolicyRequirements listed directly in a scope must all be satisfied.
+type prAnyOf struct {
+	prCommon
+
+	// Requirements is a non-empty list of alternative requirements.
+	Requirements PolicyRequirements `json:"requirements"`
+}
+
+// manifestKind are the allowed values for prAppliesToManifestKind.ManifestKind
+type manifestKind string
+
+const (
+	// ManifestKindImage refers to container images, including lists of images.
+	ManifestKindImage manifestKind = "image"
+	// ManifestKindArtifact refers to OCI artifacts (e.g. SBOMs or signatures stored in a registry) which can not be run as containers,
+	// i.e. single-image OCI manifests with a config that is not an image config. Manifests with an artifactType which do not satisfy
+	// this, and all manifest lists, are images.
+	ManifestKindArtifact manifestKind = "artifact"
+)
+
 // PolicyReferenceMatch specifies a set of image identities accepted in PolicyRequirement.
 // The type is public, but its implementation is private.
 
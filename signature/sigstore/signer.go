@@ -27,22 +27,42 @@ func WithPrivateKeyFile(file string, passphrase []byte) Option {
 		if err != nil {
 			return fmt.Errorf("reading private key from %s: %w", file, err)
 		}
-		signerVerifier, err := loadPrivateKey(privateKeyPEM, passphrase)
-		if err != nil {
-			return fmt.Errorf("initializing private key: %w", err)
-		}
-		publicKey, err := signerVerifier.PublicKey()
-		if err != nil {
-			return fmt.Errorf("getting public key from private key: %w", err)
+		return withPrivateKeyPEM(s, privateKeyPEM, passphrase)
+	}
+}
+
+// WithPrivateKey is like WithPrivateKeyFile, but uses the contents of a private key file, privateKeyPEM.
+func WithPrivateKey(privateKeyPEM []byte, passphrase []byte) Option {
+	return func(s *internal.SigstoreSigner) error {
+		if s.PrivateKey != nil {
+			return fmt.Errorf("multiple private key sources specified when preparing to create sigstore signatures")
 		}
-		publicKeyPEM, err := cryptoutils.MarshalPublicKeyToPEM(publicKey)
-		if err != nil {
-			return fmt.Errorf("converting public key to PEM: %w", err)
+
+		if passphrase == nil {
+			return errors.New("private key passphrase not provided")
 		}
-		s.PrivateKey = signerVerifier
-		s.SigningKeyOrCert = publicKeyPEM
-		return nil
+
+		return withPrivateKeyPEM(s, privateKeyPEM, passphrase)
+	}
+}
+
+// withPrivateKeyPEM is the shared implementation of WithPrivateKeyFile and WithPrivateKey.
+func withPrivateKeyPEM(s *internal.SigstoreSigner, privateKeyPEM []byte, passphrase []byte) error {
+	signerVerifier, err := loadPrivateKey(privateKeyPEM, passphrase)
+	if err != nil {
+		return fmt.Errorf("initializing private key: %w", err)
+	}
+	publicKey, err := signerVerifier.PublicKey()
+	if err != nil {
+		return fmt.Errorf("getting public key from private key: %w", err)
+	}
+	publicKeyPEM, err := cryptoutils.MarshalPublicKeyToPEM(publicKey)
+	if err != nil {
+		return fmt.Errorf("converting public key to PEM: %w", err)
 	}
+	s.PrivateKey = signerVerifier
+	s.SigningKeyOrCert = publicKeyPEM
+	return nil
 }
 
 func NewSigner(opts ...Option) (*signer.Signer, error) {
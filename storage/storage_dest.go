@@ -4,6 +4,7 @@
 package storage
 
 import (
+	"archive/tar"
 	"bytes"
 	"context"
 	"encoding/json"
@@ -13,8 +14,10 @@ import (
 	"os"
 	"path/filepath"
 	"slices"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/internal/image"
@@ -51,6 +54,10 @@ var (
 	ErrBlobSizeMismatch = errors.New("blob size mismatch")
 )
 
+// defaultMaxUncompressedLayerSize is the default limit on the uncompressed size of a layer, see
+// types.SystemContext.StorageMaxUncompressedLayerSize. It is intended to be large enough for any real-world layer.
+const defaultMaxUncompressedLayerSize = 1 << 40
+
 type storageImageDestination struct {
 	impl.Compat
 	impl.PropertyMethodsInitialize
@@ -67,6 +74,11 @@ type storageImageDestination struct {
 	signatures            []byte                   // Signature contents, temporary
 	signatureses          map[digest.Digest][]byte // Instance signature contents, temporary
 	metadata              storageImageMetadata     // Metadata contents being built
+	maxUncompressedSize   int64                    // The maximum uncompressed size of a layer
+	preserveCompressed    bool                     // Record the original form of compressed layers, from types.SystemContext.StoragePreserveCompressedLayers
+	skipXattrPrefixes     []string                 // Extended attributes to remove from layers, from types.SystemContext.StorageSkipXattrPrefixes
+	creationDateOverride  *time.Time               // From types.SystemContext.StorageCreationDateOverride
+	recordDigestedName    bool                     // From types.SystemContext.StorageRecordDigestedName
 
 	// Mapping from layer (by index) to the associated ID in the storage.
 	// It's protected *implicitly* since `commitLayer()`, at any given
@@ -141,6 +153,28 @@ type addedLayerInfo struct {
 // newImageDestination sets us up to write a new image, caching blobs in a temporary directory until
 // it's time to Commit() the image
 func newImageDestination(sys *types.SystemContext, imageRef storageReference) (*storageImageDestination, error) {
+	mustMatchRuntimeOS := true
+	if sys != nil && sys.StorageAllowForeignPlatform {
+		if sys.ArchitectureChoice != "" || sys.OSChoice != "" || sys.VariantChoice != "" {
+			return nil, errors.New("StorageAllowForeignPlatform can not be combined with ArchitectureChoice, OSChoice or VariantChoice")
+		}
+		mustMatchRuntimeOS = false
+	}
+	maxUncompressedSize := int64(defaultMaxUncompressedLayerSize)
+	if sys != nil && sys.StorageMaxUncompressedLayerSize > 0 {
+		maxUncompressedSize = sys.StorageMaxUncompressedLayerSize
+	}
+	preserveCompressed := sys != nil && sys.StoragePreserveCompressedLayers
+	recordDigestedName := sys != nil && sys.StorageRecordDigestedName
+	var skipXattrPrefixes []string
+	var creationDateOverride *time.Time
+	if sys != nil {
+		skipXattrPrefixes = slices.Clone(sys.StorageSkipXattrPrefixes)
+		if sys.StorageCreationDateOverride != nil {
+			date := *sys.StorageCreationDateOverride
+			creationDateOverride = &date
+		}
+	}
 	directory, err := tmpdir.MkDirBigFileTemp(sys, "storage")
 	if err != nil {
 		return nil, fmt.Errorf("creating a temporary directory: %w", err)
@@ -158,7 +192,7 @@ func newImageDestination(sys *types.SystemContext, imageRef storageReference) (*
 			// types can be set accordingly.
 			DesiredLayerCompression:        types.PreserveOriginal,
 			AcceptsForeignLayerURLs:        false,
-			MustMatchRuntimeOS:             true,
+			MustMatchRuntimeOS:             mustMatchRuntimeOS,
 			IgnoresEmbeddedDockerReference: true, // Yes, we want the unmodified manifest
 			HasThreadSafePutBlob:           true,
 		}),
@@ -170,7 +204,12 @@ func newImageDestination(sys *types.SystemContext, imageRef storageReference) (*
 			SignatureSizes:  []int{},
 			SignaturesSizes: make(map[digest.Digest][]int),
 		},
-		indexToStorageID: make(map[int]string),
+		maxUncompressedSize:  maxUncompressedSize,
+		preserveCompressed:   preserveCompressed,
+		skipXattrPrefixes:    skipXattrPrefixes,
+		creationDateOverride: creationDateOverride,
+		recordDigestedName:   recordDigestedName,
+		indexToStorageID:     make(map[int]string),
 		lockProtected: storageImageDestinationLockProtected{
 			indexToAddedLayerInfo: make(map[int]addedLayerInfo),
 
@@ -272,7 +311,15 @@ func (s *storageImageDestination) putBlobToPendingFile(stream io.Reader, blobinf
 	if err != nil {
 		return private.UploadedBlob{}, fmt.Errorf("creating temporary file %q: %w", filename, err)
 	}
-	defer file.Close()
+	succeeded := false
+	defer func() {
+		file.Close()
+		if !succeeded {
+			if err := os.Remove(filename); err != nil {
+				logrus.Debugf("Error removing temporary file %q: %v", filename, err)
+			}
+		}
+	}()
 	counter := ioutils.NewWriteCounter(file)
 	stream = io.TeeReader(stream, counter)
 	digester, stream := putblobdigest.DigestIfUnknown(stream, blobinfo)
@@ -284,11 +331,15 @@ func (s *storageImageDestination) putBlobToPendingFile(stream io.Reader, blobinf
 	diffID := digest.Canonical.Digester()
 	// Copy the data to the file.
 	// TODO: This can take quite some time, and should ideally be cancellable using context.Context.
-	_, err = io.Copy(diffID.Hash(), decompressed)
+	// Read at most one byte more than the limit, so that we can detect exceeding it.
+	uncompressedSize, err := io.Copy(diffID.Hash(), io.LimitReader(decompressed, s.maxUncompressedSize+1))
 	decompressed.Close()
 	if err != nil {
 		return private.UploadedBlob{}, fmt.Errorf("storing blob to file %q: %w", filename, err)
 	}
+	if uncompressedSize > s.maxUncompressedSize {
+		return private.UploadedBlob{}, fmt.Errorf("uncompressed contents of blob exceed the maximum allowed size of %d bytes", s.maxUncompressedSize)
+	}
 
 	// Determine blob properties, and fail if information that we were given about the blob
 	// is known to be incorrect.
@@ -306,6 +357,7 @@ func (s *storageImageDestination) putBlobToPendingFile(stream io.Reader, blobinf
 	s.lockProtected.fileSizes[blobDigest] = counter.Count
 	s.lockProtected.filenames[blobDigest] = filename
 	s.lock.Unlock()
+	succeeded = true
 	// This is safe because we have just computed diffID, and blobDigest was either computed
 	// by us, or validated by the caller (usually copy.digestingReader).
 	options.Cache.RecordDigestUncompressedPair(blobDigest, diffID.Digest())
@@ -346,6 +398,10 @@ func (f *zstdFetcher) GetBlobAt(chunks []chunked.ImageSourceChunk) (chan io.Read
 // If the call fails with ErrFallbackToOrdinaryLayerDownload, the caller can fall back to PutBlobWithOptions.
 // The fallback _must not_ be done otherwise.
 func (s *storageImageDestination) PutBlobPartial(ctx context.Context, chunkAccessor private.BlobChunkAccessor, srcInfo types.BlobInfo, options private.PutBlobPartialOptions) (_ private.UploadedBlob, retErr error) {
+	if len(s.skipXattrPrefixes) != 0 {
+		// Partially-pulled layers are applied by c/storage directly, we have no way to filter their extended attributes.
+		return private.UploadedBlob{}, private.NewErrFallbackToOrdinaryLayerDownload(errors.New("partial pulls can not be combined with StorageSkipXattrPrefixes"))
+	}
 	inputTOCDigest, err := toc.GetTOCDigest(srcInfo.Annotations)
 	if err != nil {
 		return private.UploadedBlob{}, err
@@ -822,6 +878,11 @@ func (s *storageImageDestination) computeID(m manifest.Manifest) (string, error)
 	if err != nil {
 		return "", err
 	}
+	// m.ImageID uses the config digest as is; if it does not use digest.Canonical (e.g. a sha512 digest),
+	// it is not a valid c/storage image ID, so derive one from it.
+	if validateImageID(ordinaryImageID) != nil {
+		ordinaryImageID = digest.Canonical.FromString(ordinaryImageID).Encoded()
+	}
 	tocIDInput := ""
 	hasLayerPulledByTOC := false
 	for i, li := range layerInfos {
@@ -837,14 +898,21 @@ func (s *storageImageDestination) computeID(m manifest.Manifest) (string, error)
 		tocIDInput += layerValue + "|" // "|" can not be present in a TOC digest, so this is an unambiguous separator.
 	}
 
-	if !hasLayerPulledByTOC {
-		return ordinaryImageID, nil
+	imageID := ordinaryImageID
+	if hasLayerPulledByTOC {
+		// ordinaryImageID is a digest of a config, which is a JSON value.
+		// To avoid the risk of collisions, start the input with @ so that the input is not a valid JSON.
+		imageID = digest.FromString("@With TOC:" + tocIDInput).Encoded()
+		logrus.Debugf("Ordinary storage image ID %s; a layer was looked up by TOC, so using image ID %s", ordinaryImageID, imageID)
 	}
-	// ordinaryImageID is a digest of a config, which is a JSON value.
-	// To avoid the risk of collisions, start the input with @ so that the input is not a valid JSON.
-	tocImageID := digest.FromString("@With TOC:" + tocIDInput).Encoded()
-	logrus.Debugf("Ordinary storage image ID %s; a layer was looked up by TOC, so using image ID %s", ordinaryImageID, tocImageID)
-	return tocImageID, nil
+	if len(s.skipXattrPrefixes) != 0 {
+		// The layers have been modified, so the image must not be shared with an image stored without filtering
+		// (or with different prefixes). "|" can not be present in imageID, so this is unambiguous.
+		filteredImageID := digest.FromString("@With skipped xattrs:" + canonicalXattrPrefixes(s.skipXattrPrefixes) + "|" + imageID).Encoded()
+		logrus.Debugf("Storage image ID %s; extended attributes are filtered, so using image ID %s", imageID, filteredImageID)
+		imageID = filteredImageID
+	}
+	return imageID, nil
 }
 
 // getConfigBlob exists only to let us retrieve the configuration blob so that the manifest package can dig
@@ -1021,7 +1089,9 @@ func (s *storageImageDestination) commitLayer(index int, info addedLayerInfo, si
 		}
 	}
 
-	id := layerID(parentLayer, trusted)
+	// The ID depends on parentLayer, so a layer repeated in the manifest (even consecutively) is committed as a separate
+	// layer at each position in the chain; storageImageSource.getBlobAndLayerID relies on this.
+	id := layerID(parentLayer, trusted, s.skipXattrPrefixes)
 
 	if layer, err2 := s.imageRef.transport.store.Layer(id); layer != nil && err2 == nil {
 		// There's already a layer that should have the right contents, just reuse it.
@@ -1040,8 +1110,9 @@ func (s *storageImageDestination) commitLayer(index int, info addedLayerInfo, si
 	return false, nil
 }
 
-// layerID computes a layer (“chain”) ID for (a possibly-empty parentID, trusted)
-func layerID(parentID string, trusted trustedLayerIdentityData) string {
+// layerID computes a layer (“chain”) ID for (a possibly-empty parentID, trusted), with extended attributes matching
+// skipXattrPrefixes removed.
+func layerID(parentID string, trusted trustedLayerIdentityData, skipXattrPrefixes []string) string {
 	var component string
 	mustHash := false
 	if trusted.layerIdentifiedByTOC {
@@ -1049,8 +1120,19 @@ func layerID(parentID string, trusted trustedLayerIdentityData) string {
 		// But we _must_ hash this below to get a Digest.Encoded()-formatted value.
 		component = "@TOC=" + trusted.tocDigest.Encoded()
 		mustHash = true
-	} else {
+	} else if trusted.diffID.Algorithm() == digest.Canonical {
 		component = trusted.diffID.Encoded() // This looks like chain IDs, and it uses the traditional value.
+	} else {
+		// Other algorithms (e.g. sha512) don’t produce a valid layer ID, so hash them; include the algorithm name
+		// so that this is unambiguous with the digest.Canonical case.
+		component = trusted.diffID.String()
+		mustHash = true
+	}
+	if len(skipXattrPrefixes) != 0 {
+		// The filtered layer has different contents, so it must not share an ID with the original layer
+		// (or with a layer filtered using different prefixes).  "+" does not occur in any of the values above.
+		component += "+skipXattrPrefixes=" + canonicalXattrPrefixes(skipXattrPrefixes)
+		mustHash = true
 	}
 
 	if parentID == "" && !mustHash {
@@ -1059,6 +1141,19 @@ func layerID(parentID string, trusted trustedLayerIdentityData) string {
 	return digest.Canonical.FromString(parentID + "+" + component).Encoded()
 }
 
+// canonicalXattrPrefixes returns a representation of prefixes (e.g. from StorageSkipXattrPrefixes) suitable for computing IDs:
+// it does not depend on the order of prefixes, or duplicates.
+func canonicalXattrPrefixes(prefixes []string) string {
+	prefixes = slices.Clone(prefixes)
+	slices.Sort(prefixes)
+	prefixes = slices.Compact(prefixes)
+	res, err := json.Marshal(prefixes)
+	if err != nil { // This should never happen for a []string.
+		panic(fmt.Sprintf("internal error: marshaling %#v: %v", prefixes, err))
+	}
+	return string(res)
+}
+
 // createNewLayer creates a new layer newLayerID for (index, trusted) on top of parentLayer (which may be "").
 // If the layer cannot be committed yet, the function returns (nil, nil).
 func (s *storageImageDestination) createNewLayer(index int, trusted trustedLayerIdentityData, parentLayer, newLayerID string) (*storage.Layer, error) {
@@ -1253,20 +1348,92 @@ func (s *storageImageDestination) createNewLayer(index int, trusted trustedLayer
 		return nil, fmt.Errorf("opening file %q: %w", filename, err)
 	}
 	defer file.Close()
+	var diff io.Reader = file
+	trustedUncompressedDigest := trusted.diffID
+	if len(s.skipXattrPrefixes) != 0 {
+		filtered, err := filterLayerXattrs(file, s.skipXattrPrefixes)
+		if err != nil {
+			return nil, fmt.Errorf("filtering extended attributes of layer with blob %s: %w", trusted.logString(), err)
+		}
+		defer filtered.Close()
+		diff = filtered
+		// The stream no longer matches the original blob, don’t let c/storage record the original digests for it;
+		// PutLayer computes the digests of the filtered stream instead, so that the layer is never found, and reused,
+		// as if it had the original contents.
+		trustedOriginalDigest = ""
+		trustedOriginalSize = nil
+		trustedUncompressedDigest = ""
+	}
 	// Build the new layer using the diff, regardless of where it came from.
 	// TODO: This can take quite some time, and should ideally be cancellable using ctx.Done().
 	layer, _, err := s.imageRef.transport.store.PutLayer(newLayerID, parentLayer, nil, "", false, &storage.LayerOptions{
 		OriginalDigest: trustedOriginalDigest,
 		OriginalSize:   trustedOriginalSize, // nil in many cases
-		// This might be "" if trusted.layerIdentifiedByTOC; in that case PutLayer will compute the value from the stream.
-		UncompressedDigest: trusted.diffID,
-	}, file)
+		// This might be "" if trusted.layerIdentifiedByTOC, or if the layer was filtered; in that case PutLayer will compute the value from the stream.
+		UncompressedDigest: trustedUncompressedDigest,
+	}, diff)
 	if err != nil && !errors.Is(err, storage.ErrDuplicateID) {
 		return nil, fmt.Errorf("adding layer with blob %s: %w", trusted.logString(), err)
 	}
 	return layer, nil
 }
 
+// filterLayerXattrs returns the uncompressed tar stream of the layer in stream, without extended attributes
+// with names starting with any of prefixes.
+// The caller must close the returned stream.
+func filterLayerXattrs(stream io.Reader, prefixes []string) (io.ReadCloser, error) {
+	decompressed, err := archive.DecompressStream(stream)
+	if err != nil {
+		return nil, err
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		err := copyTarWithoutXattrs(pw, decompressed, prefixes)
+		decompressed.Close()
+		_ = pw.CloseWithError(err) // CloseWithError(nil) is equivalent to Close()
+	}()
+	return pr, nil
+}
+
+// copyTarWithoutXattrs copies the tar stream from src to dest, removing extended attributes with names
+// starting with any of prefixes.
+func copyTarWithoutXattrs(dest io.Writer, src io.Reader, prefixes []string) error {
+	skipped := func(name string) bool {
+		return slices.ContainsFunc(prefixes, func(prefix string) bool {
+			return strings.HasPrefix(name, prefix)
+		})
+	}
+	tr := tar.NewReader(src)
+	tw := tar.NewWriter(dest)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		for key := range hdr.PAXRecords {
+			if name, ok := strings.CutPrefix(key, archive.PaxSchilyXattr); ok && skipped(name) {
+				logrus.Debugf("Removing extended attribute %q of %q", name, hdr.Name)
+				delete(hdr.PAXRecords, key)
+			}
+		}
+		for name := range hdr.Xattrs { //nolint:staticcheck // Xattrs is deprecated, but tar.Reader still sets it, and tar.Writer uses it.
+			if skipped(name) {
+				delete(hdr.Xattrs, name) //nolint:staticcheck // Xattrs is deprecated, but tar.Reader still sets it, and tar.Writer uses it.
+			}
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
 // uncommittedImageSource allows accessing an image’s metadata (not layers) before it has been committed,
 // to allow using image.FromUnparsedImage.
 type uncommittedImageSource struct {
@@ -1396,6 +1563,54 @@ func (s *storageImageDestination) setUntrustedDiffIDValuesFromOCIConfig(config *
 	}
 }
 
+// preserveCompressedLayers records the original form of compressed layers we have received as files, as big data
+// of the corresponding layers, so that storageImageSource can offer them instead of the uncompressed layer contents.
+// Layers which were reused or pulled partially are not available in this form, and are not recorded.
+func (s *storageImageDestination) preserveCompressedLayers(layerBlobs []manifest.LayerInfo) error {
+	for i, blob := range layerBlobs {
+		if blob.EmptyLayer {
+			continue
+		}
+		filename, ok := s.lockProtected.filenames[blob.Digest]
+		if !ok || s.lockProtected.blobDiffIDs[blob.Digest] == blob.Digest {
+			continue
+		}
+		layerID, ok := s.indexToStorageID[i]
+		if !ok {
+			return fmt.Errorf("Internal error: storageImageDestination.preserveCompressedLayers(): layer %d hasn't been committed", i)
+		}
+		key, err := compressedLayerBigDataKey(blob.Digest)
+		if err != nil {
+			return err
+		}
+		layer, err := s.imageRef.transport.store.Layer(layerID)
+		if err != nil {
+			return err
+		}
+		if slices.Contains(layer.BigDataNames, key) {
+			continue
+		}
+		if err := s.preserveCompressedLayer(layerID, key, filename); err != nil {
+			if errors.Is(err, storage.ErrLayerUnknown) { // The layer is in a read-only additional store
+				logrus.Debugf("Not recording compressed layer blob %q for layer %q: %v", blob.Digest, layerID, err)
+				continue
+			}
+			return fmt.Errorf("recording compressed layer blob %q for layer %q: %w", blob.Digest, layerID, err)
+		}
+	}
+	return nil
+}
+
+// preserveCompressedLayer stores the contents of filename as big data item key of layerID.
+func (s *storageImageDestination) preserveCompressedLayer(layerID, key, filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return s.imageRef.transport.store.SetLayerBigData(layerID, key, file)
+}
+
 // CommitWithOptions marks the process of storing the image as successful and asks for the image to be persisted.
 // WARNING: This does not have any transactional semantics:
 // - Uploaded data MAY be visible to others before CommitWithOptions() is called
@@ -1448,6 +1663,11 @@ func (s *storageImageDestination) CommitWithOptions(ctx context.Context, options
 			return fmt.Errorf("Internal error: storageImageDestination.CommitWithOptions(): commitLayer() not ready to commit for layer %q", blob.Digest)
 		}
 	}
+	if s.preserveCompressed {
+		if err := s.preserveCompressedLayers(layerBlobs); err != nil {
+			return err
+		}
+	}
 	var lastLayer string
 	if len(layerBlobs) > 0 { // Zero-layer images rarely make sense, but it is technically possible, and may happen for non-image artifacts.
 		prev, ok := s.indexToStorageID[len(layerBlobs)-1]
@@ -1460,7 +1680,10 @@ func (s *storageImageDestination) CommitWithOptions(ctx context.Context, options
 	// If one of those blobs was a configuration blob, then we can try to dig out the date when the image
 	// was originally created, in case we're just copying it.  If not, no harm done.
 	imgOptions := &storage.ImageOptions{}
-	if inspect, err := man.Inspect(s.getConfigBlob); err == nil && inspect.Created != nil {
+	if s.creationDateOverride != nil {
+		logrus.Debugf("setting image creation date to %s, as requested", *s.creationDateOverride)
+		imgOptions.CreationDate = *s.creationDateOverride
+	} else if inspect, err := man.Inspect(s.getConfigBlob); err == nil && inspect.Created != nil {
 		logrus.Debugf("setting image creation date to %s", inspect.Created)
 		imgOptions.CreationDate = *inspect.Created
 	}
@@ -1602,10 +1825,20 @@ func (s *storageImageDestination) CommitWithOptions(ctx context.Context, options
 	// Add the reference's name on the image.  We don't need to worry about avoiding duplicate
 	// values because AddNames() will deduplicate the list that we pass to it.
 	if name := s.imageRef.DockerReference(); name != nil {
-		if err := s.imageRef.transport.store.AddNames(img.ID, []string{name.String()}); err != nil {
-			return fmt.Errorf("adding names %v to image %q: %w", name, img.ID, err)
+		names := []string{name.String()}
+		if s.recordDigestedName {
+			digestedName, err := digestedNameForTag(name, toplevelManifest)
+			if err != nil {
+				return err
+			}
+			if digestedName != nil {
+				names = append(names, digestedName.String())
+			}
 		}
-		logrus.Debugf("added name %q to image %q", name, img.ID)
+		if err := s.imageRef.transport.store.AddNames(img.ID, names); err != nil {
+			return fmt.Errorf("adding names %v to image %q: %w", names, img.ID, err)
+		}
+		logrus.Debugf("added names %v to image %q", names, img.ID)
 	}
 	if options.ReportResolvedReference != nil {
 		// FIXME? This is using nil for the named reference.
@@ -1627,6 +1860,26 @@ func (s *storageImageDestination) CommitWithOptions(ctx context.Context, options
 	return nil
 }
 
+// digestedNameForTag returns a repo@digest reference for the repository of name and toplevelManifest,
+// if name is a tagged reference without a digest; or nil otherwise.
+func digestedNameForTag(name reference.Named, toplevelManifest []byte) (reference.Named, error) {
+	if _, ok := name.(reference.Tagged); !ok {
+		return nil, nil
+	}
+	if _, ok := name.(reference.Digested); ok {
+		return nil, nil
+	}
+	manifestDigest, err := manifest.Digest(toplevelManifest)
+	if err != nil {
+		return nil, fmt.Errorf("digesting top-level manifest: %w", err)
+	}
+	digestedName, err := reference.WithDigest(reference.TrimNamed(name), manifestDigest)
+	if err != nil {
+		return nil, fmt.Errorf("creating a digested name for %s: %w", name.String(), err)
+	}
+	return digestedName, nil
+}
+
 // PutManifest writes the manifest to the destination.
 func (s *storageImageDestination) PutManifest(ctx context.Context, manifestBlob []byte, instanceDigest *digest.Digest) error {
 	digest, err := manifest.Digest(manifestBlob)
@@ -75,6 +75,20 @@ func TestLayerID(t *testing.T) {
 			tocDigest:       "sha256:cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc",
 			expected:        "468becc3d25ee862f81fd728d229a2b2487cfc9b3e6cf3a4d0af8c3fdde0e7a9",
 		},
+		{
+			parentID:        "",
+			identifiedByTOC: false,
+			diffID:          "sha512:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+			tocDigest:       "",
+			expected:        "8b0de859388c8854e25c8b227aec161807e0f594f3724a1f529a50554b940f94",
+		},
+		{
+			parentID:        "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb",
+			identifiedByTOC: false,
+			diffID:          "sha512:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+			tocDigest:       "",
+			expected:        "7a1155333e684021330c6cbc54cf6aff94f1bf42e2c4948b5e2d99713e6d1480",
+		},
 	} {
 		var diffID, tocDigest digest.Digest
 		if c.diffID != "" {
@@ -86,20 +100,25 @@ func TestLayerID(t *testing.T) {
 			require.NoError(t, err)
 		}
 
-		res := layerID(c.parentID, trustedLayerIdentityData{
+		trusted := trustedLayerIdentityData{
 			layerIdentifiedByTOC: c.identifiedByTOC,
 			diffID:               diffID,
 			tocDigest:            tocDigest,
 			blobDigest:           "",
-		})
+		}
+		res := layerID(c.parentID, trusted, nil)
 		assert.Equal(t, c.expected, res)
 		// blobDigest does not affect the layer ID
-		res = layerID(c.parentID, trustedLayerIdentityData{
-			layerIdentifiedByTOC: c.identifiedByTOC,
-			diffID:               diffID,
-			tocDigest:            tocDigest,
-			blobDigest:           blobDigest,
-		})
+		trustedWithBlobDigest := trusted
+		trustedWithBlobDigest.blobDigest = blobDigest
+		res = layerID(c.parentID, trustedWithBlobDigest, nil)
 		assert.Equal(t, c.expected, res)
+
+		// Filtering extended attributes changes the ID, depending on the set of prefixes but not on their order.
+		filtered := layerID(c.parentID, trusted, []string{"security.", "user."})
+		assert.NotEqual(t, c.expected, filtered)
+		assert.Regexp(t, "^[0-9a-f]{64}$", filtered)
+		assert.Equal(t, filtered, layerID(c.parentID, trusted, []string{"user.", "security.", "user."}))
+		assert.NotEqual(t, filtered, layerID(c.parentID, trusted, []string{"security."}))
 	}
 }
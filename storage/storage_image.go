@@ -37,6 +37,15 @@ func signatureBigDataKey(digest digest.Digest) (string, error) {
 	return "signature-" + digest.Encoded(), nil
 }
 
+// compressedLayerBigDataKey returns a key suitable for recording the original (compressed) form of a layer with the specified digest
+// using storage.Store.LayerBigData and related functions.
+func compressedLayerBigDataKey(digest digest.Digest) (string, error) {
+	if err := digest.Validate(); err != nil { // Make sure digest.String() uses the expected format and does not collide with other BigData keys.
+		return "", err
+	}
+	return "compressed-layer-" + digest.String(), nil
+}
+
 // storageImageMetadata is stored, as JSON, in storage.Image.Metadata
 type storageImageMetadata struct {
 	SignatureSizes  []int                   `json:"signature-sizes,omitempty"`  // List of sizes of each signature slice
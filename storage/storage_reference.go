@@ -5,11 +5,13 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"slices"
 	"strings"
 
 	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/image"
 	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/transports"
 	"github.com/containers/image/v5/types"
@@ -322,3 +324,107 @@ func ResolveReference(ref types.ImageReference) (types.ImageReference, *storage.
 	}
 	return clone, img, nil
 }
+
+// IsComplete returns true if all layers of the storage image referred to by ref, which must be a storage.Transport reference,
+// are present in the store.
+// It can be used to detect images left incomplete e.g. by an interrupted pull.
+//
+// If the image was pulled from a manifest list, the layers of the instance chosen for sys are checked.
+//
+// Returns an error matching ErrNoSuchImage if an image matching ref was not found.
+func IsComplete(ctx context.Context, sys *types.SystemContext, ref types.ImageReference) (bool, error) {
+	sref, ok := ref.(*storageReference)
+	if !ok {
+		return false, fmt.Errorf("trying to check completeness of a non-%s: reference %q", Transport.Name(),
+			transports.ImageName(ref))
+	}
+	src, err := newImageSource(sys, *sref)
+	if err != nil {
+		return false, err
+	}
+	defer src.Close()
+
+	var instanceDigest *digest.Digest
+	manifestBlob, manifestType, err := src.GetManifest(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("reading image manifest for %q: %w", src.image.ID, err)
+	}
+	if manifest.MIMETypeIsMultiImage(manifestType) {
+		list, err := manifest.ListFromBlob(manifestBlob, manifestType)
+		if err != nil {
+			return false, fmt.Errorf("parsing manifest list for %q: %w", src.image.ID, err)
+		}
+		instance, err := list.ChooseInstance(sys)
+		if err != nil {
+			return false, fmt.Errorf("choosing an image from manifest list for %q: %w", src.image.ID, err)
+		}
+		instanceDigest = &instance
+	}
+	img, err := image.FromUnparsedImage(ctx, sys, image.UnparsedInstance(src, instanceDigest))
+	if err != nil {
+		return false, fmt.Errorf("reading image %q: %w", src.image.ID, err)
+	}
+
+	// The layers of the image, the root layer first.
+	var layers []*storage.Layer
+	for layerID := src.image.TopLayer; layerID != ""; {
+		layer, err := sref.transport.store.Layer(layerID)
+		if err != nil {
+			if errors.Is(err, storage.ErrLayerUnknown) {
+				logrus.Debugf("Layer %q of image %q is missing", layerID, src.image.ID)
+				return false, nil
+			}
+			return false, fmt.Errorf("reading layer %q in image %q: %w", layerID, src.image.ID, err)
+		}
+		layers = append(layers, layer)
+		layerID = layer.Parent
+	}
+	slices.Reverse(layers)
+
+	if img.ConfigInfo().Digest == "" { // Schema1 manifests have no config, and so no DiffID values; only compare the number of layers.
+		manifestBlob, manifestType, err := img.Manifest(ctx)
+		if err != nil {
+			return false, fmt.Errorf("reading image manifest for %q: %w", src.image.ID, err)
+		}
+		man, err := manifest.FromBlob(manifestBlob, manifestType)
+		if err != nil {
+			return false, fmt.Errorf("parsing image manifest for %q: %w", src.image.ID, err)
+		}
+		expectedLayers := 0
+		for _, info := range man.LayerInfos() {
+			if !info.EmptyLayer {
+				expectedLayers++
+			}
+		}
+		if len(layers) < expectedLayers {
+			logrus.Debugf("Image %q has only %d out of %d layers", src.image.ID, len(layers), expectedLayers)
+			return false, nil
+		}
+		return true, nil
+	}
+
+	config, err := img.OCIConfig(ctx)
+	if err != nil {
+		return false, fmt.Errorf("reading config of image %q: %w", src.image.ID, err)
+	}
+	diffIDs := config.RootFS.DiffIDs
+	if len(layers) != len(diffIDs) {
+		logrus.Debugf("Image %q has %d layers, its config lists %d", src.image.ID, len(layers), len(diffIDs))
+		return false, nil
+	}
+	for i, diffID := range diffIDs {
+		if layers[i].UncompressedDigest == "" && layers[i].TOCDigest != "" {
+			// A layer pulled partially, without computing its uncompressed digest; we can’t match it to diffID.
+			continue
+		}
+		candidates, err := sref.transport.store.LayersByUncompressedDigest(diffID)
+		if err != nil && !errors.Is(err, storage.ErrLayerUnknown) {
+			return false, fmt.Errorf("looking up layers with DiffID %q: %w", diffID, err)
+		}
+		if !slices.ContainsFunc(candidates, func(l storage.Layer) bool { return l.ID == layers[i].ID }) {
+			logrus.Debugf("Layer %d of image %q, %q, does not match DiffID %q", i, src.image.ID, layers[i].ID, diffID)
+			return false, nil
+		}
+	}
+	return true, nil
+}
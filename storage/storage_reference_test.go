@@ -4,14 +4,18 @@
 package storage
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"testing"
 
 	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/pkg/blobinfocache/memory"
+	"github.com/containers/image/v5/types"
 	"github.com/containers/storage"
 	"github.com/containers/storage/pkg/archive"
+	digest "github.com/opencontainers/go-digest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -194,3 +198,104 @@ func TestResolveReference(t *testing.T) {
 		}
 	}
 }
+
+func TestIsComplete(t *testing.T) {
+	ensureTestCanCreateImages(t)
+
+	store := newStore(t)
+	cache := memory.New()
+
+	// A complete image
+	ref, err := Transport.ParseStoreReference(store, "test")
+	require.NoError(t, err)
+	createImage(t, ref, cache, []testBlob{makeLayer(t, archive.Gzip), makeLayer(t, archive.Gzip)}, nil)
+	complete, err := IsComplete(context.Background(), nil, ref)
+	require.NoError(t, err)
+	assert.True(t, complete)
+
+	_, img, err := ResolveReference(ref)
+	require.NoError(t, err)
+	manifestBlob, err := store.ImageBigData(img.ID, storage.ImageDigestBigDataKey)
+	require.NoError(t, err)
+	man, err := manifest.Schema2FromManifest(manifestBlob)
+	require.NoError(t, err)
+	configKey := man.ConfigInfo().Digest.String()
+	configBlob, err := store.ImageBigData(img.ID, configKey)
+	require.NoError(t, err)
+	// createImageRecord creates an image record named name, using topLayer and the manifest and config of the complete image,
+	// along with extraBigData.
+	createImageRecord := func(name, topLayer string, extraBigData ...storage.ImageBigDataOption) types.ImageReference {
+		created, err := store.CreateImage("", []string{name}, topLayer, "", &storage.ImageOptions{
+			BigData: append([]storage.ImageBigDataOption{
+				{Key: storage.ImageDigestBigDataKey, Data: manifestBlob},
+				{Key: configKey, Data: configBlob},
+			}, extraBigData...),
+		})
+		require.NoError(t, err)
+		ref, err := Transport.ParseStoreReference(store, "@"+created.ID)
+		require.NoError(t, err)
+		return ref
+	}
+
+	// An image missing a layer: reuse the manifest of the complete image, but only its bottom layer
+	topLayer, err := store.Layer(img.TopLayer)
+	require.NoError(t, err)
+	prunedRef := createImageRecord("pruned", topLayer.Parent)
+	complete, err = IsComplete(context.Background(), nil, prunedRef)
+	require.NoError(t, err)
+	assert.False(t, complete)
+
+	// An image with the right number of layers, but different contents
+	otherRef, err := Transport.ParseStoreReference(store, "other")
+	require.NoError(t, err)
+	createImage(t, otherRef, cache, []testBlob{makeLayer(t, archive.Gzip), makeLayer(t, archive.Gzip)}, nil)
+	_, otherImg, err := ResolveReference(otherRef)
+	require.NoError(t, err)
+	mismatchedRef := createImageRecord("mismatched", otherImg.TopLayer)
+	complete, err = IsComplete(context.Background(), nil, mismatchedRef)
+	require.NoError(t, err)
+	assert.False(t, complete)
+
+	// An image pulled from a manifest list
+	sys := &types.SystemContext{OSChoice: "linux", ArchitectureChoice: "amd64"}
+	manifestDigest := digest.FromBytes(manifestBlob)
+	list := manifest.Schema2ListFromComponents([]manifest.Schema2ManifestDescriptor{
+		{
+			Schema2Descriptor: manifest.Schema2Descriptor{
+				MediaType: manifest.DockerV2Schema2MediaType,
+				Size:      int64(len(manifestBlob)),
+				Digest:    manifestDigest,
+			},
+			Platform: manifest.Schema2PlatformSpec{OS: "linux", Architecture: "amd64"},
+		},
+	})
+	listBlob, err := list.Serialize()
+	require.NoError(t, err)
+	instanceKey, err := manifestBigDataKey(manifestDigest)
+	require.NoError(t, err)
+	for _, c := range []struct {
+		name     string
+		topLayer string
+		expected bool
+	}{
+		{"list-complete", img.TopLayer, true},
+		{"list-pruned", topLayer.Parent, false},
+	} {
+		listRef := createImageRecord(c.name, c.topLayer)
+		_, listImg, err := ResolveReference(listRef)
+		require.NoError(t, err, c.name)
+		err = store.SetImageBigData(listImg.ID, storage.ImageDigestBigDataKey, listBlob, manifest.Digest)
+		require.NoError(t, err, c.name)
+		err = store.SetImageBigData(listImg.ID, instanceKey, manifestBlob, manifest.Digest)
+		require.NoError(t, err, c.name)
+		complete, err = IsComplete(context.Background(), sys, listRef)
+		require.NoError(t, err, c.name)
+		assert.Equal(t, c.expected, complete, c.name)
+	}
+
+	// No such image
+	missingRef, err := Transport.ParseStoreReference(store, "nottest")
+	require.NoError(t, err)
+	_, err = IsComplete(context.Background(), nil, missingRef)
+	assert.ErrorIs(t, err, ErrNoSuchImage)
+}
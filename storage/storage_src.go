@@ -10,6 +10,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"slices"
 	"sync"
@@ -18,6 +19,8 @@ import (
 	"github.com/containers/image/v5/internal/image"
 	"github.com/containers/image/v5/internal/imagesource/impl"
 	"github.com/containers/image/v5/internal/imagesource/stubs"
+	"github.com/containers/image/v5/internal/iolimits"
+	"github.com/containers/image/v5/internal/private"
 	"github.com/containers/image/v5/internal/signature"
 	"github.com/containers/image/v5/internal/tmpdir"
 	"github.com/containers/image/v5/manifest"
@@ -50,6 +53,9 @@ type getBlobMutexProtected struct {
 	// digestToLayerID is a lookup map from a possibly-untrusted uncompressed layer digest (as returned by LayerInfosForCopy) to the
 	// layer ID in the store.
 	digestToLayerID map[digest.Digest]string
+	// compressedDigestToLayerID is a lookup map from a compressed layer digest (as returned by LayerInfosForCopy) to the
+	// ID of the layer in the store which records the compressed form of the layer.
+	compressedDigestToLayerID map[digest.Digest]string
 
 	// layerPosition stores where we are in reading a blob's layers
 	layerPosition map[digest.Digest]int
@@ -83,8 +89,9 @@ func newImageSource(sys *types.SystemContext, imageRef storageReference) (*stora
 			SignaturesSizes: make(map[digest.Digest][]int),
 		},
 		getBlobMutexProtected: getBlobMutexProtected{
-			digestToLayerID: make(map[digest.Digest]string),
-			layerPosition:   make(map[digest.Digest]int),
+			digestToLayerID:           make(map[digest.Digest]string),
+			compressedDigestToLayerID: make(map[digest.Digest]string),
+			layerPosition:             make(map[digest.Digest]int),
 		},
 	}
 	image.Compat = impl.AddCompat(image)
@@ -141,8 +148,17 @@ func (s *storageImageSource) GetBlob(ctx context.Context, info types.BlobInfo, c
 		layers, _ = s.imageRef.transport.store.LayersByUncompressedDigest(digest)
 	}
 
-	// If it's not a layer, then it must be a data item.
+	// If it's not a layer, then it must be the original form of a layer, if recorded, or a data item.
 	if len(layers) == 0 {
+		rc, size, found, err := s.getCompressedLayer(digest)
+		if err != nil {
+			return nil, 0, err
+		}
+		if found {
+			logrus.Debugf("exporting original compressed layer as blob %q", digest.String())
+			return rc, size, nil
+		}
+
 		b, err := s.imageRef.transport.store.ImageBigData(s.image.ID, digest.String())
 		if err != nil {
 			return nil, 0, err
@@ -242,46 +258,87 @@ func (s *storageImageSource) GetManifest(ctx context.Context, instanceDigest *di
 		if err != nil {
 			return nil, "", err
 		}
-		blob, err := s.imageRef.transport.store.ImageBigData(s.image.ID, key)
+		blob, err := s.manifestBigData(key)
 		if err != nil {
 			return nil, "", fmt.Errorf("reading manifest for image instance %q: %w", *instanceDigest, err)
 		}
+		if err := s.verifyManifestDigest(blob, *instanceDigest); err != nil {
+			return nil, "", err
+		}
 		return blob, manifest.GuessMIMEType(blob), err
 	}
 	if s.cachedManifest == nil {
+		var blob []byte
 		// The manifest is stored as a big data item.
 		// Prefer the manifest corresponding to the user-specified digest, if available.
+		var expectedDigest digest.Digest // "" if the user did not specify a digest
 		if s.imageRef.named != nil {
 			if digested, ok := s.imageRef.named.(reference.Digested); ok {
-				key, err := manifestBigDataKey(digested.Digest())
+				expectedDigest = digested.Digest()
+				key, err := manifestBigDataKey(expectedDigest)
 				if err != nil {
 					return nil, "", err
 				}
-				blob, err := s.imageRef.transport.store.ImageBigData(s.image.ID, key)
+				b, err := s.manifestBigData(key)
 				if err != nil && !os.IsNotExist(err) { // os.IsNotExist is true if the image exists but there is no data corresponding to key
 					return nil, "", err
 				}
 				if err == nil {
-					s.cachedManifest = blob
+					blob = b
 				}
 			}
 		}
 		// If the user did not specify a digest, or this is an old image stored before manifestBigDataKey was introduced, use the default manifest.
-		// Note that the manifest may not match the expected digest, and that is likely to fail eventually, e.g. in c/image/image/UnparsedImage.Manifest().
-		if s.cachedManifest == nil {
-			cachedBlob, err := s.imageRef.transport.store.ImageBigData(s.image.ID, storage.ImageDigestBigDataKey)
+		// Note that the manifest may not match the expected digest, and that is likely to fail eventually, e.g. in c/image/image/UnparsedImage.Manifest(),
+		// unless the user asked us to verify it right here.
+		if blob == nil {
+			b, err := s.manifestBigData(storage.ImageDigestBigDataKey)
 			if err != nil {
 				return nil, "", err
 			}
-			s.cachedManifest = cachedBlob
+			blob = b
 		}
+		if expectedDigest != "" {
+			if err := s.verifyManifestDigest(blob, expectedDigest); err != nil {
+				return nil, "", err
+			}
+		}
+		s.cachedManifest = blob
 		s.cachedManifestMIMEType = manifest.GuessMIMEType(s.cachedManifest)
 	}
 	return s.cachedManifest, s.cachedManifestMIMEType, err
 }
 
+// verifyManifestDigest returns an error if the user asked for manifests to be verified on read,
+// and blob does not match expectedDigest.
+func (s *storageImageSource) verifyManifestDigest(blob []byte, expectedDigest digest.Digest) error {
+	if s.systemContext == nil || !s.systemContext.StorageRequireManifestDigestMatch {
+		return nil
+	}
+	matches, err := manifest.MatchesDigest(blob, expectedDigest)
+	if err != nil {
+		return fmt.Errorf("verifying manifest of image %q: %w", s.image.ID, err)
+	}
+	if !matches {
+		return fmt.Errorf("manifest of image %q does not match the expected digest %s; the stored data may be corrupt", s.image.ID, expectedDigest)
+	}
+	return nil
+}
+
+// manifestBigData returns the contents of the big data item key, which contains a manifest,
+// refusing to read it if it is larger than the manifest size limit.
+func (s *storageImageSource) manifestBigData(key string) ([]byte, error) {
+	// If the size is unknown, let ImageBigData report a consistent error (notably, one which satisfies os.IsNotExist).
+	if size, err := s.imageRef.transport.store.ImageBigDataSize(s.image.ID, key); err == nil {
+		if limit := iolimits.ManifestSizeLimit(s.systemContext); size > int64(limit) {
+			return nil, fmt.Errorf("manifest %q of image %q has %d bytes, exceeding the maximum allowed size of %d bytes", key, s.image.ID, size, limit)
+		}
+	}
+	return s.imageRef.transport.store.ImageBigData(s.image.ID, key)
+}
+
 // LayerInfosForCopy() returns the list of layer blobs that make up the root filesystem of
-// the image, after they've been decompressed.
+// the image, after they've been decompressed, unless the original compressed form has been recorded.
 func (s *storageImageSource) LayerInfosForCopy(ctx context.Context, instanceDigest *digest.Digest) ([]types.BlobInfo, error) {
 	manifestBlob, manifestType, err := s.GetManifest(ctx, instanceDigest)
 	if err != nil {
@@ -304,6 +361,7 @@ func (s *storageImageSource) LayerInfosForCopy(ctx context.Context, instanceDige
 	}
 
 	physicalBlobInfos := []types.BlobInfo{} // Built reversed
+	physicalLayers := []*storage.Layer{}    // Built reversed, matching physicalBlobInfos
 	layerID := s.image.TopLayer
 	for layerID != "" {
 		layer, err := s.imageRef.transport.store.Layer(layerID)
@@ -344,17 +402,89 @@ func (s *storageImageSource) LayerInfosForCopy(ctx context.Context, instanceDige
 			MediaType: uncompressedLayerType,
 		}
 		physicalBlobInfos = append(physicalBlobInfos, blobInfo)
+		physicalLayers = append(physicalLayers, layer)
 		layerID = layer.Parent
 	}
 	slices.Reverse(physicalBlobInfos)
+	slices.Reverse(physicalLayers)
 
-	res, err := buildLayerInfosForCopy(man.LayerInfos(), physicalBlobInfos)
+	manifestInfos := man.LayerInfos()
+	res, err := buildLayerInfosForCopy(manifestInfos, physicalBlobInfos)
 	if err != nil {
 		return nil, fmt.Errorf("creating LayerInfosForCopy of image %q: %w", s.image.ID, err)
 	}
+	// If the original form of a layer was recorded (see types.SystemContext.StoragePreserveCompressedLayers),
+	// offer it instead of the uncompressed contents, so that the layer digests are preserved.
+	// (buildLayerInfosForCopy has verified that the non-empty layers match physicalLayers.)
+	nextPhysical := 0
+	for i, mi := range manifestInfos {
+		if mi.EmptyLayer {
+			continue
+		}
+		layer := physicalLayers[nextPhysical]
+		nextPhysical++
+		key, err := compressedLayerBigDataKey(mi.Digest)
+		if err != nil {
+			return nil, err
+		}
+		if slices.Contains(layer.BigDataNames, key) {
+			s.getBlobMutex.Lock()
+			s.getBlobMutexProtected.compressedDigestToLayerID[mi.Digest] = layer.ID
+			s.getBlobMutex.Unlock()
+			res[i] = types.BlobInfo{
+				Digest:    mi.Digest,
+				Size:      mi.Size,
+				MediaType: mi.MediaType,
+			}
+		}
+	}
 	return res, nil
 }
 
+// getCompressedLayer returns the original compressed form of a layer with the specified digest, and its size (or -1 if unknown),
+// if it was recorded (see types.SystemContext.StoragePreserveCompressedLayers) for one of the image’s layers.
+func (s *storageImageSource) getCompressedLayer(blobDigest digest.Digest) (io.ReadCloser, int64, bool, error) {
+	key, err := compressedLayerBigDataKey(blobDigest)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	s.getBlobMutex.Lock()
+	layerID, found := s.getBlobMutexProtected.compressedDigestToLayerID[blobDigest]
+	s.getBlobMutex.Unlock()
+	if !found {
+		// LayerInfosForCopy was not called; look for the item in all of the image’s layers.
+		for id := s.image.TopLayer; id != ""; {
+			layer, err := s.imageRef.transport.store.Layer(id)
+			if err != nil {
+				return nil, 0, false, fmt.Errorf("reading layer %q in image %q: %w", id, s.image.ID, err)
+			}
+			if slices.Contains(layer.BigDataNames, key) {
+				layerID, found = layer.ID, true
+				break
+			}
+			id = layer.Parent
+		}
+		if !found {
+			return nil, 0, false, nil
+		}
+	}
+	rc, err := s.imageRef.transport.store.LayerBigData(layerID, key)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	// The store does not record sizes of big data items, but it currently returns the underlying file.
+	size := int64(-1)
+	if f, ok := rc.(interface{ Stat() (fs.FileInfo, error) }); ok {
+		fi, err := f.Stat()
+		if err != nil {
+			rc.Close()
+			return nil, 0, false, fmt.Errorf("reading size of compressed layer blob %q: %w", blobDigest, err)
+		}
+		size = fi.Size()
+	}
+	return rc, size, true, nil
+}
+
 // buildLayerInfosForCopy builds a LayerInfosForCopy return value based on manifestInfos from the original manifest,
 // but using layer data which we can actually produce — physicalInfos for non-empty layers,
 // and image.GzippedEmptyLayer for empty ones.
@@ -430,6 +560,24 @@ func (s *storageImageSource) GetSignaturesWithFormat(ctx context.Context, instan
 	return res, nil
 }
 
+// GetSignaturesMetadata returns metadata of the image's signatures, in the same order as GetSignaturesWithFormat.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to describe signatures for
+// (when the primary manifest is a manifest list); this never happens if the primary manifest is not a manifest list
+// (e.g. if the source never returns manifest lists).
+//
+// This only uses the recorded signature sizes, without reading the signatures; so, the signature formats are not reported.
+func (s *storageImageSource) GetSignaturesMetadata(ctx context.Context, instanceDigest *digest.Digest) ([]private.SignatureMetadata, error) {
+	signatureSizes := s.metadata.SignatureSizes
+	if instanceDigest != nil {
+		signatureSizes = s.metadata.SignaturesSizes[*instanceDigest]
+	}
+	res := make([]private.SignatureMetadata, 0, len(signatureSizes))
+	for _, size := range signatureSizes {
+		res = append(res, private.SignatureMetadata{Size: int64(size)})
+	}
+	return res, nil
+}
+
 // getSize() adds up the sizes of the image's data blobs (which includes the configuration blob), the
 // signatures, and the uncompressed sizes of all of the image's layers.
 func (s *storageImageSource) getSize() (int64, error) {
@@ -6,6 +6,7 @@ package storage
 import (
 	"archive/tar"
 	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto/rand"
 	"crypto/sha256"
@@ -17,12 +18,18 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/containers/image/v5/copy"
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/imagesource"
 	imanifest "github.com/containers/image/v5/internal/manifest"
 	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/internal/testing/imagetest"
 	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/pkg/blobinfocache/memory"
 	"github.com/containers/image/v5/types"
@@ -350,7 +357,12 @@ func configForLayers(t *testing.T, layers []testBlob) testBlob {
 
 func createUncommittedImageDest(t *testing.T, ref types.ImageReference, cache types.BlobInfoCache,
 	layers []testBlob, config *testBlob) (types.ImageDestination, types.UnparsedImage) {
-	dest, err := ref.NewImageDestination(context.Background(), nil)
+	return createUncommittedImageDestWithSys(t, ref, nil, cache, layers, config)
+}
+
+func createUncommittedImageDestWithSys(t *testing.T, ref types.ImageReference, sys *types.SystemContext, cache types.BlobInfoCache,
+	layers []testBlob, config *testBlob) (types.ImageDestination, types.UnparsedImage) {
+	dest, err := ref.NewImageDestination(context.Background(), sys)
 	require.NoError(t, err)
 
 	layerDescriptors := []manifest.Schema2Descriptor{}
@@ -529,6 +541,14 @@ func TestWriteRead(t *testing.T) {
 		sigs2, err := src.GetSignatures(context.Background(), &instanceDigest)
 		require.NoError(t, err)
 		assert.Equal(t, sigs, sigs2)
+		limitedSrc, err := ref.NewImageSource(context.Background(), &types.SystemContext{MaxManifestSize: len(manifest) - 1})
+		require.NoError(t, err)
+		_, _, err = limitedSrc.GetManifest(context.Background(), nil)
+		assert.Error(t, err)
+		_, _, err = limitedSrc.GetManifest(context.Background(), &instanceDigest)
+		assert.Error(t, err)
+		err = limitedSrc.Close()
+		require.NoError(t, err)
 		for _, layerInfo := range layerInfos {
 			buf := bytes.Buffer{}
 			layer, size, err := src.GetBlob(context.Background(), layerInfo, cache)
@@ -561,6 +581,279 @@ func TestWriteRead(t *testing.T) {
 	}
 }
 
+func TestWriteReadSHA512(t *testing.T) {
+	ensureTestCanCreateImages(t)
+
+	store := newStore(t)
+	cache := memory.New()
+
+	ref, err := Transport.ParseReference("test")
+	require.NoError(t, err)
+
+	layer := makeLayer(t, archive.Gzip)
+	layer.compressedDigest = digest.SHA512.FromBytes(layer.data)
+	config := configForLayers(t, []testBlob{layer})
+	config.compressedDigest = digest.SHA512.FromBytes(config.data)
+	config.uncompressedDigest = config.compressedDigest
+	createImage(t, ref, cache, []testBlob{layer}, &config)
+
+	img, err := Transport.GetStoreImage(store, ref)
+	require.NoError(t, err)
+	assert.NoError(t, validateImageID(img.ID))
+
+	src, err := ref.NewImageSource(context.Background(), nil)
+	require.NoError(t, err)
+	defer src.Close()
+	manifestBlob, _, err := src.GetManifest(context.Background(), nil)
+	require.NoError(t, err)
+	m, err := manifest.Schema2FromManifest(manifestBlob)
+	require.NoError(t, err)
+	assert.Equal(t, config.compressedDigest, m.ConfigDescriptor.Digest)
+	require.Len(t, m.LayersDescriptors, 1)
+	assert.Equal(t, layer.compressedDigest, m.LayersDescriptors[0].Digest)
+
+	configReader, _, err := src.GetBlob(context.Background(), types.BlobInfo{Digest: config.compressedDigest, Size: -1}, cache)
+	require.NoError(t, err)
+	configBlob, err := io.ReadAll(configReader)
+	require.NoError(t, err)
+	configReader.Close()
+	assert.Equal(t, config.data, configBlob)
+
+	layerInfos, err := src.LayerInfosForCopy(context.Background(), nil)
+	require.NoError(t, err)
+	require.Len(t, layerInfos, 1)
+	assert.Equal(t, layer.uncompressedDigest, layerInfos[0].Digest)
+	layerReader, _, err := src.GetBlob(context.Background(), layerInfos[0], cache)
+	require.NoError(t, err)
+	layerBlob, err := io.ReadAll(layerReader)
+	require.NoError(t, err)
+	layerReader.Close()
+	assert.Equal(t, layer.uncompressedDigest, digest.FromBytes(layerBlob))
+}
+
+func TestStorageAllowForeignPlatform(t *testing.T) {
+	newStore(t)
+
+	ref, err := Transport.ParseReference("test")
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		sys        *types.SystemContext
+		mustMatch  bool
+		shouldFail bool
+	}{
+		{nil, true, false},
+		{&types.SystemContext{}, true, false},
+		{&types.SystemContext{StorageAllowForeignPlatform: true}, false, false},
+		{&types.SystemContext{StorageAllowForeignPlatform: true, ArchitectureChoice: "arm64"}, false, true},
+		{&types.SystemContext{StorageAllowForeignPlatform: true, OSChoice: "windows"}, false, true},
+		{&types.SystemContext{StorageAllowForeignPlatform: true, VariantChoice: "v8"}, false, true},
+	} {
+		dest, err := ref.NewImageDestination(context.Background(), c.sys)
+		if c.shouldFail {
+			assert.Error(t, err, "%#v", c.sys)
+			continue
+		}
+		require.NoError(t, err, "%#v", c.sys)
+		assert.Equal(t, c.mustMatch, dest.MustMatchRuntimeOS(), "%#v", c.sys)
+		err = dest.Close()
+		require.NoError(t, err)
+	}
+}
+
+func TestStorageMaxUncompressedLayerSize(t *testing.T) {
+	newStore(t)
+	cache := memory.New()
+
+	ref, err := Transport.ParseReference("test")
+	require.NoError(t, err)
+
+	// A highly compressible payload, expanding to 16 MiB.
+	var compressed bytes.Buffer
+	gzipWriter := gzip.NewWriter(&compressed)
+	_, err = gzipWriter.Write(make([]byte, 16*1024*1024))
+	require.NoError(t, err)
+	err = gzipWriter.Close()
+	require.NoError(t, err)
+	blobInfo := types.BlobInfo{Digest: digest.FromBytes(compressed.Bytes()), Size: int64(compressed.Len())}
+
+	for _, c := range []struct {
+		limit      int64
+		shouldFail bool
+	}{
+		{0, false}, // The default
+		{16 * 1024 * 1024, false},
+		{1024 * 1024, true},
+	} {
+		dest, err := ref.NewImageDestination(context.Background(), &types.SystemContext{StorageMaxUncompressedLayerSize: c.limit})
+		require.NoError(t, err)
+		_, err = dest.PutBlob(context.Background(), bytes.NewReader(compressed.Bytes()), blobInfo, cache, false)
+		entries, readDirErr := os.ReadDir(dest.(*storageImageDestination).directory)
+		require.NoError(t, readDirErr)
+		if c.shouldFail {
+			assert.ErrorContains(t, err, "exceed the maximum allowed size", c.limit)
+			assert.Empty(t, entries, c.limit)
+		} else {
+			assert.NoError(t, err, c.limit)
+			assert.Len(t, entries, 1, c.limit)
+		}
+		err = dest.Close()
+		require.NoError(t, err)
+	}
+}
+
+func TestStorageBigFilesTemporaryDir(t *testing.T) {
+	newStore(t)
+	cache := memory.New()
+
+	ref, err := Transport.ParseReference("test")
+	require.NoError(t, err)
+
+	tmpDir := t.TempDir()
+	dest, err := ref.NewImageDestination(context.Background(), &types.SystemContext{BigFilesTemporaryDir: tmpDir})
+	require.NoError(t, err)
+	defer dest.Close()
+	directory := dest.(*storageImageDestination).directory
+	assert.Equal(t, tmpDir, filepath.Dir(directory))
+
+	blob := []byte("blob contents")
+	_, err = dest.PutBlob(context.Background(), bytes.NewReader(blob), types.BlobInfo{Digest: digest.FromBytes(blob), Size: int64(len(blob))}, cache, false)
+	require.NoError(t, err)
+	entries, err := os.ReadDir(directory)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	// A missing directory is reported when creating the destination.
+	_, err = ref.NewImageDestination(context.Background(), &types.SystemContext{BigFilesTemporaryDir: filepath.Join(tmpDir, "does-not-exist")})
+	assert.ErrorContains(t, err, "BigFilesTemporaryDir")
+}
+
+func TestStorageRequireManifestDigestMatch(t *testing.T) {
+	ensureTestCanCreateImages(t)
+
+	store := newStore(t)
+	cache := memory.New()
+
+	ref, err := Transport.ParseReference("test")
+	require.NoError(t, err)
+	layer := makeLayer(t, archive.Gzip)
+	createImage(t, ref, cache, []testBlob{layer}, nil)
+
+	src, err := ref.NewImageSource(context.Background(), nil)
+	require.NoError(t, err)
+	imageID := src.(*storageImageSource).image.ID
+	manifestBlob, _, err := src.GetManifest(context.Background(), nil)
+	require.NoError(t, err)
+	err = src.Close()
+	require.NoError(t, err)
+	manifestDigest, err := manifest.Digest(manifestBlob)
+	require.NoError(t, err)
+
+	// Corrupt the stored manifest.
+	key, err := manifestBigDataKey(manifestDigest)
+	require.NoError(t, err)
+	corrupted := append(slices.Clone(manifestBlob), '\n')
+	err = store.SetImageBigData(imageID, key, corrupted, manifest.Digest)
+	require.NoError(t, err)
+
+	named, err := reference.ParseNormalizedNamed("test@" + manifestDigest.String())
+	require.NoError(t, err)
+	digestedRef, err := Transport.NewStoreReference(store, named, imageID)
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		sys        *types.SystemContext
+		shouldFail bool
+	}{
+		{nil, false},
+		{&types.SystemContext{}, false},
+		{&types.SystemContext{StorageRequireManifestDigestMatch: true}, true},
+	} {
+		src, err := digestedRef.NewImageSource(context.Background(), c.sys)
+		require.NoError(t, err)
+		for _, instanceDigest := range []*digest.Digest{nil, &manifestDigest} {
+			blob, _, err := src.GetManifest(context.Background(), instanceDigest)
+			if c.shouldFail {
+				assert.ErrorContains(t, err, "does not match the expected digest")
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, corrupted, blob)
+			}
+		}
+		err = src.Close()
+		require.NoError(t, err)
+	}
+}
+
+func TestStoragePreserveCompressedLayers(t *testing.T) {
+	ensureTestCanCreateImages(t)
+
+	newStore(t)
+	cache := memory.New()
+
+	for _, preserve := range []bool{false, true} {
+		ref, err := Transport.ParseReference(fmt.Sprintf("test-preserve-%t", preserve))
+		require.NoError(t, err)
+		layer := makeLayer(t, archive.Gzip)
+		dest, unparsedToplevel := createUncommittedImageDestWithSys(t, ref, &types.SystemContext{StoragePreserveCompressedLayers: preserve},
+			cache, []testBlob{layer}, nil)
+		err = dest.Commit(context.Background(), unparsedToplevel)
+		require.NoError(t, err)
+		err = dest.Close()
+		require.NoError(t, err)
+
+		src, err := ref.NewImageSource(context.Background(), nil)
+		require.NoError(t, err)
+		layerInfos, err := src.(*storageImageSource).LayerInfosForCopy(context.Background(), nil)
+		require.NoError(t, err)
+		require.Len(t, layerInfos, 1)
+		if preserve {
+			assert.Equal(t, types.BlobInfo{
+				Digest:    layer.compressedDigest,
+				Size:      layer.compressedSize,
+				MediaType: manifest.DockerV2Schema2LayerMediaType,
+			}, layerInfos[0])
+		} else {
+			assert.Equal(t, types.BlobInfo{
+				Digest:    layer.uncompressedDigest,
+				Size:      layer.uncompressedSize,
+				MediaType: manifest.DockerV2SchemaLayerMediaTypeUncompressed,
+			}, layerInfos[0])
+		}
+		rc, size, err := src.GetBlob(context.Background(), layerInfos[0], cache)
+		require.NoError(t, err)
+		data, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		rc.Close()
+		assert.Equal(t, layerInfos[0].Digest, digest.FromBytes(data))
+		if preserve {
+			assert.Equal(t, layer.compressedSize, size)
+			assert.Equal(t, layer.data, data)
+		} else {
+			assert.Equal(t, layerInfos[0].Size, size)
+		}
+		err = src.Close()
+		require.NoError(t, err)
+
+		// The compressed form can be read even without calling LayerInfosForCopy first
+		src, err = ref.NewImageSource(context.Background(), nil)
+		require.NoError(t, err)
+		rc, size, err = src.GetBlob(context.Background(), types.BlobInfo{Digest: layer.compressedDigest, Size: layer.compressedSize}, cache)
+		if preserve {
+			require.NoError(t, err)
+			data, err = io.ReadAll(rc)
+			require.NoError(t, err)
+			rc.Close()
+			assert.Equal(t, layer.data, data)
+			assert.Equal(t, layer.compressedSize, size)
+		} else {
+			assert.Error(t, err)
+		}
+		err = src.Close()
+		require.NoError(t, err)
+	}
+}
+
 func TestDuplicateName(t *testing.T) {
 	ensureTestCanCreateImages(t)
 
@@ -683,6 +976,32 @@ func TestSize(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestCommitDiffIDMismatch(t *testing.T) {
+	ensureTestCanCreateImages(t)
+
+	newStore(t)
+	cache := memory.New()
+
+	ref, err := Transport.ParseReference("test")
+	require.NoError(t, err)
+
+	layer1 := makeLayer(t, archive.Gzip)
+	layer2 := makeLayer(t, archive.Gzip)
+	otherLayer := makeLayer(t, archive.Gzip)
+	// The config declares otherLayer's DiffID for the second layer.
+	config := configForLayers(t, []testBlob{layer1, otherLayer})
+	dest, unparsedToplevel := createUncommittedImageDest(t, ref, cache, []testBlob{layer1, layer2}, &config)
+	defer dest.Close()
+	err = dest.Commit(context.Background(), unparsedToplevel)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "layer 1")
+	assert.ErrorContains(t, err, layer2.compressedDigest.String())
+	assert.ErrorContains(t, err, otherLayer.uncompressedDigest.String())
+
+	_, err = ref.NewImageSource(context.Background(), nil)
+	assert.Error(t, err)
+}
+
 func TestDuplicateBlob(t *testing.T) {
 	ensureTestCanCreateImages(t)
 
@@ -731,6 +1050,60 @@ func TestDuplicateBlob(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestDuplicateConsecutiveBlob(t *testing.T) {
+	ensureTestCanCreateImages(t)
+
+	newStore(t)
+	cache := memory.New()
+
+	ref, err := Transport.ParseReference("test")
+	require.NoError(t, err)
+
+	layer1 := makeLayer(t, archive.Gzip)
+	layer2 := makeLayer(t, archive.Gzip)
+	layerBlobs := []testBlob{layer1, layer1, layer2}
+	config := configForLayers(t, layerBlobs)
+	createImage(t, ref, cache, layerBlobs, &config)
+
+	src, err := ref.NewImageSource(context.Background(), nil)
+	require.NoError(t, err)
+	defer src.Close()
+	source, ok := src.(*storageImageSource)
+	require.True(t, ok)
+
+	// Each of the layers is a separate layer in the storage chain.
+	store := source.imageRef.transport.store
+	chainIDs := []string{}
+	chainDiffIDs := []digest.Digest{}
+	for layerID := source.image.TopLayer; layerID != ""; {
+		layer, err := store.Layer(layerID)
+		require.NoError(t, err)
+		chainIDs = append([]string{layer.ID}, chainIDs...)
+		chainDiffIDs = append([]digest.Digest{layer.UncompressedDigest}, chainDiffIDs...)
+		layerID = layer.Parent
+	}
+	assert.Equal(t, []digest.Digest{layer1.uncompressedDigest, layer1.uncompressedDigest, layer2.uncompressedDigest}, chainDiffIDs)
+	require.Len(t, chainIDs, 3)
+	assert.NotEqual(t, chainIDs[0], chainIDs[1])
+
+	// The image reads back correctly.
+	img, err := ref.NewImage(context.Background(), nil)
+	require.NoError(t, err)
+	defer img.Close()
+	layerInfos, err := img.LayerInfosForCopy(context.Background())
+	require.NoError(t, err)
+	require.Len(t, layerInfos, 3)
+	for i, layerInfo := range layerInfos {
+		assert.Equal(t, layerBlobs[i].uncompressedDigest, layerInfo.Digest)
+		rc, _, err := src.GetBlob(context.Background(), layerInfo, cache)
+		require.NoError(t, err)
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		require.NoError(t, err)
+		assert.Equal(t, layerInfo.Digest, digest.FromBytes(data))
+	}
+}
+
 type unparsedImage struct {
 	imageReference types.ImageReference
 	manifestBytes  []byte
@@ -747,3 +1120,317 @@ func (u *unparsedImage) Manifest(context.Context) ([]byte, string, error) {
 func (u *unparsedImage) Signatures(context.Context) ([][]byte, error) {
 	return u.signatures, nil
 }
+
+// makeLayerWithXattrs returns an uncompressed layer containing a single file with the specified extended attributes.
+func makeLayerWithXattrs(t *testing.T, xattrs map[string]string) testBlob {
+	contents := []byte("file with extended attributes")
+	paxRecords := map[string]string{}
+	for name, value := range xattrs {
+		paxRecords[archive.PaxSchilyXattr+name] = value
+	}
+	var buf bytes.Buffer
+	twriter := tar.NewWriter(&buf)
+	err := twriter.WriteHeader(&tar.Header{
+		Name:       "/file-with-xattrs",
+		Mode:       0755,
+		Size:       int64(len(contents)),
+		ModTime:    time.Now(),
+		Typeflag:   tar.TypeReg,
+		PAXRecords: paxRecords,
+		Format:     tar.FormatPAX,
+	})
+	require.NoError(t, err)
+	_, err = twriter.Write(contents)
+	require.NoError(t, err)
+	// Don’t call twriter.Close(), see makeLayerGoroutine.
+	err = twriter.Flush()
+	require.NoError(t, err)
+	layerDigest := digest.Canonical.FromBytes(buf.Bytes())
+	return testBlob{
+		uncompressedDigest: layerDigest,
+		compressedDigest:   layerDigest,
+		uncompressedSize:   int64(buf.Len()),
+		compressedSize:     int64(buf.Len()),
+		data:               buf.Bytes(),
+	}
+}
+
+func TestStorageSkipXattrPrefixes(t *testing.T) {
+	ensureTestCanCreateImages(t)
+
+	cache := memory.New()
+	// A valid VFS_CAP_REVISION_2 value granting CAP_NET_RAW, so that the kernel accepts it.
+	capability := string([]byte{0x01, 0x00, 0x00, 0x02, 0x00, 0x20, 0x00, 0x00, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+	xattrs := map[string]string{
+		"security.capability": capability,
+		"user.comment":        "kept",
+	}
+	// Store the same image with and without filtering in a single store.
+	store := newStore(t)
+	layer := makeLayerWithXattrs(t, xattrs)
+	config := configForLayers(t, []testBlob{layer})
+	layerIDs := map[string]struct{}{}
+	for i, c := range []struct {
+		prefixes []string
+		expected map[string]string
+	}{
+		{[]string{"security."}, map[string]string{"user.comment": "kept"}},
+		{nil, xattrs},
+		{[]string{"security.", "user."}, map[string]string{}},
+		{[]string{"user.", "security."}, map[string]string{}},
+	} {
+		ref, err := Transport.ParseReference(fmt.Sprintf("test%d", i))
+		require.NoError(t, err)
+		dest, unparsedToplevel := createUncommittedImageDestWithSys(t, ref, &types.SystemContext{StorageSkipXattrPrefixes: c.prefixes},
+			cache, []testBlob{layer}, &config)
+		err = dest.Commit(context.Background(), unparsedToplevel)
+		require.NoError(t, err, c.prefixes)
+		err = dest.Close()
+		require.NoError(t, err)
+
+		img, err := ref.(*storageReference).resolveImage(nil)
+		require.NoError(t, err)
+		storedLayer, err := store.Layer(img.TopLayer)
+		require.NoError(t, err)
+		layerIDs[storedLayer.ID] = struct{}{}
+		if c.prefixes == nil {
+			assert.Equal(t, layer.uncompressedDigest, storedLayer.UncompressedDigest)
+		} else {
+			assert.NotEqual(t, layer.uncompressedDigest, storedLayer.UncompressedDigest, c.prefixes)
+		}
+
+		noCompression := archive.Uncompressed
+		diff, err := store.Diff("", storedLayer.ID, &storage.DiffOptions{Compression: &noCompression})
+		require.NoError(t, err)
+		hdr, err := tar.NewReader(diff).Next()
+		require.NoError(t, err)
+		diff.Close() // store.Diff holds a lock until the stream is closed
+		storedXattrs := map[string]string{}
+		for key, value := range hdr.PAXRecords {
+			if name, ok := strings.CutPrefix(key, archive.PaxSchilyXattr); ok {
+				storedXattrs[name] = value
+			}
+		}
+		assert.Equal(t, c.expected, storedXattrs, c.prefixes)
+	}
+	// Filtered layers are stored separately from the unfiltered one, and from each other unless the prefixes are the same.
+	assert.Len(t, layerIDs, 3)
+	// Only the unfiltered layer is found using the original DiffID.
+	layers, err := store.LayersByUncompressedDigest(layer.uncompressedDigest)
+	require.NoError(t, err)
+	require.Len(t, layers, 1)
+}
+
+func TestStorageCreationDateOverride(t *testing.T) {
+	ensureTestCanCreateImages(t)
+
+	cache := memory.New()
+	override := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+	for _, c := range []struct {
+		override      *time.Time
+		useConfigDate bool
+	}{
+		{nil, true},
+		{&override, false},
+	} {
+		store := newStore(t)
+		ref, err := Transport.ParseReference("test")
+		require.NoError(t, err)
+
+		layer := makeLayer(t, archive.Gzip)
+		config := configForLayers(t, []testBlob{layer})
+		var parsedConfig manifest.Schema2Image
+		err = json.Unmarshal(config.data, &parsedConfig)
+		require.NoError(t, err)
+		require.False(t, parsedConfig.Created.Equal(override))
+
+		dest, unparsedToplevel := createUncommittedImageDestWithSys(t, ref, &types.SystemContext{StorageCreationDateOverride: c.override},
+			cache, []testBlob{layer}, &config)
+		err = dest.Commit(context.Background(), unparsedToplevel)
+		require.NoError(t, err)
+		err = dest.Close()
+		require.NoError(t, err)
+
+		img, err := Transport.GetStoreImage(store, ref)
+		require.NoError(t, err)
+		if c.useConfigDate {
+			assert.True(t, img.Created.Equal(parsedConfig.Created), "%v vs. %v", img.Created, parsedConfig.Created)
+		} else {
+			assert.True(t, img.Created.Equal(override), "%v vs. %v", img.Created, override)
+		}
+	}
+}
+
+func TestStorageRecordDigestedName(t *testing.T) {
+	ensureTestCanCreateImages(t)
+
+	cache := memory.New()
+	for _, c := range []struct {
+		name   string
+		record bool
+	}{
+		{"test:tag", false},
+		{"test:tag", true},
+		{"test", true}, // Normalized to test:latest
+	} {
+		store := newStore(t)
+		ref, err := Transport.ParseReference(c.name)
+		require.NoError(t, err, c.name)
+
+		layer := makeLayer(t, archive.Gzip)
+		dest, unparsedToplevel := createUncommittedImageDestWithSys(t, ref, &types.SystemContext{StorageRecordDigestedName: c.record},
+			cache, []testBlob{layer}, nil)
+		manifestBlob, _, err := unparsedToplevel.Manifest(context.Background())
+		require.NoError(t, err, c.name)
+		manifestDigest, err := manifest.Digest(manifestBlob)
+		require.NoError(t, err, c.name)
+		err = dest.Commit(context.Background(), unparsedToplevel)
+		require.NoError(t, err, c.name)
+		err = dest.Close()
+		require.NoError(t, err, c.name)
+
+		img, err := Transport.GetStoreImage(store, ref)
+		require.NoError(t, err, c.name)
+		digestedName, err := reference.WithDigest(reference.TrimNamed(ref.DockerReference()), manifestDigest)
+		require.NoError(t, err, c.name)
+		if c.record {
+			assert.ElementsMatch(t, []string{ref.DockerReference().String(), digestedName.String()}, img.Names, c.name)
+			// Both names resolve to the same image.
+			byDigest, err := store.Image(digestedName.String())
+			require.NoError(t, err, c.name)
+			assert.Equal(t, img.ID, byDigest.ID, c.name)
+			byTag, err := store.Image(ref.DockerReference().String())
+			require.NoError(t, err, c.name)
+			assert.Equal(t, img.ID, byTag.ID, c.name)
+		} else {
+			assert.Equal(t, []string{ref.DockerReference().String()}, img.Names, c.name)
+		}
+	}
+}
+
+func TestStorageGetSignaturesMetadata(t *testing.T) {
+	ensureTestCanCreateImages(t)
+
+	newStore(t)
+	cache := memory.New()
+	ref, err := Transport.ParseReference("test")
+	require.NoError(t, err)
+
+	layer := makeLayer(t, archive.Gzip)
+	dest, unparsedToplevel := createUncommittedImageDest(t, ref, cache, []testBlob{layer}, nil)
+	// These signatures are invalid; start with 0xA3 just to be minimally plausible to signature.FromBlob.
+	err = dest.PutSignatures(context.Background(), [][]byte{[]byte("\xA3first signature"), []byte("\xA3second, longer signature")}, nil)
+	require.NoError(t, err)
+	err = dest.Commit(context.Background(), unparsedToplevel)
+	require.NoError(t, err)
+	err = dest.Close()
+	require.NoError(t, err)
+
+	src, err := ref.NewImageSource(context.Background(), nil)
+	require.NoError(t, err)
+	defer src.Close()
+	metadataSrc, ok := src.(private.SignatureMetadataSource)
+	require.True(t, ok)
+	metadata, err := metadataSrc.GetSignaturesMetadata(context.Background(), nil)
+	require.NoError(t, err)
+
+	// The sizes match the signatures read in full; the format is not known without reading the signatures.
+	sigs, err := src.(private.ImageSource).GetSignaturesWithFormat(context.Background(), nil)
+	require.NoError(t, err)
+	fullMetadata, err := imagesource.MetadataOfSignatures(sigs)
+	require.NoError(t, err)
+	require.Len(t, metadata, 2)
+	require.Len(t, fullMetadata, 2)
+	for i := range metadata {
+		assert.Equal(t, "", metadata[i].Format)
+		assert.Equal(t, fullMetadata[i].Size, metadata[i].Size)
+		assert.Equal(t, string(signature.SimpleSigningFormat), fullMetadata[i].Format)
+	}
+	assert.Less(t, metadata[0].Size, metadata[1].Size)
+
+	// A missing per-instance list of signatures is reported as no signatures.
+	otherDigest := digest.FromString("other instance")
+	metadata, err = metadataSrc.GetSignaturesMetadata(context.Background(), &otherDigest)
+	require.NoError(t, err)
+	assert.Empty(t, metadata)
+}
+
+func TestCopySignatures(t *testing.T) {
+	ensureTestCanCreateImages(t)
+
+	ctx := context.Background()
+	newStore(t)
+	sys := &types.SystemContext{BlobInfoCacheDir: t.TempDir()}
+	policyContext := imagetest.AcceptAnythingPolicyContext(t)
+
+	layer := makeLayer(t, archive.Gzip)
+	srcRef := imagetest.WriteDirImage(t, manifest.DockerV2Schema2MediaType, configForLayers(t, []testBlob{layer}).data,
+		[]imagetest.Blob{{MediaType: manifest.DockerV2Schema2LayerMediaType, Data: layer.data}})
+	dstRef, err := Transport.ParseReference("test")
+	require.NoError(t, err)
+	_, err = copy.Image(ctx, policyContext, dstRef, srcRef, &copy.Options{SourceCtx: sys, DestinationCtx: sys, PreserveDigests: true})
+	require.NoError(t, err)
+
+	readSignatures := func() [][]byte {
+		src, err := dstRef.NewImageSource(ctx, sys)
+		require.NoError(t, err)
+		defer src.Close()
+		sigs, err := src.GetSignatures(ctx, nil)
+		require.NoError(t, err)
+		return sigs
+	}
+	assert.Empty(t, readSignatures())
+
+	// Start the signature with 0xA0 to fool internal/signature.FromBlob into thinking it is valid GPG
+	err = os.WriteFile(filepath.Join(srcRef.StringWithinTransport(), "signature-1"), []byte("\xA0Signature A"), 0o644)
+	require.NoError(t, err)
+	// Make sure the layer is not read from the source.
+	err = os.Remove(filepath.Join(srcRef.StringWithinTransport(), layer.compressedDigest.Encoded()))
+	require.NoError(t, err)
+
+	// Manifests match
+	err = copy.CopySignatures(ctx, sys, srcRef, dstRef)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("\xA0Signature A")}, readSignatures())
+
+	// Existing signatures are preserved, and signatures already present are not duplicated
+	err = os.WriteFile(filepath.Join(srcRef.StringWithinTransport(), "signature-1"), []byte("\xA0Signature B"), 0o644)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(srcRef.StringWithinTransport(), "signature-2"), []byte("\xA0Signature A"), 0o644)
+	require.NoError(t, err)
+	err = copy.CopySignatures(ctx, sys, srcRef, dstRef)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("\xA0Signature A"), []byte("\xA0Signature B")}, readSignatures())
+	err = copy.CopySignatures(ctx, sys, srcRef, dstRef)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("\xA0Signature A"), []byte("\xA0Signature B")}, readSignatures())
+
+	// Manifests don’t match
+	otherRef := imagetest.WriteDirImage(t, manifest.DockerV2Schema2MediaType, configForLayers(t, []testBlob{layer}).data,
+		[]imagetest.Blob{{MediaType: manifest.DockerV2Schema2LayerMediaType, Data: layer.data}})
+	err = os.WriteFile(filepath.Join(otherRef.StringWithinTransport(), "signature-1"), []byte("\xA0Signature B"), 0o644)
+	require.NoError(t, err)
+	err = copy.CopySignatures(ctx, sys, otherRef, dstRef)
+	assert.ErrorContains(t, err, "does not match")
+	assert.Equal(t, [][]byte{[]byte("\xA0Signature A"), []byte("\xA0Signature B")}, readSignatures())
+}
+
+func TestCopyManifestOnly(t *testing.T) {
+	ensureTestCanCreateImages(t)
+
+	ctx := context.Background()
+	newStore(t)
+	sys := &types.SystemContext{BlobInfoCacheDir: t.TempDir()}
+	policyContext := imagetest.AcceptAnythingPolicyContext(t)
+
+	// The store does not contain the layer, and it can’t be fetched later.
+	layer := makeLayer(t, archive.Gzip)
+	srcRef := imagetest.WriteDirImage(t, manifest.DockerV2Schema2MediaType, configForLayers(t, []testBlob{layer}).data,
+		[]imagetest.Blob{{MediaType: manifest.DockerV2Schema2LayerMediaType, Data: layer.data}})
+	dstRef, err := Transport.ParseReference("test")
+	require.NoError(t, err)
+	_, err = copy.Image(ctx, policyContext, dstRef, srcRef, &copy.Options{SourceCtx: sys, DestinationCtx: sys, ManifestOnly: true})
+	assert.ErrorContains(t, err, "not present at the destination")
+	_, err = dstRef.NewImageSource(ctx, sys)
+	assert.ErrorIs(t, err, ErrNoSuchImage)
+}
@@ -1,6 +1,8 @@
 package alltransports
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/containers/image/v5/directory"
@@ -61,3 +63,49 @@ func TestTransportFromImageName(t *testing.T) {
 	invalidName := TransportFromImageName("unknown")
 	assert.Equal(t, invalidName, nil)
 }
+
+func TestParseAndNormalize(t *testing.T) {
+	tmpDir, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	relDir, err := filepath.Rel(wd, tmpDir)
+	require.NoError(t, err)
+
+	for _, c := range []struct{ transport, input, normalized, dockerRef string }{
+		{"docker", "//busybox", "//busybox:latest", "docker.io/library/busybox:latest"},
+		{"docker", "//docker.io/library/busybox:latest", "//busybox:latest", "docker.io/library/busybox:latest"},
+		{"docker", "//docker.io/ns/repo", "//ns/repo:latest", "docker.io/ns/repo:latest"},
+		{"docker", "//quay.io/ns/repo:tag", "//quay.io/ns/repo:tag", "quay.io/ns/repo:tag"},
+		{"dir", tmpDir + "/dir", tmpDir + "/dir", ""},
+		{"oci", tmpDir + "/layout:image", tmpDir + "/layout:image", ""},
+		{"oci", tmpDir + "/layout", tmpDir + "/layout:", ""},
+		{"dir", tmpDir + "//./dir", tmpDir + "/dir", ""},
+		{"dir", relDir + "/./dir", tmpDir + "/dir", ""},
+		{"oci", tmpDir + "//./layout:image", tmpDir + "/layout:image", ""},
+		{"oci", relDir + "/layout:@1", tmpDir + "/layout:@1", ""},
+	} {
+		ref, err := transports.ParseAndNormalize(c.transport, c.input)
+		require.NoError(t, err, c.input)
+		assert.Equal(t, c.transport, ref.Transport().Name(), c.input)
+		assert.Equal(t, c.normalized, ref.StringWithinTransport(), c.input)
+		if c.dockerRef != "" {
+			require.NotNil(t, ref.DockerReference(), c.input)
+			assert.Equal(t, c.dockerRef, ref.DockerReference().String(), c.input)
+		}
+	}
+
+	for _, c := range []struct{ transport, input string }{
+		{"this-does-not-exist", "//busybox"},
+		{"docker", ""},
+		{"docker", " //busybox"},
+		{"docker", "//busybox\n"},
+		{"docker", "busybox"},            // Missing "//"
+		{"docker", "//UPPERCASE"},        // Invalid repository name
+		{"docker", "//busybox:tag:tag"},  // Invalid tag
+		{"oci", tmpDir + "/layout:@bad"}, // Invalid image name
+	} {
+		_, err := transports.ParseAndNormalize(c.transport, c.input)
+		assert.Error(t, err, c.input)
+	}
+}
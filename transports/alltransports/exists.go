@@ -0,0 +1,76 @@
+package alltransports
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/oci/layout"
+	"github.com/containers/image/v5/types"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// ImageExists returns true if ref refers to an existing image, and false if the transport cleanly reports
+// that the image does not exist. Any other failure to determine that is returned as an error.
+//
+// The check is as lightweight as the transport allows: for docker: references, only the manifest digest is requested;
+// for containers-storage: references, the image is looked up in the store; for other transports, such as dir: or oci:,
+// the manifest is read.
+func ImageExists(ctx context.Context, sys *types.SystemContext, ref types.ImageReference) (bool, error) {
+	if ref.Transport().Name() == docker.Transport.Name() {
+		_, err := docker.GetDigest(ctx, sys, ref)
+		return imageExistsResult(ref, err)
+	}
+
+	src, err := ref.NewImageSource(ctx, sys)
+	if err != nil {
+		return imageExistsResult(ref, err)
+	}
+	defer src.Close()
+	if ref.Transport().Name() == "containers-storage" {
+		// Creating the source has successfully looked up the image.
+		return true, nil
+	}
+	_, _, err = src.GetManifest(ctx, nil)
+	return imageExistsResult(ref, err)
+}
+
+// imageExistsResult converts the result of an existence check of ref for ImageExists.
+func imageExistsResult(ref types.ImageReference, err error) (bool, error) {
+	if err == nil {
+		return true, nil
+	}
+	if isImageNotFoundError(ref, err) {
+		return false, nil
+	}
+	return false, err
+}
+
+// isImageNotFoundError returns true if err, returned when accessing ref, reports that the image does not exist.
+// Only errors specific to the transport of ref are recognized: e.g. a missing configuration file is not an indication
+// that the image does not exist.
+func isImageNotFoundError(ref types.ImageReference, err error) bool {
+	switch ref.Transport().Name() {
+	case docker.Transport.Name():
+		var notFound docker.ErrManifestNotFound
+		return errors.As(err, &notFound)
+	case layout.Transport.Name():
+		var notFound layout.ImageNotFoundError
+		return errors.As(err, &notFound) || isMissingFileError(err, imgspecv1.ImageIndexFile)
+	case directory.Transport.Name():
+		return isMissingFileError(err, "manifest.json")
+	case "containers-storage":
+		return isStorageImageNotFoundError(err)
+	default:
+		return false
+	}
+}
+
+// isMissingFileError returns true if err reports that a file with the specified base name does not exist.
+func isMissingFileError(err error, baseName string) bool {
+	var pathErr *fs.PathError
+	return errors.As(err, &pathErr) && errors.Is(pathErr, fs.ErrNotExist) && filepath.Base(pathErr.Path) == baseName
+}
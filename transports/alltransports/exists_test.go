@@ -0,0 +1,121 @@
+package alltransports
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImageExistsDocker(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/":
+			rw.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodHead && r.URL.Path == "/v2/repo/manifests/present":
+			rw.Header().Set("Docker-Content-Digest", digest.FromString("manifest").String())
+			rw.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodHead && r.URL.Path == "/v2/repo/manifests/missing":
+			rw.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodHead && r.URL.Path == "/v2/repo/manifests/server-error":
+			rw.WriteHeader(http.StatusInternalServerError)
+		default:
+			require.FailNowf(t, "Unexpected request", "%v %v", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+	registryURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	// An explicitly configured registries.conf file which does not exist is an error; use an empty one.
+	registriesConf := filepath.Join(t.TempDir(), "registries.conf")
+	err = os.WriteFile(registriesConf, []byte{}, 0o600)
+	require.NoError(t, err)
+
+	sys := &types.SystemContext{
+		RegistriesDirPath:           "/this/does/not/exist",
+		DockerPerHostCertDirPath:    "/this/does/not/exist",
+		SystemRegistriesConfPath:    registriesConf,
+		DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+	}
+	for _, c := range []struct {
+		tag      string
+		expected bool
+		fails    bool
+	}{
+		{"present", true, false},
+		{"missing", false, false},
+		{"server-error", false, true},
+	} {
+		ref, err := docker.ParseReference("//" + registryURL.Host + "/repo:" + c.tag)
+		require.NoError(t, err, c.tag)
+		exists, err := ImageExists(context.Background(), sys, ref)
+		if c.fails {
+			assert.Error(t, err, c.tag)
+		} else {
+			require.NoError(t, err, c.tag)
+			assert.Equal(t, c.expected, exists, c.tag)
+		}
+	}
+}
+
+func TestImageExistsMissingConfiguration(t *testing.T) {
+	// A missing registries.conf does not mean that the image does not exist.
+	ref, err := docker.ParseReference("//registry.example.com/repo:tag")
+	require.NoError(t, err)
+	_, err = ImageExists(context.Background(), &types.SystemContext{
+		SystemRegistriesConfPath:    "/this/does/not/exist",
+		SystemRegistriesConfDirPath: "/this/does/not/exist",
+	}, ref)
+	assert.Error(t, err)
+
+	// Only errors about the image’s files are recognized.
+	dirRef, err := directory.NewReference(t.TempDir())
+	require.NoError(t, err)
+	for _, c := range []struct {
+		ref      types.ImageReference
+		err      error
+		expected bool
+	}{
+		{dirRef, &fs.PathError{Op: "open", Path: "/some/dir/manifest.json", Err: fs.ErrNotExist}, true},
+		{dirRef, &fs.PathError{Op: "open", Path: "/etc/containers/auth.json", Err: fs.ErrNotExist}, false},
+		{ref, &fs.PathError{Op: "open", Path: "/etc/containers/auth.json", Err: fs.ErrNotExist}, false},
+		{ref, docker.ErrManifestNotFound{Err: errors.New("manifest unknown")}, true},
+	} {
+		assert.Equal(t, c.expected, isImageNotFoundError(c.ref, c.err), c.err)
+	}
+}
+
+func TestImageExistsDir(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// A missing directory
+	ref, err := directory.NewReference(filepath.Join(tmpDir, "missing"))
+	require.NoError(t, err)
+	exists, err := ImageExists(context.Background(), nil, ref)
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	// A directory containing a manifest
+	present := filepath.Join(tmpDir, "present")
+	err = os.Mkdir(present, 0o755)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(present, "manifest.json"), []byte(`{"schemaVersion":2}`), 0o644)
+	require.NoError(t, err)
+	ref, err = directory.NewReference(present)
+	require.NoError(t, err)
+	exists, err = ImageExists(context.Background(), nil, ref)
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
@@ -4,6 +4,13 @@
 package alltransports
 
 import (
+	"errors"
+
 	// Register the storage transport
-	_ "github.com/containers/image/v5/storage"
+	"github.com/containers/image/v5/storage"
 )
+
+// isStorageImageNotFoundError returns true if err reports that a containers-storage image does not exist.
+func isStorageImageNotFoundError(err error) bool {
+	return errors.Is(err, storage.ErrNoSuchImage)
+}
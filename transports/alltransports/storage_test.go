@@ -0,0 +1,79 @@
+//go:build !containers_image_storage_stub
+// +build !containers_image_storage_stub
+
+package alltransports
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	istorage "github.com/containers/image/v5/storage"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImageExistsStorage(t *testing.T) {
+	if runtime.GOOS == "linux" && os.Geteuid() != 0 {
+		t.Skip("test requires root privileges on Linux")
+	}
+	wd := t.TempDir()
+	store, err := storage.GetStore(storage.StoreOptions{
+		RunRoot:         filepath.Join(wd, "run"),
+		GraphRoot:       filepath.Join(wd, "root"),
+		GraphDriverName: "vfs",
+	})
+	require.NoError(t, err)
+	defer func() {
+		_, err := store.Shutdown(true)
+		assert.NoError(t, err)
+	}()
+
+	ref, err := istorage.Transport.ParseStoreReference(store, "example.com/present:latest")
+	require.NoError(t, err)
+	exists, err := ImageExists(context.Background(), nil, ref)
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	_, err = store.CreateImage("", []string{"example.com/present:latest"}, "", "", nil)
+	require.NoError(t, err)
+	exists, err = ImageExists(context.Background(), nil, ref)
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	ref, err = istorage.Transport.ParseStoreReference(store, "example.com/missing:latest")
+	require.NoError(t, err)
+	exists, err = ImageExists(context.Background(), nil, ref)
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestParseAndNormalizeStorage(t *testing.T) {
+	wd, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	root := filepath.Join(wd, "root")
+	run := filepath.Join(wd, "run")
+	storeSpec := "[vfs@" + root + "+" + run + "]"
+	defer func() {
+		store, err := storage.GetStore(storage.StoreOptions{GraphRoot: root, RunRoot: run, GraphDriverName: "vfs"})
+		require.NoError(t, err)
+		_, err = store.Shutdown(true)
+		assert.NoError(t, err)
+	}()
+
+	for _, c := range []struct{ input, normalized string }{
+		{storeSpec + "busybox", storeSpec + "docker.io/library/busybox:latest"},
+		{storeSpec + "quay.io/ns/repo:tag", storeSpec + "quay.io/ns/repo:tag"},
+	} {
+		ref, err := transports.ParseAndNormalize(istorage.Transport.Name(), c.input)
+		require.NoError(t, err, c.input)
+		assert.Equal(t, c.normalized, ref.StringWithinTransport(), c.input)
+	}
+
+	_, err = transports.ParseAndNormalize(istorage.Transport.Name(), storeSpec+"UPPERCASE")
+	assert.Error(t, err)
+}
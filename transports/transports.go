@@ -3,8 +3,10 @@ package transports
 import (
 	"fmt"
 	"sort"
+	"strings"
 	"sync"
 
+	"github.com/containers/image/v5/internal/private"
 	"github.com/containers/image/v5/internal/set"
 	"github.com/containers/image/v5/types"
 )
@@ -72,6 +74,44 @@ func ImageName(ref types.ImageReference) string {
 	return ref.Transport().Name() + ":" + ref.StringWithinTransport()
 }
 
+// ParseAndNormalize parses input as a reference within the transport named transportName
+// (i.e. the part of an URL-like image name after "transportName:"), rejecting empty input and input with leading
+// or trailing whitespace, and returns the reference in a canonical form.
+//
+// The result does not depend on which of the equivalent spellings accepted by the transport was used as input.
+// E.g. for docker: references, both "//busybox" and "//docker.io/library/busybox:latest" result in a reference with
+// StringWithinTransport() == "//busybox:latest" and DockerReference() == "docker.io/library/busybox:latest";
+// for transports which refer to filesystem paths, like dir: and oci:, the path is made absolute and redundant
+// path elements are removed (but symbolic links are not resolved).
+//
+// The transport must have been registered, e.g. by importing transports/alltransports.
+func ParseAndNormalize(transportName, input string) (types.ImageReference, error) {
+	transport := Get(transportName)
+	if transport == nil {
+		return nil, fmt.Errorf("unknown transport %q", transportName)
+	}
+	if input == "" {
+		return nil, fmt.Errorf("invalid %s: reference: the reference is empty", transportName)
+	}
+	if strings.TrimSpace(input) != input {
+		return nil, fmt.Errorf("invalid %s: reference %q: leading or trailing whitespace is not allowed", transportName, input)
+	}
+	ref, err := transport.ParseReference(input)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: reference %q: %w", transportName, input, err)
+	}
+	// Most transports, e.g. docker: and containers-storage:, fill in defaults and canonicalize names already
+	// when parsing; transports which don’t can do that using NormalizedReference.
+	if normalizing, ok := ref.(private.NormalizingImageReference); ok {
+		normalized, err := normalizing.NormalizedReference()
+		if err != nil {
+			return nil, fmt.Errorf("normalizing %s: reference %q: %w", transportName, input, err)
+		}
+		ref = normalized
+	}
+	return ref, nil
+}
+
 var deprecatedTransports = set.NewWithValues("atomic")
 
 // ListNames returns a list of non deprecated transport names.
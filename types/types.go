@@ -3,6 +3,7 @@ package types
 import (
 	"context"
 	"io"
+	"net"
 	"time"
 
 	"github.com/containers/image/v5/docker/reference"
@@ -487,6 +488,23 @@ type ImageInspectLayer struct {
 	Annotations map[string]string
 }
 
+// DockerMetrics receives counters from the docker: transport, e.g. to export them to a monitoring system.
+// The registry parameter is the host[:port] of the registry the counter applies to.
+// Methods may be called concurrently from several goroutines, and they should return quickly;
+// in particular, BytesDownloaded and BytesUploaded are called for every read of a request or response body.
+type DockerMetrics interface {
+	// RequestCompleted is called when a response to a HTTP request to a registry is received.
+	RequestCompleted(registry string, method string, statusCode int)
+	// BytesDownloaded is called when n bytes of a response body are read.
+	BytesDownloaded(registry string, n int64)
+	// BytesUploaded is called when n bytes of a request body are sent.
+	BytesUploaded(registry string, n int64)
+	// RequestRetried is called when a request is repeated, e.g. after a HTTP 429 response or after obtaining a token with an updated scope.
+	RequestRetried(registry string)
+	// TokenRefreshed is called when a new bearer token is obtained from the registry’s authentication server.
+	TokenRefreshed(registry string)
+}
+
 // DockerAuthConfig contains authorization information for connecting to a registry.
 // the value of Username and Password can be empty for accessing the registry anonymously
 type DockerAuthConfig struct {
@@ -513,6 +531,22 @@ const (
 	OptionalBoolFalse
 )
 
+// OSVersionMatch specifies how SystemContext.OSVersionChoice is used when choosing an image from a multi-platform image.
+// Regardless of the value, an instance with exactly the OSVersionChoice os.version is preferred, then an instance with
+// the same major.minor.build prefix (e.g. "10.0.17763" for Windows, where the last component is only the patch level),
+// then an instance without an os.version.
+type OSVersionMatch byte
+
+const (
+	// OSVersionMatchPreferred accepts an instance with any os.version, if no better match exists.
+	OSVersionMatchPreferred OSVersionMatch = iota
+	// OSVersionMatchBuild only accepts instances with the same major.minor.build prefix, or without an os.version.
+	// This corresponds to the requirements of Windows process isolation.
+	OSVersionMatchBuild
+	// OSVersionMatchExact only accepts instances with exactly the OSVersionChoice os.version, or without an os.version.
+	OSVersionMatchExact
+)
+
 // NewOptionalBool converts the input bool into either OptionalBoolTrue or
 // OptionalBoolFalse.  The function is meant to avoid boilerplate code of users.
 func NewOptionalBool(b bool) OptionalBool {
@@ -551,6 +585,10 @@ const (
 	// Note that if only one unqualified-search registry is set, it will be
 	// used without prompting.
 	ShortNameModeEnforcing
+	// Refuse to resolve short names at all, including via aliases and
+	// unqualified-search registries; only fully-qualified references
+	// can be used.
+	ShortNameModeForbidden
 )
 
 // SystemContext allows parameterizing access to implicitly-accessed resources,
@@ -570,12 +608,23 @@ type SystemContext struct {
 	// === Global configuration overrides ===
 	// If not "", overrides the system's default path for signature.Policy configuration.
 	SignaturePolicyPath string
+	// If not nil, the contents of the signature.Policy configuration to use in signature.DefaultPolicy, instead of reading a file.
+	// This takes precedence over SignaturePolicyPath and the default per-user and system-wide paths.
+	SignaturePolicyBytes []byte
+	// If not empty, references ($NAME or ${NAME}) to these environment variables in file paths of a policy loaded by signature.DefaultPolicy
+	// (e.g. keyPath, keyPaths, caPath, rekorPublicKeyPath) are expanded; other fields, and references to other variables, are not modified.
+	// By default, no expansion happens.
+	SignaturePolicyPathEnvironmentVariables []string
 	// If not "", overrides the system's default path for registries.d (Docker signature storage configuration)
 	RegistriesDirPath string
 	// Path to the system-wide registries configuration file
 	SystemRegistriesConfPath string
 	// Path to the system-wide registries configuration directory
 	SystemRegistriesConfDirPath string
+	// If not nil, the contents of the registries configuration file to use, instead of reading SystemRegistriesConfPath
+	// or the default per-user or system-wide file.
+	// Drop-in configuration files are still read as usual; set SystemRegistriesConfDirPath to a nonexistent directory to avoid using them.
+	SystemRegistriesConfBytes []byte
 	// Path to the user-specific short-names configuration file
 	UserShortNameAliasConfPath string
 	// If set, short-name resolution in pkg/shortnames must follow the specified mode
@@ -587,6 +636,12 @@ type SystemContext struct {
 	PodmanOnlyShortNamesIgnoreRegistriesConfAndForceDockerHub bool
 	// If not "", overrides the default path for the registry authentication file, but only new format files
 	AuthFilePath string
+	// If set, AuthFilePath must be set as well, and AuthFilePath is the only source of registry credentials:
+	// the default auth file locations (including $HOME/.docker/config.json and $HOME/.dockercfg) and the credential helpers
+	// configured in registries.conf are not consulted, neither for reading nor for writing.
+	// Credential helpers referenced by "credHelpers" entries in AuthFilePath itself are still used.
+	// DockerAuthConfig and DockerBearerRegistryToken, if set, still take precedence over AuthFilePath.
+	AuthFilePathOnly bool
 	// if not "", overrides the default path for the registry authentication file, but with the legacy format;
 	// the code currently will by default look for legacy format files like .dockercfg in the $HOME dir;
 	// but in addition to the home dir, openshift may mount .dockercfg files (via secret mount)
@@ -598,18 +653,58 @@ type SystemContext struct {
 	// This must not be set if AuthFilePath is set.
 	// Only credentials and credential helpers in this file apre processed, not any other configuration in this file.
 	DockerCompatAuthFilePath string
+	// If true, and the $CREDENTIALS_DIRECTORY environment variable is set (as it is for systemd services using LoadCredential= or SetCredential=),
+	// registry credentials are first looked up in that directory, in files named "registry-auth.$registry" (e.g. "registry-auth.quay.io")
+	// containing a single auth file entry (e.g. {"auth": "$base64(username:password)"}). A missing directory or file is not an error.
+	// Such credentials take precedence over auth files and credential helpers, but not over DockerAuthConfig; they are never modified.
+	UseSystemdCredentials bool
 	// If not "", overrides the use of platform.GOARCH when choosing an image or verifying architecture match.
 	ArchitectureChoice string
 	// If not "", overrides the use of platform.GOOS when choosing an image or verifying OS match.
 	OSChoice string
 	// If not "", overrides the use of detected ARM platform variant when choosing an image or verifying variant match.
 	VariantChoice string
+	// If not "", the OS version (e.g. "10.0.17763.1879" for Windows) to match against the os.version of instances
+	// when choosing an image from a multi-platform image; see OSVersionMatch.
+	OSVersionChoice string
+	// Specifies which instances are acceptable when OSVersionChoice is set; the default is OSVersionMatchPreferred.
+	OSVersionMatch OSVersionMatch
 	// If not "", overrides the system's default directory containing a blob info cache.
 	BlobInfoCacheDir string
 	// Additional tags when creating or copying a docker-archive.
 	DockerArchiveAdditionalTags []reference.NamedTagged
 	// If not "", overrides the temporary directory to use for storing big files
 	BigFilesTemporaryDir string
+	// If not 0, the maximum size, in bytes, of a manifest read into memory from an image source.
+	// The default is 4 MiB, which matches the limit enforced by registries.
+	MaxManifestSize int
+	// If not 0, the maximum size, in bytes, of an image config blob read into memory from an image source.
+	// The default is 4 MiB.
+	MaxConfigSize int
+	// If not 0, the maximum number of layers accepted in a single-image manifest read from an image source.
+	// The default is 1024.
+	MaxLayerCount int
+	// If not 0, the maximum size, in bytes, of a file read into memory by image.ReadFile.
+	// The default is 64 MiB.
+	MaxReadFileSize int
+	// If true, Docker schema1 manifests, which are deprecated, are refused: images using them can not be read (using any transport),
+	// and container registries are not sent such manifests.
+	DisableSchema1 bool
+	// If true, the contents of layers fetched from the URLs listed in a manifest (“foreign” / non-distributable layers)
+	// are not verified to match the digest and size in the manifest when reading them.
+	// This is insecure, and only exists for compatibility with servers that serve modified content.
+	SkipForeignLayerVerification bool
+	// If not 0, the maximum number of blobs copy.Image reads concurrently from an image source using this context.
+	// This is ignored if copy.Options.MaxParallelDownloads or copy.Options.ConcurrentBlobCopiesSemaphore is set.
+	MaxParallelDownloads uint
+	// If not 0, copy.Image refuses, before copying any data, to copy an image from an image source using this context
+	// if it references more than this many blobs (layers, counting duplicates, and the config).
+	// For multi-image copies, this applies to each copied instance separately.
+	MaxBlobsPerImage int
+	// If not empty, copy.Image only writes manifests and manifest lists of these MIME types to an image destination using this context,
+	// converting the image if necessary, and fails before copying any data if that is not possible.
+	// The types must also be supported by the destination transport; if not set, all types supported by the destination are used.
+	AllowedDestinationManifestMIMETypes []string
 
 	// === OCI.Transport overrides ===
 	// If not "", a directory containing a CA certificate (ending with ".crt"),
@@ -622,6 +717,21 @@ type SystemContext struct {
 	OCISharedBlobDirPath string
 	// Allow UnCompress image layer for OCI image layer
 	OCIAcceptUncompressedLayers bool
+	// If not nil, annotations added to the descriptor of the written image in the index.json of an OCI layout.
+	// Keys must use the reverse domain notation (e.g. "com.example.build.id"), and must not be "org.opencontainers.image.ref.name",
+	// which is set from the image reference instead.
+	OCIIndexAnnotations map[string]string
+	// If true, a gzip-compressed copy of the index of OCI layouts is written as index.json.gz, in addition to index.json,
+	// which can be much faster to read for very large indexes by consumers which support this extension.
+	// This is not a part of the OCI image layout specification; index.json is always written, so the layouts remain usable by all consumers.
+	// When reading, regardless of this option, index.json.gz is used instead of index.json only if it records
+	// the current size and modification time of index.json, i.e. if index.json was not modified since index.json.gz was written.
+	OCICompressIndex bool
+	// If true, sigstore signatures stored in OCI layouts as manifests referring to the image using their subject field
+	// (“referrers”) are returned when reading images.
+	// This is not the default because destinations which can not store signatures (including OCI layouts)
+	// would then require removing the signatures, and because it requires reading all manifests in the layout.
+	OCIReadReferrerSignatures bool
 
 	// === docker.Transport overrides ===
 	// If not "", a directory containing a CA certificate (ending with ".crt"),
@@ -633,13 +743,28 @@ type SystemContext struct {
 	DockerPerHostCertDirPath string
 	// Allow contacting container registries over HTTP, or HTTPS with failed TLS verification. Note that this does not affect other TLS connections.
 	DockerInsecureSkipTLSVerify OptionalBool
+	// Per-registry overrides of DockerInsecureSkipTLSVerify, keyed by registry host[:port] (e.g. "mirror.example.com:5000", or "docker.io");
+	// an entry which is not OptionalBoolUndefined takes precedence over DockerInsecureSkipTLSVerify and registries.conf for that registry only.
+	// This allows e.g. a one-off insecure pull from a single mirror without editing registries.conf.
+	DockerInsecureSkipTLSVerifyRegistries map[string]OptionalBool
+	// If not nil, informed about requests, transferred data and authentication performed by the docker: transport.
+	DockerMetrics DockerMetrics
 	// if nil, the library tries to parse ~/.docker/config.json to retrieve credentials
 	// Ignored if DockerBearerRegistryToken is non-empty.
 	DockerAuthConfig *DockerAuthConfig
 	// if not "", the library uses this registry token to authenticate to the registry
 	DockerBearerRegistryToken string
-	// if not "", an User-Agent header is added to each request when contacting a registry.
+	// if not "", the User-Agent header sent, verbatim, with each request when contacting a registry.
+	// If "", the default value is "containers/$version (github.com/containers/image)".
 	DockerRegistryUserAgent string
+	// If true, responses from registries are not requested using gzip transfer compression (“Accept-Encoding: gzip”).
+	// By default, such compression is requested, and transparently decompressed; this mostly benefits manifests and configs,
+	// and all digests are verified against the decompressed contents.
+	DockerDisableTransferCompression bool
+	// If not nil, used instead of the default net.Dialer to open network connections to registries (and to any authentication
+	// or proxy servers), e.g. to use a custom DNS resolver, or to connect to a specific IP address for a registry host name.
+	// TLS and proxy handling are unaffected: with a proxy, this is used to connect to the proxy.
+	DockerDialContext func(ctx context.Context, network, addr string) (net.Conn, error)
 	// if true, a V1 ping attempt isn't done to give users a better error. Default is false.
 	// Note that this field is used mainly to integrate containers/image into projectatomic/docker
 	// in order to not break any existing docker's integration tests.
@@ -655,6 +780,21 @@ type SystemContext struct {
 	// Note that this requires writing blobs to temporary files, and takes more time than the default behavior,
 	// when the digest for a blob is unknown.
 	DockerRegistryPushPrecomputeDigests bool
+	// If > 0, the docker destination uploads blobs in chunks of this many bytes, instead of in a single request.
+	// If 0, blobs are uploaded in a single request, falling back to chunked uploads (of a default size)
+	// if the registry rejects such an upload; to allow that, blobs are copied to a temporary file in BigFilesTemporaryDir.
+	DockerUploadChunkSize int64
+	// If not empty, repositories (e.g. "registry.example.com/shared/base") the docker destination
+	// tries to mount blobs from before consulting the blob info cache, in this order.
+	// Repositories which are not valid, or are on a different registry than the destination, are ignored with a warning.
+	BlobMountFromRepositories []string
+	// If not empty, the manifest MIME types to request from a container registry, in order of preference;
+	// any other supported MIME types are requested with a lower preference.
+	// All values must be included in manifest.DefaultRequestedManifestMIMETypes.
+	ManifestMIMETypeAcceptOrder []string
+	// If > 0, the maximum number of HTTP redirects followed for a single request to a container registry
+	// (e.g. a blob download redirected to object storage). If 0, a default of 10 is used.
+	DockerMaxRedirects int
 
 	// === docker/daemon.Transport overrides ===
 	// A directory containing a CA certificate (ending with ".crt"),
@@ -666,15 +806,54 @@ type SystemContext struct {
 	// Used to skip TLS verification, off by default. To take effect DockerDaemonCertPath needs to be specified as well.
 	DockerDaemonInsecureSkipTLSVerify bool
 
+	// === containers-storage.Transport overrides ===
+	// If true, images are written to containers-storage without verifying that their platform matches the runtime
+	// (or ArchitectureChoice/OSChoice/VariantChoice), e.g. to store a foreign-architecture image for later export.
+	// This must not be combined with ArchitectureChoice, OSChoice or VariantChoice.
+	StorageAllowForeignPlatform bool
+	// If not 0, the maximum size, in bytes, of the uncompressed contents of a layer written to containers-storage;
+	// layers which expand to more than this are rejected, to protect against decompression bombs.
+	// The default is 1 TiB.
+	StorageMaxUncompressedLayerSize int64
+	// If true, the original (compressed) form of layers written to containers-storage is recorded along with the layers,
+	// so that the image can later be read from containers-storage with the original layer digests.
+	// This roughly doubles the disk space used by the affected layers.
+	StoragePreserveCompressedLayers bool
+	// If true, a manifest read from containers-storage using a digested reference, or an instance digest, is verified
+	// to match that digest immediately, failing with an error if the stored data is corrupt.
+	// By default, such a mismatch is only detected later, by callers that validate manifest digests.
+	StorageRequireManifestDigestMatch bool
+	// If not empty, extended attributes with names starting with any of these prefixes (e.g. "security.") are removed
+	// from layers written to containers-storage, instead of being applied, for environments where applying them fails.
+	// WARNING: This changes the contents of the stored layers: e.g. removing "security.capability" removes file capabilities,
+	// so that binaries relying on them may fail, or require running with more privileges than necessary.
+	// The stored layers are identified by the DiffIDs of the filtered contents, and by layer IDs that depend on the prefixes,
+	// so they are never shared with layers stored without this option (or with different prefixes);
+	// they can not be pushed to other transports with the original digests.
+	// Partial (chunked) pulls are not used when this is set.
+	StorageSkipXattrPrefixes []string
+	// If not nil, the creation date recorded for images written to containers-storage, e.g. for reproducible builds.
+	// By default, the creation date is taken from the image config, if available.
+	StorageCreationDateOverride *time.Time
+	// If true, when an image is written to containers-storage using a tagged reference, a repo@digest name for the
+	// (top-level) manifest digest is added to the image’s names as well, so that the image can be looked up using either name.
+	StorageRecordDigestedName bool
+
 	// === dir.Transport overrides ===
 	// DirForceCompress compresses the image layers if set to true
 	DirForceCompress bool
 	// DirForceDecompress decompresses the image layers if set to true
 	DirForceDecompress bool
+	// If not "", the dir: transport stores sigstore signatures at this path relative to the image directory, instead of
+	// the default "signature-N" files. The path must contain "{index}", which is replaced by the 1-based index of the signature,
+	// e.g. "sigstore/signature-{index}.json". Signatures of per-platform instances use the file name prefixed by the instance digest.
+	// The same value must be used when reading the image.
+	DirSigstoreSignaturePattern string
 
 	// CompressionFormat is the format to use for the compression of the blobs
 	CompressionFormat *compression.Algorithm
-	// CompressionLevel specifies what compression level is used
+	// CompressionLevel specifies what compression level is used; if nil, the default of the compression algorithm is used.
+	// Valid values depend on the algorithm: -2…9 for gzip, 1…22 for zstd and zstd:chunked.
 	CompressionLevel *int
 }
 